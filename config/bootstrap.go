@@ -0,0 +1,37 @@
+package config
+
+import (
+	"bytes"
+	"os"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Bootstrap is read from a yaml file before the database is opened. dbPath applies on every start,
+// the panel settings are only written to a database the panel creates, so later changes made in the
+// panel are kept
+type Bootstrap struct {
+	DBPath   string `yaml:"dbPath"`
+	Listen   string `yaml:"listen"`
+	Port     int    `yaml:"port"`
+	BasePath string `yaml:"basePath"`
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+	// any other setting by its key, e.g. timeLocation: Asia/Tehran
+	Settings map[string]string `yaml:"settings"`
+}
+
+func LoadBootstrap(path string) (*Bootstrap, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	bootstrap := &Bootstrap{}
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	err = decoder.Decode(bootstrap)
+	if err != nil {
+		return nil, err
+	}
+	return bootstrap, nil
+}
@@ -45,7 +45,17 @@ func IsDebug() bool {
 	return os.Getenv("XUI_DEBUG") == "true"
 }
 
+var dbPath string
+
+// SetDBPath overrides the database location, e.g. with the --db-path flag
+func SetDBPath(path string) {
+	dbPath = path
+}
+
 func GetDBPath() string {
+	if dbPath != "" {
+		return dbPath
+	}
 	path := fmt.Sprintf("/home/loop/.config/%s/%s.db", GetName(), GetName())
 	fmt.Println(path)
 	return path
@@ -1,6 +1,7 @@
 package database
 
 import (
+	"context"
 	"io/fs"
 	"os"
 	"path"
@@ -8,12 +9,12 @@ import (
 	"x-ui/database/model"
 	"x-ui/xray"
 
-	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
 	"gorm.io/gorm/logger"
 )
 
 var db *gorm.DB
+var dbFile string
 
 func initUser() error {
 	err := db.AutoMigrate(&model.User{})
@@ -46,7 +47,92 @@ func initClientTraffic() error {
 	return db.AutoMigrate(&xray.ClientTraffic{})
 }
 
+func initClientIpHistory() error {
+	return db.AutoMigrate(&model.ClientIpHistory{})
+}
+
+func initAlertRule() error {
+	return db.AutoMigrate(&model.AlertRule{})
+}
+
+func initSpeedTestResult() error {
+	return db.AutoMigrate(&model.SpeedTestResult{})
+}
+
+func initTrafficHistory() error {
+	return db.AutoMigrate(&model.TrafficHistory{})
+}
+
+func initNode() error {
+	return db.AutoMigrate(&model.Node{})
+}
+
+func initInboundReplica() error {
+	return db.AutoMigrate(&model.InboundReplica{})
+}
+
+func initNodeTraffic() error {
+	return db.AutoMigrate(&model.NodeTraffic{})
+}
+
+func initWebhook() error {
+	return db.AutoMigrate(&model.Webhook{})
+}
+
+func initPlan() error {
+	return db.AutoMigrate(&model.Plan{})
+}
+
+func initClientPlan() error {
+	return db.AutoMigrate(&model.ClientPlan{})
+}
+
+func initPayment() error {
+	return db.AutoMigrate(&model.Payment{})
+}
+
+func initVoucher() error {
+	return db.AutoMigrate(&model.Voucher{})
+}
+
+func initTrialClaim() error {
+	return db.AutoMigrate(&model.TrialClaim{})
+}
+
+func initTrafficCycle() error {
+	return db.AutoMigrate(&model.TrafficCycle{})
+}
+
+func initCertificate() error {
+	return db.AutoMigrate(&model.Certificate{})
+}
+
+func initPolicyProfile() error {
+	return db.AutoMigrate(&model.PolicyProfile{})
+}
+
+func initPortForward() error {
+	return db.AutoMigrate(&model.PortForward{})
+}
+
+func initTrialRequest() error {
+	return db.AutoMigrate(&model.TrialRequest{})
+}
+
+func initApiToken() error {
+	return db.AutoMigrate(&model.ApiToken{})
+}
+
+func initCountryTraffic() error {
+	return db.AutoMigrate(&model.CountryTraffic{})
+}
+
+func initOutboundLatency() error {
+	return db.AutoMigrate(&model.OutboundLatency{})
+}
+
 func InitDB(dbPath string) error {
+	dbFile = dbPath
 	dir := path.Dir(dbPath)
 	err := os.MkdirAll(dir, fs.ModeDir)
 	if err != nil {
@@ -64,7 +150,11 @@ func InitDB(dbPath string) error {
 	c := &gorm.Config{
 		Logger: gormLogger,
 	}
-	db, err = gorm.Open(sqlite.Open(dbPath), c)
+	db, err = openDB(dbPath, c)
+	if err != nil {
+		return err
+	}
+	err = registerTracing(db)
 	if err != nil {
 		return err
 	}
@@ -85,6 +175,90 @@ func InitDB(dbPath string) error {
 	if err != nil {
 		return err
 	}
+	err = initClientIpHistory()
+	if err != nil {
+		return err
+	}
+	err = initAlertRule()
+	if err != nil {
+		return err
+	}
+	err = initSpeedTestResult()
+	if err != nil {
+		return err
+	}
+	err = initTrafficHistory()
+	if err != nil {
+		return err
+	}
+	err = initNode()
+	if err != nil {
+		return err
+	}
+	err = initInboundReplica()
+	if err != nil {
+		return err
+	}
+	err = initNodeTraffic()
+	if err != nil {
+		return err
+	}
+	err = initWebhook()
+	if err != nil {
+		return err
+	}
+	err = initPlan()
+	if err != nil {
+		return err
+	}
+	err = initClientPlan()
+	if err != nil {
+		return err
+	}
+	err = initPayment()
+	if err != nil {
+		return err
+	}
+	err = initVoucher()
+	if err != nil {
+		return err
+	}
+	err = initTrialClaim()
+	if err != nil {
+		return err
+	}
+	err = initTrafficCycle()
+	if err != nil {
+		return err
+	}
+	err = initCertificate()
+	if err != nil {
+		return err
+	}
+	err = initPolicyProfile()
+	if err != nil {
+		return err
+	}
+	err = initPortForward()
+	if err != nil {
+		return err
+	}
+	err = initTrialRequest()
+	if err != nil {
+		return err
+	}
+	err = initApiToken()
+	if err != nil {
+		return err
+	}
+	err = initCountryTraffic()
+	if err != nil {
+		return err
+	}
+	err = initOutboundLatency()
+	if err != nil {
+		return err
+	}
 	
 	return nil
 }
@@ -93,6 +267,52 @@ func GetDB() *gorm.DB {
 	return db
 }
 
+// Close closes the database if it is open, GetDB can not be used until InitDB is called again
+func Close() error {
+	if db == nil {
+		return nil
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		return err
+	}
+	db = nil
+	return sqlDB.Close()
+}
+
+func Ping() error {
+	sqlDB, err := db.DB()
+	if err != nil {
+		return err
+	}
+	return sqlDB.Ping()
+}
+
+func GetDBSize() (int64, error) {
+	info, err := os.Stat(dbFile)
+	if err != nil {
+		return 0, err
+	}
+	return info.Size(), nil
+}
+
+// Backup writes a consistent copy of the database to path, which must not exist yet. A cancelled ctx
+// interrupts the copy and removes what was written, a file that existed is left alone
+func Backup(ctx context.Context, path string) error {
+	// the file is created here, so only this call writes to it and may remove it, sqlite copies into
+	// an empty file
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	file.Close()
+	err = db.WithContext(ctx).Exec("VACUUM INTO ?", path).Error
+	if err != nil {
+		os.Remove(path)
+	}
+	return err
+}
+
 func IsNotFound(err error) bool {
 	return err == gorm.ErrRecordNotFound
 }
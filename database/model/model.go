@@ -2,6 +2,8 @@ package model
 
 import (
 	"fmt"
+	"strconv"
+	"strings"
 	"x-ui/util/json_util"
 	"x-ui/xray"
 )
@@ -11,7 +13,7 @@ type Protocol string
 const (
 	VMess       Protocol = "vmess"
 	VLESS       Protocol = "vless"
-	Dokodemo    Protocol = "Dokodemo-door"
+	Dokodemo    Protocol = "dokodemo-door"
 	Http        Protocol = "http"
 	Trojan      Protocol = "trojan"
 	Shadowsocks Protocol = "shadowsocks"
@@ -21,18 +23,31 @@ type User struct {
 	Id       int    `json:"id" gorm:"primaryKey;autoIncrement"`
 	Username string `json:"username"`
 	Password string `json:"password"`
+	// viewers can see everything but change nothing
+	Viewer bool `json:"viewer"`
 }
 
 type Inbound struct {
-	Id          int                  `json:"id" form:"id" gorm:"primaryKey;autoIncrement"`
-	UserId      int                  `json:"-"`
-	Up          int64                `json:"up" form:"up"`
-	Down        int64                `json:"down" form:"down"`
-	Total       int64                `json:"total" form:"total"`
-	Remark      string               `json:"remark" form:"remark"`
-	Enable      bool                 `json:"enable" form:"enable"`
-	ExpiryTime  int64                `json:"expiryTime" form:"expiryTime"`
-	ClientStats []xray.ClientTraffic `gorm:"foreignKey:InboundId;references:Id" json:"clientStats" form:"clientStats"`
+	Id              int                  `json:"id" form:"id" gorm:"primaryKey;autoIncrement"`
+	UserId          int                  `json:"-"`
+	Up              int64                `json:"up" form:"up"`
+	Down            int64                `json:"down" form:"down"`
+	Total           int64                `json:"total" form:"total"`
+	Remark          string               `json:"remark" form:"remark"`
+	Enable          bool                 `json:"enable" form:"enable"`
+	ExpiryTime      int64                `json:"expiryTime" form:"expiryTime"`
+	ResetDay        int                  `json:"resetDay" form:"resetDay"`
+	LastReset       int64                `json:"lastReset" form:"-"`
+	CountryMode     string               `json:"countryMode" form:"countryMode"`
+	Countries       string               `json:"countries" form:"countries"`
+	CertificateId   int                  `json:"certificateId" form:"certificateId"`
+	MuxConcurrency  int                  `json:"muxConcurrency" form:"muxConcurrency"`
+	XudpConcurrency int                  `json:"xudpConcurrency" form:"xudpConcurrency"`
+	XudpProxyUDP443 string               `json:"xudpProxyUDP443" form:"xudpProxyUDP443"`
+	PortHopping     string               `json:"portHopping" form:"portHopping"`
+	ExtraPorts      string               `json:"extraPorts" form:"extraPorts"`
+	Notes           string               `json:"notes" form:"notes"`
+	ClientStats     []xray.ClientTraffic `gorm:"foreignKey:InboundId;references:Id" json:"clientStats" form:"clientStats"`
 
 	// config part
 	Listen         string   `json:"listen" form:"listen"`
@@ -44,14 +59,35 @@ type Inbound struct {
 	Sniffing       string   `json:"sniffing" form:"sniffing"`
 }
 
+// Ports returns Port followed by the extra ports of the inbound, entries that are no port are skipped
+func (i *Inbound) Ports() []int {
+	ports := []int{i.Port}
+	for _, field := range strings.Split(i.ExtraPorts, ",") {
+		port, err := strconv.Atoi(strings.TrimSpace(field))
+		if err == nil && port > 0 {
+			ports = append(ports, port)
+		}
+	}
+	return ports
+}
+
 func (i *Inbound) GenXrayInboundConfig() *xray.InboundConfig {
 	listen := i.Listen
 	if listen != "" {
 		listen = fmt.Sprintf("\"%v\"", listen)
 	}
+	// xray takes a comma separated list of ports as a string
+	port := strconv.Itoa(i.Port)
+	if ports := i.Ports(); len(ports) > 1 {
+		list := make([]string, 0, len(ports))
+		for _, p := range ports {
+			list = append(list, strconv.Itoa(p))
+		}
+		port = fmt.Sprintf("\"%v\"", strings.Join(list, ","))
+	}
 	return &xray.InboundConfig{
 		Listen:         json_util.RawMessage(listen),
-		Port:           i.Port,
+		Port:           json_util.RawMessage(port),
 		Protocol:       string(i.Protocol),
 		Settings:       json_util.RawMessage(i.Settings),
 		StreamSettings: json_util.RawMessage(i.StreamSettings),
@@ -68,9 +104,264 @@ type Setting struct {
 
 type Client struct {
 	ID         string `json:"id"`
+	Password   string `json:"password"`
 	AlterIds   uint16 `json:"alterId"`
 	Email      string `json:"email"`
 	Security   string `json:"security"`
 	TotalGB    int64  `json:"totalGB" form:"totalGB"`
 	ExpiryTime int64  `json:"expiryTime" form:"expiryTime"`
+	ResetDay   int    `json:"resetDay" form:"resetDay"`
+}
+
+type ClientIpHistory struct {
+	Id        int    `json:"id" gorm:"primaryKey;autoIncrement"`
+	Email     string `json:"email" gorm:"uniqueIndex:idx_client_ip"`
+	IP        string `json:"ip" gorm:"uniqueIndex:idx_client_ip"`
+	Country   string `json:"country"`
+	Asn       uint   `json:"asn"`
+	AsnOrg    string `json:"asnOrg"`
+	FirstSeen int64  `json:"firstSeen"`
+	LastSeen  int64  `json:"lastSeen"`
+}
+
+type AlertRule struct {
+	Id         int     `json:"id" form:"id" gorm:"primaryKey;autoIncrement"`
+	Name       string  `json:"name" form:"name"`
+	Enable     bool    `json:"enable" form:"enable"`
+	Metric     string  `json:"metric" form:"metric"`
+	Comparator string  `json:"comparator" form:"comparator"`
+	Threshold  float64 `json:"threshold" form:"threshold"`
+	// seconds the condition has to hold before the alert fires
+	Duration    int64  `json:"duration" form:"duration"`
+	Destination string `json:"destination" form:"destination"`
+	Target      string `json:"target" form:"target"`
+}
+
+type SpeedTestResult struct {
+	Id    int    `json:"id" gorm:"primaryKey;autoIncrement"`
+	Time  int64  `json:"time"`
+	Proxy string `json:"proxy"`
+	// Outbound is the tag of the outbound tested through, if any
+	Outbound string `json:"outbound"`
+	// latency in milliseconds, speeds in bits per second
+	Latency  float64 `json:"latency"`
+	Download float64 `json:"download"`
+	Upload   float64 `json:"upload"`
+	Error    string  `json:"error"`
+}
+
+// TrafficHistory holds the traffic of one inbound during one minute
+type TrafficHistory struct {
+	Id   int    `json:"id" gorm:"primaryKey;autoIncrement"`
+	Tag  string `json:"tag" gorm:"uniqueIndex:idx_traffic_history"`
+	Time int64  `json:"time" gorm:"uniqueIndex:idx_traffic_history"`
+	Up   int64  `json:"up"`
+	Down int64  `json:"down"`
+	// what the inbound was when the traffic was recorded, it stays after the inbound changed or is gone
+	Protocol  string `json:"protocol"`
+	Transport string `json:"transport"`
+	Security  string `json:"security"`
+}
+
+// CountryTraffic is the client traffic of an hour by the country the clients were online from,
+// Country is ZZ where geoip knows no country
+type CountryTraffic struct {
+	Id      int    `json:"id" gorm:"primaryKey;autoIncrement"`
+	Country string `json:"country" gorm:"uniqueIndex:idx_country_traffic"`
+	Time    int64  `json:"time" gorm:"uniqueIndex:idx_country_traffic"`
+	Up      int64  `json:"up"`
+	Down    int64  `json:"down"`
+}
+
+// OutboundLatency is one probe of the latency probe urls through an outbound, Latency is the fastest
+// answer in milliseconds, Error is set for a failed probe
+type OutboundLatency struct {
+	Id      int     `json:"id" gorm:"primaryKey;autoIncrement"`
+	Tag     string  `json:"tag" gorm:"index:idx_outbound_latency"`
+	Time    int64   `json:"time" gorm:"index:idx_outbound_latency"`
+	Latency float64 `json:"latency"`
+	Error   string  `json:"error"`
+}
+
+// Node is a remote x-ui running in agent mode, managed by this panel
+type Node struct {
+	Id            int    `json:"id" form:"id" gorm:"primaryKey;autoIncrement"`
+	Name          string `json:"name" form:"name"`
+	Address       string `json:"address" form:"address"`
+	Token         string `json:"token" form:"token"`
+	AllowInsecure bool   `json:"allowInsecure" form:"allowInsecure"`
+	Enable        bool   `json:"enable" form:"enable"`
+
+	// health, updated by the panel, not by the user
+	Online    bool    `json:"online" form:"-"`
+	LastCheck int64   `json:"lastCheck" form:"-"`
+	LastSeen  int64   `json:"lastSeen" form:"-"`
+	XrayState string  `json:"xrayState" form:"-"`
+	Cpu       float64 `json:"cpu" form:"-"`
+	Load      float64 `json:"load" form:"-"`
+	Error     string  `json:"error" form:"-"`
+}
+
+// InboundReplica pushes an inbound to a node, Port and Listen override the local values when set
+type InboundReplica struct {
+	Id        int    `json:"id" form:"id" gorm:"primaryKey;autoIncrement"`
+	InboundId int    `json:"inboundId" form:"inboundId" gorm:"index"`
+	NodeId    int    `json:"nodeId" form:"nodeId"`
+	Port      int    `json:"port" form:"port"`
+	Listen    string `json:"listen" form:"listen"`
+	RemoteId  int    `json:"remoteId" form:"remoteId"`
+	LastSync  int64  `json:"lastSync" form:"lastSync"`
+	LastError string `json:"lastError" form:"lastError"`
+}
+
+// NodeTraffic is the last client counter read from a node, to turn its totals into increments
+type NodeTraffic struct {
+	Id     int    `json:"id" gorm:"primaryKey;autoIncrement"`
+	NodeId int    `json:"nodeId" gorm:"uniqueIndex:idx_node_traffic"`
+	Email  string `json:"email" gorm:"uniqueIndex:idx_node_traffic"`
+	Up     int64  `json:"up"`
+	Down   int64  `json:"down"`
+}
+
+// Webhook receives panel events, Events is a comma separated filter where empty means all events
+type Webhook struct {
+	Id     int    `json:"id" form:"id" gorm:"primaryKey;autoIncrement"`
+	Name   string `json:"name" form:"name"`
+	Url    string `json:"url" form:"url"`
+	Secret string `json:"secret" form:"secret"`
+	Events string `json:"events" form:"events"`
+	Enable bool   `json:"enable" form:"enable"`
+}
+
+// Plan is what a client can be sold: Traffic bytes for Days days, provisioned on the inbound InboundId
+type Plan struct {
+	Id        int     `json:"id" form:"id" gorm:"primaryKey;autoIncrement"`
+	Name      string  `json:"name" form:"name"`
+	Traffic   int64   `json:"traffic" form:"traffic"`
+	Days      int     `json:"days" form:"days"`
+	Price     float64 `json:"price" form:"price"`
+	Currency  string  `json:"currency" form:"currency"`
+	InboundId int     `json:"inboundId" form:"inboundId"`
+	Enable    bool    `json:"enable" form:"enable"`
+}
+
+// ClientPlan is the plan a client renews on, used when a payment names only the client
+type ClientPlan struct {
+	Id     int    `json:"id" form:"id" gorm:"primaryKey;autoIncrement"`
+	Email  string `json:"email" form:"email" gorm:"uniqueIndex"`
+	PlanId int    `json:"planId" form:"planId"`
+}
+
+// Payment is a payment received from a gateway, ExternalId makes deliveries of the same payment count once.
+// ExpiryTime and Traffic are the expiry and quota of the client after the payment renewed it
+type Payment struct {
+	Id         int     `json:"id" gorm:"primaryKey;autoIncrement"`
+	Provider   string  `json:"provider" gorm:"uniqueIndex:idx_payment"`
+	ExternalId string  `json:"externalId" gorm:"uniqueIndex:idx_payment"`
+	Email      string  `json:"email"`
+	PlanId     int     `json:"planId"`
+	Amount     float64 `json:"amount"`
+	Currency   string  `json:"currency"`
+	Time       int64   `json:"time"`
+	ExpiryTime int64   `json:"expiryTime"`
+	Traffic    int64   `json:"traffic"`
+}
+
+// Voucher credits Traffic bytes and Days days to the client that redeems it first
+type Voucher struct {
+	Id        int    `json:"id" form:"id" gorm:"primaryKey;autoIncrement"`
+	Code      string `json:"code" form:"code" gorm:"uniqueIndex"`
+	Traffic   int64  `json:"traffic" form:"traffic"`
+	Days      int    `json:"days" form:"days"`
+	CreatedAt int64  `json:"createdAt" form:"createdAt"`
+	UsedBy    string `json:"usedBy" form:"usedBy"`
+	UsedAt    int64  `json:"usedAt" form:"usedAt"`
+}
+
+// TrialClaim remembers who got a trial client, Source is "ip:<address>" or "tg:<user id>"
+type TrialClaim struct {
+	Id     int    `json:"id" gorm:"primaryKey;autoIncrement"`
+	Source string `json:"source" gorm:"uniqueIndex"`
+	Email  string `json:"email"`
+	Time   int64  `json:"time"`
+}
+
+// TrialRequest is a trial waiting for an admin to approve it, ChatId is the telegram chat of the requester
+// and Token lets a web requester fetch the link once the trial is approved
+type TrialRequest struct {
+	Id      int    `json:"id" gorm:"primaryKey;autoIncrement"`
+	Source  string `json:"source" gorm:"index"`
+	Address string `json:"-"`
+	ChatId  int64  `json:"-"`
+	Token   string `json:"token"`
+	Status  string `json:"status"`
+	Time    int64  `json:"time"`
+	Email   string `json:"email"`
+	Link    string `json:"link"`
+}
+
+// TrafficCycle archives the traffic of an inbound or client for one billing cycle, Name is the
+// inbound tag or the client email
+type TrafficCycle struct {
+	Id        int    `json:"id" gorm:"primaryKey;autoIncrement"`
+	Kind      string `json:"kind" gorm:"index:idx_traffic_cycle"`
+	Name      string `json:"name" gorm:"index:idx_traffic_cycle"`
+	StartTime int64  `json:"startTime"`
+	EndTime   int64  `json:"endTime"`
+	Up        int64  `json:"up"`
+	Down      int64  `json:"down"`
+}
+
+// Certificate is a tls certificate and its key in PEM form, inbounds and the panel refer to it by id.
+// Domains and ExpiryTime are read from the certificate when it is saved, Managed ones were issued through ACME
+// by the panel, which renews them
+type Certificate struct {
+	Id         int    `json:"id" form:"id" gorm:"primaryKey;autoIncrement"`
+	Name       string `json:"name" form:"name"`
+	Cert       string `json:"cert" form:"cert"`
+	Key        string `json:"key" form:"key"`
+	Domains    string `json:"domains" form:"domains"`
+	ExpiryTime int64  `json:"expiryTime" form:"expiryTime"`
+	Managed    bool   `json:"managed" form:"managed"`
+}
+
+// PolicyProfile is a named xray policy level, clients use it through the level in their settings.
+// Timeouts are seconds and BufferSize is KB, zero timeouts and a negative BufferSize keep xray's defaults
+type PolicyProfile struct {
+	Id                int    `json:"id" form:"id" gorm:"primaryKey;autoIncrement"`
+	Name              string `json:"name" form:"name"`
+	Level             int    `json:"level" form:"level" gorm:"unique"`
+	Handshake         int    `json:"handshake" form:"handshake"`
+	ConnIdle          int    `json:"connIdle" form:"connIdle"`
+	UplinkOnly        int    `json:"uplinkOnly" form:"uplinkOnly"`
+	DownlinkOnly      int    `json:"downlinkOnly" form:"downlinkOnly"`
+	BufferSize        int    `json:"bufferSize" form:"bufferSize"`
+	StatsUserUplink   bool   `json:"statsUserUplink" form:"statsUserUplink"`
+	StatsUserDownlink bool   `json:"statsUserDownlink" form:"statsUserDownlink"`
+}
+
+// PortForward forwards connections to Port to Address:DestPort through a dokodemo-door inbound of xray,
+// Network is tcp, udp or tcp,udp
+type PortForward struct {
+	Id       int    `json:"id" form:"id" gorm:"primaryKey;autoIncrement"`
+	Remark   string `json:"remark" form:"remark"`
+	Enable   bool   `json:"enable" form:"enable"`
+	Listen   string `json:"listen" form:"listen"`
+	Port     int    `json:"port" form:"port"`
+	Network  string `json:"network" form:"network"`
+	Address  string `json:"address" form:"address"`
+	DestPort int    `json:"destPort" form:"destPort"`
+}
+
+// ApiToken authenticates api requests as Authorization: Bearer <token>, only the sha256 of the token is
+// stored. Role is admin, operator or viewer and ExpiryTime is in milliseconds, 0 never expires
+type ApiToken struct {
+	Id         int    `json:"id" gorm:"primaryKey;autoIncrement"`
+	Name       string `json:"name"`
+	Role       string `json:"role"`
+	Hash       string `json:"-" gorm:"uniqueIndex"`
+	Prefix     string `json:"prefix"`
+	ExpiryTime int64  `json:"expiryTime"`
+	CreateTime int64  `json:"createTime"`
+	LastUsed   int64  `json:"lastUsed"`
 }
@@ -0,0 +1,170 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/callbacks"
+)
+
+// a write that still finds the database busy after the busy timeout of the driver is retried this
+// often, waiting twice as long every time
+const (
+	writeRetries = 4
+	writeBackoff = time.Millisecond * 100
+)
+
+// writeQueue lets one statement outside of transactions write at a time, so the writes of the panel
+// wait for each other here instead of failing on the database lock. It is held only while a statement
+// runs, not while a busy one waits for its retry
+var writeQueue sync.Mutex
+
+// failedWritesWindow is how far back FailedWrites counts, so writes that succeed in between do not
+// hide the ones that failed
+const failedWritesWindow = time.Minute * 10
+
+// failedWrites counts the writes that failed because the database stayed busy, per minute of the
+// last failedWritesWindow
+var failedWrites struct {
+	sync.Mutex
+	minutes [failedWritesWindow / time.Minute]int64
+	counts  [failedWritesWindow / time.Minute]int64
+}
+
+// IsBusy tells whether the error is sqlite reporting the database or a table as locked
+func IsBusy(err error) bool {
+	var sqliteErr sqlite3.Error
+	if errors.As(err, &sqliteErr) {
+		return sqliteErr.Code == sqlite3.ErrBusy || sqliteErr.Code == sqlite3.ErrLocked
+	}
+	return false
+}
+
+// IsDuplicate tells whether the error is sqlite refusing a row that a unique index already has
+func IsDuplicate(err error) bool {
+	var sqliteErr sqlite3.Error
+	if errors.As(err, &sqliteErr) {
+		return sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique || sqliteErr.ExtendedCode == sqlite3.ErrConstraintPrimaryKey
+	}
+	return false
+}
+
+// FailedWrites returns how many writes failed because the database stayed busy in the last failedWritesWindow
+func FailedWrites() int64 {
+	failedWrites.Lock()
+	defer failedWrites.Unlock()
+	now := time.Now().Unix() / 60
+	var count int64
+	for i, minute := range failedWrites.minutes {
+		if now-minute < int64(len(failedWrites.minutes)) {
+			count += failedWrites.counts[i]
+		}
+	}
+	return count
+}
+
+func addFailedWrite() {
+	failedWrites.Lock()
+	defer failedWrites.Unlock()
+	now := time.Now().Unix() / 60
+	i := now % int64(len(failedWrites.minutes))
+	if failedWrites.minutes[i] != now {
+		failedWrites.minutes[i] = now
+		failedWrites.counts[i] = 0
+	}
+	failedWrites.counts[i]++
+}
+
+// retryBusy runs write until it does not fail with a busy database or the retries are used up
+func retryBusy(ctx context.Context, write func() error) error {
+	backoff := writeBackoff
+	err := write()
+	for i := 0; i < writeRetries && IsBusy(err); i++ {
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+		err = write()
+	}
+	if IsBusy(err) {
+		addFailedWrite()
+	}
+	return err
+}
+
+// dialector is the sqlite dialector without RETURNING clauses, gorm sends queries with them through QueryContext
+// and sqlite reports a busy database only while reading their rows. Without them every write is run by
+// ExecContext, where the pool queues and retries it, and gorm reads the ids of inserts from LastInsertId
+type dialector struct {
+	sqlite.Dialector
+}
+
+func (d dialector) Initialize(db *gorm.DB) error {
+	db.ConnPool = d.Conn
+	callbacks.RegisterDefaultCallbacks(db, &callbacks.Config{
+		LastInsertIDReversed: true,
+	})
+	for name, builder := range d.ClauseBuilders() {
+		db.ClauseBuilders[name] = builder
+	}
+	return nil
+}
+
+// openDB opens the database of the dsn with the pool that queues and retries writes. Transactions begin
+// immediate, they take the write lock at their start and find the database busy only there
+func openDB(dsn string, config *gorm.Config) (*gorm.DB, error) {
+	if strings.Contains(dsn, "?") {
+		dsn += "&_txlock=immediate"
+	} else {
+		dsn += "?_txlock=immediate"
+	}
+	conn, err := sql.Open(sqlite.DriverName, dsn)
+	if err != nil {
+		return nil, err
+	}
+	return gorm.Open(dialector{sqlite.Dialector{DSN: dsn, Conn: &retryPool{DB: conn}}}, config)
+}
+
+// retryPool is the connection pool gorm uses, it queues and retries statements that write
+type retryPool struct {
+	*sql.DB
+}
+
+func (p *retryPool) ExecContext(ctx context.Context, query string, args ...interface{}) (result sql.Result, err error) {
+	err = retryBusy(ctx, func() error {
+		writeQueue.Lock()
+		defer writeQueue.Unlock()
+		result, err = p.DB.ExecContext(ctx, query, args...)
+		return err
+	})
+	return result, err
+}
+
+// BeginTx retries the start of transactions, the only place they find the database busy. Nothing of a
+// transaction ran when its start fails, so this retries the whole of it. Statements in a transaction
+// are not retried on their own, and transactions are not queued as they may run other queries while open
+func (p *retryPool) BeginTx(ctx context.Context, opts *sql.TxOptions) (gorm.ConnPool, error) {
+	var tx *sql.Tx
+	err := retryBusy(ctx, func() (err error) {
+		tx, err = p.DB.BeginTx(ctx, opts)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return tx, nil
+}
+
+// GetDBConn is how gorm finds the sql.DB behind the pool, e.g. for Ping
+func (p *retryPool) GetDBConn() (*sql.DB, error) {
+	return p.DB, nil
+}
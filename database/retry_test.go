@@ -0,0 +1,141 @@
+package database
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+	"time"
+	"x-ui/database/model"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// openBusyDB opens a database that reports a busy lock at once instead of waiting for it, and a second
+// connection to the same file that can hold the lock
+func openBusyDB(t *testing.T) (*gorm.DB, *sql.DB) {
+	path := filepath.Join(t.TempDir(), "x-ui.db")
+	gormDB, err := openDB(path+"?_busy_timeout=0", &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = gormDB.AutoMigrate(&model.Setting{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	locker, err := sql.Open(sqlite.DriverName, path+"?_busy_timeout=0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		locker.Close()
+		if sqlDB, err := gormDB.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	return gormDB, locker
+}
+
+// lock starts a write on the locker and ends it after hold, other connections find the database busy meanwhile
+func lock(t *testing.T, locker *sql.DB, hold time.Duration) {
+	tx, err := locker.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = tx.Exec("insert into settings (key, value) values ('lock', '')")
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.AfterFunc(hold, func() {
+		tx.Commit()
+	})
+}
+
+func TestCreateRetriedWhileBusy(t *testing.T) {
+	gormDB, locker := openBusyDB(t)
+	lock(t, locker, writeBackoff+writeBackoff/2)
+
+	setting := &model.Setting{Key: "key", Value: "value"}
+	err := gormDB.Create(setting).Error
+	if err != nil {
+		t.Fatalf("create failed while the database was busy: %v", err)
+	}
+	if setting.Id == 0 {
+		t.Fatal("create did not read the id of the inserted row")
+	}
+	if FailedWrites() != 0 {
+		t.Fatalf("failed writes = %v, want 0", FailedWrites())
+	}
+}
+
+func TestCreateFailsWhileBusyTooLong(t *testing.T) {
+	gormDB, locker := openBusyDB(t)
+	// longer than all retries together
+	hold := writeBackoff * (1 << (writeRetries + 1))
+	unlocked := time.Now().Add(hold)
+	lock(t, locker, hold)
+
+	err := gormDB.Create(&model.Setting{Key: "key", Value: "value"}).Error
+	if !IsBusy(err) {
+		t.Fatalf("create error = %v, want a busy database", err)
+	}
+	if FailedWrites() != 1 {
+		t.Fatalf("failed writes = %v, want 1", FailedWrites())
+	}
+
+	// a write that succeeds later does not hide the failed one
+	time.Sleep(time.Until(unlocked))
+	err = gormDB.Create(&model.Setting{Key: "key", Value: "value"}).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	if FailedWrites() != 1 {
+		t.Fatalf("failed writes after a success = %v, want 1", FailedWrites())
+	}
+	failedWrites.counts = [len(failedWrites.counts)]int64{}
+}
+
+func TestTransactionRetriedWhileBusy(t *testing.T) {
+	gormDB, locker := openBusyDB(t)
+	lock(t, locker, writeBackoff+writeBackoff/2)
+
+	runs := 0
+	err := gormDB.Transaction(func(tx *gorm.DB) error {
+		runs++
+		if err := tx.Create(&model.Setting{Key: "a", Value: "1"}).Error; err != nil {
+			return err
+		}
+		return tx.Create(&model.Setting{Key: "b", Value: "2"}).Error
+	})
+	if err != nil {
+		t.Fatalf("transaction failed while the database was busy: %v", err)
+	}
+	if runs != 1 {
+		t.Fatalf("transaction ran %v times, want once after its start was retried", runs)
+	}
+	var count int64
+	gormDB.Model(model.Setting{}).Where("key in ?", []string{"a", "b"}).Count(&count)
+	if count != 2 {
+		t.Fatalf("transaction wrote %v rows, want 2", count)
+	}
+}
+
+func TestIsDuplicate(t *testing.T) {
+	gormDB, _ := openBusyDB(t)
+	err := gormDB.AutoMigrate(&model.Payment{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = gormDB.Create(&model.Payment{Provider: "webhook", ExternalId: "1"}).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = gormDB.Create(&model.Payment{Provider: "webhook", ExternalId: "1"}).Error
+	if !IsDuplicate(err) {
+		t.Fatalf("second create error = %v, want a duplicate", err)
+	}
+	if IsBusy(err) {
+		t.Fatal("a duplicate is not a busy database")
+	}
+}
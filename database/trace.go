@@ -0,0 +1,73 @@
+package database
+
+import (
+	"errors"
+	"time"
+	"x-ui/util/tracing"
+
+	"gorm.io/gorm"
+)
+
+// queries that do not belong to a traced request or job are only traced when they take this long,
+// most queries of the panel are made without a context and would bury the traces otherwise
+const slowQuery = time.Millisecond * 100
+
+const tracingStart = "tracing:start"
+
+// registerTracing adds a span for every statement gorm runs, the statement and its rows are attributes
+func registerTracing(db *gorm.DB) error {
+	before := func(tx *gorm.DB) {
+		if tracing.Enabled() {
+			tx.InstanceSet(tracingStart, time.Now())
+		}
+	}
+	after := func(operation string) func(*gorm.DB) {
+		return func(tx *gorm.DB) {
+			value, ok := tx.InstanceGet(tracingStart)
+			if !ok {
+				return
+			}
+			start := value.(time.Time)
+			ctx := tx.Statement.Context
+			if !tracing.HasParent(ctx) && time.Since(start) < slowQuery {
+				return
+			}
+			_, span := tracing.Start(ctx, "db "+operation, tracing.KindClient)
+			if span == nil {
+				return
+			}
+			span.SetStart(start)
+			span.SetAttribute("db.system", "sqlite")
+			span.SetAttribute("db.operation", operation)
+			span.SetAttribute("db.statement", tx.Statement.SQL.String())
+			span.SetAttribute("db.rows_affected", tx.Statement.RowsAffected)
+			err := tx.Error
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				err = nil
+			}
+			span.End(err)
+		}
+	}
+
+	callback := db.Callback()
+	errs := []error{
+		callback.Create().Before("gorm:create").Register("tracing:before_create", before),
+		callback.Create().After("gorm:create").Register("tracing:after_create", after("create")),
+		callback.Query().Before("gorm:query").Register("tracing:before_query", before),
+		callback.Query().After("gorm:query").Register("tracing:after_query", after("query")),
+		callback.Update().Before("gorm:update").Register("tracing:before_update", before),
+		callback.Update().After("gorm:update").Register("tracing:after_update", after("update")),
+		callback.Delete().Before("gorm:delete").Register("tracing:before_delete", before),
+		callback.Delete().After("gorm:delete").Register("tracing:after_delete", after("delete")),
+		callback.Row().Before("gorm:row").Register("tracing:before_row", before),
+		callback.Row().After("gorm:row").Register("tracing:after_row", after("row")),
+		callback.Raw().Before("gorm:raw").Register("tracing:before_raw", before),
+		callback.Raw().After("gorm:raw").Register("tracing:after_raw", after("raw")),
+	}
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,125 @@
+package logger
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/op/go-logging"
+)
+
+// bufferSize is the number of recent entries kept in memory for the log viewer
+const bufferSize = 1000
+
+// Entry is a log line kept in the buffer
+type Entry struct {
+	Time      time.Time `json:"time"`
+	Level     string    `json:"level"`
+	Module    string    `json:"module"`
+	RequestId string    `json:"requestId,omitempty"`
+	Message   string    `json:"message"`
+
+	level logging.Level
+}
+
+// Query filters entries, Level is the least severe level included and the zero times are unbounded
+type Query struct {
+	Level   string
+	Keyword string
+	Since   time.Time
+	Until   time.Time
+}
+
+func (q *Query) Match(entry *Entry) bool {
+	if q.Level != "" {
+		level, err := logging.LogLevel(strings.ToUpper(q.Level))
+		if err == nil && entry.level > level {
+			return false
+		}
+	}
+	if q.Keyword != "" && !strings.Contains(strings.ToLower(entry.Message), strings.ToLower(q.Keyword)) {
+		return false
+	}
+	if !q.Since.IsZero() && entry.Time.Before(q.Since) {
+		return false
+	}
+	if !q.Until.IsZero() && entry.Time.After(q.Until) {
+		return false
+	}
+	return true
+}
+
+// bufferBackend keeps the last bufferSize entries and passes new ones to subscribers
+type bufferBackend struct {
+	lock        sync.Mutex
+	entries     []*Entry
+	next        int
+	subscribers map[chan *Entry]bool
+}
+
+var buffer = &bufferBackend{
+	entries:     make([]*Entry, 0, bufferSize),
+	subscribers: map[chan *Entry]bool{},
+}
+
+func (b *bufferBackend) Log(level logging.Level, calldepth int, rec *logging.Record) error {
+	entry := &Entry{
+		Time:    rec.Time,
+		Level:   strings.ToLower(level.String()),
+		Module:  rec.Module,
+		Message: rec.Message(),
+		level:   level,
+	}
+	if len(rec.Args) > 0 {
+		if id, ok := rec.Args[0].(RequestId); ok {
+			entry.RequestId = string(id)
+			entry.Message = strings.TrimPrefix(entry.Message, id.String()+" ")
+		}
+	}
+
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if len(b.entries) < bufferSize {
+		b.entries = append(b.entries, entry)
+	} else {
+		b.entries[b.next] = entry
+		b.next = (b.next + 1) % bufferSize
+	}
+	for ch := range b.subscribers {
+		select {
+		case ch <- entry:
+		default:
+			// a slow reader misses lines rather than blocking the logger
+		}
+	}
+	return nil
+}
+
+// GetEntries returns the buffered entries matching the query, oldest first
+func GetEntries(q *Query) []*Entry {
+	buffer.lock.Lock()
+	defer buffer.lock.Unlock()
+	entries := make([]*Entry, 0)
+	for i := range buffer.entries {
+		entry := buffer.entries[(buffer.next+i)%len(buffer.entries)]
+		if q.Match(entry) {
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
+
+// Subscribe returns a channel receiving every new entry until Unsubscribe
+func Subscribe() chan *Entry {
+	ch := make(chan *Entry, 100)
+	buffer.lock.Lock()
+	defer buffer.lock.Unlock()
+	buffer.subscribers[ch] = true
+	return ch
+}
+
+func Unsubscribe(ch chan *Entry) {
+	buffer.lock.Lock()
+	defer buffer.lock.Unlock()
+	delete(buffer.subscribers, ch)
+}
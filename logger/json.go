@@ -0,0 +1,73 @@
+package logger
+
+import (
+	"encoding/json"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/op/go-logging"
+)
+
+// RequestId tags a log line with the id of the http request it belongs to, the text format prints
+// it in brackets in front of the message and the json format moves it to its own field
+type RequestId string
+
+func (id RequestId) String() string {
+	return "[" + string(id) + "]"
+}
+
+// Request logs in the web module on behalf of the http request with the id
+type Request RequestId
+
+func (r Request) Info(args ...interface{}) {
+	Web.logger.Info(append([]interface{}{RequestId(r)}, args...)...)
+}
+
+func (r Request) Infof(format string, args ...interface{}) {
+	Web.logger.Infof("%v "+format, append([]interface{}{RequestId(r)}, args...)...)
+}
+
+func (r Request) Warning(args ...interface{}) {
+	Web.logger.Warning(append([]interface{}{RequestId(r)}, args...)...)
+}
+
+func (r Request) Warningf(format string, args ...interface{}) {
+	Web.logger.Warningf("%v "+format, append([]interface{}{RequestId(r)}, args...)...)
+}
+
+func (r Request) Error(args ...interface{}) {
+	Web.logger.Error(append([]interface{}{RequestId(r)}, args...)...)
+}
+
+type jsonRecord struct {
+	Time      string `json:"time"`
+	Level     string `json:"level"`
+	Module    string `json:"module"`
+	RequestId string `json:"request_id,omitempty"`
+	Message   string `json:"message"`
+}
+
+// jsonFormatter writes one json object per line, for log collectors such as Loki or Elasticsearch
+type jsonFormatter struct{}
+
+func (f *jsonFormatter) Format(calldepth int, r *logging.Record, w io.Writer) error {
+	record := jsonRecord{
+		Time:    r.Time.Format(time.RFC3339Nano),
+		Level:   strings.ToLower(r.Level.String()),
+		Module:  r.Module,
+		Message: r.Message(),
+	}
+	if len(r.Args) > 0 {
+		if id, ok := r.Args[0].(RequestId); ok {
+			record.RequestId = string(id)
+			record.Message = strings.TrimPrefix(record.Message, id.String()+" ")
+		}
+	}
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
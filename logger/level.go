@@ -0,0 +1,66 @@
+package logger
+
+import (
+	"sync"
+
+	"github.com/op/go-logging"
+)
+
+// levelBackend filters records by the level of their module before passing them to backend. Unlike the
+// leveled backends of go-logging its levels and backend may change while other goroutines log
+type levelBackend struct {
+	backend logging.Backend
+	lock    sync.RWMutex
+	levels  map[string]logging.Level
+}
+
+func newLevelBackend() *levelBackend {
+	return &levelBackend{levels: map[string]logging.Level{}}
+}
+
+// Log holds the lock while the record is written, so a swapped backend is no longer written to once
+// setBackend returns
+func (b *levelBackend) Log(level logging.Level, calldepth int, rec *logging.Record) error {
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+	if b.backend == nil {
+		return nil
+	}
+	return b.backend.Log(level, calldepth+1, rec)
+}
+
+func (b *levelBackend) setBackend(backend logging.Backend) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.backend = backend
+}
+
+// GetLevel returns the level of the module, or the level of the empty module for modules without one
+func (b *levelBackend) GetLevel(module string) logging.Level {
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+	if level, ok := b.levels[module]; ok {
+		return level
+	}
+	if level, ok := b.levels[""]; ok {
+		return level
+	}
+	return logging.DEBUG
+}
+
+func (b *levelBackend) SetLevel(level logging.Level, module string) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.levels[module] = level
+}
+
+// resetLevel makes the module log at the level of the empty module again
+func (b *levelBackend) resetLevel(module string) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	delete(b.levels, module)
+}
+
+func (b *levelBackend) IsEnabledFor(level logging.Level, module string) bool {
+	return level <= b.GetLevel(module)
+}
@@ -1,28 +1,148 @@
 package logger
 
 import (
+	"fmt"
 	"github.com/op/go-logging"
+	"io"
 	"os"
+	"sync"
 )
 
-var logger *logging.Logger
+const (
+	TextFormat = "text"
+	JsonFormat = "json"
+)
+
+var logger = logging.MustGetLogger("x-ui")
+
+// leveled is the backend of every logger, set once. InitLogger and the Set functions swap the output
+// behind it while other goroutines log
+var leveled = newLevelBackend()
+
+// configLock guards the output settings below and the swap of the output built from them
+var configLock sync.Mutex
+var logLevel logging.Level
+var logFormat = TextFormat
+var logFile *os.File
+var logShipper logging.Backend
 
 func init() {
+	logger.SetBackend(leveled)
 	InitLogger(logging.INFO)
 }
 
 func InitLogger(level logging.Level) {
-	format := logging.MustStringFormatter(
-		`%{time:2006/01/02 15:04:05} %{level} - %{message}`,
-	)
-	newLogger := logging.MustGetLogger("x-ui")
-	backend := logging.NewLogBackend(os.Stderr, "", 0)
-	backendFormatter := logging.NewBackendFormatter(backend, format)
-	backendLeveled := logging.AddModuleLevel(backendFormatter)
-	backendLeveled.SetLevel(level, "")
-	newLogger.SetBackend(backendLeveled)
-
-	logger = newLogger
+	configLock.Lock()
+	defer configLock.Unlock()
+	logLevel = level
+	leveled.SetLevel(level, "")
+	applyOutput()
+}
+
+// applyOutput builds the output of the settings and swaps it in, configLock must be held
+func applyOutput() {
+	var format logging.Formatter
+	if logFormat == JsonFormat {
+		format = &jsonFormatter{}
+	} else {
+		format = logging.MustStringFormatter(
+			`%{time:2006/01/02 15:04:05} %{level} - %{message}`,
+		)
+	}
+	var out io.Writer = os.Stderr
+	if logFile != nil {
+		out = io.MultiWriter(os.Stderr, logFile)
+	}
+	backend := logging.NewLogBackend(out, "", 0)
+	backends := []logging.Backend{logging.NewBackendFormatter(backend, format)}
+	if logShipper != nil {
+		// syslog and the journal stamp the time themselves
+		shipFormat := format
+		if logFormat != JsonFormat {
+			shipFormat = logging.MustStringFormatter(`%{level} - %{message}`)
+		}
+		backends = append(backends, logging.NewBackendFormatter(logShipper, shipFormat))
+	}
+	backends = append(backends, buffer)
+	leveled.setBackend(logging.MultiLogger(backends...))
+}
+
+// SetFormat switches the output between TextFormat and JsonFormat, keeping the level
+func SetFormat(format string) {
+	if format != JsonFormat {
+		format = TextFormat
+	}
+	configLock.Lock()
+	defer configLock.Unlock()
+	if format == logFormat {
+		return
+	}
+	logFormat = format
+	applyOutput()
+}
+
+// SetFile copies the output to the file at path, opened for appending so it can be rotated by truncation,
+// an empty path writes to stderr only
+func SetFile(path string) error {
+	configLock.Lock()
+	defer configLock.Unlock()
+	if logFile != nil && logFile.Name() == path {
+		return nil
+	}
+	var file *os.File
+	if path != "" {
+		var err error
+		file, err = os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+		if err != nil {
+			return err
+		}
+	}
+	old := logFile
+	logFile = file
+	applyOutput()
+	// no record is written to the old file once the output is swapped
+	if old != nil {
+		old.Close()
+	}
+	return nil
+}
+
+// SetShipping duplicates the output to "syslog" or "journald" with the facility and tag,
+// an empty target stops shipping
+func SetShipping(target string, facility string, tag string) error {
+	var shipper logging.Backend
+	var err error
+	switch target {
+	case "":
+	case "syslog":
+		shipper, err = newSyslogBackend(facility, tag)
+	case "journald":
+		shipper, err = newJournalBackend(facility, tag)
+	default:
+		err = fmt.Errorf("unknown log shipping target: %v", target)
+	}
+	if err != nil {
+		return err
+	}
+	configLock.Lock()
+	defer configLock.Unlock()
+	old := logShipper
+	logShipper = shipper
+	applyOutput()
+	if closer, ok := old.(io.Closer); ok {
+		closer.Close()
+	}
+	return nil
+}
+
+// GetFile returns the path of the file the output is copied to, empty if there is none
+func GetFile() string {
+	configLock.Lock()
+	defer configLock.Unlock()
+	if logFile == nil {
+		return ""
+	}
+	return logFile.Name()
 }
 
 func Debug(args ...interface{}) {
@@ -0,0 +1,81 @@
+package logger
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/op/go-logging"
+)
+
+// Module logs under its own name, which shows up in the json output and can have its own level
+type Module struct {
+	logger *logging.Logger
+}
+
+var modules = map[string]*Module{}
+
+var (
+	Web   = newModule("web")
+	Xray  = newModule("xray")
+	Tgbot = newModule("tgbot")
+	Job   = newModule("job")
+)
+
+func newModule(name string) *Module {
+	module := &Module{logger: logging.MustGetLogger(name)}
+	module.logger.SetBackend(leveled)
+	modules[name] = module
+	return module
+}
+
+// SetModuleLevel changes the level of a module at runtime, an empty level falls back to the global level
+func SetModuleLevel(name string, level string) error {
+	if _, ok := modules[name]; !ok {
+		return fmt.Errorf("unknown log module: %v", name)
+	}
+	if level == "" {
+		leveled.resetLevel(name)
+		return nil
+	}
+	if level == "warn" {
+		level = "warning"
+	}
+	moduleLevel, err := logging.LogLevel(strings.ToUpper(level))
+	if err != nil {
+		return err
+	}
+	leveled.SetLevel(moduleLevel, name)
+	return nil
+}
+
+func (m *Module) Debug(args ...interface{}) {
+	m.logger.Debug(args...)
+}
+
+func (m *Module) Debugf(format string, args ...interface{}) {
+	m.logger.Debugf(format, args...)
+}
+
+func (m *Module) Info(args ...interface{}) {
+	m.logger.Info(args...)
+}
+
+func (m *Module) Infof(format string, args ...interface{}) {
+	m.logger.Infof(format, args...)
+}
+
+func (m *Module) Warning(args ...interface{}) {
+	m.logger.Warning(args...)
+}
+
+func (m *Module) Warningf(format string, args ...interface{}) {
+	m.logger.Warningf(format, args...)
+}
+
+func (m *Module) Error(args ...interface{}) {
+	m.logger.Error(args...)
+}
+
+func (m *Module) Errorf(format string, args ...interface{}) {
+	m.logger.Errorf(format, args...)
+}
@@ -0,0 +1,134 @@
+//go:build !windows
+// +build !windows
+
+package logger
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"log/syslog"
+	"net"
+	"os"
+	"strings"
+
+	"github.com/op/go-logging"
+)
+
+const journalSocket = "/run/systemd/journal/socket"
+
+var facilities = map[string]syslog.Priority{
+	"kern":   syslog.LOG_KERN,
+	"user":   syslog.LOG_USER,
+	"daemon": syslog.LOG_DAEMON,
+	"auth":   syslog.LOG_AUTH,
+	"syslog": syslog.LOG_SYSLOG,
+	"local0": syslog.LOG_LOCAL0,
+	"local1": syslog.LOG_LOCAL1,
+	"local2": syslog.LOG_LOCAL2,
+	"local3": syslog.LOG_LOCAL3,
+	"local4": syslog.LOG_LOCAL4,
+	"local5": syslog.LOG_LOCAL5,
+	"local6": syslog.LOG_LOCAL6,
+	"local7": syslog.LOG_LOCAL7,
+}
+
+func parseFacility(name string) (syslog.Priority, error) {
+	if name == "" {
+		return syslog.LOG_DAEMON, nil
+	}
+	facility, ok := facilities[strings.ToLower(name)]
+	if !ok {
+		return 0, fmt.Errorf("unknown syslog facility: %v", name)
+	}
+	return facility, nil
+}
+
+// syslogBackend closes the connection to the local syslog daemon when shipping is changed
+type syslogBackend struct {
+	*logging.SyslogBackend
+}
+
+func (b *syslogBackend) Close() error {
+	return b.Writer.Close()
+}
+
+func newSyslogBackend(facility string, tag string) (logging.Backend, error) {
+	priority, err := parseFacility(facility)
+	if err != nil {
+		return nil, err
+	}
+	backend, err := logging.NewSyslogBackendPriority(tag, priority|syslog.LOG_INFO)
+	if err != nil {
+		return nil, err
+	}
+	return &syslogBackend{backend}, nil
+}
+
+// journalBackend sends records to systemd-journald using its native protocol, which keeps the
+// level as PRIORITY instead of parsing it from the line
+type journalBackend struct {
+	conn     *net.UnixConn
+	addr     *net.UnixAddr
+	facility int
+	tag      string
+}
+
+func newJournalBackend(facility string, tag string) (logging.Backend, error) {
+	priority, err := parseFacility(facility)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := os.Stat(journalSocket); err != nil {
+		return nil, fmt.Errorf("systemd journal is not available: %v", err)
+	}
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Net: "unixgram"})
+	if err != nil {
+		return nil, err
+	}
+	return &journalBackend{
+		conn:     conn,
+		addr:     &net.UnixAddr{Name: journalSocket, Net: "unixgram"},
+		facility: int(priority >> 3),
+		tag:      tag,
+	}, nil
+}
+
+// journalPriority maps the levels to syslog severities
+var journalPriority = map[logging.Level]int{
+	logging.CRITICAL: 2,
+	logging.ERROR:    3,
+	logging.WARNING:  4,
+	logging.NOTICE:   5,
+	logging.INFO:     6,
+	logging.DEBUG:    7,
+}
+
+func (b *journalBackend) Log(level logging.Level, calldepth int, rec *logging.Record) error {
+	var buf bytes.Buffer
+	writeJournalField(&buf, "MESSAGE", rec.Formatted(calldepth+1))
+	writeJournalField(&buf, "PRIORITY", fmt.Sprint(journalPriority[level]))
+	writeJournalField(&buf, "SYSLOG_FACILITY", fmt.Sprint(b.facility))
+	writeJournalField(&buf, "SYSLOG_IDENTIFIER", b.tag)
+	_, err := b.conn.WriteToUnix(buf.Bytes(), b.addr)
+	return err
+}
+
+func (b *journalBackend) Close() error {
+	return b.conn.Close()
+}
+
+// writeJournalField writes KEY=value, or the length prefixed form for values spanning lines
+func writeJournalField(buf *bytes.Buffer, key string, value string) {
+	buf.WriteString(key)
+	if !strings.Contains(value, "\n") {
+		buf.WriteByte('=')
+		buf.WriteString(value)
+		buf.WriteByte('\n')
+		return
+	}
+	buf.WriteByte('\n')
+	binary.Write(buf, binary.LittleEndian, uint64(len(value)))
+	buf.WriteString(value)
+	buf.WriteByte('\n')
+}
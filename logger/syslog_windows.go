@@ -0,0 +1,18 @@
+//go:build windows
+// +build windows
+
+package logger
+
+import (
+	"errors"
+
+	"github.com/op/go-logging"
+)
+
+func newSyslogBackend(facility string, tag string) (logging.Backend, error) {
+	return nil, errors.New("syslog is not supported on windows")
+}
+
+func newJournalBackend(facility string, tag string) (logging.Backend, error) {
+	return nil, errors.New("the systemd journal is not supported on windows")
+}
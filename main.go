@@ -1,25 +1,40 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
 	"flag"
 	"fmt"
 	"log"
+	"net"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
 	"syscall"
+	"text/tabwriter"
+	"time"
 	_ "unsafe"
 	"x-ui/config"
 	"x-ui/database"
+	"x-ui/database/model"
 	"x-ui/logger"
+	"x-ui/migrate"
+	"x-ui/util/common"
+	"x-ui/util/random"
+	"x-ui/util/sys"
 	"x-ui/v2ui"
 	"x-ui/web"
-	"x-ui/web/global"
 	"x-ui/web/service"
+	"x-ui/xray"
 
+	"github.com/google/uuid"
 	"github.com/op/go-logging"
 )
 
-func runWebServer() {
+// runWebServer serves the panel on the database bootstrap opened
+func runWebServer(isAgent bool) {
 	log.Printf("%v %v", config.GetName(), config.GetVersion())
 
 	switch config.GetLogLevel() {
@@ -35,16 +50,15 @@ func runWebServer() {
 		log.Fatal("unknown log level:", config.GetLogLevel())
 	}
 
-	err := database.InitDB(config.GetDBPath())
-	if err != nil {
-		log.Fatal(err)
+	newServer := web.NewServer
+	if isAgent {
+		newServer = web.NewAgentServer
 	}
 
 	var server *web.Server
 
-	server = web.NewServer()
-	global.SetWebServer(server)
-	err = server.Start()
+	server = newServer()
+	err := server.Start()
 	if err != nil {
 		log.Println(err)
 		return
@@ -62,8 +76,7 @@ func runWebServer() {
 			if err != nil {
 				logger.Warning("stop server err:", err)
 			}
-			server = web.NewServer()
-			global.SetWebServer(server)
+			server = newServer()
 			err = server.Start()
 			if err != nil {
 				log.Println(err)
@@ -76,6 +89,109 @@ func runWebServer() {
 	}
 }
 
+// bootstrapFlags configure the run and agent commands before the database is opened
+type bootstrapFlags struct {
+	config   string
+	dbPath   string
+	port     int
+	basePath string
+}
+
+func addBootstrapFlags(cmd *flag.FlagSet) *bootstrapFlags {
+	f := &bootstrapFlags{}
+	cmd.StringVar(&f.config, "config", os.Getenv("XUI_CONFIG"), "set the yaml bootstrap config path, $XUI_CONFIG if empty")
+	cmd.StringVar(&f.dbPath, "db-path", "", "set the db file path")
+	cmd.IntVar(&f.port, "port", 0, "set panel port")
+	cmd.StringVar(&f.basePath, "base-path", "", "set panel base path")
+	return f
+}
+
+// bootstrap applies the yaml config and the flags, the flags win over the file and are saved on every start
+func bootstrap(f *bootstrapFlags) error {
+	b := &config.Bootstrap{}
+	if f.config != "" {
+		var err error
+		b, err = config.LoadBootstrap(f.config)
+		if err != nil {
+			return common.NewError("load bootstrap config failed:", err)
+		}
+	}
+	if f.dbPath != "" {
+		config.SetDBPath(f.dbPath)
+	} else if b.DBPath != "" {
+		config.SetDBPath(b.DBPath)
+	}
+	_, err := os.Stat(config.GetDBPath())
+	isNew := os.IsNotExist(err)
+	err = database.InitDB(config.GetDBPath())
+	if err != nil {
+		return err
+	}
+
+	settingService := service.SettingService{}
+	if isNew {
+		settings := map[string]string{}
+		for key, value := range b.Settings {
+			settings[key] = value
+		}
+		if b.Listen != "" {
+			settings["webListen"] = b.Listen
+		}
+		if b.Port > 0 {
+			settings["webPort"] = strconv.Itoa(b.Port)
+		}
+		if b.BasePath != "" {
+			settings["webBasePath"] = b.BasePath
+		}
+		err = settingService.ApplyBootstrap(b.Username, b.Password, settings)
+		if err != nil {
+			// the next start applies the fixed config to a new database again
+			if sqlDB, err := database.GetDB().DB(); err == nil {
+				sqlDB.Close()
+			}
+			os.Remove(config.GetDBPath())
+			return common.NewError("apply bootstrap config failed:", err)
+		}
+	}
+	if f.port > 0 {
+		if f.port > 65535 {
+			return common.NewError("invalid port:", f.port)
+		}
+		err = settingService.SetPort(f.port)
+		if err != nil {
+			return err
+		}
+	}
+	if f.basePath != "" {
+		err = settingService.SetBasePath(f.basePath)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// prepareAgent saves the given token, or generates one on first start so the node is never left open
+func prepareAgent(token string) error {
+	err := database.InitDB(config.GetDBPath())
+	if err != nil {
+		return err
+	}
+	settingService := service.SettingService{}
+	if token == "" {
+		token, err = settingService.GetAgentToken()
+		if err != nil {
+			return err
+		}
+		if token != "" {
+			return nil
+		}
+		token = random.SecureSeq(32)
+		fmt.Println("generated agent token:", token)
+	}
+	return settingService.SetAgentToken(token)
+}
+
 func resetSetting() {
 	err := database.InitDB(config.GetDBPath())
 	if err != nil {
@@ -204,9 +320,765 @@ func updateSetting(port int, username string, password string) {
 	}
 }
 
+func reloadPanel() {
+	panelService := service.PanelService{}
+	count, err := panelService.SignalRunningPanel()
+	if err != nil {
+		fmt.Println("reload running panel failed:", err)
+	} else if count == 0 {
+		fmt.Println("no running panel found, changes apply on next start")
+	}
+}
+
+func listInbounds() {
+	err := database.InitDB(config.GetDBPath())
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	inboundService := service.InboundServiceImpl{}
+	inbounds, err := inboundService.GetAllInbounds()
+	if err != nil {
+		fmt.Println("get inbounds failed:", err)
+		return
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tENABLE\tREMARK\tPROTOCOL\tPORT\tTAG\tUP\tDOWN")
+	for _, inbound := range inbounds {
+		fmt.Fprintf(w, "%v\t%v\t%v\t%v\t%v\t%v\t%v\t%v\n",
+			inbound.Id, inbound.Enable, inbound.Remark, inbound.Protocol, inbound.Port, inbound.Tag,
+			common.FormatTraffic(inbound.Up), common.FormatTraffic(inbound.Down))
+	}
+	w.Flush()
+}
+
+// defaultInboundSettings returns settings with a single generated client, like the panel does for a new inbound
+func defaultInboundSettings(protocol model.Protocol) (string, error) {
+	email := strings.ToLower(random.Seq(8))
+	var settings map[string]interface{}
+	switch protocol {
+	case model.VMess:
+		settings = map[string]interface{}{
+			"clients": []map[string]interface{}{
+				{"id": uuid.NewString(), "alterId": 0, "email": email, "totalGB": 0, "expiryTime": 0},
+			},
+			"disableInsecureEncryption": false,
+		}
+	case model.VLESS:
+		settings = map[string]interface{}{
+			"clients": []map[string]interface{}{
+				{"id": uuid.NewString(), "flow": "", "email": email, "totalGB": 0, "expiryTime": 0},
+			},
+			"decryption": "none",
+			"fallbacks":  []interface{}{},
+		}
+	case model.Trojan:
+		settings = map[string]interface{}{
+			"clients": []map[string]interface{}{
+				{"password": random.SecureSeq(10), "flow": "", "email": email, "totalGB": 0, "expiryTime": 0},
+			},
+			"fallbacks": []interface{}{},
+		}
+	case model.Shadowsocks:
+		settings = map[string]interface{}{
+			"method":   "chacha20-poly1305",
+			"password": random.SecureSeq(10),
+			"network":  "tcp,udp",
+		}
+	default:
+		return "", common.NewErrorf("protocol %v needs explicit -settings", protocol)
+	}
+	data, err := json.MarshalIndent(settings, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+func addInbound(inbound *model.Inbound) {
+	err := database.InitDB(config.GetDBPath())
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	if inbound.Port <= 0 || inbound.Port > 65535 {
+		fmt.Println("invalid port:", inbound.Port)
+		return
+	}
+	if inbound.Settings == "" {
+		inbound.Settings, err = defaultInboundSettings(inbound.Protocol)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+	}
+	userService := service.UserService{}
+	user, err := userService.GetFirstUser()
+	if err != nil {
+		fmt.Println("get first user failed:", err)
+		return
+	}
+	inbound.UserId = user.Id
+	inbound.Enable = true
+	inbound.Tag = fmt.Sprintf("inbound-%v", inbound.Port)
+
+	inboundService := service.InboundServiceImpl{}
+	inbound, err = inboundService.AddInbound(inbound)
+	if err != nil {
+		fmt.Println("add inbound failed:", err)
+		return
+	}
+	fmt.Printf("add inbound %v success\n", inbound.Id)
+	fmt.Println(inbound.Settings)
+	reloadPanel()
+}
+
+func delInbound(id int) {
+	err := database.InitDB(config.GetDBPath())
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	inboundService := service.InboundServiceImpl{}
+	_, err = inboundService.GetInbound(id)
+	if err != nil {
+		fmt.Println("get inbound failed:", err)
+		return
+	}
+	err = inboundService.DelInbound(id)
+	if err != nil {
+		fmt.Println("delete inbound failed:", err)
+		return
+	}
+	fmt.Printf("delete inbound %v success\n", id)
+	reloadPanel()
+}
+
+func enableInbound(id int, enable bool) {
+	err := database.InitDB(config.GetDBPath())
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	inboundService := service.InboundServiceImpl{}
+	inbound, err := inboundService.GetInbound(id)
+	if err != nil {
+		fmt.Println("get inbound failed:", err)
+		return
+	}
+	inbound.Enable = enable
+	_, err = inboundService.UpdateInbound(inbound)
+	if err != nil {
+		fmt.Println("update inbound failed:", err)
+		return
+	}
+	fmt.Printf("set inbound %v enable %v success\n", id, enable)
+	reloadPanel()
+}
+
+func runInboundCmd(args []string) {
+	listCmd := flag.NewFlagSet("inbound list", flag.ExitOnError)
+
+	addCmd := flag.NewFlagSet("inbound add", flag.ExitOnError)
+	inbound := &model.Inbound{}
+	var protocol string
+	addCmd.StringVar(&inbound.Remark, "remark", "", "set inbound remark")
+	addCmd.StringVar(&protocol, "protocol", string(model.VLESS), "set inbound protocol")
+	addCmd.StringVar(&inbound.Listen, "listen", "", "set listen address, empty for all")
+	addCmd.IntVar(&inbound.Port, "port", 0, "set inbound port")
+	addCmd.Int64Var(&inbound.Total, "total", 0, "set traffic limit in bytes, 0 for unlimited")
+	addCmd.Int64Var(&inbound.ExpiryTime, "expiry", 0, "set expiry time in unix milliseconds, 0 for never")
+	addCmd.StringVar(&inbound.Settings, "settings", "", "set settings json, generated for vmess/vless/trojan/shadowsocks if empty")
+	addCmd.StringVar(&inbound.StreamSettings, "stream", `{"network":"tcp","security":"none","tcpSettings":{"header":{"type":"none"}}}`, "set stream settings json")
+	addCmd.StringVar(&inbound.Sniffing, "sniffing", `{"enabled":true,"destOverride":["http","tls"]}`, "set sniffing json")
+
+	delCmd := flag.NewFlagSet("inbound del", flag.ExitOnError)
+	var delId int
+	delCmd.IntVar(&delId, "id", 0, "inbound id")
+
+	enableCmd := flag.NewFlagSet("inbound enable", flag.ExitOnError)
+	var enableId int
+	var disable bool
+	enableCmd.IntVar(&enableId, "id", 0, "inbound id")
+	enableCmd.BoolVar(&disable, "disable", false, "disable instead of enable")
+
+	usage := func() {
+		fmt.Println("except 'list' or 'add' or 'del' or 'enable' inbound subcommands")
+		fmt.Println()
+		addCmd.Usage()
+		fmt.Println()
+		delCmd.Usage()
+		fmt.Println()
+		enableCmd.Usage()
+	}
+	if len(args) < 1 {
+		usage()
+		return
+	}
+
+	switch args[0] {
+	case "list":
+		err := listCmd.Parse(args[1:])
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		listInbounds()
+	case "add":
+		err := addCmd.Parse(args[1:])
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		inbound.Protocol = model.Protocol(protocol)
+		addInbound(inbound)
+	case "del":
+		err := delCmd.Parse(args[1:])
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		delInbound(delId)
+	case "enable":
+		err := enableCmd.Parse(args[1:])
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		enableInbound(enableId, !disable)
+	default:
+		usage()
+	}
+}
+
+func printLoginUrl() {
+	settingService := service.SettingService{}
+	port, err := settingService.GetPort()
+	if err != nil {
+		fmt.Println("get port failed:", err)
+		return
+	}
+	basePath, err := settingService.GetBasePath()
+	if err != nil {
+		fmt.Println("get base path failed:", err)
+		return
+	}
+	certFile, _ := settingService.GetCertFile()
+	host, _ := settingService.GetListen()
+	if host == "" {
+		serverService := service.ServerService{}
+		ipv4, ipv6 := serverService.GetPublicIP()
+		switch {
+		case ipv4 != "":
+			host = ipv4
+		case ipv6 != "":
+			host = ipv6
+		default:
+			host = "<server ip>"
+		}
+	}
+	scheme := "http"
+	if certFile != "" {
+		scheme = "https"
+	}
+	fmt.Printf("login url: %s://%s%s\n", scheme, net.JoinHostPort(host, strconv.Itoa(port)), basePath)
+}
+
+// resetAdmin is meant for lockout recovery, this panel has no two-factor login so there is nothing else to clear
+func resetAdmin(username string, password string, port int, basePath string) {
+	err := database.InitDB(config.GetDBPath())
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	if username != "" || password != "" {
+		userService := service.UserService{}
+		user, err := userService.GetFirstUser()
+		if err != nil {
+			fmt.Println("get first user failed:", err)
+			return
+		}
+		if username == "" {
+			username = user.Username
+		}
+		if password == "" {
+			password = random.SecureSeq(12)
+			fmt.Println("generated password:", password)
+		}
+		err = userService.UpdateFirstUser(username, password)
+		if err != nil {
+			fmt.Println("reset username and password failed:", err)
+			return
+		}
+		fmt.Println("reset username and password success, username:", username)
+	}
+
+	settingService := service.SettingService{}
+	if port > 0 {
+		if port > 65535 {
+			fmt.Println("invalid port:", port)
+			return
+		}
+		err := settingService.SetPort(port)
+		if err != nil {
+			fmt.Println("set port failed:", err)
+			return
+		}
+	}
+	if basePath != "" {
+		err := settingService.SetBasePath(basePath)
+		if err != nil {
+			fmt.Println("set base path failed:", err)
+			return
+		}
+	}
+
+	printLoginUrl()
+	reloadPanel()
+}
+
+func runAdminCmd(args []string) {
+	resetCmd := flag.NewFlagSet("admin reset", flag.ExitOnError)
+	var username string
+	var password string
+	var port int
+	var basePath string
+	resetCmd.StringVar(&username, "username", "", "set login username, keeps the current one if empty")
+	resetCmd.StringVar(&password, "password", "", "set login password, generated if empty while username is set")
+	resetCmd.IntVar(&port, "port", 0, "set panel port")
+	resetCmd.StringVar(&basePath, "webBasePath", "", "set panel base path")
+
+	viewerCmd := flag.NewFlagSet("admin viewer", flag.ExitOnError)
+	var viewerName string
+	var viewerPassword string
+	var deleteViewer bool
+	viewerCmd.StringVar(&viewerName, "username", "", "viewer username")
+	viewerCmd.StringVar(&viewerPassword, "password", "", "set viewer password, generated if empty")
+	viewerCmd.BoolVar(&deleteViewer, "delete", false, "delete the viewer")
+
+	usage := func() {
+		fmt.Println("except 'reset' or 'viewer' admin subcommands")
+		fmt.Println()
+		resetCmd.Usage()
+		fmt.Println()
+		viewerCmd.Usage()
+	}
+	if len(args) < 1 {
+		usage()
+		return
+	}
+	switch args[0] {
+	case "reset":
+		err := resetCmd.Parse(args[1:])
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		resetAdmin(username, password, port, basePath)
+	case "viewer":
+		err := viewerCmd.Parse(args[1:])
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		setViewer(viewerName, viewerPassword, deleteViewer)
+	default:
+		usage()
+	}
+}
+
+// setViewer manages read-only logins for support staff, they see everything but can not change anything
+func setViewer(username string, password string, delete bool) {
+	err := database.InitDB(config.GetDBPath())
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	userService := service.UserService{}
+	if delete {
+		err = userService.DelViewer(username)
+		if err != nil {
+			fmt.Println("delete viewer failed:", err)
+			return
+		}
+		fmt.Println("delete viewer success:", username)
+		return
+	}
+	if password == "" {
+		password = random.SecureSeq(12)
+		fmt.Println("generated password:", password)
+	}
+	err = userService.SetViewer(username, password)
+	if err != nil {
+		fmt.Println("set viewer failed:", err)
+		return
+	}
+	fmt.Println("set viewer success:", username)
+}
+
+func createBackup(keep int, upload string) {
+	err := database.InitDB(config.GetDBPath())
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	// ctrl+c or a stop of the timer running the backup cancels it instead of leaving a half written file
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	backupService := service.BackupService{}
+	backup, err := backupService.CreateBackup(ctx)
+	if err != nil {
+		fmt.Println("create backup failed:", err)
+		os.Exit(1)
+	}
+	fmt.Println("create backup success:", filepath.Join(backupService.GetBackupDir(), backup.Name))
+	if upload != "" {
+		err = backupService.UploadBackup(ctx, backup.Name, upload)
+		if err != nil {
+			fmt.Println("upload backup failed:", err)
+			os.Exit(1)
+		}
+		fmt.Println("upload backup success")
+	}
+	if keep > 0 {
+		count, err := backupService.PruneBackups(keep)
+		if err != nil {
+			fmt.Println("prune backups failed:", err)
+		} else if count > 0 {
+			fmt.Printf("pruned %v old backups\n", count)
+		}
+	}
+}
+
+func listBackups() {
+	backupService := service.BackupService{}
+	backups, err := backupService.GetBackups()
+	if err != nil {
+		fmt.Println("list backups failed:", err)
+		return
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tSIZE\tTIME")
+	for _, backup := range backups {
+		fmt.Fprintf(w, "%v\t%v\t%v\n", backup.Name, common.FormatTraffic(backup.Size), backup.Time.Format("2006-01-02 15:04:05"))
+	}
+	w.Flush()
+}
+
+func restoreBackup(name string) {
+	backupService := service.BackupService{}
+	err := backupService.RestoreBackup(name)
+	if err != nil {
+		fmt.Println("restore backup failed:", err)
+		os.Exit(1)
+	}
+	fmt.Println("restore backup success, restart x-ui to load it")
+}
+
+func runBackupCmd(args []string) {
+	createCmd := flag.NewFlagSet("backup create", flag.ExitOnError)
+	var keep int
+	var upload string
+	createCmd.IntVar(&keep, "keep", 0, "keep only the newest n backups, 0 keeps all")
+	createCmd.StringVar(&upload, "upload", "", "also PUT the backup to this url, {name} is replaced by the file name")
+
+	listCmd := flag.NewFlagSet("backup list", flag.ExitOnError)
+
+	restoreCmd := flag.NewFlagSet("backup restore", flag.ExitOnError)
+	var name string
+	restoreCmd.StringVar(&name, "name", "", "backup file name as shown by list")
+
+	usage := func() {
+		fmt.Println("except 'create' or 'list' or 'restore' backup subcommands")
+		fmt.Println()
+		createCmd.Usage()
+		fmt.Println()
+		restoreCmd.Usage()
+	}
+	if len(args) < 1 {
+		usage()
+		return
+	}
+
+	switch args[0] {
+	case "create":
+		err := createCmd.Parse(args[1:])
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		createBackup(keep, upload)
+	case "list":
+		err := listCmd.Parse(args[1:])
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		listBackups()
+	case "restore":
+		err := restoreCmd.Parse(args[1:])
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		restoreBackup(name)
+	default:
+		usage()
+	}
+}
+
+func createToken(name string, role string, expires string) {
+	lifetime, err := service.ParseTokenExpiry(expires)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	err = database.InitDB(config.GetDBPath())
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	apiTokenService := service.ApiTokenService{}
+	token, apiToken, err := apiTokenService.CreateToken(name, role, lifetime)
+	if err != nil {
+		fmt.Println("create token failed:", err)
+		os.Exit(1)
+	}
+	fmt.Printf("create token success, id: %v, role: %v\n", apiToken.Id, apiToken.Role)
+	if apiToken.ExpiryTime > 0 {
+		fmt.Println("expires:", time.UnixMilli(apiToken.ExpiryTime).Format("2006-01-02 15:04:05"))
+	}
+	// the database only keeps the hash, this is the only time the token can be seen
+	fmt.Println(token)
+}
+
+func listTokens() {
+	err := database.InitDB(config.GetDBPath())
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	apiTokenService := service.ApiTokenService{}
+	tokens, err := apiTokenService.GetTokens()
+	if err != nil {
+		fmt.Println("list tokens failed:", err)
+		return
+	}
+	formatTime := func(ms int64, zero string) string {
+		if ms == 0 {
+			return zero
+		}
+		return time.UnixMilli(ms).Format("2006-01-02 15:04:05")
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tNAME\tROLE\tPREFIX\tEXPIRES\tLAST USED")
+	for _, token := range tokens {
+		fmt.Fprintf(w, "%v\t%v\t%v\t%v...\t%v\t%v\n", token.Id, token.Name, token.Role, token.Prefix,
+			formatTime(token.ExpiryTime, "never"), formatTime(token.LastUsed, "-"))
+	}
+	w.Flush()
+}
+
+func revokeToken(id int) {
+	err := database.InitDB(config.GetDBPath())
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	apiTokenService := service.ApiTokenService{}
+	err = apiTokenService.DelToken(id)
+	if err != nil {
+		fmt.Println("revoke token failed:", err)
+		os.Exit(1)
+	}
+	fmt.Println("revoke token success:", id)
+}
+
+// runTokenCmd manages the api tokens, so automation can be set up on a headless install without logging in
+func runTokenCmd(args []string) {
+	createCmd := flag.NewFlagSet("token create", flag.ExitOnError)
+	var name string
+	var role string
+	var expires string
+	createCmd.StringVar(&name, "name", "", "name to recognize the token by")
+	createCmd.StringVar(&role, "role", service.TokenRoleOperator, "admin, operator or viewer")
+	createCmd.StringVar(&expires, "expires", "", "lifetime like 90d, 12h or 30m, never expires if empty")
+
+	listCmd := flag.NewFlagSet("token list", flag.ExitOnError)
+
+	revokeCmd := flag.NewFlagSet("token revoke", flag.ExitOnError)
+	var id int
+	revokeCmd.IntVar(&id, "id", 0, "token id as shown by list")
+
+	usage := func() {
+		fmt.Println("except 'create' or 'list' or 'revoke' token subcommands")
+		fmt.Println()
+		createCmd.Usage()
+		fmt.Println()
+		revokeCmd.Usage()
+	}
+	if len(args) < 1 {
+		usage()
+		return
+	}
+
+	switch args[0] {
+	case "create":
+		err := createCmd.Parse(args[1:])
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		createToken(name, role, expires)
+	case "list":
+		err := listCmd.Parse(args[1:])
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		listTokens()
+	case "revoke":
+		err := revokeCmd.Parse(args[1:])
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		revokeToken(id)
+	default:
+		usage()
+	}
+}
+
+type panelStatus struct {
+	Version      string `json:"version"`
+	PanelRunning bool   `json:"panelRunning"`
+	PanelPort    int    `json:"panelPort"`
+	BasePath     string `json:"basePath"`
+	Xray         struct {
+		Running bool   `json:"running"`
+		Version string `json:"version"`
+	} `json:"xray"`
+	Inbounds struct {
+		Count   int `json:"count"`
+		Enabled int `json:"enabled"`
+		Clients int `json:"clients"`
+	} `json:"inbounds"`
+	Traffic struct {
+		Up   int64 `json:"up"`
+		Down int64 `json:"down"`
+	} `json:"traffic"`
+}
+
+func showStatus(asJson bool) {
+	err := database.InitDB(config.GetDBPath())
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	status := &panelStatus{Version: config.GetVersion()}
+	settingService := service.SettingService{}
+	status.PanelPort, _ = settingService.GetPort()
+	status.BasePath, _ = settingService.GetBasePath()
+	if self, err := os.Executable(); err == nil {
+		pids, _ := sys.FindProcesses(self)
+		// the list includes this process itself
+		status.PanelRunning = len(pids) > 1
+	}
+	pids, _ := sys.FindProcesses(xray.GetBinaryPath())
+	status.Xray.Running = len(pids) > 0
+	status.Xray.Version = xray.GetBinaryVersion()
+
+	inboundService := service.InboundServiceImpl{}
+	inbounds, err := inboundService.GetAllInbounds()
+	if err != nil {
+		fmt.Println("get inbounds failed:", err)
+		os.Exit(1)
+	}
+	status.Inbounds.Count = len(inbounds)
+	for _, inbound := range inbounds {
+		if inbound.Enable {
+			status.Inbounds.Enabled++
+		}
+		status.Inbounds.Clients += len(inbound.ClientStats)
+		status.Traffic.Up += inbound.Up
+		status.Traffic.Down += inbound.Down
+	}
+
+	if asJson {
+		data, err := json.MarshalIndent(status, "", "  ")
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		fmt.Println(string(data))
+		return
+	}
+	fmt.Println("x-ui version:", status.Version)
+	fmt.Println("panel running:", status.PanelRunning)
+	fmt.Println("panel port:", status.PanelPort)
+	fmt.Println("base path:", status.BasePath)
+	fmt.Println("xray running:", status.Xray.Running)
+	fmt.Println("xray version:", status.Xray.Version)
+	fmt.Printf("inbounds: %v (%v enabled, %v clients)\n", status.Inbounds.Count, status.Inbounds.Enabled, status.Inbounds.Clients)
+	fmt.Printf("traffic: up %v, down %v\n", common.FormatTraffic(status.Traffic.Up), common.FormatTraffic(status.Traffic.Down))
+}
+
+// runChecks prints the findings of the diagnostics and exits with 1 if any check failed
+func runChecks(asJson bool) {
+	err := database.InitDB(config.GetDBPath())
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	checkService := service.CheckService{}
+	findings := checkService.RunChecks()
+	failed := false
+	for _, finding := range findings {
+		if finding.Status == service.CheckFail {
+			failed = true
+		}
+	}
+
+	if asJson {
+		data, err := json.MarshalIndent(findings, "", "  ")
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		fmt.Println(string(data))
+	} else {
+		for _, finding := range findings {
+			fmt.Printf("[%v] %v: %v\n", finding.Status, finding.Check, finding.Message)
+			if finding.Fix != "" {
+				fmt.Println("       fix:", finding.Fix)
+			}
+		}
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
 func main() {
 	if len(os.Args) < 2 {
-		runWebServer()
+		err := bootstrap(&bootstrapFlags{config: os.Getenv("XUI_CONFIG")})
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		runWebServer(false)
 		return
 	}
 
@@ -214,11 +1086,33 @@ func main() {
 	flag.BoolVar(&showVersion, "v", false, "show version")
 
 	runCmd := flag.NewFlagSet("run", flag.ExitOnError)
+	runFlags := addBootstrapFlags(runCmd)
+
+	agentCmd := flag.NewFlagSet("agent", flag.ExitOnError)
+	var agentToken string
+	agentCmd.StringVar(&agentToken, "token", "", "set the token a central panel uses to manage this node")
+	agentFlags := addBootstrapFlags(agentCmd)
 
 	v2uiCmd := flag.NewFlagSet("v2-ui", flag.ExitOnError)
 	var dbPath string
 	v2uiCmd.StringVar(&dbPath, "db", "/etc/v2-ui/v2-ui.db", "set v2-ui db file path")
 
+	migrateCmd := flag.NewFlagSet("migrate", flag.ExitOnError)
+	var migrateFrom string
+	var migrateDB string
+	var migrateConfig string
+	migrateCmd.StringVar(&migrateFrom, "from", migrate.FromXUI, "panel to migrate from: x-ui, v2-ui or marzban")
+	migrateCmd.StringVar(&migrateDB, "db", "", "set the db file path of that panel, its default install path if empty")
+	migrateCmd.StringVar(&migrateConfig, "config", migrate.DefaultMarzbanConfigPath, "set the marzban xray config path")
+
+	statusCmd := flag.NewFlagSet("status", flag.ExitOnError)
+	var statusJson bool
+	statusCmd.BoolVar(&statusJson, "json", false, "print status as json")
+
+	checkCmd := flag.NewFlagSet("check", flag.ExitOnError)
+	var checkJson bool
+	checkCmd.BoolVar(&checkJson, "json", false, "print findings as json")
+
 	settingCmd := flag.NewFlagSet("setting", flag.ExitOnError)
 	var port int
 	var username string
@@ -245,8 +1139,16 @@ func main() {
 		fmt.Println()
 		fmt.Println("Commands:")
 		fmt.Println("    run            run web panel")
+		fmt.Println("    agent          run as a node managed by a central panel, without web UI")
 		fmt.Println("    v2-ui          migrate form v2-ui")
+		fmt.Println("    migrate        migrate from x-ui, v2-ui or marzban")
 		fmt.Println("    setting        set settings")
+		fmt.Println("    inbound        manage inbounds: list, add, del, enable")
+		fmt.Println("    admin          reset login credentials, port and base path, manage viewers")
+		fmt.Println("    backup         manage database backups: create, list, restore")
+		fmt.Println("    token          manage api tokens: create, list, revoke")
+		fmt.Println("    status         show panel and xray status")
+		fmt.Println("    check          check the database, xray, ports, certificates, clock and geo files")
 	}
 
 	flag.Parse()
@@ -262,7 +1164,29 @@ func main() {
 			fmt.Println(err)
 			return
 		}
-		runWebServer()
+		err = bootstrap(runFlags)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		runWebServer(false)
+	case "agent":
+		err := agentCmd.Parse(os.Args[2:])
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		err = bootstrap(agentFlags)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		err = prepareAgent(agentToken)
+		if err != nil {
+			fmt.Println("prepare agent failed:", err)
+			return
+		}
+		runWebServer(true)
 	case "v2-ui":
 		err := v2uiCmd.Parse(os.Args[2:])
 		if err != nil {
@@ -273,6 +1197,18 @@ func main() {
 		if err != nil {
 			fmt.Println("migrate from v2-ui failed:", err)
 		}
+	case "migrate":
+		err := migrateCmd.Parse(os.Args[2:])
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		err = migrate.Migrate(migrateFrom, migrateDB, migrateConfig)
+		if err != nil {
+			fmt.Printf("migrate from %v failed: %v\n", migrateFrom, err)
+			return
+		}
+		reloadPanel()
 	case "setting":
 		err := settingCmd.Parse(os.Args[2:])
 		if err != nil {
@@ -290,8 +1226,30 @@ func main() {
 		if (tgbottoken != "") || (tgbotchatid != 0) || (tgbotRuntime != "") {
 			updateTgbotSetting(tgbottoken, tgbotchatid, tgbotRuntime)
 		}
+	case "inbound":
+		runInboundCmd(os.Args[2:])
+	case "admin":
+		runAdminCmd(os.Args[2:])
+	case "backup":
+		runBackupCmd(os.Args[2:])
+	case "token":
+		runTokenCmd(os.Args[2:])
+	case "status":
+		err := statusCmd.Parse(os.Args[2:])
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		showStatus(statusJson)
+	case "check":
+		err := checkCmd.Parse(os.Args[2:])
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		runChecks(checkJson)
 	default:
-		fmt.Println("except 'run' or 'v2-ui' or 'setting' subcommands")
+		fmt.Println("except 'run' or 'agent' or 'v2-ui' or 'migrate' or 'setting' or 'inbound' or 'admin' or 'backup' or 'token' or 'status' or 'check' subcommands")
 		fmt.Println()
 		runCmd.Usage()
 		fmt.Println()
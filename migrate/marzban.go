@@ -0,0 +1,254 @@
+package migrate
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"x-ui/config"
+	"x-ui/database"
+	"x-ui/database/model"
+	"x-ui/util/common"
+	"x-ui/web/service"
+)
+
+const DefaultMarzbanConfigPath = "/var/lib/marzban/xray_config.json"
+
+type marzbanUser struct {
+	Id          int
+	Username    string
+	Status      string
+	UsedTraffic int64
+	DataLimit   *int64
+	Expire      *int64
+}
+
+func (u *marzbanUser) TableName() string {
+	return "users"
+}
+
+type marzbanProxy struct {
+	Id       int
+	UserId   int
+	Type     string
+	Settings string
+}
+
+func (p *marzbanProxy) TableName() string {
+	return "proxies"
+}
+
+type marzbanExcludedInbound struct {
+	ProxyId    int
+	InboundTag string
+}
+
+func (e *marzbanExcludedInbound) TableName() string {
+	return "exclude_inbounds_association"
+}
+
+type marzbanInbound struct {
+	Tag            string                 `json:"tag"`
+	Listen         string                 `json:"listen"`
+	Port           int                    `json:"port"`
+	Protocol       string                 `json:"protocol"`
+	Settings       map[string]interface{} `json:"settings"`
+	StreamSettings json.RawMessage        `json:"streamSettings"`
+	Sniffing       json.RawMessage        `json:"sniffing"`
+}
+
+// marzbanClient maps a marzban proxy to a client of the given protocol, nil if it can not be used there
+func marzbanClient(protocol model.Protocol, proxy *marzbanProxy, user *marzbanUser, email string) map[string]interface{} {
+	settings := map[string]interface{}{}
+	json.Unmarshal([]byte(proxy.Settings), &settings)
+	client := map[string]interface{}{
+		"email":      email,
+		"totalGB":    0,
+		"expiryTime": 0,
+	}
+	if user.DataLimit != nil {
+		client["totalGB"] = *user.DataLimit
+	}
+	if user.Expire != nil {
+		client["expiryTime"] = *user.Expire * 1000
+	}
+	switch protocol {
+	case model.VMess:
+		client["id"] = settings["id"]
+		client["alterId"] = 0
+	case model.VLESS:
+		client["id"] = settings["id"]
+		client["flow"] = settings["flow"]
+	case model.Trojan:
+		client["password"] = settings["password"]
+		client["flow"] = settings["flow"]
+	case model.Shadowsocks:
+		client["password"] = settings["password"]
+		client["method"] = settings["method"]
+	default:
+		return nil
+	}
+	return client
+}
+
+// splitTraffic splits bytes into n shares that differ by one byte at most and add up to bytes
+func splitTraffic(bytes int64, n int) []int64 {
+	shares := make([]int64, n)
+	for i := range shares {
+		shares[i] = bytes / int64(n)
+		if int64(i) < bytes%int64(n) {
+			shares[i]++
+		}
+	}
+	return shares
+}
+
+// migrateFromMarzban imports the inbounds of the marzban xray config with the marzban users as their clients.
+// Marzban limits and counts the traffic of a user over all its protocols, the panel per client, so the data
+// limit and the usage of a user are split evenly between its clients and add up to those of marzban again.
+// The usage is imported as download traffic.
+func migrateFromMarzban(dbPath string, configPath string) error {
+	if configPath == "" {
+		configPath = DefaultMarzbanConfigPath
+	}
+	data, err := os.ReadFile(configPath)
+	if err != nil {
+		return common.NewError("read marzban xray config failed:", err)
+	}
+	xrayConfig := struct {
+		Inbounds []*marzbanInbound `json:"inbounds"`
+	}{}
+	err = json.Unmarshal(data, &xrayConfig)
+	if err != nil {
+		return common.NewError("parse marzban xray config failed:", err)
+	}
+
+	src, err := openDB(dbPath)
+	if err != nil {
+		return common.NewError("open marzban database failed:", err)
+	}
+	users := make([]*marzbanUser, 0)
+	err = src.Find(&users).Error
+	if err != nil {
+		return common.NewError("get marzban users failed:", err)
+	}
+	proxies := make([]*marzbanProxy, 0)
+	err = src.Find(&proxies).Error
+	if err != nil {
+		return common.NewError("get marzban proxies failed:", err)
+	}
+	excluded := make([]*marzbanExcludedInbound, 0)
+	if src.Migrator().HasTable("exclude_inbounds_association") {
+		err = src.Find(&excluded).Error
+		if err != nil {
+			return common.NewError("get marzban excluded inbounds failed:", err)
+		}
+	}
+
+	err = database.InitDB(config.GetDBPath())
+	if err != nil {
+		return common.NewError("init x-ui database failed:", err)
+	}
+	userService := service.UserService{}
+	user, err := userService.GetFirstUser()
+	if err != nil {
+		return common.NewError("get x-ui user failed:", err)
+	}
+
+	userMap := map[int]*marzbanUser{}
+	for _, u := range users {
+		userMap[u.Id] = u
+	}
+	excludedMap := map[string]bool{}
+	for _, e := range excluded {
+		excludedMap[fmt.Sprintf("%d/%s", e.ProxyId, e.InboundTag)] = true
+	}
+
+	// emails are unique across inbounds, so a user only keeps the bare username in the first inbound it joins
+	usedEmails := map[string]bool{}
+	userClients := map[int][]map[string]interface{}{}
+	inbounds := make([]*model.Inbound, 0)
+	inboundSettings := make([]map[string]interface{}, 0)
+	for _, mInbound := range xrayConfig.Inbounds {
+		// fallback inbounds listen on a unix socket or share a port and can not be imported on their own
+		if mInbound.Port <= 0 {
+			continue
+		}
+		protocol := model.Protocol(mInbound.Protocol)
+		clients := make([]map[string]interface{}, 0)
+		for _, proxy := range proxies {
+			if !strings.EqualFold(proxy.Type, mInbound.Protocol) || excludedMap[fmt.Sprintf("%d/%s", proxy.Id, mInbound.Tag)] {
+				continue
+			}
+			u, ok := userMap[proxy.UserId]
+			if !ok {
+				continue
+			}
+			email := u.Username
+			if usedEmails[email] {
+				email = u.Username + "-" + mInbound.Tag
+			}
+			client := marzbanClient(protocol, proxy, u, email)
+			if client == nil {
+				continue
+			}
+			usedEmails[email] = true
+			userClients[u.Id] = append(userClients[u.Id], client)
+			clients = append(clients, client)
+		}
+		if len(clients) == 0 {
+			continue
+		}
+		settings := mInbound.Settings
+		if settings == nil {
+			settings = map[string]interface{}{}
+		}
+		settings["clients"] = clients
+		inboundSettings = append(inboundSettings, settings)
+		inbounds = append(inbounds, &model.Inbound{
+			UserId:         user.Id,
+			Remark:         mInbound.Tag,
+			Enable:         true,
+			Listen:         mInbound.Listen,
+			Port:           mInbound.Port,
+			Protocol:       protocol,
+			StreamSettings: string(mInbound.StreamSettings),
+			Sniffing:       string(mInbound.Sniffing),
+		})
+	}
+
+	// the clients of a user are known only now, the split limits go into the settings written below
+	for userId, clients := range userClients {
+		u := userMap[userId]
+		if u.DataLimit != nil && *u.DataLimit > 0 {
+			limits := splitTraffic(*u.DataLimit, len(clients))
+			for i, client := range clients {
+				client["totalGB"] = limits[i]
+			}
+		}
+	}
+	for i, inbound := range inbounds {
+		settingsData, err := json.MarshalIndent(inboundSettings[i], "", "  ")
+		if err != nil {
+			return err
+		}
+		inbound.Settings = string(settingsData)
+	}
+	count := addInbounds(inbounds)
+
+	inboundService := service.InboundServiceImpl{}
+	for userId, clients := range userClients {
+		u := userMap[userId]
+		used := splitTraffic(u.UsedTraffic, len(clients))
+		for i, client := range clients {
+			email, _ := client["email"].(string)
+			err = inboundService.SetClientTraffic(email, 0, used[i], u.Status == "active" || u.Status == "on_hold")
+			if err != nil {
+				return common.NewError("import client traffic failed:", err)
+			}
+		}
+	}
+
+	fmt.Printf("migrate marzban inbounds success: %v/%v, users: %v\n", count, len(inbounds), len(userClients))
+	return nil
+}
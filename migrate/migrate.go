@@ -0,0 +1,78 @@
+package migrate
+
+import (
+	"fmt"
+	"os"
+	"x-ui/database/model"
+	"x-ui/util/common"
+	"x-ui/v2ui"
+	"x-ui/web/service"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+const (
+	FromXUI     = "x-ui"
+	FromV2UI    = "v2-ui"
+	FromMarzban = "marzban"
+)
+
+// DefaultDBPath returns where the given panel keeps its database on a standard install
+func DefaultDBPath(from string) string {
+	switch from {
+	case FromXUI:
+		return "/etc/x-ui/x-ui.db"
+	case FromV2UI:
+		return "/etc/v2-ui/v2-ui.db"
+	case FromMarzban:
+		return "/var/lib/marzban/db.sqlite3"
+	}
+	return ""
+}
+
+// Migrate imports inbounds and clients of another panel, configPath is only used by marzban
+// which keeps its inbounds in the xray config instead of the database
+func Migrate(from string, dbPath string, configPath string) error {
+	if dbPath == "" {
+		dbPath = DefaultDBPath(from)
+	}
+	switch from {
+	case FromXUI:
+		return migrateFromXUI(dbPath)
+	case FromV2UI:
+		return v2ui.MigrateFromV2UI(dbPath)
+	case FromMarzban:
+		return migrateFromMarzban(dbPath, configPath)
+	}
+	return common.NewError("unknown panel to migrate from:", from)
+}
+
+// openDB opens the database of the other panel, refusing to create it if it is missing
+func openDB(dbPath string) (*gorm.DB, error) {
+	_, err := os.Stat(dbPath)
+	if err != nil {
+		return nil, err
+	}
+	c := &gorm.Config{
+		Logger: logger.Discard,
+	}
+	return gorm.Open(sqlite.Open(dbPath), c)
+}
+
+// addInbounds adds the inbounds one by one so a conflicting port or email only skips that inbound
+func addInbounds(inbounds []*model.Inbound) int {
+	inboundService := service.InboundServiceImpl{}
+	count := 0
+	for _, inbound := range inbounds {
+		inbound.Tag = fmt.Sprintf("inbound-%v", inbound.Port)
+		_, err := inboundService.AddInbound(inbound)
+		if err != nil {
+			fmt.Printf("skip inbound %v on port %v: %v\n", inbound.Remark, inbound.Port, err)
+			continue
+		}
+		count++
+	}
+	return count
+}
@@ -0,0 +1,79 @@
+package migrate
+
+import (
+	"fmt"
+	"x-ui/config"
+	"x-ui/database"
+	"x-ui/database/model"
+	"x-ui/util/common"
+	"x-ui/web/service"
+)
+
+type xuiClientTraffic struct {
+	Email  string
+	Up     int64
+	Down   int64
+	Enable bool
+}
+
+func (t *xuiClientTraffic) TableName() string {
+	return "client_traffics"
+}
+
+// migrateFromXUI imports the original x-ui database and its forks, which share the inbounds table layout
+func migrateFromXUI(dbPath string) error {
+	src, err := openDB(dbPath)
+	if err != nil {
+		return common.NewError("open x-ui database failed:", err)
+	}
+	err = database.InitDB(config.GetDBPath())
+	if err != nil {
+		return common.NewError("init x-ui database failed:", err)
+	}
+
+	inbounds := make([]*model.Inbound, 0)
+	err = src.Model(model.Inbound{}).Find(&inbounds).Error
+	if err != nil {
+		return common.NewError("get source inbounds failed:", err)
+	}
+
+	userService := service.UserService{}
+	user, err := userService.GetFirstUser()
+	if err != nil {
+		return common.NewError("get x-ui user failed:", err)
+	}
+	srcUser := &model.User{}
+	err = src.Model(model.User{}).First(srcUser).Error
+	if err == nil && srcUser.Username != "" && srcUser.Password != "" {
+		err = userService.UpdateFirstUser(srcUser.Username, srcUser.Password)
+		if err != nil {
+			return common.NewError("import login user failed:", err)
+		}
+		fmt.Println("imported login user:", srcUser.Username)
+	}
+
+	for _, inbound := range inbounds {
+		inbound.Id = 0
+		inbound.UserId = user.Id
+		inbound.ClientStats = nil
+	}
+	count := addInbounds(inbounds)
+
+	if src.Migrator().HasTable("client_traffics") {
+		traffics := make([]*xuiClientTraffic, 0)
+		err = src.Find(&traffics).Error
+		if err != nil {
+			return common.NewError("get source client traffics failed:", err)
+		}
+		inboundService := service.InboundServiceImpl{}
+		for _, traffic := range traffics {
+			err = inboundService.SetClientTraffic(traffic.Email, traffic.Up, traffic.Down, traffic.Enable)
+			if err != nil {
+				return common.NewError("import client traffic failed:", err)
+			}
+		}
+	}
+
+	fmt.Printf("migrate x-ui inbounds success: %v/%v\n", count, len(inbounds))
+	return nil
+}
@@ -0,0 +1,76 @@
+// Package botauth parses the allowlist of telegram users that may use the admin commands of the bot
+package botauth
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Commands are the commands that need a permission, the others are open to anyone talking to the bot.
+// approve is the approve and deny buttons of trial requests
+var Commands = []string{"status", "addclient", "restart", "approve"}
+
+// Permissions holds the commands of each user keyed by numeric id or by lowercase username without @
+type Permissions map[string]map[string]bool
+
+// Parse parses one user per line as <id or @username>=<command>,<command>, * grants every command.
+// Empty lines and lines starting with # are skipped
+func Parse(s string) (Permissions, error) {
+	permissions := Permissions{}
+	for _, line := range strings.Split(s, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		user, commands, ok := strings.Cut(line, "=")
+		user = strings.TrimSpace(user)
+		if !ok || user == "" {
+			return nil, fmt.Errorf("bot user must look like @name=usage,status: %v", line)
+		}
+		if strings.HasPrefix(user, "@") {
+			user = strings.ToLower(strings.TrimPrefix(user, "@"))
+		} else if _, err := strconv.ParseInt(user, 10, 64); err != nil {
+			return nil, fmt.Errorf("bot user must be a numeric id or an @username: %v", user)
+		}
+		allowed := map[string]bool{}
+		for _, command := range strings.Split(commands, ",") {
+			command = strings.ToLower(strings.TrimSpace(command))
+			if command == "" {
+				continue
+			}
+			if command != "*" && !isCommand(command) {
+				return nil, fmt.Errorf("unknown bot command %v, known ones are %v", command, strings.Join(Commands, ", "))
+			}
+			allowed[command] = true
+		}
+		permissions[user] = allowed
+	}
+	return permissions, nil
+}
+
+func isCommand(command string) bool {
+	for _, c := range Commands {
+		if c == command {
+			return true
+		}
+	}
+	return false
+}
+
+// Allows tells whether the user with the id and username may use the command, commands that need no
+// permission are always allowed
+func (p Permissions) Allows(id int64, username string, command string) bool {
+	if !isCommand(command) {
+		return true
+	}
+	for _, key := range []string{strconv.FormatInt(id, 10), strings.ToLower(username)} {
+		if key == "" {
+			continue
+		}
+		if allowed := p[key]; allowed["*"] || allowed[command] {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,125 @@
+package dnsapi
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+	"x-ui/util/random"
+)
+
+const alidnsApi = "https://alidns.aliyuncs.com/"
+
+// alidns uses an access key of a RAM user with the AliyunDNSFullAccess policy
+type alidns struct {
+	keyId     string
+	keySecret string
+}
+
+type alidnsResponse struct {
+	Code       string `json:"Code"`
+	Message    string `json:"Message"`
+	DomainName string `json:"DomainName"`
+	RR         string `json:"RR"`
+	RecordId   string `json:"RecordId"`
+	// of DescribeSubDomainRecords
+	DomainRecords struct {
+		Record []struct {
+			RecordId string `json:"RecordId"`
+			Value    string `json:"Value"`
+		} `json:"Record"`
+	} `json:"DomainRecords"`
+}
+
+// percentEncode is the encoding of the rpc signature, url.QueryEscape with spaces as %20 and ~ unescaped
+func percentEncode(s string) string {
+	s = url.QueryEscape(s)
+	s = strings.ReplaceAll(s, "+", "%20")
+	s = strings.ReplaceAll(s, "*", "%2A")
+	return strings.ReplaceAll(s, "%7E", "~")
+}
+
+// call signs the action with the parameters by the rpc signature version 1.0
+func (p *alidns) call(action string, params map[string]string) (*alidnsResponse, error) {
+	query := map[string]string{
+		"Action":           action,
+		"Format":           "JSON",
+		"Version":          "2015-01-09",
+		"AccessKeyId":      p.keyId,
+		"SignatureMethod":  "HMAC-SHA1",
+		"SignatureVersion": "1.0",
+		"SignatureNonce":   random.Seq(16),
+		"Timestamp":        time.Now().UTC().Format("2006-01-02T15:04:05Z"),
+	}
+	for key, value := range params {
+		query[key] = value
+	}
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	pairs := make([]string, 0, len(keys))
+	for _, key := range keys {
+		pairs = append(pairs, percentEncode(key)+"="+percentEncode(query[key]))
+	}
+	canonical := strings.Join(pairs, "&")
+	mac := hmac.New(sha1.New, []byte(p.keySecret+"&"))
+	mac.Write([]byte("GET&%2F&" + percentEncode(canonical)))
+	signature := base64.StdEncoding.EncodeToString(mac.Sum(nil))
+
+	req, err := http.NewRequest(http.MethodGet, alidnsApi+"?"+canonical+"&Signature="+percentEncode(signature), nil)
+	if err != nil {
+		return nil, err
+	}
+	response := &alidnsResponse{}
+	err = doJSON(req, response)
+	if err != nil {
+		return nil, err
+	}
+	if response.Code != "" {
+		return nil, fmt.Errorf("alidns %v: %v %v", action, response.Code, response.Message)
+	}
+	return response, nil
+}
+
+func (p *alidns) Present(fqdn string, value string) error {
+	fqdn = strings.TrimSuffix(fqdn, ".")
+	domain, err := p.call("GetMainDomainName", map[string]string{"InputString": fqdn})
+	if err != nil {
+		return err
+	}
+	_, err = p.call("AddDomainRecord", map[string]string{
+		"DomainName": domain.DomainName,
+		"RR":         domain.RR,
+		"Type":       "TXT",
+		"Value":      value,
+		"TTL":        "600",
+	})
+	return err
+}
+
+func (p *alidns) CleanUp(fqdn string, value string) error {
+	records, err := p.call("DescribeSubDomainRecords", map[string]string{
+		"SubDomain": strings.TrimSuffix(fqdn, "."),
+		"Type":      "TXT",
+	})
+	if err != nil {
+		return err
+	}
+	for _, record := range records.DomainRecords.Record {
+		if record.Value != value {
+			continue
+		}
+		_, err = p.call("DeleteDomainRecord", map[string]string{"RecordId": record.RecordId})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,117 @@
+package dnsapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const cloudflareApi = "https://api.cloudflare.com/client/v4"
+
+// cloudflare uses an api token with the Zone.DNS edit permission
+type cloudflare struct {
+	token string
+}
+
+type cloudflareResponse struct {
+	Success bool `json:"success"`
+	Errors  []struct {
+		Message string `json:"message"`
+	} `json:"errors"`
+	Result json.RawMessage `json:"result"`
+}
+
+func (p *cloudflare) call(method string, path string, body interface{}, result interface{}) error {
+	var data []byte
+	if body != nil {
+		var err error
+		data, err = json.Marshal(body)
+		if err != nil {
+			return err
+		}
+	}
+	req, err := http.NewRequest(method, cloudflareApi+path, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+p.token)
+	req.Header.Set("Content-Type", "application/json")
+	response := &cloudflareResponse{}
+	err = doJSON(req, response)
+	if err != nil {
+		return err
+	}
+	if !response.Success {
+		messages := make([]string, 0, len(response.Errors))
+		for _, e := range response.Errors {
+			messages = append(messages, e.Message)
+		}
+		return fmt.Errorf("cloudflare: %v", strings.Join(messages, ", "))
+	}
+	if result != nil {
+		return json.Unmarshal(response.Result, result)
+	}
+	return nil
+}
+
+// zoneId finds the zone of fqdn by trying its parent domains from the longest
+func (p *cloudflare) zoneId(fqdn string) (string, error) {
+	labels := strings.Split(strings.TrimSuffix(fqdn, "."), ".")
+	for i := 1; i < len(labels)-1; i++ {
+		zones := []struct {
+			Id string `json:"id"`
+		}{}
+		err := p.call(http.MethodGet, "/zones?name="+url.QueryEscape(strings.Join(labels[i:], ".")), nil, &zones)
+		if err != nil {
+			return "", err
+		}
+		if len(zones) > 0 {
+			return zones[0].Id, nil
+		}
+	}
+	return "", fmt.Errorf("cloudflare: no zone for %v", fqdn)
+}
+
+func (p *cloudflare) Present(fqdn string, value string) error {
+	zoneId, err := p.zoneId(fqdn)
+	if err != nil {
+		return err
+	}
+	record := map[string]interface{}{
+		"type":    "TXT",
+		"name":    strings.TrimSuffix(fqdn, "."),
+		"content": value,
+		"ttl":     120,
+	}
+	return p.call(http.MethodPost, "/zones/"+zoneId+"/dns_records", record, nil)
+}
+
+func (p *cloudflare) CleanUp(fqdn string, value string) error {
+	zoneId, err := p.zoneId(fqdn)
+	if err != nil {
+		return err
+	}
+	records := []struct {
+		Id      string `json:"id"`
+		Content string `json:"content"`
+	}{}
+	query := "?type=TXT&name=" + url.QueryEscape(strings.TrimSuffix(fqdn, "."))
+	err = p.call(http.MethodGet, "/zones/"+zoneId+"/dns_records"+query, nil, &records)
+	if err != nil {
+		return err
+	}
+	for _, record := range records {
+		// cloudflare may return the content quoted
+		if strings.Trim(record.Content, `"`) != value {
+			continue
+		}
+		err = p.call(http.MethodDelete, "/zones/"+zoneId+"/dns_records/"+record.Id, nil, nil)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
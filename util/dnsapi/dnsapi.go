@@ -0,0 +1,107 @@
+// Package dnsapi creates and removes the TXT records of ACME dns-01 challenges through the api of a dns provider
+package dnsapi
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Provider adds and removes the TXT record value at fqdn, e.g. _acme-challenge.example.com
+type Provider interface {
+	Present(fqdn string, value string) error
+	CleanUp(fqdn string, value string) error
+}
+
+// Providers are the names New accepts
+var Providers = []string{"cloudflare", "alidns", "exec"}
+
+// New returns the provider with the name, credentials is a json object of the keys the provider needs:
+// apiToken for cloudflare, accessKeyId and accessKeySecret for alidns, command for exec
+func New(name string, credentials string) (Provider, error) {
+	values := map[string]string{}
+	if credentials != "" {
+		err := json.Unmarshal([]byte(credentials), &values)
+		if err != nil {
+			return nil, fmt.Errorf("dns credentials must be a json object of strings: %v", err)
+		}
+	}
+	require := func(keys ...string) error {
+		for _, key := range keys {
+			if values[key] == "" {
+				return fmt.Errorf("dns provider %v needs the credential %v", name, key)
+			}
+		}
+		return nil
+	}
+	switch name {
+	case "cloudflare":
+		if err := require("apiToken"); err != nil {
+			return nil, err
+		}
+		return &cloudflare{token: values["apiToken"]}, nil
+	case "alidns":
+		if err := require("accessKeyId", "accessKeySecret"); err != nil {
+			return nil, err
+		}
+		return &alidns{keyId: values["accessKeyId"], keySecret: values["accessKeySecret"]}, nil
+	case "exec":
+		if err := require("command"); err != nil {
+			return nil, err
+		}
+		return &execProvider{command: values["command"]}, nil
+	}
+	return nil, fmt.Errorf("unknown dns provider: %v", name)
+}
+
+var httpClient = &http.Client{Timeout: time.Second * 30}
+
+// doJSON sends the request and decodes the json response into result
+func doJSON(req *http.Request, result interface{}) error {
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+	err = json.Unmarshal(body, result)
+	if err != nil {
+		return fmt.Errorf("%v %v: %v", req.Method, req.URL.Host, resp.Status)
+	}
+	return nil
+}
+
+// WaitForRecord polls public resolvers until fqdn has the TXT value or the timeout passed,
+// the CA looks the record up itself and may do so before the provider published it everywhere
+func WaitForRecord(fqdn string, value string, timeout time.Duration) bool {
+	resolver := &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+			d := net.Dialer{}
+			return d.DialContext(ctx, network, "1.1.1.1:53")
+		},
+	}
+	deadline := time.Now().Add(timeout)
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+		records, _ := resolver.LookupTXT(ctx, strings.TrimSuffix(fqdn, ".")+".")
+		cancel()
+		for _, record := range records {
+			if record == value {
+				return true
+			}
+		}
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(time.Second * 5)
+	}
+}
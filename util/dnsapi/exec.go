@@ -0,0 +1,37 @@
+package dnsapi
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// execTimeout bounds a run of the command, it may wait for the record to propagate
+const execTimeout = time.Minute * 2
+
+// execProvider runs a command for the providers without an api here, the way the exec provider of lego
+// does: "<command> present <fqdn> <value>" and "<command> cleanup <fqdn> <value>". The lego cli or a
+// hook script of another acme client reaches the other dns providers that way
+type execProvider struct {
+	command string
+}
+
+func (p *execProvider) run(action string, fqdn string, value string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), execTimeout)
+	defer cancel()
+	out, err := exec.CommandContext(ctx, p.command, action, fqdn, value).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("dns command %v %v: %v %v", p.command, action, err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+func (p *execProvider) Present(fqdn string, value string) error {
+	return p.run("present", fqdn, value)
+}
+
+func (p *execProvider) CleanUp(fqdn string, value string) error {
+	return p.run("cleanup", fqdn, value)
+}
@@ -0,0 +1,14 @@
+// Package filelock takes exclusive locks on files that are released when the process dies
+package filelock
+
+import "os"
+
+// Lock is a held lock, the file stays open while it is held
+type Lock struct {
+	file *os.File
+}
+
+// Unlock releases the lock
+func (l *Lock) Unlock() error {
+	return l.file.Close()
+}
@@ -0,0 +1,24 @@
+package filelock
+
+import (
+	"os"
+	"syscall"
+)
+
+// TryLock takes an exclusive flock on path without waiting, ok is false if another process holds it
+func TryLock(path string) (lock *Lock, ok bool, err error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, false, err
+	}
+	err = syscall.Flock(int(file.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+	if err == syscall.EWOULDBLOCK {
+		file.Close()
+		return nil, false, nil
+	}
+	if err != nil {
+		file.Close()
+		return nil, false, err
+	}
+	return &Lock{file: file}, true, nil
+}
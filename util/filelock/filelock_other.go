@@ -0,0 +1,10 @@
+//go:build !linux
+// +build !linux
+
+package filelock
+
+import "errors"
+
+func TryLock(path string) (lock *Lock, ok bool, err error) {
+	return nil, false, errors.New("file locks are only supported on linux")
+}
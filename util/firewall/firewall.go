@@ -0,0 +1,125 @@
+// Package firewall opens the ports of inbounds in the host firewall through a driver, ufw or nftables.
+// Drivers mark the rules they add, rules they did not add are never changed
+package firewall
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Port is a port or a range of ports of one protocol, tcp or udp
+type Port struct {
+	Start int    `json:"start"`
+	End   int    `json:"end"`
+	Proto string `json:"proto"`
+}
+
+func (p Port) String() string {
+	if p.Start == p.End {
+		return fmt.Sprintf("%v/%v", p.Start, p.Proto)
+	}
+	return fmt.Sprintf("%v-%v/%v", p.Start, p.End, p.Proto)
+}
+
+// Change is a port the firewall opens or closes
+type Change struct {
+	Action string `json:"action"`
+	Port   Port   `json:"port"`
+}
+
+const (
+	ActionOpen  = "open"
+	ActionClose = "close"
+)
+
+// Driver manages the rules of one firewall, Opened only returns the ports opened through the driver
+type Driver interface {
+	Opened() ([]Port, error)
+	Open(port Port) error
+	Close(port Port) error
+}
+
+var drivers = map[string]func() Driver{}
+
+// Register makes a driver available by name, the drivers of this package register themselves
+func Register(name string, newDriver func() Driver) {
+	drivers[name] = newDriver
+}
+
+// Names returns the names of the registered drivers
+func Names() []string {
+	names := make([]string, 0, len(drivers))
+	for name := range drivers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func New(name string) (Driver, error) {
+	newDriver, ok := drivers[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown firewall driver: %v", name)
+	}
+	return newDriver(), nil
+}
+
+// Reconcile opens the wanted ports that are not open and closes the ones the driver opened that are no longer
+// wanted, with dryRun it only returns the changes
+func Reconcile(driver Driver, wanted []Port, dryRun bool) ([]Change, error) {
+	opened, err := driver.Opened()
+	if err != nil {
+		return nil, err
+	}
+	isOpen := map[Port]bool{}
+	for _, port := range opened {
+		isOpen[port] = true
+	}
+	isWanted := map[Port]bool{}
+	changes := make([]Change, 0)
+	for _, port := range wanted {
+		if isWanted[port] {
+			continue
+		}
+		isWanted[port] = true
+		if !isOpen[port] {
+			changes = append(changes, Change{Action: ActionOpen, Port: port})
+		}
+	}
+	for _, port := range opened {
+		if !isWanted[port] {
+			changes = append(changes, Change{Action: ActionClose, Port: port})
+		}
+	}
+	if dryRun {
+		return changes, nil
+	}
+	for _, change := range changes {
+		if change.Action == ActionOpen {
+			err = driver.Open(change.Port)
+		} else {
+			err = driver.Close(change.Port)
+		}
+		if err != nil {
+			return changes, err
+		}
+	}
+	return changes, nil
+}
+
+// parsePort parses the 443/tcp and 20000:30000/udp forms of ufw, and 20000-30000 ranges
+func parsePort(s string, proto string) (Port, bool) {
+	var port Port
+	port.Proto = proto
+	if n, _ := fmt.Sscanf(s, "%d:%d", &port.Start, &port.End); n == 2 {
+		return port, true
+	}
+	if n, _ := fmt.Sscanf(s, "%d-%d", &port.Start, &port.End); n == 2 {
+		return port, true
+	}
+	if n, _ := fmt.Sscanf(s, "%d", &port.Start); n == 1 {
+		port.End = port.Start
+		return port, true
+	}
+	return port, false
+}
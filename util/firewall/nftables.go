@@ -0,0 +1,97 @@
+package firewall
+
+import (
+	"fmt"
+	"os/exec"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// nftComment marks the rules added by the panel
+const nftComment = "x-ui"
+
+// NftChain is the chain the rules go into, the input chain of the table most distributions set up.
+// A table of its own would not help, packets dropped by another table stay dropped
+var NftChain = []string{"inet", "filter", "input"}
+
+// nftRule matches a rule added by the driver in nft -a output, e.g.
+// tcp dport 443 accept comment "x-ui" # handle 12
+var nftRule = regexp.MustCompile(`^\s*(tcp|udp) dport (\d+(?:-\d+)?) accept comment "` + nftComment + `" # handle (\d+)`)
+
+type nftablesDriver struct{}
+
+func init() {
+	Register("nftables", func() Driver { return nftablesDriver{} })
+}
+
+func nft(args ...string) (string, error) {
+	out, err := exec.Command("nft", args...).CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("nft %v: %v %v", strings.Join(args, " "), err, strings.TrimSpace(string(out)))
+	}
+	return string(out), nil
+}
+
+func nftSpec(port Port) string {
+	if port.Start == port.End {
+		return fmt.Sprint(port.Start)
+	}
+	return fmt.Sprintf("%v-%v", port.Start, port.End)
+}
+
+// rules returns the handles of the rules added by the driver
+func (nftablesDriver) rules() (map[Port]string, error) {
+	out, err := nft(append([]string{"-a", "list", "chain"}, NftChain...)...)
+	if err != nil {
+		return nil, err
+	}
+	handles := map[Port]string{}
+	for _, line := range strings.Split(out, "\n") {
+		match := nftRule.FindStringSubmatch(line)
+		if match == nil {
+			continue
+		}
+		if port, ok := parsePort(match[2], match[1]); ok {
+			handles[port] = match[3]
+		}
+	}
+	return handles, nil
+}
+
+func (d nftablesDriver) Opened() ([]Port, error) {
+	handles, err := d.rules()
+	if err != nil {
+		return nil, err
+	}
+	ports := make([]Port, 0, len(handles))
+	for port := range handles {
+		ports = append(ports, port)
+	}
+	sort.Slice(ports, func(i, j int) bool {
+		return ports[i].String() < ports[j].String()
+	})
+	return ports, nil
+}
+
+// Open inserts the rule at the top of the chain, ahead of drop rules
+func (nftablesDriver) Open(port Port) error {
+	args := append([]string{"insert", "rule"}, NftChain...)
+	args = append(args, port.Proto, "dport", nftSpec(port), "accept", "comment", fmt.Sprintf("%q", nftComment))
+	_, err := nft(args...)
+	return err
+}
+
+func (d nftablesDriver) Close(port Port) error {
+	handles, err := d.rules()
+	if err != nil {
+		return err
+	}
+	handle, ok := handles[port]
+	if !ok {
+		return nil
+	}
+	args := append([]string{"delete", "rule"}, NftChain...)
+	_, err = nft(append(args, "handle", handle)...)
+	return err
+}
@@ -0,0 +1,69 @@
+package firewall
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// ufwComment marks the rules added by the panel
+const ufwComment = "x-ui"
+
+type ufwDriver struct{}
+
+func init() {
+	Register("ufw", func() Driver { return ufwDriver{} })
+}
+
+func ufw(args ...string) (string, error) {
+	out, err := exec.Command("ufw", args...).CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("ufw %v: %v %v", strings.Join(args, " "), err, strings.TrimSpace(string(out)))
+	}
+	return string(out), nil
+}
+
+func ufwSpec(port Port) string {
+	if port.Start == port.End {
+		return fmt.Sprintf("%v/%v", port.Start, port.Proto)
+	}
+	return fmt.Sprintf("%v:%v/%v", port.Start, port.End, port.Proto)
+}
+
+// Opened reads lines like "443/tcp   ALLOW IN   Anywhere   # x-ui" of ufw status, the v6 twins
+// of rules are skipped
+func (ufwDriver) Opened() ([]Port, error) {
+	out, err := ufw("status")
+	if err != nil {
+		return nil, err
+	}
+	ports := make([]Port, 0)
+	for _, line := range strings.Split(out, "\n") {
+		rule, comment, ok := strings.Cut(line, "#")
+		if !ok || strings.TrimSpace(comment) != ufwComment || strings.Contains(rule, "(v6)") {
+			continue
+		}
+		fields := strings.Fields(rule)
+		if len(fields) == 0 {
+			continue
+		}
+		spec, proto, ok := strings.Cut(fields[0], "/")
+		if !ok {
+			continue
+		}
+		if port, ok := parsePort(spec, proto); ok {
+			ports = append(ports, port)
+		}
+	}
+	return ports, nil
+}
+
+func (ufwDriver) Open(port Port) error {
+	_, err := ufw("allow", ufwSpec(port), "comment", ufwComment)
+	return err
+}
+
+func (ufwDriver) Close(port Port) error {
+	_, err := ufw("delete", "allow", ufwSpec(port))
+	return err
+}
@@ -0,0 +1,219 @@
+package geoip
+
+import (
+	"bytes"
+	"net"
+	"os"
+	"sort"
+	"strings"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// ipRange is a network of a country in 16 byte form, so ipv4 and ipv6 sort together
+type ipRange struct {
+	start   net.IP
+	end     net.IP
+	country string
+}
+
+// datCountries looks up countries in the geoip.dat shipped with xray, a protobuf GeoIPList of
+// country codes and their CIDRs
+type datCountries struct {
+	ranges []ipRange
+}
+
+func openDat(path string) (*datCountries, error) {
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	dat := &datCountries{}
+	// GeoIPList { repeated GeoIP entry = 1; }
+	err = eachField(buf, func(num protowire.Number, value []byte) error {
+		if num == 1 {
+			return dat.addEntry(value)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(dat.ranges, func(i, j int) bool {
+		return bytes.Compare(dat.ranges[i].start, dat.ranges[j].start) < 0
+	})
+	return dat, nil
+}
+
+// addEntry parses GeoIP { string country_code = 1; repeated CIDR cidr = 2; bool reverse_match = 3; },
+// the special lists such as private or cn reversed are skipped
+func (d *datCountries) addEntry(buf []byte) error {
+	country := ""
+	cidrs := make([][]byte, 0)
+	reverse := false
+	err := eachField(buf, func(num protowire.Number, value []byte) error {
+		switch num {
+		case 1:
+			country = strings.ToUpper(string(value))
+		case 2:
+			cidrs = append(cidrs, value)
+		case 3:
+			reverse = len(value) > 0 && value[0] != 0
+		}
+		return nil
+	})
+	if err != nil || reverse || len(country) != 2 {
+		return err
+	}
+	for _, cidr := range cidrs {
+		// CIDR { bytes ip = 1; uint32 prefix = 2; }
+		var ip []byte
+		var prefix uint64
+		err = eachField(cidr, func(num protowire.Number, value []byte) error {
+			switch num {
+			case 1:
+				ip = value
+			case 2:
+				prefix, _ = protowire.ConsumeVarint(value)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		if len(ip) != net.IPv4len && len(ip) != net.IPv6len {
+			continue
+		}
+		network := &net.IPNet{IP: net.IP(ip), Mask: net.CIDRMask(int(prefix), len(ip)*8)}
+		start := network.IP.Mask(network.Mask).To16()
+		end := make(net.IP, net.IPv6len)
+		copy(end, start)
+		hostBits := len(ip)*8 - int(prefix)
+		for i := net.IPv6len - 1; hostBits > 0; i-- {
+			if hostBits >= 8 {
+				end[i] = 0xFF
+			} else {
+				end[i] |= byte(1<<uint(hostBits)) - 1
+			}
+			hostBits -= 8
+		}
+		d.ranges = append(d.ranges, ipRange{start: start, end: end, country: country})
+	}
+	return nil
+}
+
+func (d *datCountries) lookup(ip net.IP) string {
+	ip = ip.To16()
+	i := sort.Search(len(d.ranges), func(i int) bool {
+		return bytes.Compare(d.ranges[i].start, ip) > 0
+	})
+	// networks do not overlap between countries, so the last one starting before ip is the candidate
+	if i > 0 && bytes.Compare(ip, d.ranges[i-1].end) <= 0 {
+		return d.ranges[i-1].country
+	}
+	return ""
+}
+
+// eachField calls f with the number and the raw value of each field, varints are passed undecoded
+func eachField(buf []byte, f func(num protowire.Number, value []byte) error) error {
+	for len(buf) > 0 {
+		num, typ, n := protowire.ConsumeTag(buf)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		buf = buf[n:]
+		var value []byte
+		switch typ {
+		case protowire.BytesType:
+			value, n = protowire.ConsumeBytes(buf)
+		default:
+			n = protowire.ConsumeFieldValue(num, typ, buf)
+			if n >= 0 {
+				value = buf[:n]
+			}
+		}
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		buf = buf[n:]
+		if err := f(num, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteDat writes a geoip.dat to outPath with one entry per name of lists, holding the networks of
+// the countries listed under it in the geoip.dat at datPath, xray can then match them as ext:file:name
+func WriteDat(datPath string, outPath string, lists map[string][]string) error {
+	buf, err := os.ReadFile(datPath)
+	if err != nil {
+		return err
+	}
+	cidrs := map[string][][]byte{}
+	err = eachField(buf, func(num protowire.Number, value []byte) error {
+		if num != 1 {
+			return nil
+		}
+		country := ""
+		entryCidrs := make([][]byte, 0)
+		err := eachField(value, func(num protowire.Number, value []byte) error {
+			switch num {
+			case 1:
+				country = strings.ToUpper(string(value))
+			case 2:
+				entryCidrs = append(entryCidrs, value)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		cidrs[country] = entryCidrs
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	names := make([]string, 0, len(lists))
+	for name := range lists {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	out := make([]byte, 0)
+	for _, name := range names {
+		entry := protowire.AppendTag(nil, 1, protowire.BytesType)
+		entry = protowire.AppendString(entry, name)
+		for _, country := range lists[name] {
+			for _, cidr := range cidrs[strings.ToUpper(country)] {
+				entry = protowire.AppendTag(entry, 2, protowire.BytesType)
+				entry = protowire.AppendBytes(entry, cidr)
+			}
+		}
+		out = protowire.AppendTag(out, 1, protowire.BytesType)
+		out = protowire.AppendBytes(out, entry)
+	}
+	return os.WriteFile(outPath, out, 0644)
+}
+
+// ListNames returns the names of the lists in a geoip.dat or geosite.dat, both are protobuf lists of
+// entries named by their first field
+func ListNames(buf []byte) ([]string, error) {
+	names := make([]string, 0)
+	err := eachField(buf, func(num protowire.Number, value []byte) error {
+		if num != 1 {
+			return nil
+		}
+		return eachField(value, func(num protowire.Number, value []byte) error {
+			if num == 1 {
+				names = append(names, string(value))
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return names, nil
+}
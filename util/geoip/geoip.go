@@ -0,0 +1,94 @@
+// Package geoip resolves ip addresses to countries and autonomous systems, from MaxMind DB files
+// like GeoLite2-Country and GeoLite2-ASN or, for countries, from the geoip.dat shipped with xray.
+package geoip
+
+import (
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+type Info struct {
+	Country      string `json:"country"`
+	Asn          uint   `json:"asn"`
+	Organization string `json:"organization"`
+}
+
+var (
+	lock      sync.RWMutex
+	countries *mmdb
+	dat       *datCountries
+	asns      *mmdb
+)
+
+// Load replaces the databases, countryPath is a MaxMind DB or a geoip.dat, either path may be empty
+func Load(countryPath string, asnPath string) error {
+	var newCountries, newAsns *mmdb
+	var newDat *datCountries
+	var err error
+	if strings.HasSuffix(countryPath, ".dat") {
+		newDat, err = openDat(countryPath)
+	} else if countryPath != "" {
+		newCountries, err = openMMDB(countryPath)
+	}
+	if err != nil {
+		return err
+	}
+	if asnPath != "" {
+		newAsns, err = openMMDB(asnPath)
+		if err != nil {
+			return err
+		}
+	}
+
+	lock.Lock()
+	defer lock.Unlock()
+	countries, dat, asns = newCountries, newDat, newAsns
+	return nil
+}
+
+// Lookup returns what the loaded databases know about ip, the fields are empty if they know nothing
+func Lookup(address string) *Info {
+	info := &Info{}
+	ip := net.ParseIP(address)
+	if ip == nil {
+		return info
+	}
+	lock.RLock()
+	defer lock.RUnlock()
+	if countries != nil {
+		if record, err := countries.lookup(ip); err == nil && record != nil {
+			country, _ := record["country"].(map[string]interface{})
+			if country == nil {
+				// addresses of satellite providers and the like only have a registered country
+				country, _ = record["registered_country"].(map[string]interface{})
+			}
+			info.Country, _ = country["iso_code"].(string)
+		}
+	} else if dat != nil {
+		info.Country = dat.lookup(ip)
+	}
+	if asns != nil {
+		if record, err := asns.lookup(ip); err == nil && record != nil {
+			info.Asn = uint(toUint(record["autonomous_system_number"]))
+			info.Organization, _ = record["autonomous_system_organization"].(string)
+		}
+	}
+	return info
+}
+
+// String formats the info like "DE AS3320 Deutsche Telekom AG", empty if nothing is known
+func (i *Info) String() string {
+	parts := make([]string, 0, 3)
+	if i.Country != "" {
+		parts = append(parts, i.Country)
+	}
+	if i.Asn != 0 {
+		parts = append(parts, "AS"+strconv.FormatUint(uint64(i.Asn), 10))
+	}
+	if i.Organization != "" {
+		parts = append(parts, i.Organization)
+	}
+	return strings.Join(parts, " ")
+}
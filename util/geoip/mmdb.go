@@ -0,0 +1,256 @@
+package geoip
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"os"
+)
+
+var metadataMarker = []byte("\xAB\xCD\xEFMaxMind.com")
+
+// mmdb reads MaxMind DB files such as GeoLite2-Country and GeoLite2-ASN, only lookups are supported
+type mmdb struct {
+	buf        []byte
+	nodeCount  uint
+	recordSize uint
+	ipVersion  uint
+	data       []byte
+	ipv4Start  uint
+}
+
+func openMMDB(path string) (*mmdb, error) {
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	index := bytes.LastIndex(buf, metadataMarker)
+	if index < 0 {
+		return nil, errors.New("not a maxmind db: " + path)
+	}
+	metadataStart := index + len(metadataMarker)
+	decoder := &mmdbDecoder{buf: buf[metadataStart:]}
+	value, _, err := decoder.decode(0)
+	if err != nil {
+		return nil, err
+	}
+	metadata, ok := value.(map[string]interface{})
+	if !ok {
+		return nil, errors.New("invalid maxmind db metadata")
+	}
+	db := &mmdb{buf: buf}
+	db.nodeCount = uint(toUint(metadata["node_count"]))
+	db.recordSize = uint(toUint(metadata["record_size"]))
+	db.ipVersion = uint(toUint(metadata["ip_version"]))
+	if db.recordSize != 24 && db.recordSize != 28 && db.recordSize != 32 {
+		return nil, fmt.Errorf("unsupported maxmind db record size: %v", db.recordSize)
+	}
+	treeSize := db.recordSize * 2 / 8 * db.nodeCount
+	if treeSize+16 > uint(index) {
+		return nil, errors.New("maxmind db is truncated")
+	}
+	db.data = buf[treeSize+16 : index]
+
+	if db.ipVersion == 6 {
+		// ipv4 addresses live under ::/96
+		node := uint(0)
+		for i := 0; i < 96 && node < db.nodeCount; i++ {
+			node = db.readRecord(node, 0)
+		}
+		db.ipv4Start = node
+	}
+	return db, nil
+}
+
+func (db *mmdb) readRecord(node uint, bit uint) uint {
+	switch db.recordSize {
+	case 24:
+		offset := node*6 + bit*3
+		b := db.buf[offset : offset+3]
+		return uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+	case 28:
+		b := db.buf[node*7 : node*7+7]
+		if bit == 0 {
+			return uint(b[3]&0xF0)<<20 | uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+		}
+		return uint(b[3]&0x0F)<<24 | uint(b[4])<<16 | uint(b[5])<<8 | uint(b[6])
+	default:
+		offset := node*8 + bit*4
+		return uint(binary.BigEndian.Uint32(db.buf[offset : offset+4]))
+	}
+}
+
+// lookup returns the record of the ip, nil if the database has none
+func (db *mmdb) lookup(ip net.IP) (map[string]interface{}, error) {
+	node := uint(0)
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+		node = db.ipv4Start
+	} else if db.ipVersion == 4 {
+		return nil, nil
+	}
+	for i := 0; i < len(ip)*8 && node < db.nodeCount; i++ {
+		bit := uint(ip[i/8]>>(7-uint(i%8))) & 1
+		node = db.readRecord(node, bit)
+	}
+	if node <= db.nodeCount {
+		return nil, nil
+	}
+	offset := node - db.nodeCount - 16
+	if offset >= uint(len(db.data)) {
+		return nil, errors.New("invalid maxmind db pointer")
+	}
+	decoder := &mmdbDecoder{buf: db.data}
+	value, _, err := decoder.decode(offset)
+	if err != nil {
+		return nil, err
+	}
+	record, _ := value.(map[string]interface{})
+	return record, nil
+}
+
+type mmdbDecoder struct {
+	buf []byte
+}
+
+func (d *mmdbDecoder) bytes(offset uint, size uint) ([]byte, error) {
+	if offset+size > uint(len(d.buf)) {
+		return nil, errors.New("maxmind db data out of range")
+	}
+	return d.buf[offset : offset+size], nil
+}
+
+func beUint(b []byte) uint64 {
+	var value uint64
+	for _, c := range b {
+		value = value<<8 | uint64(c)
+	}
+	return value
+}
+
+// decode returns the value at offset of the data section and the offset after it
+func (d *mmdbDecoder) decode(offset uint) (interface{}, uint, error) {
+	control, err := d.bytes(offset, 1)
+	if err != nil {
+		return nil, 0, err
+	}
+	offset++
+	kind := uint(control[0] >> 5)
+	if kind == 1 {
+		return d.decodePointer(uint(control[0]), offset)
+	}
+	if kind == 0 {
+		extended, err := d.bytes(offset, 1)
+		if err != nil {
+			return nil, 0, err
+		}
+		kind = 7 + uint(extended[0])
+		offset++
+	}
+	size := uint(control[0] & 0x1F)
+	if size >= 29 {
+		n := size - 28
+		b, err := d.bytes(offset, n)
+		if err != nil {
+			return nil, 0, err
+		}
+		offset += n
+		switch n {
+		case 1:
+			size = 29 + uint(b[0])
+		case 2:
+			size = 285 + uint(beUint(b))
+		default:
+			size = 65821 + uint(beUint(b))
+		}
+	}
+
+	switch kind {
+	case 2: // utf8 string
+		b, err := d.bytes(offset, size)
+		return string(b), offset + size, err
+	case 3: // double
+		b, err := d.bytes(offset, 8)
+		if err != nil {
+			return nil, 0, err
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(b)), offset + 8, nil
+	case 4: // bytes
+		b, err := d.bytes(offset, size)
+		return b, offset + size, err
+	case 5, 6, 9, 10: // unsigned integers
+		b, err := d.bytes(offset, size)
+		return beUint(b), offset + size, err
+	case 7: // map
+		m := make(map[string]interface{}, size)
+		for i := uint(0); i < size; i++ {
+			key, next, err := d.decode(offset)
+			if err != nil {
+				return nil, 0, err
+			}
+			value, next, err := d.decode(next)
+			if err != nil {
+				return nil, 0, err
+			}
+			m[fmt.Sprint(key)] = value
+			offset = next
+		}
+		return m, offset, nil
+	case 8: // int32
+		b, err := d.bytes(offset, size)
+		return int32(beUint(b)), offset + size, err
+	case 11: // array
+		a := make([]interface{}, 0, size)
+		for i := uint(0); i < size; i++ {
+			value, next, err := d.decode(offset)
+			if err != nil {
+				return nil, 0, err
+			}
+			a = append(a, value)
+			offset = next
+		}
+		return a, offset, nil
+	case 14: // boolean
+		return size != 0, offset, nil
+	case 15: // float
+		b, err := d.bytes(offset, 4)
+		if err != nil {
+			return nil, 0, err
+		}
+		return math.Float32frombits(binary.BigEndian.Uint32(b)), offset + 4, nil
+	}
+	return nil, 0, fmt.Errorf("unsupported maxmind db data type: %v", kind)
+}
+
+// decodePointer follows a pointer, the offset after it is the one after the pointer, not the target
+func (d *mmdbDecoder) decodePointer(control uint, offset uint) (interface{}, uint, error) {
+	n := (control>>3)&0x3 + 1
+	b, err := d.bytes(offset, n)
+	if err != nil {
+		return nil, 0, err
+	}
+	value := uint(beUint(b))
+	switch n {
+	case 1:
+		value |= (control & 0x7) << 8
+	case 2:
+		value = (value | (control&0x7)<<16) + 2048
+	case 3:
+		value = (value | (control&0x7)<<24) + 526336
+	}
+	target, _, err := d.decode(value)
+	return target, offset + n, err
+}
+
+func toUint(value interface{}) uint64 {
+	switch v := value.(type) {
+	case uint64:
+		return v
+	case int32:
+		return uint64(v)
+	}
+	return 0
+}
@@ -0,0 +1,407 @@
+package geoip
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// the types of the MaxMind DB data section that have no go type of their own
+type (
+	mmdbUint128 []byte
+	mmdbPointer uint
+)
+
+func mmdbControl(kind uint, size int) []byte {
+	var b []byte
+	var sizeBits byte
+	var extra []byte
+	switch {
+	case size < 29:
+		sizeBits = byte(size)
+	case size < 285:
+		sizeBits = 29
+		extra = []byte{byte(size - 29)}
+	case size < 65821:
+		sizeBits = 30
+		extra = binary.BigEndian.AppendUint16(nil, uint16(size-285))
+	default:
+		sizeBits = 31
+		n := size - 65821
+		extra = []byte{byte(n >> 16), byte(n >> 8), byte(n)}
+	}
+	if kind <= 7 {
+		b = append(b, byte(kind<<5)|sizeBits)
+	} else {
+		b = append(b, sizeBits, byte(kind-7))
+	}
+	return append(b, extra...)
+}
+
+// trimUint drops the leading zero bytes, integers are stored in as few bytes as they need
+func trimUint(b []byte) []byte {
+	for len(b) > 0 && b[0] == 0 {
+		b = b[1:]
+	}
+	return b
+}
+
+func mmdbEncode(t *testing.T, value interface{}) []byte {
+	switch v := value.(type) {
+	case string:
+		return append(mmdbControl(2, len(v)), v...)
+	case float64:
+		return binary.BigEndian.AppendUint64(mmdbControl(3, 8), math.Float64bits(v))
+	case []byte:
+		return append(mmdbControl(4, len(v)), v...)
+	case uint16:
+		b := trimUint(binary.BigEndian.AppendUint16(nil, v))
+		return append(mmdbControl(5, len(b)), b...)
+	case uint32:
+		b := trimUint(binary.BigEndian.AppendUint32(nil, v))
+		return append(mmdbControl(6, len(b)), b...)
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		b := mmdbControl(7, len(v))
+		for _, key := range keys {
+			b = append(b, mmdbEncode(t, key)...)
+			b = append(b, mmdbEncode(t, v[key])...)
+		}
+		return b
+	case int32:
+		b := binary.BigEndian.AppendUint32(nil, uint32(v))
+		return append(mmdbControl(8, len(b)), b...)
+	case uint64:
+		b := trimUint(binary.BigEndian.AppendUint64(nil, v))
+		return append(mmdbControl(9, len(b)), b...)
+	case mmdbUint128:
+		return append(mmdbControl(10, len(v)), v...)
+	case []interface{}:
+		b := mmdbControl(11, len(v))
+		for _, item := range v {
+			b = append(b, mmdbEncode(t, item)...)
+		}
+		return b
+	case bool:
+		if v {
+			return mmdbControl(14, 1)
+		}
+		return mmdbControl(14, 0)
+	case float32:
+		return binary.BigEndian.AppendUint32(mmdbControl(15, 4), math.Float32bits(v))
+	case mmdbPointer:
+		switch {
+		case v < 2048:
+			return []byte{1<<5 | byte(v>>8)&7, byte(v)}
+		case v < 526336:
+			n := v - 2048
+			return []byte{1<<5 | 1<<3 | byte(n>>16)&7, byte(n >> 8), byte(n)}
+		case v < 134744064:
+			n := v - 526336
+			return []byte{1<<5 | 2<<3 | byte(n>>24)&7, byte(n >> 16), byte(n >> 8), byte(n)}
+		default:
+			return binary.BigEndian.AppendUint32([]byte{1<<5 | 3<<3}, uint32(v))
+		}
+	}
+	t.Fatalf("can not encode %T", value)
+	return nil
+}
+
+// mmdbNetwork is a network of the fixture and its record
+type mmdbNetwork struct {
+	cidr   string
+	record map[string]interface{}
+}
+
+// writeMMDB writes a MaxMind DB with the networks, ipv4 networks of an ipv6 database go under ::/96
+func writeMMDB(t *testing.T, recordSize int, ipVersion int, networks []mmdbNetwork) string {
+	// the search tree, a record is a node index, -1 for no data or -2-i for the data of network i
+	tree := [][2]int{{-1, -1}}
+	dataOffsets := make([]int, len(networks))
+	data := make([]byte, 0)
+	for i, network := range networks {
+		_, ipNet, err := net.ParseCIDR(network.cidr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ip := ipNet.IP
+		ones, _ := ipNet.Mask.Size()
+		if ip4 := ip.To4(); ip4 != nil {
+			ip = ip4
+			if ipVersion == 6 {
+				ip = append(make([]byte, 12), ip4...)
+				ones += 96
+			}
+		}
+		node := 0
+		for bit := 0; bit < ones; bit++ {
+			side := int(ip[bit/8]>>(7-bit%8)) & 1
+			if bit == ones-1 {
+				tree[node][side] = -2 - i
+				break
+			}
+			if tree[node][side] < 0 {
+				tree = append(tree, [2]int{-1, -1})
+				tree[node][side] = len(tree) - 1
+			}
+			node = tree[node][side]
+		}
+		dataOffsets[i] = len(data)
+		data = append(data, mmdbEncode(t, network.record)...)
+	}
+
+	nodeCount := len(tree)
+	recordValue := func(record int) uint32 {
+		switch {
+		case record == -1:
+			return uint32(nodeCount)
+		case record < -1:
+			return uint32(nodeCount + 16 + dataOffsets[-2-record])
+		}
+		return uint32(record)
+	}
+	buf := make([]byte, 0)
+	for _, node := range tree {
+		left, right := recordValue(node[0]), recordValue(node[1])
+		switch recordSize {
+		case 24:
+			buf = append(buf, byte(left>>16), byte(left>>8), byte(left), byte(right>>16), byte(right>>8), byte(right))
+		case 28:
+			buf = append(buf, byte(left>>16), byte(left>>8), byte(left), byte(left>>24)<<4|byte(right>>24)&0x0F,
+				byte(right>>16), byte(right>>8), byte(right))
+		default:
+			buf = binary.BigEndian.AppendUint32(buf, left)
+			buf = binary.BigEndian.AppendUint32(buf, right)
+		}
+	}
+	buf = append(buf, make([]byte, 16)...)
+	buf = append(buf, data...)
+	buf = append(buf, metadataMarker...)
+	buf = append(buf, mmdbEncode(t, map[string]interface{}{
+		"node_count":    uint32(nodeCount),
+		"record_size":   uint16(recordSize),
+		"ip_version":    uint16(ipVersion),
+		"database_type": "x-ui-test",
+	})...)
+
+	path := filepath.Join(t.TempDir(), "test.mmdb")
+	err := os.WriteFile(path, buf, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func countryRecord(code string) map[string]interface{} {
+	return map[string]interface{}{"country": map[string]interface{}{"iso_code": code}}
+}
+
+var testNetworks = []mmdbNetwork{
+	{"1.2.3.0/24", countryRecord("DE")},
+	{"1.2.4.128/25", countryRecord("FR")},
+	{"8.8.8.8/32", map[string]interface{}{"registered_country": map[string]interface{}{"iso_code": "US"}}},
+	{"2001:db8::/32", countryRecord("NL")},
+}
+
+func TestMMDBLookup(t *testing.T) {
+	tests := []struct {
+		ip      string
+		v4, v6  string
+		noMatch bool
+	}{
+		{ip: "1.2.3.0", v4: "DE", v6: "DE"},
+		{ip: "1.2.3.255", v4: "DE", v6: "DE"},
+		{ip: "1.2.4.127"},
+		{ip: "1.2.4.128", v4: "FR", v6: "FR"},
+		{ip: "1.2.4.255", v4: "FR", v6: "FR"},
+		{ip: "8.8.8.8", v4: "US", v6: "US"},
+		{ip: "8.8.8.9"},
+		{ip: "2001:db8:1::1", v6: "NL"},
+		{ip: "2001:db9::1"},
+	}
+	for _, recordSize := range []int{24, 28, 32} {
+		for _, ipVersion := range []int{4, 6} {
+			networks := testNetworks
+			if ipVersion == 4 {
+				networks = networks[:3]
+			}
+			db, err := openMMDB(writeMMDB(t, recordSize, ipVersion, networks))
+			if err != nil {
+				t.Fatalf("record size %v, ipv%v: %v", recordSize, ipVersion, err)
+			}
+			for _, test := range tests {
+				want := test.v4
+				if ipVersion == 6 {
+					want = test.v6
+				}
+				record, err := db.lookup(net.ParseIP(test.ip))
+				if err != nil {
+					t.Fatalf("record size %v, ipv%v, %v: %v", recordSize, ipVersion, test.ip, err)
+				}
+				got := ""
+				for _, key := range []string{"country", "registered_country"} {
+					if country, ok := record[key].(map[string]interface{}); ok {
+						got, _ = country["iso_code"].(string)
+					}
+				}
+				if got != want {
+					t.Errorf("record size %v, ipv%v: lookup %v = %q, want %q", recordSize, ipVersion, test.ip, got, want)
+				}
+			}
+		}
+	}
+}
+
+func TestLoadLookup(t *testing.T) {
+	countryPath := writeMMDB(t, 28, 6, testNetworks)
+	asnPath := writeMMDB(t, 24, 6, []mmdbNetwork{
+		{"1.2.3.0/24", map[string]interface{}{
+			"autonomous_system_number":       uint32(3320),
+			"autonomous_system_organization": "Deutsche Telekom AG",
+		}},
+	})
+	err := Load(countryPath, asnPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer Load("", "")
+
+	tests := map[string]string{
+		"1.2.3.4":     "DE AS3320 Deutsche Telekom AG",
+		"8.8.8.8":     "US",
+		"2001:db8::1": "NL",
+		"9.9.9.9":     "",
+		"not an ip":   "",
+	}
+	for ip, want := range tests {
+		if got := Lookup(ip).String(); got != want {
+			t.Errorf("Lookup(%q) = %q, want %q", ip, got, want)
+		}
+	}
+}
+
+func TestMMDBDecodeTypes(t *testing.T) {
+	values := []interface{}{
+		"",
+		"short",
+		strings.Repeat("a", 28),
+		strings.Repeat("b", 29),
+		strings.Repeat("c", 284),
+		strings.Repeat("d", 285),
+		strings.Repeat("e", 65820),
+		strings.Repeat("f", 65821),
+		3.25,
+		[]byte{1, 2, 3},
+		uint16(0),
+		uint16(443),
+		uint32(3320),
+		int32(-7),
+		uint64(1 << 40),
+		true,
+		false,
+		float32(1.5),
+		[]interface{}{"a", uint64(1), []interface{}{}},
+		map[string]interface{}{"nested": map[string]interface{}{"en": "Germany"}, "empty": map[string]interface{}{}},
+	}
+	for _, value := range values {
+		buf := mmdbEncode(t, value)
+		decoder := &mmdbDecoder{buf: buf}
+		got, next, err := decoder.decode(0)
+		if err != nil {
+			t.Fatalf("decode %T: %v", value, err)
+		}
+		if next != uint(len(buf)) {
+			t.Errorf("decode %T ended at %v, want %v", value, next, len(buf))
+		}
+		want := value
+		// the unsigned integers all decode to uint64
+		switch v := value.(type) {
+		case uint16:
+			want = uint64(v)
+		case uint32:
+			want = uint64(v)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("decode %T = %v, want %v", value, got, want)
+		}
+	}
+
+	got, _, err := (&mmdbDecoder{buf: mmdbEncode(t, mmdbUint128{1, 0, 0, 0, 0, 0, 0, 0, 2})}).decode(0)
+	if err != nil || got != uint64(2) {
+		// the low 64 bits, no database has larger numbers where they are read
+		t.Errorf("decode uint128 = %v, %v", got, err)
+	}
+}
+
+func TestMMDBDecodePointer(t *testing.T) {
+	// one pointer of each size that fits a test, the targets are beyond the smaller sizes
+	for _, target := range []uint{0, 1000, 2048, 100000, 526336, 600000} {
+		buf := make([]byte, 0, target+64)
+		if target > 0 {
+			// a string that ends where the target starts
+			filler := int(target) - len(mmdbControl(2, int(target)))
+			for len(mmdbControl(2, filler))+filler != int(target) {
+				filler--
+			}
+			buf = append(buf, mmdbEncode(t, strings.Repeat("x", filler))...)
+		}
+		buf = append(buf, mmdbEncode(t, "shared")...)
+		start := uint(len(buf))
+		buf = append(buf, mmdbEncode(t, map[string]interface{}{"a": mmdbPointer(target), "b": "after"})...)
+
+		decoder := &mmdbDecoder{buf: buf}
+		got, next, err := decoder.decode(start)
+		if err != nil {
+			t.Fatalf("pointer to %v: %v", target, err)
+		}
+		want := map[string]interface{}{"a": "shared", "b": "after"}
+		if !reflect.DeepEqual(got, want) || next != uint(len(buf)) {
+			t.Errorf("pointer to %v: decode = %v ending at %v, want %v ending at %v", target, got, next, want, len(buf))
+		}
+	}
+}
+
+func TestOpenMMDBInvalid(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name string, data []byte) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	metadata := func(nodeCount uint32, recordSize uint16) []byte {
+		return append(append([]byte{}, metadataMarker...), mmdbEncode(t, map[string]interface{}{
+			"node_count":  nodeCount,
+			"record_size": recordSize,
+			"ip_version":  uint16(6),
+		})...)
+	}
+
+	tests := map[string][]byte{
+		"no metadata":        bytes.Repeat([]byte{0}, 64),
+		"bad metadata":       append(append([]byte{}, metadataMarker...), mmdbEncode(t, "not a map")...),
+		"record size":        append(make([]byte, 64), metadata(1, 20)...),
+		"truncated":          append(make([]byte, 6), metadata(1000, 24)...),
+		"metadata truncated": append(append([]byte{}, metadataMarker...), 0xE3),
+	}
+	for name, data := range tests {
+		if _, err := openMMDB(write(strings.ReplaceAll(name, " ", "-")+".mmdb", data)); err == nil {
+			t.Errorf("%v: openMMDB succeeded", name)
+		}
+	}
+	if _, err := openMMDB(filepath.Join(dir, "missing.mmdb")); err == nil {
+		t.Error("openMMDB of a missing file succeeded")
+	}
+}
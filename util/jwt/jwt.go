@@ -0,0 +1,75 @@
+// Package jwt signs and verifies HS256 json web tokens, the only kind the panel issues
+package jwt
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+)
+
+var (
+	ErrInvalid = errors.New("jwt: invalid token")
+	ErrExpired = errors.New("jwt: token expired")
+)
+
+// Claims are the registered claims the panel uses, tokens carry them next to their own
+type Claims struct {
+	Subject   string `json:"sub,omitempty"`
+	IssuedAt  int64  `json:"iat,omitempty"`
+	ExpiresAt int64  `json:"exp,omitempty"`
+}
+
+func (c *Claims) expired(now time.Time) bool {
+	return c.ExpiresAt != 0 && now.Unix() >= c.ExpiresAt
+}
+
+// expirer is implemented by the claims of tokens, by embedding Claims
+type expirer interface {
+	expired(now time.Time) bool
+}
+
+var header = base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`))
+
+func sign(key []byte, data string) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// Sign makes a token of the claims, a struct that embeds Claims
+func Sign(key []byte, claims interface{}) (string, error) {
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	data := header + "." + base64.RawURLEncoding.EncodeToString(payload)
+	return data + "." + sign(key, data), nil
+}
+
+// Verify checks the signature and expiry of the token and reads its claims, a struct that embeds Claims
+func Verify(key []byte, token string, claims interface{}) error {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 || parts[0] != header {
+		return ErrInvalid
+	}
+	expected := sign(key, parts[0]+"."+parts[1])
+	if !hmac.Equal([]byte(parts[2]), []byte(expected)) {
+		return ErrInvalid
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return ErrInvalid
+	}
+	err = json.Unmarshal(payload, claims)
+	if err != nil {
+		return ErrInvalid
+	}
+	if e, ok := claims.(expirer); ok && e.expired(time.Now()) {
+		return ErrExpired
+	}
+	return nil
+}
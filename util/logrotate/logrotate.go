@@ -0,0 +1,75 @@
+// Package logrotate rotates log files that other processes keep open by copying and truncating them,
+// so xray and the panel logger keep writing without being told.
+package logrotate
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// Rotate compresses path into path.1.gz and truncates it once it reaches maxSize bytes, shifting older
+// archives up to path.<maxFiles>.gz. Archives beyond maxFiles or older than maxAge are removed,
+// a zero maxAge keeps them regardless of age. It reports whether the file was rotated.
+func Rotate(path string, maxSize int64, maxFiles int, maxAge time.Duration) (bool, error) {
+	stat, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	defer prune(path, maxFiles, maxAge)
+	if maxSize <= 0 || stat.Size() < maxSize || maxFiles <= 0 {
+		return false, nil
+	}
+
+	for i := maxFiles - 1; i >= 1; i-- {
+		err = os.Rename(archiveName(path, i), archiveName(path, i+1))
+		if err != nil && !os.IsNotExist(err) {
+			return false, err
+		}
+	}
+	err = compress(path, archiveName(path, 1))
+	if err != nil {
+		return false, err
+	}
+	return true, os.Truncate(path, 0)
+}
+
+func archiveName(path string, index int) string {
+	return fmt.Sprintf("%s.%d.gz", path, index)
+}
+
+func compress(src string, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	writer := gzip.NewWriter(out)
+	_, err = io.Copy(writer, in)
+	if err != nil {
+		return err
+	}
+	return writer.Close()
+}
+
+func prune(path string, maxFiles int, maxAge time.Duration) {
+	for i := 1; ; i++ {
+		name := archiveName(path, i)
+		stat, err := os.Stat(name)
+		if err != nil {
+			return
+		}
+		if i > maxFiles || (maxAge > 0 && time.Since(stat.ModTime()) > maxAge) {
+			os.Remove(name)
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+)
+
+type Label struct {
+	Name  string
+	Value string
+}
+
+// Writer writes samples in the Prometheus text exposition format
+type Writer struct {
+	w   io.Writer
+	err error
+}
+
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{w: w}
+}
+
+func (w *Writer) printf(format string, a ...interface{}) {
+	if w.err != nil {
+		return
+	}
+	_, w.err = fmt.Fprintf(w.w, format, a...)
+}
+
+func (w *Writer) Header(name string, help string, typ string) {
+	w.printf("# HELP %s %s\n", name, help)
+	w.printf("# TYPE %s %s\n", name, typ)
+}
+
+func (w *Writer) Sample(name string, value float64, labels ...Label) {
+	w.printf("%s%s %s\n", name, formatLabels(labels), formatValue(value))
+}
+
+func (w *Writer) Err() error {
+	return w.err
+}
+
+func formatLabels(labels []Label) string {
+	if len(labels) == 0 {
+		return ""
+	}
+	parts := make([]string, 0, len(labels))
+	for _, label := range labels {
+		parts = append(parts, fmt.Sprintf("%s=%q", label.Name, label.Value))
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
+
+func formatValue(value float64) string {
+	if math.IsInf(value, 1) {
+		return "+Inf"
+	}
+	return fmt.Sprint(value)
+}
+
+var DefBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+type histogramSeries struct {
+	labels []Label
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+// Histogram is a minimal labeled histogram, enough for request latencies
+type Histogram struct {
+	name       string
+	help       string
+	buckets    []float64
+	labelNames []string
+
+	lock   sync.Mutex
+	series map[string]*histogramSeries
+}
+
+func NewHistogram(name string, help string, buckets []float64, labelNames ...string) *Histogram {
+	return &Histogram{
+		name:       name,
+		help:       help,
+		buckets:    buckets,
+		labelNames: labelNames,
+		series:     map[string]*histogramSeries{},
+	}
+}
+
+func (h *Histogram) Observe(value float64, labelValues ...string) {
+	key := strings.Join(labelValues, "\xff")
+
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	s, ok := h.series[key]
+	if !ok {
+		labels := make([]Label, 0, len(h.labelNames))
+		for i, name := range h.labelNames {
+			if i < len(labelValues) {
+				labels = append(labels, Label{Name: name, Value: labelValues[i]})
+			}
+		}
+		s = &histogramSeries{
+			labels: labels,
+			counts: make([]uint64, len(h.buckets)),
+		}
+		h.series[key] = s
+	}
+	for i, bound := range h.buckets {
+		if value <= bound {
+			s.counts[i]++
+		}
+	}
+	s.sum += value
+	s.count++
+}
+
+func (h *Histogram) Write(w *Writer) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	keys := make([]string, 0, len(h.series))
+	for key := range h.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	w.Header(h.name, h.help, "histogram")
+	for _, key := range keys {
+		s := h.series[key]
+		for i, bound := range h.buckets {
+			labels := append(append([]Label{}, s.labels...), Label{Name: "le", Value: formatValue(bound)})
+			w.Sample(h.name+"_bucket", float64(s.counts[i]), labels...)
+		}
+		labels := append(append([]Label{}, s.labels...), Label{Name: "le", Value: "+Inf"})
+		w.Sample(h.name+"_bucket", float64(s.count), labels...)
+		w.Sample(h.name+"_sum", s.sum, s.labels...)
+		w.Sample(h.name+"_count", float64(s.count), s.labels...)
+	}
+}
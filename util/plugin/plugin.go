@@ -0,0 +1,69 @@
+// Package plugin runs the executables of a directory as hooks, they get the hook name as argument and
+// its data as json on stdin, and may print replacement data on stdout
+package plugin
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Plugin is an executable file in the plugin directory
+type Plugin struct {
+	Name string `json:"name"`
+	Path string `json:"path"`
+}
+
+// List returns the executables of dir sorted by name, so plugins can be ordered with prefixes like 10-,
+// a missing dir has no plugins
+func List(dir string) ([]Plugin, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	plugins := make([]Plugin, 0)
+	for _, entry := range entries {
+		if entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil || !info.Mode().IsRegular() || info.Mode().Perm()&0111 == 0 {
+			continue
+		}
+		plugins = append(plugins, Plugin{Name: entry.Name(), Path: filepath.Join(dir, entry.Name())})
+	}
+	sort.Slice(plugins, func(i, j int) bool {
+		return plugins[i].Name < plugins[j].Name
+	})
+	return plugins, nil
+}
+
+// Call runs the plugin for the hook with data on stdin and returns its stdout, it is killed after timeout
+func Call(p Plugin, hook string, data []byte, timeout time.Duration) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, p.Path, hook)
+	cmd.Dir = filepath.Dir(p.Path)
+	cmd.Env = append(os.Environ(), "XUI_HOOK="+hook)
+	cmd.Stdin = bytes.NewReader(data)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	err := cmd.Run()
+	if ctx.Err() == context.DeadlineExceeded {
+		return nil, fmt.Errorf("plugin %v timed out after %v", p.Name, timeout)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("plugin %v failed: %v %v", p.Name, err, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.Bytes(), nil
+}
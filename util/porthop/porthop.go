@@ -0,0 +1,40 @@
+// Package porthop redirects ranges of udp ports to the port of an inbound with nat rules of the kernel,
+// so clients that hop between the ports of the range all reach the inbound
+package porthop
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Rule redirects udp traffic to the ports Start to End, both included, to Port
+type Rule struct {
+	Start int
+	End   int
+	Port  int
+}
+
+func (r Rule) String() string {
+	return fmt.Sprintf("udp %v-%v to %v", r.Start, r.End, r.Port)
+}
+
+// ParseRange parses a port range like 20000-30000
+func ParseRange(s string) (int, int, error) {
+	startString, endString, ok := strings.Cut(strings.TrimSpace(s), "-")
+	if !ok {
+		return 0, 0, fmt.Errorf("port range must look like 20000-30000: %v", s)
+	}
+	start, err := strconv.Atoi(strings.TrimSpace(startString))
+	if err != nil {
+		return 0, 0, fmt.Errorf("port range must look like 20000-30000: %v", s)
+	}
+	end, err := strconv.Atoi(strings.TrimSpace(endString))
+	if err != nil {
+		return 0, 0, fmt.Errorf("port range must look like 20000-30000: %v", s)
+	}
+	if start < 1 || end > 65535 || start >= end {
+		return 0, 0, fmt.Errorf("port range must be within 1-65535 and start below its end: %v", s)
+	}
+	return start, end, nil
+}
@@ -0,0 +1,88 @@
+//go:build linux
+// +build linux
+
+package porthop
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// the nftables table and the iptables chain that hold the rules, nothing else in them is touched
+const (
+	nftTable      = "xui_porthop"
+	iptablesChain = "XUI-PORTHOP"
+)
+
+func run(name string, stdin string, args ...string) error {
+	cmd := exec.Command(name, args...)
+	if stdin != "" {
+		cmd.Stdin = strings.NewReader(stdin)
+	}
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%v %v: %v %v", name, strings.Join(args, " "), err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// Apply replaces the redirects with rules, no rules removes them. nftables is used if nft is installed,
+// iptables and ip6tables otherwise
+func Apply(rules []Rule) error {
+	if _, err := exec.LookPath("nft"); err == nil {
+		return applyNft(rules)
+	}
+	return applyIptables(rules)
+}
+
+func applyNft(rules []Rule) error {
+	// it does not exist on the first run
+	run("nft", "", "delete", "table", "inet", nftTable)
+	if len(rules) == 0 {
+		return nil
+	}
+	script := &strings.Builder{}
+	fmt.Fprintf(script, "table inet %v {\n", nftTable)
+	fmt.Fprintf(script, "\tchain prerouting {\n\t\ttype nat hook prerouting priority dstnat; policy accept;\n")
+	for _, rule := range rules {
+		fmt.Fprintf(script, "\t\tudp dport %v-%v redirect to :%v\n", rule.Start, rule.End, rule.Port)
+	}
+	fmt.Fprintf(script, "\t}\n}\n")
+	return run("nft", script.String(), "-f", "-")
+}
+
+func applyIptables(rules []Rule) error {
+	for _, command := range []string{"iptables", "ip6tables"} {
+		if _, err := exec.LookPath(command); err != nil {
+			if command == "iptables" && len(rules) > 0 {
+				return errors.New("port hopping needs nft or iptables")
+			}
+			continue
+		}
+		// they do not exist on the first run
+		run(command, "", "-t", "nat", "-D", "PREROUTING", "-j", iptablesChain)
+		run(command, "", "-t", "nat", "-F", iptablesChain)
+		run(command, "", "-t", "nat", "-X", iptablesChain)
+		if len(rules) == 0 {
+			continue
+		}
+		err := run(command, "", "-t", "nat", "-N", iptablesChain)
+		if err != nil {
+			return err
+		}
+		for _, rule := range rules {
+			err = run(command, "", "-t", "nat", "-A", iptablesChain, "-p", "udp",
+				"--dport", fmt.Sprintf("%v:%v", rule.Start, rule.End), "-j", "REDIRECT", "--to-ports", fmt.Sprint(rule.Port))
+			if err != nil {
+				return err
+			}
+		}
+		err = run(command, "", "-t", "nat", "-A", "PREROUTING", "-j", iptablesChain)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
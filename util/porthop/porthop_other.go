@@ -0,0 +1,13 @@
+//go:build !linux
+// +build !linux
+
+package porthop
+
+import "errors"
+
+func Apply(rules []Rule) error {
+	if len(rules) == 0 {
+		return nil
+	}
+	return errors.New("port hopping is only supported on linux")
+}
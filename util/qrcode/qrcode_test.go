@@ -0,0 +1,370 @@
+package qrcode
+
+import (
+	"bytes"
+	"fmt"
+	"image/png"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// the format bits of level M for each mask as ISO/IEC 18004 lists them
+var formatBitsM = [8]string{
+	"101010000010010",
+	"101000100100101",
+	"101111001111100",
+	"101101101001011",
+	"100010111111001",
+	"100000011001110",
+	"100111110010111",
+	"100101010100000",
+}
+
+func TestReedSolomon(t *testing.T) {
+	// the version 1-M symbol of "01234567" from annex I of the standard
+	data := []byte{0x10, 0x20, 0x0C, 0x56, 0x61, 0x80, 0xEC, 0x11, 0xEC, 0x11, 0xEC, 0x11, 0xEC, 0x11, 0xEC, 0x11}
+	want := []byte{0xA5, 0x24, 0xD4, 0xC1, 0xED, 0x36, 0xC7, 0x87, 0x2C, 0x55}
+	divisor := reedSolomonDivisor(10)
+	// the generator polynomial of degree 10 is a^0, a^251, a^67, a^46, a^61, a^118, a^70, a^64, a^94, a^32, a^45
+	wantDivisor := []byte{0xD8, 0xC2, 0x9F, 0x6F, 0xC7, 0x5E, 0x5F, 0x71, 0x9D, 0xC1}
+	if !bytes.Equal(divisor, wantDivisor) {
+		t.Errorf("reedSolomonDivisor(10) = % X, want % X", divisor, wantDivisor)
+	}
+	if got := reedSolomonRemainder(data, divisor); !bytes.Equal(got, want) {
+		t.Errorf("reedSolomonRemainder = % X, want % X", got, want)
+	}
+}
+
+func TestFormatAndVersionBits(t *testing.T) {
+	for mask, want := range formatBitsM {
+		q := newQRCode(1)
+		q.drawFormatBits(mask)
+		first, second := readFormatBits(q)
+		if first != want || second != want {
+			t.Errorf("mask %v: format bits %v and %v, want %v", mask, first, second, want)
+		}
+	}
+
+	for version, want := range map[int]int{7: 0x07C94, 8: 0x085BC, 40: 0x28C69} {
+		q := newQRCode(version)
+		q.drawVersion()
+		var below, right int
+		for i := 17; i >= 0; i-- {
+			if q.Modules[i/3][q.Size-11+i%3] {
+				right |= 1 << i
+			}
+			if q.Modules[q.Size-11+i%3][i/3] {
+				below |= 1 << i
+			}
+		}
+		if right != want || below != want {
+			t.Errorf("version %v: version bits %X and %X, want %X", version, right, below, want)
+		}
+	}
+}
+
+func TestCapacity(t *testing.T) {
+	// data codewords of level M from table 7 of the standard
+	codewords := map[int]int{1: 16, 2: 28, 3: 44, 4: 64, 5: 86, 6: 108, 7: 124, 10: 216, 20: 669, 27: 1128, 40: 2334}
+	for version, want := range codewords {
+		if got := numDataCodewords(version); got != want {
+			t.Errorf("numDataCodewords(%v) = %v, want %v", version, got, want)
+		}
+	}
+
+	// the largest text in byte mode that fits each version
+	capacity := map[int]int{1: 14, 2: 26, 3: 42, 7: 122, 9: 180, 10: 213, 40: 2331}
+	for version, length := range capacity {
+		q, err := Encode(strings.Repeat("a", length))
+		if err != nil || q.Version != version {
+			t.Errorf("%v bytes: got version %v, %v, want %v", length, q.Version, err, version)
+		}
+		if version == 40 {
+			continue
+		}
+		q, err = Encode(strings.Repeat("a", length+1))
+		if err != nil || q.Version != version+1 {
+			t.Errorf("%v bytes: got version %v, %v", length+1, q.Version, err)
+		}
+	}
+	if _, err := Encode(strings.Repeat("a", 2332)); err == nil {
+		t.Error("Encode of 2332 bytes succeeded")
+	}
+}
+
+func TestAlignmentPatternPositions(t *testing.T) {
+	// table E.1 of the standard
+	positions := map[int][]int{
+		1:  nil,
+		2:  {6, 18},
+		7:  {6, 22, 38},
+		14: {6, 26, 46, 66},
+		22: {6, 26, 50, 74, 98},
+		32: {6, 34, 60, 86, 112, 138},
+		36: {6, 24, 50, 76, 102, 128, 154},
+		40: {6, 30, 58, 86, 114, 142, 170},
+	}
+	for version, want := range positions {
+		if got := newQRCode(version).alignmentPatternPositions(); !reflect.DeepEqual(got, want) {
+			t.Errorf("version %v: alignment patterns at %v, want %v", version, got, want)
+		}
+	}
+}
+
+func TestEncodeDecode(t *testing.T) {
+	texts := []string{
+		"",
+		"01234567",
+		"HELLO WORLD",
+		"vless://2f0c8c4e-7a4b-4f0e-9d6a-1e2b3c4d5e6f@example.com:443?type=tcp&security=reality#x-ui",
+		"ünïcödé 二维码",
+		strings.Repeat("vmess://", 40),
+		strings.Repeat("z", 2331),
+	}
+	for _, text := range texts {
+		q, err := Encode(text)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := decode(q)
+		if err != nil {
+			t.Fatalf("%.20q: %v", text, err)
+		}
+		if got != text {
+			t.Errorf("decode = %.20q, want %.20q", got, text)
+		}
+	}
+}
+
+func TestPNG(t *testing.T) {
+	data, err := PNG("HELLO WORLD", 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// version 1 with the quiet zone of 4 modules
+	if size := img.Bounds().Dx(); size != (21+8)*3 || img.Bounds().Dy() != size {
+		t.Fatalf("png is %v, want %vx%v", img.Bounds(), (21+8)*3, (21+8)*3)
+	}
+	dark := func(x, y int) bool {
+		r, _, _, _ := img.At(x, y).RGBA()
+		return r == 0
+	}
+	if dark(0, 0) || dark(3*4-1, 3*4-1) {
+		t.Error("quiet zone is not white")
+	}
+	if !dark(3*4, 3*4) || !dark(3*4+2, 3*4+2) || dark(3*5, 3*5) {
+		t.Error("finder pattern is not at the top left")
+	}
+}
+
+// readFormatBits reads both copies of the format bits, most significant bit first
+func readFormatBits(q *QRCode) (string, string) {
+	bit := func(x, y int) byte {
+		if q.Modules[y][x] {
+			return '1'
+		}
+		return '0'
+	}
+	var first, second []byte
+	for x := 0; x <= 8; x++ {
+		if x != 6 {
+			first = append(first, bit(x, 8))
+		}
+	}
+	for y := 7; y >= 0; y-- {
+		if y != 6 {
+			first = append(first, bit(8, y))
+		}
+	}
+	for y := q.Size - 1; y >= q.Size-7; y-- {
+		second = append(second, bit(8, y))
+	}
+	for x := q.Size - 8; x < q.Size; x++ {
+		second = append(second, bit(x, 8))
+	}
+	return string(first), string(second)
+}
+
+// gfMultiply multiplies in GF(2^8/0x11D) by shifting and adding, apart from reedSolomonMultiply
+func gfMultiply(x, y byte) byte {
+	var z byte
+	for ; y > 0; y >>= 1 {
+		if y&1 != 0 {
+			z ^= x
+		}
+		carry := x & 0x80
+		x <<= 1
+		if carry != 0 {
+			x ^= 0x1D
+		}
+	}
+	return z
+}
+
+// decode reads the text back as a reader of the standard would, checking the function patterns, the
+// format bits and the error correction on the way
+func decode(q *QRCode) (string, error) {
+	if q.Size != q.Version*4+17 {
+		return "", fmt.Errorf("size %v for version %v", q.Size, q.Version)
+	}
+	for _, corner := range [][2]int{{0, 0}, {q.Size - 7, 0}, {0, q.Size - 7}} {
+		for dy := 0; dy < 7; dy++ {
+			for dx := 0; dx < 7; dx++ {
+				ring := maxInt(abs(dx-3), abs(dy-3))
+				if q.Modules[corner[1]+dy][corner[0]+dx] != (ring != 2) {
+					return "", fmt.Errorf("finder pattern at %v", corner)
+				}
+			}
+		}
+	}
+	for i := 8; i < q.Size-8; i++ {
+		if q.Modules[6][i] != (i%2 == 0) || q.Modules[i][6] != (i%2 == 0) {
+			return "", fmt.Errorf("timing pattern at %v", i)
+		}
+	}
+	if !q.Modules[q.Size-8][8] {
+		return "", fmt.Errorf("no dark module")
+	}
+
+	first, second := readFormatBits(q)
+	if first != second {
+		return "", fmt.Errorf("format bits %v and %v differ", first, second)
+	}
+	mask := -1
+	for i, bits := range formatBitsM {
+		if bits == first {
+			mask = i
+		}
+	}
+	if mask < 0 {
+		return "", fmt.Errorf("format bits %v are not of level M", first)
+	}
+
+	reference := newQRCode(q.Version)
+	reference.drawFunctionPatterns()
+	masked := func(x, y int) bool {
+		i, j := y, x
+		switch mask {
+		case 0:
+			return (i+j)%2 == 0
+		case 1:
+			return i%2 == 0
+		case 2:
+			return j%3 == 0
+		case 3:
+			return (i+j)%3 == 0
+		case 4:
+			return (i/2+j/3)%2 == 0
+		case 5:
+			return (i*j)%2+(i*j)%3 == 0
+		case 6:
+			return ((i*j)%2+(i*j)%3)%2 == 0
+		}
+		return ((i+j)%2+(i*j)%3)%2 == 0
+	}
+
+	// the codewords in placement order, pairs of columns right to left, the first going up
+	var bits []bool
+	upward := true
+	for right := q.Size - 1; right > 0; right -= 2 {
+		if right == 6 {
+			right--
+		}
+		for k := 0; k < q.Size; k++ {
+			y := k
+			if upward {
+				y = q.Size - 1 - k
+			}
+			for x := right; x >= right-1; x-- {
+				if !reference.isFunction[y][x] {
+					bits = append(bits, q.Modules[y][x] != masked(x, y))
+				}
+			}
+		}
+		upward = !upward
+	}
+	codewords := make([]byte, len(bits)/8)
+	for i := range codewords {
+		for _, bit := range bits[i*8 : i*8+8] {
+			codewords[i] <<= 1
+			if bit {
+				codewords[i] |= 1
+			}
+		}
+	}
+
+	// deinterleave, the short blocks come first and the data of the long ones has a codeword more
+	numBlocks := numErrorCorrectionBlocks[q.Version]
+	eccLen := eccCodewordsPerBlock[q.Version]
+	numLong := len(codewords) % numBlocks
+	shortData := len(codewords)/numBlocks - eccLen
+	blocks := make([][]byte, numBlocks)
+	k := 0
+	for i := 0; i < shortData+1; i++ {
+		for b := range blocks {
+			if i < shortData || b >= numBlocks-numLong {
+				blocks[b] = append(blocks[b], codewords[k])
+				k++
+			}
+		}
+	}
+	for i := 0; i < eccLen; i++ {
+		for b := range blocks {
+			blocks[b] = append(blocks[b], codewords[k])
+			k++
+		}
+	}
+	var data []byte
+	for b, block := range blocks {
+		// a codeword is valid when the generator roots a^0 to a^(eccLen-1) are roots of it
+		root := byte(1)
+		for i := 0; i < eccLen; i++ {
+			var syndrome byte
+			for _, c := range block {
+				syndrome = gfMultiply(syndrome, root) ^ c
+			}
+			if syndrome != 0 {
+				return "", fmt.Errorf("block %v has syndrome %v at a^%v", b, syndrome, i)
+			}
+			root = gfMultiply(root, 2)
+		}
+		data = append(data, block[:len(block)-eccLen]...)
+	}
+
+	if data[0]>>4 != 0x4 {
+		return "", fmt.Errorf("mode %b is not byte mode", data[0]>>4)
+	}
+	// the segment is shifted by the 4 bits of the mode
+	shifted := make([]byte, len(data)-1)
+	for i := range shifted {
+		shifted[i] = data[i]<<4 | data[i+1]>>4
+	}
+	countBytes := 1
+	if q.Version > 9 {
+		countBytes = 2
+	}
+	length := int(shifted[0])
+	if countBytes == 2 {
+		length = length<<8 | int(shifted[1])
+	}
+	text := shifted[countBytes:]
+	if length > len(text) {
+		return "", fmt.Errorf("length %v is beyond the data", length)
+	}
+	// the terminator is the low half of the codeword the text ends in, the pad codewords follow
+	end := countBytes + length
+	if end < len(data) && data[end]&0x0F != 0 {
+		return "", fmt.Errorf("no terminator")
+	}
+	for i, pad := end+1, byte(0xEC); i < len(data); i, pad = i+1, pad^0xEC^0x11 {
+		if data[i] != pad {
+			return "", fmt.Errorf("pad codeword %v is %X, want %X", i, data[i], pad)
+		}
+	}
+	return string(text[:length]), nil
+}
@@ -1,6 +1,8 @@
 package random
 
 import (
+	crand "crypto/rand"
+	"math/big"
 	"math/rand"
 	"time"
 )
@@ -41,3 +43,26 @@ func Seq(n int) string {
 	}
 	return string(runes)
 }
+
+// SecureSeq returns n digits and letters from crypto/rand, for tokens, passwords and other credentials
+func SecureSeq(n int) string {
+	return secureSeq(allSeq[:], n)
+}
+
+// SecureUpperSeq returns n digits and upper case letters from crypto/rand, for codes that must not be guessable
+func SecureUpperSeq(n int) string {
+	return secureSeq(numUpperSeq[:], n)
+}
+
+func secureSeq(seq []rune, n int) string {
+	runes := make([]rune, n)
+	max := big.NewInt(int64(len(seq)))
+	for i := 0; i < n; i++ {
+		index, err := crand.Int(crand.Reader, max)
+		if err != nil {
+			panic(err)
+		}
+		runes[i] = seq[index.Int64()]
+	}
+	return string(runes)
+}
@@ -0,0 +1,96 @@
+package ratelimit
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// buckets idle longer than this are full again and can be forgotten
+const idleTimeout = time.Minute * 10
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// Limiter is a token bucket per key, each bucket holds up to burst tokens and refills at rate tokens per second
+type Limiter struct {
+	rate    float64
+	burst   float64
+	buckets map[string]*bucket
+	lock    sync.Mutex
+	cleaned time.Time
+}
+
+// NewPerMinute returns a limiter allowing perMinute requests per minute with bursts of the same size,
+// or nil if perMinute is not positive. A nil limiter allows everything.
+func NewPerMinute(perMinute int) *Limiter {
+	if perMinute <= 0 {
+		return nil
+	}
+	return &Limiter{
+		rate:    float64(perMinute) / 60,
+		burst:   float64(perMinute),
+		buckets: map[string]*bucket{},
+		cleaned: time.Now(),
+	}
+}
+
+// Allow takes a token from the bucket of key, when it is empty it returns false and how long until the next token
+func (l *Limiter) Allow(key string) (bool, time.Duration) {
+	if l == nil {
+		return true, 0
+	}
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	b, wait := l.refill(key)
+	if wait > 0 {
+		return false, wait
+	}
+	b.tokens--
+	return true, 0
+}
+
+// Blocked tells whether the bucket of key is empty and how long until the next token, without taking one,
+// for counting only some requests like failed logins
+func (l *Limiter) Blocked(key string) (bool, time.Duration) {
+	if l == nil {
+		return false, 0
+	}
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	_, wait := l.refill(key)
+	return wait > 0, wait
+}
+
+// refill adds the tokens earned since the bucket of key was last used, it returns the bucket and how long
+// until it has a token, 0 if it has one
+func (l *Limiter) refill(key string) (*bucket, time.Duration) {
+	now := time.Now()
+	if now.Sub(l.cleaned) > idleTimeout {
+		l.clean(now)
+	}
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: l.burst, last: now}
+		l.buckets[key] = b
+	}
+	b.tokens = math.Min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+	if b.tokens < 1 {
+		return b, time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+	}
+	return b, 0
+}
+
+func (l *Limiter) clean(now time.Time) {
+	for key, b := range l.buckets {
+		if now.Sub(b.last) > idleTimeout {
+			delete(l.buckets, key)
+		}
+	}
+	l.cleaned = now
+}
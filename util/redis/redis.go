@@ -0,0 +1,217 @@
+// Package redis is a minimal redis client, enough for the locks panel instances coordinate with
+package redis
+
+import (
+	"bufio"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrNil is returned for nil replies, like GET of a missing key
+var ErrNil = errors.New("redis: nil")
+
+type Client struct {
+	addr     string
+	useTLS   bool
+	username string
+	password string
+	db       int
+	timeout  time.Duration
+
+	lock   sync.Mutex
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+// Parse makes a client from a url like redis://:password@host:6379/0, rediss:// connects with tls
+func Parse(rawUrl string) (*Client, error) {
+	u, err := url.Parse(rawUrl)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "redis" && u.Scheme != "rediss" {
+		return nil, fmt.Errorf("redis url must start with redis:// or rediss://: %v", rawUrl)
+	}
+	c := &Client{
+		addr:    u.Host,
+		useTLS:  u.Scheme == "rediss",
+		timeout: time.Second * 5,
+	}
+	if u.Port() == "" {
+		c.addr = net.JoinHostPort(u.Hostname(), "6379")
+	}
+	if u.User != nil {
+		c.username = u.User.Username()
+		c.password, _ = u.User.Password()
+	}
+	if path := strings.Trim(u.Path, "/"); path != "" {
+		c.db, err = strconv.Atoi(path)
+		if err != nil {
+			return nil, fmt.Errorf("redis database must be a number: %v", path)
+		}
+	}
+	return c, nil
+}
+
+func (c *Client) connect() error {
+	dialer := &net.Dialer{Timeout: c.timeout}
+	var conn net.Conn
+	var err error
+	if c.useTLS {
+		host, _, _ := net.SplitHostPort(c.addr)
+		conn, err = tls.DialWithDialer(dialer, "tcp", c.addr, &tls.Config{ServerName: host})
+	} else {
+		conn, err = dialer.Dial("tcp", c.addr)
+	}
+	if err != nil {
+		return err
+	}
+	c.conn = conn
+	c.reader = bufio.NewReader(conn)
+	if c.password != "" {
+		args := []string{"AUTH", c.password}
+		if c.username != "" {
+			args = []string{"AUTH", c.username, c.password}
+		}
+		if _, err := c.roundTrip(args); err != nil {
+			c.close()
+			return err
+		}
+	}
+	if c.db != 0 {
+		if _, err := c.roundTrip([]string{"SELECT", strconv.Itoa(c.db)}); err != nil {
+			c.close()
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *Client) close() {
+	if c.conn != nil {
+		c.conn.Close()
+		c.conn = nil
+	}
+}
+
+func (c *Client) roundTrip(args []string) (interface{}, error) {
+	c.conn.SetDeadline(time.Now().Add(c.timeout))
+	var b strings.Builder
+	fmt.Fprintf(&b, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(&b, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	if _, err := io.WriteString(c.conn, b.String()); err != nil {
+		return nil, err
+	}
+	return c.readReply()
+}
+
+// readReply reads one reply, strings and bulk strings are strings, integers int64 and arrays []interface{}
+func (c *Client) readReply() (interface{}, error) {
+	line, err := c.reader.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+	if line == "" {
+		return nil, errors.New("redis: empty reply")
+	}
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return nil, ReplyError(line[1:])
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, err
+		}
+		if n < 0 {
+			return nil, ErrNil
+		}
+		buf := make([]byte, n+2)
+		if _, err := io.ReadFull(c.reader, buf); err != nil {
+			return nil, err
+		}
+		return string(buf[:n]), nil
+	case '*':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, err
+		}
+		if n < 0 {
+			return nil, ErrNil
+		}
+		values := make([]interface{}, n)
+		for i := range values {
+			values[i], err = c.readReply()
+			if err != nil && err != ErrNil {
+				return nil, err
+			}
+		}
+		return values, nil
+	}
+	return nil, fmt.Errorf("redis: unknown reply %q", line)
+}
+
+// ReplyError is an error the server answered with, the connection is still usable after it
+type ReplyError string
+
+func (e ReplyError) Error() string {
+	return "redis: " + string(e)
+}
+
+// Do sends a command and returns the reply, the connection is opened on first use and again after errors
+func (c *Client) Do(args ...string) (interface{}, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.conn == nil {
+		if err := c.connect(); err != nil {
+			return nil, err
+		}
+	}
+	reply, err := c.roundTrip(args)
+	if err != nil && err != ErrNil {
+		if _, ok := err.(ReplyError); !ok {
+			c.close()
+		}
+	}
+	return reply, err
+}
+
+// SetNX sets key to value if it does not exist, it expires after ttl. It tells whether the key was set
+func (c *Client) SetNX(key string, value string, ttl time.Duration) (bool, error) {
+	_, err := c.Do("SET", key, value, "NX", "PX", strconv.FormatInt(ttl.Milliseconds(), 10))
+	if err == ErrNil {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (c *Client) Get(key string) (string, error) {
+	reply, err := c.Do("GET", key)
+	if err != nil {
+		return "", err
+	}
+	value, _ := reply.(string)
+	return value, nil
+}
+
+func (c *Client) Ping() error {
+	_, err := c.Do("PING")
+	return err
+}
@@ -0,0 +1,70 @@
+// Package schedule parses the hours of the day a client may connect in, like 09:00-17:00
+package schedule
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Window is a span of the day in minutes since midnight, windows with End before Start go past midnight
+type Window struct {
+	Start int
+	End   int
+}
+
+// Schedule is a list of windows, an empty one allows every time of the day
+type Schedule []Window
+
+func parseClock(s string) (int, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(s))
+	if err != nil {
+		return 0, err
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// Parse parses comma separated windows like 09:00-12:00,13:00-17:00 or 22:00-06:00
+func Parse(s string) (Schedule, error) {
+	schedule := Schedule{}
+	for _, field := range strings.Split(s, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		startString, endString, ok := strings.Cut(field, "-")
+		if !ok {
+			return nil, fmt.Errorf("schedule window must look like 09:00-17:00: %v", field)
+		}
+		start, err := parseClock(startString)
+		if err != nil {
+			return nil, fmt.Errorf("schedule window must look like 09:00-17:00: %v", field)
+		}
+		end, err := parseClock(endString)
+		if err != nil {
+			return nil, fmt.Errorf("schedule window must look like 09:00-17:00: %v", field)
+		}
+		if start == end {
+			return nil, fmt.Errorf("schedule window is empty: %v", field)
+		}
+		schedule = append(schedule, Window{Start: start, End: end})
+	}
+	return schedule, nil
+}
+
+// Allows tells whether t, in the location the schedule is meant for, falls in one of the windows
+func (s Schedule) Allows(t time.Time) bool {
+	if len(s) == 0 {
+		return true
+	}
+	minute := t.Hour()*60 + t.Minute()
+	for _, w := range s {
+		if w.Start < w.End && minute >= w.Start && minute < w.End {
+			return true
+		}
+		if w.Start > w.End && (minute >= w.Start || minute < w.End) {
+			return true
+		}
+	}
+	return false
+}
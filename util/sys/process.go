@@ -0,0 +1,31 @@
+package sys
+
+import (
+	"path/filepath"
+
+	"github.com/shirou/gopsutil/v3/process"
+)
+
+// FindProcesses returns the pids of the processes running the executable at path
+func FindProcesses(path string) ([]int32, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		path = resolved
+	}
+	processes, err := process.Processes()
+	if err != nil {
+		return nil, err
+	}
+	pids := make([]int32, 0)
+	for _, p := range processes {
+		exe, err := p.Exe()
+		if err != nil || exe != path {
+			continue
+		}
+		pids = append(pids, p.Pid)
+	}
+	return pids, nil
+}
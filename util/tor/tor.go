@@ -0,0 +1,40 @@
+package tor
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"time"
+)
+
+// DefaultAddress is where the tor daemon of distribution packages listens for socks connections
+const DefaultAddress = "127.0.0.1:9050"
+
+// Check tells whether a socks5 proxy that takes connections without authentication, as tor does,
+// listens at address
+func Check(address string, timeout time.Duration) error {
+	conn, err := net.DialTimeout("tcp", address, timeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(timeout))
+
+	// version 5, one method, no authentication
+	_, err = conn.Write([]byte{5, 1, 0})
+	if err != nil {
+		return err
+	}
+	reply := make([]byte, 2)
+	_, err = conn.Read(reply)
+	if err != nil {
+		return err
+	}
+	if reply[0] != 5 {
+		return fmt.Errorf("%v is not a socks5 proxy", address)
+	}
+	if reply[1] != 0 {
+		return errors.New("the socks proxy asks for authentication")
+	}
+	return nil
+}
@@ -0,0 +1,55 @@
+//go:build linux
+// +build linux
+
+package tor
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+func run(name string, args ...string) error {
+	out, err := exec.Command(name, args...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%v %v: %v %v", name, strings.Join(args, " "), err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// Install installs tor with the package manager of the distribution unless it is installed already
+func Install() error {
+	if _, err := exec.LookPath("tor"); err == nil {
+		return nil
+	}
+	installs := [][]string{
+		{"apt-get", "install", "-y", "tor"},
+		{"dnf", "install", "-y", "tor"},
+		{"yum", "install", "-y", "tor"},
+		{"pacman", "-S", "--noconfirm", "tor"},
+		{"apk", "add", "tor"},
+	}
+	for _, install := range installs {
+		if _, err := exec.LookPath(install[0]); err != nil {
+			continue
+		}
+		return run(install[0], install[1:]...)
+	}
+	return errors.New("no known package manager to install tor with")
+}
+
+// Restart enables the tor service and restarts it
+func Restart() error {
+	if _, err := exec.LookPath("systemctl"); err == nil {
+		err := run("systemctl", "enable", "tor")
+		if err != nil {
+			return err
+		}
+		return run("systemctl", "restart", "tor")
+	}
+	if _, err := exec.LookPath("rc-service"); err == nil {
+		return run("rc-service", "tor", "restart")
+	}
+	return errors.New("no known service manager to start tor with")
+}
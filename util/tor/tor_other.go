@@ -0,0 +1,14 @@
+//go:build !linux
+// +build !linux
+
+package tor
+
+import "errors"
+
+func Install() error {
+	return errors.New("installing tor is only supported on linux")
+}
+
+func Restart() error {
+	return errors.New("managing tor is only supported on linux")
+}
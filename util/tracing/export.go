@@ -0,0 +1,233 @@
+package tracing
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// spans are sent in batches every few seconds, or sooner once a batch is full
+const (
+	exportInterval  = time.Second * 5
+	exportBatchSize = 512
+	// spans beyond this many waiting are dropped, a collector that is down must not grow the memory of the panel
+	maxQueuedSpans = 8192
+	exportTimeout  = time.Second * 10
+)
+
+type exporter struct {
+	endpoint string
+	headers  map[string]string
+	service  string
+	client   *http.Client
+
+	lock    sync.Mutex
+	queue   []*Span
+	dropped int64
+	flush   chan struct{}
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+var active *exporter
+var activeLock sync.Mutex
+
+func current() *exporter {
+	activeLock.Lock()
+	defer activeLock.Unlock()
+	return active
+}
+
+// Configure sends the spans to the OTLP http endpoint, like http://collector:4318/v1/traces, with the
+// headers, e.g. for an api key. An empty endpoint turns tracing off. The spans of the previous endpoint
+// are sent before it is replaced
+func Configure(endpoint string, headers map[string]string, service string) {
+	activeLock.Lock()
+	old := active
+	active = nil
+	if endpoint != "" {
+		active = &exporter{
+			endpoint: endpoint,
+			headers:  headers,
+			service:  service,
+			client:   &http.Client{Timeout: exportTimeout},
+			flush:    make(chan struct{}, 1),
+			stop:     make(chan struct{}),
+			done:     make(chan struct{}),
+		}
+		go active.loop()
+	}
+	activeLock.Unlock()
+	if old != nil {
+		old.close()
+	}
+}
+
+// Shutdown sends the spans that are still queued and turns tracing off
+func Shutdown() {
+	Configure("", nil, "")
+}
+
+func (e *exporter) add(span *Span) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	if len(e.queue) >= maxQueuedSpans {
+		e.dropped++
+		return
+	}
+	e.queue = append(e.queue, span)
+	if len(e.queue) >= exportBatchSize {
+		select {
+		case e.flush <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (e *exporter) loop() {
+	defer close(e.done)
+	ticker := time.NewTicker(exportInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-e.stop:
+			e.send()
+			return
+		case <-ticker.C:
+		case <-e.flush:
+		}
+		e.send()
+	}
+}
+
+func (e *exporter) close() {
+	close(e.stop)
+	<-e.done
+}
+
+// send exports the queued spans in batches, a failed batch is dropped with a note in the next one
+func (e *exporter) send() {
+	for {
+		e.lock.Lock()
+		n := len(e.queue)
+		if n > exportBatchSize {
+			n = exportBatchSize
+		}
+		batch := e.queue[:n]
+		e.queue = e.queue[n:]
+		if len(e.queue) == 0 {
+			e.queue = nil
+		}
+		dropped := e.dropped
+		e.lock.Unlock()
+		if len(batch) == 0 {
+			return
+		}
+		err := e.post(batch, dropped)
+		e.lock.Lock()
+		if err != nil {
+			e.dropped += int64(len(batch))
+		} else {
+			e.dropped -= dropped
+		}
+		e.lock.Unlock()
+		if err != nil {
+			return
+		}
+	}
+}
+
+func attribute(key string, value interface{}) map[string]interface{} {
+	var v map[string]interface{}
+	switch value := value.(type) {
+	case bool:
+		v = map[string]interface{}{"boolValue": value}
+	case int:
+		v = map[string]interface{}{"intValue": strconv.Itoa(value)}
+	case int64:
+		v = map[string]interface{}{"intValue": strconv.FormatInt(value, 10)}
+	case float64:
+		v = map[string]interface{}{"doubleValue": value}
+	default:
+		v = map[string]interface{}{"stringValue": fmt.Sprint(value)}
+	}
+	return map[string]interface{}{"key": key, "value": v}
+}
+
+func (s *Span) otlp() map[string]interface{} {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	keys := make([]string, 0, len(s.attrs))
+	for key := range s.attrs {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	attrs := make([]interface{}, 0, len(keys))
+	for _, key := range keys {
+		attrs = append(attrs, attribute(key, s.attrs[key]))
+	}
+	span := map[string]interface{}{
+		"traceId":           hex.EncodeToString(s.traceId[:]),
+		"spanId":            hex.EncodeToString(s.spanId[:]),
+		"name":              s.name,
+		"kind":              s.kind,
+		"startTimeUnixNano": strconv.FormatInt(s.start.UnixNano(), 10),
+		"endTimeUnixNano":   strconv.FormatInt(s.end.UnixNano(), 10),
+		"attributes":        attrs,
+	}
+	if s.parentId != [8]byte{} {
+		span["parentSpanId"] = hex.EncodeToString(s.parentId[:])
+	}
+	if s.err != "" {
+		span["status"] = map[string]interface{}{"code": 2, "message": s.err}
+	}
+	return span
+}
+
+func (e *exporter) post(batch []*Span, dropped int64) error {
+	spans := make([]interface{}, 0, len(batch))
+	for _, span := range batch {
+		spans = append(spans, span.otlp())
+	}
+	resource := []interface{}{attribute("service.name", e.service)}
+	if dropped > 0 {
+		resource = append(resource, attribute("x-ui.dropped_spans", dropped))
+	}
+	body, err := json.Marshal(map[string]interface{}{
+		"resourceSpans": []interface{}{map[string]interface{}{
+			"resource": map[string]interface{}{"attributes": resource},
+			"scopeSpans": []interface{}{map[string]interface{}{
+				"scope": map[string]interface{}{"name": "x-ui"},
+				"spans": spans,
+			}},
+		}},
+	})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, e.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for name, value := range e.headers {
+		req.Header.Set(name, value)
+	}
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("otlp endpoint responded with status %v", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,188 @@
+// Package tracing records spans and exports them as OTLP json over http, enough to follow requests and
+// jobs through a collector like Jaeger or Tempo without the OpenTelemetry sdk
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// span kinds of OTLP
+const (
+	KindInternal = 1
+	KindServer   = 2
+	KindClient   = 3
+)
+
+type Span struct {
+	traceId  [16]byte
+	spanId   [8]byte
+	parentId [8]byte
+	name     string
+	kind     int
+	start    time.Time
+	end      time.Time
+	attrs    map[string]interface{}
+	err      string
+	lock     sync.Mutex
+	ended    bool
+}
+
+type spanKey struct{}
+
+// remoteParent is the span of a traceparent header, the spans of a request continue its trace
+type remoteParent struct {
+	traceId [16]byte
+	spanId  [8]byte
+}
+
+type remoteKey struct{}
+
+func randomBytes(b []byte) {
+	// an all zero id is invalid, crypto/rand does not fail on the supported systems
+	for {
+		rand.Read(b)
+		for _, c := range b {
+			if c != 0 {
+				return
+			}
+		}
+	}
+}
+
+// Enabled tells whether spans are recorded, callers can skip preparing attributes otherwise
+func Enabled() bool {
+	return current() != nil
+}
+
+// FromContext returns the span of ctx, nil if there is none
+func FromContext(ctx context.Context) *Span {
+	if ctx == nil {
+		return nil
+	}
+	span, _ := ctx.Value(spanKey{}).(*Span)
+	return span
+}
+
+// HasParent tells whether a span started with ctx would be part of a trace that is already going on
+func HasParent(ctx context.Context) bool {
+	if ctx == nil {
+		return false
+	}
+	if FromContext(ctx) != nil {
+		return true
+	}
+	_, ok := ctx.Value(remoteKey{}).(*remoteParent)
+	return ok
+}
+
+// Start starts a span in the trace of ctx or a new trace, the span is nil and ctx unchanged when
+// tracing is off. The methods of a nil span do nothing
+func Start(ctx context.Context, name string, kind int) (context.Context, *Span) {
+	if current() == nil {
+		return ctx, nil
+	}
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	span := &Span{name: name, kind: kind, start: time.Now(), attrs: map[string]interface{}{}}
+	if parent := FromContext(ctx); parent != nil {
+		span.traceId = parent.traceId
+		span.parentId = parent.spanId
+	} else if remote, ok := ctx.Value(remoteKey{}).(*remoteParent); ok {
+		span.traceId = remote.traceId
+		span.parentId = remote.spanId
+	} else {
+		randomBytes(span.traceId[:])
+	}
+	randomBytes(span.spanId[:])
+	return context.WithValue(ctx, spanKey{}, span), span
+}
+
+// Extract continues the trace of a W3C traceparent header, an invalid header is ignored
+func Extract(ctx context.Context, traceparent string) context.Context {
+	parts := strings.Split(strings.TrimSpace(traceparent), "-")
+	if len(parts) != 4 || len(parts[1]) != 32 || len(parts[2]) != 16 {
+		return ctx
+	}
+	remote := &remoteParent{}
+	if _, err := hex.Decode(remote.traceId[:], []byte(parts[1])); err != nil {
+		return ctx
+	}
+	if _, err := hex.Decode(remote.spanId[:], []byte(parts[2])); err != nil {
+		return ctx
+	}
+	if remote.traceId == [16]byte{} || remote.spanId == [8]byte{} {
+		return ctx
+	}
+	return context.WithValue(ctx, remoteKey{}, remote)
+}
+
+// TraceParent returns the W3C traceparent header that continues the trace of the span elsewhere
+func (s *Span) TraceParent() string {
+	if s == nil {
+		return ""
+	}
+	return fmt.Sprintf("00-%x-%x-01", s.traceId, s.spanId)
+}
+
+// TraceId returns the id of the trace of the span in hex, e.g. to log it next to a request
+func (s *Span) TraceId() string {
+	if s == nil {
+		return ""
+	}
+	return hex.EncodeToString(s.traceId[:])
+}
+
+// SetStart moves the start of the span back, for work that is only traced once it turns out to be slow
+func (s *Span) SetStart(start time.Time) {
+	if s == nil {
+		return
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.start = start
+}
+
+func (s *Span) SetAttribute(key string, value interface{}) {
+	if s == nil {
+		return
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.attrs[key] = value
+}
+
+// SetError marks the span failed, End does the same with the error it is given
+func (s *Span) SetError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.err = err.Error()
+}
+
+// End ends the span, failed when err is not nil, and queues it for export. Only the first End counts
+func (s *Span) End(err error) {
+	if s == nil {
+		return
+	}
+	s.SetError(err)
+	s.lock.Lock()
+	if s.ended {
+		s.lock.Unlock()
+		return
+	}
+	s.ended = true
+	s.end = time.Now()
+	s.lock.Unlock()
+	if exp := current(); exp != nil {
+		exp.add(s)
+	}
+}
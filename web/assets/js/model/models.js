@@ -36,6 +36,16 @@ class DBInbound {
         this.remark = "";
         this.enable = true;
         this.expiryTime = 0;
+        this.resetDay = 0;
+        this.countryMode = "";
+        this.countries = "";
+        this.certificateId = 0;
+        this.muxConcurrency = 0;
+        this.xudpConcurrency = 0;
+        this.xudpProxyUDP443 = "";
+        this.portHopping = "";
+        this.extraPorts = "";
+        this.notes = "";
 
         this.listen = "";
         this.port = 0;
@@ -84,8 +94,9 @@ class DBInbound {
     }
 
     get address() {
-        let address = location.hostname;
-        if (!ObjectUtil.isEmpty(this.listen) && this.listen !== "0.0.0.0") {
+        // without brackets, links add them where needed
+        let address = location.hostname.replace(/^\[(.*)\]$/, '$1');
+        if (!ObjectUtil.isEmpty(this.listen) && this.listen !== "0.0.0.0" && this.listen !== "::") {
             address = this.listen;
         }
         return address;
@@ -155,6 +166,27 @@ class DBInbound {
         const inbound = this.toInbound();
         return inbound.genLink(this.address, this.remark, clientIndex);
     }
+
+    get ports() {
+        const ports = [this.port];
+        for (const field of this.extraPorts.split(',')) {
+            const port = parseInt(field);
+            if (port > 0) {
+                ports.push(port);
+            }
+        }
+        return ports;
+    }
+
+    // genLinks returns the link of every port, the ones of extra ports with the port in their remark
+    genLinks(clientIndex) {
+        const inbound = this.toInbound();
+        return this.ports.map((port, i) => {
+            inbound.port = port;
+            const remark = i === 0 ? this.remark : this.remark + '-' + port;
+            return inbound.genLink(this.address, remark, clientIndex);
+        });
+    }
 }
 
 class AllSetting {
@@ -164,14 +196,85 @@ class AllSetting {
         this.webPort = 2053;
         this.webCertFile = "";
         this.webKeyFile = "";
+        this.webCertificateId = 0;
         this.webBasePath = "/";
         this.tgBotEnable = false;
         this.tgBotToken = "";
         this.tgBotChatId = 0;
+        this.tgBotUsers = "";
         this.tgRunTime = "";
         this.xrayTemplateConfig = "";
 
         this.timeLocation = "Asia/Tehran";
+        this.ipHistoryRetention = 30;
+        this.uniqueClientIds = false;
+        this.tsdbEnable = false;
+        this.tsdbUrl = "";
+        this.tsdbToken = "";
+        this.tsdbInterval = 60;
+        this.loginRateLimit = 10;
+        this.apiRateLimit = 300;
+        this.subRateLimit = 60;
+        this.subSkipOfflineNodes = true;
+        this.trustedProxies = "127.0.0.1,::1";
+        this.paymentSecret = "";
+        this.trialEnable = false;
+        this.trialInboundId = 0;
+        this.trialTraffic = 1;
+        this.trialHours = 24;
+        this.trialCooldownDays = 30;
+        this.trialApproval = false;
+        this.logFormat = "text";
+        this.logFile = "";
+        this.logMaxSize = 10;
+        this.logMaxFiles = 5;
+        this.logMaxAge = 30;
+        this.logShipping = "";
+        this.logSyslogFacility = "daemon";
+        this.logSyslogTag = "x-ui";
+        this.logLevelWeb = "";
+        this.logLevelXray = "";
+        this.logLevelTgbot = "";
+        this.logLevelJob = "";
+        this.jobSchedules = "{}";
+        this.geoipCountryDb = "";
+        this.geoipAsnDb = "";
+        this.language = "en-US";
+        this.smtpHost = "";
+        this.smtpPort = 587;
+        this.smtpUsername = "";
+        this.smtpPassword = "";
+        this.smtpFrom = "";
+        this.smtpTo = "";
+        this.smtpLoginNotify = false;
+        this.acmeEmail = "";
+        this.acmeDirectory = "https://acme-v02.api.letsencrypt.org/directory";
+        this.acmeDnsProvider = "";
+        this.acmeDnsCredentials = "";
+        this.firewallDriver = "";
+        this.firewallDryRun = false;
+        this.preferredAddressFamily = "ipv4";
+        this.eventScripts = "{}";
+        this.redisUrl = "";
+        this.haLock = "";
+        this.routingPresets = "";
+        this.geoipUrl = "";
+        this.geositeUrl = "";
+        this.geoSigningKey = "";
+        this.torEnable = false;
+        this.torManaged = false;
+        this.torAddress = "127.0.0.1:9050";
+        this.torDomains = "domain:onion";
+        this.reachabilityChecker = "";
+        this.reachabilityCheckerToken = "";
+        this.latencyProbeUrls = "";
+        this.latencyBalancers = false;
+        this.tracingEndpoint = "";
+        this.tracingHeaders = "";
+        this.debugEnable = false;
+        this.jwtSessions = false;
+        this.jwtAccessMinutes = 15;
+        this.jwtRefreshDays = 7;
 
         if (data == null) {
             return
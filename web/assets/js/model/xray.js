@@ -316,6 +316,10 @@ class KcpStreamSettings extends XrayCommonClass {
         this.seed = seed;
     }
 
+    genSeed() {
+        this.seed = RandomUtil.randomSeq(10);
+    }
+
     static fromJson(json={}) {
         return new KcpStreamSettings(
             json.mtu,
@@ -451,22 +455,93 @@ class QuicStreamSettings extends XrayCommonClass {
 }
 
 class GrpcStreamSettings extends XrayCommonClass {
-    constructor(serviceName="") {
+    constructor(serviceName="", multiMode=false, idleTimeout=0, healthCheckTimeout=0, permitWithoutStream=false, initialWindowsSize=0) {
         super();
         this.serviceName = serviceName;
+        this.multiMode = multiMode;
+        this.idleTimeout = idleTimeout;
+        this.healthCheckTimeout = healthCheckTimeout;
+        this.permitWithoutStream = permitWithoutStream;
+        this.initialWindowsSize = initialWindowsSize;
+    }
+
+    get mode() {
+        return this.multiMode ? "multi" : "gun";
     }
 
     static fromJson(json={}) {
-        return new GrpcStreamSettings(json.serviceName);
+        return new GrpcStreamSettings(
+            json.serviceName,
+            json.multiMode,
+            json.idle_timeout,
+            json.health_check_timeout,
+            json.permit_without_stream,
+            json.initial_windows_size,
+        );
     }
 
     toJson() {
         return {
             serviceName: this.serviceName,
+            multiMode: this.multiMode,
+            idle_timeout: this.idleTimeout,
+            health_check_timeout: this.healthCheckTimeout,
+            permit_without_stream: this.permitWithoutStream,
+            initial_windows_size: this.initialWindowsSize,
         }
     }
 }
 
+class HttpUpgradeStreamSettings extends XrayCommonClass {
+    constructor(acceptProxyProtocol=false, path='/', host='') {
+        super();
+        this.acceptProxyProtocol = acceptProxyProtocol;
+        this.path = path;
+        this.host = host;
+    }
+
+    static fromJson(json={}) {
+        return new HttpUpgradeStreamSettings(
+            json.acceptProxyProtocol,
+            json.path,
+            json.host,
+        );
+    }
+
+    toJson() {
+        return {
+            acceptProxyProtocol: this.acceptProxyProtocol,
+            path: this.path,
+            host: this.host,
+        };
+    }
+}
+
+class XHttpStreamSettings extends XrayCommonClass {
+    constructor(path='/', host='', mode='auto') {
+        super();
+        this.path = path;
+        this.host = host;
+        this.mode = mode;
+    }
+
+    static fromJson(json={}) {
+        return new XHttpStreamSettings(
+            json.path,
+            json.host,
+            json.mode,
+        );
+    }
+
+    toJson() {
+        return {
+            path: this.path,
+            host: this.host,
+            mode: this.mode,
+        };
+    }
+}
+
 class TlsStreamSettings extends XrayCommonClass {
     constructor(serverName = '', minVersion = TLS_VERSION_OPTION.TLS12, maxVersion = TLS_VERSION_OPTION.TLS13,
         cipherSuites = '',
@@ -567,6 +642,8 @@ class StreamSettings extends XrayCommonClass {
 		httpSettings=new HttpStreamSettings(),
 		quicSettings=new QuicStreamSettings(),
 		grpcSettings=new GrpcStreamSettings(),
+		httpupgradeSettings=new HttpUpgradeStreamSettings(),
+		xhttpSettings=new XHttpStreamSettings(),
 		) {
         super();
         this.network = network;
@@ -578,6 +655,8 @@ class StreamSettings extends XrayCommonClass {
         this.http = httpSettings;
         this.quic = quicSettings;
         this.grpc = grpcSettings;
+        this.httpupgrade = httpupgradeSettings;
+        this.xhttp = xhttpSettings;
     }
 
     get isTls() {
@@ -621,6 +700,8 @@ class StreamSettings extends XrayCommonClass {
             HttpStreamSettings.fromJson(json.httpSettings),
             QuicStreamSettings.fromJson(json.quicSettings),
             GrpcStreamSettings.fromJson(json.grpcSettings),
+            HttpUpgradeStreamSettings.fromJson(json.httpupgradeSettings),
+            XHttpStreamSettings.fromJson(json.xhttpSettings),
         );
     }
 
@@ -637,6 +718,8 @@ class StreamSettings extends XrayCommonClass {
             httpSettings: network === 'http' ? this.http.toJson() : undefined,
             quicSettings: network === 'quic' ? this.quic.toJson() : undefined,
             grpcSettings: network === 'grpc' ? this.grpc.toJson() : undefined,
+            httpupgradeSettings: network === 'httpupgrade' ? this.httpupgrade.toJson() : undefined,
+            xhttpSettings: network === 'xhttp' ? this.xhttp.toJson() : undefined,
         };
     }
 }
@@ -753,6 +836,14 @@ class Inbound extends XrayCommonClass {
         return this.network === "http";
     }
 
+    get isHttpUpgrade() {
+        return this.network === "httpupgrade";
+    }
+
+    get isXHttp() {
+        return this.network === "xhttp";
+    }
+
     isInboundEmpty() {
         if (this.protocol == Protocols.VMESS && this.settings.vmesses.length == 0) {
             return true;
@@ -924,6 +1015,8 @@ class Inbound extends XrayCommonClass {
             case "http":
             case "quic":
             case "grpc":
+            case "httpupgrade":
+            case "xhttp":
                 return true;
             default:
                 return false;
@@ -1032,6 +1125,14 @@ class Inbound extends XrayCommonClass {
             path = this.stream.quic.key;
         } else if (network === 'grpc') {
             path = this.stream.grpc.serviceName;
+            type = this.stream.grpc.mode;
+        } else if (network === 'httpupgrade') {
+            path = this.stream.httpupgrade.path;
+            host = this.stream.httpupgrade.host;
+        } else if (network === 'xhttp') {
+            path = this.stream.xhttp.path;
+            host = this.stream.xhttp.host;
+            type = this.stream.xhttp.mode;
         }
 
         if (this.stream.security === 'tls') {
@@ -1111,6 +1212,18 @@ class Inbound extends XrayCommonClass {
             case "grpc":
                 const grpc = this.stream.grpc;
                 params.set("serviceName", grpc.serviceName);
+                params.set("mode", grpc.mode);
+                break;
+            case "httpupgrade":
+                const httpupgrade = this.stream.httpupgrade;
+                params.set("path", httpupgrade.path);
+                params.set("host", httpupgrade.host);
+                break;
+            case "xhttp":
+                const xhttp = this.stream.xhttp;
+                params.set("path", xhttp.path);
+                params.set("host", xhttp.host);
+                params.set("mode", xhttp.mode);
                 break;
         }
 
@@ -1126,7 +1239,7 @@ class Inbound extends XrayCommonClass {
             params.set("flow", this.settings.vlesses[clientIndex].flow);
         }
 
-        const link = `vless://${uuid}@${address}:${port}`;
+        const link = `vless://${uuid}@${hostPort(address, port)}`;
         const url = new URL(link);
         for (const [key, value] of params) {
             url.searchParams.set(key, value)
@@ -1142,9 +1255,9 @@ class Inbound extends XrayCommonClass {
             address = server;
         }
         if (settings.method == SSMethods.BLAKE3_AES_128_GCM || settings.method == SSMethods.BLAKE3_AES_256_GCM || settings.method == SSMethods.BLAKE3_CHACHA20_POLY1305) {
-            return `ss://${settings.method}:${settings.password}@${address}:${this.port}#${encodeURIComponent(remark)}`;
+            return `ss://${settings.method}:${settings.password}@${hostPort(address, this.port)}#${encodeURIComponent(remark)}`;
         } else {
-            return 'ss://' + safeBase64(settings.method + ':' + settings.password + '@' + address + ':' + this.port)
+            return 'ss://' + safeBase64(settings.method + ':' + settings.password + '@' + hostPort(address, this.port))
                 + '#' + encodeURIComponent(remark);
         }
     }
@@ -1202,6 +1315,18 @@ class Inbound extends XrayCommonClass {
             case "grpc":
                 const grpc = this.stream.grpc;
                 params.set("serviceName", grpc.serviceName);
+                params.set("mode", grpc.mode);
+                break;
+            case "httpupgrade":
+                const httpupgrade = this.stream.httpupgrade;
+                params.set("path", httpupgrade.path);
+                params.set("host", httpupgrade.host);
+                break;
+            case "xhttp":
+                const xhttp = this.stream.xhttp;
+                params.set("path", xhttp.path);
+                params.set("host", xhttp.host);
+                params.set("mode", xhttp.mode);
                 break;
         }
 
@@ -1215,7 +1340,7 @@ class Inbound extends XrayCommonClass {
         if (this.xtls) {
             params.set("flow", this.settings.trojans[clientIndex].flow);
         }
-        const link = `trojan://${settings.trojans[clientIndex].password}@${address}:${this.port}#${encodeURIComponent(remark)}`;
+        const link = `trojan://${settings.trojans[clientIndex].password}@${hostPort(address, this.port)}#${encodeURIComponent(remark)}`;
         const url = new URL(link);
         for (const [key, value] of params) {
             url.searchParams.set(key, value)
@@ -1359,13 +1484,21 @@ Inbound.VmessSettings = class extends Inbound.Settings {
     }
 };
 Inbound.VmessSettings.Vmess = class extends XrayCommonClass {
-    constructor(id=RandomUtil.randomUUID(), alterId=0, email=RandomUtil.randomText(), totalGB=0, expiryTime='') {
+    constructor(id=RandomUtil.randomUUID(), alterId=0, email=RandomUtil.randomText(), totalGB=0, expiryTime='', resetDay=0, level=0, subId=RandomUtil.randomSeq(16), subEnable=true, notes='', tgId=0, connLimit=0, schedule='') {
         super();
         this.id = id;
         this.alterId = alterId;
         this.email = email;
         this.totalGB = totalGB;
         this.expiryTime = expiryTime;
+        this.resetDay = resetDay;
+        this.level = level;
+        this.subId = subId;
+        this.subEnable = subEnable;
+        this.notes = notes;
+        this.tgId = tgId;
+        this.connLimit = connLimit;
+        this.schedule = schedule;
     }
 
     static fromJson(json={}) {
@@ -1375,7 +1508,14 @@ Inbound.VmessSettings.Vmess = class extends XrayCommonClass {
             json.email,
             json.totalGB,
             json.expiryTime,
-
+            json.resetDay,
+            json.level,
+            json.subId,
+            json.subEnable,
+            json.notes,
+            json.tgId,
+            json.connLimit,
+            json.schedule,
         );
     }
     get _expiryTime() {
@@ -1441,7 +1581,7 @@ Inbound.VLESSSettings = class extends Inbound.Settings {
 };
 Inbound.VLESSSettings.VLESS = class extends XrayCommonClass {
 
-    constructor(id=RandomUtil.randomUUID(), flow='', email=RandomUtil.randomText(), totalGB=0, fingerprint = UTLS_FINGERPRINT.UTLS_CHROME, expiryTime='') {
+    constructor(id=RandomUtil.randomUUID(), flow='', email=RandomUtil.randomText(), totalGB=0, fingerprint = UTLS_FINGERPRINT.UTLS_CHROME, expiryTime='', resetDay=0, level=0, subId=RandomUtil.randomSeq(16), subEnable=true, notes='', tgId=0, connLimit=0, schedule='') {
         super();
         this.id = id;
         this.flow = flow;
@@ -1449,6 +1589,14 @@ Inbound.VLESSSettings.VLESS = class extends XrayCommonClass {
         this.totalGB = totalGB;
         this.fingerprint = fingerprint;
         this.expiryTime = expiryTime;
+        this.resetDay = resetDay;
+        this.level = level;
+        this.subId = subId;
+        this.subEnable = subEnable;
+        this.notes = notes;
+        this.tgId = tgId;
+        this.connLimit = connLimit;
+        this.schedule = schedule;
 
     }
 
@@ -1460,7 +1608,14 @@ Inbound.VLESSSettings.VLESS = class extends XrayCommonClass {
             json.totalGB,
             json.fingerprint,
             json.expiryTime,
-
+            json.resetDay,
+            json.level,
+            json.subId,
+            json.subEnable,
+            json.notes,
+            json.tgId,
+            json.connLimit,
+            json.schedule,
         );
     }
 
@@ -1557,13 +1712,21 @@ Inbound.TrojanSettings = class extends Inbound.Settings {
     }
 };
 Inbound.TrojanSettings.Trojan = class extends XrayCommonClass {
-    constructor(password=RandomUtil.randomSeq(10), flow ='', email=RandomUtil.randomText(), totalGB=0, expiryTime='') {
+    constructor(password=RandomUtil.randomSeq(10), flow ='', email=RandomUtil.randomText(), totalGB=0, expiryTime='', resetDay=0, level=0, subId=RandomUtil.randomSeq(16), subEnable=true, notes='', tgId=0, connLimit=0, schedule='') {
         super();
         this.password = password;
         this.flow = flow;
         this.email = email;
         this.totalGB = totalGB;
         this.expiryTime = expiryTime;
+        this.resetDay = resetDay;
+        this.level = level;
+        this.subId = subId;
+        this.subEnable = subEnable;
+        this.notes = notes;
+        this.tgId = tgId;
+        this.connLimit = connLimit;
+        this.schedule = schedule;
     }
 
     toJson() {
@@ -1573,6 +1736,14 @@ Inbound.TrojanSettings.Trojan = class extends XrayCommonClass {
             email: this.email,
             totalGB: this.totalGB,
             expiryTime: this.expiryTime,
+            resetDay: this.resetDay,
+            level: this.level,
+            subId: this.subId,
+            subEnable: this.subEnable,
+            notes: this.notes,
+            tgId: this.tgId,
+            connLimit: this.connLimit,
+            schedule: this.schedule,
         };
     }
 
@@ -1583,7 +1754,14 @@ Inbound.TrojanSettings.Trojan = class extends XrayCommonClass {
             json.email,
             json.totalGB,
             json.expiryTime,
-
+            json.resetDay,
+            json.level,
+            json.subId,
+            json.subEnable,
+            json.notes,
+            json.tgId,
+            json.connLimit,
+            json.schedule,
         );
     }
 
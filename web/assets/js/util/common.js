@@ -51,6 +51,14 @@ function addZero(num) {
     }
 }
 
+// hostPort puts an ipv6 literal in brackets, like the host part of a url needs
+function hostPort(address, port) {
+    if (address.includes(':') && !address.startsWith('[')) {
+        address = `[${address}]`;
+    }
+    return `${address}:${port}`;
+}
+
 function toFixed(num, n) {
     n = Math.pow(10, n);
     return Math.round(num * n) / n;
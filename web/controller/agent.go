@@ -0,0 +1,170 @@
+package controller
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"x-ui/database/model"
+	"x-ui/web/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// the most ports another panel may have probed in one request
+const maxReachabilityTargets = 1024
+
+// AgentController is the control surface of a node, used by a central panel instead of the web UI
+type AgentController struct {
+	inboundService service.InboundServiceImpl
+	serverService  service.ServerService
+	settingService service.SettingService
+	userService    service.UserService
+	xrayService    service.XrayService
+}
+
+func NewAgentController(g *gin.RouterGroup) *AgentController {
+	a := &AgentController{}
+	a.initRouter(g)
+	return a
+}
+
+func (a *AgentController) initRouter(g *gin.RouterGroup) {
+	g = g.Group("/agent")
+	g.Use(a.checkToken)
+
+	g.GET("/status", a.status)
+	g.GET("/inbounds", a.getInbounds)
+	g.POST("/inbounds/add", a.addInbound)
+	g.POST("/inbounds/update/:id", a.updateInbound)
+	g.POST("/inbounds/del/:id", a.delInbound)
+	g.GET("/traffic", a.getTraffic)
+	g.POST("/clients/enable", a.setClientsEnable)
+	g.POST("/reachability", a.probeReachability)
+}
+
+func (a *AgentController) checkToken(c *gin.Context) {
+	token, err := a.settingService.GetAgentToken()
+	if err != nil || token == "" {
+		c.AbortWithStatus(http.StatusUnauthorized)
+		return
+	}
+	given := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+	if subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+		c.AbortWithStatus(http.StatusUnauthorized)
+		return
+	}
+	c.Next()
+}
+
+func (a *AgentController) status(c *gin.Context) {
+	jsonObj(c, a.serverService.GetStatus(nil), nil)
+}
+
+func (a *AgentController) getInbounds(c *gin.Context) {
+	inbounds, err := a.inboundService.GetAllInbounds()
+	if err != nil {
+		jsonMsg(c, "get inbounds", err)
+		return
+	}
+	jsonObj(c, inbounds, nil)
+}
+
+func (a *AgentController) addInbound(c *gin.Context) {
+	inbound := &model.Inbound{}
+	err := c.ShouldBind(inbound)
+	if err != nil {
+		jsonMsg(c, "add inbound", err)
+		return
+	}
+	user, err := a.userService.GetFirstUser()
+	if err != nil {
+		jsonMsg(c, "add inbound", err)
+		return
+	}
+	inbound.Id = 0
+	inbound.UserId = user.Id
+	inbound.Tag = fmt.Sprintf("inbound-%v", inbound.Port)
+	inbound, err = a.inboundService.AddInbound(inbound)
+	jsonMsgObj(c, "add inbound", inbound, err)
+	if err == nil {
+		a.xrayService.SetToNeedRestart()
+	}
+}
+
+func (a *AgentController) updateInbound(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		jsonMsg(c, "update inbound", err)
+		return
+	}
+	inbound := &model.Inbound{}
+	err = c.ShouldBind(inbound)
+	if err != nil {
+		jsonMsg(c, "update inbound", err)
+		return
+	}
+	inbound.Id = id
+	inbound, err = a.inboundService.UpdateInbound(inbound)
+	jsonMsgObj(c, "update inbound", inbound, err)
+	if err == nil {
+		a.xrayService.SetToNeedRestart()
+	}
+}
+
+func (a *AgentController) delInbound(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		jsonMsg(c, "delete inbound", err)
+		return
+	}
+	err = a.inboundService.DelInbound(id)
+	jsonMsgObj(c, "delete inbound", id, err)
+	if err == nil {
+		a.xrayService.SetToNeedRestart()
+	}
+}
+
+// getTraffic returns the client counters, the central panel keeps track of what it already counted
+func (a *AgentController) getTraffic(c *gin.Context) {
+	traffics, err := a.inboundService.GetAllClientTraffics()
+	if err != nil {
+		jsonMsg(c, "get traffic", err)
+		return
+	}
+	jsonObj(c, traffics, nil)
+}
+
+func (a *AgentController) setClientsEnable(c *gin.Context) {
+	clients := make([]*service.ClientEnable, 0)
+	err := c.ShouldBindJSON(&clients)
+	if err != nil {
+		jsonMsg(c, "set clients enable", err)
+		return
+	}
+	for _, client := range clients {
+		err = a.inboundService.SetClientEnable(client.Email, client.Enable)
+		if err != nil {
+			jsonMsg(c, "set clients enable", err)
+			return
+		}
+	}
+	jsonMsg(c, "set clients enable", nil)
+	a.xrayService.SetToNeedRestart()
+}
+
+// probeReachability dials the ports another panel asked for, this panel is its reachability checker
+func (a *AgentController) probeReachability(c *gin.Context) {
+	targets := make([]*service.ReachabilityTarget, 0)
+	err := c.ShouldBindJSON(&targets)
+	if err != nil {
+		jsonMsg(c, "check reachability", err)
+		return
+	}
+	if len(targets) > maxReachabilityTargets {
+		jsonMsg(c, "check reachability", fmt.Errorf("at most %v ports can be checked at once", maxReachabilityTargets))
+		return
+	}
+	jsonObj(c, service.ProbeTargets(targets), nil)
+}
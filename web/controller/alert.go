@@ -0,0 +1,76 @@
+package controller
+
+import (
+	"strconv"
+	"x-ui/database/model"
+	"x-ui/web/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+type AlertController struct {
+	alertService service.AlertService
+}
+
+func NewAlertController(g *gin.RouterGroup) *AlertController {
+	a := &AlertController{}
+	a.initRouter(g)
+	return a
+}
+
+func (a *AlertController) initRouter(g *gin.RouterGroup) {
+	g = g.Group("/alert")
+
+	g.POST("/list", a.getAlertRules)
+	g.POST("/add", a.addAlertRule)
+	g.POST("/update/:id", a.updateAlertRule)
+	g.POST("/del/:id", a.delAlertRule)
+}
+
+func (a *AlertController) getAlertRules(c *gin.Context) {
+	rules, err := a.alertService.GetAlertRules()
+	if err != nil {
+		jsonMsg(c, "get alert rules", err)
+		return
+	}
+	jsonObj(c, rules, nil)
+}
+
+func (a *AlertController) addAlertRule(c *gin.Context) {
+	rule := &model.AlertRule{}
+	err := c.ShouldBind(rule)
+	if err != nil {
+		jsonMsg(c, "add alert rule", err)
+		return
+	}
+	rule.Id = 0
+	rule, err = a.alertService.AddAlertRule(rule)
+	jsonMsgObj(c, "add alert rule", rule, err)
+}
+
+func (a *AlertController) updateAlertRule(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		jsonMsg(c, "update alert rule", err)
+		return
+	}
+	rule := &model.AlertRule{}
+	err = c.ShouldBind(rule)
+	if err != nil {
+		jsonMsg(c, "update alert rule", err)
+		return
+	}
+	rule.Id = id
+	rule, err = a.alertService.UpdateAlertRule(rule)
+	jsonMsgObj(c, "update alert rule", rule, err)
+}
+
+func (a *AlertController) delAlertRule(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		jsonMsg(c, "delete alert rule", err)
+		return
+	}
+	err = a.alertService.DelAlertRule(id)
+	jsonMsgObj(c, "delete alert rule", id, err)
+}
@@ -3,33 +3,43 @@ package controller
 import (
 	"github.com/gin-gonic/gin"
 )
+
 type APIController struct {
 	BaseController
 
 	inboundController *InboundController
+	serverController  *ServerController
 	settingController *SettingController
+	trafficController *TrafficController
 }
 
-func NewAPIController(g *gin.RouterGroup) *APIController {
-	a := &APIController{}
+// NewAPIController serves the routes of the server controller of the panel under the api too, so its
+// status task does not run twice
+func NewAPIController(g *gin.RouterGroup, serverController *ServerController) *APIController {
+	a := &APIController{serverController: serverController}
 	a.initRouter(g)
 	return a
 }
 
 func (a *APIController) initRouter(g *gin.RouterGroup) {
-	g = g.Group("/xui/API/inbounds")
-	g.Use(a.checkLogin)
+	g = g.Group("/xui/API")
+	g.Use(a.checkLogin, newApiRateLimit())
 
-	g.GET("/", a.inbounds)
-	g.GET("/get/:id", a.inbound)
-	g.POST("/add", a.addInbound)
-	g.POST("/del/:id", a.delInbound)
-	g.POST("/update/:id", a.updateInbound)
+	inbounds := g.Group("/inbounds")
+	inbounds.GET("/", a.inbounds)
+	inbounds.GET("/get/:id", a.inbound)
+	inbounds.POST("/add", withIdempotencyKey(a.addInbound))
+	inbounds.POST("/del/:id", a.delInbound)
+	inbounds.POST("/update/:id", a.updateInbound)
+	inbounds.GET("/onlines", a.onlineClients)
+	inbounds.GET("/clientIps/:email", a.clientIps)
 
-	
-	a.inboundController = NewInboundController(g)
-}
+	g.GET("/server/status", a.serverStatus)
 
+	a.inboundController = NewInboundController(inbounds)
+	a.serverController.initRouter(g)
+	a.trafficController = NewTrafficController(g)
+}
 
 func (a *APIController) inbounds(c *gin.Context) {
 	a.inboundController.getInbounds(c)
@@ -46,3 +56,12 @@ func (a *APIController) delInbound(c *gin.Context) {
 func (a *APIController) updateInbound(c *gin.Context) {
 	a.inboundController.updateInbound(c)
 }
+func (a *APIController) onlineClients(c *gin.Context) {
+	a.inboundController.getOnlineClients(c)
+}
+func (a *APIController) clientIps(c *gin.Context) {
+	a.inboundController.getClientIps(c)
+}
+func (a *APIController) serverStatus(c *gin.Context) {
+	a.serverController.status(c)
+}
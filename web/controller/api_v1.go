@@ -0,0 +1,448 @@
+package controller
+
+import (
+	"net/http"
+	"x-ui/config"
+	"x-ui/database/model"
+	"x-ui/logger"
+	"x-ui/util/firewall"
+	"x-ui/util/openapi"
+	"x-ui/web/service"
+	"x-ui/xray"
+
+	"github.com/gin-gonic/gin"
+)
+
+// APIV1Controller is the versioned api for third-party tools, every route registered through
+// route is also described in the OpenAPI document served at /api/v1/openapi.json
+type APIV1Controller struct {
+	BaseController
+
+	inboundController     *InboundController
+	serverController      *ServerController
+	trafficController     *TrafficController
+	nodeController        *NodeController
+	logController         *LogController
+	jobController         *JobController
+	certificateController *CertificateController
+	policyController      *PolicyController
+	portForwardController *PortForwardController
+	planController        *PlanController
+	outboundController    *OutboundController
+
+	doc *openapi.Document
+}
+
+// NewAPIV1Controller serves the handlers of the other controllers, the status of the server controller of
+// the panel is shared so it is refreshed by one task
+func NewAPIV1Controller(g *gin.RouterGroup, serverController *ServerController) *APIV1Controller {
+	a := &APIV1Controller{
+		inboundController:     newInboundController(),
+		serverController:      serverController,
+		trafficController:     newTrafficController(),
+		nodeController:        newNodeController(),
+		logController:         newLogController(),
+		jobController:         newJobController(),
+		certificateController: newCertificateController(),
+		policyController:      newPolicyController(),
+		portForwardController: newPortForwardController(),
+		outboundController:    newOutboundController(),
+		planController:        newPlanController(),
+		doc:                   openapi.New(config.GetName(), config.GetVersion()),
+	}
+	a.initRouter(g)
+	return a
+}
+
+func (a *APIV1Controller) initRouter(g *gin.RouterGroup) {
+	g = g.Group("/api/v1")
+	g.GET("/openapi.json", a.openapi)
+	g.GET("/docs", a.docs)
+
+	a.doc.Components.SecuritySchemes["basicAuth"] = &openapi.SecurityScheme{Type: "http", Scheme: "basic"}
+	a.doc.Components.SecuritySchemes["session"] = &openapi.SecurityScheme{Type: "apiKey", In: "cookie", Name: "session"}
+	a.doc.Components.SecuritySchemes["bearerAuth"] = &openapi.SecurityScheme{Type: "http", Scheme: "bearer"}
+	a.doc.Security = []map[string][]string{{"basicAuth": {}}, {"bearerAuth": {}}, {"session": {}}}
+
+	g.Use(a.checkLoginOrBasicAuth, newApiRateLimit())
+
+	a.route(g, http.MethodGet, "/inbounds", a.inboundController.getInbounds, &openapi.Operation{
+		Summary:    "List inbounds",
+		Tags:       []string{"inbounds"},
+		Parameters: pageParameters(),
+	}, nil, a.pageSchema([]*model.Inbound{}))
+	a.route(g, http.MethodGet, "/inbounds/:id", a.inboundController.getInbound, &openapi.Operation{
+		Summary: "Get an inbound",
+		Tags:    []string{"inbounds"},
+	}, nil, &model.Inbound{})
+	a.route(g, http.MethodPost, "/inbounds", withIdempotencyKey(a.inboundController.addInbound), &openapi.Operation{
+		Summary: "Add an inbound",
+		Tags:    []string{"inbounds"},
+		Parameters: []*openapi.Parameter{
+			{Name: idempotencyKeyHeader, In: "header", Description: "retries with the same key get the first response instead of adding another inbound", Schema: &openapi.Schema{Type: "string"}},
+			{Name: "streamPreset", In: "query", Description: "name of a stream preset that replaces streamSettings", Schema: &openapi.Schema{Type: "string"}},
+		},
+	}, &model.Inbound{}, &model.Inbound{})
+	a.route(g, http.MethodGet, "/streamPresets", a.inboundController.getStreamPresets, &openapi.Operation{
+		Summary: "List the stream presets, pass the name of one as streamPreset when adding an inbound",
+		Tags:    []string{"inbounds"},
+	}, nil, []*service.StreamPreset{})
+	a.route(g, http.MethodPost, "/inbounds/wizard", a.inboundController.fallbackWizard, &openapi.Operation{
+		Summary: "Check a domain, port, certificate and camouflage site and add a VLESS inbound with fallbacks or reality",
+		Tags:    []string{"inbounds"},
+	}, &service.FallbackWizard{}, &service.WizardResult{})
+	a.route(g, http.MethodPut, "/inbounds/:id", a.inboundController.updateInbound, &openapi.Operation{
+		Summary: "Update an inbound",
+		Tags:    []string{"inbounds"},
+	}, &model.Inbound{}, &model.Inbound{})
+	a.route(g, http.MethodDelete, "/inbounds/:id", a.inboundController.delInbound, &openapi.Operation{
+		Summary: "Delete an inbound",
+		Tags:    []string{"inbounds"},
+	}, nil, 0)
+	a.route(g, http.MethodGet, "/inbounds/:id/replicas", a.inboundController.getReplicas, &openapi.Operation{
+		Summary: "List the nodes an inbound is replicated to",
+		Tags:    []string{"inbounds"},
+	}, nil, []*model.InboundReplica{})
+	a.route(g, http.MethodPut, "/inbounds/:id/replicas", a.inboundController.setReplicas, &openapi.Operation{
+		Summary: "Set the nodes an inbound is replicated to",
+		Tags:    []string{"inbounds"},
+	}, []*model.InboundReplica{}, []*model.InboundReplica{})
+	a.route(g, http.MethodPost, "/inbounds/:id/selfTest", a.inboundController.selfTest, &openapi.Operation{
+		Summary: "Make a request through the inbound with a temporary xray client, as one of its clients, and report whether it worked and its latency",
+		Tags:    []string{"inbounds"},
+		Parameters: []*openapi.Parameter{
+			{Name: "email", In: "query", Description: "email of the client to connect as, the first client of the inbound by default", Schema: &openapi.Schema{Type: "string"}},
+		},
+	}, nil, &service.SelfTestResult{})
+
+	a.route(g, http.MethodPost, "/inbounds/:id/clients/import", a.inboundController.importClients, &openapi.Operation{
+		Summary: "Add the clients of a csv of email, quota in GB, expiry and an optional uuid or password to an inbound, all or none",
+		Tags:    []string{"clients"},
+	}, nil, &service.ClientImportResult{})
+
+	a.route(g, http.MethodGet, "/clients", a.inboundController.getClients, &openapi.Operation{
+		Summary:    "List clients with their traffic",
+		Tags:       []string{"clients"},
+		Parameters: pageParameters(),
+	}, nil, a.pageSchema([]*xray.ClientTraffic{}))
+	a.route(g, http.MethodGet, "/clients/export", a.inboundController.exportClients, &openapi.Operation{
+		Summary: "Export all clients with quota, usage, expiry and share link",
+		Tags:    []string{"clients"},
+		Parameters: []*openapi.Parameter{
+			{Name: "format", In: "query", Description: "csv for a csv file, json if empty", Schema: &openapi.Schema{Type: "string"}},
+		},
+	}, nil, []*service.ClientExport{})
+	a.route(g, http.MethodGet, "/clients/:email/config", a.inboundController.getClientConfig, &openapi.Operation{
+		Summary: "Get a complete xray client config of a client, with the mux settings of its inbound",
+		Tags:    []string{"clients"},
+		Parameters: []*openapi.Parameter{
+			{Name: "download", In: "query", Description: "answer with the bare config as a file download", Schema: &openapi.Schema{Type: "string"}},
+		},
+	}, nil, map[string]interface{}{})
+	a.route(g, http.MethodGet, "/clients/online", a.inboundController.getOnlineClients, &openapi.Operation{
+		Summary: "List online clients",
+		Tags:    []string{"clients"},
+	}, nil, []*service.OnlineClient{})
+	a.route(g, http.MethodGet, "/clients/:email/ips", a.inboundController.getClientIps, &openapi.Operation{
+		Summary:    "List the addresses a client connected from",
+		Tags:       []string{"clients"},
+		Parameters: pageParameters(),
+	}, nil, a.pageSchema([]*model.ClientIpHistory{}))
+	a.route(g, http.MethodPost, "/clients/:email/resetTraffic", a.inboundController.resetClientTraffic, &openapi.Operation{
+		Summary: "Reset the traffic of a client",
+		Tags:    []string{"clients"},
+	}, nil, nil)
+	a.route(g, http.MethodPost, "/clients/:email/rotate", a.inboundController.rotateClient, &openapi.Operation{
+		Summary: "Give a client a new uuid or password, its old share links stop working",
+		Tags:    []string{"clients"},
+	}, nil, &service.RotatedClient{})
+	a.route(g, http.MethodPost, "/clients/:email/connLimit", a.inboundController.setClientConnLimit, &openapi.Operation{
+		Summary: "Set how many addresses a client may be connected from at the same time, 0 removes the limit",
+		Tags:    []string{"clients"},
+	}, &service.ClientConnLimit{}, &service.ClientConnLimit{})
+	a.route(g, http.MethodPost, "/clients/:email/schedule", a.inboundController.setClientSchedule, &openapi.Operation{
+		Summary: "Set the hours of the day a client may connect in, like 09:00-17:00, empty allows any hour",
+		Tags:    []string{"clients"},
+	}, &service.ClientSchedule{}, &service.ClientSchedule{})
+	a.route(g, http.MethodPost, "/clients/:email/subEnable", a.inboundController.setClientSubEnable, &openapi.Operation{
+		Summary: "Turn the subscription url of a client on or off, disabled ones answer 404",
+		Tags:    []string{"clients"},
+	}, &service.ClientSubEnable{}, &service.ClientSubEnable{})
+	a.route(g, http.MethodPost, "/clients/:email/tgId", a.inboundController.setClientTgId, &openapi.Operation{
+		Summary: "Bind a client to a telegram user that gets its expiry, quota and renewal messages, 0 unbinds it",
+		Tags:    []string{"clients"},
+	}, &service.ClientTgId{}, &service.ClientTgId{})
+
+	a.route(g, http.MethodGet, "/server/status", a.serverController.status, &openapi.Operation{
+		Summary: "Get server and xray status",
+		Tags:    []string{"server"},
+	}, nil, &service.Status{})
+	a.route(g, http.MethodGet, "/server/realityDests", a.serverController.getRealityDests, &openapi.Operation{
+		Summary: "Get the last check of the dests of reality inbounds, broken ones come with working alternatives",
+		Tags:    []string{"server"},
+	}, nil, []*service.RealityDestStatus{})
+	a.route(g, http.MethodPost, "/server/updateGeo", a.serverController.updateGeo, &openapi.Operation{
+		Summary: "Update geoip.dat and geosite.dat from the geoipUrl and geositeUrl settings, after checking their checksums and signatures",
+		Tags:    []string{"server"},
+	}, nil, nil)
+	a.route(g, http.MethodGet, "/server/routingPresets", a.serverController.getRoutingPresets, &openapi.Operation{
+		Summary: "List the routing presets, the routingPresets setting enables them by name",
+		Tags:    []string{"server"},
+	}, nil, []*service.RoutingPreset{})
+	a.route(g, http.MethodGet, "/server/tor", a.serverController.getTorStatus, &openapi.Operation{
+		Summary: "Tell whether the tor daemon at the torAddress setting answers",
+		Tags:    []string{"server"},
+	}, nil, &service.TorStatus{})
+	a.route(g, http.MethodGet, "/server/reachability", a.serverController.getReachability, &openapi.Operation{
+		Summary: "Get the last check of whether the reachability checker could connect to the inbound ports",
+		Tags:    []string{"server"},
+	}, nil, []*service.ReachabilityStatus{})
+	a.route(g, http.MethodPost, "/server/reachability/check", a.serverController.checkReachability, &openapi.Operation{
+		Summary: "Have the node or panel of the reachabilityChecker setting connect to the tcp ports of the inbounds from outside",
+		Tags:    []string{"server"},
+	}, nil, []*service.ReachabilityStatus{})
+	a.route(g, http.MethodPost, "/server/tor/install", a.serverController.installTor, &openapi.Operation{
+		Summary: "Install the tor daemon with the package manager of the server and start it",
+		Tags:    []string{"server"},
+	}, nil, nil)
+	a.route(g, http.MethodPost, "/server/firewall", a.serverController.applyFirewall, &openapi.Operation{
+		Summary: "Open the ports of enabled inbounds and close the ones the panel opened for removed inbounds",
+		Tags:    []string{"server"},
+		Parameters: []*openapi.Parameter{
+			{Name: "dryRun", In: "query", Description: "true only answers with the changes", Schema: &openapi.Schema{Type: "boolean"}},
+		},
+	}, nil, []firewall.Change{})
+
+	a.route(g, http.MethodGet, "/logs", a.logController.getLogs, &openapi.Operation{
+		Summary: "List recent panel log entries, /xui/ws/logs streams new ones",
+		Tags:    []string{"server"},
+		Parameters: append([]*openapi.Parameter{
+			{Name: "level", In: "query", Description: "least severe level included: debug, info, warning or error", Schema: &openapi.Schema{Type: "string"}},
+			{Name: "keyword", In: "query", Description: "case insensitive text the message contains", Schema: &openapi.Schema{Type: "string"}},
+			{Name: "since", In: "query", Description: "unix time of the oldest entry", Schema: &openapi.Schema{Type: "integer"}},
+			{Name: "until", In: "query", Description: "unix time of the newest entry", Schema: &openapi.Schema{Type: "integer"}},
+		}, pageParameters()...),
+	}, nil, a.pageSchema([]*logger.Entry{}))
+
+	a.route(g, http.MethodGet, "/jobs", a.jobController.getJobs, &openapi.Operation{
+		Summary: "List background jobs",
+		Tags:    []string{"jobs"},
+	}, nil, []string{})
+	a.route(g, http.MethodGet, "/jobs/history", a.jobController.getHistory, &openapi.Operation{
+		Summary: "List recent job runs, newest first",
+		Tags:    []string{"jobs"},
+		Parameters: append([]*openapi.Parameter{
+			{Name: "name", In: "query", Description: "job name, all jobs if empty", Schema: &openapi.Schema{Type: "string"}},
+		}, pageParameters()...),
+	}, nil, a.pageSchema([]*service.JobRun{}))
+	a.route(g, http.MethodPost, "/jobs/:name/run", a.jobController.runJob, &openapi.Operation{
+		Summary: "Run a job now in the background",
+		Tags:    []string{"jobs"},
+	}, nil, nil)
+
+	a.route(g, http.MethodGet, "/traffic/series", a.trafficController.getSeries, &openapi.Operation{
+		Summary: "Get downsampled inbound traffic",
+		Tags:    []string{"traffic"},
+		Parameters: append([]*openapi.Parameter{
+			{Name: "inbound", In: "query", Description: "inbound tag, all inbounds if empty", Schema: &openapi.Schema{Type: "string"}},
+			{Name: "range", In: "query", Description: "time range like 1h, 24h or 7d", Schema: &openapi.Schema{Type: "string"}},
+		}, pageParameters()...),
+	}, nil, &service.TrafficSeries{})
+
+	a.route(g, http.MethodGet, "/traffic/breakdown", a.trafficController.getBreakdown, &openapi.Operation{
+		Summary: "Get the traffic per protocol, transport and security",
+		Tags:    []string{"traffic"},
+		Parameters: []*openapi.Parameter{
+			{Name: "range", In: "query", Description: "time range like 24h or 7d, 30d if empty, at most the 90 days of history", Schema: &openapi.Schema{Type: "string"}},
+			{Name: "by", In: "query", Description: "comma separated protocol, transport and security, all three if empty", Schema: &openapi.Schema{Type: "string"}},
+		},
+	}, nil, []*service.TrafficBreakdown{})
+
+	a.route(g, http.MethodGet, "/traffic/countries", a.trafficController.getCountries, &openapi.Operation{
+		Summary: "Get the client traffic per country the clients connect from, ZZ where geoip knows no country",
+		Tags:    []string{"traffic"},
+		Parameters: []*openapi.Parameter{
+			{Name: "range", In: "query", Description: "time range like 24h or 7d, 30d if empty, at most the 90 days of history", Schema: &openapi.Schema{Type: "string"}},
+		},
+	}, nil, []*service.CountryTrafficSum{})
+
+	a.route(g, http.MethodGet, "/traffic/cycles", a.trafficController.getCycles, &openapi.Operation{
+		Summary: "List the archived traffic cycles of an inbound or client, from monthly and manual resets",
+		Tags:    []string{"traffic"},
+		Parameters: append([]*openapi.Parameter{
+			{Name: "kind", In: "query", Description: "inbound or client, client if empty", Schema: &openapi.Schema{Type: "string"}},
+			{Name: "name", In: "query", Description: "inbound tag or client email", Schema: &openapi.Schema{Type: "string"}},
+		}, pageParameters()...),
+	}, nil, a.pageSchema([]*model.TrafficCycle{}))
+	a.route(g, http.MethodGet, "/payments", a.planController.getPayments, &openapi.Operation{
+		Summary: "List the payments that renewed clients, with the expiry and quota each one gave",
+		Tags:    []string{"payments"},
+		Parameters: append([]*openapi.Parameter{
+			{Name: "email", In: "query", Description: "only the payments of this client", Schema: &openapi.Schema{Type: "string"}},
+		}, pageParameters()...),
+	}, nil, a.pageSchema([]*model.Payment{}))
+
+	a.route(g, http.MethodGet, "/nodes", a.nodeController.getNodes, &openapi.Operation{
+		Summary: "List nodes",
+		Tags:    []string{"nodes"},
+	}, nil, []*model.Node{})
+	a.route(g, http.MethodPost, "/nodes", a.nodeController.addNode, &openapi.Operation{
+		Summary: "Add a node",
+		Tags:    []string{"nodes"},
+	}, &model.Node{}, &model.Node{})
+	a.route(g, http.MethodPut, "/nodes/:id", a.nodeController.updateNode, &openapi.Operation{
+		Summary: "Update a node",
+		Tags:    []string{"nodes"},
+	}, &model.Node{}, &model.Node{})
+	a.route(g, http.MethodDelete, "/nodes/:id", a.nodeController.delNode, &openapi.Operation{
+		Summary: "Delete a node",
+		Tags:    []string{"nodes"},
+	}, nil, 0)
+	a.route(g, http.MethodGet, "/nodes/:id/status", a.nodeController.getNodeStatus, &openapi.Operation{
+		Summary: "Get the status of a node",
+		Tags:    []string{"nodes"},
+	}, nil, &service.Status{})
+
+	a.route(g, http.MethodGet, "/certificates", a.certificateController.getCertificates, &openapi.Operation{
+		Summary: "List stored certificates, without their keys",
+		Tags:    []string{"certificates"},
+	}, nil, []*model.Certificate{})
+	a.route(g, http.MethodPost, "/certificates", a.certificateController.addCertificate, &openapi.Operation{
+		Summary: "Store a certificate and key in PEM form, domains and expiry are read from the certificate",
+		Tags:    []string{"certificates"},
+	}, &model.Certificate{}, &model.Certificate{})
+	a.route(g, http.MethodPut, "/certificates/:id", a.certificateController.updateCertificate, &openapi.Operation{
+		Summary: "Replace a stored certificate, an empty key keeps the stored one",
+		Tags:    []string{"certificates"},
+	}, &model.Certificate{}, &model.Certificate{})
+	a.route(g, http.MethodDelete, "/certificates/:id", a.certificateController.delCertificate, &openapi.Operation{
+		Summary: "Delete a certificate no inbound and not the panel uses",
+		Tags:    []string{"certificates"},
+	}, nil, 0)
+	a.route(g, http.MethodPut, "/certificates/:id/inbounds", a.certificateController.applyCertificate, &openapi.Operation{
+		Summary: "Set the tls inbounds that use a certificate, renewals of it reach them without editing their stream settings",
+		Tags:    []string{"certificates"},
+	}, &service.CertificateApply{}, &service.CertificateApply{})
+	a.route(g, http.MethodPost, "/certificates/issue", a.certificateController.issueCertificate, &openapi.Operation{
+		Summary: "Issue a certificate through ACME with dns-01 challenges of the configured dns provider, or renew the one with the id",
+		Tags:    []string{"certificates"},
+	}, &service.CertificateIssue{}, &model.Certificate{})
+
+	a.route(g, http.MethodGet, "/policies", a.policyController.getPolicyProfiles, &openapi.Operation{
+		Summary: "List the policy profiles, each one is an xray policy level",
+		Tags:    []string{"policies"},
+	}, nil, []*model.PolicyProfile{})
+	a.route(g, http.MethodPost, "/policies", a.policyController.addPolicyProfile, &openapi.Operation{
+		Summary: "Add a policy profile, it replaces a level of the xray config template with the same number",
+		Tags:    []string{"policies"},
+	}, &model.PolicyProfile{}, &model.PolicyProfile{})
+	a.route(g, http.MethodPut, "/policies/:id", a.policyController.updatePolicyProfile, &openapi.Operation{
+		Summary: "Update a policy profile, its level can only change while no client uses it",
+		Tags:    []string{"policies"},
+	}, &model.PolicyProfile{}, &model.PolicyProfile{})
+	a.route(g, http.MethodDelete, "/policies/:id", a.policyController.delPolicyProfile, &openapi.Operation{
+		Summary: "Delete a policy profile no client uses",
+		Tags:    []string{"policies"},
+	}, nil, 0)
+	a.route(g, http.MethodPost, "/clients/:email/policy", a.policyController.setClientPolicy, &openapi.Operation{
+		Summary: "Assign a policy profile to a client, profile id 0 puts it back on level 0",
+		Tags:    []string{"clients"},
+	}, &service.ClientPolicy{}, &service.ClientPolicy{})
+
+	a.route(g, http.MethodGet, "/forwards", a.portForwardController.getPortForwards, &openapi.Operation{
+		Summary: "List the port forwards",
+		Tags:    []string{"forwards"},
+	}, nil, []*model.PortForward{})
+	a.route(g, http.MethodPost, "/forwards", a.portForwardController.addPortForward, &openapi.Operation{
+		Summary: "Add a port forward, xray forwards its port to the destination address and port",
+		Tags:    []string{"forwards"},
+	}, &model.PortForward{}, &model.PortForward{})
+	a.route(g, http.MethodPut, "/forwards/:id", a.portForwardController.updatePortForward, &openapi.Operation{
+		Summary: "Update a port forward",
+		Tags:    []string{"forwards"},
+	}, &model.PortForward{}, &model.PortForward{})
+	a.route(g, http.MethodDelete, "/forwards/:id", a.portForwardController.delPortForward, &openapi.Operation{
+		Summary: "Delete a port forward",
+		Tags:    []string{"forwards"},
+	}, nil, 0)
+
+	a.route(g, http.MethodGet, "/outbounds", a.outboundController.getOutbounds, &openapi.Operation{
+		Summary: "List the outbounds of the xray template",
+		Tags:    []string{"outbounds"},
+	}, nil, []interface{}{})
+	a.route(g, http.MethodGet, "/outbounds/latency", a.outboundController.getLatency, &openapi.Operation{
+		Summary: "Get the latency measured through every outbound, the latencyProbeUrls setting turns the probes on",
+		Tags:    []string{"outbounds"},
+		Parameters: []*openapi.Parameter{
+			{Name: "range", In: "query", Description: "time range like 1h, 24h or 7d, 24h if empty, at most the 7 days of probes", Schema: &openapi.Schema{Type: "string"}},
+		},
+	}, nil, []*service.LatencySeries{})
+	a.route(g, http.MethodPost, "/outbounds/chains", a.outboundController.addChain, &openapi.Operation{
+		Summary: "Add a chain of outbounds, each hop dials through the next. A hop with only a tag refers to an outbound of the template",
+		Tags:    []string{"outbounds"},
+	}, &service.OutboundChain{}, []interface{}{})
+	a.route(g, http.MethodDelete, "/outbounds/:tag", a.outboundController.delOutbound, &openapi.Operation{
+		Summary: "Delete an outbound that no other outbound dials through and no routing rule sends traffic to",
+		Tags:    []string{"outbounds"},
+	}, nil, 0)
+}
+
+// pageParameters documents the query parameters read by getPageQuery
+func pageParameters() []*openapi.Parameter {
+	return []*openapi.Parameter{
+		{Name: "page", In: "query", Description: "page number starting at 1, without it the whole list is returned", Schema: &openapi.Schema{Type: "integer"}},
+		{Name: "size", In: "query", Description: "items per page, 20 by default and 500 at most", Schema: &openapi.Schema{Type: "integer"}},
+		{Name: "sort", In: "query", Description: "field to sort by, prefixed with - for descending order", Schema: &openapi.Schema{Type: "string"}},
+		{Name: "filter", In: "query", Description: "text the items must contain, case insensitive", Schema: &openapi.Schema{Type: "string"}},
+	}
+}
+
+// pageSchema describes a list that is either returned as is or, when paged, in an entity.Page envelope
+func (a *APIV1Controller) pageSchema(list interface{}) *openapi.Schema {
+	items := a.doc.Schema(list)
+	return &openapi.Schema{
+		Description: "the list, or an object with items, total, page and size when page is given",
+		OneOf: []*openapi.Schema{items, {
+			Type: "object",
+			Properties: map[string]*openapi.Schema{
+				"items": items,
+				"total": {Type: "integer"},
+				"page":  {Type: "integer"},
+				"size":  {Type: "integer"},
+			},
+		}},
+	}
+}
+
+// route registers the handler and documents it, request and response are values of the body types,
+// responses are wrapped in the usual success/msg/obj envelope
+func (a *APIV1Controller) route(g *gin.RouterGroup, method string, path string, handler gin.HandlerFunc,
+	op *openapi.Operation, request interface{}, response interface{}) {
+	g.Handle(method, path, handler)
+
+	if request != nil {
+		op.RequestBody = a.doc.JSONBody(request)
+	}
+	envelope := &openapi.Schema{
+		Type: "object",
+		Properties: map[string]*openapi.Schema{
+			"success": {Type: "boolean"},
+			"msg":     {Type: "string"},
+			"obj":     a.doc.Schema(response),
+		},
+	}
+	op.Responses = map[string]*openapi.Response{
+		"200": a.doc.JSONResponse("success is false when the operation failed, msg tells why", envelope),
+		"401": {Description: "not logged in"},
+	}
+	a.doc.Add(method, g.BasePath()+path, op)
+}
+
+func (a *APIV1Controller) openapi(c *gin.Context) {
+	c.JSON(http.StatusOK, a.doc)
+}
+
+// docs renders the OpenAPI document with the assets of the panel, so the page loads nothing from elsewhere
+func (a *APIV1Controller) docs(c *gin.Context) {
+	html(c, "api_docs.html", "pages.apiDocs.title", nil)
+}
@@ -2,7 +2,16 @@ package controller
 
 import (
 	"github.com/gin-gonic/gin"
+	"math"
 	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"x-ui/database/model"
+	"x-ui/util/ratelimit"
+	"x-ui/web/entity"
+	"x-ui/web/service"
 	"x-ui/web/session"
 )
 
@@ -17,11 +26,274 @@ func (a *BaseController) checkLogin(c *gin.Context) {
 			c.Redirect(http.StatusTemporaryRedirect, c.GetString("base_path"))
 		}
 		c.Abort()
+	} else if !allowUser(c, session.GetLoginUser(c)) {
+		rejectViewer(c)
 	} else {
 		c.Next()
 	}
 }
 
+// checkLoginOrBasicAuth also accepts the panel credentials as basic auth and api tokens as bearer auth,
+// for scrapers, probes and automation that can not keep a session
+func (a *BaseController) checkLoginOrBasicAuth(c *gin.Context) {
+	if user := session.GetLoginUser(c); user != nil {
+		if !allowUser(c, user) {
+			rejectViewer(c)
+			return
+		}
+		c.Next()
+		return
+	}
+	username, password, hasBasic := c.Request.BasicAuth()
+	token, hasToken := bearerToken(c)
+	if (hasBasic || hasToken) && loginBlocked(c) {
+		return
+	}
+	userService := service.UserService{}
+	if hasBasic {
+		if user := userService.CheckUser(username, password); user != nil {
+			if !allowUser(c, user) {
+				rejectViewer(c)
+				return
+			}
+			session.SetRequestUser(c, user)
+			c.Next()
+			return
+		}
+	}
+	if hasToken {
+		apiTokenService := service.ApiTokenService{}
+		if apiToken := apiTokenService.CheckToken(token); apiToken != nil {
+			user, err := userService.GetFirstUser()
+			if err != nil {
+				c.AbortWithStatus(http.StatusInternalServerError)
+				return
+			}
+			if !allowToken(c, apiToken, user) {
+				rejectViewer(c)
+				return
+			}
+			// tokens act as the admin, but only admin tokens see secrets
+			if apiToken.Role != service.TokenRoleAdmin {
+				viewer := *user
+				viewer.Viewer = true
+				user = &viewer
+			}
+			session.SetRequestUser(c, user)
+			c.Set(apiTokenId, apiToken.Id)
+			c.Next()
+			return
+		}
+	}
+	if hasBasic || hasToken {
+		loginFailed(c)
+	}
+	c.Header("WWW-Authenticate", `Basic realm="x-ui"`)
+	c.AbortWithStatus(http.StatusUnauthorized)
+}
+
+func bearerToken(c *gin.Context) (string, bool) {
+	token, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+	return strings.TrimSpace(token), ok && strings.TrimSpace(token) != ""
+}
+
+// operatorRoutes are the api routes, with the routes below them, that operator tokens may change. They are
+// full routes below the base path and manage inbounds and clients but not the panel
+var operatorRoutes = []string{"/api/v1/inbounds", "/api/v1/clients"}
+
+// allowToken applies the role of an api token, requests act as the admin but operators and viewers read
+// like viewers, operators may also change inbounds and clients
+func allowToken(c *gin.Context, apiToken *model.ApiToken, user *model.User) bool {
+	if apiToken.Role == service.TokenRoleAdmin {
+		return true
+	}
+	viewer := *user
+	viewer.Viewer = true
+	if allowUser(c, &viewer) {
+		return true
+	}
+	if apiToken.Role != service.TokenRoleOperator {
+		return false
+	}
+	path := routePath(c)
+	for _, route := range operatorRoutes {
+		if path == route || strings.HasPrefix(path, route+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// viewerPostRoutes are the POST routes that only read, the UI loads its data with POST. They are the
+// full routes below the base path, so a new route is for admins until it is added here
+var viewerPostRoutes = map[string]bool{
+	"/xui/inbound/list":             true,
+	"/xui/inbound/onlines":          true,
+	"/xui/inbound/clients":          true,
+	"/xui/inbound/clientIps/:email": true,
+	"/xui/inbound/replicas/:id":     true,
+	"/xui/alert/list":               true,
+	"/xui/certificate/list":         true,
+	"/xui/job/list":                 true,
+	"/xui/job/history":              true,
+	"/xui/logs":                     true,
+	"/xui/node/list":                true,
+	"/xui/node/status/:id":          true,
+	"/xui/node/inbounds/:id":        true,
+	"/xui/outbound/list":            true,
+	"/xui/outbound/latency":         true,
+	"/xui/plan/list":                true,
+	"/xui/plan/clients":             true,
+	"/xui/policy/list":              true,
+	"/xui/forward/list":             true,
+	"/xui/voucher/list":             true,
+	"/xui/webhook/list":             true,
+	"/server/status":                true,
+	"/server/getXrayVersion":        true,
+	"/server/speedTestHistory":      true,
+	"/server/routingPresets":        true,
+	"/server/torStatus":             true,
+	"/server/reachability":          true,
+}
+
+// viewerDeniedGetRoutes are the GET routes that hand out client credentials, viewers may not call them
+var viewerDeniedGetRoutes = map[string]bool{
+	"/xui/inbound/exportClients":       true,
+	"/xui/inbound/clientConfig/:email": true,
+	"/api/v1/clients/export":           true,
+	"/api/v1/clients/:email/config":    true,
+}
+
+// the legacy api mounts the inbound and server controllers again below /xui/API
+func init() {
+	for _, routes := range []map[string]bool{viewerPostRoutes, viewerDeniedGetRoutes} {
+		legacy := make([]string, 0)
+		for route := range routes {
+			if strings.HasPrefix(route, "/xui/inbound/") {
+				legacy = append(legacy, "/xui/API/inbounds"+strings.TrimPrefix(route, "/xui"))
+			} else if strings.HasPrefix(route, "/server/") {
+				legacy = append(legacy, "/xui/API"+route)
+			}
+		}
+		for _, route := range legacy {
+			routes[route] = true
+		}
+	}
+}
+
+// routePath returns the route of the request below the base path, e.g. /xui/inbound/list
+func routePath(c *gin.Context) string {
+	return "/" + strings.TrimPrefix(c.FullPath(), c.GetString("base_path"))
+}
+
+// allowUser lets viewers call GET routes and the POST routes that read, everything else is for admins
+func allowUser(c *gin.Context, user *model.User) bool {
+	if !user.Viewer {
+		return true
+	}
+	switch c.Request.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return !viewerDeniedGetRoutes[routePath(c)]
+	case http.MethodPost:
+		return viewerPostRoutes[routePath(c)]
+	}
+	return false
+}
+
+// isViewer tells whether the request is made by a viewer or with an api token that is not an admin token,
+// read routes leave out secrets for them
+func isViewer(c *gin.Context) bool {
+	user := session.GetLoginUser(c)
+	return user == nil || user.Viewer
+}
+
+func rejectViewer(c *gin.Context) {
+	c.AbortWithStatusJSON(http.StatusForbidden, entity.Msg{
+		Success: false,
+		Msg:     I18n(c, "pages.login.viewerReadOnly"),
+	})
+}
+
+// rateLimit rejects requests with 429 once the bucket of their key is empty, a nil limiter lets everything through
+func rateLimit(limiter *ratelimit.Limiter, key func(c *gin.Context) string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ok, wait := limiter.Allow(key(c))
+		if ok {
+			c.Next()
+			return
+		}
+		tooManyRequests(c, wait)
+	}
+}
+
+func tooManyRequests(c *gin.Context, wait time.Duration) {
+	c.Header("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+	c.AbortWithStatusJSON(http.StatusTooManyRequests, entity.Msg{
+		Success: false,
+		Msg:     "too many requests",
+	})
+}
+
+func ipKey(c *gin.Context) string {
+	return "ip:" + getRemoteIp(c)
+}
+
+// apiTokenId is set to the id of the api token a request was authenticated with
+const apiTokenId = "api_token_id"
+
+// apiKey counts requests per login or api token, so clients behind one address do not share a bucket. It runs
+// after the login check, credentials that were not checked yet count on the address
+func apiKey(c *gin.Context) string {
+	if id := c.GetInt(apiTokenId); id != 0 {
+		return "token:" + strconv.Itoa(id)
+	}
+	if user := session.GetLoginUser(c); user != nil {
+		return "user:" + strconv.Itoa(user.Id)
+	}
+	return ipKey(c)
+}
+
+var (
+	loginLimiter     *ratelimit.Limiter
+	loginLimiterOnce sync.Once
+)
+
+// getLoginLimiter returns the limiter of failed basic auth and bearer logins, it allows as many per address
+// as the login form does
+func getLoginLimiter() *ratelimit.Limiter {
+	loginLimiterOnce.Do(func() {
+		settingService := service.SettingService{}
+		perMinute, err := settingService.GetLoginRateLimit()
+		if err != nil {
+			perMinute = 0
+		}
+		loginLimiter = ratelimit.NewPerMinute(perMinute)
+	})
+	return loginLimiter
+}
+
+// loginBlocked answers 429 while the address has no failed logins left, before its credentials are checked
+func loginBlocked(c *gin.Context) bool {
+	blocked, wait := getLoginLimiter().Blocked(ipKey(c))
+	if blocked {
+		tooManyRequests(c, wait)
+	}
+	return blocked
+}
+
+func loginFailed(c *gin.Context) {
+	getLoginLimiter().Allow(ipKey(c))
+}
+
+func newApiRateLimit() gin.HandlerFunc {
+	settingService := service.SettingService{}
+	perMinute, err := settingService.GetApiRateLimit()
+	if err != nil {
+		perMinute = 0
+	}
+	return rateLimit(ratelimit.NewPerMinute(perMinute), apiKey)
+}
+
 func I18n(c *gin.Context, name string) string {
 	anyfunc, _ := c.Get("I18n")
 	i18n, _ := anyfunc.(func(key string, params ...string) (string, error))
@@ -0,0 +1,131 @@
+package controller
+
+import (
+	"strconv"
+	"strings"
+	"x-ui/database/model"
+	"x-ui/web/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CertificateController manages the stored tls certificates that inbounds and the panel refer to by id
+type CertificateController struct {
+	certificateService service.CertificateService
+	acmeService        service.AcmeService
+	xrayService        service.XrayService
+}
+
+func NewCertificateController(g *gin.RouterGroup) *CertificateController {
+	a := newCertificateController()
+	a.initRouter(g)
+	return a
+}
+
+// newCertificateController makes the controller without routes, for controllers that serve its handlers
+func newCertificateController() *CertificateController {
+	return &CertificateController{}
+}
+
+func (a *CertificateController) initRouter(g *gin.RouterGroup) {
+	g = g.Group("/certificate")
+
+	g.POST("/list", a.getCertificates)
+	g.POST("/add", a.addCertificate)
+	g.POST("/update/:id", a.updateCertificate)
+	g.POST("/del/:id", a.delCertificate)
+	g.POST("/issue", a.issueCertificate)
+	g.POST("/apply/:id", a.applyCertificate)
+}
+
+func (a *CertificateController) getCertificates(c *gin.Context) {
+	certs, err := a.certificateService.GetCertificates()
+	if err != nil {
+		jsonMsg(c, "get certificates", err)
+		return
+	}
+	if isViewer(c) {
+		for _, cert := range certs {
+			cert.Key = ""
+		}
+	}
+	jsonObj(c, certs, nil)
+}
+
+func (a *CertificateController) addCertificate(c *gin.Context) {
+	cert := &model.Certificate{}
+	err := c.ShouldBind(cert)
+	if err != nil {
+		jsonMsg(c, "add certificate", err)
+		return
+	}
+	cert.Id = 0
+	cert, err = a.certificateService.AddCertificate(cert)
+	jsonMsgObj(c, "add certificate", cert, err)
+}
+
+func (a *CertificateController) updateCertificate(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		jsonMsg(c, "update certificate", err)
+		return
+	}
+	cert := &model.Certificate{}
+	err = c.ShouldBind(cert)
+	if err != nil {
+		jsonMsg(c, "update certificate", err)
+		return
+	}
+	cert.Id = id
+	cert, err = a.certificateService.UpdateCertificate(cert)
+	jsonMsgObj(c, "update certificate", cert, err)
+	if err == nil {
+		// inbounds using it get the new certificate in their config
+		a.xrayService.SetToNeedRestart()
+	}
+}
+
+func (a *CertificateController) delCertificate(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		jsonMsg(c, "delete certificate", err)
+		return
+	}
+	err = a.certificateService.DelCertificate(id)
+	jsonMsgObj(c, "delete certificate", id, err)
+}
+
+// applyCertificate sets the inbounds that use the certificate, ones not listed stop using it
+func (a *CertificateController) applyCertificate(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		jsonMsg(c, "apply certificate", err)
+		return
+	}
+	form := &service.CertificateApply{}
+	err = c.ShouldBind(form)
+	if err != nil {
+		jsonMsg(c, "apply certificate", err)
+		return
+	}
+	err = a.certificateService.ApplyCertificate(id, form.InboundIds)
+	jsonMsgObj(c, "apply certificate", form, err)
+	if err == nil {
+		a.xrayService.SetToNeedRestart()
+	}
+}
+
+// issueCertificate gets a certificate through ACME, the request waits until the CA checked the dns records
+func (a *CertificateController) issueCertificate(c *gin.Context) {
+	form := &service.CertificateIssue{}
+	err := c.ShouldBind(form)
+	if err != nil {
+		jsonMsg(c, "issue certificate", err)
+		return
+	}
+	cert, err := a.acmeService.IssueCertificate(form.Id, form.Name, strings.Split(form.Domains, ","))
+	jsonMsgObj(c, "issue certificate", cert, err)
+	if err == nil && form.Id > 0 {
+		a.xrayService.SetToNeedRestart()
+	}
+}
@@ -0,0 +1,15 @@
+package controller
+
+import (
+	"context"
+
+	"github.com/robfig/cron/v3"
+)
+
+// Container holds what the server shares with its controllers. The server creates one on every start
+// and hands it down through the controller constructors, so no controller reaches for package state
+// that may still belong to the server before a restart.
+type Container struct {
+	Cron *cron.Cron
+	Ctx  context.Context
+}
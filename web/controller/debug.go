@@ -0,0 +1,97 @@
+package controller
+
+import (
+	"net/http"
+	"net/http/pprof"
+	"x-ui/web/service"
+	"x-ui/web/session"
+
+	"github.com/gin-gonic/gin"
+)
+
+// the profiles of runtime/pprof, each served by name
+var pprofProfiles = []string{"allocs", "block", "goroutine", "heap", "mutex", "threadcreate"}
+
+// DebugController serves the pprof profiles and runtime stats of the panel to admins, when the
+// debugEnable setting is on
+type DebugController struct {
+	BaseController
+
+	settingService  service.SettingService
+	userService     service.UserService
+	apiTokenService service.ApiTokenService
+	debugService    service.DebugService
+}
+
+func NewDebugController(g *gin.RouterGroup) *DebugController {
+	a := &DebugController{}
+	a.initRouter(g)
+	return a
+}
+
+func (a *DebugController) initRouter(g *gin.RouterGroup) {
+	g = g.Group("/debug")
+	g.Use(a.checkEnabled, a.checkAdmin)
+
+	g.GET("/runtime", a.getRuntime)
+	g.GET("/pprof/", gin.WrapF(pprof.Index))
+	g.GET("/pprof/cmdline", gin.WrapF(pprof.Cmdline))
+	g.GET("/pprof/profile", gin.WrapF(pprof.Profile))
+	g.GET("/pprof/symbol", gin.WrapF(pprof.Symbol))
+	g.POST("/pprof/symbol", gin.WrapF(pprof.Symbol))
+	g.GET("/pprof/trace", gin.WrapF(pprof.Trace))
+	for _, name := range pprofProfiles {
+		g.GET("/pprof/"+name, gin.WrapH(pprof.Handler(name)))
+	}
+}
+
+// checkEnabled answers 404 while the debugEnable setting is off, as if the routes did not exist
+func (a *DebugController) checkEnabled(c *gin.Context) {
+	enabled, err := a.settingService.GetDebugEnable()
+	if err != nil || !enabled {
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+	c.Next()
+}
+
+// checkAdmin lets in admins by session, basic auth or an admin api token. Unlike the other routes viewers
+// may not read them, the profiles show the memory of the panel and the secrets in it
+func (a *DebugController) checkAdmin(c *gin.Context) {
+	user := session.GetLoginUser(c)
+	if user == nil {
+		username, password, hasBasic := c.Request.BasicAuth()
+		token, hasToken := bearerToken(c)
+		if (hasBasic || hasToken) && loginBlocked(c) {
+			return
+		}
+		if hasBasic {
+			user = a.userService.CheckUser(username, password)
+		} else if hasToken {
+			if apiToken := a.apiTokenService.CheckToken(token); apiToken != nil {
+				if apiToken.Role != service.TokenRoleAdmin {
+					rejectViewer(c)
+					return
+				}
+				user, _ = a.userService.GetFirstUser()
+			}
+		}
+		if user == nil && (hasBasic || hasToken) {
+			loginFailed(c)
+		}
+	}
+	if user == nil {
+		c.Header("WWW-Authenticate", `Basic realm="x-ui"`)
+		c.AbortWithStatus(http.StatusUnauthorized)
+		return
+	}
+	if user.Viewer {
+		rejectViewer(c)
+		return
+	}
+	c.Next()
+}
+
+func (a *DebugController) getRuntime(c *gin.Context) {
+	jsonObj(c, a.debugService.GetRuntimeStats(), nil)
+}
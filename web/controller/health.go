@@ -0,0 +1,67 @@
+package controller
+
+import (
+	"net/http"
+	"x-ui/database"
+	"x-ui/web/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+type HealthController struct {
+	BaseController
+
+	xrayService service.XrayService
+}
+
+func NewHealthController(g *gin.RouterGroup) *HealthController {
+	a := &HealthController{}
+	a.initRouter(g)
+	return a
+}
+
+func (a *HealthController) initRouter(g *gin.RouterGroup) {
+	g.GET("/healthz", a.healthz)
+	g.GET("/readyz", a.checkLoginOrBasicAuth, a.readyz)
+}
+
+// healthz only tells the panel process is serving requests
+func (a *HealthController) healthz(c *gin.Context) {
+	c.String(http.StatusOK, "ok")
+}
+
+func (a *HealthController) readyz(c *gin.Context) {
+	checks := gin.H{}
+	ready := true
+
+	if err := database.Ping(); err != nil {
+		checks["db"] = err.Error()
+		ready = false
+	} else {
+		checks["db"] = "ok"
+	}
+
+	if a.xrayService.IsXrayRunning() {
+		checks["xray"] = "ok"
+	} else if service.IsStandby() {
+		// a standby runs no xray, load balancers should send the traffic to the active instance
+		ready = false
+		checks["xray"] = "standby"
+	} else {
+		ready = false
+		if err := a.xrayService.GetXrayErr(); err != nil {
+			checks["xray"] = err.Error()
+		} else {
+			checks["xray"] = "not running"
+		}
+	}
+
+	code := http.StatusOK
+	if !ready {
+		code = http.StatusServiceUnavailable
+	}
+	c.JSON(code, gin.H{
+		"ready":  ready,
+		"checks": checks,
+	})
+}
@@ -0,0 +1,138 @@
+package controller
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+	"x-ui/web/entity"
+
+	"github.com/gin-gonic/gin"
+)
+
+const idempotencyKeyHeader = "Idempotency-Key"
+const idempotencyKeyTTL = time.Hour * 24
+const maxIdempotencyKeyLength = 255
+
+type idempotentResponse struct {
+	bodyHash    string
+	done        bool
+	status      int
+	contentType string
+	body        []byte
+	created     time.Time
+}
+
+var idempotencyLock sync.Mutex
+var idempotentResponses = map[string]*idempotentResponse{}
+
+type recordingWriter struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *recordingWriter) Write(data []byte) (int, error) {
+	w.body.Write(data)
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *recordingWriter) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
+
+func idempotencyError(c *gin.Context, status int, msg string) {
+	c.AbortWithStatusJSON(status, entity.Msg{
+		Success: false,
+		Msg:     msg,
+	})
+}
+
+// withIdempotencyKey replays the first successful response to requests repeating an Idempotency-Key header,
+// so a retry after a timeout does not create a second inbound. Keys are kept in memory for a day
+// and are scoped to the caller, reusing a key with a different body is rejected.
+func withIdempotencyKey(handler gin.HandlerFunc) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.GetHeader(idempotencyKeyHeader)
+		if key == "" {
+			handler(c)
+			return
+		}
+		if len(key) > maxIdempotencyKeyLength {
+			idempotencyError(c, http.StatusBadRequest, "idempotency key is too long")
+			return
+		}
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			idempotencyError(c, http.StatusBadRequest, "read request body failed")
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+		sum := sha256.Sum256(body)
+		bodyHash := hex.EncodeToString(sum[:])
+		key = apiKey(c) + " " + c.Request.Method + " " + c.FullPath() + " " + key
+
+		idempotencyLock.Lock()
+		now := time.Now()
+		for k, response := range idempotentResponses {
+			if now.Sub(response.created) > idempotencyKeyTTL {
+				delete(idempotentResponses, k)
+			}
+		}
+		response, ok := idempotentResponses[key]
+		if !ok {
+			response = &idempotentResponse{bodyHash: bodyHash, created: now}
+			idempotentResponses[key] = response
+		}
+		idempotencyLock.Unlock()
+
+		if ok {
+			switch {
+			case response.bodyHash != bodyHash:
+				idempotencyError(c, http.StatusUnprocessableEntity, "idempotency key was used with a different request")
+			case !response.done:
+				idempotencyError(c, http.StatusConflict, "a request with this idempotency key is still in progress")
+			default:
+				c.Header("Idempotent-Replayed", "true")
+				c.Data(response.status, response.contentType, response.body)
+				c.Abort()
+			}
+			return
+		}
+
+		stored := false
+		defer func() {
+			if stored {
+				return
+			}
+			// a request that failed, was aborted or panicked is not replayed, it may be retried with the key
+			idempotencyLock.Lock()
+			if idempotentResponses[key] == response {
+				delete(idempotentResponses, key)
+			}
+			idempotencyLock.Unlock()
+		}()
+
+		writer := &recordingWriter{ResponseWriter: c.Writer}
+		c.Writer = writer
+		handler(c)
+
+		// the handlers answer failures with status 200 and success false, e.g. a locked database
+		msg := entity.Msg{}
+		if c.IsAborted() || writer.Status() >= http.StatusMultipleChoices ||
+			json.Unmarshal(writer.body.Bytes(), &msg) != nil || !msg.Success {
+			return
+		}
+		idempotencyLock.Lock()
+		defer idempotencyLock.Unlock()
+		response.done = true
+		response.status = writer.Status()
+		response.contentType = writer.Header().Get("Content-Type")
+		response.body = writer.body.Bytes()
+		stored = true
+	}
+}
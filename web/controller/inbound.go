@@ -1,11 +1,15 @@
 package controller
 
 import (
+	"encoding/json"
 	"fmt"
+	"io"
+	"net/http"
 	"strconv"
+	"time"
 	"x-ui/database/model"
 	"x-ui/logger"
-	"x-ui/web/global"
+	"x-ui/util/common"
 	"x-ui/web/service"
 	"x-ui/web/session"
 
@@ -13,49 +17,90 @@ import (
 )
 
 type InboundController struct {
-	inboundService service.InboundServiceImpl
-	xrayService    service.XrayService
+	inboundService   service.InboundServiceImpl
+	wizardService    service.WizardService
+	onlineService    service.OnlineService
+	clientIpService  service.ClientIpService
+	replicaService   service.ReplicaService
+	webhookService   service.WebhookService
+	xrayService      service.XrayService
+	connLimitService service.ConnLimitService
+	scheduleService  service.ClientScheduleService
+	firewallService  service.FirewallService
+	subService       service.SubService
+	selfTestService  service.SelfTestService
 }
 
 func NewInboundController(g *gin.RouterGroup) *InboundController {
-	a := &InboundController{}
-	global.SetInbounds(&a.inboundService)
+	a := newInboundController()
 	a.initRouter(g)
-	a.startTask()
 	return a
 }
 
+// newInboundController makes the controller without routes, for controllers that serve its handlers
+func newInboundController() *InboundController {
+	return &InboundController{}
+}
+
 func (a *InboundController) initRouter(g *gin.RouterGroup) {
 	g = g.Group("/inbound")
 
 	g.POST("/list", a.getInbounds)
-	g.POST("/add", a.addInbound)
+	g.POST("/add", withIdempotencyKey(a.addInbound))
+	g.POST("/wizard", a.fallbackWizard)
 	g.POST("/del/:id", a.delInbound)
 	g.POST("/update/:id", a.updateInbound)
 	g.POST("/resetClientTraffic/:email", a.resetClientTraffic)
+	g.POST("/clientConnLimit/:email", a.setClientConnLimit)
+	g.POST("/clientSchedule/:email", a.setClientSchedule)
+	g.POST("/clientSubEnable/:email", a.setClientSubEnable)
+	g.POST("/clientTgId/:email", a.setClientTgId)
+	g.POST("/importClients/:id", a.importClients)
+	g.GET("/exportClients", a.exportClients)
+	g.GET("/clientConfig/:email", a.getClientConfig)
+	g.POST("/rotateClient/:email", a.rotateClient)
+	g.POST("/onlines", a.getOnlineClients)
+	g.POST("/clients", a.getClients)
+	g.POST("/clientIps/:email", a.getClientIps)
+	g.POST("/replicas/:id", a.getReplicas)
+	g.POST("/setReplicas/:id", a.setReplicas)
+	g.POST("/streamPresets", a.getStreamPresets)
+	g.POST("/selfTest/:id", a.selfTest)
 
 }
 
-func (a *InboundController) startTask() {
-	webServer := global.GetWebServer()
-	c := webServer.GetCron()
-	c.AddFunc("@every 10s", func() {
-		if a.xrayService.IsNeedRestartAndSetFalse() {
-			err := a.xrayService.RestartXray(false)
-			if err != nil {
-				logger.Error("restart xray failed:", err)
-			}
+// applyFirewall opens and closes inbound ports in the background after inbounds changed
+func (a *InboundController) applyFirewall() {
+	go func() {
+		_, err := a.firewallService.ApplyFirewall(false)
+		if err != nil {
+			logger.Web.Warning("apply firewall rules failed:", err)
 		}
-	})
+	}()
 }
 
 func (a *InboundController) getInbounds(c *gin.Context) {
 	user := session.GetLoginUser(c)
+	if q := getPageQuery(c); q != nil {
+		page, err := a.inboundService.GetInboundsPage(user.Id, q)
+		if err != nil {
+			jsonMsg(c, I18n(c, "pages.inbounds.toasts.obtain"), err)
+			return
+		}
+		if isViewer(c) {
+			redactInbounds(page.Items.([]*model.Inbound))
+		}
+		jsonObj(c, page, nil)
+		return
+	}
 	inbounds, err := a.inboundService.GetInbounds(user.Id)
 	if err != nil {
 		jsonMsg(c, I18n(c, "pages.inbounds.toasts.obtain"), err)
 		return
 	}
+	if isViewer(c) {
+		redactInbounds(inbounds)
+	}
 	jsonObj(c, inbounds, nil)
 }
 func (a *InboundController) getInbound(c *gin.Context) {
@@ -69,6 +114,9 @@ func (a *InboundController) getInbound(c *gin.Context) {
 		jsonMsg(c, I18n(c, "pages.inbounds.toasts.obtain"), err)
 		return
 	}
+	if isViewer(c) {
+		redactInbounds([]*model.Inbound{inbound})
+	}
 	jsonObj(c, inbound, nil)
 }
 
@@ -79,6 +127,14 @@ func (a *InboundController) addInbound(c *gin.Context) {
 		jsonMsg(c, I18n(c, "pages.inbounds.addTo"), err)
 		return
 	}
+	// a preset replaces the stream settings the form sent
+	if preset := c.Query("streamPreset"); preset != "" {
+		inbound.StreamSettings, err = service.ExpandStreamPreset(preset)
+		if err != nil {
+			jsonMsg(c, I18n(c, "pages.inbounds.addTo"), err)
+			return
+		}
+	}
 	user := session.GetLoginUser(c)
 	inbound.UserId = user.Id
 	inbound.Enable = true
@@ -87,6 +143,35 @@ func (a *InboundController) addInbound(c *gin.Context) {
 	jsonMsgObj(c, I18n(c, "pages.inbounds.addTo"), inbound, err)
 	if err == nil {
 		a.xrayService.SetToNeedRestart()
+		a.webhookService.Dispatch(service.EventInboundCreated, inbound)
+		a.applyFirewall()
+	}
+}
+
+func (a *InboundController) getStreamPresets(c *gin.Context) {
+	presets, err := service.GetStreamPresets()
+	if err != nil {
+		jsonMsg(c, "get stream presets", err)
+		return
+	}
+	jsonObj(c, presets, nil)
+}
+
+// fallbackWizard answers with the steps of the checks even if one failed
+func (a *InboundController) fallbackWizard(c *gin.Context) {
+	form := &service.FallbackWizard{}
+	err := c.ShouldBind(form)
+	if err != nil {
+		jsonMsg(c, "fallback wizard", err)
+		return
+	}
+	user := session.GetLoginUser(c)
+	result, err := a.wizardService.CreateFallbackInbound(user.Id, form)
+	jsonMsgObj(c, "fallback wizard", result, err)
+	if err == nil {
+		a.xrayService.SetToNeedRestart()
+		a.webhookService.Dispatch(service.EventInboundCreated, result.Inbound)
+		a.applyFirewall()
 	}
 }
 
@@ -100,6 +185,14 @@ func (a *InboundController) delInbound(c *gin.Context) {
 	jsonMsgObj(c, I18n(c, "delete"), id, err)
 	if err == nil {
 		a.xrayService.SetToNeedRestart()
+		a.webhookService.Dispatch(service.EventInboundDeleted, map[string]interface{}{"id": id})
+		a.applyFirewall()
+		go func() {
+			err := a.replicaService.DelReplicas(id)
+			if err != nil {
+				logger.Web.Warning("remove replicated inbound failed:", err)
+			}
+		}()
 	}
 }
 
@@ -121,6 +214,14 @@ func (a *InboundController) updateInbound(c *gin.Context) {
 	jsonMsgObj(c, I18n(c, "pages.inbounds.revise"), inbound, err)
 	if err == nil {
 		a.xrayService.SetToNeedRestart()
+		a.webhookService.Dispatch(service.EventInboundUpdated, inbound)
+		a.applyFirewall()
+		go func() {
+			err := a.replicaService.SyncInbound(id)
+			if err != nil {
+				logger.Web.Warning("sync replicated inbound failed:", err)
+			}
+		}()
 	}
 }
 
@@ -134,3 +235,275 @@ func (a *InboundController) resetClientTraffic(c *gin.Context) {
 	}
 	jsonMsg(c, "traffic reseted", nil)
 }
+
+func (a *InboundController) setClientConnLimit(c *gin.Context) {
+	email := c.Param("email")
+	limit := &service.ClientConnLimit{}
+	err := c.ShouldBind(limit)
+	if err != nil {
+		jsonMsg(c, "set client connection limit", err)
+		return
+	}
+	err = a.connLimitService.SetClientConnLimit(email, limit.ConnLimit)
+	jsonMsgObj(c, "set client connection limit", limit, err)
+}
+
+func (a *InboundController) setClientSchedule(c *gin.Context) {
+	email := c.Param("email")
+	form := &service.ClientSchedule{}
+	err := c.ShouldBind(form)
+	if err != nil {
+		jsonMsg(c, "set client schedule", err)
+		return
+	}
+	err = a.scheduleService.SetClientSchedule(email, form.Schedule)
+	jsonMsgObj(c, "set client schedule", form, err)
+}
+
+func (a *InboundController) setClientSubEnable(c *gin.Context) {
+	email := c.Param("email")
+	form := &service.ClientSubEnable{}
+	err := c.ShouldBind(form)
+	if err != nil {
+		jsonMsg(c, "set client subscription", err)
+		return
+	}
+	err = a.subService.SetClientSubEnable(email, form.SubEnable)
+	jsonMsgObj(c, "set client subscription", form, err)
+}
+
+func (a *InboundController) setClientTgId(c *gin.Context) {
+	email := c.Param("email")
+	form := &service.ClientTgId{}
+	err := c.ShouldBind(form)
+	if err != nil {
+		jsonMsg(c, "set client telegram id", err)
+		return
+	}
+	err = a.inboundService.SetClientTgId(email, form.TgId)
+	jsonMsgObj(c, "set client telegram id", form, err)
+}
+
+// importClients takes the csv as the file field of a multipart form or as the request body
+func (a *InboundController) importClients(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		jsonMsg(c, "import clients", err)
+		return
+	}
+	var reader io.Reader = c.Request.Body
+	if file, err := c.FormFile("file"); err == nil {
+		f, err := file.Open()
+		if err != nil {
+			jsonMsg(c, "import clients", err)
+			return
+		}
+		defer f.Close()
+		reader = f
+	}
+	result, err := a.inboundService.ImportClients(c.Request.Context(), id, reader)
+	jsonMsgObj(c, "import clients", result, err)
+	if err == nil {
+		a.xrayService.SetToNeedRestart()
+	}
+}
+
+func (a *InboundController) rotateClient(c *gin.Context) {
+	address := getRequestAddress(c)
+	inbound, rotated, err := a.inboundService.RotateClient(c.Param("email"), address)
+	jsonMsgObj(c, "rotate client", rotated, err)
+	if err == nil {
+		a.xrayService.SetToNeedRestart()
+		a.webhookService.Dispatch(service.EventClientRotated, map[string]interface{}{"email": rotated.Email, "inboundId": inbound.Id})
+		go func() {
+			err := a.replicaService.SyncInbound(inbound.Id)
+			if err != nil {
+				logger.Web.Warning("sync replicated inbound failed:", err)
+			}
+		}()
+	}
+}
+
+// getClientConfig answers with an xray client config, ?download=1 makes it a file download
+func (a *InboundController) getClientConfig(c *gin.Context) {
+	address := getRequestAddress(c)
+	email := c.Param("email")
+	config, err := a.inboundService.GetClientConfig(email, address)
+	if err != nil {
+		jsonMsg(c, "get client config", err)
+		return
+	}
+	if c.Query("download") != "" {
+		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%v.json", email))
+		c.IndentedJSON(http.StatusOK, config)
+		return
+	}
+	jsonObj(c, config, nil)
+}
+
+// exportClients answers ?format=csv with a csv download and with json otherwise
+func (a *InboundController) exportClients(c *gin.Context) {
+	address := getRequestAddress(c)
+	if c.Query("format") != "csv" {
+		exports, err := a.inboundService.ExportClients(address)
+		if err != nil {
+			jsonMsg(c, "export clients", err)
+			return
+		}
+		jsonObj(c, exports, nil)
+		return
+	}
+	// the rows are written as the inbounds are read, an error after the first rows can only cut the file short
+	c.Header("Content-Type", "text/csv; charset=utf-8")
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=clients-%v.csv", time.Now().Format("20060102")))
+	writer := service.NewClientsCsvWriter(c.Writer)
+	err := a.inboundService.EachClientExport(address, writer.Write)
+	err = common.Combine(err, writer.Flush())
+	if err != nil {
+		requestLogger(c).Warning("write clients csv failed:", err)
+	}
+}
+
+func (a *InboundController) getOnlineClients(c *gin.Context) {
+	jsonObj(c, a.onlineService.GetOnlineClients(), nil)
+}
+
+func (a *InboundController) getClientIps(c *gin.Context) {
+	email := c.Param("email")
+	ips, err := a.clientIpService.GetClientIpHistory(email)
+	if err != nil {
+		jsonMsg(c, "get client ip history", err)
+		return
+	}
+	jsonList(c, ips)
+}
+
+func (a *InboundController) getClients(c *gin.Context) {
+	if q := getPageQuery(c); q != nil {
+		page, err := a.inboundService.GetClientTrafficsPage(q)
+		if err != nil {
+			jsonMsg(c, "get clients", err)
+			return
+		}
+		jsonObj(c, page, nil)
+		return
+	}
+	traffics, err := a.inboundService.GetAllClientTraffics()
+	if err != nil {
+		jsonMsg(c, "get clients", err)
+		return
+	}
+	jsonObj(c, traffics, nil)
+}
+
+func (a *InboundController) getReplicas(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		jsonMsg(c, "get replicas", err)
+		return
+	}
+	replicas, err := a.replicaService.GetReplicas(id)
+	if err != nil {
+		jsonMsg(c, "get replicas", err)
+		return
+	}
+	jsonObj(c, replicas, nil)
+}
+
+// setReplicas takes a json array of replicas, an empty array stops replicating the inbound
+func (a *InboundController) setReplicas(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		jsonMsg(c, "set replicas", err)
+		return
+	}
+	replicas := make([]*model.InboundReplica, 0)
+	err = c.ShouldBindJSON(&replicas)
+	if err != nil {
+		jsonMsg(c, "set replicas", err)
+		return
+	}
+	err = a.replicaService.SetReplicas(id, replicas)
+	jsonMsgObj(c, "set replicas", replicas, err)
+}
+
+// selfTest makes a request through the inbound as the client with the email form value, or as its
+// first client
+func (a *InboundController) selfTest(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		jsonMsg(c, "self test inbound", err)
+		return
+	}
+	email := c.PostForm("email")
+	if email == "" {
+		email = c.Query("email")
+	}
+	result, err := a.selfTestService.SelfTest(id, email)
+	if err != nil {
+		jsonMsg(c, "self test inbound", err)
+		return
+	}
+	jsonObj(c, result, nil)
+}
+
+// secretFields are the fields of the settings and stream settings of an inbound that let a client connect
+// or the server be impersonated: client ids, passwords, subscription ids and private keys
+var secretFields = map[string]bool{
+	"id":         true,
+	"password":   true,
+	"pass":       true,
+	"subId":      true,
+	"privateKey": true,
+	"secretKey":  true,
+	"key":        true,
+	"seed":       true,
+}
+
+// redactInbounds blanks the credentials in the settings of the inbounds for viewers, the rest of the
+// settings is kept so the inbounds still show as they are configured
+func redactInbounds(inbounds []*model.Inbound) {
+	for _, inbound := range inbounds {
+		inbound.Settings = redactSecrets(inbound.Settings)
+		inbound.StreamSettings = redactSecrets(inbound.StreamSettings)
+	}
+}
+
+func redactSecrets(settings string) string {
+	var value interface{}
+	if json.Unmarshal([]byte(settings), &value) != nil {
+		// settings that are not json can not be told apart from a secret
+		return ""
+	}
+	data, err := json.Marshal(redactValue(value))
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
+
+func redactValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, field := range v {
+			if !secretFields[key] {
+				v[key] = redactValue(field)
+				continue
+			}
+			// an empty value of the same kind, the pages read the key lines of a certificate as an array
+			switch field.(type) {
+			case []interface{}:
+				v[key] = []interface{}{}
+			case string:
+				v[key] = ""
+			default:
+				v[key] = nil
+			}
+		}
+	case []interface{}:
+		for i, item := range v {
+			v[i] = redactValue(item)
+		}
+	}
+	return value
+}
@@ -4,6 +4,8 @@ import (
 	"net/http"
 	"time"
 	"x-ui/logger"
+	"x-ui/util/geoip"
+	"x-ui/util/ratelimit"
 	"x-ui/web/job"
 	"x-ui/web/service"
 	"x-ui/web/session"
@@ -19,7 +21,9 @@ type LoginForm struct {
 type IndexController struct {
 	BaseController
 
-	userService service.UserService
+	userService    service.UserService
+	settingService service.SettingService
+	webhookService service.WebhookService
 }
 
 func NewIndexController(g *gin.RouterGroup) *IndexController {
@@ -30,7 +34,11 @@ func NewIndexController(g *gin.RouterGroup) *IndexController {
 
 func (a *IndexController) initRouter(g *gin.RouterGroup) {
 	g.GET("/", a.index)
-	g.POST("/login", a.login)
+	loginLimit, err := a.settingService.GetLoginRateLimit()
+	if err != nil {
+		logger.Web.Warning("get login rate limit failed:", err)
+	}
+	g.POST("/login", rateLimit(ratelimit.NewPerMinute(loginLimit), ipKey), a.login)
 	g.GET("/logout", a.logout)
 }
 
@@ -58,26 +66,28 @@ func (a *IndexController) login(c *gin.Context) {
 		return
 	}
 	user := a.userService.CheckUser(form.Username, form.Password)
+	geo := geoip.Lookup(getRemoteIp(c))
 	timeStr := time.Now().Format("2006-01-02 15:04:05")
 	if user == nil {
 		job.NewStatsNotifyJob().UserLoginNotify(form.Username, getRemoteIp(c), timeStr, 0)
-		logger.Infof("wrong username or password: \"%s\" \"%s\"", form.Username, form.Password)
+		a.webhookService.Dispatch(service.EventLoginFailed, map[string]interface{}{"username": form.Username, "ip": getRemoteIp(c), "country": geo.Country, "asn": geo.Asn})
+		requestLogger(c).Infof("wrong username or password: \"%s\" \"%s\",Ip Address:%s %s", form.Username, form.Password, getRemoteIp(c), geo)
 		pureJsonMsg(c, false, I18n(c, "pages.login.toasts.wrongUsernameOrPassword"))
 		return
 	} else {
-		logger.Infof("%s login success,Ip Address:%s\n", form.Username, getRemoteIp(c))
+		requestLogger(c).Infof("%s login success,Ip Address:%s %s\n", form.Username, getRemoteIp(c), geo)
 		job.NewStatsNotifyJob().UserLoginNotify(form.Username, getRemoteIp(c), timeStr, 1)
 	}
 
 	err = session.SetLoginUser(c, user)
-	logger.Info("user", user.Id, "login success")
+	requestLogger(c).Info("user", user.Id, "login success")
 	jsonMsg(c, I18n(c, "pages.login.toasts.successLogin"), err)
 }
 
 func (a *IndexController) logout(c *gin.Context) {
 	user := session.GetLoginUser(c)
 	if user != nil {
-		logger.Info("user", user.Id, "logout")
+		requestLogger(c).Info("user", user.Id, "logout")
 	}
 	session.ClearSession(c)
 	c.Redirect(http.StatusTemporaryRedirect, c.GetString("base_path"))
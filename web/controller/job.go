@@ -0,0 +1,49 @@
+package controller
+
+import (
+	"x-ui/web/job"
+	"x-ui/web/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// JobController shows what the background jobs did and runs them on demand
+type JobController struct {
+	jobHistoryService service.JobHistoryService
+}
+
+func NewJobController(g *gin.RouterGroup) *JobController {
+	a := newJobController()
+	a.initRouter(g)
+	return a
+}
+
+// newJobController makes the controller without routes, for controllers that serve its handlers
+func newJobController() *JobController {
+	return &JobController{}
+}
+
+func (a *JobController) initRouter(g *gin.RouterGroup) {
+	g = g.Group("/job")
+
+	g.POST("/list", a.getJobs)
+	g.POST("/history", a.getHistory)
+	g.POST("/run/:name", a.runJob)
+}
+
+func (a *JobController) getJobs(c *gin.Context) {
+	jsonObj(c, job.GetNames(), nil)
+}
+
+// getHistory lists the recorded runs, newest first, of the job given by the name parameter or of all jobs
+func (a *JobController) getHistory(c *gin.Context) {
+	name, _ := getParam(c, "name")
+	jsonList(c, a.jobHistoryService.GetHistory(name))
+}
+
+// runJob starts the job in the background, its run shows up in the history when it is done
+func (a *JobController) runJob(c *gin.Context) {
+	name := c.Param("name")
+	err := job.Trigger(name)
+	jsonMsg(c, "run job "+name, err)
+}
@@ -0,0 +1,94 @@
+package controller
+
+import (
+	"io"
+	"strconv"
+	"time"
+	"x-ui/logger"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/net/websocket"
+)
+
+// LogController shows the recent entries of the panel's own log, kept in memory by the logger
+type LogController struct {
+}
+
+func NewLogController(g *gin.RouterGroup) *LogController {
+	a := newLogController()
+	a.initRouter(g)
+	return a
+}
+
+// newLogController makes the controller without routes, for controllers that serve its handlers
+func newLogController() *LogController {
+	return &LogController{}
+}
+
+func (a *LogController) initRouter(g *gin.RouterGroup) {
+	g.POST("/logs", a.getLogs)
+	g.GET("/ws/logs", a.tail)
+}
+
+// getLogQuery reads the level, keyword, since and until filters, the times are unix seconds
+func getLogQuery(c *gin.Context) *logger.Query {
+	q := &logger.Query{}
+	q.Level, _ = getParam(c, "level")
+	q.Keyword, _ = getParam(c, "keyword")
+	if value, ok := getParam(c, "since"); ok {
+		if since, err := strconv.ParseInt(value, 10, 64); err == nil {
+			q.Since = time.Unix(since, 0)
+		}
+	}
+	if value, ok := getParam(c, "until"); ok {
+		if until, err := strconv.ParseInt(value, 10, 64); err == nil {
+			q.Until = time.Unix(until, 0)
+		}
+	}
+	return q
+}
+
+func (a *LogController) getLogs(c *gin.Context) {
+	jsonList(c, logger.GetEntries(getLogQuery(c)))
+}
+
+// tail streams new entries matching the filters over a websocket, like the traffic stream
+func (a *LogController) tail(c *gin.Context) {
+	q := getLogQuery(c)
+	server := websocket.Server{
+		Handshake: checkSameOrigin,
+		Handler: func(ws *websocket.Conn) {
+			a.handleTail(ws, q)
+		},
+	}
+	server.ServeHTTP(c.Writer, c.Request)
+}
+
+func (a *LogController) handleTail(ws *websocket.Conn, q *logger.Query) {
+	ch := logger.Subscribe()
+	defer logger.Unsubscribe(ch)
+
+	closed := make(chan struct{})
+	go func() {
+		io.Copy(io.Discard, ws)
+		close(closed)
+	}()
+
+	for {
+		select {
+		case entry := <-ch:
+			if !q.Match(entry) {
+				continue
+			}
+			ws.SetWriteDeadline(time.Now().Add(time.Second * 10))
+			err := websocket.JSON.Send(ws, entry)
+			if err != nil {
+				// logging here would feed the stream that just failed
+				ws.Close()
+				return
+			}
+		case <-closed:
+			return
+		}
+	}
+}
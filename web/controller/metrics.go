@@ -0,0 +1,34 @@
+package controller
+
+import (
+	"net/http"
+	"x-ui/logger"
+	"x-ui/web/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+type MetricsController struct {
+	BaseController
+
+	metricsService service.MetricsService
+}
+
+func NewMetricsController(g *gin.RouterGroup) *MetricsController {
+	a := &MetricsController{}
+	a.initRouter(g)
+	return a
+}
+
+func (a *MetricsController) initRouter(g *gin.RouterGroup) {
+	g.GET("/metrics", a.checkLoginOrBasicAuth, a.metrics)
+}
+
+func (a *MetricsController) metrics(c *gin.Context) {
+	c.Header("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	c.Status(http.StatusOK)
+	err := a.metricsService.WriteMetrics(c.Writer)
+	if err != nil {
+		logger.Web.Warning("write metrics failed:", err)
+	}
+}
@@ -0,0 +1,177 @@
+package controller
+
+import (
+	"strconv"
+	"x-ui/database/model"
+	"x-ui/web/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+type NodeController struct {
+	nodeService service.NodeService
+}
+
+func NewNodeController(g *gin.RouterGroup) *NodeController {
+	a := newNodeController()
+	a.initRouter(g)
+	return a
+}
+
+// newNodeController makes the controller without routes, for controllers that serve its handlers
+func newNodeController() *NodeController {
+	return &NodeController{}
+}
+
+func (a *NodeController) initRouter(g *gin.RouterGroup) {
+	g = g.Group("/node")
+
+	g.POST("/list", a.getNodes)
+	g.POST("/add", a.addNode)
+	g.POST("/update/:id", a.updateNode)
+	g.POST("/del/:id", a.delNode)
+	g.POST("/status/:id", a.getNodeStatus)
+	g.POST("/inbounds/:id", a.getNodeInbounds)
+	g.POST("/addInbound/:id", a.addNodeInbound)
+	g.POST("/updateInbound/:id/:inboundId", a.updateNodeInbound)
+	g.POST("/delInbound/:id/:inboundId", a.delNodeInbound)
+}
+
+// getNodeParam loads the node named by the :id path parameter
+func (a *NodeController) getNodeParam(c *gin.Context) (*model.Node, error) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return nil, err
+	}
+	return a.nodeService.GetNode(id)
+}
+
+func (a *NodeController) getNodes(c *gin.Context) {
+	nodes, err := a.nodeService.GetNodes()
+	if err != nil {
+		jsonMsg(c, "get nodes", err)
+		return
+	}
+	// the token of a node lets its holder change the node
+	if isViewer(c) {
+		for _, node := range nodes {
+			node.Token = ""
+		}
+	}
+	jsonObj(c, nodes, nil)
+}
+
+func (a *NodeController) addNode(c *gin.Context) {
+	node := &model.Node{}
+	err := c.ShouldBind(node)
+	if err != nil {
+		jsonMsg(c, "add node", err)
+		return
+	}
+	node.Id = 0
+	node, err = a.nodeService.AddNode(node)
+	jsonMsgObj(c, "add node", node, err)
+}
+
+func (a *NodeController) updateNode(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		jsonMsg(c, "update node", err)
+		return
+	}
+	node := &model.Node{}
+	err = c.ShouldBind(node)
+	if err != nil {
+		jsonMsg(c, "update node", err)
+		return
+	}
+	node.Id = id
+	node, err = a.nodeService.UpdateNode(node)
+	jsonMsgObj(c, "update node", node, err)
+}
+
+func (a *NodeController) delNode(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		jsonMsg(c, "delete node", err)
+		return
+	}
+	err = a.nodeService.DelNode(id)
+	jsonMsgObj(c, "delete node", id, err)
+}
+
+func (a *NodeController) getNodeStatus(c *gin.Context) {
+	node, err := a.getNodeParam(c)
+	if err != nil {
+		jsonMsg(c, "get node status", err)
+		return
+	}
+	status, err := a.nodeService.GetNodeStatus(node)
+	jsonObj(c, status, err)
+}
+
+func (a *NodeController) getNodeInbounds(c *gin.Context) {
+	node, err := a.getNodeParam(c)
+	if err != nil {
+		jsonMsg(c, "get node inbounds", err)
+		return
+	}
+	inbounds, err := a.nodeService.GetNodeInbounds(node)
+	if err == nil && isViewer(c) {
+		redactInbounds(inbounds)
+	}
+	jsonObj(c, inbounds, err)
+}
+
+func (a *NodeController) addNodeInbound(c *gin.Context) {
+	node, err := a.getNodeParam(c)
+	if err != nil {
+		jsonMsg(c, "add node inbound", err)
+		return
+	}
+	inbound := &model.Inbound{}
+	err = c.ShouldBind(inbound)
+	if err != nil {
+		jsonMsg(c, "add node inbound", err)
+		return
+	}
+	inbound, err = a.nodeService.AddNodeInbound(node, inbound)
+	jsonMsgObj(c, "add node inbound", inbound, err)
+}
+
+func (a *NodeController) updateNodeInbound(c *gin.Context) {
+	node, err := a.getNodeParam(c)
+	if err != nil {
+		jsonMsg(c, "update node inbound", err)
+		return
+	}
+	inboundId, err := strconv.Atoi(c.Param("inboundId"))
+	if err != nil {
+		jsonMsg(c, "update node inbound", err)
+		return
+	}
+	inbound := &model.Inbound{}
+	err = c.ShouldBind(inbound)
+	if err != nil {
+		jsonMsg(c, "update node inbound", err)
+		return
+	}
+	inbound.Id = inboundId
+	inbound, err = a.nodeService.UpdateNodeInbound(node, inbound)
+	jsonMsgObj(c, "update node inbound", inbound, err)
+}
+
+func (a *NodeController) delNodeInbound(c *gin.Context) {
+	node, err := a.getNodeParam(c)
+	if err != nil {
+		jsonMsg(c, "delete node inbound", err)
+		return
+	}
+	inboundId, err := strconv.Atoi(c.Param("inboundId"))
+	if err != nil {
+		jsonMsg(c, "delete node inbound", err)
+		return
+	}
+	err = a.nodeService.DelNodeInbound(node, inboundId)
+	jsonMsgObj(c, "delete node inbound", inboundId, err)
+}
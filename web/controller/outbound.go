@@ -0,0 +1,80 @@
+package controller
+
+import (
+	"x-ui/web/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// OutboundController manages the outbounds of the xray template and builds chains of them
+type OutboundController struct {
+	outboundService        service.OutboundService
+	outboundLatencyService service.OutboundLatencyService
+	xrayService            service.XrayService
+}
+
+func NewOutboundController(g *gin.RouterGroup) *OutboundController {
+	a := newOutboundController()
+	a.initRouter(g)
+	return a
+}
+
+// newOutboundController makes the controller without routes, for controllers that serve its handlers
+func newOutboundController() *OutboundController {
+	return &OutboundController{}
+}
+
+func (a *OutboundController) initRouter(g *gin.RouterGroup) {
+	g = g.Group("/outbound")
+
+	g.POST("/list", a.getOutbounds)
+	g.POST("/chain", a.addChain)
+	g.POST("/del/:tag", a.delOutbound)
+	g.POST("/latency", a.getLatency)
+}
+
+func (a *OutboundController) getOutbounds(c *gin.Context) {
+	outbounds, err := a.outboundService.GetOutbounds()
+	if err != nil {
+		jsonMsg(c, "get outbounds", err)
+		return
+	}
+	jsonObj(c, outbounds, nil)
+}
+
+func (a *OutboundController) addChain(c *gin.Context) {
+	chain := &service.OutboundChain{}
+	err := c.ShouldBindJSON(chain)
+	if err != nil {
+		jsonMsg(c, "add outbound chain", err)
+		return
+	}
+	outbounds, err := a.outboundService.AddChain(chain)
+	jsonMsgObj(c, "add outbound chain", outbounds, err)
+	if err == nil {
+		a.xrayService.SetToNeedRestart()
+	}
+}
+
+func (a *OutboundController) delOutbound(c *gin.Context) {
+	err := a.outboundService.DelOutbound(c.Param("tag"))
+	jsonMsg(c, "delete outbound", err)
+	if err == nil {
+		a.xrayService.SetToNeedRestart()
+	}
+}
+
+// getLatency answers ?range=<24h|7d|...> with the latency series of every outbound
+func (a *OutboundController) getLatency(c *gin.Context) {
+	span, err := service.ParseRange(c.DefaultQuery("range", "24h"))
+	if err != nil {
+		jsonMsg(c, "get outbound latency", err)
+		return
+	}
+	series, err := a.outboundLatencyService.GetLatencySeries(span)
+	if err != nil {
+		jsonMsg(c, "get outbound latency", err)
+		return
+	}
+	jsonObj(c, series, nil)
+}
@@ -0,0 +1,151 @@
+package controller
+
+import (
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"x-ui/web/entity"
+
+	"github.com/gin-gonic/gin"
+)
+
+const defaultPageSize = 20
+const maxPageSize = 500
+
+func getParam(c *gin.Context, key string) (string, bool) {
+	if value, ok := c.GetQuery(key); ok {
+		return value, true
+	}
+	return c.GetPostForm(key)
+}
+
+// getPageQuery returns nil when no page was asked for, so existing callers keep getting the plain list
+func getPageQuery(c *gin.Context) *entity.PageQuery {
+	pageValue, ok := getParam(c, "page")
+	if !ok {
+		return nil
+	}
+	q := &entity.PageQuery{Page: 1, Size: defaultPageSize}
+	if page, err := strconv.Atoi(pageValue); err == nil && page > 0 {
+		q.Page = page
+	}
+	if sizeValue, ok := getParam(c, "size"); ok {
+		if size, err := strconv.Atoi(sizeValue); err == nil && size > 0 {
+			q.Size = size
+		}
+	}
+	if q.Size > maxPageSize {
+		q.Size = maxPageSize
+	}
+	q.Sort, _ = getParam(c, "sort")
+	if strings.HasPrefix(q.Sort, "-") {
+		q.Sort = q.Sort[1:]
+		q.Desc = true
+	}
+	q.Filter, _ = getParam(c, "filter")
+	return q
+}
+
+// jsonList responds with the list, or with one page of it if the request asked for a page
+func jsonList(c *gin.Context, list interface{}) {
+	q := getPageQuery(c)
+	if q == nil {
+		jsonObj(c, list, nil)
+		return
+	}
+	jsonObj(c, paginate(list, q), nil)
+}
+
+// fieldByJson returns the field of struct v, which may be a pointer, whose json name is name
+func fieldByJson(v reflect.Value, name string) (reflect.Value, bool) {
+	v = reflect.Indirect(v)
+	if v.Kind() != reflect.Struct {
+		return reflect.Value{}, false
+	}
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		if strings.Split(t.Field(i).Tag.Get("json"), ",")[0] == name {
+			return v.Field(i), true
+		}
+	}
+	return reflect.Value{}, false
+}
+
+func matchFilter(v reflect.Value, filter string) bool {
+	v = reflect.Indirect(v)
+	if v.Kind() != reflect.Struct {
+		return true
+	}
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Field(i)
+		if field.Kind() == reflect.String && strings.Contains(strings.ToLower(field.String()), filter) {
+			return true
+		}
+	}
+	return false
+}
+
+func lessValue(a reflect.Value, b reflect.Value) bool {
+	switch a.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return a.Int() < b.Int()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return a.Uint() < b.Uint()
+	case reflect.Float32, reflect.Float64:
+		return a.Float() < b.Float()
+	case reflect.String:
+		return a.String() < b.String()
+	case reflect.Bool:
+		return !a.Bool() && b.Bool()
+	}
+	return false
+}
+
+// paginate filters, sorts and slices a slice of structs or struct pointers
+func paginate(list interface{}, q *entity.PageQuery) *entity.Page {
+	v := reflect.ValueOf(list)
+	if v.Kind() != reflect.Slice {
+		return &entity.Page{Items: list, Page: q.Page, Size: q.Size}
+	}
+	items := make([]reflect.Value, 0, v.Len())
+	filter := strings.ToLower(q.Filter)
+	for i := 0; i < v.Len(); i++ {
+		if filter == "" || matchFilter(v.Index(i), filter) {
+			items = append(items, v.Index(i))
+		}
+	}
+	if q.Sort != "" {
+		sort.SliceStable(items, func(i, j int) bool {
+			a, okA := fieldByJson(items[i], q.Sort)
+			b, okB := fieldByJson(items[j], q.Sort)
+			if !okA || !okB {
+				return false
+			}
+			if q.Desc {
+				return lessValue(b, a)
+			}
+			return lessValue(a, b)
+		})
+	}
+
+	total := len(items)
+	start := (q.Page - 1) * q.Size
+	if start > total {
+		start = total
+	}
+	end := start + q.Size
+	if end > total {
+		end = total
+	}
+	result := reflect.MakeSlice(v.Type(), 0, end-start)
+	for _, item := range items[start:end] {
+		result = reflect.Append(result, item)
+	}
+	return &entity.Page{
+		Items: result.Interface(),
+		Total: total,
+		Page:  q.Page,
+		Size:  q.Size,
+	}
+}
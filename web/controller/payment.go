@@ -0,0 +1,143 @@
+package controller
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+	"x-ui/database/model"
+	"x-ui/logger"
+	"x-ui/web/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// paymentNotification is the body of /payment/webhook. X-XUI-Signature is the signature of outgoing webhooks over
+// "<X-XUI-Timestamp>.<body>" with the payment secret, the timestamp is the unix time of the delivery
+type paymentNotification struct {
+	Id       string  `json:"id"`
+	Email    string  `json:"email"`
+	PlanId   int     `json:"planId"`
+	Amount   float64 `json:"amount"`
+	Currency string  `json:"currency"`
+}
+
+// stripeEvent is the part of a Stripe checkout.session.completed event we need, the checkout session
+// has to carry the client email and optionally the plan id in its metadata
+type stripeEvent struct {
+	Id   string `json:"id"`
+	Type string `json:"type"`
+	Data struct {
+		Object struct {
+			AmountTotal int64  `json:"amount_total"`
+			Currency    string `json:"currency"`
+			Metadata    struct {
+				Email  string `json:"email"`
+				PlanId string `json:"planId"`
+			} `json:"metadata"`
+		} `json:"object"`
+	} `json:"data"`
+}
+
+// PaymentController receives payment notifications from gateways, it is public and authenticated by signatures
+type PaymentController struct {
+	planService    service.PlanService
+	settingService service.SettingService
+}
+
+func NewPaymentController(g *gin.RouterGroup) *PaymentController {
+	a := &PaymentController{}
+	a.initRouter(g)
+	return a
+}
+
+func (a *PaymentController) initRouter(g *gin.RouterGroup) {
+	g = g.Group("/payment")
+
+	g.POST("/webhook", a.webhook)
+	g.POST("/stripe", a.stripe)
+}
+
+// readSigned returns the body and payment secret, or responds itself and returns false
+func (a *PaymentController) readSigned(c *gin.Context) ([]byte, string, bool) {
+	secret, err := a.settingService.GetPaymentSecret()
+	if err != nil || secret == "" {
+		c.AbortWithStatus(http.StatusNotFound)
+		return nil, "", false
+	}
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		c.AbortWithStatus(http.StatusBadRequest)
+		return nil, "", false
+	}
+	return body, secret, true
+}
+
+func (a *PaymentController) record(c *gin.Context, payment *model.Payment) {
+	applied, err := a.planService.RecordPayment(payment)
+	if err != nil {
+		logger.Web.Warningf("payment %v of %v failed: %v", payment.ExternalId, payment.Email, err)
+		// a 5xx makes the gateway deliver again later
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if applied {
+		logger.Web.Infof("payment %v applied plan %v to %v", payment.ExternalId, payment.PlanId, payment.Email)
+	}
+	c.JSON(http.StatusOK, gin.H{"applied": applied})
+}
+
+func (a *PaymentController) webhook(c *gin.Context) {
+	body, secret, ok := a.readSigned(c)
+	if !ok {
+		return
+	}
+	if !a.planService.VerifySignature(secret, c.GetHeader("X-XUI-Timestamp"), c.GetHeader("X-XUI-Signature"), body) {
+		c.AbortWithStatus(http.StatusUnauthorized)
+		return
+	}
+	notification := &paymentNotification{}
+	if err := json.Unmarshal(body, notification); err != nil {
+		c.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+	a.record(c, &model.Payment{
+		Provider:   "webhook",
+		ExternalId: notification.Id,
+		Email:      notification.Email,
+		PlanId:     notification.PlanId,
+		Amount:     notification.Amount,
+		Currency:   notification.Currency,
+	})
+}
+
+func (a *PaymentController) stripe(c *gin.Context) {
+	body, secret, ok := a.readSigned(c)
+	if !ok {
+		return
+	}
+	if !a.planService.VerifyStripeSignature(secret, c.GetHeader("Stripe-Signature"), body) {
+		c.AbortWithStatus(http.StatusUnauthorized)
+		return
+	}
+	event := &stripeEvent{}
+	if err := json.Unmarshal(body, event); err != nil {
+		c.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+	if event.Type != "checkout.session.completed" {
+		c.JSON(http.StatusOK, gin.H{"applied": false})
+		return
+	}
+	object := event.Data.Object
+	// metadata values are always strings, an empty plan renews the assigned plan
+	planId, _ := strconv.Atoi(object.Metadata.PlanId)
+	a.record(c, &model.Payment{
+		Provider:   "stripe",
+		ExternalId: event.Id,
+		Email:      object.Metadata.Email,
+		PlanId:     planId,
+		Amount:     float64(object.AmountTotal) / 100,
+		Currency:   object.Currency,
+	})
+}
@@ -0,0 +1,132 @@
+package controller
+
+import (
+	"strconv"
+	"x-ui/database/model"
+	"x-ui/web/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+type assignPlanForm struct {
+	Email  string `json:"email" form:"email"`
+	PlanId int    `json:"planId" form:"planId"`
+}
+
+type PlanController struct {
+	planService service.PlanService
+}
+
+func NewPlanController(g *gin.RouterGroup) *PlanController {
+	a := newPlanController()
+	a.initRouter(g)
+	return a
+}
+
+// newPlanController makes the controller without routes, for controllers that serve its handlers
+func newPlanController() *PlanController {
+	return &PlanController{}
+}
+
+func (a *PlanController) initRouter(g *gin.RouterGroup) {
+	g = g.Group("/plan")
+
+	g.POST("/list", a.getPlans)
+	g.POST("/add", a.addPlan)
+	g.POST("/update/:id", a.updatePlan)
+	g.POST("/del/:id", a.delPlan)
+	g.POST("/clients", a.getClientPlans)
+	g.POST("/assign", a.assignPlan)
+	g.POST("/apply", a.applyPlan)
+	g.POST("/payments", a.getPayments)
+}
+
+func (a *PlanController) getPlans(c *gin.Context) {
+	plans, err := a.planService.GetPlans()
+	if err != nil {
+		jsonMsg(c, "get plans", err)
+		return
+	}
+	jsonObj(c, plans, nil)
+}
+
+func (a *PlanController) addPlan(c *gin.Context) {
+	plan := &model.Plan{}
+	err := c.ShouldBind(plan)
+	if err != nil {
+		jsonMsg(c, "add plan", err)
+		return
+	}
+	plan.Id = 0
+	plan, err = a.planService.AddPlan(plan)
+	jsonMsgObj(c, "add plan", plan, err)
+}
+
+func (a *PlanController) updatePlan(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		jsonMsg(c, "update plan", err)
+		return
+	}
+	plan := &model.Plan{}
+	err = c.ShouldBind(plan)
+	if err != nil {
+		jsonMsg(c, "update plan", err)
+		return
+	}
+	plan.Id = id
+	plan, err = a.planService.UpdatePlan(plan)
+	jsonMsgObj(c, "update plan", plan, err)
+}
+
+func (a *PlanController) delPlan(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		jsonMsg(c, "delete plan", err)
+		return
+	}
+	err = a.planService.DelPlan(id)
+	jsonMsgObj(c, "delete plan", id, err)
+}
+
+func (a *PlanController) getClientPlans(c *gin.Context) {
+	clientPlans, err := a.planService.GetClientPlans()
+	if err != nil {
+		jsonMsg(c, "get client plans", err)
+		return
+	}
+	jsonList(c, clientPlans)
+}
+
+func (a *PlanController) assignPlan(c *gin.Context) {
+	form := &assignPlanForm{}
+	err := c.ShouldBind(form)
+	if err != nil {
+		jsonMsg(c, "assign plan", err)
+		return
+	}
+	err = a.planService.AssignPlan(form.Email, form.PlanId)
+	jsonMsg(c, "assign plan", err)
+}
+
+// applyPlan provisions or renews a client by hand, e.g. for a payment made outside of any gateway
+func (a *PlanController) applyPlan(c *gin.Context) {
+	form := &assignPlanForm{}
+	err := c.ShouldBind(form)
+	if err != nil {
+		jsonMsg(c, "apply plan", err)
+		return
+	}
+	inbound, err := a.planService.ApplyPlan(form.Email, form.PlanId)
+	jsonMsgObj(c, "apply plan", inbound, err)
+}
+
+// getPayments lists the applied payments, ?email= narrows them to one client
+func (a *PlanController) getPayments(c *gin.Context) {
+	payments, err := a.planService.GetPayments(c.Query("email"))
+	if err != nil {
+		jsonMsg(c, "get payments", err)
+		return
+	}
+	jsonList(c, payments)
+}
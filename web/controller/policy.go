@@ -0,0 +1,108 @@
+package controller
+
+import (
+	"strconv"
+	"x-ui/database/model"
+	"x-ui/web/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// PolicyController manages the xray policy levels clients are assigned to
+type PolicyController struct {
+	policyService service.PolicyService
+	xrayService   service.XrayService
+}
+
+func NewPolicyController(g *gin.RouterGroup) *PolicyController {
+	a := newPolicyController()
+	a.initRouter(g)
+	return a
+}
+
+// newPolicyController makes the controller without routes, for controllers that serve its handlers
+func newPolicyController() *PolicyController {
+	return &PolicyController{}
+}
+
+func (a *PolicyController) initRouter(g *gin.RouterGroup) {
+	g = g.Group("/policy")
+
+	g.POST("/list", a.getPolicyProfiles)
+	g.POST("/add", a.addPolicyProfile)
+	g.POST("/update/:id", a.updatePolicyProfile)
+	g.POST("/del/:id", a.delPolicyProfile)
+	g.POST("/client/:email", a.setClientPolicy)
+}
+
+func (a *PolicyController) getPolicyProfiles(c *gin.Context) {
+	profiles, err := a.policyService.GetPolicyProfiles()
+	if err != nil {
+		jsonMsg(c, "get policy profiles", err)
+		return
+	}
+	jsonObj(c, profiles, nil)
+}
+
+func (a *PolicyController) addPolicyProfile(c *gin.Context) {
+	profile := &model.PolicyProfile{}
+	err := c.ShouldBind(profile)
+	if err != nil {
+		jsonMsg(c, "add policy profile", err)
+		return
+	}
+	profile.Id = 0
+	profile, err = a.policyService.AddPolicyProfile(profile)
+	jsonMsgObj(c, "add policy profile", profile, err)
+	if err == nil {
+		a.xrayService.SetToNeedRestart()
+	}
+}
+
+func (a *PolicyController) updatePolicyProfile(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		jsonMsg(c, "update policy profile", err)
+		return
+	}
+	profile := &model.PolicyProfile{}
+	err = c.ShouldBind(profile)
+	if err != nil {
+		jsonMsg(c, "update policy profile", err)
+		return
+	}
+	profile.Id = id
+	profile, err = a.policyService.UpdatePolicyProfile(profile)
+	jsonMsgObj(c, "update policy profile", profile, err)
+	if err == nil {
+		a.xrayService.SetToNeedRestart()
+	}
+}
+
+func (a *PolicyController) delPolicyProfile(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		jsonMsg(c, "delete policy profile", err)
+		return
+	}
+	err = a.policyService.DelPolicyProfile(id)
+	jsonMsgObj(c, "delete policy profile", id, err)
+	if err == nil {
+		a.xrayService.SetToNeedRestart()
+	}
+}
+
+func (a *PolicyController) setClientPolicy(c *gin.Context) {
+	form := &service.ClientPolicy{}
+	err := c.ShouldBind(form)
+	if err != nil {
+		jsonMsg(c, "set client policy", err)
+		return
+	}
+	form.Email = c.Param("email")
+	_, err = a.policyService.SetClientPolicy(form.Email, form.ProfileId)
+	jsonMsgObj(c, "set client policy", form, err)
+	if err == nil {
+		a.xrayService.SetToNeedRestart()
+	}
+}
@@ -0,0 +1,105 @@
+package controller
+
+import (
+	"strconv"
+	"x-ui/database/model"
+	"x-ui/logger"
+	"x-ui/web/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// PortForwardController manages port forwards, local ports xray forwards to a destination host and port
+type PortForwardController struct {
+	portForwardService service.PortForwardService
+	xrayService        service.XrayService
+	firewallService    service.FirewallService
+}
+
+func NewPortForwardController(g *gin.RouterGroup) *PortForwardController {
+	a := newPortForwardController()
+	a.initRouter(g)
+	return a
+}
+
+// newPortForwardController makes the controller without routes, for controllers that serve its handlers
+func newPortForwardController() *PortForwardController {
+	return &PortForwardController{}
+}
+
+func (a *PortForwardController) initRouter(g *gin.RouterGroup) {
+	g = g.Group("/forward")
+
+	g.POST("/list", a.getPortForwards)
+	g.POST("/add", a.addPortForward)
+	g.POST("/update/:id", a.updatePortForward)
+	g.POST("/del/:id", a.delPortForward)
+}
+
+// changed restarts xray and opens or closes the forwarded ports after a port forward changed
+func (a *PortForwardController) changed() {
+	a.xrayService.SetToNeedRestart()
+	go func() {
+		_, err := a.firewallService.ApplyFirewall(false)
+		if err != nil {
+			logger.Web.Warning("apply firewall rules failed:", err)
+		}
+	}()
+}
+
+func (a *PortForwardController) getPortForwards(c *gin.Context) {
+	forwards, err := a.portForwardService.GetPortForwards()
+	if err != nil {
+		jsonMsg(c, "get port forwards", err)
+		return
+	}
+	jsonObj(c, forwards, nil)
+}
+
+func (a *PortForwardController) addPortForward(c *gin.Context) {
+	forward := &model.PortForward{}
+	err := c.ShouldBind(forward)
+	if err != nil {
+		jsonMsg(c, "add port forward", err)
+		return
+	}
+	forward.Id = 0
+	forward, err = a.portForwardService.AddPortForward(forward)
+	jsonMsgObj(c, "add port forward", forward, err)
+	if err == nil {
+		a.changed()
+	}
+}
+
+func (a *PortForwardController) updatePortForward(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		jsonMsg(c, "update port forward", err)
+		return
+	}
+	forward := &model.PortForward{}
+	err = c.ShouldBind(forward)
+	if err != nil {
+		jsonMsg(c, "update port forward", err)
+		return
+	}
+	forward.Id = id
+	forward, err = a.portForwardService.UpdatePortForward(forward)
+	jsonMsgObj(c, "update port forward", forward, err)
+	if err == nil {
+		a.changed()
+	}
+}
+
+func (a *PortForwardController) delPortForward(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		jsonMsg(c, "delete port forward", err)
+		return
+	}
+	err = a.portForwardService.DelPortForward(id)
+	jsonMsgObj(c, "delete port forward", id, err)
+	if err == nil {
+		a.changed()
+	}
+}
@@ -0,0 +1,122 @@
+package controller
+
+import (
+	"net/http"
+	"x-ui/logger"
+	"x-ui/util/ratelimit"
+	"x-ui/web/service"
+	"x-ui/web/session"
+
+	"github.com/gin-gonic/gin"
+)
+
+type redeemForm struct {
+	Code string `json:"code" form:"code"`
+}
+
+type PortalLoginForm struct {
+	Email  string `json:"email" form:"email"`
+	Secret string `json:"secret" form:"secret"`
+}
+
+// PortalController is the self-service area of end users, who log in with their client email and id.
+// It has its own session entry and middleware and never sees the admin routes.
+type PortalController struct {
+	portalService   service.PortalService
+	voucherService  service.VoucherService
+	clientIpService service.ClientIpService
+	settingService  service.SettingService
+}
+
+func NewPortalController(g *gin.RouterGroup) *PortalController {
+	a := &PortalController{}
+	a.initRouter(g)
+	return a
+}
+
+func (a *PortalController) initRouter(g *gin.RouterGroup) {
+	g = g.Group("/portal")
+
+	loginLimit, err := a.settingService.GetLoginRateLimit()
+	if err != nil {
+		logger.Web.Warning("get login rate limit failed:", err)
+	}
+	g.GET("/", a.index)
+	g.POST("/login", rateLimit(ratelimit.NewPerMinute(loginLimit), ipKey), a.login)
+	g.GET("/logout", a.logout)
+
+	g = g.Group("", a.checkPortalLogin)
+	g.POST("/info", a.getInfo)
+	g.POST("/ips", a.getIps)
+	g.POST("/redeem", rateLimit(ratelimit.NewPerMinute(loginLimit), ipKey), a.redeem)
+}
+
+func (a *PortalController) checkPortalLogin(c *gin.Context) {
+	if session.GetPortalClient(c) == "" {
+		pureJsonMsg(c, false, I18n(c, "pages.login.loginAgain"))
+		c.Abort()
+		return
+	}
+	c.Next()
+}
+
+func (a *PortalController) index(c *gin.Context) {
+	if session.GetPortalClient(c) == "" {
+		html(c, "portal_login.html", "pages.portal.title", nil)
+		return
+	}
+	html(c, "portal.html", "pages.portal.title", nil)
+}
+
+func (a *PortalController) login(c *gin.Context) {
+	var form PortalLoginForm
+	err := c.ShouldBind(&form)
+	if err != nil {
+		pureJsonMsg(c, false, I18n(c, "pages.login.toasts.invalidFormData"))
+		return
+	}
+	if !a.portalService.CheckClient(form.Email, form.Secret) {
+		requestLogger(c).Infof("portal login failed for \"%s\" from %s", form.Email, getRemoteIp(c))
+		pureJsonMsg(c, false, I18n(c, "pages.portal.wrongCredentials"))
+		return
+	}
+	err = session.SetPortalClient(c, form.Email)
+	jsonMsg(c, I18n(c, "pages.login.toasts.successLogin"), err)
+}
+
+func (a *PortalController) logout(c *gin.Context) {
+	err := session.ClearPortalClient(c)
+	if err != nil {
+		logger.Web.Warning("portal logout failed:", err)
+	}
+	c.Redirect(http.StatusTemporaryRedirect, c.GetString("base_path")+"portal/")
+}
+
+func (a *PortalController) getInfo(c *gin.Context) {
+	info, err := a.portalService.GetPortalInfo(session.GetPortalClient(c))
+	if err != nil {
+		jsonMsg(c, "get portal info", err)
+		return
+	}
+	jsonObj(c, info, nil)
+}
+
+func (a *PortalController) getIps(c *gin.Context) {
+	ips, err := a.clientIpService.GetClientIpHistory(session.GetPortalClient(c))
+	if err != nil {
+		jsonMsg(c, "get client ip history", err)
+		return
+	}
+	jsonList(c, ips)
+}
+
+func (a *PortalController) redeem(c *gin.Context) {
+	form := &redeemForm{}
+	err := c.ShouldBind(form)
+	if err != nil {
+		jsonMsg(c, I18n(c, "pages.portal.redeem"), err)
+		return
+	}
+	voucher, err := a.voucherService.Redeem(session.GetPortalClient(c), form.Code)
+	jsonMsgObj(c, I18n(c, "pages.portal.redeem"), voucher, err)
+}
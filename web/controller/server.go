@@ -2,15 +2,23 @@ package controller
 
 import (
 	"github.com/gin-gonic/gin"
+	"strconv"
 	"time"
-	"x-ui/web/global"
 	"x-ui/web/service"
 )
 
 type ServerController struct {
 	BaseController
 
-	serverService service.ServerService
+	container *Container
+
+	serverService       service.ServerService
+	speedTestService    service.SpeedTestService
+	realityService      service.RealityService
+	firewallService     service.FirewallService
+	geoService          service.GeoService
+	torService          service.TorService
+	reachabilityService service.ReachabilityService
 
 	lastStatus        *service.Status
 	lastGetStatusTime time.Time
@@ -19,8 +27,9 @@ type ServerController struct {
 	lastGetVersionsTime time.Time
 }
 
-func NewServerController(g *gin.RouterGroup) *ServerController {
+func NewServerController(g *gin.RouterGroup, container *Container) *ServerController {
 	a := &ServerController{
+		container:         container,
 		lastGetStatusTime: time.Now(),
 	}
 	a.initRouter(g)
@@ -35,6 +44,17 @@ func (a *ServerController) initRouter(g *gin.RouterGroup) {
 	g.POST("/status", a.status)
 	g.POST("/getXrayVersion", a.getXrayVersion)
 	g.POST("/installXray/:version", a.installXray)
+	g.POST("/updateGeo", a.updateGeo)
+	g.POST("/speedTest", a.runSpeedTest)
+	g.POST("/speedTestHistory", a.getSpeedTestHistory)
+	g.POST("/realityDests", a.getRealityDests)
+	g.POST("/routingPresets", a.getRoutingPresets)
+	g.POST("/checkRealityDest", a.checkRealityDest)
+	g.POST("/firewall", a.applyFirewall)
+	g.POST("/torStatus", a.getTorStatus)
+	g.POST("/installTor", a.installTor)
+	g.POST("/reachability", a.getReachability)
+	g.POST("/checkReachability", a.checkReachability)
 }
 
 func (a *ServerController) refreshStatus() {
@@ -42,9 +62,7 @@ func (a *ServerController) refreshStatus() {
 }
 
 func (a *ServerController) startTask() {
-	webServer := global.GetWebServer()
-	c := webServer.GetCron()
-	c.AddFunc("@every 2s", func() {
+	a.container.Cron.AddFunc("@every 2s", func() {
 		now := time.Now()
 		if now.Sub(a.lastGetStatusTime) > time.Minute*3 {
 			return
@@ -55,6 +73,10 @@ func (a *ServerController) startTask() {
 
 func (a *ServerController) status(c *gin.Context) {
 	a.lastGetStatusTime = time.Now()
+	// the refresh task pauses while nobody asks for the status, so do not hand out stale data
+	if a.lastStatus == nil || time.Since(a.lastStatus.T) > time.Second*5 {
+		a.refreshStatus()
+	}
 
 	jsonObj(c, a.lastStatus, nil)
 }
@@ -80,6 +102,84 @@ func (a *ServerController) getXrayVersion(c *gin.Context) {
 
 func (a *ServerController) installXray(c *gin.Context) {
 	version := c.Param("version")
-	err := a.serverService.UpdateXray(version)
+	err := a.serverService.UpdateXray(c.Request.Context(), version)
 	jsonMsg(c, I18n(c, "install")+" xray", err)
 }
+
+// updateGeo updates the geo files from their configured urls now
+func (a *ServerController) updateGeo(c *gin.Context) {
+	err := a.geoService.UpdateGeoFiles(c.Request.Context())
+	jsonMsg(c, "update geo files", err)
+}
+
+func (a *ServerController) runSpeedTest(c *gin.Context) {
+	result, err := a.speedTestService.RunSpeedTest(c.PostForm("proxy"), c.PostForm("outbound"))
+	jsonMsgObj(c, "speed test", result, err)
+}
+
+func (a *ServerController) getSpeedTestHistory(c *gin.Context) {
+	results, err := a.speedTestService.GetSpeedTestResults(100)
+	if err != nil {
+		jsonMsg(c, "get speed test history", err)
+		return
+	}
+	jsonList(c, results)
+}
+
+func (a *ServerController) getRealityDests(c *gin.Context) {
+	jsonObj(c, a.realityService.GetRealityDestStatuses(), nil)
+}
+
+// getRoutingPresets answers with the routing presets that the routingPresets setting can enable
+func (a *ServerController) getRoutingPresets(c *gin.Context) {
+	presets, err := service.GetRoutingPresets()
+	if err != nil {
+		jsonMsg(c, "get routing presets", err)
+		return
+	}
+	jsonObj(c, presets, nil)
+}
+
+// getReachability answers with the last check of the inbound ports from outside
+func (a *ServerController) getReachability(c *gin.Context) {
+	jsonObj(c, a.reachabilityService.GetReachabilityStatuses(), nil)
+}
+
+// checkReachability has the reachability checker connect to the inbound ports now
+func (a *ServerController) checkReachability(c *gin.Context) {
+	err := a.reachabilityService.CheckReachability()
+	if err != nil {
+		jsonMsg(c, "check reachability", err)
+		return
+	}
+	jsonObj(c, a.reachabilityService.GetReachabilityStatuses(), nil)
+}
+
+// getTorStatus tells whether the tor daemon at the tor address answers
+func (a *ServerController) getTorStatus(c *gin.Context) {
+	status, err := a.torService.GetTorStatus()
+	if err != nil {
+		jsonMsg(c, "get tor status", err)
+		return
+	}
+	jsonObj(c, status, nil)
+}
+
+// installTor installs the tor daemon with the package manager and starts it
+func (a *ServerController) installTor(c *gin.Context) {
+	err := a.torService.InstallTor()
+	jsonMsg(c, I18n(c, "install")+" tor", err)
+}
+
+// checkRealityDest checks the dest and serverName of a reality inbound that is being edited
+func (a *ServerController) checkRealityDest(c *gin.Context) {
+	status, err := a.realityService.CheckRealityDest(c.PostForm("dest"), c.PostForm("serverName"))
+	jsonMsgObj(c, "check reality dest", status, err)
+}
+
+// applyFirewall reconciles the firewall now, with dryRun=true it only answers with the changes
+func (a *ServerController) applyFirewall(c *gin.Context) {
+	dryRun, _ := strconv.ParseBool(c.Query("dryRun"))
+	changes, err := a.firewallService.ApplyFirewall(dryRun)
+	jsonMsgObj(c, "apply firewall", changes, err)
+}
@@ -64,8 +64,9 @@ func (a *SettingController) updateUser(c *gin.Context) {
 		jsonMsg(c, I18n(c, "pages.setting.toasts.modifySetting"), err)
 		return
 	}
+	// the login may come from a token, which does not carry the password
 	user := session.GetLoginUser(c)
-	if user.Username != form.OldUsername || user.Password != form.OldPassword {
+	if checked := a.userService.CheckUser(form.OldUsername, form.OldPassword); checked == nil || checked.Id != user.Id {
 		jsonMsg(c, I18n(c, "pages.setting.toasts.modifyUser"), errors.New(I18n(c, "pages.setting.toasts.originalUserPassIncorrect")))
 		return
 	}
@@ -0,0 +1,42 @@
+package controller
+
+import (
+	"net/http"
+	"x-ui/logger"
+	"x-ui/util/ratelimit"
+	"x-ui/web/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SubController serves the subscriptions of clients, it is public and answers 404 for unknown and disabled ones
+type SubController struct {
+	subService     service.SubService
+	settingService service.SettingService
+}
+
+func NewSubController(g *gin.RouterGroup) *SubController {
+	a := &SubController{}
+	a.initRouter(g)
+	return a
+}
+
+func (a *SubController) initRouter(g *gin.RouterGroup) {
+	// the limit keeps addresses from guessing subIds, each guess is one request
+	subLimit, err := a.settingService.GetSubRateLimit()
+	if err != nil {
+		logger.Web.Warning("get subscription rate limit failed:", err)
+	}
+	g.GET("/sub/:subId", rateLimit(ratelimit.NewPerMinute(subLimit), ipKey), a.getSubscription)
+}
+
+// getSubscription answers with the base64 share links of the client, they point at the host the request was sent to
+func (a *SubController) getSubscription(c *gin.Context) {
+	sub, err := a.subService.GetSubscription(c.Param("subId"), getRequestAddress(c))
+	if err != nil {
+		logger.Web.Debug("get subscription failed:", err)
+		c.Status(http.StatusNotFound)
+		return
+	}
+	c.String(http.StatusOK, sub)
+}
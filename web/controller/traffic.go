@@ -0,0 +1,97 @@
+package controller
+
+import (
+	"strings"
+	"x-ui/web/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+type TrafficController struct {
+	trafficHistoryService service.TrafficHistoryService
+	billingService        service.BillingService
+}
+
+func NewTrafficController(g *gin.RouterGroup) *TrafficController {
+	a := newTrafficController()
+	a.initRouter(g)
+	return a
+}
+
+// newTrafficController makes the controller without routes, for controllers that serve its handlers
+func newTrafficController() *TrafficController {
+	return &TrafficController{}
+}
+
+func (a *TrafficController) initRouter(g *gin.RouterGroup) {
+	g = g.Group("/traffic")
+
+	g.GET("/series", a.getSeries)
+	g.GET("/cycles", a.getCycles)
+	g.GET("/breakdown", a.getBreakdown)
+	g.GET("/countries", a.getCountries)
+}
+
+// getSeries answers ?inbound=<tag>&range=<24h|7d|...>, an empty inbound sums up all inbounds,
+// with a page parameter only that page of the points is returned
+func (a *TrafficController) getSeries(c *gin.Context) {
+	span, err := service.ParseRange(c.DefaultQuery("range", "24h"))
+	if err != nil {
+		jsonMsg(c, "get traffic series", err)
+		return
+	}
+	series, err := a.trafficHistoryService.GetTrafficSeries(c.Query("inbound"), span)
+	if err != nil {
+		jsonMsg(c, "get traffic series", err)
+		return
+	}
+	if q := getPageQuery(c); q != nil {
+		jsonObj(c, paginate(series.Points, q), nil)
+		return
+	}
+	jsonObj(c, series, nil)
+}
+
+// getBreakdown answers ?range=<24h|7d|...>&by=<protocol,transport,security> with the traffic per group, largest first
+func (a *TrafficController) getBreakdown(c *gin.Context) {
+	span, err := service.ParseRange(c.DefaultQuery("range", "30d"))
+	if err != nil {
+		jsonMsg(c, "get traffic breakdown", err)
+		return
+	}
+	by := make([]string, 0)
+	if value := c.Query("by"); value != "" {
+		by = strings.Split(value, ",")
+	}
+	breakdown, err := a.trafficHistoryService.GetTrafficBreakdown(span, by)
+	if err != nil {
+		jsonMsg(c, "get traffic breakdown", err)
+		return
+	}
+	jsonObj(c, breakdown, nil)
+}
+
+// getCountries answers ?range=<24h|7d|...> with the client traffic per country, largest first
+func (a *TrafficController) getCountries(c *gin.Context) {
+	span, err := service.ParseRange(c.DefaultQuery("range", "30d"))
+	if err != nil {
+		jsonMsg(c, "get country traffic", err)
+		return
+	}
+	countries, err := a.trafficHistoryService.GetCountryTraffic(span)
+	if err != nil {
+		jsonMsg(c, "get country traffic", err)
+		return
+	}
+	jsonObj(c, countries, nil)
+}
+
+// getCycles answers ?kind=<inbound|client>&name=<tag or email> with the archived traffic cycles, newest first
+func (a *TrafficController) getCycles(c *gin.Context) {
+	cycles, err := a.billingService.GetTrafficCycles(c.DefaultQuery("kind", "client"), c.Query("name"))
+	if err != nil {
+		jsonMsg(c, "get traffic cycles", err)
+		return
+	}
+	jsonList(c, cycles)
+}
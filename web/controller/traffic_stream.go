@@ -0,0 +1,74 @@
+package controller
+
+import (
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+	"x-ui/logger"
+	"x-ui/web/service"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/net/websocket"
+)
+
+type TrafficStreamController struct {
+	trafficStreamService service.TrafficStreamService
+}
+
+func NewTrafficStreamController(g *gin.RouterGroup) *TrafficStreamController {
+	a := &TrafficStreamController{}
+	a.initRouter(g)
+	return a
+}
+
+func (a *TrafficStreamController) initRouter(g *gin.RouterGroup) {
+	g.GET("/ws/traffic", a.stream)
+}
+
+// the session cookie is sent with cross-site websocket requests, so only accept our own origin
+func checkSameOrigin(config *websocket.Config, req *http.Request) error {
+	origin, err := websocket.Origin(config, req)
+	if err != nil {
+		return err
+	}
+	if origin == nil || origin.Host != req.Host {
+		return websocket.ErrBadWebSocketOrigin
+	}
+	config.Origin = &url.URL{Scheme: origin.Scheme, Host: origin.Host}
+	return nil
+}
+
+func (a *TrafficStreamController) stream(c *gin.Context) {
+	server := websocket.Server{
+		Handshake: checkSameOrigin,
+		Handler:   a.handle,
+	}
+	server.ServeHTTP(c.Writer, c.Request)
+}
+
+func (a *TrafficStreamController) handle(ws *websocket.Conn) {
+	ch := a.trafficStreamService.Subscribe()
+	defer a.trafficStreamService.Unsubscribe(ch)
+
+	closed := make(chan struct{})
+	go func() {
+		io.Copy(io.Discard, ws)
+		close(closed)
+	}()
+
+	for {
+		select {
+		case snapshot := <-ch:
+			ws.SetWriteDeadline(time.Now().Add(time.Second * 10))
+			err := websocket.JSON.Send(ws, snapshot)
+			if err != nil {
+				logger.Web.Debug("send traffic snapshot failed:", err)
+				ws.Close()
+				return
+			}
+		case <-closed:
+			return
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package controller
+
+import (
+	"x-ui/logger"
+	"x-ui/util/ratelimit"
+	"x-ui/web/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+type trialStatusForm struct {
+	Id    int    `json:"id" form:"id"`
+	Token string `json:"token" form:"token"`
+}
+
+// TrialController lets anyone create a trial client once per cooldown, it is public and off
+// unless trials are enabled in the settings
+type TrialController struct {
+	trialService   service.TrialService
+	settingService service.SettingService
+}
+
+func NewTrialController(g *gin.RouterGroup) *TrialController {
+	a := &TrialController{}
+	a.initRouter(g)
+	return a
+}
+
+func (a *TrialController) initRouter(g *gin.RouterGroup) {
+	loginLimit, err := a.settingService.GetLoginRateLimit()
+	if err != nil {
+		logger.Web.Warning("get login rate limit failed:", err)
+	}
+	g.POST("/trial", rateLimit(ratelimit.NewPerMinute(loginLimit), ipKey), a.createTrial)
+	g.POST("/trial/status", rateLimit(ratelimit.NewPerMinute(loginLimit), ipKey), a.getTrialStatus)
+}
+
+// createTrial returns the email, limits and share link of the new client, the link points at the
+// host the request was sent to. Trials that need approval answer with the id and token of their request
+func (a *TrialController) createTrial(c *gin.Context) {
+	address := getRequestAddress(c)
+	account, request, err := a.trialService.RequestTrial("ip:"+getRemoteIp(c), address, 0)
+	if err != nil {
+		logger.Web.Infof("trial for %s refused: %v", getRemoteIp(c), err)
+	}
+	if request != nil {
+		jsonObj(c, request, nil)
+		return
+	}
+	jsonObj(c, account, err)
+}
+
+// getTrialStatus answers with the status of a trial request, and the link once it is approved
+func (a *TrialController) getTrialStatus(c *gin.Context) {
+	form := &trialStatusForm{}
+	err := c.ShouldBind(form)
+	if err != nil {
+		jsonObj(c, nil, err)
+		return
+	}
+	request, err := a.trialService.GetTrialRequest(form.Id, form.Token)
+	jsonObj(c, request, err)
+}
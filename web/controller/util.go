@@ -19,16 +19,24 @@ func getUriId(c *gin.Context) int64 {
 	return s.Id
 }
 
+// getRemoteIp is the address of the client, X-Forwarded-For is only followed through the trusted proxies
+// the router was given, anyone else could pick the address their requests are counted on
 func getRemoteIp(c *gin.Context) string {
-	value := c.GetHeader("X-Forwarded-For")
-	if value != "" {
-		ips := strings.Split(value, ",")
-		return ips[0]
-	} else {
-		addr := c.Request.RemoteAddr
-		ip, _, _ := net.SplitHostPort(addr)
-		return ip
+	return c.ClientIP()
+}
+
+// getRequestAddress returns the host the request was sent to without its port, ipv6 literals without brackets
+func getRequestAddress(c *gin.Context) string {
+	address, _, err := net.SplitHostPort(c.Request.Host)
+	if err != nil {
+		address = strings.TrimSuffix(strings.TrimPrefix(c.Request.Host, "["), "]")
 	}
+	return address
+}
+
+// requestLogger tags log lines with the id the request got in the router
+func requestLogger(c *gin.Context) logger.Request {
+	return logger.Request(c.GetString("request_id"))
 }
 
 func jsonMsg(c *gin.Context, msg string, err error) {
@@ -43,6 +51,7 @@ func jsonMsgObj(c *gin.Context, msg string, obj interface{}, err error) {
 	m := entity.Msg{
 		Obj: obj,
 	}
+	msg = localizeMsg(c, msg)
 	if err == nil {
 		m.Success = true
 		if msg != "" {
@@ -51,11 +60,22 @@ func jsonMsgObj(c *gin.Context, msg string, obj interface{}, err error) {
 	} else {
 		m.Success = false
 		m.Msg = msg + I18n(c, "fail") + ": " + err.Error()
-		logger.Warning(msg+I18n(c, "fail")+": ", err)
+		requestLogger(c).Warning(msg+I18n(c, "fail")+": ", err)
 	}
 	c.JSON(http.StatusOK, m)
 }
 
+// localizeMsg looks up the action of a response in the messages catalog, messages it does not know stay as they are
+func localizeMsg(c *gin.Context, msg string) string {
+	if msg == "" {
+		return msg
+	}
+	if translated := I18n(c, "messages."+msg); translated != "" {
+		return translated
+	}
+	return msg
+}
+
 func pureJsonMsg(c *gin.Context, success bool, msg string) {
 	if success {
 		c.JSON(http.StatusOK, entity.Msg{
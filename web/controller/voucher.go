@@ -0,0 +1,68 @@
+package controller
+
+import (
+	"strconv"
+	"x-ui/web/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+type generateVouchersForm struct {
+	Count   int   `json:"count" form:"count"`
+	Traffic int64 `json:"traffic" form:"traffic"`
+	Days    int   `json:"days" form:"days"`
+}
+
+type VoucherController struct {
+	voucherService service.VoucherService
+}
+
+func NewVoucherController(g *gin.RouterGroup) *VoucherController {
+	a := &VoucherController{}
+	a.initRouter(g)
+	return a
+}
+
+func (a *VoucherController) initRouter(g *gin.RouterGroup) {
+	g = g.Group("/voucher")
+
+	g.POST("/list", a.getVouchers)
+	g.POST("/generate", a.generateVouchers)
+	g.POST("/del/:id", a.delVoucher)
+}
+
+func (a *VoucherController) getVouchers(c *gin.Context) {
+	vouchers, err := a.voucherService.GetVouchers()
+	if err != nil {
+		jsonMsg(c, "get vouchers", err)
+		return
+	}
+	// anyone with a code can redeem it
+	if isViewer(c) {
+		for _, voucher := range vouchers {
+			voucher.Code = ""
+		}
+	}
+	jsonList(c, vouchers)
+}
+
+func (a *VoucherController) generateVouchers(c *gin.Context) {
+	form := &generateVouchersForm{}
+	err := c.ShouldBind(form)
+	if err != nil {
+		jsonMsg(c, "generate vouchers", err)
+		return
+	}
+	vouchers, err := a.voucherService.GenerateVouchers(form.Count, form.Traffic, form.Days)
+	jsonMsgObj(c, "generate vouchers", vouchers, err)
+}
+
+func (a *VoucherController) delVoucher(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		jsonMsg(c, "delete voucher", err)
+		return
+	}
+	err = a.voucherService.DelVoucher(id)
+	jsonMsgObj(c, "delete voucher", id, err)
+}
@@ -0,0 +1,81 @@
+package controller
+
+import (
+	"strconv"
+	"x-ui/database/model"
+	"x-ui/web/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+type WebhookController struct {
+	webhookService service.WebhookService
+}
+
+func NewWebhookController(g *gin.RouterGroup) *WebhookController {
+	a := &WebhookController{}
+	a.initRouter(g)
+	return a
+}
+
+func (a *WebhookController) initRouter(g *gin.RouterGroup) {
+	g = g.Group("/webhook")
+
+	g.POST("/list", a.getWebhooks)
+	g.POST("/add", a.addWebhook)
+	g.POST("/update/:id", a.updateWebhook)
+	g.POST("/del/:id", a.delWebhook)
+}
+
+func (a *WebhookController) getWebhooks(c *gin.Context) {
+	webhooks, err := a.webhookService.GetWebhooks()
+	if err != nil {
+		jsonMsg(c, "get webhooks", err)
+		return
+	}
+	if isViewer(c) {
+		for _, webhook := range webhooks {
+			webhook.Secret = ""
+		}
+	}
+	jsonObj(c, webhooks, nil)
+}
+
+func (a *WebhookController) addWebhook(c *gin.Context) {
+	webhook := &model.Webhook{}
+	err := c.ShouldBind(webhook)
+	if err != nil {
+		jsonMsg(c, "add webhook", err)
+		return
+	}
+	webhook.Id = 0
+	webhook, err = a.webhookService.AddWebhook(webhook)
+	jsonMsgObj(c, "add webhook", webhook, err)
+}
+
+func (a *WebhookController) updateWebhook(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		jsonMsg(c, "update webhook", err)
+		return
+	}
+	webhook := &model.Webhook{}
+	err = c.ShouldBind(webhook)
+	if err != nil {
+		jsonMsg(c, "update webhook", err)
+		return
+	}
+	webhook.Id = id
+	webhook, err = a.webhookService.UpdateWebhook(webhook)
+	jsonMsgObj(c, "update webhook", webhook, err)
+}
+
+func (a *WebhookController) delWebhook(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		jsonMsg(c, "delete webhook", err)
+		return
+	}
+	err = a.webhookService.DelWebhook(id)
+	jsonMsgObj(c, "delete webhook", id, err)
+}
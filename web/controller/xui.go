@@ -7,8 +7,20 @@ import (
 type XUIController struct {
 	BaseController
 
-	inboundController *InboundController
-	settingController *SettingController
+	inboundController       *InboundController
+	settingController       *SettingController
+	trafficStreamController *TrafficStreamController
+	alertController         *AlertController
+	nodeController          *NodeController
+	webhookController       *WebhookController
+	planController          *PlanController
+	voucherController       *VoucherController
+	logController           *LogController
+	jobController           *JobController
+	certificateController   *CertificateController
+	policyController        *PolicyController
+	portForwardController   *PortForwardController
+	outboundController      *OutboundController
 }
 
 func NewXUIController(g *gin.RouterGroup) *XUIController {
@@ -27,6 +39,18 @@ func (a *XUIController) initRouter(g *gin.RouterGroup) {
 
 	a.inboundController = NewInboundController(g)
 	a.settingController = NewSettingController(g)
+	a.trafficStreamController = NewTrafficStreamController(g)
+	a.alertController = NewAlertController(g)
+	a.nodeController = NewNodeController(g)
+	a.webhookController = NewWebhookController(g)
+	a.planController = NewPlanController(g)
+	a.voucherController = NewVoucherController(g)
+	a.logController = NewLogController(g)
+	a.jobController = NewJobController(g)
+	a.certificateController = NewCertificateController(g)
+	a.policyController = NewPolicyController(g)
+	a.portForwardController = NewPortForwardController(g)
+	a.outboundController = NewOutboundController(g)
 }
 
 func (a *XUIController) index(c *gin.Context) {
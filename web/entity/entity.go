@@ -1,13 +1,25 @@
 package entity
 
 import (
+	"crypto/ed25519"
 	"crypto/tls"
+	"encoding/base64"
 	"encoding/json"
 	"net"
+	"net/mail"
+	"net/url"
+	"path/filepath"
 	"strings"
 	"time"
+	"x-ui/util/botauth"
 	"x-ui/util/common"
+	"x-ui/util/dnsapi"
+	"x-ui/util/firewall"
+	"x-ui/util/redis"
 	"x-ui/xray"
+
+	"github.com/robfig/cron/v3"
+	"golang.org/x/text/language"
 )
 
 type Msg struct {
@@ -26,19 +38,129 @@ type Pager struct {
 	List     interface{} `json:"list"`
 }
 
+// PageQuery is parsed from the page, size, sort and filter parameters of list endpoints,
+// sort names a json field and a leading "-" sorts descending, filter matches any text field
+type PageQuery struct {
+	Page   int
+	Size   int
+	Sort   string
+	Desc   bool
+	Filter string
+}
+
+type Page struct {
+	Items interface{} `json:"items"`
+	Total int         `json:"total"`
+	Page  int         `json:"page"`
+	Size  int         `json:"size"`
+}
+
 type AllSetting struct {
 	WebListen          string `json:"webListen" form:"webListen"`
 	WebPort            int    `json:"webPort" form:"webPort"`
 	WebCertFile        string `json:"webCertFile" form:"webCertFile"`
 	WebKeyFile         string `json:"webKeyFile" form:"webKeyFile"`
+	WebCertificateId   int    `json:"webCertificateId" form:"webCertificateId"`
 	WebBasePath        string `json:"webBasePath" form:"webBasePath"`
 	TgBotEnable        bool   `json:"tgBotEnable" form:"tgBotEnable"`
 	TgBotToken         string `json:"tgBotToken" form:"tgBotToken"`
 	TgBotChatId        int    `json:"tgBotChatId" form:"tgBotChatId"`
+	TgBotUsers         string `json:"tgBotUsers" form:"tgBotUsers"`
 	TgRunTime          string `json:"tgRunTime" form:"tgRunTime"`
 	XrayTemplateConfig string `json:"xrayTemplateConfig" form:"xrayTemplateConfig"`
 
-	TimeLocation string `json:"timeLocation" form:"timeLocation"`
+	TimeLocation       string `json:"timeLocation" form:"timeLocation"`
+	IpHistoryRetention int    `json:"ipHistoryRetention" form:"ipHistoryRetention"`
+	UniqueClientIds    bool   `json:"uniqueClientIds" form:"uniqueClientIds"`
+
+	TsdbEnable   bool   `json:"tsdbEnable" form:"tsdbEnable"`
+	TsdbUrl      string `json:"tsdbUrl" form:"tsdbUrl"`
+	TsdbToken    string `json:"tsdbToken" form:"tsdbToken"`
+	TsdbInterval int    `json:"tsdbInterval" form:"tsdbInterval"`
+
+	LoginRateLimit      int    `json:"loginRateLimit" form:"loginRateLimit"`
+	ApiRateLimit        int    `json:"apiRateLimit" form:"apiRateLimit"`
+	SubRateLimit        int    `json:"subRateLimit" form:"subRateLimit"`
+	SubSkipOfflineNodes bool   `json:"subSkipOfflineNodes" form:"subSkipOfflineNodes"`
+	TrustedProxies      string `json:"trustedProxies" form:"trustedProxies"`
+
+	PaymentSecret string `json:"paymentSecret" form:"paymentSecret"`
+
+	TrialEnable       bool `json:"trialEnable" form:"trialEnable"`
+	TrialInboundId    int  `json:"trialInboundId" form:"trialInboundId"`
+	TrialTraffic      int  `json:"trialTraffic" form:"trialTraffic"`
+	TrialHours        int  `json:"trialHours" form:"trialHours"`
+	TrialCooldownDays int  `json:"trialCooldownDays" form:"trialCooldownDays"`
+	TrialApproval     bool `json:"trialApproval" form:"trialApproval"`
+
+	LogFormat         string `json:"logFormat" form:"logFormat"`
+	LogFile           string `json:"logFile" form:"logFile"`
+	LogMaxSize        int    `json:"logMaxSize" form:"logMaxSize"`
+	LogMaxFiles       int    `json:"logMaxFiles" form:"logMaxFiles"`
+	LogMaxAge         int    `json:"logMaxAge" form:"logMaxAge"`
+	LogShipping       string `json:"logShipping" form:"logShipping"`
+	LogSyslogFacility string `json:"logSyslogFacility" form:"logSyslogFacility"`
+	LogSyslogTag      string `json:"logSyslogTag" form:"logSyslogTag"`
+	LogLevelWeb       string `json:"logLevelWeb" form:"logLevelWeb"`
+	LogLevelXray      string `json:"logLevelXray" form:"logLevelXray"`
+	LogLevelTgbot     string `json:"logLevelTgbot" form:"logLevelTgbot"`
+	LogLevelJob       string `json:"logLevelJob" form:"logLevelJob"`
+
+	JobSchedules string `json:"jobSchedules" form:"jobSchedules"`
+
+	GeoipCountryDb string `json:"geoipCountryDb" form:"geoipCountryDb"`
+	GeoipAsnDb     string `json:"geoipAsnDb" form:"geoipAsnDb"`
+
+	Language string `json:"language" form:"language"`
+
+	SmtpHost        string `json:"smtpHost" form:"smtpHost"`
+	SmtpPort        int    `json:"smtpPort" form:"smtpPort"`
+	SmtpUsername    string `json:"smtpUsername" form:"smtpUsername"`
+	SmtpPassword    string `json:"smtpPassword" form:"smtpPassword"`
+	SmtpFrom        string `json:"smtpFrom" form:"smtpFrom"`
+	SmtpTo          string `json:"smtpTo" form:"smtpTo"`
+	SmtpLoginNotify bool   `json:"smtpLoginNotify" form:"smtpLoginNotify"`
+
+	AcmeEmail          string `json:"acmeEmail" form:"acmeEmail"`
+	AcmeDirectory      string `json:"acmeDirectory" form:"acmeDirectory"`
+	AcmeDnsProvider    string `json:"acmeDnsProvider" form:"acmeDnsProvider"`
+	AcmeDnsCredentials string `json:"acmeDnsCredentials" form:"acmeDnsCredentials"`
+
+	FirewallDriver string `json:"firewallDriver" form:"firewallDriver"`
+	FirewallDryRun bool   `json:"firewallDryRun" form:"firewallDryRun"`
+
+	PreferredAddressFamily string `json:"preferredAddressFamily" form:"preferredAddressFamily"`
+
+	EventScripts string `json:"eventScripts" form:"eventScripts"`
+
+	RedisUrl string `json:"redisUrl" form:"redisUrl"`
+	HaLock   string `json:"haLock" form:"haLock"`
+
+	RoutingPresets string `json:"routingPresets" form:"routingPresets"`
+
+	GeoipUrl      string `json:"geoipUrl" form:"geoipUrl"`
+	GeositeUrl    string `json:"geositeUrl" form:"geositeUrl"`
+	GeoSigningKey string `json:"geoSigningKey" form:"geoSigningKey"`
+
+	TorEnable  bool   `json:"torEnable" form:"torEnable"`
+	TorManaged bool   `json:"torManaged" form:"torManaged"`
+	TorAddress string `json:"torAddress" form:"torAddress"`
+	TorDomains string `json:"torDomains" form:"torDomains"`
+
+	ReachabilityChecker      string `json:"reachabilityChecker" form:"reachabilityChecker"`
+	ReachabilityCheckerToken string `json:"reachabilityCheckerToken" form:"reachabilityCheckerToken"`
+
+	LatencyProbeUrls string `json:"latencyProbeUrls" form:"latencyProbeUrls"`
+	LatencyBalancers bool   `json:"latencyBalancers" form:"latencyBalancers"`
+
+	TracingEndpoint string `json:"tracingEndpoint" form:"tracingEndpoint"`
+	TracingHeaders  string `json:"tracingHeaders" form:"tracingHeaders"`
+
+	DebugEnable bool `json:"debugEnable" form:"debugEnable"`
+
+	JwtSessions      bool `json:"jwtSessions" form:"jwtSessions"`
+	JwtAccessMinutes int  `json:"jwtAccessMinutes" form:"jwtAccessMinutes"`
+	JwtRefreshDays   int  `json:"jwtRefreshDays" form:"jwtRefreshDays"`
 }
 
 func (s *AllSetting) CheckValid() error {
@@ -60,6 +182,10 @@ func (s *AllSetting) CheckValid() error {
 		}
 	}
 
+	if s.WebCertificateId < 0 {
+		return common.NewError("web certificate is not a valid id:", s.WebCertificateId)
+	}
+
 	if !strings.HasPrefix(s.WebBasePath, "/") {
 		s.WebBasePath = "/" + s.WebBasePath
 	}
@@ -78,5 +204,194 @@ func (s *AllSetting) CheckValid() error {
 		return common.NewError("time location not exist:", s.TimeLocation)
 	}
 
+	if s.IpHistoryRetention < 0 {
+		return common.NewError("ip history retention can not be negative:", s.IpHistoryRetention)
+	}
+
+	if s.TsdbEnable {
+		u, err := url.Parse(s.TsdbUrl)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			return common.NewError("time-series database url is not valid:", s.TsdbUrl)
+		}
+		if s.TsdbInterval < 10 {
+			return common.NewError("time-series export interval must be at least 10 seconds:", s.TsdbInterval)
+		}
+	}
+
+	if s.LoginRateLimit < 0 || s.ApiRateLimit < 0 || s.SubRateLimit < 0 {
+		return common.NewError("rate limits can not be negative")
+	}
+	for _, proxy := range strings.Split(s.TrustedProxies, ",") {
+		proxy = strings.TrimSpace(proxy)
+		if proxy == "" {
+			continue
+		}
+		if net.ParseIP(proxy) == nil {
+			if _, _, err := net.ParseCIDR(proxy); err != nil {
+				return common.NewError("trusted proxy is not an address or cidr:", proxy)
+			}
+		}
+	}
+
+	if s.TrialEnable {
+		if s.TrialInboundId <= 0 {
+			return common.NewError("trial inbound is not set")
+		}
+		if s.TrialTraffic <= 0 || s.TrialHours <= 0 {
+			return common.NewError("trial traffic and hours must be positive")
+		}
+		if s.TrialApproval && (!s.TgBotEnable || s.TgBotToken == "" || s.TgBotChatId == 0) {
+			return common.NewError("trial approval needs the telegram bot with a chat id")
+		}
+	}
+	if s.TrialCooldownDays < 0 {
+		return common.NewError("trial cooldown can not be negative:", s.TrialCooldownDays)
+	}
+
+	if s.LogFormat != "text" && s.LogFormat != "json" {
+		return common.NewError("log format must be text or json:", s.LogFormat)
+	}
+	if s.LogFile != "" && !filepath.IsAbs(s.LogFile) {
+		return common.NewError("log file must be an absolute path:", s.LogFile)
+	}
+	if s.LogMaxSize < 0 || s.LogMaxFiles < 0 || s.LogMaxAge < 0 {
+		return common.NewError("log rotation limits can not be negative")
+	}
+	if s.LogShipping != "" && s.LogShipping != "syslog" && s.LogShipping != "journald" {
+		return common.NewError("log shipping must be empty, syslog or journald:", s.LogShipping)
+	}
+	for _, level := range []string{s.LogLevelWeb, s.LogLevelXray, s.LogLevelTgbot, s.LogLevelJob} {
+		switch level {
+		case "", "debug", "info", "warning", "error":
+		default:
+			return common.NewError("log level must be empty, debug, info, warning or error:", level)
+		}
+	}
+
+	if s.SmtpHost != "" {
+		if s.SmtpPort <= 0 || s.SmtpPort > 65535 {
+			return common.NewError("smtp port is not a valid port:", s.SmtpPort)
+		}
+		if _, err := mail.ParseAddress(s.SmtpFrom); err != nil {
+			return common.NewError("smtp sender is not a valid address:", s.SmtpFrom)
+		}
+		if s.SmtpTo != "" {
+			if _, err := mail.ParseAddressList(s.SmtpTo); err != nil {
+				return common.NewError("smtp recipients are not valid addresses:", s.SmtpTo)
+			}
+		}
+	}
+
+	if _, err := language.Parse(s.Language); err != nil {
+		return common.NewError("language is not a valid language tag:", s.Language)
+	}
+
+	if s.AcmeEmail != "" {
+		if _, err := mail.ParseAddress(s.AcmeEmail); err != nil {
+			return common.NewError("acme email is not a valid address:", s.AcmeEmail)
+		}
+	}
+	if u, err := url.Parse(s.AcmeDirectory); err != nil || u.Scheme != "https" {
+		return common.NewError("acme directory is not a valid https url:", s.AcmeDirectory)
+	}
+	if s.AcmeDnsProvider != "" {
+		if _, err := dnsapi.New(s.AcmeDnsProvider, s.AcmeDnsCredentials); err != nil {
+			return err
+		}
+	}
+
+	if s.PreferredAddressFamily != "ipv4" && s.PreferredAddressFamily != "ipv6" {
+		return common.NewError("preferred address family must be ipv4 or ipv6:", s.PreferredAddressFamily)
+	}
+
+	if s.FirewallDriver != "" {
+		if _, err := firewall.New(s.FirewallDriver); err != nil {
+			return err
+		}
+	}
+
+	if _, err := botauth.Parse(s.TgBotUsers); err != nil {
+		return err
+	}
+
+	for _, path := range []string{s.GeoipCountryDb, s.GeoipAsnDb} {
+		if path != "" && !filepath.IsAbs(path) {
+			return common.NewError("geoip database must be an absolute path:", path)
+		}
+	}
+
+	schedules := map[string]string{}
+	err = json.Unmarshal([]byte(s.JobSchedules), &schedules)
+	if err != nil {
+		return common.NewError("job schedules must be a json object of job names and cron specs:", err)
+	}
+	parser := cron.NewParser(cron.Second | cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow | cron.Descriptor)
+	for name, spec := range schedules {
+		if _, err := parser.Parse(spec); err != nil {
+			return common.NewErrorf("schedule of job %v is not a valid cron spec: %v", name, err)
+		}
+	}
+
+	scripts := map[string]string{}
+	err = json.Unmarshal([]byte(s.EventScripts), &scripts)
+	if err != nil {
+		return common.NewError("event scripts must be a json object of event names and commands:", err)
+	}
+
+	if s.RedisUrl != "" {
+		if _, err := redis.Parse(s.RedisUrl); err != nil {
+			return err
+		}
+	}
+	for _, geoUrl := range []string{s.GeoipUrl, s.GeositeUrl} {
+		if geoUrl == "" {
+			continue
+		}
+		if u, err := url.Parse(geoUrl); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			return common.NewError("geo file url is not valid:", geoUrl)
+		}
+	}
+	if s.GeoSigningKey != "" {
+		if key, err := base64.StdEncoding.DecodeString(s.GeoSigningKey); err != nil || len(key) != ed25519.PublicKeySize {
+			return common.NewError("geo signing key must be a base64 ed25519 public key")
+		}
+	}
+	if s.TorEnable {
+		if _, _, err := net.SplitHostPort(s.TorAddress); err != nil {
+			return common.NewError("tor address must be a host and port:", s.TorAddress)
+		}
+	}
+	for _, probeUrl := range strings.Split(s.LatencyProbeUrls, ",") {
+		probeUrl = strings.TrimSpace(probeUrl)
+		if probeUrl == "" {
+			continue
+		}
+		if u, err := url.Parse(probeUrl); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			return common.NewError("latency probe url is not valid:", probeUrl)
+		}
+	}
+	if s.JwtSessions && (s.JwtAccessMinutes <= 0 || s.JwtRefreshDays <= 0) {
+		return common.NewError("the lifetimes of session tokens must be positive")
+	}
+	if s.TracingEndpoint != "" {
+		if u, err := url.Parse(s.TracingEndpoint); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			return common.NewError("tracing endpoint is not a http url:", s.TracingEndpoint)
+		}
+	}
+	for _, pair := range strings.Split(s.TracingHeaders, ",") {
+		if pair = strings.TrimSpace(pair); pair == "" {
+			continue
+		}
+		if name, _, ok := strings.Cut(pair, "="); !ok || strings.TrimSpace(name) == "" {
+			return common.NewError("tracing header is not name=value:", pair)
+		}
+	}
+	if s.HaLock == "redis" && s.RedisUrl == "" {
+		return common.NewError("the redis high availability lock needs the redis url")
+	}
+	if s.HaLock != "" && s.HaLock != "redis" && !filepath.IsAbs(s.HaLock) {
+		return common.NewError("high availability lock must be redis or an absolute path:", s.HaLock)
+	}
+
 	return nil
 }
@@ -0,0 +1,36 @@
+package job
+
+import (
+	"context"
+	"x-ui/logger"
+	"x-ui/util/common"
+	"x-ui/web/service"
+)
+
+type AccessLogJob struct {
+	onlineService   service.OnlineService
+	clientIpService service.ClientIpService
+}
+
+func NewAccessLogJob() *AccessLogJob {
+	return new(AccessLogJob)
+}
+
+func (j *AccessLogJob) Run() {
+	err := j.Execute(context.Background())
+	if err != nil {
+		logger.Job.Warning(err)
+	}
+}
+
+func (j *AccessLogJob) Execute(ctx context.Context) error {
+	entries, err := j.onlineService.ReadAccessLog()
+	if err != nil {
+		return common.NewError("read xray access log failed:", err)
+	}
+	err = j.clientIpService.AddAccessLogEntries(ctx, entries)
+	if err != nil {
+		return common.NewError("save client ip history failed:", err)
+	}
+	return nil
+}
@@ -0,0 +1,21 @@
+package job
+
+import (
+	"x-ui/logger"
+	"x-ui/web/service"
+)
+
+type AlertJob struct {
+	alertService service.AlertService
+}
+
+func NewAlertJob() *AlertJob {
+	return new(AlertJob)
+}
+
+func (j *AlertJob) Run() {
+	err := j.alertService.EvaluateAlertRules()
+	if err != nil {
+		logger.Job.Warning("evaluate alert rules failed:", err)
+	}
+}
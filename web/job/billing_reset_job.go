@@ -0,0 +1,34 @@
+package job
+
+import (
+	"context"
+	"x-ui/logger"
+	"x-ui/util/common"
+	"x-ui/web/service"
+)
+
+type BillingResetJob struct {
+	billingService service.BillingService
+}
+
+func NewBillingResetJob() *BillingResetJob {
+	return new(BillingResetJob)
+}
+
+func (j *BillingResetJob) Run() {
+	err := j.Execute(context.Background())
+	if err != nil {
+		logger.Job.Warning(err)
+	}
+}
+
+func (j *BillingResetJob) Execute(ctx context.Context) error {
+	count, err := j.billingService.ResetDueCycles(ctx)
+	if err != nil {
+		return common.NewError("reset billing cycles failed:", err)
+	}
+	if count > 0 {
+		logger.Job.Infof("reset the traffic of %v inbounds and clients for the new billing cycle", count)
+	}
+	return nil
+}
@@ -0,0 +1,31 @@
+package job
+
+import (
+	"x-ui/logger"
+	"x-ui/web/service"
+)
+
+type CertRenewJob struct {
+	acmeService        service.AcmeService
+	certificateService service.CertificateService
+	xrayService        service.XrayService
+}
+
+func NewCertRenewJob() *CertRenewJob {
+	return new(CertRenewJob)
+}
+
+func (j *CertRenewJob) Run() {
+	renewed, err := j.acmeService.RenewCertificates()
+	if err != nil {
+		logger.Job.Warning("renew certificates failed:", err)
+	}
+	for _, cert := range renewed {
+		logger.Job.Infof("renewed certificate %v of %v", cert.Name, cert.Domains)
+		// the panel listener picks the new one up by itself, xray reads it at start
+		used, err := j.certificateService.IsCertificateUsed(cert.Id)
+		if err == nil && used {
+			j.xrayService.SetToNeedRestart()
+		}
+	}
+}
@@ -1,7 +1,9 @@
 package job
 
 import (
+	"context"
 	"x-ui/logger"
+	"x-ui/util/common"
 	"x-ui/web/service"
 )
 
@@ -15,19 +17,28 @@ func NewCheckInboundJob() *CheckInboundJob {
 }
 
 func (j *CheckInboundJob) Run() {
-	count, err := j.inboundService.DisableInvalidClients()
+	err := j.Execute(context.Background())
 	if err != nil {
-		logger.Warning("disable invalid Client err:", err)
+		logger.Job.Warning(err)
+	}
+}
+
+func (j *CheckInboundJob) Execute(ctx context.Context) error {
+	var errs []error
+	count, err := j.inboundService.DisableInvalidClients(ctx)
+	if err != nil {
+		errs = append(errs, common.NewError("disable invalid Client err:", err))
 	} else if count > 0 {
-		logger.Debugf("disabled %v Client", count)
+		logger.Job.Debugf("disabled %v Client", count)
 		j.xrayService.SetToNeedRestart()
 	}
 
-	count, err = j.inboundService.DisableInvalidInbounds()
+	count, err = j.inboundService.DisableInvalidInbounds(ctx)
 	if err != nil {
-		logger.Warning("disable invalid inbounds err:", err)
+		errs = append(errs, common.NewError("disable invalid inbounds err:", err))
 	} else if count > 0 {
-		logger.Debugf("disabled %v inbounds", count)
+		logger.Job.Debugf("disabled %v inbounds", count)
 		j.xrayService.SetToNeedRestart()
 	}
+	return common.Combine(errs...)
 }
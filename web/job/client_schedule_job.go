@@ -0,0 +1,21 @@
+package job
+
+import (
+	"x-ui/logger"
+	"x-ui/web/service"
+)
+
+type ClientScheduleJob struct {
+	clientScheduleService service.ClientScheduleService
+}
+
+func NewClientScheduleJob() *ClientScheduleJob {
+	return new(ClientScheduleJob)
+}
+
+func (j *ClientScheduleJob) Run() {
+	err := j.clientScheduleService.ApplyClientSchedules()
+	if err != nil {
+		logger.Job.Warning("apply client schedules failed:", err)
+	}
+}
@@ -0,0 +1,21 @@
+package job
+
+import (
+	"x-ui/logger"
+	"x-ui/web/service"
+)
+
+type ConnLimitJob struct {
+	connLimitService service.ConnLimitService
+}
+
+func NewConnLimitJob() *ConnLimitJob {
+	return new(ConnLimitJob)
+}
+
+func (j *ConnLimitJob) Run() {
+	err := j.connLimitService.EnforceConnLimits()
+	if err != nil {
+		logger.Job.Warning("enforce connection limits failed:", err)
+	}
+}
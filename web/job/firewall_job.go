@@ -0,0 +1,21 @@
+package job
+
+import (
+	"x-ui/logger"
+	"x-ui/web/service"
+)
+
+type FirewallJob struct {
+	firewallService service.FirewallService
+}
+
+func NewFirewallJob() *FirewallJob {
+	return new(FirewallJob)
+}
+
+func (j *FirewallJob) Run() {
+	_, err := j.firewallService.ApplyFirewall(false)
+	if err != nil {
+		logger.Job.Warning("apply firewall rules failed:", err)
+	}
+}
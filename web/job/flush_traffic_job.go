@@ -0,0 +1,31 @@
+package job
+
+import (
+	"context"
+	"x-ui/logger"
+	"x-ui/util/common"
+	"x-ui/web/service"
+)
+
+type FlushTrafficJob struct {
+	trafficBufferService service.TrafficBufferService
+}
+
+func NewFlushTrafficJob() *FlushTrafficJob {
+	return new(FlushTrafficJob)
+}
+
+func (j *FlushTrafficJob) Run() {
+	err := j.Execute(context.Background())
+	if err != nil {
+		logger.Job.Warning(err)
+	}
+}
+
+func (j *FlushTrafficJob) Execute(ctx context.Context) error {
+	err := j.trafficBufferService.Flush(ctx)
+	if err != nil {
+		return common.NewError("flush traffic failed:", err)
+	}
+	return nil
+}
@@ -0,0 +1,34 @@
+package job
+
+import (
+	"context"
+	"x-ui/logger"
+	"x-ui/util/common"
+	"x-ui/web/service"
+)
+
+type GeoUpdateJob struct {
+	ctx        context.Context
+	geoService service.GeoService
+}
+
+// NewGeoUpdateJob makes a job whose downloads stop when ctx, the context of the server, is cancelled
+func NewGeoUpdateJob(ctx context.Context) *GeoUpdateJob {
+	return &GeoUpdateJob{ctx: ctx}
+}
+
+func (j *GeoUpdateJob) Run() {
+	err := j.Execute(j.ctx)
+	if err != nil {
+		logger.Job.Warning(err)
+	}
+}
+
+// Execute downloads with the context of the server rather than ctx, so the downloads stop with the server
+func (j *GeoUpdateJob) Execute(ctx context.Context) error {
+	err := j.geoService.UpdateGeoFiles(j.ctx)
+	if err != nil {
+		return common.NewError("update geo files failed:", err)
+	}
+	return nil
+}
@@ -0,0 +1,15 @@
+package job
+
+import "x-ui/web/service"
+
+type LeaderElectionJob struct {
+	leaderService service.LeaderService
+}
+
+func NewLeaderElectionJob() *LeaderElectionJob {
+	return new(LeaderElectionJob)
+}
+
+func (j *LeaderElectionJob) Run() {
+	j.leaderService.Campaign()
+}
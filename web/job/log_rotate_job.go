@@ -0,0 +1,57 @@
+package job
+
+import (
+	"encoding/json"
+	"time"
+	"x-ui/logger"
+	"x-ui/util/logrotate"
+	"x-ui/web/service"
+	"x-ui/xray"
+)
+
+// LogRotateJob keeps the panel log file and the xray access and error logs below the configured size
+type LogRotateJob struct {
+	settingService service.SettingService
+}
+
+func NewLogRotateJob() *LogRotateJob {
+	return new(LogRotateJob)
+}
+
+func (j *LogRotateJob) Run() {
+	maxSize, err := j.settingService.GetLogMaxSize()
+	if err != nil {
+		logger.Job.Warning("get log max size failed:", err)
+		return
+	}
+	maxFiles, err := j.settingService.GetLogMaxFiles()
+	if err != nil {
+		logger.Job.Warning("get log max files failed:", err)
+		return
+	}
+	maxAge, err := j.settingService.GetLogMaxAge()
+	if err != nil {
+		logger.Job.Warning("get log max age failed:", err)
+		return
+	}
+
+	paths := []string{logger.GetFile()}
+	template, err := j.settingService.GetXrayConfigTemplate()
+	if err == nil {
+		xrayConfig := &xray.Config{}
+		if json.Unmarshal([]byte(template), xrayConfig) == nil {
+			paths = append(paths, xrayConfig.GetAccessLogPath(), xrayConfig.GetErrorLogPath())
+		}
+	}
+	for _, path := range paths {
+		if path == "" {
+			continue
+		}
+		rotated, err := logrotate.Rotate(path, int64(maxSize)*1024*1024, maxFiles, time.Hour*24*time.Duration(maxAge))
+		if err != nil {
+			logger.Job.Warning("rotate log", path, "failed:", err)
+		} else if rotated {
+			logger.Job.Info("rotated log", path)
+		}
+	}
+}
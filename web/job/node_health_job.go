@@ -0,0 +1,21 @@
+package job
+
+import (
+	"x-ui/logger"
+	"x-ui/web/service"
+)
+
+type NodeHealthJob struct {
+	nodeService service.NodeService
+}
+
+func NewNodeHealthJob() *NodeHealthJob {
+	return new(NodeHealthJob)
+}
+
+func (j *NodeHealthJob) Run() {
+	err := j.nodeService.CheckHealth()
+	if err != nil {
+		logger.Job.Warning("check node health failed:", err)
+	}
+}
@@ -0,0 +1,31 @@
+package job
+
+import (
+	"context"
+	"x-ui/logger"
+	"x-ui/util/common"
+	"x-ui/web/service"
+)
+
+type NodeTrafficJob struct {
+	nodeService service.NodeService
+}
+
+func NewNodeTrafficJob() *NodeTrafficJob {
+	return new(NodeTrafficJob)
+}
+
+func (j *NodeTrafficJob) Run() {
+	err := j.Execute(context.Background())
+	if err != nil {
+		logger.Job.Warning(err)
+	}
+}
+
+func (j *NodeTrafficJob) Execute(ctx context.Context) error {
+	err := j.nodeService.CollectTraffic(ctx)
+	if err != nil {
+		return common.NewError("collect node traffic failed:", err)
+	}
+	return nil
+}
@@ -0,0 +1,21 @@
+package job
+
+import (
+	"x-ui/logger"
+	"x-ui/web/service"
+)
+
+type OutboundLatencyJob struct {
+	outboundLatencyService service.OutboundLatencyService
+}
+
+func NewOutboundLatencyJob() *OutboundLatencyJob {
+	return new(OutboundLatencyJob)
+}
+
+func (j *OutboundLatencyJob) Run() {
+	err := j.outboundLatencyService.ProbeOutbounds()
+	if err != nil {
+		logger.Job.Warning("probe outbound latency failed:", err)
+	}
+}
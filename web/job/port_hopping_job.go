@@ -0,0 +1,21 @@
+package job
+
+import (
+	"x-ui/logger"
+	"x-ui/web/service"
+)
+
+type PortHoppingJob struct {
+	portHoppingService service.PortHoppingService
+}
+
+func NewPortHoppingJob() *PortHoppingJob {
+	return new(PortHoppingJob)
+}
+
+func (j *PortHoppingJob) Run() {
+	err := j.portHoppingService.ApplyPortHopping()
+	if err != nil {
+		logger.Job.Warning("apply port hopping failed:", err)
+	}
+}
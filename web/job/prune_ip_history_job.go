@@ -0,0 +1,34 @@
+package job
+
+import (
+	"context"
+	"x-ui/logger"
+	"x-ui/util/common"
+	"x-ui/web/service"
+)
+
+type PruneIpHistoryJob struct {
+	clientIpService service.ClientIpService
+}
+
+func NewPruneIpHistoryJob() *PruneIpHistoryJob {
+	return new(PruneIpHistoryJob)
+}
+
+func (j *PruneIpHistoryJob) Run() {
+	err := j.Execute(context.Background())
+	if err != nil {
+		logger.Job.Warning(err)
+	}
+}
+
+func (j *PruneIpHistoryJob) Execute(ctx context.Context) error {
+	count, err := j.clientIpService.PruneClientIpHistory(ctx)
+	if err != nil {
+		return common.NewError("prune client ip history failed:", err)
+	}
+	if count > 0 {
+		logger.Job.Debugf("pruned %v client ip records", count)
+	}
+	return nil
+}
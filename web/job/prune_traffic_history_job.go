@@ -0,0 +1,34 @@
+package job
+
+import (
+	"context"
+	"x-ui/logger"
+	"x-ui/util/common"
+	"x-ui/web/service"
+)
+
+type PruneTrafficHistoryJob struct {
+	trafficHistoryService service.TrafficHistoryService
+}
+
+func NewPruneTrafficHistoryJob() *PruneTrafficHistoryJob {
+	return new(PruneTrafficHistoryJob)
+}
+
+func (j *PruneTrafficHistoryJob) Run() {
+	err := j.Execute(context.Background())
+	if err != nil {
+		logger.Job.Warning(err)
+	}
+}
+
+func (j *PruneTrafficHistoryJob) Execute(ctx context.Context) error {
+	count, err := j.trafficHistoryService.PruneTrafficHistory(ctx)
+	if err != nil {
+		return common.NewError("prune traffic history failed:", err)
+	}
+	if count > 0 {
+		logger.Job.Debugf("pruned %v traffic history records", count)
+	}
+	return nil
+}
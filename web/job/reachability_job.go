@@ -0,0 +1,21 @@
+package job
+
+import (
+	"x-ui/logger"
+	"x-ui/web/service"
+)
+
+type ReachabilityJob struct {
+	reachabilityService service.ReachabilityService
+}
+
+func NewReachabilityJob() *ReachabilityJob {
+	return new(ReachabilityJob)
+}
+
+func (j *ReachabilityJob) Run() {
+	err := j.reachabilityService.CheckReachability()
+	if err != nil {
+		logger.Job.Warning("check reachability failed:", err)
+	}
+}
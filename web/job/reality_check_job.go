@@ -0,0 +1,21 @@
+package job
+
+import (
+	"x-ui/logger"
+	"x-ui/web/service"
+)
+
+type RealityCheckJob struct {
+	realityService service.RealityService
+}
+
+func NewRealityCheckJob() *RealityCheckJob {
+	return new(RealityCheckJob)
+}
+
+func (j *RealityCheckJob) Run() {
+	err := j.realityService.CheckRealityDests()
+	if err != nil {
+		logger.Job.Warning("check reality dests failed:", err)
+	}
+}
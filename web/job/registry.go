@@ -0,0 +1,146 @@
+package job
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+	"x-ui/logger"
+	"x-ui/util/common"
+	"x-ui/util/tracing"
+	"x-ui/web/service"
+
+	"github.com/robfig/cron/v3"
+	"go.uber.org/atomic"
+)
+
+// ErrorJob is implemented by jobs that can tell why a run failed, the run history records the error.
+// ctx carries the span of the run, the queries and calls made with it are part of its trace
+type ErrorJob interface {
+	Execute(ctx context.Context) error
+}
+
+// exclusiveJobs only work on the shared database or outside services, when panel instances coordinate
+// through redis each of their runs happens on one instance. Jobs of the local xray run on every instance
+var exclusiveJobs = map[string]bool{
+	"alert":               true,
+	"pruneIpHistory":      true,
+	"pruneTrafficHistory": true,
+	"replicaSync":         true,
+	"nodeTraffic":         true,
+	"nodeHealth":          true,
+	"billingReset":        true,
+	"certRenew":           true,
+	"tsdbExport":          true,
+	"statsNotify":         true,
+}
+
+// recordedJob runs a registered job and records each run in the job history
+type recordedJob struct {
+	name                string
+	job                 cron.Job
+	period              time.Duration
+	jobHistoryService   service.JobHistoryService
+	coordinationService service.CoordinationService
+	// running is set while a run of the job is in progress, runs do not overlap
+	running atomic.Bool
+}
+
+var registry = map[string]*recordedJob{}
+var registryLock sync.Mutex
+
+// Register names the job for the run history and manual triggers, the returned job is the one to schedule.
+// period is the time between its runs
+func Register(name string, j cron.Job, period time.Duration) cron.Job {
+	recorded := &recordedJob{name: name, job: j, period: period}
+	registryLock.Lock()
+	defer registryLock.Unlock()
+	registry[name] = recorded
+	return recorded
+}
+
+// Run is the scheduled run, it is skipped while the previous or a manual run is still in progress
+func (j *recordedJob) Run() {
+	if !j.running.CAS(false, true) {
+		logger.Job.Warning("job", j.name, "is still running, skipped a run")
+		return
+	}
+	defer j.running.Store(false)
+	j.run(false)
+}
+
+func (j *recordedJob) run(manual bool) {
+	// a standby instance only campaigns, the active one does the work
+	if !manual && service.IsStandby() && j.name != "leaderElection" {
+		return
+	}
+	// the lock is left to expire just before the next run, so an instance that fires a little
+	// later skips this run instead of repeating it
+	if !manual && exclusiveJobs[j.name] && !j.coordinationService.TryLock("job:"+j.name, j.period-time.Second) {
+		logger.Job.Debug("job", j.name, "runs on another panel instance")
+		return
+	}
+	ctx, span := tracing.Start(context.Background(), "job "+j.name, tracing.KindInternal)
+	span.SetAttribute("x-ui.job_manual", manual)
+	start := time.Now()
+	run := &service.JobRun{
+		Job:    j.name,
+		Start:  start.UnixMilli(),
+		Manual: manual,
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			run.Error = fmt.Sprint("panic: ", r)
+			logger.Job.Error("job", j.name, "panicked:", r)
+		}
+		run.Success = run.Error == ""
+		run.Duration = time.Since(start).Milliseconds()
+		j.jobHistoryService.Record(run)
+		if !run.Success {
+			span.SetError(errors.New(run.Error))
+		}
+		span.End(nil)
+	}()
+
+	if errorJob, ok := j.job.(ErrorJob); ok {
+		err := errorJob.Execute(ctx)
+		if err != nil {
+			run.Error = err.Error()
+			logger.Job.Warning(err)
+		}
+		return
+	}
+	j.job.Run()
+}
+
+// Trigger runs the registered job now, in the background, unless it is running already
+func Trigger(name string) error {
+	registryLock.Lock()
+	recorded, ok := registry[name]
+	registryLock.Unlock()
+	if !ok {
+		return common.NewError("job not found:", name)
+	}
+	if !recorded.running.CAS(false, true) {
+		return common.NewError("job is already running:", name)
+	}
+	go func() {
+		defer recorded.running.Store(false)
+		recorded.run(true)
+	}()
+	return nil
+}
+
+// GetNames returns the names of the registered jobs
+func GetNames() []string {
+	registryLock.Lock()
+	defer registryLock.Unlock()
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,31 @@
+package job
+
+import (
+	"context"
+	"x-ui/logger"
+	"x-ui/util/common"
+	"x-ui/web/service"
+)
+
+type ReplicaSyncJob struct {
+	replicaService service.ReplicaService
+}
+
+func NewReplicaSyncJob() *ReplicaSyncJob {
+	return new(ReplicaSyncJob)
+}
+
+func (j *ReplicaSyncJob) Run() {
+	err := j.Execute(context.Background())
+	if err != nil {
+		logger.Job.Warning(err)
+	}
+}
+
+func (j *ReplicaSyncJob) Execute(ctx context.Context) error {
+	err := j.replicaService.SyncAllReplicas(ctx)
+	if err != nil {
+		return common.NewError("sync replicated inbounds failed:", err)
+	}
+	return nil
+}
@@ -4,9 +4,16 @@ import (
 	"fmt"
 	"net"
 	"os"
+	"strconv"
+	"strings"
 	"time"
+	"x-ui/database/model"
 	"x-ui/logger"
+	"x-ui/util/botauth"
 	"x-ui/util/common"
+	"x-ui/util/geoip"
+	"x-ui/util/qrcode"
+	"x-ui/web/locale"
 	"x-ui/web/service"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
@@ -24,6 +31,11 @@ type StatsNotifyJob struct {
 	xrayService    service.XrayService
 	inboundService service.InboundServiceImpl
 	settingService service.SettingService
+	notifyService  service.NotifyService
+	voucherService service.VoucherService
+	trialService   service.TrialService
+	serverService  service.ServerService
+	planService    service.PlanService
 }
 
 func NewStatsNotifyJob() *StatsNotifyJob {
@@ -31,28 +43,10 @@ func NewStatsNotifyJob() *StatsNotifyJob {
 }
 
 func (j *StatsNotifyJob) SendMsgToTgbot(msg string) {
-	//Telegram bot basic info
-	tgBottoken, err := j.settingService.GetTgBotToken()
-	if err != nil || tgBottoken == "" {
-		logger.Warning("sendMsgToTgbot failed,GetTgBotToken fail:", err)
-		return
-	}
-	tgBotid, err := j.settingService.GetTgBotChatId()
+	err := j.notifyService.SendTelegram(msg)
 	if err != nil {
-		logger.Warning("sendMsgToTgbot failed,GetTgBotChatId fail:", err)
-		return
+		logger.Tgbot.Warning("sendMsgToTgbot failed:", err)
 	}
-
-	bot, err := tgbotapi.NewBotAPI(tgBottoken)
-	if err != nil {
-		fmt.Println("get tgbot error:", err)
-		return
-	}
-	bot.Debug = true
-	fmt.Printf("Authorized on account %s", bot.Self.UserName)
-	info := tgbotapi.NewMessage(int64(tgBotid), msg)
-	//msg.ReplyToMessageID = int(tgBotid)
-	bot.Send(info)
 }
 
 // Here run is a interface method of Job interface
@@ -67,7 +61,6 @@ func (j *StatsNotifyJob) Run() {
 		fmt.Println("get hostname error:", err)
 		return
 	}
-	info = fmt.Sprintf("Hostname:%s\r\n", name)
 	//get ip address
 	var ip string
 	netInterfaces, err := net.Interfaces()
@@ -93,22 +86,22 @@ func (j *StatsNotifyJob) Run() {
 			}
 		}
 	}
-	info += fmt.Sprintf("IP:%s\r\n \r\n", ip)
+	info = locale.I18n("tgbot.server", "Hostname", name, "IP", ip)
 
 	// get traffic
 	inbouds, err := j.inboundService.GetAllInbounds()
 	if err != nil {
-		logger.Warning("StatsNotifyJob run failed:", err)
+		logger.Tgbot.Warning("StatsNotifyJob run failed:", err)
 		return
 	}
 	// NOTE:If there no any sessions here,need to notify here
 	// TODO:Sub-node push, automatic conversion format
 	for _, inbound := range inbouds {
-		info += fmt.Sprintf("Node name:%s\r\nPort:%d\r\nUpload↑:%s\r\nDownload↓:%s\r\nTotal:%s\r\n", inbound.Remark, inbound.Port, common.FormatTraffic(inbound.Up), common.FormatTraffic(inbound.Down), common.FormatTraffic((inbound.Up + inbound.Down)))
+		info += locale.I18n("tgbot.inbound", "Remark", inbound.Remark, "Port", inbound.Port, "Up", common.FormatTraffic(inbound.Up), "Down", common.FormatTraffic(inbound.Down), "Total", common.FormatTraffic((inbound.Up + inbound.Down)))
 		if inbound.ExpiryTime == 0 {
-			info += fmt.Sprintf("Expire date:unlimited\r\n \r\n")
+			info += locale.I18n("tgbot.expireDate", "Expiry", locale.I18n("tgbot.unlimited"))
 		} else {
-			info += fmt.Sprintf("Expire date:%s\r\n \r\n", time.Unix((inbound.ExpiryTime/1000), 0).Format("2006-01-02 15:04:05"))
+			info += locale.I18n("tgbot.expireDate", "Expiry", time.Unix((inbound.ExpiryTime/1000), 0).Format("2006-01-02 15:04:05"))
 		}
 	}
 	j.SendMsgToTgbot(info)
@@ -116,7 +109,7 @@ func (j *StatsNotifyJob) Run() {
 
 func (j *StatsNotifyJob) UserLoginNotify(username string, ip string, time string, status LoginStatus) {
 	if username == "" || ip == "" || time == "" {
-		logger.Warning("UserLoginNotify failed,invalid info")
+		logger.Tgbot.Warning("UserLoginNotify failed,invalid info")
 		return
 	}
 	var msg string
@@ -127,26 +120,63 @@ func (j *StatsNotifyJob) UserLoginNotify(username string, ip string, time string
 		return
 	}
 	if status == LoginSuccess {
-		msg = fmt.Sprintf("Successfully logged-in to the panel\r\nHostname:%s\r\n", name)
+		msg = locale.I18n("tgbot.loginSuccess", "Hostname", name)
 	} else if status == LoginFail {
-		msg = fmt.Sprintf("Login to the panel was unsuccessful\r\nHostname:%s\r\n", name)
+		msg = locale.I18n("tgbot.loginFailed", "Hostname", name)
+	}
+	msg += locale.I18n("tgbot.loginInfo", "Time", time, "Username", username, "IP", ip)
+	if info := geoip.Lookup(ip).String(); info != "" {
+		msg += locale.I18n("tgbot.location", "Location", info)
 	}
-	msg += fmt.Sprintf("Time:%s\r\n", time)
-	msg += fmt.Sprintf("Username:%s\r\n", username)
-	msg += fmt.Sprintf("IP:%s\r\n", ip)
 	j.SendMsgToTgbot(msg)
+	if notify, _ := j.settingService.GetSmtpLoginNotify(); notify {
+		// the first line says whether the login succeeded, it is the subject of the mail
+		lines := strings.SplitN(msg, "\r\n", 2)
+		lines = append(lines, "")
+		go func() {
+			err := j.notifyService.SendEmail("", lines[0], lines[1])
+			if err != nil {
+				logger.Tgbot.Warning("send login email failed:", err)
+			}
+		}()
+	}
 }
 
-var numericKeyboard = tgbotapi.NewInlineKeyboardMarkup(
-	tgbotapi.NewInlineKeyboardRow(
-		tgbotapi.NewInlineKeyboardButtonData("Get Usage", "get_usage"),
-	),
-)
+// allowed tells whether the user may use the command in the chat, the admin chat may use every command and
+// other users the ones the tgBotUsers setting grants them
+func (j *StatsNotifyJob) allowed(user *tgbotapi.User, chatId int64, command string) bool {
+	adminChatId, err := j.settingService.GetTgBotChatId()
+	if err == nil && adminChatId != 0 && chatId == int64(adminChatId) {
+		return true
+	}
+	users, err := j.settingService.GetTgBotUsers()
+	if err != nil {
+		return false
+	}
+	permissions, err := botauth.Parse(users)
+	if err != nil {
+		logger.Tgbot.Warning("invalid bot users:", err)
+		permissions = botauth.Permissions{}
+	}
+	if user == nil {
+		return permissions.Allows(0, "", command)
+	}
+	return permissions.Allows(user.ID, user.UserName, command)
+}
+
+// numericKeyboard is built per reply, so the button follows the panel language
+func numericKeyboard() tgbotapi.InlineKeyboardMarkup {
+	return tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(locale.I18n("tgbot.getUsage"), "get_usage"),
+		),
+	)
+}
 
 func (j *StatsNotifyJob) OnReceive() *StatsNotifyJob {
 	tgBottoken, err := j.settingService.GetTgBotToken()
 	if err != nil || tgBottoken == "" {
-		logger.Warning("sendMsgToTgbot failed,GetTgBotToken fail:", err)
+		logger.Tgbot.Warning("sendMsgToTgbot failed,GetTgBotToken fail:", err)
 		return j
 	}
 	bot, err := tgbotapi.NewBotAPI(tgBottoken)
@@ -168,19 +198,21 @@ func (j *StatsNotifyJob) OnReceive() *StatsNotifyJob {
 				// a message with the data received.
 				callback := tgbotapi.NewCallback(update.CallbackQuery.ID, update.CallbackQuery.Data)
 				if _, err := bot.Request(callback); err != nil {
-					logger.Warning(err)
+					logger.Tgbot.Warning(err)
 				}
 
 				// And finally, send a message containing the data received.
 				msg := tgbotapi.NewMessage(update.CallbackQuery.Message.Chat.ID, "")
 
-				switch update.CallbackQuery.Data {
-				case "get_usage":
-					msg.Text = "for get your usage send command like this : \n <code>/usage uuid | id</code> \n example : <code>/usage fc3239ed-8f3b-4151-ff51-b183d5182142</code>"
+				switch data := update.CallbackQuery.Data; {
+				case data == "get_usage":
+					msg.Text = locale.I18n("tgbot.usageHelp")
 					msg.ParseMode = "HTML"
+				case strings.HasPrefix(data, "trial_"):
+					msg.Text = j.answerTrialRequest(bot, update.CallbackQuery)
 				}
 				if _, err := bot.Send(msg); err != nil {
-					logger.Warning(err)
+					logger.Tgbot.Warning(err)
 				}
 			}
 
@@ -195,54 +227,199 @@ func (j *StatsNotifyJob) OnReceive() *StatsNotifyJob {
 		// so we leave it empty.
 		msg := tgbotapi.NewMessage(update.Message.Chat.ID, "")
 
+		if !j.allowed(update.Message.From, update.Message.Chat.ID, update.Message.Command()) {
+			msg.Text = locale.I18n("tgbot.notAllowed")
+			if _, err := bot.Send(msg); err != nil {
+				logger.Tgbot.Warning(err)
+			}
+			continue
+		}
+
 		// Extract the command from the Message.
 		switch update.Message.Command() {
 		case "help":
-			msg.Text = "What you need?"
-			msg.ReplyMarkup = numericKeyboard
+			msg.Text = locale.I18n("tgbot.help")
+			msg.ReplyMarkup = numericKeyboard()
 		case "start":
-			msg.Text = "Hi :) \n What you need?"
-			msg.ReplyMarkup = numericKeyboard
+			msg.Text = locale.I18n("tgbot.start") + locale.I18n("tgbot.yourId", "Id", update.Message.Chat.ID)
+			msg.ReplyMarkup = numericKeyboard()
 
 		case "status":
-			msg.Text = "bot is ok."
+			msg.Text = locale.I18n("tgbot.status")
 
 		case "usage":
 			msg.Text = j.getClientUsage(update.Message.CommandArguments())
+
+		case "redeem":
+			msg.Text = j.redeemVoucher(update.Message.CommandArguments())
+
+		case "trial":
+			msg.Text = j.createTrial(update.Message.From, update.Message.Chat.ID)
+
+		case "addclient":
+			msg.Text = j.addClient(bot, update.Message.Chat.ID, update.Message.CommandArguments())
+
+		case "restart":
+			msg.Text = j.restartXray()
 		default:
-			msg.Text = "I don't know that command, /help"
-			msg.ReplyMarkup = numericKeyboard
+			msg.Text = locale.I18n("tgbot.unknownCommand")
+			msg.ReplyMarkup = numericKeyboard()
 
 		}
 
 		if _, err := bot.Send(msg); err != nil {
-			logger.Warning(err)
+			logger.Tgbot.Warning(err)
 		}
 	}
 	return j
 
 }
+
+// redeemVoucher answers /redeem <client id> <code>, the client id proves the sender owns the client
+func (j *StatsNotifyJob) redeemVoucher(args string) string {
+	fields := strings.Fields(args)
+	if len(fields) != 2 {
+		return locale.I18n("tgbot.redeemHelp")
+	}
+	traffic, err := j.inboundService.GetClientTrafficById(fields[0])
+	if err != nil || traffic == nil || traffic.Email == "" {
+		return locale.I18n("tgbot.clientNotFound")
+	}
+	voucher, err := j.voucherService.Redeem(traffic.Email, fields[1])
+	if err != nil {
+		logger.Tgbot.Warning("redeem voucher failed:", err)
+		return locale.I18n("tgbot.redeemFailed", "Error", err.Error())
+	}
+	return locale.I18n("tgbot.redeemed", "Code", voucher.Code, "Email", voucher.UsedBy,
+		"Traffic", common.FormatTraffic(voucher.Traffic), "Days", voucher.Days)
+}
+
+// createTrial answers /trial, each telegram user gets one trial per cooldown. With the trialApproval
+// setting the link is sent to chatId once an admin approved it
+func (j *StatsNotifyJob) createTrial(from *tgbotapi.User, chatId int64) string {
+	if from == nil {
+		return locale.I18n("tgbot.somethingWrong")
+	}
+	address := j.serverService.GetPreferredPublicIP()
+	account, request, err := j.trialService.RequestTrial(fmt.Sprintf("tg:%d", from.ID), address, chatId)
+	if err != nil {
+		logger.Tgbot.Info("trial for telegram user", from.ID, "refused:", err)
+		return locale.I18n("tgbot.trialFailed", "Error", err.Error())
+	}
+	if request != nil {
+		return locale.I18n("tgbot.trialPending")
+	}
+	return trialCreatedText(account)
+}
+
+func trialCreatedText(account *service.TrialAccount) string {
+	return locale.I18n("tgbot.trialCreated", "Email", account.Email, "Traffic", common.FormatTraffic(account.Total),
+		"Expiry", time.UnixMilli(account.ExpiryTime).Format("2006-01-02 15:04:05"), "Link", account.Link)
+}
+
+// answerTrialRequest handles the approve and deny buttons of a trial request and tells the requester in
+// telegram about the outcome
+func (j *StatsNotifyJob) answerTrialRequest(bot *tgbotapi.BotAPI, query *tgbotapi.CallbackQuery) string {
+	if !j.allowed(query.From, query.Message.Chat.ID, "approve") {
+		return locale.I18n("tgbot.notAllowed")
+	}
+	action, idString, _ := strings.Cut(query.Data, ":")
+	id, err := strconv.Atoi(idString)
+	if err != nil {
+		return locale.I18n("tgbot.somethingWrong")
+	}
+	var reply string
+	var request *model.TrialRequest
+	switch action {
+	case "trial_approve":
+		var account *service.TrialAccount
+		request, account, err = j.trialService.ApproveTrialRequest(id)
+		if err != nil {
+			return locale.I18n("tgbot.trialFailed", "Error", err.Error())
+		}
+		reply = trialCreatedText(account)
+	case "trial_deny":
+		request, err = j.trialService.DenyTrialRequest(id)
+		if err != nil {
+			return locale.I18n("tgbot.trialFailed", "Error", err.Error())
+		}
+		reply = locale.I18n("tgbot.trialDenied")
+	default:
+		return locale.I18n("tgbot.unknownCommand")
+	}
+	if request.ChatId != 0 {
+		if _, err := bot.Send(tgbotapi.NewMessage(request.ChatId, reply)); err != nil {
+			logger.Tgbot.Warning(err)
+		}
+	}
+	return locale.I18n("tgbot.trialAnswered", "Id", request.Id, "Source", request.Source, "Status", request.Status)
+}
+
+// addClient answers /addclient <plan> <email>, it creates the client on the plan and sends a qr code of
+// each of its links before the answer
+func (j *StatsNotifyJob) addClient(bot *tgbotapi.BotAPI, chatId int64, args string) string {
+	fields := strings.Fields(args)
+	if len(fields) != 2 {
+		return locale.I18n("tgbot.addClientHelp")
+	}
+	plan, err := j.planService.FindPlan(fields[0])
+	if err != nil {
+		return locale.I18n("tgbot.addClientFailed", "Error", err.Error())
+	}
+	inbound, err := j.planService.AddPlanClient(fields[1], plan.Id)
+	if err != nil {
+		logger.Tgbot.Warning("add client failed:", err)
+		return locale.I18n("tgbot.addClientFailed", "Error", err.Error())
+	}
+	links, err := service.GenLinks(inbound, fields[1], j.serverService.GetPreferredPublicIP())
+	if err != nil {
+		return locale.I18n("tgbot.addClientFailed", "Error", err.Error())
+	}
+	for _, link := range links {
+		image, err := qrcode.PNG(link, 8)
+		if err != nil {
+			logger.Tgbot.Warning("qr code of link failed:", err)
+			continue
+		}
+		photo := tgbotapi.NewPhoto(chatId, tgbotapi.FileBytes{Name: "qrcode.png", Bytes: image})
+		if _, err := bot.Send(photo); err != nil {
+			logger.Tgbot.Warning(err)
+		}
+	}
+	return locale.I18n("tgbot.clientAdded", "Email", fields[1], "Plan", plan.Name, "Links", strings.Join(links, "\r\n\r\n"))
+}
+
+// restartXray answers /restart
+func (j *StatsNotifyJob) restartXray() string {
+	err := j.xrayService.RestartXray(true)
+	if err != nil {
+		logger.Tgbot.Warning("restart xray failed:", err)
+		return locale.I18n("tgbot.restartFailed", "Error", err.Error())
+	}
+	return locale.I18n("tgbot.restarted")
+}
+
 func (j *StatsNotifyJob) getClientUsage(id string) string {
 	traffic, err := j.inboundService.GetClientTrafficById(id)
 	if err != nil {
-		logger.Warning(err)
-		return "something wrong!"
+		logger.Tgbot.Warning(err)
+		return locale.I18n("tgbot.somethingWrong")
 	}
 	expiryTime := ""
 	if traffic.ExpiryTime == 0 {
-		expiryTime = fmt.Sprintf("unlimited")
+		expiryTime = locale.I18n("tgbot.unlimited")
 	} else {
 		expiryTime = fmt.Sprintf("%s", time.Unix((traffic.ExpiryTime/1000), 0).Format("2006-01-02 15:04:05"))
 	}
 	total := ""
 	if traffic.Total == 0 {
-		total = fmt.Sprintf("unlimited")
+		total = locale.I18n("tgbot.unlimited")
 	} else {
 		total = fmt.Sprintf("%s", common.FormatTraffic((traffic.Total)))
 	}
-	output := fmt.Sprintf("💡 Active: %t\r\n📧 Email: %s\r\n🔼 Download↑: %s\r\n🔽 Upload↓: %s\r\n🔄 Total: %s / %s\r\n📅 Expire in: %s\r\n",
-		traffic.Enable, traffic.Email, common.FormatTraffic(traffic.Up), common.FormatTraffic(traffic.Down), common.FormatTraffic((traffic.Up + traffic.Down)),
-		total, expiryTime)
+	output := locale.I18n("tgbot.usage", "Active", traffic.Enable, "Email", traffic.Email,
+		"Up", common.FormatTraffic(traffic.Up), "Down", common.FormatTraffic(traffic.Down), "Used", common.FormatTraffic((traffic.Up + traffic.Down)),
+		"Total", total, "Expiry", expiryTime)
 
 	return output
 }
@@ -0,0 +1,21 @@
+package job
+
+import (
+	"x-ui/logger"
+	"x-ui/web/service"
+)
+
+type TorCheckJob struct {
+	torService service.TorService
+}
+
+func NewTorCheckJob() *TorCheckJob {
+	return new(TorCheckJob)
+}
+
+func (j *TorCheckJob) Run() {
+	err := j.torService.CheckTor()
+	if err != nil {
+		logger.Job.Warning("check tor failed:", err)
+	}
+}
@@ -0,0 +1,31 @@
+package job
+
+import (
+	"context"
+	"x-ui/logger"
+	"x-ui/util/common"
+	"x-ui/web/service"
+)
+
+type TsdbExportJob struct {
+	tsdbExportService service.TsdbExportService
+}
+
+func NewTsdbExportJob() *TsdbExportJob {
+	return new(TsdbExportJob)
+}
+
+func (j *TsdbExportJob) Run() {
+	err := j.Execute(context.Background())
+	if err != nil {
+		logger.Job.Warning(err)
+	}
+}
+
+func (j *TsdbExportJob) Execute(ctx context.Context) error {
+	err := j.tsdbExportService.Export(ctx)
+	if err != nil {
+		return common.NewError("export to time-series database failed:", err)
+	}
+	return nil
+}
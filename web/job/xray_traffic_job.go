@@ -1,13 +1,22 @@
 package job
 
 import (
+	"context"
+	"time"
 	"x-ui/logger"
+	"x-ui/util/common"
 	"x-ui/web/service"
+	"x-ui/xray"
 )
 
 type XrayTrafficJob struct {
-	xrayService    service.XrayService
-	inboundService service.InboundServiceImpl
+	xrayService          service.XrayService
+	inboundService       service.InboundServiceImpl
+	onlineService        service.OnlineService
+	trafficBufferService service.TrafficBufferService
+	trafficStreamService service.TrafficStreamService
+
+	lastRunTime time.Time
 }
 
 func NewXrayTrafficJob() *XrayTrafficJob {
@@ -15,23 +24,67 @@ func NewXrayTrafficJob() *XrayTrafficJob {
 }
 
 func (j *XrayTrafficJob) Run() {
+	err := j.Execute(context.Background())
+	if err != nil {
+		logger.Job.Warning(err)
+	}
+}
+
+func (j *XrayTrafficJob) Execute(ctx context.Context) error {
 	if !j.xrayService.IsXrayRunning() {
-		return
+		return nil
 	}
 
-	traffics, clientTraffics, err := j.xrayService.GetXrayTraffic()
+	traffics, clientTraffics, err := j.xrayService.GetXrayTraffic(ctx)
 	if err != nil {
-		logger.Warning("get xray traffic failed:", err)
-		return
+		return common.NewError("get xray traffic failed:", err)
 	}
-	err = j.inboundService.AddTraffic(traffics)
-	if err != nil {
-		logger.Warning("add traffic failed:", err)
+	// written to the database by FlushTrafficJob
+	j.trafficBufferService.Add(traffics, clientTraffics)
+
+	// clients that moved any traffic since the last run are considered online
+	onlineClients := make([]string, 0)
+	for _, traffic := range clientTraffics {
+		if traffic.Up+traffic.Down > 0 {
+			onlineClients = append(onlineClients, traffic.Email)
+		}
 	}
+	j.onlineService.MarkActive(onlineClients)
 
-	err = j.inboundService.AddClientTraffic(clientTraffics)
-	if err != nil {
-		logger.Warning("add client traffic failed:", err)
+	now := time.Now()
+	if !j.lastRunTime.IsZero() && j.trafficStreamService.HasSubscribers() {
+		j.publishTraffic(traffics, now.Sub(j.lastRunTime))
 	}
+	j.lastRunTime = now
+	return nil
+}
 
+func (j *XrayTrafficJob) publishTraffic(traffics []*xray.Traffic, interval time.Duration) {
+	inbounds, err := j.inboundService.GetAllInboundTraffics()
+	if err != nil {
+		logger.Job.Warning("get inbounds for traffic stream failed:", err)
+		return
+	}
+	seconds := interval.Seconds()
+	snapshot := &service.TrafficSnapshot{
+		Time:     time.Now().Unix(),
+		Inbounds: make([]*service.InboundTraffic, 0, len(inbounds)),
+	}
+	for _, inbound := range inbounds {
+		inboundTraffic := &service.InboundTraffic{
+			Tag:  inbound.Tag,
+			Up:   inbound.Up,
+			Down: inbound.Down,
+		}
+		for _, traffic := range traffics {
+			if traffic.IsInbound && traffic.Tag == inbound.Tag {
+				inboundTraffic.UpSpeed = int64(float64(traffic.Up) / seconds)
+				inboundTraffic.DownSpeed = int64(float64(traffic.Down) / seconds)
+			}
+		}
+		snapshot.Up += inbound.Up
+		snapshot.Down += inbound.Down
+		snapshot.Inbounds = append(snapshot.Inbounds, inboundTraffic)
+	}
+	j.trafficStreamService.Publish(snapshot)
 }
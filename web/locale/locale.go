@@ -0,0 +1,87 @@
+// Package locale holds the translation catalogs embedded in the panel, for the web UI as well as
+// messages produced outside of a request such as bot replies and notifications
+package locale
+
+import (
+	"embed"
+	"io/fs"
+	"sync"
+
+	"github.com/nicksnyder/go-i18n/v2/i18n"
+	"github.com/pelletier/go-toml/v2"
+	"golang.org/x/text/language"
+)
+
+var (
+	bundle    *i18n.Bundle
+	lock      sync.RWMutex
+	panelLang = "en-US"
+)
+
+// InitLocalizer loads the toml catalogs under the translation directory of i18nFS
+func InitLocalizer(i18nFS embed.FS) error {
+	b := i18n.NewBundle(language.SimplifiedChinese)
+	b.RegisterUnmarshalFunc("toml", toml.Unmarshal)
+	err := fs.WalkDir(i18nFS, "translation", func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		data, err := i18nFS.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		_, err = b.ParseMessageFileBytes(data, path)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	bundle = b
+	return nil
+}
+
+// SetLanguage sets the panel language, used when a request does not ask for a supported one
+func SetLanguage(lang string) {
+	lock.Lock()
+	defer lock.Unlock()
+	panelLang = lang
+}
+
+func GetLanguage() string {
+	lock.RLock()
+	defer lock.RUnlock()
+	return panelLang
+}
+
+// NewLocalizer prefers langs, e.g. a cookie or Accept-Language, over the panel language
+func NewLocalizer(langs ...string) *i18n.Localizer {
+	return i18n.NewLocalizer(bundle, append(langs, GetLanguage())...)
+}
+
+// Localize translates key, params are pairs of template names and values
+func Localize(localizer *i18n.Localizer, key string, params ...interface{}) (string, error) {
+	templateData := map[string]interface{}{}
+	for i := 0; i+1 < len(params); i += 2 {
+		name, _ := params[i].(string)
+		templateData[name] = params[i+1]
+	}
+	return localizer.Localize(&i18n.LocalizeConfig{
+		MessageID:    key,
+		TemplateData: templateData,
+	})
+}
+
+// I18n translates key in the panel language, a missing translation gives the key itself
+func I18n(key string, params ...interface{}) string {
+	if bundle == nil {
+		return key
+	}
+	message, err := Localize(NewLocalizer(), key, params...)
+	if err != nil {
+		return key
+	}
+	return message
+}
@@ -0,0 +1,274 @@
+package service
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+	"x-ui/database"
+	"x-ui/database/model"
+	"x-ui/logger"
+	"x-ui/util/common"
+	"x-ui/util/dnsapi"
+
+	"golang.org/x/crypto/acme"
+)
+
+// managed certificates are renewed once they expire within this time
+const acmeRenewBefore = time.Hour * 24 * 30
+
+// an issuance waits this long for the challenge records to show up in public dns before the CA checks them
+const acmePropagationTimeout = time.Minute * 2
+
+// issuances run one at a time, the dns records of two orders for the same name would get in each other's way
+var acmeLock sync.Mutex
+
+// CertificateApply lists the inbounds that use a certificate
+type CertificateApply struct {
+	InboundIds []int `json:"inboundIds" form:"inboundIds"`
+}
+
+// CertificateIssue asks for a certificate of the comma separated domains, Id renews a stored one
+type CertificateIssue struct {
+	Id      int    `json:"id" form:"id"`
+	Name    string `json:"name" form:"name"`
+	Domains string `json:"domains" form:"domains"`
+}
+
+// AcmeService issues certificates with ACME dns-01 challenges, so that a domain whose ports 80 and 443
+// belong to xray inbounds can still get one
+type AcmeService struct {
+	settingService     SettingService
+	certificateService CertificateService
+}
+
+// getAccountKey returns the key of the ACME account, made and stored on the first call
+func (s *AcmeService) getAccountKey() (crypto.Signer, error) {
+	value, err := s.settingService.GetAcmeAccountKey()
+	if err != nil {
+		return nil, err
+	}
+	if value != "" {
+		block, _ := pem.Decode([]byte(value))
+		if block == nil {
+			return nil, common.NewError("acme account key is not PEM")
+		}
+		return x509.ParseECPrivateKey(block.Bytes)
+	}
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	err = s.settingService.SetAcmeAccountKey(string(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der})))
+	if err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+func (s *AcmeService) getClient(ctx context.Context) (*acme.Client, error) {
+	key, err := s.getAccountKey()
+	if err != nil {
+		return nil, err
+	}
+	directory, err := s.settingService.GetAcmeDirectory()
+	if err != nil {
+		return nil, err
+	}
+	email, err := s.settingService.GetAcmeEmail()
+	if err != nil {
+		return nil, err
+	}
+	client := &acme.Client{Key: key, DirectoryURL: directory}
+	account := &acme.Account{}
+	if email != "" {
+		account.Contact = []string{"mailto:" + email}
+	}
+	_, err = client.Register(ctx, account, acme.AcceptTOS)
+	if err != nil && !errors.Is(err, acme.ErrAccountAlreadyExists) {
+		return nil, err
+	}
+	return client, nil
+}
+
+func (s *AcmeService) getProvider() (dnsapi.Provider, error) {
+	name, err := s.settingService.GetAcmeDnsProvider()
+	if err != nil {
+		return nil, err
+	}
+	if name == "" {
+		return nil, common.NewError("no dns provider is set up for acme")
+	}
+	credentials, err := s.settingService.GetAcmeDnsCredentials()
+	if err != nil {
+		return nil, err
+	}
+	return dnsapi.New(name, credentials)
+}
+
+// authorize solves the dns-01 challenge of one authorization, the record is removed again afterwards
+func (s *AcmeService) authorize(ctx context.Context, client *acme.Client, provider dnsapi.Provider, authzURL string) error {
+	authz, err := client.GetAuthorization(ctx, authzURL)
+	if err != nil {
+		return err
+	}
+	if authz.Status == acme.StatusValid {
+		return nil
+	}
+	var challenge *acme.Challenge
+	for _, c := range authz.Challenges {
+		if c.Type == "dns-01" {
+			challenge = c
+		}
+	}
+	if challenge == nil {
+		return common.NewError("the CA offers no dns-01 challenge for", authz.Identifier.Value)
+	}
+	value, err := client.DNS01ChallengeRecord(challenge.Token)
+	if err != nil {
+		return err
+	}
+	// a wildcard is proven at the name it covers
+	fqdn := "_acme-challenge." + strings.TrimPrefix(authz.Identifier.Value, "*.")
+	err = provider.Present(fqdn, value)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := provider.CleanUp(fqdn, value); err != nil {
+			logger.Warningf("remove acme record %v failed: %v", fqdn, err)
+		}
+	}()
+	if !dnsapi.WaitForRecord(fqdn, value, acmePropagationTimeout) {
+		logger.Warningf("acme record %v not seen in public dns yet, asking the CA anyway", fqdn)
+	}
+	_, err = client.Accept(ctx, challenge)
+	if err != nil {
+		return err
+	}
+	_, err = client.WaitAuthorization(ctx, authz.URI)
+	return err
+}
+
+// IssueCertificate gets a certificate for the domains and stores it as a managed certificate, under the id
+// of an existing one to renew it or as a new one named name if id is 0
+func (s *AcmeService) IssueCertificate(id int, name string, domains []string) (*model.Certificate, error) {
+	acmeLock.Lock()
+	defer acmeLock.Unlock()
+
+	cleaned := make([]string, 0, len(domains))
+	for _, domain := range domains {
+		if domain = strings.ToLower(strings.TrimSpace(domain)); domain != "" {
+			cleaned = append(cleaned, domain)
+		}
+	}
+	if len(cleaned) == 0 {
+		return nil, common.NewError("no domains to issue a certificate for")
+	}
+	provider, err := s.getProvider()
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute*10)
+	defer cancel()
+	client, err := s.getClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+	order, err := client.AuthorizeOrder(ctx, acme.DomainIDs(cleaned...))
+	if err != nil {
+		return nil, err
+	}
+	for _, authzURL := range order.AuthzURLs {
+		err = s.authorize(ctx, client, provider, authzURL)
+		if err != nil {
+			return nil, err
+		}
+	}
+	order, err = client.WaitOrder(ctx, order.URI)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	csr, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject:  pkix.Name{CommonName: cleaned[0]},
+		DNSNames: cleaned,
+	}, key)
+	if err != nil {
+		return nil, err
+	}
+	chain, _, err := client.CreateOrderCert(ctx, order.FinalizeURL, csr, true)
+	if err != nil {
+		return nil, err
+	}
+	certPEM := make([]byte, 0)
+	for _, der := range chain {
+		certPEM = append(certPEM, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})...)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	cert := &model.Certificate{
+		Id:      id,
+		Name:    name,
+		Cert:    string(certPEM),
+		Key:     string(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})),
+		Managed: true,
+	}
+	if id > 0 {
+		old, err := s.certificateService.GetCertificate(id)
+		if err != nil {
+			return nil, err
+		}
+		if cert.Name == "" {
+			cert.Name = old.Name
+		}
+		return s.certificateService.UpdateCertificate(cert)
+	}
+	if cert.Name == "" {
+		cert.Name = cleaned[0]
+	}
+	return s.certificateService.AddCertificate(cert)
+}
+
+// RenewCertificates issues the managed certificates that expire soon again and returns those that were renewed,
+// one failing does not keep the others from renewing
+func (s *AcmeService) RenewCertificates() ([]*model.Certificate, error) {
+	db := database.GetDB()
+	var certs []*model.Certificate
+	deadline := time.Now().Add(acmeRenewBefore).UnixMilli()
+	err := db.Model(model.Certificate{}).Where("managed = ? and expiry_time < ?", true, deadline).Find(&certs).Error
+	if err != nil {
+		return nil, err
+	}
+	renewed := make([]*model.Certificate, 0, len(certs))
+	errs := make([]error, 0)
+	for _, cert := range certs {
+		issued, err := s.IssueCertificate(cert.Id, cert.Name, strings.Split(cert.Domains, ","))
+		if err != nil {
+			errs = append(errs, common.NewErrorf("renew certificate %v: %v", cert.Name, err))
+			continue
+		}
+		renewed = append(renewed, issued)
+	}
+	return renewed, common.Combine(errs...)
+}
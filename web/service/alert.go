@@ -0,0 +1,325 @@
+package service
+
+import (
+	"fmt"
+	"net/mail"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+	"x-ui/database"
+	"x-ui/database/model"
+	"x-ui/logger"
+	"x-ui/util/common"
+	"x-ui/web/locale"
+)
+
+const (
+	AlertMetricCpu            = "cpu"
+	AlertMetricMem            = "mem"
+	AlertMetricDisk           = "disk"
+	AlertMetricXrayDown       = "xray_down"
+	AlertMetricInboundTraffic = "inbound_traffic"
+	AlertMetricInboundExpiry  = "inbound_expiry"
+	AlertMetricClientTraffic  = "client_traffic"
+	AlertMetricClientExpiry   = "client_expiry"
+	AlertMetricNodeDown       = "node_down"
+	AlertMetricRealityDest    = "reality_dest"
+	AlertMetricDbWrite        = "db_write_failures"
+)
+
+var alertMetrics = []string{
+	AlertMetricCpu,
+	AlertMetricMem,
+	AlertMetricDisk,
+	AlertMetricXrayDown,
+	AlertMetricInboundTraffic,
+	AlertMetricInboundExpiry,
+	AlertMetricClientTraffic,
+	AlertMetricClientExpiry,
+	AlertMetricNodeDown,
+	AlertMetricRealityDest,
+	AlertMetricDbWrite,
+}
+
+var alertComparators = []string{">", ">=", "<", "<=", "=="}
+
+// alertSample is a metric value of one subject, e.g. the traffic usage of one client
+type alertSample struct {
+	subject string
+	value   float64
+}
+
+type alertState struct {
+	since time.Time
+	fired bool
+}
+
+var alertStates = map[string]*alertState{}
+var alertLock sync.Mutex
+
+type AlertService struct {
+	serverService  ServerService
+	xrayService    XrayService
+	inboundService InboundServiceImpl
+	nodeService    NodeService
+	notifyService  NotifyService
+}
+
+func (s *AlertService) GetAlertRules() ([]*model.AlertRule, error) {
+	db := database.GetDB()
+	var rules []*model.AlertRule
+	err := db.Model(model.AlertRule{}).Find(&rules).Error
+	if err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
+
+func (s *AlertService) checkAlertRule(rule *model.AlertRule) error {
+	if !common.IsSubString(rule.Metric, append([]string{}, alertMetrics...)) {
+		return common.NewError("unknown alert metric:", rule.Metric)
+	}
+	if !common.IsSubString(rule.Comparator, append([]string{}, alertComparators...)) {
+		return common.NewError("unknown alert comparator:", rule.Comparator)
+	}
+	if rule.Duration < 0 {
+		return common.NewError("alert duration can not be negative:", rule.Duration)
+	}
+	switch rule.Destination {
+	case NotifyTelegram:
+	case NotifyWebhook, NotifyDiscord, NotifySlack:
+		u, err := url.Parse(rule.Target)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			return common.NewError("webhook target is not a valid url:", rule.Target)
+		}
+	case NotifyEmail:
+		// an empty target mails the recipients of the smtp settings
+		if rule.Target != "" {
+			if _, err := mail.ParseAddressList(rule.Target); err != nil {
+				return common.NewError("email target is not a valid address list:", rule.Target)
+			}
+		}
+	default:
+		return common.NewError("unknown alert destination:", rule.Destination)
+	}
+	return nil
+}
+
+func (s *AlertService) AddAlertRule(rule *model.AlertRule) (*model.AlertRule, error) {
+	if err := s.checkAlertRule(rule); err != nil {
+		return rule, err
+	}
+	db := database.GetDB()
+	return rule, db.Create(rule).Error
+}
+
+func (s *AlertService) UpdateAlertRule(rule *model.AlertRule) (*model.AlertRule, error) {
+	if err := s.checkAlertRule(rule); err != nil {
+		return rule, err
+	}
+	db := database.GetDB()
+	err := db.Save(rule).Error
+	if err == nil {
+		s.resetAlertState(rule.Id)
+	}
+	return rule, err
+}
+
+func (s *AlertService) DelAlertRule(id int) error {
+	db := database.GetDB()
+	err := db.Delete(model.AlertRule{}, id).Error
+	if err == nil {
+		s.resetAlertState(id)
+	}
+	return err
+}
+
+func (s *AlertService) resetAlertState(ruleId int) {
+	alertLock.Lock()
+	defer alertLock.Unlock()
+	prefix := fmt.Sprintf("%d/", ruleId)
+	for key := range alertStates {
+		if strings.HasPrefix(key, prefix) {
+			delete(alertStates, key)
+		}
+	}
+}
+
+func compare(value float64, comparator string, threshold float64) bool {
+	switch comparator {
+	case ">":
+		return value > threshold
+	case ">=":
+		return value >= threshold
+	case "<":
+		return value < threshold
+	case "<=":
+		return value <= threshold
+	case "==":
+		return value == threshold
+	}
+	return false
+}
+
+func percent(current uint64, total uint64) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(current) * 100 / float64(total)
+}
+
+// hoursLeft converts an expiry time in milliseconds to the hours remaining until it
+func hoursLeft(expiryTime int64, now time.Time) float64 {
+	return float64(expiryTime-now.UnixMilli()) / float64(time.Hour/time.Millisecond)
+}
+
+func (s *AlertService) collect(metric string, status *Status) ([]alertSample, error) {
+	now := time.Now()
+	switch metric {
+	case AlertMetricCpu:
+		return []alertSample{{subject: "cpu", value: status.Cpu}}, nil
+	case AlertMetricMem:
+		return []alertSample{{subject: "mem", value: percent(status.Mem.Current, status.Mem.Total)}}, nil
+	case AlertMetricDisk:
+		return []alertSample{{subject: "disk", value: percent(status.Disk.Current, status.Disk.Total)}}, nil
+	case AlertMetricXrayDown:
+		value := 0.0
+		if !s.xrayService.IsXrayRunning() {
+			value = 1
+		}
+		return []alertSample{{subject: "xray", value: value}}, nil
+	case AlertMetricNodeDown:
+		nodes, err := s.nodeService.GetNodes()
+		if err != nil {
+			return nil, err
+		}
+		samples := make([]alertSample, 0, len(nodes))
+		for _, node := range nodes {
+			// nodes that were never checked yet are not reported as down
+			if !node.Enable || node.LastCheck == 0 {
+				continue
+			}
+			value := 0.0
+			if !node.Online {
+				value = 1
+			}
+			samples = append(samples, alertSample{subject: node.Name, value: value})
+		}
+		return samples, nil
+	case AlertMetricRealityDest:
+		return realityDestSamples(), nil
+	case AlertMetricDbWrite:
+		return dbWriteSamples(), nil
+	}
+
+	inbounds, err := s.inboundService.GetAllInboundTraffics()
+	if err != nil {
+		return nil, err
+	}
+	samples := make([]alertSample, 0)
+	for _, inbound := range inbounds {
+		switch metric {
+		case AlertMetricInboundTraffic:
+			if inbound.Enable && inbound.Total > 0 {
+				samples = append(samples, alertSample{
+					subject: inbound.Tag,
+					value:   percent(uint64(inbound.Up+inbound.Down), uint64(inbound.Total)),
+				})
+			}
+		case AlertMetricInboundExpiry:
+			if inbound.Enable && inbound.ExpiryTime > 0 {
+				samples = append(samples, alertSample{subject: inbound.Tag, value: hoursLeft(inbound.ExpiryTime, now)})
+			}
+		case AlertMetricClientTraffic:
+			for _, stat := range inbound.ClientStats {
+				if stat.Enable && stat.Total > 0 {
+					samples = append(samples, alertSample{
+						subject: stat.Email,
+						value:   percent(uint64(stat.Up+stat.Down), uint64(stat.Total)),
+					})
+				}
+			}
+		case AlertMetricClientExpiry:
+			for _, stat := range inbound.ClientStats {
+				if stat.Enable && stat.ExpiryTime > 0 {
+					samples = append(samples, alertSample{subject: stat.Email, value: hoursLeft(stat.ExpiryTime, now)})
+				}
+			}
+		}
+	}
+	return samples, nil
+}
+
+// notifyAlertClient forwards alerts about the traffic or expiry of a client to the telegram user of the client
+func (s *AlertService) notifyAlertClient(metric string, sample alertSample) {
+	switch metric {
+	case AlertMetricClientTraffic:
+		s.inboundService.NotifyClient(sample.subject, locale.I18n("tgbot.clientTrafficAlert",
+			"Email", sample.subject, "Percent", fmt.Sprintf("%.0f", sample.value)))
+	case AlertMetricClientExpiry:
+		s.inboundService.NotifyClient(sample.subject, locale.I18n("tgbot.clientExpiryAlert",
+			"Email", sample.subject, "Hours", fmt.Sprintf("%.0f", sample.value)))
+	}
+}
+
+// EvaluateAlertRules checks every enabled rule once and notifies about conditions that held long enough
+func (s *AlertService) EvaluateAlertRules() error {
+	rules, err := s.GetAlertRules()
+	if err != nil {
+		return err
+	}
+	if len(rules) == 0 {
+		return nil
+	}
+
+	status := s.serverService.GetStatus(nil)
+	now := time.Now()
+
+	alertLock.Lock()
+	defer alertLock.Unlock()
+
+	active := map[string]bool{}
+	for _, rule := range rules {
+		if !rule.Enable {
+			continue
+		}
+		samples, err := s.collect(rule.Metric, status)
+		if err != nil {
+			logger.Warning("collect alert metric failed:", rule.Metric, err)
+			continue
+		}
+		for _, sample := range samples {
+			if !compare(sample.value, rule.Comparator, rule.Threshold) {
+				continue
+			}
+			key := fmt.Sprintf("%d/%s", rule.Id, sample.subject)
+			active[key] = true
+			state, ok := alertStates[key]
+			if !ok {
+				state = &alertState{since: now}
+				alertStates[key] = state
+			}
+			if state.fired || now.Sub(state.since) < time.Duration(rule.Duration)*time.Second {
+				continue
+			}
+			subject := locale.I18n("notify.alertSubject", "Name", rule.Name)
+			msg := fmt.Sprintf("%s: %s = %.2f (%s %v)", sample.subject, rule.Metric, sample.value, rule.Comparator, rule.Threshold)
+			err := s.notifyService.Send(rule.Destination, rule.Target, subject, msg)
+			if err != nil {
+				logger.Warning("send alert failed:", rule.Name, err)
+				continue
+			}
+			state.fired = true
+			s.notifyAlertClient(rule.Metric, sample)
+		}
+	}
+
+	// conditions that no longer hold are resolved and may fire again later
+	for key := range alertStates {
+		if !active[key] {
+			delete(alertStates, key)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,126 @@
+package service
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+	"strings"
+	"time"
+	"x-ui/database"
+	"x-ui/database/model"
+	"x-ui/logger"
+	"x-ui/util/common"
+	"x-ui/util/random"
+
+	"gorm.io/gorm"
+)
+
+const (
+	// admins may call every api route
+	TokenRoleAdmin = "admin"
+	// operators read everything and manage inbounds and clients
+	TokenRoleOperator = "operator"
+	// viewers only read, like viewer logins
+	TokenRoleViewer = "viewer"
+)
+
+// tokens start with this so that they are recognizable in configs and secret scanners
+const apiTokenPrefix = "xui_"
+
+type ApiTokenService struct {
+}
+
+func hashApiToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// ParseTokenExpiry parses a lifetime like 90d, 12h or 30m, empty and 0 never expire
+func ParseTokenExpiry(s string) (time.Duration, error) {
+	s = strings.TrimSpace(s)
+	if s == "" || s == "0" {
+		return 0, nil
+	}
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil || n < 1 {
+			return 0, common.NewError("expiry must look like 90d, 12h or 30m:", s)
+		}
+		return time.Hour * 24 * time.Duration(n), nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d <= 0 {
+		return 0, common.NewError("expiry must look like 90d, 12h or 30m:", s)
+	}
+	return d, nil
+}
+
+func (s *ApiTokenService) GetTokens() ([]*model.ApiToken, error) {
+	db := database.GetDB()
+	var tokens []*model.ApiToken
+	err := db.Model(model.ApiToken{}).Order("id").Find(&tokens).Error
+	if err != nil {
+		return nil, err
+	}
+	return tokens, nil
+}
+
+// CreateToken mints a token with the role that expires after lifetime, 0 never. The token itself is
+// only returned here, the database keeps its hash
+func (s *ApiTokenService) CreateToken(name string, role string, lifetime time.Duration) (string, *model.ApiToken, error) {
+	switch role {
+	case TokenRoleAdmin, TokenRoleOperator, TokenRoleViewer:
+	default:
+		return "", nil, common.NewError("role must be admin, operator or viewer:", role)
+	}
+	token := apiTokenPrefix + random.SecureSeq(32)
+	now := time.Now()
+	apiToken := &model.ApiToken{
+		Name:       strings.TrimSpace(name),
+		Role:       role,
+		Hash:       hashApiToken(token),
+		Prefix:     token[:len(apiTokenPrefix)+4],
+		CreateTime: now.UnixMilli(),
+	}
+	if lifetime > 0 {
+		apiToken.ExpiryTime = now.Add(lifetime).UnixMilli()
+	}
+	err := database.GetDB().Create(apiToken).Error
+	if err != nil {
+		return "", nil, err
+	}
+	return token, apiToken, nil
+}
+
+func (s *ApiTokenService) DelToken(id int) error {
+	result := database.GetDB().Delete(model.ApiToken{}, id)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return common.NewError("token not found:", id)
+	}
+	return nil
+}
+
+// CheckToken returns the stored token for a bearer token, nil if it is unknown or expired
+func (s *ApiTokenService) CheckToken(token string) *model.ApiToken {
+	if !strings.HasPrefix(token, apiTokenPrefix) {
+		return nil
+	}
+	db := database.GetDB()
+	apiToken := &model.ApiToken{}
+	err := db.Model(model.ApiToken{}).Where("hash = ?", hashApiToken(token)).First(apiToken).Error
+	if err != nil {
+		if err != gorm.ErrRecordNotFound {
+			logger.Warning("check api token failed:", err)
+		}
+		return nil
+	}
+	now := time.Now().UnixMilli()
+	if apiToken.ExpiryTime > 0 && apiToken.ExpiryTime <= now {
+		return nil
+	}
+	db.Model(model.ApiToken{}).Where("id = ?", apiToken.Id).Update("last_used", now)
+	return apiToken
+}
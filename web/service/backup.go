@@ -0,0 +1,185 @@
+package service
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+	"x-ui/config"
+	"x-ui/database"
+	"x-ui/util/common"
+	"x-ui/util/random"
+)
+
+const backupPrefix = "x-ui-"
+const backupSuffix = ".db"
+
+type BackupFile struct {
+	Name string    `json:"name"`
+	Size int64     `json:"size"`
+	Time time.Time `json:"time"`
+}
+
+type BackupService struct {
+}
+
+func (s *BackupService) GetBackupDir() string {
+	return filepath.Join(filepath.Dir(config.GetDBPath()), "backup")
+}
+
+// backupPath resolves a backup name inside the backup dir, refusing anything that points elsewhere
+func (s *BackupService) backupPath(name string) (string, error) {
+	if name != filepath.Base(name) || !strings.HasPrefix(name, backupPrefix) || !strings.HasSuffix(name, backupSuffix) {
+		return "", common.NewError("invalid backup name:", name)
+	}
+	return filepath.Join(s.GetBackupDir(), name), nil
+}
+
+func (s *BackupService) CreateBackup(ctx context.Context) (*BackupFile, error) {
+	dir := s.GetBackupDir()
+	err := os.MkdirAll(dir, 0700)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	// backups of the same second, e.g. a scheduled and a manual one, get names of their own
+	name := backupPrefix + now.Format("20060102-150405") + "-" + strings.ToLower(random.SecureSeq(6)) + backupSuffix
+	path := filepath.Join(dir, name)
+	err = database.Backup(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	return &BackupFile{Name: name, Size: info.Size(), Time: now}, nil
+}
+
+// GetBackups lists the backups, newest first
+func (s *BackupService) GetBackups() ([]*BackupFile, error) {
+	entries, err := os.ReadDir(s.GetBackupDir())
+	if os.IsNotExist(err) {
+		return []*BackupFile{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+	backups := make([]*BackupFile, 0, len(entries))
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasPrefix(name, backupPrefix) || !strings.HasSuffix(name, backupSuffix) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		backups = append(backups, &BackupFile{Name: name, Size: info.Size(), Time: info.ModTime()})
+	}
+	sort.Slice(backups, func(i, j int) bool {
+		return backups[i].Time.After(backups[j].Time)
+	})
+	return backups, nil
+}
+
+// PruneBackups keeps the newest keep backups and deletes the rest
+func (s *BackupService) PruneBackups(keep int) (int, error) {
+	backups, err := s.GetBackups()
+	if err != nil {
+		return 0, err
+	}
+	count := 0
+	for i := keep; i < len(backups); i++ {
+		err = os.Remove(filepath.Join(s.GetBackupDir(), backups[i].Name))
+		if err != nil {
+			return count, err
+		}
+		count++
+	}
+	return count, nil
+}
+
+// RestoreBackup closes the database and replaces its file with a backup, the panel has to be restarted to use it
+func (s *BackupService) RestoreBackup(name string) error {
+	src, err := s.backupPath(name)
+	if err != nil {
+		return err
+	}
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	dbPath := config.GetDBPath()
+	tmpPath := dbPath + ".restore"
+	out, err := os.OpenFile(tmpPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(out, in)
+	if err == nil {
+		err = out.Sync()
+	}
+	err = common.Combine(err, out.Close())
+	if err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	// sqlite would apply the write-ahead log of the old database to the restored one
+	err = database.Close()
+	if err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	for _, suffix := range []string{"-wal", "-shm"} {
+		err = os.Remove(dbPath + suffix)
+		if err != nil && !os.IsNotExist(err) {
+			os.Remove(tmpPath)
+			return err
+		}
+	}
+	return os.Rename(tmpPath, dbPath)
+}
+
+// UploadBackup sends a backup with an HTTP PUT, which works for WebDAV and presigned object storage urls,
+// cancelling ctx aborts the upload
+func (s *BackupService) UploadBackup(ctx context.Context, name string, target string) error {
+	path, err := s.backupPath(name)
+	if err != nil {
+		return err
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+
+	target = strings.ReplaceAll(target, "{name}", name)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, target, file)
+	if err != nil {
+		return err
+	}
+	req.ContentLength = info.Size()
+	req.Header.Set("Content-Type", "application/octet-stream")
+	client := &http.Client{
+		Timeout: time.Minute * 5,
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return common.NewErrorf("upload backup responded with status %v", resp.StatusCode)
+	}
+	return nil
+}
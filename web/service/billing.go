@@ -0,0 +1,208 @@
+package service
+
+import (
+	"context"
+	"time"
+	"x-ui/database"
+	"x-ui/database/model"
+	"x-ui/xray"
+
+	"gorm.io/gorm"
+)
+
+// BillingService resets the traffic of inbounds and clients that have a monthly reset day,
+// archiving the traffic of the finished cycle
+type BillingService struct {
+	inboundService InboundServiceImpl
+	settingService SettingService
+	xrayService    XrayService
+}
+
+// anchorDate returns the reset day in the month of t, days past the end of a short month fall on its last day
+func anchorDate(day int, year int, month time.Month, loc *time.Location) time.Time {
+	lastDay := time.Date(year, month+1, 0, 0, 0, 0, 0, loc).Day()
+	if day > lastDay {
+		day = lastDay
+	}
+	return time.Date(year, month, day, 0, 0, 0, 0, loc)
+}
+
+// lastAnchor returns the last reset day up to today
+func lastAnchor(day int, today time.Time) time.Time {
+	anchor := anchorDate(day, today.Year(), today.Month(), today.Location())
+	if anchor.After(today) {
+		previousMonth := time.Date(today.Year(), today.Month()-1, 1, 0, 0, 0, 0, today.Location())
+		anchor = anchorDate(day, previousMonth.Year(), previousMonth.Month(), today.Location())
+	}
+	return anchor
+}
+
+func (s *BillingService) GetTrafficCycles(kind string, name string) ([]*model.TrafficCycle, error) {
+	db := database.GetDB()
+	var cycles []*model.TrafficCycle
+	err := db.Model(model.TrafficCycle{}).
+		Where("kind = ? and name = ?", kind, name).
+		Order("end_time desc").
+		Find(&cycles).Error
+	if err != nil {
+		return nil, err
+	}
+	return cycles, nil
+}
+
+// archiveCycle records the cycle ending on the reset day end, it returns false if that reset already happened
+func archiveCycle(tx *gorm.DB, kind string, name string, day int, end time.Time, up int64, down int64) (bool, error) {
+	var count int64
+	err := tx.Model(model.TrafficCycle{}).
+		Where("kind = ? and name = ? and end_time = ?", kind, name, end.Unix()).
+		Count(&count).Error
+	if err != nil || count > 0 {
+		return false, err
+	}
+	start := lastAnchor(day, end.AddDate(0, 0, -1))
+	return true, tx.Create(&model.TrafficCycle{
+		Kind:      kind,
+		Name:      name,
+		StartTime: start.Unix(),
+		EndTime:   end.Unix(),
+		Up:        up,
+		Down:      down,
+	}).Error
+}
+
+// archiveReset records the traffic of a manual reset as a cycle that starts where the last archived cycle of the
+// inbound or client ended, or at 0 if none was archived before. Resets without traffic are not recorded
+func archiveReset(tx *gorm.DB, kind string, name string, up int64, down int64) error {
+	if up+down == 0 {
+		return nil
+	}
+	last := &model.TrafficCycle{}
+	err := tx.Model(model.TrafficCycle{}).
+		Where("kind = ? and name = ?", kind, name).
+		Order("end_time desc").
+		Limit(1).
+		Find(last).Error
+	if err != nil {
+		return err
+	}
+	return tx.Create(&model.TrafficCycle{
+		Kind:      kind,
+		Name:      name,
+		StartTime: last.EndTime,
+		EndTime:   time.Now().Unix(),
+		Up:        up,
+		Down:      down,
+	}).Error
+}
+
+// ResetDueCycles resets the counters of the inbounds and clients whose reset day in the panel's time zone
+// passed since their last reset, so a reset day the panel was down on is caught up. Those with a traffic
+// limit that are not expired are enabled again. It returns how many were reset.
+func (s *BillingService) ResetDueCycles(ctx context.Context) (int, error) {
+	loc, err := s.settingService.GetTimeLocation()
+	if err != nil {
+		return 0, err
+	}
+	now := time.Now().In(loc)
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, loc)
+	// isDue returns the reset day to reset on and whether it is due. The first time a reset day is seen
+	// only today counts, the reset day before is taken as the last reset and recorded by the caller
+	isDue := func(day int, lastReset int64) (time.Time, bool) {
+		if day <= 0 {
+			return time.Time{}, false
+		}
+		anchor := lastAnchor(day, today)
+		if lastReset == 0 {
+			return anchor, anchor.Equal(today)
+		}
+		return anchor, anchor.Unix() > lastReset
+	}
+	notExpired := func(expiryTime int64) bool {
+		return expiryTime == 0 || expiryTime > now.UnixMilli()
+	}
+
+	inbounds, err := s.inboundService.GetAllInbounds()
+	if err != nil {
+		return 0, err
+	}
+	count := 0
+	needRestart := false
+	db := database.GetDB().WithContext(ctx)
+	err = db.Transaction(func(tx *gorm.DB) error {
+		for _, inbound := range inbounds {
+			if anchor, due := isDue(inbound.ResetDay, inbound.LastReset); due {
+				reset, err := archiveCycle(tx, "inbound", inbound.Tag, inbound.ResetDay, anchor, inbound.Up, inbound.Down)
+				if err != nil {
+					return err
+				}
+				updates := map[string]interface{}{"last_reset": anchor.Unix()}
+				if reset {
+					updates["up"] = 0
+					updates["down"] = 0
+					if !inbound.Enable && inbound.Total > 0 && notExpired(inbound.ExpiryTime) {
+						updates["enable"] = true
+						needRestart = true
+					}
+					count++
+				}
+				err = tx.Model(model.Inbound{}).Where("id = ?", inbound.Id).Updates(updates).Error
+				if err != nil {
+					return err
+				}
+			} else if inbound.ResetDay > 0 && inbound.LastReset == 0 {
+				err := tx.Model(model.Inbound{}).Where("id = ?", inbound.Id).Update("last_reset", anchor.Unix()).Error
+				if err != nil {
+					return err
+				}
+			}
+
+			clients, err := s.inboundService.getClients(inbound)
+			if err != nil {
+				continue
+			}
+			for _, client := range clients {
+				for _, traffic := range inbound.ClientStats {
+					if traffic.Email != client.Email {
+						continue
+					}
+					anchor, due := isDue(client.ResetDay, traffic.LastReset)
+					if !due {
+						if client.ResetDay > 0 && traffic.LastReset == 0 {
+							err := tx.Model(xray.ClientTraffic{}).Where("id = ?", traffic.Id).Update("last_reset", anchor.Unix()).Error
+							if err != nil {
+								return err
+							}
+						}
+						continue
+					}
+					reset, err := archiveCycle(tx, "client", client.Email, client.ResetDay, anchor, traffic.Up, traffic.Down)
+					if err != nil {
+						return err
+					}
+					updates := map[string]interface{}{"last_reset": anchor.Unix()}
+					if reset {
+						updates["up"] = 0
+						updates["down"] = 0
+						if !traffic.Enable && traffic.Total > 0 && notExpired(traffic.ExpiryTime) {
+							updates["enable"] = true
+							needRestart = true
+						}
+						count++
+					}
+					err = tx.Model(xray.ClientTraffic{}).Where("id = ?", traffic.Id).Updates(updates).Error
+					if err != nil {
+						return err
+					}
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	if needRestart {
+		s.xrayService.SetToNeedRestart()
+	}
+	return count, nil
+}
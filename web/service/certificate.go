@@ -0,0 +1,257 @@
+package service
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"strings"
+	"sync"
+	"x-ui/database"
+	"x-ui/database/model"
+	"x-ui/logger"
+	"x-ui/util/common"
+)
+
+// key pairs by certificate id, the panel listener asks for its certificate on every handshake
+var keyPairCache = map[int]*tls.Certificate{}
+var keyPairLock sync.Mutex
+
+type CertificateService struct {
+	settingService SettingService
+}
+
+// GetCertificates returns the stored certificates without their keys
+func (s *CertificateService) GetCertificates() ([]*model.Certificate, error) {
+	db := database.GetDB()
+	var certs []*model.Certificate
+	err := db.Model(model.Certificate{}).Find(&certs).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, cert := range certs {
+		cert.Key = ""
+	}
+	return certs, nil
+}
+
+func (s *CertificateService) GetCertificate(id int) (*model.Certificate, error) {
+	db := database.GetDB()
+	cert := &model.Certificate{}
+	err := db.Model(model.Certificate{}).First(cert, id).Error
+	if err != nil {
+		return nil, err
+	}
+	return cert, nil
+}
+
+// GetKeyPair returns the certificate with the id ready for a tls.Config, renewals are picked up
+// as soon as they are stored
+func (s *CertificateService) GetKeyPair(id int) (*tls.Certificate, error) {
+	keyPairLock.Lock()
+	defer keyPairLock.Unlock()
+	if pair, ok := keyPairCache[id]; ok {
+		return pair, nil
+	}
+	cert, err := s.GetCertificate(id)
+	if err != nil {
+		return nil, err
+	}
+	pair, err := tls.X509KeyPair([]byte(cert.Cert), []byte(cert.Key))
+	if err != nil {
+		return nil, err
+	}
+	keyPairCache[id] = &pair
+	return &pair, nil
+}
+
+func (s *CertificateService) forgetKeyPair(id int) {
+	keyPairLock.Lock()
+	defer keyPairLock.Unlock()
+	delete(keyPairCache, id)
+}
+
+// checkCertificate makes sure the key belongs to the certificate and fills in its domains and expiry
+func (s *CertificateService) checkCertificate(cert *model.Certificate) error {
+	cert.Name = strings.TrimSpace(cert.Name)
+	if cert.Name == "" {
+		return common.NewError("certificate name can not be empty")
+	}
+	pair, err := tls.X509KeyPair([]byte(cert.Cert), []byte(cert.Key))
+	if err != nil {
+		return common.NewError("certificate or key invalid:", err)
+	}
+	leaf, err := x509.ParseCertificate(pair.Certificate[0])
+	if err != nil {
+		return common.NewError("certificate invalid:", err)
+	}
+	domains := leaf.DNSNames
+	if len(domains) == 0 && leaf.Subject.CommonName != "" {
+		domains = []string{leaf.Subject.CommonName}
+	}
+	cert.Domains = strings.Join(domains, ",")
+	cert.ExpiryTime = leaf.NotAfter.UnixMilli()
+	return nil
+}
+
+func (s *CertificateService) AddCertificate(cert *model.Certificate) (*model.Certificate, error) {
+	if err := s.checkCertificate(cert); err != nil {
+		return cert, err
+	}
+	db := database.GetDB()
+	err := db.Create(cert).Error
+	cert.Key = ""
+	return cert, err
+}
+
+// UpdateCertificate replaces a certificate, an empty key keeps the stored one so that renewals
+// with the same key only need the certificate
+func (s *CertificateService) UpdateCertificate(cert *model.Certificate) (*model.Certificate, error) {
+	old, err := s.GetCertificate(cert.Id)
+	if err != nil {
+		return cert, err
+	}
+	if cert.Key == "" {
+		cert.Key = old.Key
+	}
+	if err := s.checkCertificate(cert); err != nil {
+		cert.Key = ""
+		return cert, err
+	}
+	db := database.GetDB()
+	err = db.Save(cert).Error
+	cert.Key = ""
+	s.forgetKeyPair(cert.Id)
+	return cert, err
+}
+
+// DelCertificate refuses to delete a certificate an inbound or the panel still uses
+func (s *CertificateService) DelCertificate(id int) error {
+	db := database.GetDB()
+	var count int64
+	err := db.Model(model.Inbound{}).Where("certificate_id = ?", id).Count(&count).Error
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return common.NewErrorf("certificate is used by %v inbounds", count)
+	}
+	webCertificateId, err := s.settingService.GetWebCertificateId()
+	if err != nil {
+		return err
+	}
+	if webCertificateId == id {
+		return common.NewError("certificate is used by the panel")
+	}
+	s.forgetKeyPair(id)
+	return db.Delete(model.Certificate{}, id).Error
+}
+
+// ApplyCertificate makes exactly the inbounds with the ids use the certificate, they must have tls or xtls security.
+// Their stream settings keep their own certificates, the stored one takes their place in the xray config
+func (s *CertificateService) ApplyCertificate(id int, inboundIds []int) (err error) {
+	_, err = s.GetCertificate(id)
+	if err != nil {
+		return err
+	}
+	db := database.GetDB()
+	var inbounds []*model.Inbound
+	err = db.Model(model.Inbound{}).Where("id in ?", inboundIds).Find(&inbounds).Error
+	if err != nil {
+		return err
+	}
+	if len(inbounds) != len(inboundIds) {
+		return common.NewError("some of the inbounds do not exist:", inboundIds)
+	}
+	for _, inbound := range inbounds {
+		stream := map[string]interface{}{}
+		json.Unmarshal([]byte(inbound.StreamSettings), &stream)
+		if stream["security"] != "tls" && stream["security"] != "xtls" {
+			return common.NewErrorf("inbound %v does not use tls", inbound.Remark)
+		}
+	}
+
+	tx := db.Begin()
+	defer func() {
+		if err == nil {
+			tx.Commit()
+		} else {
+			tx.Rollback()
+		}
+	}()
+	err = tx.Model(model.Inbound{}).Where("certificate_id = ?", id).Update("certificate_id", 0).Error
+	if err != nil {
+		return err
+	}
+	if len(inboundIds) > 0 {
+		err = tx.Model(model.Inbound{}).Where("id in ?", inboundIds).Update("certificate_id", id).Error
+	}
+	return err
+}
+
+// IsCertificateUsed tells whether an inbound refers to the certificate
+func (s *CertificateService) IsCertificateUsed(id int) (bool, error) {
+	db := database.GetDB()
+	var count int64
+	err := db.Model(model.Inbound{}).Where("certificate_id = ?", id).Count(&count).Error
+	return count > 0, err
+}
+
+// checkInboundCertificate fails if the inbound refers to a certificate that does not exist
+func checkInboundCertificate(inbound *model.Inbound) error {
+	if inbound.CertificateId == 0 {
+		return nil
+	}
+	db := database.GetDB()
+	var count int64
+	err := db.Model(model.Certificate{}).Where("id = ?", inbound.CertificateId).Count(&count).Error
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return common.NewError("certificate not found:", inbound.CertificateId)
+	}
+	return nil
+}
+
+// applyCertificate puts the stored certificate of the inbound into its tls or xtls settings,
+// in place of the certificates they list themselves
+func (s *CertificateService) applyCertificate(inbound *model.Inbound) {
+	if inbound.CertificateId == 0 {
+		return
+	}
+	stream := map[string]interface{}{}
+	err := json.Unmarshal([]byte(inbound.StreamSettings), &stream)
+	if err != nil {
+		return
+	}
+	var key string
+	switch stream["security"] {
+	case "tls":
+		key = "tlsSettings"
+	case "xtls":
+		key = "xtlsSettings"
+	default:
+		return
+	}
+	cert, err := s.GetCertificate(inbound.CertificateId)
+	if err != nil {
+		logger.Xray.Warningf("certificate %v of inbound %v not loaded: %v", inbound.CertificateId, inbound.Tag, err)
+		return
+	}
+	settings, _ := stream[key].(map[string]interface{})
+	if settings == nil {
+		settings = map[string]interface{}{}
+	}
+	settings["certificates"] = []interface{}{
+		map[string]interface{}{
+			"certificate": strings.Split(strings.TrimSpace(cert.Cert), "\n"),
+			"key":         strings.Split(strings.TrimSpace(cert.Key), "\n"),
+		},
+	}
+	stream[key] = settings
+	data, err := json.Marshal(stream)
+	if err != nil {
+		return
+	}
+	inbound.StreamSettings = string(data)
+}
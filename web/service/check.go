@@ -0,0 +1,281 @@
+package service
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+	"x-ui/database"
+	"x-ui/database/model"
+	"x-ui/util/redis"
+	"x-ui/util/tor"
+	"x-ui/xray"
+)
+
+const (
+	CheckOk   = "ok"
+	CheckWarn = "warn"
+	CheckFail = "fail"
+)
+
+// certificates expiring sooner than this are reported
+const checkCertWarning = time.Hour * 24 * 14
+
+// geo files older than this are reported, the rules in them go stale
+const checkGeoMaxAge = time.Hour * 24 * 30
+
+// clocks further apart than this break vmess, which rejects requests more than 90 seconds off
+const checkMaxClockOffset = time.Second * 30
+
+// CheckFinding is the outcome of one diagnostic check, Fix tells what to do about a warning or failure
+type CheckFinding struct {
+	Check   string `json:"check"`
+	Status  string `json:"status"`
+	Message string `json:"message"`
+	Fix     string `json:"fix,omitempty"`
+}
+
+// CheckService runs the diagnostics of x-ui check against the database and the host
+type CheckService struct {
+	inboundService     InboundServiceImpl
+	settingService     SettingService
+	certificateService CertificateService
+}
+
+func finding(check string, status string, message string, fix string) *CheckFinding {
+	return &CheckFinding{Check: check, Status: status, Message: message, Fix: fix}
+}
+
+// RunChecks runs every check, findings that could not be checked are warnings
+func (s *CheckService) RunChecks() []*CheckFinding {
+	findings := make([]*CheckFinding, 0)
+	findings = append(findings, s.checkDatabase())
+	findings = append(findings, s.checkXray())
+	findings = append(findings, s.checkPorts()...)
+	findings = append(findings, s.checkCertificates()...)
+	findings = append(findings, s.checkClock())
+	findings = append(findings, s.checkGeoFiles()...)
+	if redisUrl, err := s.settingService.GetRedisUrl(); err == nil && redisUrl != "" {
+		findings = append(findings, s.checkRedis(redisUrl))
+	}
+	if torEnable, err := s.settingService.GetTorEnable(); err == nil && torEnable {
+		findings = append(findings, s.checkTor())
+	}
+	return findings
+}
+
+func (s *CheckService) checkDatabase() *CheckFinding {
+	var result string
+	err := database.GetDB().Raw("PRAGMA integrity_check").Scan(&result).Error
+	if err != nil {
+		return finding("database", CheckFail, fmt.Sprint("integrity check failed: ", err), "restore the latest backup with x-ui backup restore")
+	}
+	if result != "ok" {
+		return finding("database", CheckFail, "integrity check: "+result, "restore the latest backup with x-ui backup restore")
+	}
+	return finding("database", CheckOk, "integrity ok", "")
+}
+
+func (s *CheckService) checkXray() *CheckFinding {
+	path := xray.GetBinaryPath()
+	if _, err := os.Stat(path); err != nil {
+		return finding("xray", CheckFail, "binary not found: "+path, "reinstall x-ui or put the xray binary in "+path)
+	}
+	version := xray.GetBinaryVersion()
+	if version == "Unknown" {
+		return finding("xray", CheckFail, "binary does not run: "+path, "check that the binary matches the architecture and is executable")
+	}
+	return finding("xray", CheckOk, "version "+version, "")
+}
+
+// checkPorts dials the panel and the tcp ports of enabled inbounds on localhost
+func (s *CheckService) checkPorts() []*CheckFinding {
+	findings := make([]*CheckFinding, 0)
+	dial := func(listen string, port int) error {
+		if listen == "" || listen == "0.0.0.0" || listen == "::" {
+			listen = "127.0.0.1"
+		}
+		conn, err := net.DialTimeout("tcp", net.JoinHostPort(listen, strconv.Itoa(port)), time.Second*3)
+		if err == nil {
+			conn.Close()
+		}
+		return err
+	}
+
+	port, err := s.settingService.GetPort()
+	if err == nil {
+		listen, _ := s.settingService.GetListen()
+		if err := dial(listen, port); err != nil {
+			findings = append(findings, finding("port", CheckFail, fmt.Sprintf("panel port %v: %v", port, err), "start the panel with x-ui run or check x-ui status"))
+		} else {
+			findings = append(findings, finding("port", CheckOk, fmt.Sprintf("panel port %v reachable", port), ""))
+		}
+	}
+
+	inbounds, err := s.inboundService.GetAllInbounds()
+	if err != nil {
+		return append(findings, finding("port", CheckWarn, fmt.Sprint("get inbounds failed: ", err), ""))
+	}
+	for _, inbound := range inbounds {
+		if !inbound.Enable || hopsUdp(inbound) || inbound.Protocol == model.Dokodemo && inboundUdp(inbound) {
+			continue
+		}
+		for _, port := range inbound.Ports() {
+			if err := dial(inbound.Listen, port); err != nil {
+				findings = append(findings, finding("port", CheckFail, fmt.Sprintf("inbound %v port %v: %v", inbound.Remark, port, err),
+					"check the xray log, another program may hold the port or xray is not running"))
+			} else {
+				findings = append(findings, finding("port", CheckOk, fmt.Sprintf("inbound %v port %v reachable", inbound.Remark, port), ""))
+			}
+		}
+	}
+	return findings
+}
+
+func certExpiryFinding(name string, notAfter time.Time) *CheckFinding {
+	left := time.Until(notAfter)
+	expiry := notAfter.Format("2006-01-02")
+	switch {
+	case left <= 0:
+		return finding("certificate", CheckFail, fmt.Sprintf("%v expired on %v", name, expiry), "renew the certificate or issue one through ACME")
+	case left < checkCertWarning:
+		return finding("certificate", CheckWarn, fmt.Sprintf("%v expires on %v", name, expiry), "renew the certificate before it expires")
+	}
+	return finding("certificate", CheckOk, fmt.Sprintf("%v valid until %v", name, expiry), "")
+}
+
+func certFileExpiry(path string) (time.Time, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return time.Time{}, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return time.Time{}, fmt.Errorf("no pem data in %v", path)
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return cert.NotAfter, nil
+}
+
+// checkCertificates checks the stored certificates, the panel certificate and certificate files of inbounds
+func (s *CheckService) checkCertificates() []*CheckFinding {
+	findings := make([]*CheckFinding, 0)
+	certs, err := s.certificateService.GetCertificates()
+	if err != nil {
+		return append(findings, finding("certificate", CheckWarn, fmt.Sprint("get certificates failed: ", err), ""))
+	}
+	for _, cert := range certs {
+		findings = append(findings, certExpiryFinding("certificate "+cert.Name, time.UnixMilli(cert.ExpiryTime)))
+	}
+
+	certFile, _ := s.settingService.GetCertFile()
+	keyFile, _ := s.settingService.GetKeyFile()
+	if certFile != "" || keyFile != "" {
+		if _, err := tls.LoadX509KeyPair(certFile, keyFile); err != nil {
+			findings = append(findings, finding("certificate", CheckFail, fmt.Sprint("panel certificate: ", err), "fix the certificate and key file settings"))
+		} else if notAfter, err := certFileExpiry(certFile); err == nil {
+			findings = append(findings, certExpiryFinding("panel certificate", notAfter))
+		}
+	}
+
+	inbounds, err := s.inboundService.GetAllInbounds()
+	if err != nil {
+		return findings
+	}
+	for _, inbound := range inbounds {
+		if !inbound.Enable || inbound.CertificateId != 0 {
+			continue
+		}
+		stream := map[string]interface{}{}
+		if json.Unmarshal([]byte(inbound.StreamSettings), &stream) != nil {
+			continue
+		}
+		certificates, _ := streamValue(stream, "tlsSettings", "certificates").([]interface{})
+		for _, c := range certificates {
+			certificate, _ := c.(map[string]interface{})
+			path, _ := certificate["certificateFile"].(string)
+			if path == "" {
+				continue
+			}
+			notAfter, err := certFileExpiry(path)
+			if err != nil {
+				findings = append(findings, finding("certificate", CheckFail, fmt.Sprintf("inbound %v: %v", inbound.Remark, err), "fix the certificate file of the inbound"))
+				continue
+			}
+			findings = append(findings, certExpiryFinding("inbound "+inbound.Remark+" certificate", notAfter))
+		}
+	}
+	return findings
+}
+
+// checkClock compares the local clock with the Date header of a well known server
+func (s *CheckService) checkClock() *CheckFinding {
+	client := &http.Client{Timeout: time.Second * 10}
+	start := time.Now()
+	resp, err := client.Head("https://www.google.com")
+	if err != nil {
+		return finding("time", CheckWarn, fmt.Sprint("could not compare the clock: ", err), "")
+	}
+	resp.Body.Close()
+	remote, err := http.ParseTime(resp.Header.Get("Date"))
+	if err != nil {
+		return finding("time", CheckWarn, "could not compare the clock, the response has no date", "")
+	}
+	// the Date header has whole seconds, taken somewhere during the request
+	local := start.Add(time.Since(start) / 2)
+	offset := local.Sub(remote).Round(time.Second)
+	if offset > checkMaxClockOffset || offset < -checkMaxClockOffset {
+		return finding("time", CheckFail, fmt.Sprintf("clock is off by %v", offset), "enable time sync, e.g. timedatectl set-ntp true")
+	}
+	return finding("time", CheckOk, fmt.Sprintf("clock is off by %v", offset), "")
+}
+
+func (s *CheckService) checkGeoFiles() []*CheckFinding {
+	findings := make([]*CheckFinding, 0)
+	for _, path := range []string{xray.GetGeoipPath(), xray.GetGeositePath()} {
+		info, err := os.Stat(path)
+		if err != nil {
+			findings = append(findings, finding("geo", CheckFail, "missing "+path, "install xray again from the panel, it brings the geo files"))
+			continue
+		}
+		age := time.Since(info.ModTime())
+		if age > checkGeoMaxAge {
+			findings = append(findings, finding("geo", CheckWarn, fmt.Sprintf("%v is %v days old", path, int(age.Hours()/24)), "set geoipUrl and geositeUrl to update them every week, or install xray again from the panel"))
+			continue
+		}
+		findings = append(findings, finding("geo", CheckOk, fmt.Sprintf("%v is %v days old", path, int(age.Hours()/24)), ""))
+	}
+	return findings
+}
+
+func (s *CheckService) checkRedis(redisUrl string) *CheckFinding {
+	client, err := redis.Parse(redisUrl)
+	if err == nil {
+		err = client.Ping()
+	}
+	if err != nil {
+		return finding("redis", CheckFail, fmt.Sprint("redis unreachable: ", err), "fix the redis setting, until then every panel instance runs all jobs")
+	}
+	return finding("redis", CheckOk, "redis reachable", "")
+}
+
+func (s *CheckService) checkTor() *CheckFinding {
+	address, err := s.settingService.GetTorAddress()
+	if err != nil {
+		return finding("tor", CheckWarn, fmt.Sprint("could not read the tor address: ", err), "")
+	}
+	err = tor.Check(address, time.Second*5)
+	if err != nil {
+		return finding("tor", CheckFail, fmt.Sprint("tor unreachable at ", address, ": ", err), "install and start tor, or let the panel manage it with the torManaged setting")
+	}
+	return finding("tor", CheckOk, "tor reachable at "+address, "")
+}
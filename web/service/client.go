@@ -0,0 +1,212 @@
+package service
+
+import (
+	"encoding/json"
+	"x-ui/database"
+	"x-ui/database/model"
+	"x-ui/util/common"
+	"x-ui/util/random"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// NewClient returns the settings of a new client of an inbound with the protocol, in the form the web UI writes them
+func NewClient(protocol model.Protocol, email string, totalGB int64, expiryTime int64) (map[string]interface{}, error) {
+	client := map[string]interface{}{
+		"email":      email,
+		"totalGB":    totalGB,
+		"expiryTime": expiryTime,
+		"subId":      random.SecureSeq(16),
+		"subEnable":  true,
+	}
+	switch protocol {
+	case model.VMess:
+		client["id"] = uuid.NewString()
+		client["alterId"] = 0
+	case model.VLESS:
+		client["id"] = uuid.NewString()
+		client["flow"] = ""
+	case model.Trojan:
+		client["password"] = random.SecureSeq(10)
+		client["flow"] = ""
+	default:
+		return nil, common.NewErrorf("protocol %v has no clients", protocol)
+	}
+	return client, nil
+}
+
+func parseClients(inbound *model.Inbound) (map[string]interface{}, []interface{}, error) {
+	settings := map[string]interface{}{}
+	err := json.Unmarshal([]byte(inbound.Settings), &settings)
+	if err != nil {
+		return nil, nil, err
+	}
+	clients, _ := settings["clients"].([]interface{})
+	return settings, clients, nil
+}
+
+func (s *InboundServiceImpl) saveClients(tx *gorm.DB, inbound *model.Inbound, settings map[string]interface{}, clients []interface{}) error {
+	settings["clients"] = clients
+	data, err := json.MarshalIndent(settings, "", "  ")
+	if err != nil {
+		return err
+	}
+	inbound.Settings = string(data)
+	err = tx.Model(model.Inbound{}).Where("id = ?", inbound.Id).Update("settings", inbound.Settings).Error
+	if err != nil {
+		return err
+	}
+	return s.updateClientStat(tx, inbound.Id, inbound.Settings)
+}
+
+// AddClient appends a client, e.g. one made by NewClient, to the inbound and creates its traffic record
+func (s *InboundServiceImpl) AddClient(inboundId int, client map[string]interface{}) (*model.Inbound, error) {
+	return s.addClient(database.GetDB(), inboundId, client)
+}
+
+func (s *InboundServiceImpl) addClient(tx *gorm.DB, inboundId int, client map[string]interface{}) (*model.Inbound, error) {
+	email, _ := client["email"].(string)
+	if email == "" {
+		return nil, common.NewError("client email can not be empty")
+	}
+	existEmail, err := s.checkEmailsExist(map[string]bool{email: true}, 0)
+	if err != nil {
+		return nil, err
+	}
+	if existEmail != "" {
+		return nil, common.NewError("Duplicate email:", existEmail)
+	}
+	id, _ := client["id"].(string)
+	if id == "" {
+		id, _ = client["password"].(string)
+	}
+	if id != "" {
+		existId, err := s.checkClientIdsExist(map[string]bool{id: true}, 0)
+		if err != nil {
+			return nil, err
+		}
+		if existId != "" {
+			return nil, common.NewError("Duplicate client id:", existId)
+		}
+	}
+	inbound := &model.Inbound{}
+	err = tx.Model(model.Inbound{}).First(inbound, inboundId).Error
+	if err != nil {
+		return nil, err
+	}
+	settings, clients, err := parseClients(inbound)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := settings["clients"]; !ok {
+		return nil, common.NewErrorf("inbound %v has no clients", inbound.Remark)
+	}
+	flow, _ := client["flow"].(string)
+	err = checkClientFlow(inbound, email, flow)
+	if err != nil {
+		return nil, err
+	}
+	return inbound, s.saveClients(tx, inbound, settings, append(clients, client))
+}
+
+// FindClient returns the inbound of the client with the email and the settings of the client
+func (s *InboundServiceImpl) FindClient(email string) (*model.Inbound, map[string]interface{}, error) {
+	return s.findClient(database.GetDB(), email)
+}
+
+func (s *InboundServiceImpl) findClient(tx *gorm.DB, email string) (*model.Inbound, map[string]interface{}, error) {
+	var inbounds []*model.Inbound
+	err := tx.Model(model.Inbound{}).Preload("ClientStats").Find(&inbounds).Error
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, inbound := range inbounds {
+		_, clients, err := parseClients(inbound)
+		if err != nil {
+			continue
+		}
+		for _, c := range clients {
+			if client, ok := c.(map[string]interface{}); ok && client["email"] == email {
+				return inbound, client, nil
+			}
+		}
+	}
+	return nil, nil, common.NewError("client not found:", email)
+}
+
+// UpdateClient changes the settings of the client with the email in place and saves its inbound
+func (s *InboundServiceImpl) UpdateClient(email string, update func(client map[string]interface{})) (*model.Inbound, error) {
+	return s.updateClient(database.GetDB(), email, update)
+}
+
+func (s *InboundServiceImpl) updateClient(tx *gorm.DB, email string, update func(client map[string]interface{})) (*model.Inbound, error) {
+	inbound, _, err := s.findClient(tx, email)
+	if err != nil {
+		return nil, err
+	}
+	settings, clients, err := parseClients(inbound)
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range clients {
+		if client, ok := c.(map[string]interface{}); ok && client["email"] == email {
+			update(client)
+		}
+	}
+	return inbound, s.saveClients(tx, inbound, settings, clients)
+}
+
+// RotatedClient is the new credential of a client and the share link made with it
+type RotatedClient struct {
+	Email    string `json:"email"`
+	Id       string `json:"id,omitempty"`
+	Password string `json:"password,omitempty"`
+	Link     string `json:"link"`
+}
+
+// RotateClient gives the client with the email a new uuid, or password for trojan, so that its old share links
+// stop working once xray restarted, the new link uses address like GenLink
+func (s *InboundServiceImpl) RotateClient(email string, address string) (*model.Inbound, *RotatedClient, error) {
+	inbound, _, err := s.FindClient(email)
+	if err != nil {
+		return nil, nil, err
+	}
+	rotated := &RotatedClient{Email: email}
+	switch inbound.Protocol {
+	case model.VMess, model.VLESS:
+		rotated.Id = uuid.NewString()
+	case model.Trojan:
+		rotated.Password = random.SecureSeq(10)
+	default:
+		return nil, nil, common.NewErrorf("protocol %v has no clients", inbound.Protocol)
+	}
+	inbound, err = s.UpdateClient(email, func(client map[string]interface{}) {
+		if rotated.Id != "" {
+			client["id"] = rotated.Id
+		} else {
+			client["password"] = rotated.Password
+		}
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	rotated.Link, err = GenLink(inbound, email, address)
+	if err != nil {
+		return nil, nil, err
+	}
+	return inbound, rotated, nil
+}
+
+// clientInt reads a number of client settings, which json decodes as float64
+func clientInt(client map[string]interface{}, key string) int64 {
+	switch value := client[key].(type) {
+	case float64:
+		return int64(value)
+	case int64:
+		return value
+	case int:
+		return int64(value)
+	}
+	return 0
+}
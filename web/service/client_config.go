@@ -0,0 +1,167 @@
+package service
+
+import (
+	"x-ui/database/model"
+	"x-ui/util/common"
+)
+
+// the local proxies of a generated client config, the ports v2rayN and most xray clients use
+const (
+	clientConfigSocksPort = 10808
+	clientConfigHttpPort  = 10809
+)
+
+// clientStream turns the stream settings of an inbound into the ones of a client outbound,
+// certificates and other server side secrets are left out
+func clientStream(stream map[string]interface{}, address string, fingerprint string) map[string]interface{} {
+	network := streamString(stream, "network")
+	if network == "" {
+		network = "tcp"
+	}
+	result := map[string]interface{}{"network": network}
+	settingsKey := map[string]string{
+		"tcp":         "tcpSettings",
+		"kcp":         "kcpSettings",
+		"ws":          "wsSettings",
+		"http":        "httpSettings",
+		"quic":        "quicSettings",
+		"grpc":        "grpcSettings",
+		"httpupgrade": "httpupgradeSettings",
+		"xhttp":       "xhttpSettings",
+	}[network]
+	if settings, ok := stream[settingsKey]; ok {
+		result[settingsKey] = settings
+	}
+	security := streamString(stream, "security")
+	switch security {
+	case "tls", "xtls":
+		key := security + "Settings"
+		serverName := streamString(stream, key, "serverName")
+		if serverName == "" {
+			serverName = address
+		}
+		settings := map[string]interface{}{"serverName": serverName}
+		if alpn := streamValue(stream, key, "alpn"); alpn != nil {
+			settings["alpn"] = alpn
+		}
+		if fingerprint != "" && security == "tls" {
+			settings["fingerprint"] = fingerprint
+		}
+		result["security"] = security
+		result[key] = settings
+	case "reality":
+		fp := streamString(stream, "realitySettings", "settings", "fingerprint")
+		if fp == "" {
+			fp = "chrome"
+		}
+		result["security"] = security
+		result["realitySettings"] = map[string]interface{}{
+			"serverName":  firstString(streamValue(stream, "realitySettings", "serverNames")),
+			"publicKey":   streamString(stream, "realitySettings", "settings", "publicKey"),
+			"shortId":     firstString(streamValue(stream, "realitySettings", "shortIds")),
+			"fingerprint": fp,
+		}
+	default:
+		result["security"] = "none"
+	}
+	return result
+}
+
+// GenClientConfig builds a complete xray client config for the client with the email, with local socks and http
+// proxies and the mux settings of the inbound, address is chosen like in GenLink
+func GenClientConfig(inbound *model.Inbound, email string, address string) (map[string]interface{}, error) {
+	if inbound.Listen != "" && inbound.Listen != "0.0.0.0" && inbound.Listen != "::" {
+		address = inbound.Listen
+	}
+	client, stream, err := findLinkClient(inbound, email)
+	if err != nil {
+		return nil, err
+	}
+	_, serverName := linkParams(stream)
+	if serverName != "" {
+		address = serverName
+	}
+	flow, _ := client["flow"].(string)
+	fingerprint, _ := client["fingerprint"].(string)
+
+	var settings map[string]interface{}
+	switch inbound.Protocol {
+	case model.VMess:
+		settings = map[string]interface{}{
+			"vnext": []interface{}{map[string]interface{}{
+				"address": address,
+				"port":    inbound.Port,
+				"users": []interface{}{map[string]interface{}{
+					"id":       client["id"],
+					"alterId":  clientInt(client, "alterId"),
+					"security": "auto",
+				}},
+			}},
+		}
+	case model.VLESS:
+		settings = map[string]interface{}{
+			"vnext": []interface{}{map[string]interface{}{
+				"address": address,
+				"port":    inbound.Port,
+				"users": []interface{}{map[string]interface{}{
+					"id":         client["id"],
+					"encryption": "none",
+					"flow":       flow,
+				}},
+			}},
+		}
+	case model.Trojan:
+		settings = map[string]interface{}{
+			"servers": []interface{}{map[string]interface{}{
+				"address":  address,
+				"port":     inbound.Port,
+				"password": client["password"],
+				"flow":     flow,
+			}},
+		}
+	default:
+		return nil, common.NewErrorf("protocol %v has no client configs", inbound.Protocol)
+	}
+	proxy := map[string]interface{}{
+		"tag":            "proxy",
+		"protocol":       string(inbound.Protocol),
+		"settings":       settings,
+		"streamSettings": clientStream(stream, address, fingerprint),
+	}
+	if mux := muxSettings(inbound, flow); mux != nil {
+		proxy["mux"] = mux
+	}
+	listen := "127.0.0.1"
+	return map[string]interface{}{
+		"log": map[string]interface{}{"loglevel": "warning"},
+		"inbounds": []interface{}{
+			map[string]interface{}{
+				"tag":      "socks",
+				"listen":   listen,
+				"port":     clientConfigSocksPort,
+				"protocol": "socks",
+				"settings": map[string]interface{}{"udp": true},
+				"sniffing": map[string]interface{}{"enabled": true, "destOverride": []string{"http", "tls"}},
+			},
+			map[string]interface{}{
+				"tag":      "http",
+				"listen":   listen,
+				"port":     clientConfigHttpPort,
+				"protocol": "http",
+			},
+		},
+		"outbounds": []interface{}{
+			proxy,
+			map[string]interface{}{"tag": "direct", "protocol": "freedom"},
+		},
+	}, nil
+}
+
+// GetClientConfig finds the inbound of the client with the email and builds its client config
+func (s *InboundServiceImpl) GetClientConfig(email string, address string) (map[string]interface{}, error) {
+	inbound, _, err := s.FindClient(email)
+	if err != nil {
+		return nil, err
+	}
+	return GenClientConfig(inbound, email, address)
+}
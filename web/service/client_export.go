@@ -0,0 +1,134 @@
+package service
+
+import (
+	"encoding/csv"
+	"io"
+	"strconv"
+	"time"
+	"x-ui/database"
+	"x-ui/database/model"
+
+	"gorm.io/gorm"
+)
+
+// ClientExport is a client with its usage as exported for reporting and billing, Links has the link for
+// every port of the inbound and Link the one of its port
+type ClientExport struct {
+	InboundId  int      `json:"inboundId"`
+	Inbound    string   `json:"inbound"`
+	Protocol   string   `json:"protocol"`
+	Port       int      `json:"port"`
+	Email      string   `json:"email"`
+	Enable     bool     `json:"enable"`
+	Up         int64    `json:"up"`
+	Down       int64    `json:"down"`
+	Total      int64    `json:"total"`
+	ExpiryTime int64    `json:"expiryTime"`
+	Link       string   `json:"link"`
+	Links      []string `json:"links"`
+}
+
+// ExportClients returns all clients of all inbounds in the order of their inbound, the links use address
+// like the ones of the web UI
+func (s *InboundServiceImpl) ExportClients(address string) ([]*ClientExport, error) {
+	exports := make([]*ClientExport, 0)
+	err := s.EachClientExport(address, func(export *ClientExport) error {
+		exports = append(exports, export)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return exports, nil
+}
+
+// EachClientExport calls fn with every client like ExportClients returns them, the inbounds are read in
+// batches so a large panel does not hold all of them at once. An error of fn stops the export
+func (s *InboundServiceImpl) EachClientExport(address string, fn func(*ClientExport) error) error {
+	var inbounds []*model.Inbound
+	db := database.GetDB().Model(model.Inbound{}).Preload("ClientStats")
+	return db.FindInBatches(&inbounds, 50, func(tx *gorm.DB, batch int) error {
+		for _, inbound := range inbounds {
+			clients, err := s.getClients(inbound)
+			if err != nil {
+				continue
+			}
+			for _, client := range clients {
+				export := &ClientExport{
+					InboundId:  inbound.Id,
+					Inbound:    inbound.Remark,
+					Protocol:   string(inbound.Protocol),
+					Port:       inbound.Port,
+					Email:      client.Email,
+					Total:      client.TotalGB,
+					ExpiryTime: client.ExpiryTime,
+				}
+				for _, stat := range inbound.ClientStats {
+					if stat.Email == client.Email {
+						export.Enable = stat.Enable
+						export.Up = stat.Up
+						export.Down = stat.Down
+					}
+				}
+				export.Links, _ = GenLinks(inbound, client.Email, address)
+				if len(export.Links) > 0 {
+					export.Link = export.Links[0]
+				}
+				err = fn(export)
+				if err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}).Error
+}
+
+// ClientsCsvWriter writes exports as csv rows as they come, quotas and usage in bytes and expiry as
+// RFC 3339, empty for none
+type ClientsCsvWriter struct {
+	writer *csv.Writer
+}
+
+// NewClientsCsvWriter starts the csv with the header row
+func NewClientsCsvWriter(w io.Writer) *ClientsCsvWriter {
+	writer := csv.NewWriter(w)
+	writer.Write([]string{"inbound_id", "inbound", "protocol", "port", "email", "enable", "up", "down", "total", "expiry", "link"})
+	return &ClientsCsvWriter{writer: writer}
+}
+
+func (w *ClientsCsvWriter) Write(export *ClientExport) error {
+	expiry := ""
+	if export.ExpiryTime > 0 {
+		expiry = time.UnixMilli(export.ExpiryTime).Format(time.RFC3339)
+	}
+	w.writer.Write([]string{
+		strconv.Itoa(export.InboundId),
+		export.Inbound,
+		export.Protocol,
+		strconv.Itoa(export.Port),
+		export.Email,
+		strconv.FormatBool(export.Enable),
+		strconv.FormatInt(export.Up, 10),
+		strconv.FormatInt(export.Down, 10),
+		strconv.FormatInt(export.Total, 10),
+		expiry,
+		export.Link,
+	})
+	return w.writer.Error()
+}
+
+// Flush writes out the buffered rows, it is needed after the last one
+func (w *ClientsCsvWriter) Flush() error {
+	w.writer.Flush()
+	return w.writer.Error()
+}
+
+// WriteClientsCsv writes the exports with a header row
+func WriteClientsCsv(w io.Writer, exports []*ClientExport) error {
+	writer := NewClientsCsvWriter(w)
+	for _, export := range exports {
+		writer.Write(export)
+	}
+	return writer.Flush()
+}
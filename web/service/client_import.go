@@ -0,0 +1,207 @@
+package service
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+	"x-ui/database"
+	"x-ui/database/model"
+	"x-ui/util/common"
+
+	"github.com/google/uuid"
+)
+
+// ClientImportError is a row of an import that was rejected, rows count from 1 and include the header
+type ClientImportError struct {
+	Row   int    `json:"row"`
+	Email string `json:"email"`
+	Error string `json:"error"`
+}
+
+type ClientImportResult struct {
+	Added  int                  `json:"added"`
+	Errors []*ClientImportError `json:"errors"`
+}
+
+// parseImportExpiry accepts an empty field or 0 for no expiry, a date, a RFC 3339 time or unix milliseconds
+func parseImportExpiry(value string) (int64, error) {
+	if value == "" || value == "0" {
+		return 0, nil
+	}
+	if millis, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return millis, nil
+	}
+	for _, layout := range []string{time.RFC3339, "2006-01-02 15:04", "2006-01-02"} {
+		if t, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			return t.UnixMilli(), nil
+		}
+	}
+	return 0, common.NewError("expiry is not a date or unix milliseconds:", value)
+}
+
+// ImportClients adds the clients of a csv with the columns email, quota in GB, expiry and an optional
+// uuid, the password for trojan, to the inbound. Every row is checked first and nothing is added
+// if any of them is invalid, the result then lists the rows and the error says how many there are.
+// Nothing is added either when ctx is cancelled before the clients are saved
+func (s *InboundServiceImpl) ImportClients(ctx context.Context, inboundId int, reader io.Reader) (*ClientImportResult, error) {
+	inbound, err := s.GetInbound(inboundId)
+	if err != nil {
+		return nil, err
+	}
+	settings, clients, err := parseClients(inbound)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := settings["clients"]; !ok {
+		return nil, common.NewErrorf("inbound %v has no clients", inbound.Remark)
+	}
+
+	others, err := s.getOtherClients(0)
+	if err != nil {
+		return nil, err
+	}
+	settingService := SettingService{}
+	uniqueIds, err := settingService.GetUniqueClientIds()
+	if err != nil {
+		return nil, err
+	}
+	emails := map[string]bool{}
+	ids := map[string]bool{}
+	for _, client := range others {
+		emails[client.Email] = true
+		if uniqueIds {
+			ids[clientId(client)] = true
+		}
+	}
+	own, err := s.getClients(inbound)
+	if err != nil {
+		return nil, err
+	}
+	for _, client := range own {
+		ids[clientId(client)] = true
+	}
+
+	csvReader := csv.NewReader(reader)
+	csvReader.FieldsPerRecord = -1
+	csvReader.TrimLeadingSpace = true
+	records, err := csvReader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+
+	result := &ClientImportResult{Errors: make([]*ClientImportError, 0)}
+	newClients := make([]interface{}, 0, len(records))
+	for i, record := range records {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		row := i + 1
+		if i == 0 && len(record) > 0 && strings.EqualFold(strings.TrimSpace(record[0]), "email") {
+			continue
+		}
+		client, err := s.importClient(inbound.Protocol, record, emails, ids)
+		if err != nil {
+			email := ""
+			if len(record) > 0 {
+				email = strings.TrimSpace(record[0])
+			}
+			result.Errors = append(result.Errors, &ClientImportError{Row: row, Email: email, Error: err.Error()})
+			continue
+		}
+		newClients = append(newClients, client)
+	}
+	if len(result.Errors) > 0 {
+		return result, common.NewErrorf("%v of %v rows are invalid, no client was added", len(result.Errors), len(result.Errors)+len(newClients))
+	}
+	if len(newClients) == 0 {
+		return result, common.NewError("no clients to import")
+	}
+
+	settings["clients"] = append(clients, newClients...)
+	data, err := json.MarshalIndent(settings, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	inbound.Settings = string(data)
+
+	db := database.GetDB().WithContext(ctx)
+	tx := db.Begin()
+	defer func() {
+		if err == nil {
+			tx.Commit()
+		} else {
+			tx.Rollback()
+		}
+	}()
+	err = tx.Model(model.Inbound{}).Where("id = ?", inbound.Id).Update("settings", inbound.Settings).Error
+	if err != nil {
+		return nil, err
+	}
+	err = s.updateClientStat(tx, inbound.Id, inbound.Settings)
+	if err != nil {
+		return nil, err
+	}
+	result.Added = len(newClients)
+	return result, nil
+}
+
+// importClient makes the client of a csv record, emails and ids are those taken so far and get the ones of the client
+func (s *InboundServiceImpl) importClient(protocol model.Protocol, record []string, emails map[string]bool, ids map[string]bool) (map[string]interface{}, error) {
+	fields := make([]string, 4)
+	for i := range fields {
+		if i < len(record) {
+			fields[i] = strings.TrimSpace(record[i])
+		}
+	}
+	email, quota, expiry, id := fields[0], fields[1], fields[2], fields[3]
+
+	if email == "" {
+		return nil, common.NewError("client email can not be empty")
+	}
+	if emails[email] {
+		return nil, common.NewError("Duplicate email:", email)
+	}
+	var totalGB int64
+	if quota != "" {
+		gb, err := strconv.ParseFloat(quota, 64)
+		if err != nil || gb < 0 {
+			return nil, common.NewError("quota is not a number of GB:", quota)
+		}
+		totalGB = int64(gb * 1024 * 1024 * 1024)
+	}
+	expiryTime, err := parseImportExpiry(expiry)
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := NewClient(protocol, email, totalGB, expiryTime)
+	if err != nil {
+		return nil, err
+	}
+	if id != "" {
+		switch protocol {
+		case model.VMess, model.VLESS:
+			if _, err := uuid.Parse(id); err != nil {
+				return nil, common.NewError("id is not a uuid:", id)
+			}
+			client["id"] = id
+		default:
+			client["password"] = id
+		}
+	}
+	if _, ok := client["id"]; ok {
+		id = client["id"].(string)
+	} else {
+		id = client["password"].(string)
+	}
+	if ids[id] {
+		return nil, common.NewError("Duplicate client id:", id)
+	}
+	emails[email] = true
+	ids[id] = true
+	return client, nil
+}
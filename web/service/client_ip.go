@@ -0,0 +1,118 @@
+package service
+
+import (
+	"context"
+	"time"
+	"x-ui/database"
+	"x-ui/database/model"
+	"x-ui/util/geoip"
+
+	"gorm.io/gorm"
+)
+
+type ClientIpService struct {
+	settingService SettingService
+}
+
+func (s *ClientIpService) AddAccessLogEntries(ctx context.Context, entries []*AccessLogEntry) (err error) {
+	if len(entries) == 0 {
+		return nil
+	}
+
+	// collapse the entries to one record per client and ip before touching the db
+	records := map[string]*model.ClientIpHistory{}
+	keys := make([]string, 0)
+	for _, entry := range entries {
+		key := entry.Email + " " + entry.IP
+		seen := entry.Time.Unix()
+		record, ok := records[key]
+		if !ok {
+			record = &model.ClientIpHistory{
+				Email:     entry.Email,
+				IP:        entry.IP,
+				FirstSeen: seen,
+				LastSeen:  seen,
+			}
+			records[key] = record
+			keys = append(keys, key)
+			continue
+		}
+		if seen < record.FirstSeen {
+			record.FirstSeen = seen
+		}
+		if seen > record.LastSeen {
+			record.LastSeen = seen
+		}
+	}
+
+	db := database.GetDB().WithContext(ctx)
+	tx := db.Begin()
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		} else {
+			tx.Commit()
+		}
+	}()
+	for _, key := range keys {
+		record := records[key]
+		result := tx.Model(model.ClientIpHistory{}).
+			Where("email = ? and ip = ?", record.Email, record.IP).
+			UpdateColumns(map[string]interface{}{
+				"first_seen": gorm.Expr("min(first_seen, ?)", record.FirstSeen),
+				"last_seen":  gorm.Expr("max(last_seen, ?)", record.LastSeen),
+			})
+		err = result.Error
+		if err != nil {
+			return
+		}
+		if result.RowsAffected == 0 {
+			info := geoip.Lookup(record.IP)
+			record.Country = info.Country
+			record.Asn = info.Asn
+			record.AsnOrg = info.Organization
+			err = tx.Create(record).Error
+			if err != nil {
+				return
+			}
+		}
+	}
+	return
+}
+
+func (s *ClientIpService) GetClientIpHistory(email string) ([]*model.ClientIpHistory, error) {
+	db := database.GetDB()
+	var records []*model.ClientIpHistory
+	err := db.Model(model.ClientIpHistory{}).
+		Where("email = ?", email).
+		Order("last_seen desc").
+		Find(&records).Error
+	if err != nil {
+		return nil, err
+	}
+	return records, nil
+}
+
+// CountClientIps returns how many distinct ips the client used since the given time
+func (s *ClientIpService) CountClientIps(email string, since time.Time) (int64, error) {
+	db := database.GetDB()
+	var count int64
+	err := db.Model(model.ClientIpHistory{}).
+		Where("email = ? and last_seen >= ?", email, since.Unix()).
+		Count(&count).Error
+	return count, err
+}
+
+func (s *ClientIpService) PruneClientIpHistory(ctx context.Context) (int64, error) {
+	days, err := s.settingService.GetIpHistoryRetention()
+	if err != nil {
+		return 0, err
+	}
+	if days <= 0 {
+		return 0, nil
+	}
+	before := time.Now().AddDate(0, 0, -days).Unix()
+	db := database.GetDB().WithContext(ctx)
+	result := db.Where("last_seen < ?", before).Delete(model.ClientIpHistory{})
+	return result.RowsAffected, result.Error
+}
@@ -0,0 +1,41 @@
+package service
+
+import (
+	"x-ui/logger"
+	"x-ui/util/common"
+)
+
+// ClientTgId binds a client to the telegram user with the id, 0 unbinds it
+type ClientTgId struct {
+	TgId int64 `json:"tgId" form:"tgId"`
+}
+
+// SetClientTgId stores the telegram user of the client with the email, NotifyClient messages that user
+func (s *InboundServiceImpl) SetClientTgId(email string, tgId int64) error {
+	if tgId < 0 {
+		return common.NewError("telegram id can not be negative:", tgId)
+	}
+	_, err := s.UpdateClient(email, func(client map[string]interface{}) {
+		client["tgId"] = tgId
+	})
+	return err
+}
+
+// NotifyClient sends msg in the background to the telegram user bound to the client with the email by its tgId,
+// clients without one are skipped
+func (s *InboundServiceImpl) NotifyClient(email string, msg string) {
+	_, client, err := s.FindClient(email)
+	if err != nil {
+		return
+	}
+	tgId := clientInt(client, "tgId")
+	if tgId == 0 {
+		return
+	}
+	go func() {
+		err := s.notifyService.SendTelegramTo(tgId, msg)
+		if err != nil {
+			logger.Warning("notify client failed:", email, err)
+		}
+	}()
+}
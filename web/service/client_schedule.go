@@ -0,0 +1,119 @@
+package service
+
+import (
+	"sync"
+	"time"
+	"x-ui/database/model"
+	"x-ui/util/common"
+	"x-ui/util/schedule"
+)
+
+// ClientSchedule sets the hours of the day a client may connect in, in the panel's time zone, empty allows any hour
+type ClientSchedule struct {
+	Schedule string `json:"schedule" form:"schedule"`
+}
+
+var clientScheduleLock sync.Mutex
+
+// the clients that were outside of their schedule when the xray config was generated last
+var scheduledOffClients = map[string]bool{}
+
+// ClientScheduleService keeps clients with a schedule out of the xray config outside of their hours,
+// xray is restarted when a client enters or leaves its hours
+type ClientScheduleService struct {
+	inboundService InboundServiceImpl
+	settingService SettingService
+	xrayService    XrayService
+}
+
+// checkClientSchedules checks the schedule of every client of the inbound
+func checkClientSchedules(inbound *model.Inbound) error {
+	_, clients, err := parseClients(inbound)
+	if err != nil {
+		return err
+	}
+	for _, c := range clients {
+		client, ok := c.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		value, _ := client["schedule"].(string)
+		if _, err := schedule.Parse(value); err != nil {
+			return common.NewError("client", client["email"], err)
+		}
+	}
+	return nil
+}
+
+// clientOutOfSchedule tells whether the client has a schedule that does not allow now
+func clientOutOfSchedule(client map[string]interface{}, now time.Time) bool {
+	value, _ := client["schedule"].(string)
+	if value == "" {
+		return false
+	}
+	s, err := schedule.Parse(value)
+	return err == nil && !s.Allows(now)
+}
+
+// SetClientSchedule stores the schedule of the client with the email, it takes effect within a minute
+func (s *ClientScheduleService) SetClientSchedule(email string, value string) error {
+	if _, err := schedule.Parse(value); err != nil {
+		return err
+	}
+	_, err := s.inboundService.UpdateClient(email, func(client map[string]interface{}) {
+		client["schedule"] = value
+	})
+	return err
+}
+
+// ApplyClientSchedules restarts xray when a client entered or left its hours since the config was generated
+func (s *ClientScheduleService) ApplyClientSchedules() error {
+	loc, err := s.settingService.GetTimeLocation()
+	if err != nil {
+		return err
+	}
+	now := time.Now().In(loc)
+	inbounds, err := s.inboundService.GetAllInbounds()
+	if err != nil {
+		return err
+	}
+	off := map[string]bool{}
+	for _, inbound := range inbounds {
+		if !inbound.Enable {
+			continue
+		}
+		_, clients, err := parseClients(inbound)
+		if err != nil {
+			continue
+		}
+		for _, c := range clients {
+			client, ok := c.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			if email, _ := client["email"].(string); clientOutOfSchedule(client, now) {
+				off[email] = true
+			}
+		}
+	}
+
+	clientScheduleLock.Lock()
+	defer clientScheduleLock.Unlock()
+	changed := len(off) != len(scheduledOffClients)
+	for email := range off {
+		if !scheduledOffClients[email] {
+			changed = true
+		}
+	}
+	if changed {
+		s.xrayService.SetToNeedRestart()
+	}
+	return nil
+}
+
+// setScheduledOffClients remembers the clients the xray config was generated without
+func setScheduledOffClients(off map[string]bool) {
+	clientScheduleLock.Lock()
+	defer clientScheduleLock.Unlock()
+	scheduledOffClients = off
+}
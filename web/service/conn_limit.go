@@ -0,0 +1,210 @@
+package service
+
+import (
+	"encoding/json"
+	"sort"
+	"sync"
+	"x-ui/logger"
+	"x-ui/util/common"
+	"x-ui/xray"
+)
+
+// ClientConnLimit sets how many addresses a client may be connected from at the same time, 0 removes the limit
+type ClientConnLimit struct {
+	ConnLimit int `json:"connLimit" form:"connLimit"`
+}
+
+var connLimitLock sync.Mutex
+
+// the addresses each limited client is allowed from, kept while they stay online so that the first
+// devices of a client keep their slots
+var connLimitAllowed = map[string]map[string]bool{}
+
+// the addresses each client is blocked from, the xray config routes them to the blocked outbound
+var connLimitBlocked = map[string][]string{}
+
+// ConnLimitService enforces the connLimit of clients. Xray can not count the connections of a user, so the
+// addresses a client is online from according to the access log stand in for its connections. Addresses
+// past the limit are blocked for that client by routing rules until one of its allowed addresses goes offline
+type ConnLimitService struct {
+	inboundService InboundServiceImpl
+	onlineService  OnlineService
+	xrayService    XrayService
+}
+
+// SetClientConnLimit stores the limit of the client with the email, EnforceConnLimits picks it up
+func (s *ConnLimitService) SetClientConnLimit(email string, connLimit int) error {
+	if connLimit < 0 {
+		return common.NewError("connection limit can not be negative:", connLimit)
+	}
+	_, err := s.inboundService.UpdateClient(email, func(client map[string]interface{}) {
+		client["connLimit"] = connLimit
+	})
+	return err
+}
+
+// EnforceConnLimits blocks the addresses of clients that are online from more addresses than their limit,
+// the rules of the clients whose blocked addresses changed are replaced in the running xray
+func (s *ConnLimitService) EnforceConnLimits() error {
+	inbounds, err := s.inboundService.GetAllInbounds()
+	if err != nil {
+		return err
+	}
+	limits := map[string]int{}
+	for _, inbound := range inbounds {
+		if !inbound.Enable {
+			continue
+		}
+		_, clients, err := parseClients(inbound)
+		if err != nil {
+			continue
+		}
+		for _, c := range clients {
+			client, ok := c.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			email, _ := client["email"].(string)
+			if limit := clientInt(client, "connLimit"); email != "" && limit > 0 {
+				limits[email] = int(limit)
+			}
+		}
+	}
+
+	connLimitLock.Lock()
+	defer connLimitLock.Unlock()
+
+	allowed := map[string]map[string]bool{}
+	blocked := map[string][]string{}
+	for _, client := range s.onlineService.GetOnlineClients() {
+		limit, ok := limits[client.Email]
+		if !ok {
+			continue
+		}
+		ips := make([]string, 0, len(client.IPs))
+		for _, ip := range client.IPs {
+			ips = append(ips, ip.IP)
+		}
+		// addresses that were allowed before keep their slots
+		wasAllowed := connLimitAllowed[client.Email]
+		sort.Slice(ips, func(i, j int) bool {
+			if wasAllowed[ips[i]] != wasAllowed[ips[j]] {
+				return wasAllowed[ips[i]]
+			}
+			return ips[i] < ips[j]
+		})
+		allowed[client.Email] = map[string]bool{}
+		for i, ip := range ips {
+			if i < limit {
+				allowed[client.Email][ip] = true
+			} else {
+				blocked[client.Email] = append(blocked[client.Email], ip)
+			}
+		}
+		sort.Strings(blocked[client.Email])
+	}
+	connLimitAllowed = allowed
+
+	changed := len(blocked) != len(connLimitBlocked)
+	for email, ips := range blocked {
+		if old, ok := connLimitBlocked[email]; !ok || !equalStrings(ips, old) {
+			logger.Warningf("client %v is connected from more than %v addresses, blocked %v", email, limits[email], ips)
+			changed = true
+		}
+	}
+	if changed {
+		err = s.updateConnLimitRules(connLimitBlocked, blocked)
+		if err != nil {
+			logger.Warning("change connection limit rules of running xray failed, restarting it:", err)
+			s.xrayService.SetToNeedRestart()
+		}
+		connLimitBlocked = blocked
+	}
+	return nil
+}
+
+// connLimitRuleTag tags the rule of the client in the routing of xray, so that it can be removed again
+func connLimitRuleTag(email string) string {
+	return "connlimit-" + email
+}
+
+// updateConnLimitRules replaces the rules of the clients whose blocked addresses changed through the api of
+// xray, without the restart that would drop the connections of every client
+func (s *ConnLimitService) updateConnLimitRules(old map[string][]string, blocked map[string][]string) error {
+	if !s.xrayService.IsXrayRunning() {
+		// the config of the next start has the rules
+		return nil
+	}
+	for email, ips := range old {
+		if ipsNow, ok := blocked[email]; ok && equalStrings(ips, ipsNow) {
+			continue
+		}
+		err := s.xrayService.RemoveRule(connLimitRuleTag(email))
+		if err != nil {
+			return err
+		}
+	}
+	for email, ips := range blocked {
+		if ipsBefore, ok := old[email]; ok && equalStrings(ips, ipsBefore) {
+			continue
+		}
+		err := s.xrayService.AddSourceRule(connLimitRuleTag(email), "blocked", email, ips)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// addConnLimitRules puts routing rules in front of the template rules that send the blocked addresses
+// of clients over their connection limit to the blocked outbound
+func addConnLimitRules(xrayConfig *xray.Config) error {
+	connLimitLock.Lock()
+	defer connLimitLock.Unlock()
+	if len(connLimitBlocked) == 0 {
+		return nil
+	}
+	emails := make([]string, 0, len(connLimitBlocked))
+	for email := range connLimitBlocked {
+		emails = append(emails, email)
+	}
+	sort.Strings(emails)
+	rules := make([]interface{}, 0, len(emails))
+	for _, email := range emails {
+		rules = append(rules, map[string]interface{}{
+			"type":        "field",
+			"ruleTag":     connLimitRuleTag(email),
+			"user":        []string{email},
+			"source":      connLimitBlocked[email],
+			"outboundTag": "blocked",
+		})
+	}
+
+	routing := map[string]interface{}{}
+	if len(xrayConfig.RouterConfig) > 0 {
+		err := json.Unmarshal(xrayConfig.RouterConfig, &routing)
+		if err != nil {
+			return err
+		}
+	}
+	templateRules, _ := routing["rules"].([]interface{})
+	routing["rules"] = append(rules, templateRules...)
+	routerConfig, err := json.Marshal(routing)
+	if err != nil {
+		return err
+	}
+	xrayConfig.RouterConfig = routerConfig
+	return nil
+}
+
+func equalStrings(a []string, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,99 @@
+package service
+
+import (
+	"strconv"
+	"sync"
+	"time"
+	"x-ui/logger"
+	"x-ui/util/common"
+	"x-ui/util/random"
+	"x-ui/util/redis"
+)
+
+// instanceId tells the panel instances sharing a redis apart, it is the value of the locks this one holds
+var instanceId = random.SecureSeq(16)
+
+var redisClient *redis.Client
+var redisOnce sync.Once
+
+// keys of the panel are prefixed, so a redis can be shared with other programs
+const redisKeyPrefix = "x-ui:"
+
+// CoordinationService lets panel instances that share a database take turns through redis, without
+// redisUrl the panel runs alone and every lock is granted. The sessions of the panel are kept in the redis
+// as well, so a logout ends a session on every instance
+type CoordinationService struct {
+	settingService SettingService
+}
+
+func GetInstanceId() string {
+	return instanceId
+}
+
+// getRedis connects to the redisUrl of the start of the panel, nil if it is not set
+func (s *CoordinationService) getRedis() *redis.Client {
+	redisOnce.Do(func() {
+		redisUrl, err := s.settingService.GetRedisUrl()
+		if err != nil || redisUrl == "" {
+			return
+		}
+		redisClient, err = redis.Parse(redisUrl)
+		if err != nil {
+			logger.Warning("parse redis url failed:", err)
+			return
+		}
+		logger.Info("coordinating with other panel instances through redis as", instanceId)
+	})
+	return redisClient
+}
+
+// GetRedis returns the redis of the panel, nil if it runs alone
+func (s *CoordinationService) GetRedis() *redis.Client {
+	return s.getRedis()
+}
+
+func (s *CoordinationService) IsCoordinated() bool {
+	return s.getRedis() != nil
+}
+
+// TryLock takes the named lock for ttl unless another instance holds it. If redis can not be reached
+// the lock is refused, the instances can not tell who runs a job then and each would run it
+func (s *CoordinationService) TryLock(name string, ttl time.Duration) bool {
+	client := s.getRedis()
+	if client == nil {
+		return true
+	}
+	if ttl < time.Second {
+		ttl = time.Second
+	}
+	ok, err := client.SetNX(redisKeyPrefix+"lock:"+name, instanceId, ttl)
+	if err != nil {
+		logger.Warning("take lock", name, "failed, skipping:", err)
+		return false
+	}
+	return ok
+}
+
+// holdScript extends a lock only while this instance holds it, so a lock another instance took
+// after it expired is left alone
+const holdScript = `if redis.call("GET", KEYS[1]) == ARGV[1] then return redis.call("PEXPIRE", KEYS[1], ARGV[2]) end return 0`
+
+// HoldLock takes the named lock for ttl or extends it if this instance holds it already. Unlike TryLock
+// it fails if redis is not set and returns the error of redis
+func (s *CoordinationService) HoldLock(name string, ttl time.Duration) (bool, error) {
+	client := s.getRedis()
+	if client == nil {
+		return false, common.NewError("redis is not set")
+	}
+	key := redisKeyPrefix + "lock:" + name
+	ok, err := client.SetNX(key, instanceId, ttl)
+	if err != nil || ok {
+		return ok, err
+	}
+	reply, err := client.Do("EVAL", holdScript, "1", key, instanceId, strconv.FormatInt(ttl.Milliseconds(), 10))
+	if err != nil {
+		return false, err
+	}
+	extended, _ := reply.(int64)
+	return extended == 1, nil
+}
@@ -0,0 +1,117 @@
+package service
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"x-ui/database/model"
+	"x-ui/util/common"
+	"x-ui/util/geoip"
+	"x-ui/xray"
+)
+
+// geoipNames returns the names of the lists in the geoip.dat of xray, upper case like the codes of inbounds
+func geoipNames() (map[string]bool, error) {
+	data, err := os.ReadFile(xray.GetGeoipPath())
+	if err != nil {
+		return nil, err
+	}
+	list, err := geoip.ListNames(data)
+	if err != nil {
+		return nil, err
+	}
+	names := make(map[string]bool, len(list))
+	for _, name := range list {
+		names[strings.ToUpper(name)] = true
+	}
+	return names, nil
+}
+
+// normalizeCountries checks the source country rule of an inbound and stores the codes upper case. The codes
+// must name lists of the geoip.dat, xray refuses to start with a rule of an unknown one
+func normalizeCountries(inbound *model.Inbound) error {
+	switch inbound.CountryMode {
+	case "":
+		inbound.Countries = ""
+		return nil
+	case "allow", "deny":
+	default:
+		return common.NewError("country mode must be empty, allow or deny:", inbound.CountryMode)
+	}
+	names, err := geoipNames()
+	if err != nil {
+		return common.NewError("read country lists of geoip.dat failed:", err)
+	}
+	countries := make([]string, 0)
+	for _, country := range strings.Split(inbound.Countries, ",") {
+		country = strings.ToUpper(strings.TrimSpace(country))
+		if country == "" {
+			continue
+		}
+		if !names[country] {
+			return common.NewError("country is not in geoip.dat:", country)
+		}
+		countries = append(countries, country)
+	}
+	if len(countries) == 0 {
+		return common.NewError("country list of inbound is empty")
+	}
+	inbound.Countries = strings.Join(countries, ",")
+	return nil
+}
+
+// addCountryRules puts routing rules in front of the template rules that send connections from
+// countries an inbound does not accept to the blocked outbound
+func addCountryRules(xrayConfig *xray.Config, inbounds []*model.Inbound) error {
+	rules := make([]interface{}, 0)
+	allowLists := map[string][]string{}
+	for _, inbound := range inbounds {
+		if !inbound.Enable || inbound.CountryMode == "" || inbound.Countries == "" {
+			continue
+		}
+		countries := strings.Split(inbound.Countries, ",")
+		source := make([]string, 0, len(countries))
+		if inbound.CountryMode == "deny" {
+			for _, country := range countries {
+				source = append(source, "geoip:"+strings.ToLower(country))
+			}
+		} else {
+			// xray ors the entries of source, so "not in any of the countries" needs a single list
+			name := strings.ToUpper(inbound.Tag)
+			allowLists[name] = countries
+			source = append(source, "ext:"+filepath.Base(xray.GetInboundGeoipPath())+":!"+name)
+		}
+		rules = append(rules, map[string]interface{}{
+			"type":        "field",
+			"inboundTag":  []string{inbound.Tag},
+			"source":      source,
+			"outboundTag": "blocked",
+		})
+	}
+	if len(rules) == 0 {
+		return nil
+	}
+	if len(allowLists) > 0 {
+		err := geoip.WriteDat(xray.GetGeoipPath(), xray.GetInboundGeoipPath(), allowLists)
+		if err != nil {
+			return common.NewError("write country lists of inbounds failed:", err)
+		}
+	}
+
+	routing := map[string]interface{}{}
+	if len(xrayConfig.RouterConfig) > 0 {
+		err := json.Unmarshal(xrayConfig.RouterConfig, &routing)
+		if err != nil {
+			return err
+		}
+	}
+	templateRules, _ := routing["rules"].([]interface{})
+	routing["rules"] = append(rules, templateRules...)
+	routerConfig, err := json.Marshal(routing)
+	if err != nil {
+		return err
+	}
+	xrayConfig.RouterConfig = routerConfig
+	return nil
+}
@@ -0,0 +1,64 @@
+package service
+
+import (
+	"runtime"
+	"time"
+)
+
+// panelStartTime is when the panel process started, for its uptime
+var panelStartTime = time.Now()
+
+// RuntimeStats is the state of the go runtime of the panel, sizes are in bytes and pauses in nanoseconds
+type RuntimeStats struct {
+	GoVersion    string `json:"goVersion"`
+	Uptime       int64  `json:"uptime"`
+	NumCPU       int    `json:"numCpu"`
+	GoMaxProcs   int    `json:"goMaxProcs"`
+	Goroutines   int    `json:"goroutines"`
+	HeapAlloc    uint64 `json:"heapAlloc"`
+	HeapInuse    uint64 `json:"heapInuse"`
+	HeapIdle     uint64 `json:"heapIdle"`
+	HeapReleased uint64 `json:"heapReleased"`
+	HeapObjects  uint64 `json:"heapObjects"`
+	StackInuse   uint64 `json:"stackInuse"`
+	Sys          uint64 `json:"sys"`
+	TotalAlloc   uint64 `json:"totalAlloc"`
+	NumGC        uint32 `json:"numGc"`
+	LastGC       int64  `json:"lastGc"`
+	PauseTotal   uint64 `json:"pauseTotal"`
+	LastPause    uint64 `json:"lastPause"`
+	NextGC       uint64 `json:"nextGc"`
+}
+
+// DebugService reports the runtime of the panel for diagnosing memory growth of long running panels
+type DebugService struct {
+}
+
+// GetRuntimeStats reads the memory stats, which stops the world for a moment
+func (s *DebugService) GetRuntimeStats() *RuntimeStats {
+	memStats := &runtime.MemStats{}
+	runtime.ReadMemStats(memStats)
+	stats := &RuntimeStats{
+		GoVersion:    runtime.Version(),
+		Uptime:       int64(time.Since(panelStartTime).Seconds()),
+		NumCPU:       runtime.NumCPU(),
+		GoMaxProcs:   runtime.GOMAXPROCS(0),
+		Goroutines:   runtime.NumGoroutine(),
+		HeapAlloc:    memStats.HeapAlloc,
+		HeapInuse:    memStats.HeapInuse,
+		HeapIdle:     memStats.HeapIdle,
+		HeapReleased: memStats.HeapReleased,
+		HeapObjects:  memStats.HeapObjects,
+		StackInuse:   memStats.StackInuse,
+		Sys:          memStats.Sys,
+		TotalAlloc:   memStats.TotalAlloc,
+		NumGC:        memStats.NumGC,
+		PauseTotal:   memStats.PauseTotalNs,
+		NextGC:       memStats.NextGC,
+	}
+	if memStats.NumGC > 0 {
+		stats.LastGC = int64(memStats.LastGC / uint64(time.Millisecond))
+		stats.LastPause = memStats.PauseNs[(memStats.NumGC+255)%256]
+	}
+	return stats
+}
@@ -0,0 +1,149 @@
+package service
+
+import (
+	"bytes"
+	"crypto/tls"
+	_ "embed"
+	"encoding/base64"
+	"fmt"
+	"html/template"
+	"mime"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"os"
+	"strconv"
+	"time"
+	"x-ui/util/common"
+)
+
+//go:embed email.html
+var emailHtml string
+
+var emailTemplate = template.Must(template.New("email").Parse(emailHtml))
+
+// SendEmail sends subject and msg as an html mail, to is a comma separated list and defaults to the smtpTo setting
+func (s *NotifyService) SendEmail(to string, subject string, msg string) error {
+	host, err := s.settingService.GetSmtpHost()
+	if err != nil {
+		return err
+	}
+	if host == "" {
+		return common.NewError("smtp host is empty")
+	}
+	port, err := s.settingService.GetSmtpPort()
+	if err != nil {
+		return err
+	}
+	username, err := s.settingService.GetSmtpUsername()
+	if err != nil {
+		return err
+	}
+	password, err := s.settingService.GetSmtpPassword()
+	if err != nil {
+		return err
+	}
+	from, err := s.settingService.GetSmtpFrom()
+	if err != nil {
+		return err
+	}
+	sender, err := mail.ParseAddress(from)
+	if err != nil {
+		return common.NewError("smtp sender is not a valid address:", from)
+	}
+	if to == "" {
+		to, err = s.settingService.GetSmtpTo()
+		if err != nil {
+			return err
+		}
+	}
+	recipients, err := mail.ParseAddressList(to)
+	if err != nil {
+		return common.NewError("email recipients are not valid addresses:", to)
+	}
+	addresses := make([]string, 0, len(recipients))
+	for _, recipient := range recipients {
+		addresses = append(addresses, recipient.Address)
+	}
+
+	hostname, _ := os.Hostname()
+	body := &bytes.Buffer{}
+	err = emailTemplate.Execute(body, map[string]interface{}{
+		"Subject":  subject,
+		"Message":  msg,
+		"Hostname": hostname,
+		"Time":     time.Now().Format("2006-01-02 15:04:05"),
+	})
+	if err != nil {
+		return err
+	}
+
+	message := &bytes.Buffer{}
+	fmt.Fprintf(message, "From: %s\r\n", sender.String())
+	fmt.Fprintf(message, "To: %s\r\n", to)
+	fmt.Fprintf(message, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(message, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	message.WriteString("MIME-Version: 1.0\r\n")
+	message.WriteString("Content-Type: text/html; charset=UTF-8\r\n")
+	message.WriteString("Content-Transfer-Encoding: base64\r\n\r\n")
+	encoded := base64.StdEncoding.EncodeToString(body.Bytes())
+	for len(encoded) > 76 {
+		message.WriteString(encoded[:76] + "\r\n")
+		encoded = encoded[76:]
+	}
+	message.WriteString(encoded + "\r\n")
+
+	return sendMail(host, port, username, password, sender.Address, addresses, message.Bytes())
+}
+
+// sendMail is smtp.SendMail, except that port 465 speaks tls from the start instead of STARTTLS
+func sendMail(host string, port int, username string, password string, from string, to []string, msg []byte) error {
+	addr := net.JoinHostPort(host, strconv.Itoa(port))
+	var auth smtp.Auth
+	if username != "" {
+		auth = smtp.PlainAuth("", username, password, host)
+	}
+	if port != 465 {
+		return smtp.SendMail(addr, auth, from, to, msg)
+	}
+
+	conn, err := tls.DialWithDialer(&net.Dialer{Timeout: time.Second * 10}, "tcp", addr, &tls.Config{ServerName: host})
+	if err != nil {
+		return err
+	}
+	client, err := smtp.NewClient(conn, host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+	if auth != nil {
+		err = client.Auth(auth)
+		if err != nil {
+			return err
+		}
+	}
+	err = client.Mail(from)
+	if err != nil {
+		return err
+	}
+	for _, recipient := range to {
+		err = client.Rcpt(recipient)
+		if err != nil {
+			return err
+		}
+	}
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(msg)
+	if err != nil {
+		return err
+	}
+	err = w.Close()
+	if err != nil {
+		return err
+	}
+	return client.Quit()
+}
@@ -0,0 +1,100 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"x-ui/logger"
+	"x-ui/util/common"
+)
+
+// scripts that take longer are killed
+const eventScriptTimeout = time.Minute
+
+// checkEventScripts rejects scripts for events that do not exist, CheckValid already parsed the object
+func checkEventScripts(value string) error {
+	scripts := map[string]string{}
+	err := json.Unmarshal([]byte(value), &scripts)
+	if err != nil {
+		return err
+	}
+	for event := range scripts {
+		if !common.IsSubString(event, append([]string{}, webhookEvents...)) {
+			return common.NewError("unknown event in event scripts:", event)
+		}
+	}
+	return nil
+}
+
+// eventEnvName turns a json key like inboundId into XUI_INBOUND_ID
+func eventEnvName(key string) string {
+	var b strings.Builder
+	b.WriteString("XUI_")
+	for i, r := range key {
+		if unicode.IsUpper(r) && i > 0 {
+			b.WriteByte('_')
+		}
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			r = '_'
+		}
+		b.WriteRune(unicode.ToUpper(r))
+	}
+	return b.String()
+}
+
+// eventEnv has XUI_EVENT, XUI_EVENT_TIME and XUI_EVENT_DATA with the json of the data, and every
+// top level number, string or bool of the data on its own like XUI_EMAIL
+func eventEnv(payload *WebhookPayload) []string {
+	env := []string{
+		"XUI_EVENT=" + payload.Event,
+		"XUI_EVENT_TIME=" + strconv.FormatInt(payload.Time, 10),
+	}
+	data, err := json.Marshal(payload.Data)
+	if err != nil {
+		return env
+	}
+	env = append(env, "XUI_EVENT_DATA="+string(data))
+	fields := map[string]interface{}{}
+	if json.Unmarshal(data, &fields) != nil {
+		return env
+	}
+	for key, value := range fields {
+		switch v := value.(type) {
+		case string:
+			env = append(env, eventEnvName(key)+"="+v)
+		case float64, bool:
+			env = append(env, fmt.Sprint(eventEnvName(key), "=", v))
+		}
+	}
+	return env
+}
+
+// runEventScripts runs the command eventScripts sets for the event with sh, failures are only logged
+func runEventScripts(payload *WebhookPayload) {
+	settingService := SettingService{}
+	scripts, err := settingService.GetEventScripts()
+	if err != nil {
+		logger.Warning("get event scripts failed:", err)
+		return
+	}
+	script := strings.TrimSpace(scripts[payload.Event])
+	if script == "" {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), eventScriptTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, "sh", "-c", script)
+	cmd.Env = append(os.Environ(), eventEnv(payload)...)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		logger.Warningf("event script of %v failed: %v %v", payload.Event, err, strings.TrimSpace(string(out)))
+		return
+	}
+	logger.Debugf("event script of %v: %v", payload.Event, strings.TrimSpace(string(out)))
+}
@@ -0,0 +1,97 @@
+package service
+
+import (
+	"strconv"
+	"strings"
+	"x-ui/database"
+	"x-ui/database/model"
+	"x-ui/util/common"
+	"x-ui/util/porthop"
+
+	"gorm.io/gorm"
+)
+
+// inPortHopping tells whether port is in the port hopping range of the inbound
+func inPortHopping(inbound *model.Inbound, port int) bool {
+	if inbound.PortHopping == "" {
+		return false
+	}
+	start, end, err := porthop.ParseRange(inbound.PortHopping)
+	return err == nil && port >= start && port <= end
+}
+
+// checkExtraPorts normalizes the extra ports of the inbound to a comma separated list, xray listens on
+// them like on its port. None of its ports may be a port of another inbound or in its port hopping range,
+// nor the port of a port forward
+func (s *InboundServiceImpl) checkExtraPorts(inbound *model.Inbound) error {
+	seen := map[int]bool{inbound.Port: true}
+	extraPorts := make([]string, 0)
+	for _, field := range strings.Split(inbound.ExtraPorts, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		port, err := strconv.Atoi(field)
+		if err != nil || port < 1 || port > 65535 {
+			return common.NewError("extra ports must be a comma separated list of ports:", field)
+		}
+		if seen[port] {
+			return common.NewError("port is listed twice:", port)
+		}
+		if inPortHopping(inbound, port) {
+			return common.NewError("port is in the port hopping range of the inbound:", port)
+		}
+		seen[port] = true
+		extraPorts = append(extraPorts, strconv.Itoa(port))
+	}
+	inbound.ExtraPorts = strings.Join(extraPorts, ",")
+
+	inbounds, err := s.GetAllInbounds()
+	if err != nil {
+		return err
+	}
+	ports := inbound.Ports()
+	for _, other := range inbounds {
+		if other.Id == inbound.Id {
+			continue
+		}
+		for _, otherPort := range other.Ports() {
+			if seen[otherPort] {
+				return common.NewErrorf("port %v is used by inbound %v", otherPort, other.Remark)
+			}
+		}
+		for _, port := range ports {
+			if inPortHopping(other, port) {
+				return common.NewErrorf("port %v is in the port hopping range of inbound %v", port, other.Remark)
+			}
+		}
+	}
+	forward := &model.PortForward{}
+	err = database.GetDB().Model(model.PortForward{}).Where("port in ?", ports).First(forward).Error
+	if err == nil {
+		return common.NewErrorf("port %v is used by port forward %v", forward.Port, forward.Remark)
+	}
+	if err != gorm.ErrRecordNotFound {
+		return err
+	}
+	return nil
+}
+
+// GenLinks returns the share link of the client for every port of the inbound, the ones of extra ports
+// carry the port in their remark so apps tell them apart
+func GenLinks(inbound *model.Inbound, email string, address string) ([]string, error) {
+	links := make([]string, 0)
+	for i, port := range inbound.Ports() {
+		portInbound := *inbound
+		portInbound.Port = port
+		if i > 0 {
+			portInbound.Remark = inbound.Remark + "-" + strconv.Itoa(port)
+		}
+		link, err := GenLink(&portInbound, email, address)
+		if err != nil {
+			return nil, err
+		}
+		links = append(links, link)
+	}
+	return links, nil
+}
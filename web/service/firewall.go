@@ -0,0 +1,115 @@
+package service
+
+import (
+	"encoding/json"
+	"net"
+	"strings"
+	"sync"
+	"x-ui/database/model"
+	"x-ui/logger"
+	"x-ui/util/firewall"
+	"x-ui/util/porthop"
+)
+
+var firewallLock sync.Mutex
+
+// FirewallService opens the ports of enabled inbounds and of the panel in the host firewall and closes
+// the ones it opened for inbounds that are gone, through the driver of the firewallDriver setting
+type FirewallService struct {
+	inboundService     InboundServiceImpl
+	settingService     SettingService
+	portForwardService PortForwardService
+}
+
+// inboundUdp tells whether clients reach the inbound over udp
+func inboundUdp(inbound *model.Inbound) bool {
+	switch inbound.Protocol {
+	case model.Shadowsocks:
+		return true
+	case model.Dokodemo:
+		settings := map[string]interface{}{}
+		json.Unmarshal([]byte(inbound.Settings), &settings)
+		network, _ := settings["network"].(string)
+		return strings.Contains(network, "udp")
+	}
+	return hopsUdp(inbound)
+}
+
+// GetWantedPorts returns the ports that must be open: the panel port, the ports of enabled inbounds,
+// extra ones included, with their port hopping ranges and the ones of enabled port forwards
+func (s *FirewallService) GetWantedPorts() ([]firewall.Port, error) {
+	webPort, err := s.settingService.GetPort()
+	if err != nil {
+		return nil, err
+	}
+	ports := []firewall.Port{{Start: webPort, End: webPort, Proto: "tcp"}}
+	inbounds, err := s.inboundService.GetAllInbounds()
+	if err != nil {
+		return nil, err
+	}
+	for _, inbound := range inbounds {
+		// inbounds on a loopback address are only reached through another one, e.g. as a fallback
+		if ip := net.ParseIP(inbound.Listen); !inbound.Enable || (ip != nil && ip.IsLoopback()) {
+			continue
+		}
+		for _, port := range inbound.Ports() {
+			ports = append(ports, firewall.Port{Start: port, End: port, Proto: "tcp"})
+			if inboundUdp(inbound) {
+				ports = append(ports, firewall.Port{Start: port, End: port, Proto: "udp"})
+			}
+		}
+		if inbound.PortHopping != "" {
+			start, end, err := porthop.ParseRange(inbound.PortHopping)
+			if err == nil {
+				ports = append(ports, firewall.Port{Start: start, End: end, Proto: "udp"})
+			}
+		}
+	}
+	forwards, err := s.portForwardService.GetPortForwards()
+	if err != nil {
+		return nil, err
+	}
+	for _, forward := range forwards {
+		if ip := net.ParseIP(forward.Listen); !forward.Enable || (ip != nil && ip.IsLoopback()) {
+			continue
+		}
+		for _, proto := range strings.Split(forward.Network, ",") {
+			ports = append(ports, firewall.Port{Start: forward.Port, End: forward.Port, Proto: proto})
+		}
+	}
+	return ports, nil
+}
+
+// ApplyFirewall reconciles the firewall with GetWantedPorts and returns the changes, with dryRun or the
+// firewallDryRun setting they are only returned and logged. It does nothing without a firewall driver
+func (s *FirewallService) ApplyFirewall(dryRun bool) ([]firewall.Change, error) {
+	name, err := s.settingService.GetFirewallDriver()
+	if err != nil || name == "" {
+		return nil, err
+	}
+	settingDryRun, err := s.settingService.GetFirewallDryRun()
+	if err != nil {
+		return nil, err
+	}
+	dryRun = dryRun || settingDryRun
+	driver, err := firewall.New(name)
+	if err != nil {
+		return nil, err
+	}
+	ports, err := s.GetWantedPorts()
+	if err != nil {
+		return nil, err
+	}
+
+	firewallLock.Lock()
+	defer firewallLock.Unlock()
+	changes, err := firewall.Reconcile(driver, ports, dryRun)
+	for _, change := range changes {
+		if dryRun {
+			logger.Infof("firewall dry run: would %v %v", change.Action, change.Port)
+		} else {
+			logger.Infof("firewall: %v %v", change.Action, change.Port)
+		}
+	}
+	return changes, err
+}
@@ -0,0 +1,77 @@
+package service
+
+import (
+	"encoding/json"
+	"strings"
+	"x-ui/database/model"
+	"x-ui/util/common"
+)
+
+// checkClientFlow fails with the reason if xray would refuse the flow of a client, flows are only understood
+// by vless, and by trojan for the old xtls ones, each with its own transport and security
+func checkClientFlow(inbound *model.Inbound, email string, flow string) error {
+	if flow == "" {
+		return nil
+	}
+	stream := map[string]interface{}{}
+	if inbound.StreamSettings != "" {
+		err := json.Unmarshal([]byte(inbound.StreamSettings), &stream)
+		if err != nil {
+			return err
+		}
+	}
+	network := streamString(stream, "network")
+	if network == "" {
+		network = "tcp"
+	}
+	security := streamString(stream, "security")
+	if security == "" {
+		security = "none"
+	}
+	base := strings.TrimSuffix(flow, "-udp443")
+
+	switch base {
+	case "xtls-rprx-vision":
+		if inbound.Protocol != model.VLESS {
+			return common.NewErrorf("client %v: flow %v is only supported by vless, not %v", email, flow, inbound.Protocol)
+		}
+		if network != "tcp" || (security != "tls" && security != "reality") {
+			return common.NewErrorf("client %v: flow %v needs tcp with tls or reality, the inbound uses %v with %v",
+				email, flow, network, security)
+		}
+	case "xtls-rprx-direct", "xtls-rprx-origin", "xtls-rprx-splice":
+		if inbound.Protocol != model.VLESS && inbound.Protocol != model.Trojan {
+			return common.NewErrorf("client %v: flow %v is only supported by vless and trojan, not %v", email, flow, inbound.Protocol)
+		}
+		if security != "xtls" {
+			return common.NewErrorf("client %v: flow %v needs xtls security, the inbound uses %v", email, flow, security)
+		}
+		if network != "tcp" && network != "kcp" && network != "domainsocket" {
+			return common.NewErrorf("client %v: flow %v needs tcp, kcp or domainsocket, the inbound uses %v", email, flow, network)
+		}
+	default:
+		return common.NewErrorf("client %v: unknown flow %v", email, flow)
+	}
+	return nil
+}
+
+// checkInboundFlows checks the flow of every client of the inbound
+func checkInboundFlows(inbound *model.Inbound) error {
+	_, clients, err := parseClients(inbound)
+	if err != nil {
+		return err
+	}
+	for _, client := range clients {
+		c, ok := client.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		email, _ := c["email"].(string)
+		flow, _ := c["flow"].(string)
+		err = checkClientFlow(inbound, email, flow)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,206 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	"x-ui/logger"
+	"x-ui/util/common"
+	"x-ui/util/geoip"
+	"x-ui/xray"
+)
+
+// geo files larger than this are refused, the full lists are a few tens of megabytes
+const maxGeoFileSize = 256 << 20
+
+// GeoService updates geoip.dat and geosite.dat from the configured urls. A file is only swapped in
+// after its sha256 matches <url>.sha256sum, its signature <url>.sig matches the signing key if one is
+// set and it parses as a list
+type GeoService struct {
+	settingService SettingService
+	xrayService    XrayService
+}
+
+func downloadGeo(ctx context.Context, client *http.Client, url string, limit int64) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, common.NewErrorf("download %v failed: %v", url, resp.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > limit {
+		return nil, common.NewErrorf("%v is larger than %v bytes", url, limit)
+	}
+	return data, nil
+}
+
+// verifyGeo checks the checksum and signature published next to the file
+func verifyGeo(ctx context.Context, client *http.Client, url string, data []byte, signingKey string) error {
+	sumFile, err := downloadGeo(ctx, client, url+".sha256sum", 4096)
+	if err != nil {
+		return err
+	}
+	// sha256sum format, the hash followed by the file name
+	fields := strings.Fields(string(sumFile))
+	if len(fields) == 0 {
+		return common.NewError("checksum file is empty:", url+".sha256sum")
+	}
+	sum := sha256.Sum256(data)
+	if !strings.EqualFold(fields[0], hex.EncodeToString(sum[:])) {
+		return common.NewError("checksum mismatch:", url)
+	}
+
+	if signingKey == "" {
+		return nil
+	}
+	key, err := base64.StdEncoding.DecodeString(signingKey)
+	if err != nil || len(key) != ed25519.PublicKeySize {
+		return common.NewError("geo signing key must be a base64 ed25519 public key")
+	}
+	signature, err := downloadGeo(ctx, client, url+".sig", 4096)
+	if err != nil {
+		return err
+	}
+	// raw signatures and base64 ones are both accepted
+	if len(signature) != ed25519.SignatureSize {
+		signature, err = base64.StdEncoding.DecodeString(string(bytes.TrimSpace(signature)))
+		if err != nil {
+			return common.NewError("signature is neither raw nor base64:", url+".sig")
+		}
+	}
+	if !ed25519.Verify(ed25519.PublicKey(key), data, signature) {
+		return common.NewError("signature mismatch:", url)
+	}
+	return nil
+}
+
+// fileSha256 hashes the file at path, a missing file has no hash
+func fileSha256(path string) ([]byte, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	hash := sha256.New()
+	_, err = io.Copy(hash, file)
+	if err != nil {
+		return nil, err
+	}
+	return hash.Sum(nil), nil
+}
+
+// updateGeoFile downloads and verifies the file and swaps it in with a rename, so xray never reads
+// half a file. It reports false and keeps the file when the download is the same as it
+func (s *GeoService) updateGeoFile(ctx context.Context, client *http.Client, url string, path string, signingKey string) (bool, error) {
+	data, err := downloadGeo(ctx, client, url, maxGeoFileSize)
+	if err != nil {
+		return false, err
+	}
+	err = verifyGeo(ctx, client, url, data, signingKey)
+	if err != nil {
+		return false, err
+	}
+	sum := sha256.Sum256(data)
+	if current, err := fileSha256(path); err == nil && bytes.Equal(current, sum[:]) {
+		logger.Debugf("%v is the same as %v, keeping it", path, url)
+		return false, nil
+	}
+	names, err := geoip.ListNames(data)
+	if err != nil || len(names) == 0 {
+		return false, common.NewError("not a geo data file:", url)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return false, err
+	}
+	defer os.Remove(tmp.Name())
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return false, err
+	}
+	err = os.Chmod(tmp.Name(), 0644)
+	if err != nil {
+		return false, err
+	}
+	err = os.Rename(tmp.Name(), path)
+	if err != nil {
+		return false, err
+	}
+	logger.Infof("updated %v from %v, %v lists", path, url, len(names))
+	return true, nil
+}
+
+// UpdateGeoFiles updates the geo files that have a url set and restarts xray if one of them changed, an
+// empty url keeps the file that came with xray. Cancelling ctx stops the downloads
+func (s *GeoService) UpdateGeoFiles(ctx context.Context) error {
+	geoipUrl, err := s.settingService.GetGeoipUrl()
+	if err != nil {
+		return err
+	}
+	geositeUrl, err := s.settingService.GetGeositeUrl()
+	if err != nil {
+		return err
+	}
+	signingKey, err := s.settingService.GetGeoSigningKey()
+	if err != nil {
+		return err
+	}
+	if geoipUrl == "" && geositeUrl == "" {
+		return nil
+	}
+
+	client := &http.Client{Timeout: time.Minute * 5}
+	errs := make([]error, 0)
+	updated := false
+	if geoipUrl != "" {
+		changed, err := s.updateGeoFile(ctx, client, geoipUrl, xray.GetGeoipPath(), signingKey)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("geoip: %v", err))
+		} else if changed {
+			updated = true
+			// the countries of the online clients and the traffic by country come from it
+			if err := s.settingService.LoadGeoip(); err != nil {
+				logger.Warning("load geoip databases failed:", err)
+			}
+		}
+	}
+	if geositeUrl != "" {
+		changed, err := s.updateGeoFile(ctx, client, geositeUrl, xray.GetGeositePath(), signingKey)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("geosite: %v", err))
+		} else if changed {
+			updated = true
+		}
+	}
+	if updated {
+		err := s.xrayService.RestartXray(true)
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return common.Combine(errs...)
+}
@@ -1,6 +1,7 @@
 package service
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"github.com/google/uuid"
@@ -10,12 +11,16 @@ import (
 	"x-ui/database/model"
 	"x-ui/logger"
 	"x-ui/util/common"
+	"x-ui/web/entity"
+	"x-ui/web/locale"
 	"x-ui/xray"
 
 	"gorm.io/gorm"
 )
 
 type InboundServiceImpl struct {
+	webhookService WebhookService
+	notifyService  NotifyService
 }
 
 func (s *InboundServiceImpl) GetInbounds(userId int) ([]*model.Inbound, error) {
@@ -29,6 +34,24 @@ func (s *InboundServiceImpl) GetInbounds(userId int) ([]*model.Inbound, error) {
 	return inbounds, nil
 }
 
+// GetInboundsPage returns a page of the inbounds of the user, only the inbounds of the page are read
+func (s *InboundServiceImpl) GetInboundsPage(userId int, q *entity.PageQuery) (*entity.Page, error) {
+	db := database.GetDB().Where("user_id = ?", userId)
+	db, total, err := pageDb(db, model.Inbound{}, q)
+	if err != nil {
+		return nil, err
+	}
+	inbounds := make([]*model.Inbound, 0, q.Size)
+	err = db.Preload("ClientStats").Find(&inbounds).Error
+	if err != nil {
+		return nil, err
+	}
+	return &entity.Page{Items: inbounds, Total: total, Page: q.Page, Size: q.Size}, nil
+}
+
+// GetAllInbounds reads every inbound with its settings and client stats at once. It is for the readers that need
+// the clients in the settings of all inbounds together, like the default list of the UI and subscriptions. Readers
+// of traffic use GetAllInboundTraffics, readers that take one inbound at a time EachInbound
 func (s *InboundServiceImpl) GetAllInbounds() ([]*model.Inbound, error) {
 	db := database.GetDB()
 	var inbounds []*model.Inbound
@@ -39,6 +62,37 @@ func (s *InboundServiceImpl) GetAllInbounds() ([]*model.Inbound, error) {
 	return inbounds, nil
 }
 
+// inboundTrafficColumns are the columns of inbounds readers of traffic need, without the settings that grow with
+// the clients
+var inboundTrafficColumns = []string{"id", "user_id", "remark", "tag", "protocol", "enable", "up", "down", "total", "expiry_time"}
+
+// GetAllInboundTraffics returns every inbound with its client stats, but only the columns of inboundTrafficColumns
+func (s *InboundServiceImpl) GetAllInboundTraffics() ([]*model.Inbound, error) {
+	db := database.GetDB()
+	var inbounds []*model.Inbound
+	err := db.Model(model.Inbound{}).Select(inboundTrafficColumns).Preload("ClientStats").Find(&inbounds).Error
+	if err != nil && err != gorm.ErrRecordNotFound {
+		return nil, err
+	}
+	return inbounds, nil
+}
+
+// EachInbound calls fn with every inbound and its client stats, reading 100 inbounds at a time so only those are
+// in memory together. An error of fn stops the reading and is returned
+func (s *InboundServiceImpl) EachInbound(fn func(inbound *model.Inbound) error) error {
+	var inbounds []*model.Inbound
+	return database.GetDB().Model(model.Inbound{}).Preload("ClientStats").
+		FindInBatches(&inbounds, 100, func(tx *gorm.DB, batch int) error {
+			for _, inbound := range inbounds {
+				err := fn(inbound)
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		}).Error
+}
+
 func (s *InboundServiceImpl) checkPortExist(port int, ignoreId int) (bool, error) {
 	db := database.GetDB()
 	db = db.Model(model.Inbound{}).Where("port = ?", port)
@@ -67,48 +121,109 @@ func (s *InboundServiceImpl) getClients(inbound *model.Inbound) ([]model.Client,
 	return clients, nil
 }
 
-func (s *InboundServiceImpl) checkEmailsExist(emails map[string]bool, ignoreId int) (string, error) {
+// clientId returns the credential of a client, the uuid of vmess and vless or the password of trojan
+func clientId(client model.Client) string {
+	if client.ID != "" {
+		return client.ID
+	}
+	return client.Password
+}
+
+// getOtherClients returns the clients of all inbounds but the one with ignoreId
+func (s *InboundServiceImpl) getOtherClients(ignoreId int) ([]model.Client, error) {
 	db := database.GetDB()
 	var inbounds []*model.Inbound
-	db = db.Model(model.Inbound{}).Where("Protocol in ?", []model.Protocol{model.VMess, model.VLESS, model.Trojan})
+	db = db.Model(model.Inbound{}).Select("id", "settings").Where("Protocol in ?", []model.Protocol{model.VMess, model.VLESS, model.Trojan})
 	if ignoreId > 0 {
 		db = db.Where("id != ?", ignoreId)
 	}
 	db = db.Find(&inbounds)
 	if db.Error != nil {
-		return "", db.Error
+		return nil, db.Error
 	}
 
+	others := make([]model.Client, 0)
 	for _, inbound := range inbounds {
 		clients, err := s.getClients(inbound)
 		if err != nil {
-			return "", err
+			return nil, err
 		}
+		others = append(others, clients...)
+	}
+	return others, nil
+}
 
-		for _, client := range clients {
-			if emails[client.Email] {
-				return client.Email, nil
-			}
+func (s *InboundServiceImpl) checkEmailsExist(emails map[string]bool, ignoreId int) (string, error) {
+	clients, err := s.getOtherClients(ignoreId)
+	if err != nil {
+		return "", err
+	}
+	for _, client := range clients {
+		if emails[client.Email] {
+			return client.Email, nil
 		}
 	}
 	return "", nil
 }
 
-func (s *InboundServiceImpl) checkEmailExistForInbound(inbound *model.Inbound) (string, error) {
-	clients, err := s.getClients(inbound)
+// checkClientIdsExist finds an id of ids used by a client of another inbound, clients may share ids across
+// inbounds unless the uniqueClientIds setting is on
+func (s *InboundServiceImpl) checkClientIdsExist(ids map[string]bool, ignoreId int) (string, error) {
+	settingService := SettingService{}
+	unique, err := settingService.GetUniqueClientIds()
+	if err != nil || !unique {
+		return "", err
+	}
+	clients, err := s.getOtherClients(ignoreId)
 	if err != nil {
 		return "", err
 	}
+	for _, client := range clients {
+		if ids[clientId(client)] {
+			return clientId(client), nil
+		}
+	}
+	return "", nil
+}
+
+// checkClientsUnique fails if two clients of the inbound share an email or a uuid or password, or a client of it
+// and one of another inbound share an email, the email is the key of stats, ip limits and subscriptions
+func (s *InboundServiceImpl) checkClientsUnique(inbound *model.Inbound) error {
+	clients, err := s.getClients(inbound)
+	if err != nil {
+		return err
+	}
 	emails := make(map[string]bool)
+	ids := make(map[string]bool)
 	for _, client := range clients {
 		if client.Email != "" {
 			if emails[client.Email] {
-				return client.Email, nil
+				return common.NewError("Duplicate email:", client.Email)
 			}
 			emails[client.Email] = true
 		}
+		if id := clientId(client); id != "" {
+			if ids[id] {
+				return common.NewError("Duplicate client id:", id)
+			}
+			ids[id] = true
+		}
+	}
+	existEmail, err := s.checkEmailsExist(emails, inbound.Id)
+	if err != nil {
+		return err
 	}
-	return s.checkEmailsExist(emails, inbound.Id)
+	if existEmail != "" {
+		return common.NewError("Duplicate email:", existEmail)
+	}
+	existId, err := s.checkClientIdsExist(ids, inbound.Id)
+	if err != nil {
+		return err
+	}
+	if existId != "" {
+		return common.NewError("Duplicate client id:", existId)
+	}
+	return nil
 }
 
 func (s *InboundServiceImpl) AddInbound(inbound *model.Inbound) (*model.Inbound, error) {
@@ -120,12 +235,49 @@ func (s *InboundServiceImpl) AddInbound(inbound *model.Inbound) (*model.Inbound,
 		return inbound, common.NewError("Port already exists:", inbound.Port)
 	}
 
-	existEmail, err := s.checkEmailExistForInbound(inbound)
+	err = normalizeCountries(inbound)
 	if err != nil {
 		return inbound, err
 	}
-	if existEmail != "" {
-		return inbound, common.NewError("Duplicate email:", existEmail)
+
+	err = checkInboundCertificate(inbound)
+	if err != nil {
+		return inbound, err
+	}
+
+	err = checkInboundMux(inbound)
+	if err != nil {
+		return inbound, err
+	}
+
+	err = checkStreamSettings(inbound)
+	if err != nil {
+		return inbound, err
+	}
+
+	err = s.checkPortHopping(inbound)
+	if err != nil {
+		return inbound, err
+	}
+
+	err = s.checkExtraPorts(inbound)
+	if err != nil {
+		return inbound, err
+	}
+
+	err = checkInboundFlows(inbound)
+	if err != nil {
+		return inbound, err
+	}
+
+	err = checkClientSchedules(inbound)
+	if err != nil {
+		return inbound, err
+	}
+
+	err = s.checkClientsUnique(inbound)
+	if err != nil {
+		return inbound, err
 	}
 
 	db := database.GetDB()
@@ -137,8 +289,17 @@ func (s *InboundServiceImpl) AddInbound(inbound *model.Inbound) (*model.Inbound,
 	return inbound, err
 }
 
-func (s *InboundServiceImpl) AddInbounds(inbounds []*model.Inbound) error {
+// AddInbounds adds all inbounds or none of them, ports and client emails are checked against the
+// database and each other before anything is written
+func (s *InboundServiceImpl) AddInbounds(inbounds []*model.Inbound) (err error) {
+	ports := map[int]bool{}
+	emails := map[string]bool{}
+	ids := map[string]bool{}
 	for _, inbound := range inbounds {
+		if ports[inbound.Port] {
+			return common.NewError("Port already exists:", inbound.Port)
+		}
+		ports[inbound.Port] = true
 		exist, err := s.checkPortExist(inbound.Port, 0)
 		if err != nil {
 			return err
@@ -146,11 +307,65 @@ func (s *InboundServiceImpl) AddInbounds(inbounds []*model.Inbound) error {
 		if exist {
 			return common.NewError("Port already exists:", inbound.Port)
 		}
+
+		err = checkStreamSettings(inbound)
+		if err != nil {
+			return err
+		}
+		err = s.checkExtraPorts(inbound)
+		if err != nil {
+			return err
+		}
+		for _, port := range inbound.Ports()[1:] {
+			if ports[port] {
+				return common.NewError("Port already exists:", port)
+			}
+			ports[port] = true
+		}
+		err = checkInboundFlows(inbound)
+		if err != nil {
+			return err
+		}
+		err = checkClientSchedules(inbound)
+		if err != nil {
+			return err
+		}
+		clients, err := s.getClients(inbound)
+		if err != nil {
+			return err
+		}
+		for _, client := range clients {
+			if client.Email != "" {
+				if emails[client.Email] {
+					return common.NewError("Duplicate email:", client.Email)
+				}
+				emails[client.Email] = true
+			}
+			if id := clientId(client); id != "" {
+				if ids[id] {
+					return common.NewError("Duplicate client id:", id)
+				}
+				ids[id] = true
+			}
+		}
+	}
+	existEmail, err := s.checkEmailsExist(emails, 0)
+	if err != nil {
+		return err
+	}
+	if existEmail != "" {
+		return common.NewError("Duplicate email:", existEmail)
+	}
+	existId, err := s.checkClientIdsExist(ids, 0)
+	if err != nil {
+		return err
+	}
+	if existId != "" {
+		return common.NewError("Duplicate client id:", existId)
 	}
 
 	db := database.GetDB()
 	tx := db.Begin()
-	var err error
 	defer func() {
 		if err == nil {
 			tx.Commit()
@@ -167,6 +382,10 @@ func (s *InboundServiceImpl) AddInbounds(inbounds []*model.Inbound) error {
 		if err != nil {
 			return err
 		}
+		err = s.updateClientStat(tx, inbound.Id, inbound.Settings)
+		if err != nil {
+			return err
+		}
 	}
 
 	return nil
@@ -196,24 +415,89 @@ func (s *InboundServiceImpl) UpdateInbound(inbound *model.Inbound) (*model.Inbou
 		return inbound, common.NewError("Port already exists:", inbound.Port)
 	}
 
-	existEmail, err := s.checkEmailExistForInbound(inbound)
+	err = normalizeCountries(inbound)
 	if err != nil {
 		return inbound, err
 	}
-	if existEmail != "" {
-		return inbound, common.NewError("Duplicate email:", existEmail)
+
+	err = checkInboundCertificate(inbound)
+	if err != nil {
+		return inbound, err
+	}
+
+	err = checkInboundMux(inbound)
+	if err != nil {
+		return inbound, err
 	}
 
-	oldInbound, err := s.GetInbound(inbound.Id)
+	err = checkStreamSettings(inbound)
 	if err != nil {
 		return inbound, err
 	}
+
+	err = s.checkPortHopping(inbound)
+	if err != nil {
+		return inbound, err
+	}
+
+	err = s.checkExtraPorts(inbound)
+	if err != nil {
+		return inbound, err
+	}
+
+	err = checkInboundFlows(inbound)
+	if err != nil {
+		return inbound, err
+	}
+
+	err = checkClientSchedules(inbound)
+	if err != nil {
+		return inbound, err
+	}
+
+	err = s.checkClientsUnique(inbound)
+	if err != nil {
+		return inbound, err
+	}
+
+	db := database.GetDB()
+	err = db.Transaction(func(tx *gorm.DB) error {
+		return s.updateInbound(tx, inbound)
+	})
+	return inbound, err
+}
+
+// updateInbound saves the inbound, the cycle of a traffic reset is archived in the same transaction so it is
+// neither lost nor archived twice
+func (s *InboundServiceImpl) updateInbound(tx *gorm.DB, inbound *model.Inbound) error {
+	oldInbound := &model.Inbound{}
+	err := tx.Model(model.Inbound{}).First(oldInbound, inbound.Id).Error
+	if err != nil {
+		return err
+	}
+	if inbound.Up == 0 && inbound.Down == 0 {
+		// the traffic of the inbound is reset, keep what it used
+		err = archiveReset(tx, "inbound", oldInbound.Tag, oldInbound.Up, oldInbound.Down)
+		if err != nil {
+			return err
+		}
+	}
 	oldInbound.Up = inbound.Up
 	oldInbound.Down = inbound.Down
 	oldInbound.Total = inbound.Total
 	oldInbound.Remark = inbound.Remark
 	oldInbound.Enable = inbound.Enable
 	oldInbound.ExpiryTime = inbound.ExpiryTime
+	oldInbound.ResetDay = inbound.ResetDay
+	oldInbound.CountryMode = inbound.CountryMode
+	oldInbound.Countries = inbound.Countries
+	oldInbound.CertificateId = inbound.CertificateId
+	oldInbound.MuxConcurrency = inbound.MuxConcurrency
+	oldInbound.XudpConcurrency = inbound.XudpConcurrency
+	oldInbound.XudpProxyUDP443 = inbound.XudpProxyUDP443
+	oldInbound.PortHopping = inbound.PortHopping
+	oldInbound.ExtraPorts = inbound.ExtraPorts
+	oldInbound.Notes = inbound.Notes
 	oldInbound.Listen = inbound.Listen
 	oldInbound.Port = inbound.Port
 	oldInbound.Protocol = inbound.Protocol
@@ -222,9 +506,11 @@ func (s *InboundServiceImpl) UpdateInbound(inbound *model.Inbound) (*model.Inbou
 	oldInbound.Sniffing = inbound.Sniffing
 	oldInbound.Tag = fmt.Sprintf("inbound-%v", inbound.Port)
 
-	s.UpdateClientStat(inbound.Id, inbound.Settings)
-	db := database.GetDB()
-	return inbound, db.Save(oldInbound).Error
+	err = s.updateClientStat(tx, inbound.Id, inbound.Settings)
+	if err != nil {
+		return err
+	}
+	return tx.Save(oldInbound).Error
 }
 
 func (s *InboundServiceImpl) AddTraffic(traffics []*xray.Traffic) (err error) {
@@ -232,7 +518,6 @@ func (s *InboundServiceImpl) AddTraffic(traffics []*xray.Traffic) (err error) {
 		return nil
 	}
 	db := database.GetDB()
-	db = db.Model(model.Inbound{})
 	tx := db.Begin()
 	defer func() {
 		if err != nil {
@@ -241,27 +526,30 @@ func (s *InboundServiceImpl) AddTraffic(traffics []*xray.Traffic) (err error) {
 			tx.Commit()
 		}
 	}()
+	return s.addTraffic(tx, traffics)
+}
+
+func (s *InboundServiceImpl) addTraffic(tx *gorm.DB, traffics []*xray.Traffic) error {
 	for _, traffic := range traffics {
 		if traffic.IsInbound {
-			err = tx.Where("tag = ?", traffic.Tag).
+			err := tx.Model(model.Inbound{}).
+				Where("tag = ?", traffic.Tag).
 				UpdateColumns(map[string]interface{}{
 					"up":   gorm.Expr("up + ?", traffic.Up),
 					"down": gorm.Expr("down + ?", traffic.Down)}).Error
 			if err != nil {
-				return
+				return err
 			}
 		}
 	}
-	return
+	return nil
 }
-func (s *InboundServiceImpl) AddClientTraffic(traffics []*xray.ClientTraffic) (err error) {
+
+func (s *InboundServiceImpl) AddClientTraffic(ctx context.Context, traffics []*xray.ClientTraffic) (err error) {
 	if len(traffics) == 0 {
 		return nil
 	}
-	db := database.GetDB()
-	dbInbound := db.Model(model.Inbound{})
-
-	db = db.Model(xray.ClientTraffic{})
+	db := database.GetDB().WithContext(ctx)
 	tx := db.Begin()
 	defer func() {
 		if err != nil {
@@ -270,81 +558,111 @@ func (s *InboundServiceImpl) AddClientTraffic(traffics []*xray.ClientTraffic) (e
 			tx.Commit()
 		}
 	}()
-	txInbound := dbInbound.Begin()
-	defer func() {
-		if err != nil {
-			txInbound.Rollback()
-		} else {
-			txInbound.Commit()
-		}
-	}()
-
-	for _, traffic := range traffics {
-		inbound := &model.Inbound{}
-
-		err := txInbound.Where("settings like ?", "%"+traffic.Email+"%").First(inbound).Error
-		traffic.InboundId = inbound.Id
-		if err != nil {
-			if err == gorm.ErrRecordNotFound {
-				// delete removed client record
-				clientErr := s.DelClientStat(tx, traffic.Email)
-				logger.Warning(err, traffic.Email, clientErr)
+	return s.addClientTraffic(tx, traffics)
+}
 
-			}
-			continue
-		}
-		// get settings clients
+// addClientTraffic adds up the counters of clients, failures of single clients are only logged
+func (s *InboundServiceImpl) addClientTraffic(tx *gorm.DB, traffics []*xray.ClientTraffic) error {
+	var inbounds []*model.Inbound
+	err := tx.Model(model.Inbound{}).Find(&inbounds).Error
+	if err != nil {
+		return err
+	}
+	// the inbound and settings of every client, parsed once instead of searched per client
+	inboundIds := map[string]int{}
+	clients := map[string]model.Client{}
+	for _, inbound := range inbounds {
 		settings := map[string][]model.Client{}
 		json.Unmarshal([]byte(inbound.Settings), &settings)
-		clients := settings["clients"]
-		for _, client := range clients {
-			if traffic.Email == client.Email {
-				traffic.ExpiryTime = client.ExpiryTime
-				traffic.Total = client.TotalGB
+		for _, client := range settings["clients"] {
+			if _, ok := inboundIds[client.Email]; !ok {
+				inboundIds[client.Email] = inbound.Id
+				clients[client.Email] = client
 			}
 		}
-		if tx.Where("inbound_id = ?", inbound.Id).Where("email = ?", traffic.Email).
+	}
+
+	for _, traffic := range traffics {
+		inboundId, ok := inboundIds[traffic.Email]
+		if !ok {
+			// delete removed client record
+			clientErr := s.DelClientStat(tx, traffic.Email)
+			logger.Warning("client not found:", traffic.Email, clientErr)
+			continue
+		}
+		traffic.InboundId = inboundId
+		traffic.ExpiryTime = clients[traffic.Email].ExpiryTime
+		traffic.Total = clients[traffic.Email].TotalGB
+
+		result := tx.Model(xray.ClientTraffic{}).
+			Where("inbound_id = ?", inboundId).Where("email = ?", traffic.Email).
 			UpdateColumns(map[string]interface{}{
 				"enable":      true,
 				"expiry_time": traffic.ExpiryTime,
 				"total":       traffic.Total,
 				"up":          gorm.Expr("up + ?", traffic.Up),
-				"down":        gorm.Expr("down + ?", traffic.Down)}).RowsAffected == 0 {
+				"down":        gorm.Expr("down + ?", traffic.Down)})
+		err = result.Error
+		if err == nil && result.RowsAffected == 0 {
 			err = tx.Create(traffic).Error
 		}
-
 		if err != nil {
 			logger.Warning("AddClientTraffic update data ", err)
-			continue
 		}
-
 	}
-	return
+	return nil
 }
 
-func (s *InboundServiceImpl) DisableInvalidInbounds() (int64, error) {
-	db := database.GetDB()
+func (s *InboundServiceImpl) DisableInvalidInbounds(ctx context.Context) (int64, error) {
+	db := database.GetDB().WithContext(ctx)
 	now := time.Now().Unix() * 1000
-	result := db.Model(model.Inbound{}).
+	var tags []string
+	err := db.Model(model.Inbound{}).
 		Where("((total > 0 and up + down >= total) or (expiry_time > 0 and expiry_time <= ?)) and enable = ?", now, true).
+		Pluck("tag", &tags).Error
+	if err != nil || len(tags) == 0 {
+		return 0, err
+	}
+	result := db.Model(model.Inbound{}).
+		Where("tag in ?", tags).
 		Update("enable", false)
-	err := result.Error
+	err = result.Error
 	count := result.RowsAffected
+	if err == nil {
+		for _, tag := range tags {
+			s.webhookService.Dispatch(EventInboundDepleted, map[string]interface{}{"tag": tag})
+		}
+	}
 	return count, err
 }
-func (s *InboundServiceImpl) DisableInvalidClients() (int64, error) {
-	db := database.GetDB()
+func (s *InboundServiceImpl) DisableInvalidClients(ctx context.Context) (int64, error) {
+	db := database.GetDB().WithContext(ctx)
 	now := time.Now().Unix() * 1000
-	result := db.Model(xray.ClientTraffic{}).
+	var emails []string
+	err := db.Model(xray.ClientTraffic{}).
 		Where("((total > 0 and up + down >= total) or (expiry_time > 0 and expiry_time <= ?)) and enable = ?", now, true).
+		Pluck("email", &emails).Error
+	if err != nil || len(emails) == 0 {
+		return 0, err
+	}
+	result := db.Model(xray.ClientTraffic{}).
+		Where("email in ?", emails).
 		Update("enable", false)
-	err := result.Error
+	err = result.Error
 	count := result.RowsAffected
+	if err == nil {
+		for _, email := range emails {
+			s.webhookService.Dispatch(EventClientDepleted, map[string]interface{}{"email": email})
+			s.NotifyClient(email, locale.I18n("tgbot.clientDepleted", "Email", email))
+		}
+	}
 	return count, err
 }
 func (s *InboundServiceImpl) UpdateClientStat(inboundId int, inboundSettings string) error {
-	db := database.GetDB()
+	return s.updateClientStat(database.GetDB(), inboundId, inboundSettings)
+}
 
+func (s *InboundServiceImpl) updateClientStat(db *gorm.DB, inboundId int, inboundSettings string) error {
 	// get settings clients
 	settings := map[string][]model.Client{}
 	json.Unmarshal([]byte(inboundSettings), &settings)
@@ -376,20 +694,121 @@ func (s *InboundServiceImpl) DelClientStat(tx *gorm.DB, email string) error {
 	return tx.Where("email = ?", email).Delete(xray.ClientTraffic{}).Error
 }
 
+// ResetClientTraffic zeroes the counters of the client, the traffic used so far is archived as a traffic cycle
 func (s *InboundServiceImpl) ResetClientTraffic(clientEmail string) error {
 	db := database.GetDB()
+	return db.Transaction(func(tx *gorm.DB) error {
+		return s.resetClientTraffic(tx, clientEmail)
+	})
+}
 
-	result := db.Model(xray.ClientTraffic{}).
+func (s *InboundServiceImpl) resetClientTraffic(tx *gorm.DB, clientEmail string) error {
+	var traffics []*xray.ClientTraffic
+	err := tx.Model(xray.ClientTraffic{}).Where("email = ?", clientEmail).Find(&traffics).Error
+	if err != nil {
+		return err
+	}
+	for _, traffic := range traffics {
+		err = archiveReset(tx, "client", traffic.Email, traffic.Up, traffic.Down)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Model(xray.ClientTraffic{}).
+		Where("email = ?", clientEmail).
+		Updates(map[string]interface{}{"up": 0, "down": 0}).
+		Error
+}
+// SetClientTraffic overwrites the counters of a client, used when importing clients from other panels
+func (s *InboundServiceImpl) SetClientTraffic(clientEmail string, up int64, down int64, enable bool) error {
+	db := database.GetDB()
+	return db.Model(xray.ClientTraffic{}).
 		Where("email = ?", clientEmail).
-		Updates(map[string]interface{}{"up": 0, "down": 0})
+		Updates(map[string]interface{}{"up": up, "down": down, "enable": enable}).
+		Error
+}
 
-	err := result.Error
+func (s *InboundServiceImpl) GetAllClientTraffics() ([]*xray.ClientTraffic, error) {
+	db := database.GetDB()
+	var traffics []*xray.ClientTraffic
+	err := db.Model(xray.ClientTraffic{}).Find(&traffics).Error
+	if err != nil {
+		return nil, err
+	}
+	err = s.setClientNotes(traffics, false)
+	if err != nil {
+		return nil, err
+	}
+	return traffics, nil
+}
 
+// GetClientTrafficsPage returns a page of the client traffics, the notes are read from the inbounds of
+// the clients of the page only
+func (s *InboundServiceImpl) GetClientTrafficsPage(q *entity.PageQuery) (*entity.Page, error) {
+	db, total, err := pageDb(database.GetDB(), xray.ClientTraffic{}, q)
+	if err != nil {
+		return nil, err
+	}
+	traffics := make([]*xray.ClientTraffic, 0, q.Size)
+	err = db.Find(&traffics).Error
+	if err != nil {
+		return nil, err
+	}
+	err = s.setClientNotes(traffics, true)
+	if err != nil {
+		return nil, err
+	}
+	return &entity.Page{Items: traffics, Total: total, Page: q.Page, Size: q.Size}, nil
+}
+
+// setClientNotes fills in the notes of the clients from the settings of the inbounds, of only their own
+// inbounds when onlyOwn is set. The inbounds are read in batches without their client stats
+func (s *InboundServiceImpl) setClientNotes(traffics []*xray.ClientTraffic, onlyOwn bool) error {
+	if len(traffics) == 0 {
+		return nil
+	}
+	db := database.GetDB().Model(model.Inbound{}).Select("id", "settings")
+	if onlyOwn {
+		ids := make([]int, 0, len(traffics))
+		for _, traffic := range traffics {
+			ids = append(ids, traffic.InboundId)
+		}
+		db = db.Where("id in ?", ids)
+	}
+	notes := map[string]string{}
+	var inbounds []*model.Inbound
+	err := db.FindInBatches(&inbounds, 100, func(tx *gorm.DB, batch int) error {
+		for _, inbound := range inbounds {
+			_, clients, err := parseClients(inbound)
+			if err != nil {
+				continue
+			}
+			for _, c := range clients {
+				if client, ok := c.(map[string]interface{}); ok {
+					email, _ := client["email"].(string)
+					notes[email], _ = client["notes"].(string)
+				}
+			}
+		}
+		return nil
+	}).Error
 	if err != nil {
 		return err
 	}
+	for _, traffic := range traffics {
+		traffic.Notes = notes[traffic.Email]
+	}
 	return nil
 }
+
+func (s *InboundServiceImpl) SetClientEnable(clientEmail string, enable bool) error {
+	db := database.GetDB()
+	return db.Model(xray.ClientTraffic{}).
+		Where("email = ?", clientEmail).
+		Update("enable", enable).
+		Error
+}
+
 func (s *InboundServiceImpl) GetClientTrafficById(uuid string) (traffic *xray.ClientTraffic, err error) {
 	db := database.GetDB()
 	inbound := &model.Inbound{}
@@ -0,0 +1,46 @@
+package service
+
+import (
+	"sync"
+)
+
+// jobHistorySize is the number of runs kept in memory across all jobs
+const jobHistorySize = 500
+
+// JobRun is one execution of a background job, Start is unix milliseconds and Duration milliseconds
+type JobRun struct {
+	Job      string `json:"job"`
+	Start    int64  `json:"start"`
+	Duration int64  `json:"duration"`
+	Success  bool   `json:"success"`
+	Error    string `json:"error"`
+	Manual   bool   `json:"manual"`
+}
+
+var jobHistory []*JobRun
+var jobHistoryLock sync.Mutex
+
+type JobHistoryService struct {
+}
+
+func (s *JobHistoryService) Record(run *JobRun) {
+	jobHistoryLock.Lock()
+	defer jobHistoryLock.Unlock()
+	jobHistory = append(jobHistory, run)
+	if len(jobHistory) > jobHistorySize {
+		jobHistory = jobHistory[len(jobHistory)-jobHistorySize:]
+	}
+}
+
+// GetHistory returns the recorded runs of the job, or of all jobs if name is empty, newest first
+func (s *JobHistoryService) GetHistory(name string) []*JobRun {
+	jobHistoryLock.Lock()
+	defer jobHistoryLock.Unlock()
+	runs := make([]*JobRun, 0)
+	for i := len(jobHistory) - 1; i >= 0; i-- {
+		if name == "" || jobHistory[i].Job == name {
+			runs = append(runs, jobHistory[i])
+		}
+	}
+	return runs
+}
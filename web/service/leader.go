@@ -0,0 +1,91 @@
+package service
+
+import (
+	"time"
+	"x-ui/logger"
+	"x-ui/util/filelock"
+
+	"go.uber.org/atomic"
+)
+
+// standby is set while another panel instance is active, a standby runs neither xray nor the jobs
+var standby atomic.Bool
+
+// the file lock is held as long as this instance is active
+var leaderFileLock *filelock.Lock
+
+// leaderHeld is when this instance last held the lock
+var leaderHeld time.Time
+
+// the active instance renews its redis lock every election, a standby takes over once it expired
+const leaderTtl = time.Second * 15
+
+// IsStandby tells whether another panel instance is active, without haLock every instance is active
+func IsStandby() bool {
+	return standby.Load()
+}
+
+// LeaderService elects the active one of redundant panel instances through the haLock setting
+type LeaderService struct {
+	settingService      SettingService
+	coordinationService CoordinationService
+	xrayService         XrayService
+}
+
+// Campaign tries to become or stay the active instance, it starts xray on taking over and stops it when
+// another instance took over
+func (s *LeaderService) Campaign() {
+	haLock, err := s.settingService.GetHaLock()
+	if err != nil {
+		logger.Warning("get high availability lock failed:", err)
+		return
+	}
+	active := true
+	if haLock != "" {
+		active, err = s.hold(haLock)
+		if err != nil {
+			logger.Warning("leader election failed:", err)
+			// the active instance stays active until its lock could have expired, a standby could
+			// take over after that
+			if !standby.Load() && time.Since(leaderHeld) < leaderTtl {
+				return
+			}
+			active = false
+		}
+		if active {
+			leaderHeld = time.Now()
+		}
+	}
+
+	if standby.Swap(!active) != active {
+		return
+	}
+	if active {
+		logger.Info("this panel instance is active now")
+		err = s.xrayService.RestartXray(true)
+		if err != nil {
+			logger.Warning("start xray failed:", err)
+		}
+	} else {
+		logger.Warning("another panel instance is active, standing by")
+		err = s.xrayService.StopXray()
+		if err != nil {
+			logger.Debug("stop xray:", err)
+		}
+	}
+}
+
+func (s *LeaderService) hold(haLock string) (bool, error) {
+	if haLock == "redis" {
+		return s.coordinationService.HoldLock("leader", leaderTtl)
+	}
+	if leaderFileLock != nil {
+		return true, nil
+	}
+	lock, ok, err := filelock.TryLock(haLock)
+	if err != nil || !ok {
+		return false, err
+	}
+	leaderFileLock = lock
+	return true, nil
+}
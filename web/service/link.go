@@ -0,0 +1,258 @@
+package service
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"x-ui/database/model"
+	"x-ui/util/common"
+)
+
+// streamValue walks nested json objects, e.g. streamValue(stream, "wsSettings", "path")
+func streamValue(stream map[string]interface{}, keys ...string) interface{} {
+	var value interface{} = stream
+	for _, key := range keys {
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		value = object[key]
+	}
+	return value
+}
+
+func streamString(stream map[string]interface{}, keys ...string) string {
+	value, _ := streamValue(stream, keys...).(string)
+	return value
+}
+
+// streamHeader returns a header value of xray's {"Host": ["a", "b"]} or {"Host": "a"} form
+func streamHeader(headers interface{}, name string) string {
+	object, _ := headers.(map[string]interface{})
+	for key, value := range object {
+		if !strings.EqualFold(key, name) {
+			continue
+		}
+		switch v := value.(type) {
+		case string:
+			return v
+		case []interface{}:
+			values := make([]string, 0, len(v))
+			for _, item := range v {
+				values = append(values, fmt.Sprint(item))
+			}
+			return strings.Join(values, ",")
+		}
+	}
+	return ""
+}
+
+func joinStrings(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case []interface{}:
+		values := make([]string, 0, len(v))
+		for _, item := range v {
+			values = append(values, fmt.Sprint(item))
+		}
+		return strings.Join(values, ",")
+	}
+	return ""
+}
+
+// firstString returns the first item of a json array of strings
+func firstString(value interface{}) string {
+	items, _ := value.([]interface{})
+	if len(items) == 0 {
+		return ""
+	}
+	item, _ := items[0].(string)
+	return item
+}
+
+// linkParams are the transport parameters shared by vless and trojan links, as the web UI builds them
+func linkParams(stream map[string]interface{}) (url.Values, string) {
+	params := url.Values{}
+	network := streamString(stream, "network")
+	if network == "" {
+		network = "tcp"
+	}
+	security := streamString(stream, "security")
+	if security == "" {
+		security = "none"
+	}
+	params.Set("type", network)
+	params.Set("security", security)
+	switch network {
+	case "tcp":
+		if streamString(stream, "tcpSettings", "header", "type") == "http" {
+			params.Set("path", joinStrings(streamValue(stream, "tcpSettings", "header", "request", "path")))
+			if host := streamHeader(streamValue(stream, "tcpSettings", "header", "request", "headers"), "host"); host != "" {
+				params.Set("host", host)
+			}
+			params.Set("headerType", "http")
+		}
+	case "kcp":
+		params.Set("headerType", streamString(stream, "kcpSettings", "header", "type"))
+		params.Set("seed", streamString(stream, "kcpSettings", "seed"))
+	case "ws":
+		params.Set("path", streamString(stream, "wsSettings", "path"))
+		if host := streamHeader(streamValue(stream, "wsSettings", "headers"), "host"); host != "" {
+			params.Set("host", host)
+		}
+	case "http":
+		params.Set("path", streamString(stream, "httpSettings", "path"))
+		params.Set("host", joinStrings(streamValue(stream, "httpSettings", "host")))
+	case "quic":
+		params.Set("quicSecurity", streamString(stream, "quicSettings", "security"))
+		params.Set("key", streamString(stream, "quicSettings", "key"))
+		params.Set("headerType", streamString(stream, "quicSettings", "header", "type"))
+	case "grpc":
+		params.Set("serviceName", streamString(stream, "grpcSettings", "serviceName"))
+		if multiMode, _ := streamValue(stream, "grpcSettings", "multiMode").(bool); multiMode {
+			params.Set("mode", "multi")
+		} else {
+			params.Set("mode", "gun")
+		}
+	case "httpupgrade":
+		params.Set("path", streamString(stream, "httpupgradeSettings", "path"))
+		params.Set("host", streamString(stream, "httpupgradeSettings", "host"))
+	case "xhttp":
+		params.Set("path", streamString(stream, "xhttpSettings", "path"))
+		params.Set("host", streamString(stream, "xhttpSettings", "host"))
+		params.Set("mode", streamString(stream, "xhttpSettings", "mode"))
+	}
+	serverName := ""
+	switch security {
+	case "tls":
+		serverName = streamString(stream, "tlsSettings", "serverName")
+		if serverName != "" {
+			params.Set("sni", serverName)
+		}
+	case "xtls":
+		serverName = streamString(stream, "xtlsSettings", "serverName")
+	case "reality":
+		// the server name of reality is the camouflage site, not the address of this server
+		params.Set("sni", firstString(streamValue(stream, "realitySettings", "serverNames")))
+		params.Set("pbk", streamString(stream, "realitySettings", "settings", "publicKey"))
+		params.Set("fp", streamString(stream, "realitySettings", "settings", "fingerprint"))
+		params.Set("sid", firstString(streamValue(stream, "realitySettings", "shortIds")))
+	}
+	return params, serverName
+}
+
+// findLinkClient returns the settings of the client with the email and the stream settings of the inbound
+func findLinkClient(inbound *model.Inbound, email string) (map[string]interface{}, map[string]interface{}, error) {
+	_, clients, err := parseClients(inbound)
+	if err != nil {
+		return nil, nil, err
+	}
+	var client map[string]interface{}
+	for _, c := range clients {
+		if object, ok := c.(map[string]interface{}); ok && object["email"] == email {
+			client = object
+		}
+	}
+	if client == nil {
+		return nil, nil, common.NewError("client not found:", email)
+	}
+	stream := map[string]interface{}{}
+	if inbound.StreamSettings != "" {
+		err = json.Unmarshal([]byte(inbound.StreamSettings), &stream)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	return client, stream, nil
+}
+
+// GenLink builds the share link of the client with the email like the web UI does, address is used
+// unless the inbound listens on a specific address or its tls names a server
+func GenLink(inbound *model.Inbound, email string, address string) (string, error) {
+	if inbound.Listen != "" && inbound.Listen != "0.0.0.0" && inbound.Listen != "::" {
+		address = inbound.Listen
+	}
+	client, stream, err := findLinkClient(inbound, email)
+	if err != nil {
+		return "", err
+	}
+	remark := inbound.Remark + "-" + email
+	params, serverName := linkParams(stream)
+	if serverName != "" {
+		address = serverName
+	}
+	flow, _ := client["flow"].(string)
+	if security := params.Get("security"); security == "tls" || security == "xtls" || security == "reality" {
+		params.Set("flow", flow)
+	}
+	hostPort := net.JoinHostPort(address, strconv.Itoa(inbound.Port))
+	// parameters of the inbound itself rather than of its transport
+	extra := muxParams(muxSettings(inbound, flow))
+	if inbound.PortHopping != "" {
+		// the range apps that hop ports pick from, e.g. 20000-30000
+		extra.Set("mport", inbound.PortHopping)
+	}
+
+	switch inbound.Protocol {
+	case model.VMess:
+		network := params.Get("type")
+		vmess := map[string]interface{}{
+			"v":    "2",
+			"ps":   remark,
+			"add":  address,
+			"port": inbound.Port,
+			"id":   client["id"],
+			"aid":  clientInt(client, "alterId"),
+			"net":  network,
+			"type": "none",
+			"host": params.Get("host"),
+			"path": params.Get("path"),
+			"tls":  params.Get("security"),
+		}
+		switch network {
+		case "tcp", "kcp", "quic":
+			if headerType := params.Get("headerType"); headerType != "" {
+				vmess["type"] = headerType
+			}
+		case "http":
+			vmess["net"] = "h2"
+		case "grpc":
+			vmess["path"] = params.Get("serviceName")
+			vmess["type"] = params.Get("mode")
+		case "xhttp":
+			vmess["type"] = params.Get("mode")
+		}
+		if network == "kcp" {
+			vmess["path"] = params.Get("seed")
+		} else if network == "quic" {
+			vmess["host"] = params.Get("quicSecurity")
+			vmess["path"] = params.Get("key")
+		}
+		for key := range extra {
+			vmess[key] = extra.Get(key)
+		}
+		data, err := json.MarshalIndent(vmess, "", "  ")
+		if err != nil {
+			return "", err
+		}
+		return "vmess://" + base64.StdEncoding.EncodeToString(data), nil
+	case model.VLESS:
+		for key := range extra {
+			params.Set(key, extra.Get(key))
+		}
+		id, _ := client["id"].(string)
+		return fmt.Sprintf("vless://%s@%s?%s#%s", id, hostPort, params.Encode(), url.PathEscape(remark)), nil
+	case model.Trojan:
+		for key := range extra {
+			params.Set(key, extra.Get(key))
+		}
+		password, _ := client["password"].(string)
+		return fmt.Sprintf("trojan://%s@%s?%s#%s", url.PathEscape(password), hostPort, params.Encode(), url.PathEscape(remark)), nil
+	}
+	return "", common.NewErrorf("protocol %v has no client links", inbound.Protocol)
+}
@@ -0,0 +1,106 @@
+package service
+
+import (
+	"io"
+	"strconv"
+	"x-ui/database"
+	"x-ui/logger"
+	"x-ui/util/metrics"
+	"x-ui/xray"
+)
+
+var HttpRequestDuration = metrics.NewHistogram(
+	"xui_http_request_duration_seconds",
+	"Latency of panel HTTP handlers.",
+	metrics.DefBuckets,
+	"method", "path", "code",
+)
+
+type MetricsService struct {
+	inboundService InboundServiceImpl
+	onlineService  OnlineService
+	xrayService    XrayService
+}
+
+func (s *MetricsService) WriteMetrics(out io.Writer) error {
+	w := metrics.NewWriter(out)
+
+	inbounds, err := s.inboundService.GetAllInboundTraffics()
+	if err != nil {
+		return err
+	}
+
+	w.Header("xui_inbound_up_bytes", "Uploaded bytes per inbound.", "counter")
+	for _, inbound := range inbounds {
+		w.Sample("xui_inbound_up_bytes", float64(inbound.Up), inboundLabels(inbound.Tag, inbound.Remark)...)
+	}
+	w.Header("xui_inbound_down_bytes", "Downloaded bytes per inbound.", "counter")
+	for _, inbound := range inbounds {
+		w.Sample("xui_inbound_down_bytes", float64(inbound.Down), inboundLabels(inbound.Tag, inbound.Remark)...)
+	}
+	w.Header("xui_inbound_enabled", "Whether the inbound is enabled.", "gauge")
+	for _, inbound := range inbounds {
+		w.Sample("xui_inbound_enabled", boolValue(inbound.Enable), inboundLabels(inbound.Tag, inbound.Remark)...)
+	}
+
+	clientStats := make([]xray.ClientTraffic, 0)
+	for _, inbound := range inbounds {
+		clientStats = append(clientStats, inbound.ClientStats...)
+	}
+	w.Header("xui_client_up_bytes", "Uploaded bytes per client.", "counter")
+	for _, stat := range clientStats {
+		w.Sample("xui_client_up_bytes", float64(stat.Up), clientLabels(stat)...)
+	}
+	w.Header("xui_client_down_bytes", "Downloaded bytes per client.", "counter")
+	for _, stat := range clientStats {
+		w.Sample("xui_client_down_bytes", float64(stat.Down), clientLabels(stat)...)
+	}
+	w.Header("xui_client_enabled", "Whether the client is enabled.", "gauge")
+	for _, stat := range clientStats {
+		w.Sample("xui_client_enabled", boolValue(stat.Enable), clientLabels(stat)...)
+	}
+
+	w.Header("xui_online_clients", "Number of clients seen in traffic stats or the access log recently.", "gauge")
+	w.Sample("xui_online_clients", float64(len(s.onlineService.GetOnlineClients())))
+
+	w.Header("xui_xray_running", "Whether the xray process is running.", "gauge")
+	w.Sample("xui_xray_running", boolValue(s.xrayService.IsXrayRunning()),
+		metrics.Label{Name: "version", Value: s.xrayService.GetXrayVersion()})
+	w.Header("xui_xray_uptime_seconds", "Seconds since xray was last started.", "gauge")
+	w.Sample("xui_xray_uptime_seconds", s.xrayService.GetXrayUptime().Seconds())
+	w.Header("xui_xray_restarts_total", "Number of times xray was started by the panel.", "counter")
+	w.Sample("xui_xray_restarts_total", float64(s.xrayService.GetXrayRestartCount()))
+
+	dbSize, err := database.GetDBSize()
+	if err != nil {
+		logger.Warning("get db size failed:", err)
+	} else {
+		w.Header("xui_db_size_bytes", "Size of the panel database file.", "gauge")
+		w.Sample("xui_db_size_bytes", float64(dbSize))
+	}
+
+	HttpRequestDuration.Write(w)
+
+	return w.Err()
+}
+
+func inboundLabels(tag string, remark string) []metrics.Label {
+	return []metrics.Label{
+		{Name: "tag", Value: tag},
+		{Name: "remark", Value: remark},
+	}
+}
+
+func clientLabels(stat xray.ClientTraffic) []metrics.Label {
+	return []metrics.Label{
+		{Name: "email", Value: stat.Email},
+		{Name: "inbound_id", Value: strconv.Itoa(stat.InboundId)},
+	}
+}
+
+func boolValue(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,74 @@
+package service
+
+import (
+	"fmt"
+	"net/url"
+	"x-ui/database/model"
+	"x-ui/util/common"
+)
+
+// checkInboundMux checks the mux settings handed to clients of an inbound, mux is off while MuxConcurrency is 0.
+// XudpConcurrency 0 keeps xray's default and -1 sends udp without XUDP
+func checkInboundMux(inbound *model.Inbound) error {
+	if inbound.MuxConcurrency == 0 {
+		inbound.XudpConcurrency = 0
+		inbound.XudpProxyUDP443 = ""
+		return nil
+	}
+	switch inbound.Protocol {
+	case model.VMess, model.VLESS, model.Trojan:
+	default:
+		return common.NewError("mux is not supported by protocol", inbound.Protocol)
+	}
+	if inbound.MuxConcurrency < 1 || inbound.MuxConcurrency > 1024 {
+		return common.NewError("mux concurrency must be between 1 and 1024:", inbound.MuxConcurrency)
+	}
+	if inbound.XudpConcurrency < -1 || inbound.XudpConcurrency > 1024 {
+		return common.NewError("xudp concurrency must be between 1 and 1024, 0 or -1:", inbound.XudpConcurrency)
+	}
+	switch inbound.XudpProxyUDP443 {
+	case "", "reject", "allow", "skip":
+	default:
+		return common.NewError("xudpProxyUDP443 must be reject, allow or skip:", inbound.XudpProxyUDP443)
+	}
+	return nil
+}
+
+// muxSettings returns the mux object of a client outbound, nil if mux is off.
+// XTLS Vision can not carry mux.cool, its clients only get XUDP
+func muxSettings(inbound *model.Inbound, flow string) map[string]interface{} {
+	if inbound.MuxConcurrency == 0 {
+		return nil
+	}
+	concurrency := inbound.MuxConcurrency
+	if flow != "" {
+		concurrency = -1
+	}
+	mux := map[string]interface{}{
+		"enabled":     true,
+		"concurrency": concurrency,
+	}
+	if inbound.XudpConcurrency != 0 {
+		mux["xudpConcurrency"] = inbound.XudpConcurrency
+	}
+	if inbound.XudpProxyUDP443 != "" {
+		mux["xudpProxyUDP443"] = inbound.XudpProxyUDP443
+	}
+	return mux
+}
+
+// muxParams returns the mux settings as share link parameters, there is no standard for them,
+// the names are the ones of the xray mux object
+func muxParams(mux map[string]interface{}) url.Values {
+	params := url.Values{}
+	if mux == nil {
+		return params
+	}
+	params.Set("mux", "1")
+	for _, key := range []string{"concurrency", "xudpConcurrency", "xudpProxyUDP443"} {
+		if value, ok := mux[key]; ok {
+			params.Set(key, fmt.Sprint(value))
+		}
+	}
+	return params
+}
@@ -0,0 +1,330 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+	"x-ui/database"
+	"x-ui/database/model"
+	"x-ui/logger"
+	"x-ui/util/common"
+	"x-ui/xray"
+)
+
+// agentReply mirrors entity.Msg with the object left raw for decoding into the expected type
+type agentReply struct {
+	Success bool            `json:"success"`
+	Msg     string          `json:"msg"`
+	Obj     json.RawMessage `json:"obj"`
+}
+
+// ClientEnable tells a node whether a client may still connect
+type ClientEnable struct {
+	Email  string `json:"email"`
+	Enable bool   `json:"enable"`
+}
+
+type NodeService struct {
+	inboundService InboundServiceImpl
+}
+
+func (s *NodeService) GetNodes() ([]*model.Node, error) {
+	db := database.GetDB()
+	var nodes []*model.Node
+	err := db.Model(model.Node{}).Find(&nodes).Error
+	if err != nil {
+		return nil, err
+	}
+	return nodes, nil
+}
+
+func (s *NodeService) GetNode(id int) (*model.Node, error) {
+	db := database.GetDB()
+	node := &model.Node{}
+	err := db.Model(model.Node{}).First(node, id).Error
+	if err != nil {
+		return nil, err
+	}
+	return node, nil
+}
+
+func (s *NodeService) checkNode(node *model.Node) error {
+	u, err := url.Parse(node.Address)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return common.NewError("node address is not a valid url:", node.Address)
+	}
+	if node.Token == "" {
+		return common.NewError("node token can not be empty")
+	}
+	return nil
+}
+
+func (s *NodeService) AddNode(node *model.Node) (*model.Node, error) {
+	if err := s.checkNode(node); err != nil {
+		return node, err
+	}
+	db := database.GetDB()
+	return node, db.Create(node).Error
+}
+
+func (s *NodeService) UpdateNode(node *model.Node) (*model.Node, error) {
+	if err := s.checkNode(node); err != nil {
+		return node, err
+	}
+	db := database.GetDB()
+	err := db.Model(node).
+		Select("name", "address", "token", "allow_insecure", "enable").
+		Updates(node).Error
+	return node, err
+}
+
+func (s *NodeService) DelNode(id int) error {
+	db := database.GetDB()
+	err := db.Where("node_id = ?", id).Delete(model.InboundReplica{}).Error
+	if err != nil {
+		return err
+	}
+	err = db.Where("node_id = ?", id).Delete(model.NodeTraffic{}).Error
+	if err != nil {
+		return err
+	}
+	return db.Delete(model.Node{}, id).Error
+}
+
+// call sends a request to the agent api of the node and decodes the returned object into obj if it is not nil
+func (s *NodeService) call(node *model.Node, method string, path string, body interface{}, obj interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, strings.TrimSuffix(node.Address, "/")+"/agent"+path, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+node.Token)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	client := &http.Client{
+		Timeout: time.Second * 10,
+	}
+	if node.AllowInsecure {
+		client.Transport = &http.Transport{
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+		}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return common.NewErrorf("node %v responded with status %v", node.Name, resp.StatusCode)
+	}
+	reply := &agentReply{}
+	err = json.NewDecoder(resp.Body).Decode(reply)
+	if err != nil {
+		return err
+	}
+	if !reply.Success {
+		return common.NewError(reply.Msg)
+	}
+	if obj != nil && len(reply.Obj) > 0 {
+		return json.Unmarshal(reply.Obj, obj)
+	}
+	return nil
+}
+
+func (s *NodeService) GetNodeStatus(node *model.Node) (*Status, error) {
+	status := &Status{}
+	err := s.call(node, http.MethodGet, "/status", nil, status)
+	if err != nil {
+		return nil, err
+	}
+	return status, nil
+}
+
+func (s *NodeService) GetNodeInbounds(node *model.Node) ([]*model.Inbound, error) {
+	inbounds := make([]*model.Inbound, 0)
+	err := s.call(node, http.MethodGet, "/inbounds", nil, &inbounds)
+	if err != nil {
+		return nil, err
+	}
+	return inbounds, nil
+}
+
+func (s *NodeService) AddNodeInbound(node *model.Node, inbound *model.Inbound) (*model.Inbound, error) {
+	err := s.call(node, http.MethodPost, "/inbounds/add", inbound, inbound)
+	return inbound, err
+}
+
+func (s *NodeService) UpdateNodeInbound(node *model.Node, inbound *model.Inbound) (*model.Inbound, error) {
+	err := s.call(node, http.MethodPost, fmt.Sprintf("/inbounds/update/%d", inbound.Id), inbound, inbound)
+	return inbound, err
+}
+
+func (s *NodeService) DelNodeInbound(node *model.Node, inboundId int) error {
+	return s.call(node, http.MethodPost, fmt.Sprintf("/inbounds/del/%d", inboundId), nil, nil)
+}
+
+func (s *NodeService) GetNodeTraffic(node *model.Node) ([]*xray.ClientTraffic, error) {
+	traffics := make([]*xray.ClientTraffic, 0)
+	err := s.call(node, http.MethodGet, "/traffic", nil, &traffics)
+	if err != nil {
+		return nil, err
+	}
+	return traffics, nil
+}
+
+func (s *NodeService) SetNodeClientsEnable(node *model.Node, clients []*ClientEnable) error {
+	return s.call(node, http.MethodPost, "/clients/enable", clients, nil)
+}
+
+// collectNodeTraffic adds what the clients used on the node since the last collection to the local counters
+func (s *NodeService) collectNodeTraffic(ctx context.Context, node *model.Node) error {
+	traffics, err := s.GetNodeTraffic(node)
+	if err != nil {
+		return err
+	}
+	db := database.GetDB().WithContext(ctx)
+	var lasts []*model.NodeTraffic
+	err = db.Model(model.NodeTraffic{}).Where("node_id = ?", node.Id).Find(&lasts).Error
+	if err != nil {
+		return err
+	}
+	lastMap := map[string]*model.NodeTraffic{}
+	for _, last := range lasts {
+		lastMap[last.Email] = last
+	}
+
+	deltas := make([]*xray.ClientTraffic, 0)
+	for _, traffic := range traffics {
+		last, ok := lastMap[traffic.Email]
+		if !ok {
+			last = &model.NodeTraffic{NodeId: node.Id, Email: traffic.Email}
+		}
+		up, down := traffic.Up-last.Up, traffic.Down-last.Down
+		// a counter below the last value was reset on the node, everything on it is new
+		if up < 0 || down < 0 {
+			up, down = traffic.Up, traffic.Down
+		}
+		if up > 0 || down > 0 {
+			deltas = append(deltas, &xray.ClientTraffic{Email: traffic.Email, Up: up, Down: down})
+		}
+		last.Up, last.Down = traffic.Up, traffic.Down
+		err = db.Save(last).Error
+		if err != nil {
+			return err
+		}
+	}
+	return s.inboundService.AddClientTraffic(ctx, deltas)
+}
+
+// pushClientsEnable makes the node follow the enable state of the combined counters
+func (s *NodeService) pushClientsEnable(ctx context.Context, node *model.Node) error {
+	traffics, err := s.GetNodeTraffic(node)
+	if err != nil {
+		return err
+	}
+	db := database.GetDB().WithContext(ctx)
+	clients := make([]*ClientEnable, 0)
+	for _, traffic := range traffics {
+		local := &xray.ClientTraffic{}
+		err := db.Model(xray.ClientTraffic{}).Where("email = ?", traffic.Email).First(local).Error
+		if err != nil {
+			continue
+		}
+		if local.Enable != traffic.Enable {
+			clients = append(clients, &ClientEnable{Email: traffic.Email, Enable: local.Enable})
+		}
+	}
+	if len(clients) == 0 {
+		return nil
+	}
+	return s.SetNodeClientsEnable(node, clients)
+}
+
+// CollectTraffic aggregates client usage of all enabled nodes into the local counters,
+// so quotas apply to the combined usage, and disables clients on the nodes once they are over it
+func (s *NodeService) CollectTraffic(ctx context.Context) error {
+	nodes, err := s.GetNodes()
+	if err != nil {
+		return err
+	}
+	collected := make([]*model.Node, 0, len(nodes))
+	for _, node := range nodes {
+		if !node.Enable {
+			continue
+		}
+		err := s.collectNodeTraffic(ctx, node)
+		if err != nil {
+			logger.Warning("collect traffic of node failed:", node.Name, err)
+			continue
+		}
+		collected = append(collected, node)
+	}
+	if len(collected) == 0 {
+		return nil
+	}
+
+	_, err = s.inboundService.DisableInvalidClients(ctx)
+	if err != nil {
+		return err
+	}
+	for _, node := range collected {
+		err := s.pushClientsEnable(ctx, node)
+		if err != nil {
+			logger.Warning("push client state to node failed:", node.Name, err)
+		}
+	}
+	return nil
+}
+
+// CheckHealth refreshes reachability, xray state and load of all enabled nodes
+func (s *NodeService) CheckHealth() error {
+	nodes, err := s.GetNodes()
+	if err != nil {
+		return err
+	}
+	db := database.GetDB()
+	for _, node := range nodes {
+		if !node.Enable {
+			continue
+		}
+		now := time.Now().Unix()
+		updates := map[string]interface{}{"last_check": now}
+		status, err := s.GetNodeStatus(node)
+		if err != nil {
+			if node.Online {
+				logger.Warning("node is down:", node.Name, err)
+			}
+			updates["online"] = false
+			updates["error"] = err.Error()
+		} else {
+			updates["online"] = true
+			updates["last_seen"] = now
+			updates["error"] = ""
+			updates["xray_state"] = string(status.Xray.State)
+			updates["cpu"] = status.Cpu
+			if len(status.Loads) > 0 {
+				updates["load"] = status.Loads[0]
+			}
+		}
+		err = db.Model(model.Node{}).Where("id = ?", node.Id).Updates(updates).Error
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
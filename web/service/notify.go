@@ -0,0 +1,131 @@
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+	"x-ui/util/common"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const (
+	NotifyTelegram = "telegram"
+	NotifyWebhook  = "webhook"
+	NotifyEmail    = "email"
+	// incoming webhooks of chat services, mattermost and rocket.chat accept the slack format
+	NotifyDiscord = "discord"
+	NotifySlack   = "slack"
+)
+
+type NotifyService struct {
+	settingService SettingService
+}
+
+func (s *NotifyService) SendTelegram(msg string) error {
+	chatId, err := s.settingService.GetTgBotChatId()
+	if err != nil {
+		return err
+	}
+	return s.SendTelegramTo(int64(chatId), msg)
+}
+
+// SendTelegramTo sends msg to the chat with the id instead of the admin chat, e.g. to a client
+func (s *NotifyService) SendTelegramTo(chatId int64, msg string) error {
+	token, err := s.settingService.GetTgBotToken()
+	if err != nil {
+		return err
+	}
+	if token == "" {
+		return common.NewError("telegram bot token is empty")
+	}
+	bot, err := tgbotapi.NewBotAPI(token)
+	if err != nil {
+		return err
+	}
+	_, err = bot.Send(tgbotapi.NewMessage(chatId, msg))
+	return err
+}
+
+// SendTelegramKeyboard sends msg with inline buttons to the admin chat, the bot answers their callbacks
+func (s *NotifyService) SendTelegramKeyboard(msg string, keyboard tgbotapi.InlineKeyboardMarkup) error {
+	token, err := s.settingService.GetTgBotToken()
+	if err != nil {
+		return err
+	}
+	if token == "" {
+		return common.NewError("telegram bot token is empty")
+	}
+	chatId, err := s.settingService.GetTgBotChatId()
+	if err != nil {
+		return err
+	}
+	bot, err := tgbotapi.NewBotAPI(token)
+	if err != nil {
+		return err
+	}
+	message := tgbotapi.NewMessage(int64(chatId), msg)
+	message.ReplyMarkup = keyboard
+	_, err = bot.Send(message)
+	return err
+}
+
+func (s *NotifyService) SendWebhook(url string, payload interface{}) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	return s.PostWebhook(url, data, nil)
+}
+
+// PostWebhook posts an already encoded json body with extra headers, e.g. a signature
+func (s *NotifyService) PostWebhook(url string, data []byte, headers map[string]string) error {
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+	client := &http.Client{
+		Timeout: time.Second * 10,
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return common.NewErrorf("webhook %v responded with status %v", url, resp.StatusCode)
+	}
+	return nil
+}
+
+// Send delivers a notification through the given channel, target is channel specific (e.g. the webhook url)
+func (s *NotifyService) Send(channel string, target string, subject string, msg string) error {
+	switch channel {
+	case NotifyTelegram:
+		return s.SendTelegram(fmt.Sprintf("%s\r\n%s", subject, msg))
+	case NotifyWebhook:
+		return s.SendWebhook(target, map[string]interface{}{
+			"subject": subject,
+			"message": msg,
+			"time":    time.Now().Unix(),
+		})
+	case NotifyEmail:
+		return s.SendEmail(target, subject, msg)
+	case NotifyDiscord:
+		return s.SendWebhook(target, map[string]interface{}{
+			"content": fmt.Sprintf("**%s**\n%s", subject, msg),
+		})
+	case NotifySlack:
+		return s.SendWebhook(target, map[string]interface{}{
+			"text": fmt.Sprintf("*%s*\n%s", subject, msg),
+		})
+	default:
+		return common.NewError("unknown notify channel:", channel)
+	}
+}
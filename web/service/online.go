@@ -0,0 +1,228 @@
+package service
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"x-ui/util/geoip"
+	"x-ui/xray"
+)
+
+// a client is shown as online for this long after its last traffic or access log entry
+const onlineTimeout = time.Minute * 2
+
+// 2023/02/20 10:34:56 1.2.3.4:56789 accepted tcp:www.google.com:443 [inbound-443 -> direct] email: user1
+var accessLogRegex = regexp.MustCompile(`^(\d{4}/\d{2}/\d{2} \d{2}:\d{2}:\d{2})(?:\.\d+)? (?:from )?(?:tcp:|udp:)?(\[[0-9a-fA-F:.]+\]|[0-9.]+):\d+ accepted (\S+) \[([^\]\s]+)\s*(?:->|>>)\s*([^\]]*)\](?: email: (\S+))?`)
+
+type AccessLogEntry struct {
+	Time        time.Time
+	IP          string
+	Destination string
+	InboundTag  string
+	OutboundTag string
+	Email       string
+}
+
+type OnlineIP struct {
+	IP       string `json:"ip"`
+	LastSeen int64  `json:"lastSeen"`
+	*geoip.Info
+}
+
+type OnlineClient struct {
+	Email      string     `json:"email"`
+	InboundTag string     `json:"inboundTag"`
+	IPs        []OnlineIP `json:"ips"`
+	LastSeen   int64      `json:"lastSeen"`
+}
+
+type onlineClient struct {
+	inboundTag string
+	ips        map[string]time.Time
+	lastSeen   time.Time
+}
+
+var onlineClients = map[string]*onlineClient{}
+var onlineLock sync.Mutex
+var accessLogOffset int64
+
+type OnlineService struct {
+	settingService SettingService
+}
+
+func (s *OnlineService) getOnlineClient(email string) *onlineClient {
+	client, ok := onlineClients[email]
+	if !ok {
+		client = &onlineClient{
+			ips: map[string]time.Time{},
+		}
+		onlineClients[email] = client
+	}
+	return client
+}
+
+// MarkActive records clients that moved traffic according to the xray stats api
+func (s *OnlineService) MarkActive(emails []string) {
+	onlineLock.Lock()
+	defer onlineLock.Unlock()
+	now := time.Now()
+	for _, email := range emails {
+		s.getOnlineClient(email).lastSeen = now
+	}
+}
+
+func (s *OnlineService) getAccessLogPath() (string, error) {
+	template, err := s.settingService.GetXrayConfigTemplate()
+	if err != nil {
+		return "", err
+	}
+	xrayConfig := &xray.Config{}
+	err = json.Unmarshal([]byte(template), xrayConfig)
+	if err != nil {
+		return "", err
+	}
+	return xrayConfig.GetAccessLogPath(), nil
+}
+
+// ReadAccessLog parses the lines appended to the xray access log since the last call
+func (s *OnlineService) ReadAccessLog() ([]*AccessLogEntry, error) {
+	path, err := s.getAccessLogPath()
+	if err != nil || path == "" {
+		return nil, err
+	}
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	stat, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	onlineLock.Lock()
+	defer onlineLock.Unlock()
+
+	if stat.Size() < accessLogOffset {
+		// the log was truncated or rotated
+		accessLogOffset = 0
+	}
+	_, err = file.Seek(accessLogOffset, io.SeekStart)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]*AccessLogEntry, 0)
+	reader := bufio.NewReader(file)
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			// leave a partially written line for the next run
+			break
+		}
+		accessLogOffset += int64(len(line))
+		entry := parseAccessLogLine(strings.TrimSpace(line))
+		if entry == nil || entry.Email == "" {
+			continue
+		}
+		client := s.getOnlineClient(entry.Email)
+		client.inboundTag = entry.InboundTag
+		client.ips[entry.IP] = entry.Time
+		if entry.Time.After(client.lastSeen) {
+			client.lastSeen = entry.Time
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+func parseAccessLogLine(line string) *AccessLogEntry {
+	matches := accessLogRegex.FindStringSubmatch(line)
+	if len(matches) < 7 {
+		return nil
+	}
+	t, err := time.ParseInLocation("2006/01/02 15:04:05", matches[1], time.Local)
+	if err != nil {
+		return nil
+	}
+	return &AccessLogEntry{
+		Time:        t,
+		IP:          strings.Trim(matches[2], "[]"),
+		Destination: matches[3],
+		InboundTag:  matches[4],
+		OutboundTag: strings.TrimSpace(matches[5]),
+		Email:       matches[6],
+	}
+}
+
+// clientCountries returns the countries of the addresses the client was online from lately, ZZ for
+// addresses geoip does not know
+func clientCountries(email string) []string {
+	onlineLock.Lock()
+	ips := make([]string, 0)
+	if client, ok := onlineClients[email]; ok {
+		now := time.Now()
+		for ip, lastSeen := range client.ips {
+			if now.Sub(lastSeen) <= onlineTimeout {
+				ips = append(ips, ip)
+			}
+		}
+	}
+	onlineLock.Unlock()
+
+	seen := map[string]bool{}
+	countries := make([]string, 0, len(ips))
+	for _, ip := range ips {
+		country := geoip.Lookup(ip).Country
+		if country == "" {
+			country = unknownCountry
+		}
+		if !seen[country] {
+			seen[country] = true
+			countries = append(countries, country)
+		}
+	}
+	sort.Strings(countries)
+	return countries
+}
+
+func (s *OnlineService) GetOnlineClients() []*OnlineClient {
+	onlineLock.Lock()
+	defer onlineLock.Unlock()
+
+	now := time.Now()
+	result := make([]*OnlineClient, 0)
+	for email, client := range onlineClients {
+		if now.Sub(client.lastSeen) > onlineTimeout {
+			delete(onlineClients, email)
+			continue
+		}
+		onlineClient := &OnlineClient{
+			Email:      email,
+			InboundTag: client.inboundTag,
+			IPs:        make([]OnlineIP, 0, len(client.ips)),
+			LastSeen:   client.lastSeen.Unix(),
+		}
+		for ip, lastSeen := range client.ips {
+			if now.Sub(lastSeen) > onlineTimeout {
+				delete(client.ips, ip)
+				continue
+			}
+			onlineClient.IPs = append(onlineClient.IPs, OnlineIP{IP: ip, LastSeen: lastSeen.Unix(), Info: geoip.Lookup(ip)})
+		}
+		result = append(result, onlineClient)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Email < result[j].Email
+	})
+	return result
+}
@@ -0,0 +1,210 @@
+package service
+
+import (
+	"encoding/json"
+	"x-ui/util/common"
+	"x-ui/xray"
+)
+
+// OutboundChain is a list of outbounds each dialing through the next, traffic routed to the first
+// leaves through the last. A hop with only a tag refers to an outbound of the template
+type OutboundChain struct {
+	Hops []map[string]interface{} `json:"hops"`
+}
+
+// OutboundService edits the outbounds of the xray template
+type OutboundService struct {
+	settingService SettingService
+}
+
+func outboundTag(outbound interface{}) string {
+	o, _ := outbound.(map[string]interface{})
+	tag, _ := o["tag"].(string)
+	return tag
+}
+
+// proxyTag is the tag of the outbound the outbound dials through, empty if it dials directly
+func proxyTag(outbound interface{}) string {
+	o, _ := outbound.(map[string]interface{})
+	proxy, _ := o["proxySettings"].(map[string]interface{})
+	tag, _ := proxy["tag"].(string)
+	return tag
+}
+
+func (s *OutboundService) getTemplate() (map[string]interface{}, []interface{}, error) {
+	template, err := s.settingService.GetXrayConfigTemplate()
+	if err != nil {
+		return nil, nil, err
+	}
+	config := map[string]interface{}{}
+	err = json.Unmarshal([]byte(template), &config)
+	if err != nil {
+		return nil, nil, err
+	}
+	outbounds, _ := config["outbounds"].([]interface{})
+	return config, outbounds, nil
+}
+
+func (s *OutboundService) saveTemplate(config map[string]interface{}) error {
+	data, err := json.MarshalIndent(config, "", "  ")
+	if err != nil {
+		return err
+	}
+	err = json.Unmarshal(data, &xray.Config{})
+	if err != nil {
+		return err
+	}
+	return s.settingService.SetSetting("xrayTemplateConfig", string(data))
+}
+
+func (s *OutboundService) GetOutbounds() ([]interface{}, error) {
+	_, outbounds, err := s.getTemplate()
+	if err != nil {
+		return nil, err
+	}
+	if outbounds == nil {
+		outbounds = make([]interface{}, 0)
+	}
+	return outbounds, nil
+}
+
+// checkOutboundChains follows the proxySettings of every outbound, they must lead to outbounds that
+// exist and must not come back around
+func checkOutboundChains(outbounds []interface{}) error {
+	next := map[string]string{}
+	for _, outbound := range outbounds {
+		tag := outboundTag(outbound)
+		if tag == "" {
+			if proxyTag(outbound) != "" {
+				return common.NewError("outbounds with proxySettings need a tag")
+			}
+			continue
+		}
+		if _, ok := next[tag]; ok {
+			return common.NewError("outbound tag is used twice:", tag)
+		}
+		next[tag] = proxyTag(outbound)
+	}
+	for start := range next {
+		seen := map[string]bool{start: true}
+		for tag := next[start]; tag != ""; tag = next[tag] {
+			if _, ok := next[tag]; !ok {
+				return common.NewErrorf("outbound %v dials through %v, which does not exist", start, tag)
+			}
+			if seen[tag] {
+				return common.NewErrorf("outbound chain of %v runs in a cycle through %v", start, tag)
+			}
+			seen[tag] = true
+		}
+	}
+	return nil
+}
+
+// AddChain adds the new hops of the chain to the template, wires each hop to dial through the next and
+// returns the outbounds of the chain as written
+func (s *OutboundService) AddChain(chain *OutboundChain) ([]interface{}, error) {
+	if len(chain.Hops) < 2 {
+		return nil, common.NewError("a chain needs at least two hops")
+	}
+	config, outbounds, err := s.getTemplate()
+	if err != nil {
+		return nil, err
+	}
+	existing := map[string]map[string]interface{}{}
+	for _, outbound := range outbounds {
+		if o, ok := outbound.(map[string]interface{}); ok && outboundTag(o) != "" {
+			existing[outboundTag(o)] = o
+		}
+	}
+
+	hops := make([]map[string]interface{}, 0, len(chain.Hops))
+	for i, hop := range chain.Hops {
+		tag := outboundTag(hop)
+		if tag == "" {
+			return nil, common.NewErrorf("hop %v needs a tag", i+1)
+		}
+		if len(hop) == 1 {
+			// a reference to an outbound of the template
+			outbound, ok := existing[tag]
+			if !ok {
+				return nil, common.NewError("outbound not found:", tag)
+			}
+			hops = append(hops, outbound)
+			continue
+		}
+		if _, ok := existing[tag]; ok {
+			return nil, common.NewError("outbound tag already exists:", tag)
+		}
+		if protocol, _ := hop["protocol"].(string); protocol == "" {
+			return nil, common.NewError("hop needs a protocol:", tag)
+		}
+		existing[tag] = hop
+		outbounds = append(outbounds, hop)
+		hops = append(hops, hop)
+	}
+
+	result := make([]interface{}, 0, len(hops))
+	for i, hop := range hops {
+		result = append(result, hop)
+		if i == len(hops)-1 {
+			break
+		}
+		switch hop["protocol"] {
+		case "freedom", "blackhole", "dns":
+			return nil, common.NewErrorf("%v can only be the last hop, it does not dial through others", outboundTag(hop))
+		}
+		nextTag := outboundTag(hops[i+1])
+		if current := proxyTag(hop); current != "" && current != nextTag {
+			return nil, common.NewErrorf("outbound %v already dials through %v", outboundTag(hop), current)
+		}
+		// transportLayer keeps the stream settings of the hop, e.g. its tls, over the next hop
+		hop["proxySettings"] = map[string]interface{}{
+			"tag":            nextTag,
+			"transportLayer": true,
+		}
+	}
+
+	err = checkOutboundChains(outbounds)
+	if err != nil {
+		return nil, err
+	}
+	config["outbounds"] = outbounds
+	err = s.saveTemplate(config)
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// DelOutbound removes an outbound from the template unless another outbound dials through it or a
+// routing rule sends traffic to it
+func (s *OutboundService) DelOutbound(tag string) error {
+	config, outbounds, err := s.getTemplate()
+	if err != nil {
+		return err
+	}
+	kept := make([]interface{}, 0, len(outbounds))
+	found := false
+	for _, outbound := range outbounds {
+		if proxyTag(outbound) == tag {
+			return common.NewErrorf("outbound %v dials through %v", outboundTag(outbound), tag)
+		}
+		if tag != "" && outboundTag(outbound) == tag {
+			found = true
+			continue
+		}
+		kept = append(kept, outbound)
+	}
+	if !found {
+		return common.NewError("outbound not found:", tag)
+	}
+	routing, _ := config["routing"].(map[string]interface{})
+	rules, _ := routing["rules"].([]interface{})
+	for _, rule := range rules {
+		if r, ok := rule.(map[string]interface{}); ok && r["outboundTag"] == tag {
+			return common.NewErrorf("a routing rule sends traffic to %v", tag)
+		}
+	}
+	config["outbounds"] = kept
+	return s.saveTemplate(config)
+}
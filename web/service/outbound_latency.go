@@ -0,0 +1,330 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"sync"
+	"time"
+	"x-ui/database"
+	"x-ui/database/model"
+	"x-ui/util/common"
+	"x-ui/util/json_util"
+	"x-ui/util/random"
+	"x-ui/xray"
+)
+
+// latency probes are kept this long
+const outboundLatencyRetention = time.Hour * 24 * 7
+
+// how long a probe through an outbound may take
+const latencyProbeTimeout = time.Second * 10
+
+// how often the observatory of xray probes the outbounds of latency balancers
+const latencyBalancerInterval = "1m"
+
+// the inbound tag prefix of the local socks inbounds that lead into the outbounds
+const latencyProbeTagPrefix = "latency-probe-"
+
+// latencyProbePorts are the local ports of the probe inbounds by outbound tag, they are kept across
+// configs so a restart of xray does not move them
+var latencyProbePorts = map[string]int{}
+var latencyLock sync.Mutex
+
+// the account of the probe inbounds, other local users could use the outbounds through them otherwise
+var (
+	latencyProbeUser = random.SecureSeq(16)
+	latencyProbePass = random.SecureSeq(32)
+)
+
+// LatencyPoint is the average latency of the successful probes in a bucket and the failed probes
+type LatencyPoint struct {
+	Time     int64   `json:"time" gorm:"column:bucket"`
+	Latency  float64 `json:"latency"`
+	Failures int64   `json:"failures"`
+}
+
+type LatencySeries struct {
+	Tag        string          `json:"tag"`
+	From       int64           `json:"from"`
+	To         int64           `json:"to"`
+	Resolution int64           `json:"resolution"`
+	Points     []*LatencyPoint `json:"points"`
+}
+
+// OutboundLatencyService measures the latency through every outbound of the xray config, each one is
+// reached through a local socks inbound routed to it
+type OutboundLatencyService struct {
+	settingService SettingService
+	xrayService    XrayService
+}
+
+// probedOutbound tells whether requests can be made through the outbound
+func probedOutbound(outbound interface{}) bool {
+	o, _ := outbound.(map[string]interface{})
+	switch o["protocol"] {
+	case "blackhole", "dns", "loopback":
+		return false
+	}
+	return outboundTag(outbound) != ""
+}
+
+// addLatencyProbes adds a local socks inbound for every outbound and a rule in front of the others
+// that sends its traffic to the outbound
+func addLatencyProbes(xrayConfig *xray.Config) error {
+	outbounds := make([]interface{}, 0)
+	if len(xrayConfig.OutboundConfigs) > 0 {
+		err := json.Unmarshal(xrayConfig.OutboundConfigs, &outbounds)
+		if err != nil {
+			return err
+		}
+	}
+	routing := map[string]interface{}{}
+	if len(xrayConfig.RouterConfig) > 0 {
+		err := json.Unmarshal(xrayConfig.RouterConfig, &routing)
+		if err != nil {
+			return err
+		}
+	}
+
+	probeSettings, err := json.Marshal(map[string]interface{}{
+		"auth":     "password",
+		"accounts": []map[string]string{{"user": latencyProbeUser, "pass": latencyProbePass}},
+	})
+	if err != nil {
+		return err
+	}
+
+	latencyLock.Lock()
+	defer latencyLock.Unlock()
+	ports := map[string]int{}
+	rules := make([]interface{}, 0)
+	for _, outbound := range outbounds {
+		if !probedOutbound(outbound) {
+			continue
+		}
+		tag := outboundTag(outbound)
+		port, ok := latencyProbePorts[tag]
+		if !ok {
+			var err error
+			port, err = freeLocalPort()
+			if err != nil {
+				return err
+			}
+		}
+		ports[tag] = port
+		xrayConfig.InboundConfigs = append(xrayConfig.InboundConfigs, xray.InboundConfig{
+			Listen:   json_util.RawMessage(`"127.0.0.1"`),
+			Port:     json_util.RawMessage(fmt.Sprint(port)),
+			Protocol: "socks",
+			Settings: json_util.RawMessage(probeSettings),
+			Tag:      latencyProbeTagPrefix + tag,
+		})
+		rules = append(rules, map[string]interface{}{
+			"type":        "field",
+			"inboundTag":  []string{latencyProbeTagPrefix + tag},
+			"outboundTag": tag,
+		})
+	}
+	latencyProbePorts = ports
+
+	templateRules, _ := routing["rules"].([]interface{})
+	routing["rules"] = append(rules, templateRules...)
+	routerConfig, err := json.Marshal(routing)
+	if err != nil {
+		return err
+	}
+	xrayConfig.RouterConfig = routerConfig
+	return nil
+}
+
+// addLatencyBalancers lets the balancers of the template without a strategy of their own use the outbound with
+// the lowest latency, which the observatory of xray measures with the first of the urls. A template with an
+// observatory keeps it
+func addLatencyBalancers(xrayConfig *xray.Config, urls []string) error {
+	if len(xrayConfig.RouterConfig) == 0 {
+		return nil
+	}
+	routing := map[string]interface{}{}
+	err := json.Unmarshal(xrayConfig.RouterConfig, &routing)
+	if err != nil {
+		return err
+	}
+	balancers, _ := routing["balancers"].([]interface{})
+	selectors := make([]interface{}, 0)
+	for _, balancer := range balancers {
+		b, ok := balancer.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if _, ok := b["strategy"]; !ok {
+			b["strategy"] = map[string]interface{}{"type": "leastPing"}
+		}
+		selector, _ := b["selector"].([]interface{})
+		selectors = append(selectors, selector...)
+	}
+	if len(selectors) == 0 {
+		return nil
+	}
+	routerConfig, err := json.Marshal(routing)
+	if err != nil {
+		return err
+	}
+	xrayConfig.RouterConfig = routerConfig
+	if len(xrayConfig.Observatory) > 0 {
+		return nil
+	}
+	observatory := map[string]interface{}{
+		"subjectSelector": selectors,
+		"probeInterval":   latencyBalancerInterval,
+	}
+	if len(urls) > 0 {
+		observatory["probeURL"] = urls[0]
+	}
+	xrayConfig.Observatory, err = json.Marshal(observatory)
+	return err
+}
+
+// probeProxy is the proxy url of the probe inbound on the local port
+func probeProxy(port int) string {
+	proxy := url.URL{
+		Scheme: "socks5",
+		User:   url.UserPassword(latencyProbeUser, latencyProbePass),
+		Host:   fmt.Sprintf("127.0.0.1:%v", port),
+	}
+	return proxy.String()
+}
+
+// outboundProxy returns the proxy url that leads into the outbound with the tag, the probe inbounds are
+// only added while latency probe urls are set
+func outboundProxy(tag string) (string, error) {
+	latencyLock.Lock()
+	port, ok := latencyProbePorts[tag]
+	latencyLock.Unlock()
+	if !ok {
+		return "", common.NewErrorf("outbound %v has no probe inbound, set latency probe urls to add them", tag)
+	}
+	return probeProxy(port), nil
+}
+
+// probeLatency requests the urls through the local socks port and returns the fastest answer in milliseconds
+func probeLatency(port int, urls []string) (float64, error) {
+	client, err := newSpeedTestClient(probeProxy(port))
+	if err != nil {
+		return 0, err
+	}
+	client.Timeout = latencyProbeTimeout
+	best := time.Duration(0)
+	var lastErr error
+	for _, u := range urls {
+		start := time.Now()
+		resp, err := client.Get(u)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		elapsed := time.Since(start)
+		if best == 0 || elapsed < best {
+			best = elapsed
+		}
+	}
+	if best == 0 {
+		return 0, lastErr
+	}
+	return float64(best) / float64(time.Millisecond), nil
+}
+
+// ProbeOutbounds measures the latency through every outbound and stores it
+func (s *OutboundLatencyService) ProbeOutbounds() error {
+	urls, err := s.settingService.GetLatencyProbeUrls()
+	if err != nil {
+		return err
+	}
+	if len(urls) == 0 {
+		return nil
+	}
+	if !s.xrayService.IsXrayRunning() {
+		return nil
+	}
+	latencyLock.Lock()
+	ports := make(map[string]int, len(latencyProbePorts))
+	for tag, port := range latencyProbePorts {
+		ports[tag] = port
+	}
+	latencyLock.Unlock()
+
+	now := time.Now().Unix()
+	probes := make([]*model.OutboundLatency, 0, len(ports))
+	wg := sync.WaitGroup{}
+	probeLock := sync.Mutex{}
+	for tag, port := range ports {
+		wg.Add(1)
+		go func(tag string, port int) {
+			defer wg.Done()
+			probe := &model.OutboundLatency{Tag: tag, Time: now}
+			latency, err := probeLatency(port, urls)
+			if err != nil {
+				probe.Error = err.Error()
+			}
+			probe.Latency = latency
+			probeLock.Lock()
+			probes = append(probes, probe)
+			probeLock.Unlock()
+		}(tag, port)
+	}
+	wg.Wait()
+	if len(probes) == 0 {
+		return nil
+	}
+
+	db := database.GetDB()
+	err = db.Create(probes).Error
+	if err != nil {
+		return err
+	}
+	return db.Where("time < ?", time.Now().Add(-outboundLatencyRetention).Unix()).Delete(model.OutboundLatency{}).Error
+}
+
+// GetLatencySeries returns the latency of every outbound in the last span, by outbound tag
+func (s *OutboundLatencyService) GetLatencySeries(span time.Duration) ([]*LatencySeries, error) {
+	if span <= 0 {
+		return nil, common.NewError("range must be positive")
+	}
+	if span > outboundLatencyRetention {
+		span = outboundLatencyRetention
+	}
+	resolution := pickResolution(span)
+	step := int64(resolution / time.Second)
+	now := time.Now()
+	from := now.Add(-span).Unix() / step * step
+
+	db := database.GetDB()
+	var tags []string
+	err := db.Model(model.OutboundLatency{}).Where("time >= ?", from).Distinct("tag").Order("tag").Pluck("tag", &tags).Error
+	if err != nil {
+		return nil, err
+	}
+	series := make([]*LatencySeries, 0, len(tags))
+	for _, tag := range tags {
+		points := make([]*LatencyPoint, 0)
+		err = db.Model(model.OutboundLatency{}).
+			Select("time / ? * ? as bucket, coalesce(avg(case when error = '' then latency end), 0) as latency, "+
+				"sum(case when error = '' then 0 else 1 end) as failures", step, step).
+			Where("tag = ? and time >= ?", tag, from).
+			Group("bucket").Order("bucket").Scan(&points).Error
+		if err != nil {
+			return nil, err
+		}
+		series = append(series, &LatencySeries{
+			Tag:        tag,
+			From:       from,
+			To:         now.Unix(),
+			Resolution: step,
+			Points:     points,
+		})
+	}
+	return series, nil
+}
@@ -0,0 +1,68 @@
+package service
+
+import (
+	"reflect"
+	"strings"
+	"x-ui/web/entity"
+
+	"gorm.io/gorm"
+)
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// pageDb applies the filter, sort and page of q to a query of the table of value in the database, the
+// way the in-memory pagination of the controllers does: the sort names a json field and the filter
+// matches any text column. It returns the query for the items of the page and the count of all matches
+func pageDb(db *gorm.DB, value interface{}, q *entity.PageQuery) (*gorm.DB, int, error) {
+	stmt := &gorm.Statement{DB: db}
+	err := stmt.Parse(value)
+	if err != nil {
+		return nil, 0, err
+	}
+	db = db.Model(value)
+	if q.Filter != "" {
+		pattern := "%" + likeEscaper.Replace(q.Filter) + "%"
+		conditions := make([]string, 0)
+		args := make([]interface{}, 0)
+		for _, field := range stmt.Schema.Fields {
+			if field.DBName != "" && field.FieldType.Kind() == reflect.String {
+				conditions = append(conditions, stmt.Quote(field.DBName)+` like ? escape '\'`)
+				args = append(args, pattern)
+			}
+		}
+		if len(conditions) == 0 {
+			db = db.Where("1 = 0")
+		} else {
+			db = db.Where("("+strings.Join(conditions, " or ")+")", args...)
+		}
+	}
+	// a new session, so counting does not change the query of the items
+	db = db.Session(&gorm.Session{})
+	var total int64
+	err = db.Count(&total).Error
+	if err != nil {
+		return nil, 0, err
+	}
+
+	primary := ""
+	if stmt.Schema.PrioritizedPrimaryField != nil {
+		primary = stmt.Schema.PrioritizedPrimaryField.DBName
+	}
+	if q.Sort != "" {
+		for _, field := range stmt.Schema.Fields {
+			if field.DBName != "" && strings.Split(field.Tag.Get("json"), ",")[0] == q.Sort {
+				order := stmt.Quote(field.DBName)
+				if q.Desc {
+					order += " desc"
+				}
+				db = db.Order(order)
+				break
+			}
+		}
+	}
+	// ties keep the order of the rows, as the stable sort in memory does
+	if primary != "" {
+		db = db.Order(stmt.Quote(primary))
+	}
+	return db.Limit(q.Size).Offset((q.Page - 1) * q.Size), int(total), nil
+}
@@ -5,6 +5,7 @@ import (
 	"syscall"
 	"time"
 	"x-ui/logger"
+	"x-ui/util/sys"
 )
 
 type PanelService struct {
@@ -24,3 +25,32 @@ func (s *PanelService) RestartPanel(delay time.Duration) error {
 	}()
 	return nil
 }
+
+// SignalRunningPanel asks other processes of this binary, e.g. the panel started by systemd, to reload.
+// It is used by the command line after changing the database, and returns how many processes were signaled.
+func (s *PanelService) SignalRunningPanel() (int, error) {
+	self, err := os.Executable()
+	if err != nil {
+		return 0, err
+	}
+	pids, err := sys.FindProcesses(self)
+	if err != nil {
+		return 0, err
+	}
+	count := 0
+	for _, pid := range pids {
+		if int(pid) == os.Getpid() {
+			continue
+		}
+		p, err := os.FindProcess(int(pid))
+		if err != nil {
+			return count, err
+		}
+		err = p.Signal(syscall.SIGHUP)
+		if err != nil {
+			return count, err
+		}
+		count++
+	}
+	return count, nil
+}
@@ -0,0 +1,416 @@
+package service
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"x-ui/database"
+	"x-ui/database/model"
+	"x-ui/logger"
+	"x-ui/util/common"
+	"x-ui/web/locale"
+
+	"gorm.io/gorm"
+)
+
+// payments signed longer ago than this are rejected, against replays of captured deliveries
+const paymentSignatureTolerance = time.Minute * 5
+
+// gateways deliver again when they get no answer in time, so the same payment may arrive twice at once.
+// The lock serializes them in this process only, the unique index of payments catches the rest
+var paymentLock sync.Mutex
+
+// paymentTolerance absorbs the rounding of gateways that report amounts in cents
+const paymentTolerance = 0.005
+
+type PlanService struct {
+	inboundService InboundServiceImpl
+	xrayService    XrayService
+	webhookService WebhookService
+	serverService  ServerService
+}
+
+func (s *PlanService) GetPlans() ([]*model.Plan, error) {
+	db := database.GetDB()
+	var plans []*model.Plan
+	err := db.Model(model.Plan{}).Find(&plans).Error
+	if err != nil {
+		return nil, err
+	}
+	return plans, nil
+}
+
+func (s *PlanService) GetPlan(id int) (*model.Plan, error) {
+	db := database.GetDB()
+	plan := &model.Plan{}
+	err := db.Model(model.Plan{}).First(plan, id).Error
+	if err != nil {
+		return nil, err
+	}
+	return plan, nil
+}
+
+func (s *PlanService) checkPlan(plan *model.Plan) error {
+	if strings.TrimSpace(plan.Name) == "" {
+		return common.NewError("plan name can not be empty")
+	}
+	if plan.Traffic < 0 || plan.Days < 0 || plan.Price < 0 {
+		return common.NewError("plan traffic, days and price can not be negative")
+	}
+	inbound, err := s.inboundService.GetInbound(plan.InboundId)
+	if err != nil {
+		return common.NewError("plan inbound not found:", plan.InboundId)
+	}
+	if _, err := NewClient(inbound.Protocol, "", 0, 0); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (s *PlanService) AddPlan(plan *model.Plan) (*model.Plan, error) {
+	if err := s.checkPlan(plan); err != nil {
+		return plan, err
+	}
+	db := database.GetDB()
+	return plan, db.Create(plan).Error
+}
+
+func (s *PlanService) UpdatePlan(plan *model.Plan) (*model.Plan, error) {
+	if err := s.checkPlan(plan); err != nil {
+		return plan, err
+	}
+	db := database.GetDB()
+	return plan, db.Save(plan).Error
+}
+
+func (s *PlanService) DelPlan(id int) error {
+	db := database.GetDB()
+	err := db.Where("plan_id = ?", id).Delete(model.ClientPlan{}).Error
+	if err != nil {
+		return err
+	}
+	return db.Delete(model.Plan{}, id).Error
+}
+
+func (s *PlanService) GetClientPlans() ([]*model.ClientPlan, error) {
+	db := database.GetDB()
+	var clientPlans []*model.ClientPlan
+	err := db.Model(model.ClientPlan{}).Find(&clientPlans).Error
+	if err != nil {
+		return nil, err
+	}
+	return clientPlans, nil
+}
+
+// AssignPlan sets the plan a client renews on, planId 0 removes the assignment
+func (s *PlanService) AssignPlan(email string, planId int) error {
+	db := database.GetDB()
+	if planId == 0 {
+		return db.Where("email = ?", email).Delete(model.ClientPlan{}).Error
+	}
+	if _, err := s.GetPlan(planId); err != nil {
+		return common.NewError("plan not found:", planId)
+	}
+	return s.assignPlan(db, email, planId)
+}
+
+func (s *PlanService) assignPlan(tx *gorm.DB, email string, planId int) error {
+	result := tx.Model(model.ClientPlan{}).Where("email = ?", email).Update("plan_id", planId)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return tx.Create(&model.ClientPlan{Email: email, PlanId: planId}).Error
+	}
+	return nil
+}
+
+// FindPlan returns the enabled plan with the id or, ignoring case, the name
+func (s *PlanService) FindPlan(idOrName string) (*model.Plan, error) {
+	plans, err := s.GetPlans()
+	if err != nil {
+		return nil, err
+	}
+	for _, plan := range plans {
+		if plan.Enable && (strconv.Itoa(plan.Id) == idOrName || strings.EqualFold(plan.Name, idOrName)) {
+			return plan, nil
+		}
+	}
+	return nil, common.NewError("plan not found:", idOrName)
+}
+
+// AddPlanClient creates a client with the email on the inbound of the plan, unlike ApplyPlan it refuses
+// emails of existing clients
+func (s *PlanService) AddPlanClient(email string, planId int) (*model.Inbound, error) {
+	email = strings.TrimSpace(email)
+	if email == "" {
+		return nil, common.NewError("client email is empty")
+	}
+	if _, _, err := s.inboundService.FindClient(email); err == nil {
+		return nil, common.NewError("client already exists:", email)
+	}
+	return s.ApplyPlan(email, planId)
+}
+
+// ApplyPlan renews the client with the email for another period of the plan, or creates it on the inbound of the
+// plan if it does not exist. A renewal resets the traffic and extends the expiry from the later of now and the old expiry.
+// Disabled plans are refused.
+func (s *PlanService) ApplyPlan(email string, planId int) (*model.Inbound, error) {
+	plan, err := s.getEnabledPlan(planId)
+	if err != nil {
+		return nil, err
+	}
+	var inbound *model.Inbound
+	renewed := false
+	err = database.GetDB().Transaction(func(tx *gorm.DB) error {
+		var err error
+		inbound, renewed, err = s.applyPlan(tx, email, plan)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.planApplied(inbound, email, plan, renewed)
+	return inbound, nil
+}
+
+func (s *PlanService) getEnabledPlan(planId int) (*model.Plan, error) {
+	plan, err := s.GetPlan(planId)
+	if err != nil {
+		return nil, common.NewError("plan not found:", planId)
+	}
+	if !plan.Enable {
+		return nil, common.NewError("plan is disabled:", plan.Name)
+	}
+	return plan, nil
+}
+
+// applyPlan makes the changes of ApplyPlan in the transaction, it tells whether an existing client was renewed
+func (s *PlanService) applyPlan(tx *gorm.DB, email string, plan *model.Plan) (*model.Inbound, bool, error) {
+	period := time.Hour * 24 * time.Duration(plan.Days)
+	now := time.Now()
+
+	var inbound *model.Inbound
+	_, _, err := s.inboundService.findClient(tx, email)
+	renewed := err == nil
+	if renewed {
+		inbound, err = s.inboundService.updateClient(tx, email, func(client map[string]interface{}) {
+			expiryTime := int64(0)
+			if plan.Days > 0 {
+				from := now
+				if old := time.UnixMilli(clientInt(client, "expiryTime")); old.After(now) {
+					from = old
+				}
+				expiryTime = from.Add(period).UnixMilli()
+			}
+			client["expiryTime"] = expiryTime
+			client["totalGB"] = plan.Traffic
+		})
+		if err != nil {
+			return nil, false, err
+		}
+		err = s.inboundService.resetClientTraffic(tx, email)
+		if err != nil {
+			return nil, false, err
+		}
+	} else {
+		planInbound := &model.Inbound{}
+		err = tx.Model(model.Inbound{}).First(planInbound, plan.InboundId).Error
+		if err != nil {
+			return nil, false, err
+		}
+		expiryTime := int64(0)
+		if plan.Days > 0 {
+			expiryTime = now.Add(period).UnixMilli()
+		}
+		client, err := NewClient(planInbound.Protocol, email, plan.Traffic, expiryTime)
+		if err != nil {
+			return nil, false, err
+		}
+		inbound, err = s.inboundService.addClient(tx, plan.InboundId, client)
+		if err != nil {
+			return nil, false, err
+		}
+	}
+
+	err = s.assignPlan(tx, email, plan.Id)
+	if err != nil {
+		return nil, false, err
+	}
+	return inbound, renewed, nil
+}
+
+// planApplied restarts xray and tells about the applied plan once its transaction committed
+func (s *PlanService) planApplied(inbound *model.Inbound, email string, plan *model.Plan, renewed bool) {
+	s.xrayService.SetToNeedRestart()
+	s.webhookService.Dispatch(EventClientRenewed, map[string]interface{}{"email": email, "plan": plan.Name})
+	if renewed {
+		s.notifyRenewed(inbound, email, plan)
+	}
+}
+
+// notifyRenewed sends the new expiry and the share links of the renewed client to its telegram user
+func (s *PlanService) notifyRenewed(inbound *model.Inbound, email string, plan *model.Plan) {
+	_, client, err := s.inboundService.FindClient(email)
+	if err != nil {
+		return
+	}
+	expiry := locale.I18n("tgbot.unlimited")
+	if expiryTime := clientInt(client, "expiryTime"); expiryTime > 0 {
+		expiry = time.UnixMilli(expiryTime).Format("2006-01-02 15:04:05")
+	}
+	links, err := GenLinks(inbound, email, s.serverService.GetPreferredPublicIP())
+	if err != nil {
+		logger.Warning("generate links of renewed client failed:", email, err)
+	}
+	s.inboundService.NotifyClient(email, locale.I18n("tgbot.clientRenewed",
+		"Email", email, "Plan", plan.Name, "Expiry", expiry, "Links", strings.Join(links, "\r\n\r\n")))
+}
+
+// RecordPayment applies a payment once, repeated deliveries of the same payment return false without changes.
+// A payment without a plan renews the client on its assigned plan, a payment of less than the price of the plan or
+// in another currency is refused. The payment is stored before the plan is applied in the same transaction, a
+// delivery another panel sharing the database applied already fails on the unique index of payments and returns false.
+func (s *PlanService) RecordPayment(payment *model.Payment) (bool, error) {
+	if payment.ExternalId == "" || payment.Email == "" {
+		return false, common.NewError("payment id and client email are required")
+	}
+	paymentLock.Lock()
+	defer paymentLock.Unlock()
+	db := database.GetDB()
+	var count int64
+	err := db.Model(model.Payment{}).
+		Where("provider = ? and external_id = ?", payment.Provider, payment.ExternalId).
+		Count(&count).Error
+	if err != nil {
+		return false, err
+	}
+	if count > 0 {
+		return false, nil
+	}
+	if payment.PlanId == 0 {
+		clientPlan := &model.ClientPlan{}
+		err = db.Model(model.ClientPlan{}).Where("email = ?", payment.Email).First(clientPlan).Error
+		if err != nil {
+			return false, common.NewError("client has no plan:", payment.Email)
+		}
+		payment.PlanId = clientPlan.PlanId
+	}
+	plan, err := s.getEnabledPlan(payment.PlanId)
+	if err != nil {
+		return false, err
+	}
+	err = checkPaymentAmount(payment, plan)
+	if err != nil {
+		return false, err
+	}
+
+	var inbound *model.Inbound
+	renewed := false
+	err = db.Transaction(func(tx *gorm.DB) error {
+		payment.Time = time.Now().Unix()
+		err := tx.Create(payment).Error
+		if err != nil {
+			return err
+		}
+		inbound, renewed, err = s.applyPlan(tx, payment.Email, plan)
+		if err != nil {
+			return err
+		}
+		_, client, err := s.inboundService.findClient(tx, payment.Email)
+		if err != nil {
+			return err
+		}
+		payment.ExpiryTime = clientInt(client, "expiryTime")
+		payment.Traffic = clientInt(client, "totalGB")
+		return tx.Model(payment).Updates(map[string]interface{}{
+			"expiry_time": payment.ExpiryTime,
+			"traffic":     payment.Traffic,
+		}).Error
+	})
+	if database.IsDuplicate(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	s.planApplied(inbound, payment.Email, plan, renewed)
+	return true, nil
+}
+
+// checkPaymentAmount refuses a payment of less than the price of the plan or in another currency than the plan.
+// Gateways differ in the case of currency codes, a plan without a currency accepts any
+func checkPaymentAmount(payment *model.Payment, plan *model.Plan) error {
+	if plan.Currency != "" && !strings.EqualFold(payment.Currency, plan.Currency) {
+		return common.NewErrorf("payment %v is in %v, plan %v costs %v %v", payment.ExternalId, payment.Currency, plan.Name, plan.Price, plan.Currency)
+	}
+	if payment.Amount+paymentTolerance < plan.Price {
+		return common.NewErrorf("payment %v of %v is less than the price %v of plan %v", payment.ExternalId, payment.Amount, plan.Price, plan.Name)
+	}
+	return nil
+}
+
+// GetPayments returns the applied payments, of the client with the email if it is not empty, newest first
+func (s *PlanService) GetPayments(email string) ([]*model.Payment, error) {
+	db := database.GetDB().Model(model.Payment{})
+	if email != "" {
+		db = db.Where("email = ?", email)
+	}
+	var payments []*model.Payment
+	err := db.Order("time desc").Find(&payments).Error
+	if err != nil {
+		return nil, err
+	}
+	return payments, nil
+}
+
+// VerifySignature checks the X-XUI-Signature of a payment delivered in the panel's own format, it signs
+// "<X-XUI-Timestamp>.<body>" like Sign, so a captured delivery can not be replayed once the timestamp is stale
+func (s *PlanService) VerifySignature(secret string, timestamp string, signature string, body []byte) bool {
+	if !isFreshTimestamp(timestamp) {
+		return false
+	}
+	return hmac.Equal([]byte(Sign(secret, append([]byte(timestamp+"."), body...))), []byte(signature))
+}
+
+// isFreshTimestamp tells whether the unix time is within paymentSignatureTolerance of now
+func isFreshTimestamp(timestamp string) bool {
+	t, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return false
+	}
+	age := time.Since(time.Unix(t, 0))
+	return age <= paymentSignatureTolerance && age >= -paymentSignatureTolerance
+}
+
+// VerifyStripeSignature checks a Stripe-Signature header: t=<unix time>,v1=<hex hmac of "t.body">
+func (s *PlanService) VerifyStripeSignature(secret string, header string, body []byte) bool {
+	var timestamp string
+	signatures := make([]string, 0)
+	for _, part := range strings.Split(header, ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+		switch key {
+		case "t":
+			timestamp = value
+		case "v1":
+			signatures = append(signatures, value)
+		}
+	}
+	if !isFreshTimestamp(timestamp) {
+		return false
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	expected := hex.EncodeToString(mac.Sum(nil))
+	for _, signature := range signatures {
+		if hmac.Equal([]byte(expected), []byte(signature)) {
+			return true
+		}
+	}
+	return false
+}
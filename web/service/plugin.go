@@ -0,0 +1,154 @@
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"path/filepath"
+	"sync"
+	"time"
+	"x-ui/config"
+	"x-ui/logger"
+	"x-ui/util/plugin"
+)
+
+// hooks plugins may change the data of, every webhook event is also passed to plugins to observe
+const (
+	// HookConfigRender gets the xray config before xray is started with it
+	HookConfigRender = "config.render"
+	// HookSubscriptionRendered gets the links of a subscription before they are encoded
+	HookSubscriptionRendered = "subscription.rendered"
+)
+
+// plugins that take longer are killed, rendering the config waits for them
+const pluginTimeout = time.Second * 10
+
+// the plugin dir is listed again after this, plugins added meanwhile are called from then on
+const pluginListTTL = time.Minute
+
+// subscriptions are public, at most this many of them run the plugins at once and the others are
+// answered without them, so requests can not start plugin processes without bound
+const maxSubscriptionPlugins = 4
+
+var (
+	pluginLock     sync.Mutex
+	pluginList     []plugin.Plugin
+	pluginListTime time.Time
+
+	subscriptionPlugins = make(chan struct{}, maxSubscriptionPlugins)
+)
+
+// SubscriptionLinks is the data of HookSubscriptionRendered
+type SubscriptionLinks struct {
+	SubId string   `json:"subId"`
+	Links []string `json:"links"`
+}
+
+// GetPluginDir is where the plugin executables are, next to the database
+func GetPluginDir() string {
+	return filepath.Join(filepath.Dir(config.GetDBPath()), "plugins")
+}
+
+func GetPlugins() ([]plugin.Plugin, error) {
+	return plugin.List(GetPluginDir())
+}
+
+// getCachedPlugins lists the plugin dir at most once per pluginListTTL, the hooks run too often to read it
+// every time
+func getCachedPlugins() ([]plugin.Plugin, error) {
+	pluginLock.Lock()
+	defer pluginLock.Unlock()
+	if pluginList != nil && time.Since(pluginListTime) < pluginListTTL {
+		return pluginList, nil
+	}
+	plugins, err := GetPlugins()
+	if err != nil {
+		return nil, err
+	}
+	if plugins == nil {
+		plugins = []plugin.Plugin{}
+	}
+	pluginList = plugins
+	pluginListTime = time.Now()
+	return plugins, nil
+}
+
+// observePlugins passes the event to every plugin, their output is ignored
+func observePlugins(hook string, data interface{}) {
+	plugins, err := getCachedPlugins()
+	if err != nil {
+		logger.Warning("list plugins failed:", err)
+		return
+	}
+	if len(plugins) == 0 {
+		return
+	}
+	body, err := json.Marshal(data)
+	if err != nil {
+		logger.Warning("encode plugin data failed:", hook, err)
+		return
+	}
+	for _, p := range plugins {
+		_, err := plugin.Call(p, hook, body, pluginTimeout)
+		if err != nil {
+			logger.Warning(hook, err)
+		}
+	}
+}
+
+// mutatePlugins passes data through the plugins in order, each gets what the one before printed, empty
+// output keeps the data. The result is decoded into out and true returned only if a plugin changed it,
+// failing plugins are skipped so a broken plugin can not take the panel down
+func mutatePlugins(hook string, data interface{}, out interface{}) bool {
+	plugins, err := getCachedPlugins()
+	if err != nil {
+		logger.Warning("list plugins failed:", err)
+		return false
+	}
+	if len(plugins) == 0 {
+		return false
+	}
+	original, err := json.Marshal(data)
+	if err != nil {
+		logger.Warning("encode plugin data failed:", hook, err)
+		return false
+	}
+	body := original
+	for _, p := range plugins {
+		result, err := plugin.Call(p, hook, body, pluginTimeout)
+		if err != nil {
+			logger.Warning(hook, err)
+			continue
+		}
+		result = bytes.TrimSpace(result)
+		if len(result) == 0 {
+			continue
+		}
+		if !json.Valid(result) {
+			logger.Warning(hook, "plugin", p.Name, "printed invalid json, ignored")
+			continue
+		}
+		body = result
+	}
+	if bytes.Equal(body, original) {
+		return false
+	}
+	err = json.Unmarshal(body, out)
+	if err != nil {
+		logger.Warning(hook, "decode plugin output failed:", err)
+		return false
+	}
+	return true
+}
+
+// mutateSubscriptionPlugins is mutatePlugins for HookSubscriptionRendered, it returns false without calling
+// the plugins while maxSubscriptionPlugins subscriptions are running them
+func mutateSubscriptionPlugins(links *SubscriptionLinks, out *SubscriptionLinks) bool {
+	select {
+	case subscriptionPlugins <- struct{}{}:
+		defer func() { <-subscriptionPlugins }()
+	default:
+		logger.Warning(HookSubscriptionRendered, "too many subscriptions running plugins, skipped")
+		return false
+	}
+	return mutatePlugins(HookSubscriptionRendered, links, out)
+}
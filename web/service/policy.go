@@ -0,0 +1,212 @@
+package service
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+	"x-ui/database"
+	"x-ui/database/model"
+	"x-ui/logger"
+	"x-ui/util/common"
+	"x-ui/xray"
+)
+
+// ClientPolicy assigns a policy profile to a client, profile id 0 puts the client back on level 0
+type ClientPolicy struct {
+	Email     string `json:"email" form:"email"`
+	ProfileId int    `json:"profileId" form:"profileId"`
+}
+
+type PolicyService struct {
+	inboundService InboundServiceImpl
+}
+
+func (s *PolicyService) GetPolicyProfiles() ([]*model.PolicyProfile, error) {
+	db := database.GetDB()
+	var profiles []*model.PolicyProfile
+	err := db.Model(model.PolicyProfile{}).Order("level").Find(&profiles).Error
+	if err != nil {
+		return nil, err
+	}
+	return profiles, nil
+}
+
+func (s *PolicyService) GetPolicyProfile(id int) (*model.PolicyProfile, error) {
+	db := database.GetDB()
+	profile := &model.PolicyProfile{}
+	err := db.Model(model.PolicyProfile{}).First(profile, id).Error
+	if err != nil {
+		return nil, err
+	}
+	return profile, nil
+}
+
+func (s *PolicyService) checkPolicyProfile(profile *model.PolicyProfile) error {
+	profile.Name = strings.TrimSpace(profile.Name)
+	if profile.Name == "" {
+		return common.NewError("policy profile name is empty")
+	}
+	if profile.Level < 0 {
+		return common.NewError("policy level can not be negative:", profile.Level)
+	}
+	if profile.Handshake < 0 || profile.ConnIdle < 0 || profile.UplinkOnly < 0 || profile.DownlinkOnly < 0 {
+		return common.NewError("policy timeouts can not be negative")
+	}
+	// the traffic of clients and their limits are counted from these stats, clients without a level are on level 0
+	if profile.Level == 0 && (!profile.StatsUserUplink || !profile.StatsUserDownlink) {
+		return common.NewError("policy level 0 must keep the user uplink and downlink stats")
+	}
+	db := database.GetDB()
+	var count int64
+	err := db.Model(model.PolicyProfile{}).Where("level = ? and id != ?", profile.Level, profile.Id).Count(&count).Error
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return common.NewError("another policy profile has level", profile.Level)
+	}
+	return nil
+}
+
+func (s *PolicyService) AddPolicyProfile(profile *model.PolicyProfile) (*model.PolicyProfile, error) {
+	if err := s.checkPolicyProfile(profile); err != nil {
+		return profile, err
+	}
+	db := database.GetDB()
+	err := db.Create(profile).Error
+	return profile, err
+}
+
+// UpdatePolicyProfile can not change the level while clients use it, they would silently move to another level
+func (s *PolicyService) UpdatePolicyProfile(profile *model.PolicyProfile) (*model.PolicyProfile, error) {
+	old, err := s.GetPolicyProfile(profile.Id)
+	if err != nil {
+		return profile, err
+	}
+	if old.Level != profile.Level {
+		count, err := s.countLevelClients(old.Level)
+		if err != nil {
+			return profile, err
+		}
+		if count > 0 {
+			return profile, common.NewErrorf("level %v is used by %v clients", old.Level, count)
+		}
+	}
+	if err := s.checkPolicyProfile(profile); err != nil {
+		return profile, err
+	}
+	db := database.GetDB()
+	err = db.Save(profile).Error
+	return profile, err
+}
+
+func (s *PolicyService) DelPolicyProfile(id int) error {
+	profile, err := s.GetPolicyProfile(id)
+	if err != nil {
+		return err
+	}
+	count, err := s.countLevelClients(profile.Level)
+	if err != nil {
+		return err
+	}
+	if count > 0 && profile.Level != 0 {
+		return common.NewErrorf("policy profile is used by %v clients", count)
+	}
+	db := database.GetDB()
+	return db.Delete(model.PolicyProfile{}, id).Error
+}
+
+// countLevelClients counts the clients of all inbounds on the level, clients without a level are on level 0
+func (s *PolicyService) countLevelClients(level int) (int, error) {
+	inbounds, err := s.inboundService.GetAllInbounds()
+	if err != nil {
+		return 0, err
+	}
+	count := 0
+	for _, inbound := range inbounds {
+		_, clients, err := parseClients(inbound)
+		if err != nil {
+			continue
+		}
+		for _, client := range clients {
+			c, ok := client.(map[string]interface{})
+			if ok && clientInt(c, "level") == int64(level) {
+				count++
+			}
+		}
+	}
+	return count, nil
+}
+
+// SetClientPolicy moves the client to the level of the profile
+func (s *PolicyService) SetClientPolicy(email string, profileId int) (*model.Inbound, error) {
+	level := 0
+	if profileId > 0 {
+		profile, err := s.GetPolicyProfile(profileId)
+		if err != nil {
+			return nil, err
+		}
+		level = profile.Level
+	}
+	return s.inboundService.UpdateClient(email, func(client map[string]interface{}) {
+		client["level"] = level
+	})
+}
+
+// addPolicyLevels writes the profiles into the policy levels of the config, a profile replaces
+// a level of the template with the same number
+func (s *PolicyService) addPolicyLevels(xrayConfig *xray.Config) error {
+	profiles, err := s.GetPolicyProfiles()
+	if err != nil {
+		return err
+	}
+	if len(profiles) == 0 {
+		return nil
+	}
+	policy := map[string]interface{}{}
+	if len(xrayConfig.Policy) > 0 {
+		err = json.Unmarshal(xrayConfig.Policy, &policy)
+		if err != nil {
+			return common.NewError("policy of xray config template is invalid:", err)
+		}
+	}
+	levels, _ := policy["levels"].(map[string]interface{})
+	if levels == nil {
+		levels = map[string]interface{}{}
+	}
+	for _, profile := range profiles {
+		if profile.Level == 0 && (!profile.StatsUserUplink || !profile.StatsUserDownlink) {
+			// saved before checkPolicyProfile refused it
+			logger.Warningf("policy profile %v turns off the user stats of level 0, keeping them on", profile.Name)
+			profile.StatsUserUplink = true
+			profile.StatsUserDownlink = true
+		}
+		level := map[string]interface{}{
+			"statsUserUplink":   profile.StatsUserUplink,
+			"statsUserDownlink": profile.StatsUserDownlink,
+		}
+		if profile.Handshake > 0 {
+			level["handshake"] = profile.Handshake
+		}
+		if profile.ConnIdle > 0 {
+			level["connIdle"] = profile.ConnIdle
+		}
+		if profile.UplinkOnly > 0 {
+			level["uplinkOnly"] = profile.UplinkOnly
+		}
+		if profile.DownlinkOnly > 0 {
+			level["downlinkOnly"] = profile.DownlinkOnly
+		}
+		if profile.BufferSize >= 0 {
+			level["bufferSize"] = profile.BufferSize
+		}
+		levels[strconv.Itoa(profile.Level)] = level
+	}
+	policy["levels"] = levels
+	data, err := json.Marshal(policy)
+	if err != nil {
+		return err
+	}
+	xrayConfig.Policy = data
+	return nil
+}
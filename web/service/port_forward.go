@@ -0,0 +1,150 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"strings"
+	"x-ui/database"
+	"x-ui/database/model"
+	"x-ui/util/common"
+	"x-ui/util/json_util"
+	"x-ui/xray"
+)
+
+// PortForwardService manages port forwards, xray serves each enabled one with a dokodemo-door inbound
+// tagged forward-<id>
+type PortForwardService struct {
+	inboundService InboundServiceImpl
+}
+
+func (s *PortForwardService) GetPortForwards() ([]*model.PortForward, error) {
+	db := database.GetDB()
+	var forwards []*model.PortForward
+	err := db.Model(model.PortForward{}).Order("port").Find(&forwards).Error
+	if err != nil {
+		return nil, err
+	}
+	return forwards, nil
+}
+
+func (s *PortForwardService) GetPortForward(id int) (*model.PortForward, error) {
+	db := database.GetDB()
+	forward := &model.PortForward{}
+	err := db.Model(model.PortForward{}).First(forward, id).Error
+	if err != nil {
+		return nil, err
+	}
+	return forward, nil
+}
+
+func (s *PortForwardService) checkPortForward(forward *model.PortForward) error {
+	forward.Remark = strings.TrimSpace(forward.Remark)
+	forward.Listen = strings.TrimSpace(forward.Listen)
+	forward.Address = strings.TrimSpace(forward.Address)
+	if forward.Network == "" {
+		forward.Network = "tcp"
+	}
+	switch forward.Network {
+	case "tcp", "udp", "tcp,udp":
+	default:
+		return common.NewError("network must be tcp, udp or tcp,udp:", forward.Network)
+	}
+	if forward.Port < 1 || forward.Port > 65535 {
+		return common.NewError("port must be within 1-65535:", forward.Port)
+	}
+	if forward.DestPort < 1 || forward.DestPort > 65535 {
+		return common.NewError("destination port must be within 1-65535:", forward.DestPort)
+	}
+	if forward.Address == "" {
+		return common.NewError("destination address is empty")
+	}
+	if forward.Listen != "" && net.ParseIP(forward.Listen) == nil {
+		return common.NewError("listen must be an ip address:", forward.Listen)
+	}
+
+	inbounds, err := s.inboundService.GetAllInbounds()
+	if err != nil {
+		return err
+	}
+	for _, inbound := range inbounds {
+		for _, port := range inbound.Ports() {
+			if port == forward.Port {
+				return common.NewErrorf("port %v is used by inbound %v", port, inbound.Remark)
+			}
+		}
+		if inPortHopping(inbound, forward.Port) {
+			return common.NewErrorf("port %v is in the port hopping range of inbound %v", forward.Port, inbound.Remark)
+		}
+	}
+	db := database.GetDB()
+	var count int64
+	err = db.Model(model.PortForward{}).Where("port = ? and id != ?", forward.Port, forward.Id).Count(&count).Error
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return common.NewError("another port forward uses port", forward.Port)
+	}
+	return nil
+}
+
+func (s *PortForwardService) AddPortForward(forward *model.PortForward) (*model.PortForward, error) {
+	if err := s.checkPortForward(forward); err != nil {
+		return forward, err
+	}
+	db := database.GetDB()
+	err := db.Create(forward).Error
+	return forward, err
+}
+
+func (s *PortForwardService) UpdatePortForward(forward *model.PortForward) (*model.PortForward, error) {
+	_, err := s.GetPortForward(forward.Id)
+	if err != nil {
+		return forward, err
+	}
+	if err := s.checkPortForward(forward); err != nil {
+		return forward, err
+	}
+	db := database.GetDB()
+	err = db.Save(forward).Error
+	return forward, err
+}
+
+func (s *PortForwardService) DelPortForward(id int) error {
+	db := database.GetDB()
+	return db.Delete(model.PortForward{}, id).Error
+}
+
+// addPortForwards appends the dokodemo-door inbounds of the enabled port forwards to the xray config
+func (s *PortForwardService) addPortForwards(xrayConfig *xray.Config) error {
+	forwards, err := s.GetPortForwards()
+	if err != nil {
+		return err
+	}
+	for _, forward := range forwards {
+		if !forward.Enable {
+			continue
+		}
+		settings, err := json.Marshal(map[string]interface{}{
+			"address": forward.Address,
+			"port":    forward.DestPort,
+			"network": forward.Network,
+		})
+		if err != nil {
+			return err
+		}
+		listen := ""
+		if forward.Listen != "" {
+			listen = fmt.Sprintf("\"%v\"", forward.Listen)
+		}
+		xrayConfig.InboundConfigs = append(xrayConfig.InboundConfigs, xray.InboundConfig{
+			Listen:   json_util.RawMessage(listen),
+			Port:     json_util.RawMessage(fmt.Sprint(forward.Port)),
+			Protocol: string(model.Dokodemo),
+			Settings: json_util.RawMessage(settings),
+			Tag:      fmt.Sprintf("forward-%v", forward.Id),
+		})
+	}
+	return nil
+}
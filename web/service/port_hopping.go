@@ -0,0 +1,125 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"x-ui/database/model"
+	"x-ui/util/common"
+	"x-ui/util/porthop"
+)
+
+var portHoppingLock sync.Mutex
+
+// the rules last applied by ApplyPortHopping, nil as long as none were
+var appliedPortHopping []porthop.Rule
+
+// PortHoppingService keeps the nat rules that redirect the port hopping range of an inbound to its port
+type PortHoppingService struct {
+	inboundService InboundServiceImpl
+}
+
+// hopsUdp tells whether the transport of the inbound runs over udp, only those can hop ports
+func hopsUdp(inbound *model.Inbound) bool {
+	stream := map[string]interface{}{}
+	if json.Unmarshal([]byte(inbound.StreamSettings), &stream) != nil {
+		return false
+	}
+	network := streamString(stream, "network")
+	return network == "kcp" || network == "quic"
+}
+
+// checkPortHopping normalizes the port hopping range of the inbound, it must not cover the port of another
+// inbound or overlap its range, and the port of the inbound must not be in the range of another one
+func (s *InboundServiceImpl) checkPortHopping(inbound *model.Inbound) error {
+	inbound.PortHopping = strings.TrimSpace(inbound.PortHopping)
+	var start, end int
+	if inbound.PortHopping != "" {
+		if !hopsUdp(inbound) {
+			return common.NewError("port hopping needs the kcp or quic transport")
+		}
+		var err error
+		start, end, err = porthop.ParseRange(inbound.PortHopping)
+		if err != nil {
+			return err
+		}
+		inbound.PortHopping = fmt.Sprintf("%v-%v", start, end)
+	}
+	inbounds, err := s.GetAllInbounds()
+	if err != nil {
+		return err
+	}
+	for _, other := range inbounds {
+		if other.Id == inbound.Id {
+			continue
+		}
+		for _, otherPort := range other.Ports() {
+			if inbound.PortHopping != "" && otherPort >= start && otherPort <= end {
+				return common.NewErrorf("port hopping range %v covers port %v of inbound %v", inbound.PortHopping, otherPort, other.Remark)
+			}
+		}
+		if other.PortHopping == "" {
+			continue
+		}
+		otherStart, otherEnd, err := porthop.ParseRange(other.PortHopping)
+		if err != nil {
+			continue
+		}
+		if inbound.Port >= otherStart && inbound.Port <= otherEnd {
+			return common.NewErrorf("port %v is in the port hopping range of inbound %v", inbound.Port, other.Remark)
+		}
+		if inbound.PortHopping != "" && start <= otherEnd && otherStart <= end {
+			return common.NewErrorf("port hopping range %v overlaps the one of inbound %v", inbound.PortHopping, other.Remark)
+		}
+	}
+	return nil
+}
+
+// GetPortHoppingRules returns the redirects of the enabled inbounds, ordered by range
+func (s *PortHoppingService) GetPortHoppingRules() ([]porthop.Rule, error) {
+	inbounds, err := s.inboundService.GetAllInbounds()
+	if err != nil {
+		return nil, err
+	}
+	rules := make([]porthop.Rule, 0)
+	for _, inbound := range inbounds {
+		if !inbound.Enable || inbound.PortHopping == "" {
+			continue
+		}
+		start, end, err := porthop.ParseRange(inbound.PortHopping)
+		if err != nil {
+			continue
+		}
+		rules = append(rules, porthop.Rule{Start: start, End: end, Port: inbound.Port})
+	}
+	sort.Slice(rules, func(i, j int) bool {
+		return rules[i].Start < rules[j].Start
+	})
+	return rules, nil
+}
+
+// ApplyPortHopping brings the nat rules in line with GetPortHoppingRules, it does nothing while the rules
+// are unchanged, so panels without port hopping never touch the firewall
+func (s *PortHoppingService) ApplyPortHopping() error {
+	portHoppingLock.Lock()
+	defer portHoppingLock.Unlock()
+
+	rules, err := s.GetPortHoppingRules()
+	if err != nil {
+		return err
+	}
+	if len(rules) == 0 && appliedPortHopping == nil {
+		return nil
+	}
+	if appliedPortHopping != nil && fmt.Sprint(rules) == fmt.Sprint(appliedPortHopping) {
+		return nil
+	}
+	err = porthop.Apply(rules)
+	if err != nil {
+		return err
+	}
+	appliedPortHopping = rules
+	return nil
+}
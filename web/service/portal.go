@@ -0,0 +1,149 @@
+package service
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"x-ui/database"
+	"x-ui/database/model"
+	"x-ui/util/common"
+	"x-ui/xray"
+)
+
+// PortalInfo is what an end user sees about their own client in the portal
+type PortalInfo struct {
+	Email      string `json:"email"`
+	Enable     bool   `json:"enable"`
+	Up         int64  `json:"up"`
+	Down       int64  `json:"down"`
+	Total      int64  `json:"total"`
+	ExpiryTime int64  `json:"expiryTime"`
+
+	// the inbound of the client with every other client and the server side secrets removed,
+	// enough for the portal page to build the share link
+	Inbound *model.Inbound `json:"inbound"`
+}
+
+type PortalService struct {
+	inboundService InboundServiceImpl
+}
+
+// findClient returns the inbound and settings of the client with the email
+func (s *PortalService) findClient(email string) (*model.Inbound, *model.Client, error) {
+	inbounds, err := s.inboundService.GetAllInbounds()
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, inbound := range inbounds {
+		clients, err := s.inboundService.getClients(inbound)
+		if err != nil {
+			continue
+		}
+		for i := range clients {
+			if clients[i].Email == email {
+				return inbound, &clients[i], nil
+			}
+		}
+	}
+	return nil, nil, common.NewError("client not found:", email)
+}
+
+// CheckClient logs an end user in with the email of their client and its id, or password for trojan
+func (s *PortalService) CheckClient(email string, secret string) bool {
+	if email == "" || secret == "" {
+		return false
+	}
+	_, client, err := s.findClient(email)
+	if err != nil {
+		return false
+	}
+	for _, expected := range []string{client.ID, client.Password} {
+		if expected != "" && subtle.ConstantTimeCompare([]byte(expected), []byte(secret)) == 1 {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *PortalService) GetPortalInfo(email string) (*PortalInfo, error) {
+	inbound, client, err := s.findClient(email)
+	if err != nil {
+		return nil, err
+	}
+	info := &PortalInfo{
+		Email:      email,
+		Enable:     inbound.Enable,
+		Total:      client.TotalGB,
+		ExpiryTime: client.ExpiryTime,
+	}
+
+	db := database.GetDB()
+	traffic := &xray.ClientTraffic{}
+	err = db.Model(xray.ClientTraffic{}).Where("email = ?", email).First(traffic).Error
+	if err == nil {
+		info.Enable = info.Enable && traffic.Enable
+		info.Up = traffic.Up
+		info.Down = traffic.Down
+	} else if !database.IsNotFound(err) {
+		return nil, err
+	}
+
+	info.Inbound, err = s.publicInbound(inbound, email)
+	if err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+// publicInbound copies the inbound keeping only the client with the email and without private keys
+func (s *PortalService) publicInbound(inbound *model.Inbound, email string) (*model.Inbound, error) {
+	settings := map[string]interface{}{}
+	err := json.Unmarshal([]byte(inbound.Settings), &settings)
+	if err != nil {
+		return nil, err
+	}
+	if clients, ok := settings["clients"].([]interface{}); ok {
+		own := make([]interface{}, 0, 1)
+		for _, client := range clients {
+			if c, ok := client.(map[string]interface{}); ok && c["email"] == email {
+				own = append(own, c)
+			}
+		}
+		settings["clients"] = own
+	}
+	settingsJson, err := json.Marshal(settings)
+	if err != nil {
+		return nil, err
+	}
+
+	stream := map[string]interface{}{}
+	if inbound.StreamSettings != "" {
+		err = json.Unmarshal([]byte(inbound.StreamSettings), &stream)
+		if err != nil {
+			return nil, err
+		}
+	}
+	for _, key := range []string{"tlsSettings", "xtlsSettings"} {
+		if tls, ok := stream[key].(map[string]interface{}); ok {
+			delete(tls, "certificates")
+		}
+	}
+	if reality, ok := stream["realitySettings"].(map[string]interface{}); ok {
+		delete(reality, "privateKey")
+	}
+	streamJson, err := json.Marshal(stream)
+	if err != nil {
+		return nil, err
+	}
+
+	return &model.Inbound{
+		Remark:         inbound.Remark,
+		Enable:         inbound.Enable,
+		Listen:         inbound.Listen,
+		Port:           inbound.Port,
+		ExtraPorts:     inbound.ExtraPorts,
+		Protocol:       inbound.Protocol,
+		Settings:       string(settingsJson),
+		StreamSettings: string(streamJson),
+		Tag:            inbound.Tag,
+	}, nil
+}
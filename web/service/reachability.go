@@ -0,0 +1,179 @@
+package service
+
+import (
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+	"x-ui/database/model"
+	"x-ui/logger"
+	"x-ui/util/common"
+)
+
+// how long the checker waits for a port to accept a connection
+const reachabilityTimeout = time.Second * 5
+
+// ReachabilityTarget is a tcp port the checker dials
+type ReachabilityTarget struct {
+	Host string `json:"host"`
+	Port int    `json:"port"`
+}
+
+// ReachabilityStatus is whether a port of an inbound could be reached from the checker, Latency is the
+// time to connect in milliseconds
+type ReachabilityStatus struct {
+	InboundId int     `json:"inboundId"`
+	Tag       string  `json:"tag"`
+	Host      string  `json:"host"`
+	Port      int     `json:"port"`
+	Reachable bool    `json:"reachable"`
+	Latency   float64 `json:"latency"`
+	Error     string  `json:"error,omitempty"`
+	CheckTime int64   `json:"checkTime"`
+}
+
+var reachabilityStatuses []*ReachabilityStatus
+var reachabilityLock sync.Mutex
+
+// ReachabilityService has a node or another panel connect to the inbound ports of this server, a local
+// check cannot tell that the isp of the server or a firewall on the way drops connections
+type ReachabilityService struct {
+	settingService SettingService
+	serverService  ServerService
+	inboundService InboundServiceImpl
+	nodeService    NodeService
+	webhookService WebhookService
+}
+
+// ProbeTargets dials the targets from this server, it is what a panel does as the checker of another one
+func ProbeTargets(targets []*ReachabilityTarget) []*ReachabilityStatus {
+	statuses := make([]*ReachabilityStatus, len(targets))
+	wg := sync.WaitGroup{}
+	for i, target := range targets {
+		wg.Add(1)
+		go func(i int, target *ReachabilityTarget) {
+			defer wg.Done()
+			status := &ReachabilityStatus{Host: target.Host, Port: target.Port, CheckTime: time.Now().Unix()}
+			start := time.Now()
+			conn, err := net.DialTimeout("tcp", net.JoinHostPort(target.Host, strconv.Itoa(target.Port)), reachabilityTimeout)
+			if err != nil {
+				status.Error = err.Error()
+			} else {
+				conn.Close()
+				status.Reachable = true
+				status.Latency = float64(time.Since(start)) / float64(time.Millisecond)
+			}
+			statuses[i] = status
+		}(i, target)
+	}
+	wg.Wait()
+	return statuses
+}
+
+// getChecker returns the node named by the reachabilityChecker setting or, for a url, another panel
+// reached like a node, nil if the check is off
+func (s *ReachabilityService) getChecker() (*model.Node, error) {
+	checker, err := s.settingService.GetReachabilityChecker()
+	if err != nil || checker == "" {
+		return nil, err
+	}
+	if u, err := url.Parse(checker); err == nil && (u.Scheme == "http" || u.Scheme == "https") {
+		token, err := s.settingService.GetReachabilityCheckerToken()
+		if err != nil {
+			return nil, err
+		}
+		return &model.Node{Name: u.Host, Address: checker, Token: token}, nil
+	}
+	nodes, err := s.nodeService.GetNodes()
+	if err != nil {
+		return nil, err
+	}
+	for _, node := range nodes {
+		if node.Name == checker {
+			return node, nil
+		}
+	}
+	return nil, common.NewError("reachability checker node not found:", checker)
+}
+
+// CheckReachability has the checker dial the tcp ports of the enabled inbounds on the public address of
+// this server and dispatches port.blocked for ports that stopped being reachable
+func (s *ReachabilityService) CheckReachability() error {
+	checker, err := s.getChecker()
+	if err != nil || checker == nil {
+		return err
+	}
+	host := s.serverService.GetPreferredPublicIP()
+	if host == "" {
+		logger.Warning("reachability check skipped, the public address of this server is unknown")
+		return nil
+	}
+	inbounds, err := s.inboundService.GetAllInbounds()
+	if err != nil {
+		return err
+	}
+	targets := make([]*ReachabilityTarget, 0)
+	owners := make([]*model.Inbound, 0)
+	for _, inbound := range inbounds {
+		// udp ports cannot be told apart from closed ones by connecting
+		if !inbound.Enable || hopsUdp(inbound) || inbound.Protocol == model.Dokodemo && inboundUdp(inbound) {
+			continue
+		}
+		address := host
+		if inbound.Listen != "" && inbound.Listen != "0.0.0.0" && inbound.Listen != "::" {
+			if ip := net.ParseIP(inbound.Listen); ip != nil && ip.IsLoopback() {
+				continue
+			}
+			address = inbound.Listen
+		}
+		for _, port := range inbound.Ports() {
+			targets = append(targets, &ReachabilityTarget{Host: address, Port: port})
+			owners = append(owners, inbound)
+		}
+	}
+
+	statuses := make([]*ReachabilityStatus, 0)
+	err = s.nodeService.call(checker, http.MethodPost, "/reachability", targets, &statuses)
+	if err != nil {
+		return err
+	}
+	if len(statuses) != len(targets) {
+		return common.NewErrorf("checker %v answered for %v of %v ports", checker.Name, len(statuses), len(targets))
+	}
+
+	reachabilityLock.Lock()
+	last := map[string]bool{}
+	for _, status := range reachabilityStatuses {
+		last[net.JoinHostPort(status.Host, strconv.Itoa(status.Port))] = status.Reachable
+	}
+	reachabilityLock.Unlock()
+	for i, status := range statuses {
+		status.InboundId = owners[i].Id
+		status.Tag = owners[i].Tag
+		if status.Reachable {
+			continue
+		}
+		if reachable, ok := last[net.JoinHostPort(status.Host, strconv.Itoa(status.Port))]; !ok || reachable {
+			logger.Warningf("port %v of %v is not reachable from %v: %v", status.Port, status.Tag, checker.Name, status.Error)
+			s.webhookService.Dispatch(EventPortBlocked, map[string]interface{}{
+				"tag":     status.Tag,
+				"port":    status.Port,
+				"checker": checker.Name,
+				"error":   status.Error,
+			})
+		}
+	}
+	reachabilityLock.Lock()
+	reachabilityStatuses = statuses
+	reachabilityLock.Unlock()
+	return nil
+}
+
+// GetReachabilityStatuses returns the results of the last CheckReachability
+func (s *ReachabilityService) GetReachabilityStatuses() []*ReachabilityStatus {
+	reachabilityLock.Lock()
+	defer reachabilityLock.Unlock()
+	return reachabilityStatuses
+}
@@ -0,0 +1,209 @@
+package service
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+	"x-ui/database/model"
+	"x-ui/logger"
+	"x-ui/util/common"
+)
+
+// realityDestCandidates are well known sites with tls 1.3 and h2 suggested when the dest of a reality inbound breaks
+var realityDestCandidates = []string{
+	"www.microsoft.com",
+	"www.apple.com",
+	"www.amazon.com",
+	"www.cloudflare.com",
+	"www.mozilla.org",
+	"dl.google.com",
+}
+
+// RealityDestStatus is the last check of one server name of a reality inbound
+type RealityDestStatus struct {
+	InboundId    int      `json:"inboundId"`
+	Tag          string   `json:"tag"`
+	Dest         string   `json:"dest"`
+	ServerName   string   `json:"serverName"`
+	Ok           bool     `json:"ok"`
+	Message      string   `json:"message"`
+	CheckTime    int64    `json:"checkTime"`
+	Alternatives []string `json:"alternatives"`
+}
+
+var realityDestStatuses []*RealityDestStatus
+var realityDestLock sync.Mutex
+
+type RealityService struct {
+	inboundService InboundServiceImpl
+}
+
+// checkTls13Site connects to address with the server name, the certificate must be valid for it and tls 1.3
+// negotiated, h2 tells whether the site also speaks http/2
+func checkTls13Site(address string, serverName string) (h2 bool, err error) {
+	dialer := &net.Dialer{Timeout: time.Second * 10}
+	conn, err := tls.DialWithDialer(dialer, "tcp", address, &tls.Config{
+		ServerName: serverName,
+		MinVersion: tls.VersionTLS13,
+		NextProtos: []string{"h2", "http/1.1"},
+	})
+	if err != nil {
+		return false, err
+	}
+	defer conn.Close()
+	return conn.ConnectionState().NegotiatedProtocol == "h2", nil
+}
+
+// realityDest returns the dest of the reality settings as host:port, ok is false for local dests
+// like a bare port or a unix socket, they are not checked
+func realityDest(dest interface{}) (string, bool) {
+	switch d := dest.(type) {
+	case float64:
+		return "", false
+	case string:
+		if _, err := strconv.Atoi(d); err == nil {
+			return "", false
+		}
+		host, _, err := net.SplitHostPort(d)
+		if err != nil {
+			return net.JoinHostPort(d, "443"), true
+		}
+		if host == "" || host == "127.0.0.1" || host == "localhost" || host == "::1" {
+			return "", false
+		}
+		return d, true
+	}
+	return "", false
+}
+
+// suggestRealityDests returns the candidates that pass the check right now
+func suggestRealityDests(count int) []string {
+	alternatives := make([]string, 0, count)
+	for _, candidate := range realityDestCandidates {
+		h2, err := checkTls13Site(net.JoinHostPort(candidate, "443"), candidate)
+		if err == nil && h2 {
+			alternatives = append(alternatives, candidate)
+			if len(alternatives) == count {
+				break
+			}
+		}
+	}
+	return alternatives
+}
+
+func (s *RealityService) checkInbound(inbound *model.Inbound, now time.Time) []*RealityDestStatus {
+	stream := map[string]interface{}{}
+	if json.Unmarshal([]byte(inbound.StreamSettings), &stream) != nil || streamString(stream, "security") != "reality" {
+		return nil
+	}
+	address, ok := realityDest(streamValue(stream, "realitySettings", "dest"))
+	if !ok {
+		return nil
+	}
+	serverNames, _ := streamValue(stream, "realitySettings", "serverNames").([]interface{})
+	statuses := make([]*RealityDestStatus, 0, len(serverNames))
+	for _, name := range serverNames {
+		serverName, _ := name.(string)
+		if serverName == "" {
+			continue
+		}
+		status := &RealityDestStatus{
+			InboundId:  inbound.Id,
+			Tag:        inbound.Tag,
+			Dest:       address,
+			ServerName: serverName,
+			CheckTime:  now.UnixMilli(),
+		}
+		h2, err := checkTls13Site(address, serverName)
+		switch {
+		case err != nil:
+			status.Message = err.Error()
+		case !h2:
+			status.Message = "tls 1.3 works but h2 is not offered"
+		default:
+			status.Ok = true
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses
+}
+
+// CheckRealityDests checks the dest of every enabled reality inbound with each of its server names.
+// Broken ones are logged with alternatives and reported by the reality_dest alert metric
+func (s *RealityService) CheckRealityDests() error {
+	inbounds, err := s.inboundService.GetAllInbounds()
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	statuses := make([]*RealityDestStatus, 0)
+	var alternatives []string
+	for _, inbound := range inbounds {
+		if !inbound.Enable {
+			continue
+		}
+		for _, status := range s.checkInbound(inbound, now) {
+			if !status.Ok {
+				if alternatives == nil {
+					alternatives = suggestRealityDests(3)
+				}
+				status.Alternatives = alternatives
+				logger.Warningf("reality dest %v of %v fails for %v: %v, working alternatives: %v",
+					status.Dest, status.Tag, status.ServerName, status.Message, alternatives)
+			}
+			statuses = append(statuses, status)
+		}
+	}
+	realityDestLock.Lock()
+	realityDestStatuses = statuses
+	realityDestLock.Unlock()
+	return nil
+}
+
+// GetRealityDestStatuses returns the results of the last CheckRealityDests
+func (s *RealityService) GetRealityDestStatuses() []*RealityDestStatus {
+	realityDestLock.Lock()
+	defer realityDestLock.Unlock()
+	return realityDestStatuses
+}
+
+// realityDestSamples are the alert samples of the reality_dest metric, 1 for a broken dest
+func realityDestSamples() []alertSample {
+	realityDestLock.Lock()
+	defer realityDestLock.Unlock()
+	samples := make([]alertSample, 0, len(realityDestStatuses))
+	for _, status := range realityDestStatuses {
+		value := 0.0
+		if !status.Ok {
+			value = 1
+		}
+		samples = append(samples, alertSample{subject: fmt.Sprintf("%v %v", status.Tag, status.ServerName), value: value})
+	}
+	return samples
+}
+
+// CheckRealityDest checks a dest and server name for the inbound form before it is saved
+func (s *RealityService) CheckRealityDest(dest string, serverName string) (*RealityDestStatus, error) {
+	address, ok := realityDest(dest)
+	if !ok {
+		return nil, common.NewError("local dests are not checked:", dest)
+	}
+	status := &RealityDestStatus{Dest: address, ServerName: serverName, CheckTime: time.Now().UnixMilli()}
+	h2, err := checkTls13Site(address, serverName)
+	switch {
+	case err != nil:
+		status.Message = err.Error()
+	case !h2:
+		status.Message = "tls 1.3 works but h2 is not offered"
+	default:
+		status.Ok = true
+	}
+	if !status.Ok {
+		status.Alternatives = suggestRealityDests(3)
+	}
+	return status, nil
+}
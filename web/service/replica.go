@@ -0,0 +1,188 @@
+package service
+
+import (
+	"context"
+	"sync"
+	"time"
+	"x-ui/database"
+	"x-ui/database/model"
+	"x-ui/logger"
+	"x-ui/util/common"
+)
+
+// replicaLock keeps edits and the periodic sync from pushing the same inbound at the same time
+var replicaLock sync.Mutex
+
+type ReplicaService struct {
+	inboundService InboundServiceImpl
+	nodeService    NodeService
+}
+
+func (s *ReplicaService) GetReplicas(inboundId int) ([]*model.InboundReplica, error) {
+	db := database.GetDB()
+	var replicas []*model.InboundReplica
+	err := db.Model(model.InboundReplica{}).Where("inbound_id = ?", inboundId).Find(&replicas).Error
+	if err != nil {
+		return nil, err
+	}
+	return replicas, nil
+}
+
+// SetReplicas replaces the nodes an inbound is replicated to, removing it from nodes no longer listed
+func (s *ReplicaService) SetReplicas(inboundId int, replicas []*model.InboundReplica) error {
+	replicaLock.Lock()
+	defer replicaLock.Unlock()
+
+	old, err := s.GetReplicas(inboundId)
+	if err != nil {
+		return err
+	}
+	oldByNode := map[int]*model.InboundReplica{}
+	for _, replica := range old {
+		oldByNode[replica.NodeId] = replica
+	}
+
+	db := database.GetDB()
+	seen := map[int]bool{}
+	for _, replica := range replicas {
+		if seen[replica.NodeId] {
+			return common.NewError("node listed twice:", replica.NodeId)
+		}
+		seen[replica.NodeId] = true
+		if _, err := s.nodeService.GetNode(replica.NodeId); err != nil {
+			return common.NewError("unknown node:", replica.NodeId)
+		}
+		replica.InboundId = inboundId
+		replica.Id = 0
+		replica.RemoteId = 0
+		if prev, ok := oldByNode[replica.NodeId]; ok {
+			replica.Id = prev.Id
+			replica.RemoteId = prev.RemoteId
+		}
+		err = db.Save(replica).Error
+		if err != nil {
+			return err
+		}
+	}
+	for nodeId, replica := range oldByNode {
+		if !seen[nodeId] {
+			s.removeReplica(replica)
+		}
+	}
+	return s.syncInbound(inboundId)
+}
+
+// removeReplica deletes the inbound from the node, the local record is dropped even if the node is unreachable
+func (s *ReplicaService) removeReplica(replica *model.InboundReplica) {
+	if replica.RemoteId > 0 {
+		node, err := s.nodeService.GetNode(replica.NodeId)
+		if err == nil {
+			err = s.nodeService.DelNodeInbound(node, replica.RemoteId)
+		}
+		if err != nil {
+			logger.Warning("remove replicated inbound from node failed:", replica.NodeId, err)
+		}
+	}
+	db := database.GetDB()
+	db.Delete(model.InboundReplica{}, replica.Id)
+}
+
+// SyncInbound pushes the current state of an inbound to all of its nodes
+func (s *ReplicaService) SyncInbound(inboundId int) error {
+	replicaLock.Lock()
+	defer replicaLock.Unlock()
+	return s.syncInbound(inboundId)
+}
+
+func (s *ReplicaService) syncInbound(inboundId int) error {
+	replicas, err := s.GetReplicas(inboundId)
+	if err != nil || len(replicas) == 0 {
+		return err
+	}
+	inbound, err := s.inboundService.GetInbound(inboundId)
+	if err != nil {
+		return err
+	}
+	db := database.GetDB()
+	errs := make([]error, 0)
+	for _, replica := range replicas {
+		err := s.pushReplica(inbound, replica)
+		replica.LastError = ""
+		if err != nil {
+			replica.LastError = err.Error()
+			errs = append(errs, err)
+		} else {
+			replica.LastSync = time.Now().Unix()
+		}
+		db.Save(replica)
+	}
+	return common.Combine(errs...)
+}
+
+func (s *ReplicaService) pushReplica(inbound *model.Inbound, replica *model.InboundReplica) error {
+	node, err := s.nodeService.GetNode(replica.NodeId)
+	if err != nil {
+		return err
+	}
+	remote := &model.Inbound{
+		Remark:         inbound.Remark,
+		Enable:         inbound.Enable && node.Enable,
+		Total:          inbound.Total,
+		ExpiryTime:     inbound.ExpiryTime,
+		Listen:         inbound.Listen,
+		Port:           inbound.Port,
+		Protocol:       inbound.Protocol,
+		Settings:       inbound.Settings,
+		StreamSettings: inbound.StreamSettings,
+		Sniffing:       inbound.Sniffing,
+	}
+	if replica.Port > 0 {
+		remote.Port = replica.Port
+	}
+	if replica.Listen != "" {
+		remote.Listen = replica.Listen
+	}
+	if replica.RemoteId > 0 {
+		remote.Id = replica.RemoteId
+		_, err = s.nodeService.UpdateNodeInbound(node, remote)
+		return err
+	}
+	remote, err = s.nodeService.AddNodeInbound(node, remote)
+	if err != nil {
+		return err
+	}
+	replica.RemoteId = remote.Id
+	return nil
+}
+
+// DelReplicas removes a deleted inbound from all of its nodes
+func (s *ReplicaService) DelReplicas(inboundId int) error {
+	replicaLock.Lock()
+	defer replicaLock.Unlock()
+	replicas, err := s.GetReplicas(inboundId)
+	if err != nil {
+		return err
+	}
+	for _, replica := range replicas {
+		s.removeReplica(replica)
+	}
+	return nil
+}
+
+// SyncAllReplicas pushes every replicated inbound again, repairing nodes that missed an edit
+func (s *ReplicaService) SyncAllReplicas(ctx context.Context) error {
+	db := database.GetDB().WithContext(ctx)
+	var inboundIds []int
+	err := db.Model(model.InboundReplica{}).Distinct().Pluck("inbound_id", &inboundIds).Error
+	if err != nil {
+		return err
+	}
+	errs := make([]error, 0)
+	for _, inboundId := range inboundIds {
+		err := s.SyncInbound(inboundId)
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return common.Combine(errs...)
+}
@@ -0,0 +1,121 @@
+package service
+
+import (
+	_ "embed"
+	"encoding/json"
+	"strings"
+	"x-ui/util/common"
+	"x-ui/xray"
+)
+
+//go:embed routing_presets.json
+var routingPresetsJson []byte
+
+// RoutingPreset is a named bundle of routing rules, the outbounds it routes to are added unless the
+// template has outbounds with their tags already
+type RoutingPreset struct {
+	Name        string        `json:"name"`
+	Title       string        `json:"title"`
+	Description string        `json:"description"`
+	Rules       []interface{} `json:"rules"`
+	Outbounds   []interface{} `json:"outbounds,omitempty"`
+}
+
+// GetRoutingPresets returns the presets shipped with the panel, each call parses them anew so callers may
+// change what they get
+func GetRoutingPresets() ([]*RoutingPreset, error) {
+	presets := make([]*RoutingPreset, 0)
+	err := json.Unmarshal(routingPresetsJson, &presets)
+	if err != nil {
+		return nil, err
+	}
+	return presets, nil
+}
+
+// checkRoutingPresets rejects names of presets that do not exist
+func checkRoutingPresets(value string) error {
+	presets, err := GetRoutingPresets()
+	if err != nil {
+		return err
+	}
+	for _, name := range strings.Split(value, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		found := false
+		for _, preset := range presets {
+			found = found || preset.Name == name
+		}
+		if !found {
+			return common.NewError("routing preset not found:", name)
+		}
+	}
+	return nil
+}
+
+// addRoutingPresets appends the rules of the enabled presets after the rules of the template, so rules
+// of the template win, and adds the outbounds they need
+func addRoutingPresets(xrayConfig *xray.Config, names []string) error {
+	if len(names) == 0 {
+		return nil
+	}
+	presets, err := GetRoutingPresets()
+	if err != nil {
+		return err
+	}
+
+	outbounds := make([]interface{}, 0)
+	if len(xrayConfig.OutboundConfigs) > 0 {
+		err = json.Unmarshal(xrayConfig.OutboundConfigs, &outbounds)
+		if err != nil {
+			return err
+		}
+	}
+	tags := map[string]bool{}
+	for _, outbound := range outbounds {
+		if o, ok := outbound.(map[string]interface{}); ok {
+			tag, _ := o["tag"].(string)
+			tags[tag] = true
+		}
+	}
+
+	rules := make([]interface{}, 0)
+	for _, name := range names {
+		for _, preset := range presets {
+			if preset.Name != name {
+				continue
+			}
+			rules = append(rules, preset.Rules...)
+			for _, outbound := range preset.Outbounds {
+				o, _ := outbound.(map[string]interface{})
+				tag, _ := o["tag"].(string)
+				if !tags[tag] {
+					tags[tag] = true
+					outbounds = append(outbounds, outbound)
+				}
+			}
+		}
+	}
+
+	routing := map[string]interface{}{}
+	if len(xrayConfig.RouterConfig) > 0 {
+		err := json.Unmarshal(xrayConfig.RouterConfig, &routing)
+		if err != nil {
+			return err
+		}
+	}
+	templateRules, _ := routing["rules"].([]interface{})
+	routing["rules"] = append(templateRules, rules...)
+	routerConfig, err := json.Marshal(routing)
+	if err != nil {
+		return err
+	}
+	outboundConfigs, err := json.Marshal(outbounds)
+	if err != nil {
+		return err
+	}
+	xrayConfig.RouterConfig = routerConfig
+	xrayConfig.OutboundConfigs = outboundConfigs
+	return nil
+}
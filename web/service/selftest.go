@@ -0,0 +1,220 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+	"x-ui/util/common"
+	"x-ui/xray"
+)
+
+// how long the temporary client xray has to start and the request through it has to finish
+const (
+	selfTestStartTimeout   = time.Second * 5
+	selfTestRequestTimeout = time.Second * 15
+)
+
+// SelfTestResult is the outcome of a request through an inbound, Latency is in milliseconds
+type SelfTestResult struct {
+	InboundId int     `json:"inboundId"`
+	Email     string  `json:"email"`
+	Ok        bool    `json:"ok"`
+	Latency   float64 `json:"latency"`
+	Error     string  `json:"error,omitempty"`
+}
+
+// SelfTestService checks inbounds end to end, a temporary xray connects to the inbound as one of its
+// clients and a request is made through it. The client runs the xray binary of the panel rather than
+// xray-core in process, which would build every protocol and transport into the panel as well
+type SelfTestService struct {
+	inboundService InboundServiceImpl
+	xrayService    XrayService
+}
+
+// freeLocalPort returns a tcp port on localhost that nothing listens on right now
+func freeLocalPort() (int, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return 0, err
+	}
+	defer listener.Close()
+	return listener.Addr().(*net.TCPAddr).Port, nil
+}
+
+// selfTestConfig turns the client config of the client into one that dials the inbound on this server,
+// the server names of tls and reality stay as they are
+func selfTestConfig(config map[string]interface{}, address string, socksPort int) error {
+	outbounds, _ := config["outbounds"].([]interface{})
+	if len(outbounds) == 0 {
+		return common.NewError("client config has no outbound")
+	}
+	proxy, ok := outbounds[0].(map[string]interface{})
+	if !ok {
+		return common.NewError("client config has an invalid outbound")
+	}
+	config["inbounds"] = []interface{}{
+		map[string]interface{}{
+			"tag":      "socks",
+			"listen":   "127.0.0.1",
+			"port":     socksPort,
+			"protocol": "socks",
+		},
+	}
+	settings, _ := proxy["settings"].(map[string]interface{})
+	for _, key := range []string{"vnext", "servers"} {
+		servers, _ := settings[key].([]interface{})
+		for _, server := range servers {
+			if s, ok := server.(map[string]interface{}); ok {
+				s["address"] = address
+			}
+		}
+	}
+	// without routing rules everything goes to the first outbound, the proxy
+	config["outbounds"] = outbounds[:1]
+	return nil
+}
+
+// waitForPort waits until something accepts connections on the port or the process exited
+func waitForPort(port int, exited <-chan struct{}) error {
+	deadline := time.Now().Add(selfTestStartTimeout)
+	for time.Now().Before(deadline) {
+		conn, err := net.DialTimeout("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(port)), time.Millisecond*200)
+		if err == nil {
+			conn.Close()
+			return nil
+		}
+		select {
+		case <-exited:
+			return common.NewError("xray exited")
+		case <-time.After(time.Millisecond * 100):
+		}
+	}
+	return common.NewError("xray did not start in time")
+}
+
+// SelfTest connects to the inbound as the client with the email, or as its first client if email is
+// empty, and measures a request through it. A failed test is a result with the error, not an error
+func (s *SelfTestService) SelfTest(inboundId int, email string) (*SelfTestResult, error) {
+	inbound, err := s.inboundService.GetInbound(inboundId)
+	if err != nil {
+		return nil, err
+	}
+	if email == "" {
+		_, clients, err := parseClients(inbound)
+		if err != nil {
+			return nil, err
+		}
+		for _, client := range clients {
+			if c, ok := client.(map[string]interface{}); ok {
+				email, _ = c["email"].(string)
+				break
+			}
+		}
+	}
+	result := &SelfTestResult{InboundId: inboundId, Email: email}
+	if !inbound.Enable {
+		return nil, common.NewError("inbound is disabled:", inbound.Remark)
+	}
+	if !s.xrayService.IsXrayRunning() {
+		return nil, common.NewError("xray is not running")
+	}
+
+	address := "127.0.0.1"
+	if inbound.Listen != "" && inbound.Listen != "0.0.0.0" && inbound.Listen != "::" {
+		address = inbound.Listen
+	}
+	config, err := GenClientConfig(inbound, email, address)
+	if err != nil {
+		return nil, err
+	}
+	socksPort, err := freeLocalPort()
+	if err != nil {
+		return nil, err
+	}
+	err = selfTestConfig(config, address, socksPort)
+	if err != nil {
+		return nil, err
+	}
+	data, err := json.MarshalIndent(config, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.CreateTemp("", "xui-selftest-*.json")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(file.Name())
+	_, err = file.Write(data)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), selfTestStartTimeout+selfTestRequestTimeout)
+	defer cancel()
+	output := &bytes.Buffer{}
+	cmd := exec.CommandContext(ctx, xray.GetBinaryPath(), "-c", file.Name())
+	cmd.Stdout = output
+	cmd.Stderr = output
+	err = cmd.Start()
+	if err != nil {
+		return nil, err
+	}
+	exited := make(chan struct{})
+	go func() {
+		cmd.Wait()
+		close(exited)
+	}()
+	defer func() {
+		cancel()
+		<-exited
+	}()
+
+	err = waitForPort(socksPort, exited)
+	if err != nil {
+		// the output is only complete once xray is gone
+		cancel()
+		<-exited
+		result.Error = fmt.Sprint(err, ": ", lastLines(output.String(), 5))
+		return result, nil
+	}
+	client, err := newSpeedTestClient(fmt.Sprintf("socks5://127.0.0.1:%v", socksPort))
+	if err != nil {
+		return nil, err
+	}
+	client.Timeout = selfTestRequestTimeout
+	start := time.Now()
+	resp, err := client.Get(speedTestServer + "/__down?bytes=0")
+	if err != nil {
+		result.Error = err.Error()
+		return result, nil
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	result.Latency = float64(time.Since(start)) / float64(time.Millisecond)
+	if resp.StatusCode != http.StatusOK {
+		result.Error = "unexpected response: " + resp.Status
+		return result, nil
+	}
+	result.Ok = true
+	return result, nil
+}
+
+func lastLines(text string, n int) string {
+	lines := strings.Split(strings.TrimSpace(text), "\n")
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	return strings.Join(lines, "\n")
+}
@@ -3,13 +3,17 @@ package service
 import (
 	"archive/zip"
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"io/fs"
 	"net/http"
+	"net/netip"
 	"os"
 	"runtime"
+	"strings"
+	"sync"
 	"time"
 	"x-ui/logger"
 	"x-ui/util/sys"
@@ -50,6 +54,7 @@ type Status struct {
 		State    ProcessState `json:"state"`
 		ErrorMsg string       `json:"errorMsg"`
 		Version  string       `json:"version"`
+		Uptime   uint64       `json:"uptime"`
 	} `json:"xray"`
 	Uptime   uint64    `json:"uptime"`
 	Loads    []float64 `json:"loads"`
@@ -63,6 +68,10 @@ type Status struct {
 		Sent uint64 `json:"sent"`
 		Recv uint64 `json:"recv"`
 	} `json:"netTraffic"`
+	PublicIP struct {
+		IPv4 string `json:"ipv4"`
+		IPv6 string `json:"ipv6"`
+	} `json:"publicIP"`
 }
 
 type Release struct {
@@ -70,7 +79,72 @@ type Release struct {
 }
 
 type ServerService struct {
-	xrayService XrayService
+	xrayService    XrayService
+	settingService SettingService
+}
+
+var (
+	publicIPLock        sync.Mutex
+	publicIPOnce        sync.Once
+	publicIPv4          string
+	publicIPv6          string
+	lastGetPublicIPTime time.Time
+	publicIPRefreshing  bool
+)
+
+func getPublicIP(url string) string {
+	client := &http.Client{
+		Timeout: time.Second * 3,
+	}
+	resp, err := client.Get(url)
+	if err != nil {
+		return ""
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 64))
+	if err != nil {
+		return ""
+	}
+	ip, err := netip.ParseAddr(strings.TrimSpace(string(data)))
+	if err != nil {
+		return ""
+	}
+	return ip.String()
+}
+
+func refreshPublicIP() {
+	ipv4 := getPublicIP("https://api4.ipify.org")
+	ipv6 := getPublicIP("https://api6.ipify.org")
+	publicIPLock.Lock()
+	defer publicIPLock.Unlock()
+	publicIPv4 = ipv4
+	publicIPv6 = ipv6
+	lastGetPublicIPTime = time.Now()
+	publicIPRefreshing = false
+}
+
+// GetPublicIP returns the public addresses of this server. Only the first call waits for the lookup, the
+// addresses are looked up again in the background once they are older than 10 minutes
+func (s *ServerService) GetPublicIP() (string, string) {
+	publicIPOnce.Do(refreshPublicIP)
+	publicIPLock.Lock()
+	defer publicIPLock.Unlock()
+	if time.Since(lastGetPublicIPTime) > time.Minute*10 && !publicIPRefreshing {
+		publicIPRefreshing = true
+		go refreshPublicIP()
+	}
+	return publicIPv4, publicIPv6
+}
+
+// GetPreferredPublicIP returns the public address of the family of the preferredAddressFamily setting,
+// the one of the other family if this server has none, e.g. on ipv6 only hosts
+func (s *ServerService) GetPreferredPublicIP() string {
+	ipv4, ipv6 := s.GetPublicIP()
+	family, _ := s.settingService.GetPreferredAddressFamily()
+	if family == "ipv6" && ipv6 != "" || ipv4 == "" {
+		return ipv6
+	}
+	return ipv4
 }
 
 func (s *ServerService) GetStatus(lastStatus *Status) *Status {
@@ -167,6 +241,9 @@ func (s *ServerService) GetStatus(lastStatus *Status) *Status {
 		status.Xray.ErrorMsg = s.xrayService.GetXrayResult()
 	}
 	status.Xray.Version = s.xrayService.GetXrayVersion()
+	status.Xray.Uptime = uint64(s.xrayService.GetXrayUptime().Seconds())
+
+	status.PublicIP.IPv4, status.PublicIP.IPv6 = s.GetPublicIP()
 
 	return status
 }
@@ -198,7 +275,7 @@ func (s *ServerService) GetXrayVersions() ([]string, error) {
 	return versions, nil
 }
 
-func (s *ServerService) downloadXRay(version string) (string, error) {
+func (s *ServerService) downloadXRay(ctx context.Context, version string) (string, error) {
 	osName := runtime.GOOS
 	arch := runtime.GOARCH
 
@@ -216,7 +293,11 @@ func (s *ServerService) downloadXRay(version string) (string, error) {
 
 	fileName := fmt.Sprintf("Xray-%s-%s.zip", osName, arch)
 	url := fmt.Sprintf("https://github.com/XTLS/Xray-core/releases/download/%s/%s", version, fileName)
-	resp, err := http.Get(url)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
 		return "", err
 	}
@@ -231,14 +312,18 @@ func (s *ServerService) downloadXRay(version string) (string, error) {
 
 	_, err = io.Copy(file, resp.Body)
 	if err != nil {
+		file.Close()
+		os.Remove(fileName)
 		return "", err
 	}
 
 	return fileName, nil
 }
 
-func (s *ServerService) UpdateXray(version string) error {
-	zipFileName, err := s.downloadXRay(version)
+// UpdateXray downloads and installs the xray version, cancelling ctx stops the download, xray is
+// left alone until the download is complete
+func (s *ServerService) UpdateXray(ctx context.Context, version string) error {
+	zipFileName, err := s.downloadXRay(ctx, version)
 	if err != nil {
 		return err
 	}
@@ -260,6 +345,9 @@ func (s *ServerService) UpdateXray(version string) error {
 	if err != nil {
 		return err
 	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 
 	s.xrayService.StopXray()
 	defer func() {
@@ -6,6 +6,7 @@ import (
 	"errors"
 	"fmt"
 	"github.com/gin-gonic/gin"
+	"os"
 	"reflect"
 	"strconv"
 	"strings"
@@ -14,29 +15,107 @@ import (
 	"x-ui/database/model"
 	"x-ui/logger"
 	"x-ui/util/common"
+	"x-ui/util/geoip"
 	"x-ui/util/random"
 	"x-ui/util/reflect_util"
+	"x-ui/util/tracing"
 	"x-ui/web/entity"
-	"x-ui/web/global"
+	"x-ui/web/locale"
 	"x-ui/web/session"
+	"x-ui/xray"
+
+	"gorm.io/gorm"
 )
 
 //go:embed config.json
 var xrayTemplateConfig string
 
 var defaultValueMap = map[string]string{
-	"xrayTemplateConfig": xrayTemplateConfig,
-	"webListen":          "",
-	"webPort":            "2053",
-	"webCertFile":        "",
-	"webKeyFile":         "",
-	"secret":             random.Seq(32),
-	"webBasePath":        "/",
-	"timeLocation":       "Asia/Tehran",
-	"tgBotEnable":        "false",
-	"tgBotToken":         "",
-	"tgBotChatId":        "0",
-	"tgRunTime":          "",
+	"xrayTemplateConfig":       xrayTemplateConfig,
+	"webListen":                "",
+	"webPort":                  "2053",
+	"webCertFile":              "",
+	"webKeyFile":               "",
+	"secret":                   random.SecureSeq(32),
+	"webBasePath":              "/",
+	"timeLocation":             "Asia/Tehran",
+	"tgBotEnable":              "false",
+	"tgBotToken":               "",
+	"tgBotChatId":              "0",
+	"tgBotUsers":               "",
+	"tgRunTime":                "",
+	"ipHistoryRetention":       "30",
+	"uniqueClientIds":          "false",
+	"tsdbEnable":               "false",
+	"tsdbUrl":                  "",
+	"tsdbToken":                "",
+	"tsdbInterval":             "60",
+	"agentToken":               "",
+	"acmeAccountKey":           "",
+	"loginRateLimit":           "10",
+	"apiRateLimit":             "300",
+	"subRateLimit":             "60",
+	"subSkipOfflineNodes":      "true",
+	"trustedProxies":           "127.0.0.1,::1",
+	"paymentSecret":            "",
+	"trialEnable":              "false",
+	"trialInboundId":           "0",
+	"trialTraffic":             "1",
+	"trialHours":               "24",
+	"trialCooldownDays":        "30",
+	"trialApproval":            "false",
+	"logFormat":                "text",
+	"logFile":                  "",
+	"logMaxSize":               "10",
+	"logMaxFiles":              "5",
+	"logMaxAge":                "30",
+	"logShipping":              "",
+	"logSyslogFacility":        "daemon",
+	"logSyslogTag":             "x-ui",
+	"logLevelWeb":              "",
+	"logLevelXray":             "",
+	"logLevelTgbot":            "",
+	"logLevelJob":              "",
+	"jobSchedules":             "{}",
+	"geoipCountryDb":           "",
+	"geoipAsnDb":               "",
+	"language":                 "en-US",
+	"smtpHost":                 "",
+	"smtpPort":                 "587",
+	"smtpUsername":             "",
+	"smtpPassword":             "",
+	"smtpFrom":                 "",
+	"smtpTo":                   "",
+	"smtpLoginNotify":          "false",
+	"webCertificateId":         "0",
+	"acmeEmail":                "",
+	"acmeDirectory":            "https://acme-v02.api.letsencrypt.org/directory",
+	"acmeDnsProvider":          "",
+	"acmeDnsCredentials":       "",
+	"firewallDriver":           "",
+	"firewallDryRun":           "false",
+	"preferredAddressFamily":   "ipv4",
+	"eventScripts":             "{}",
+	"redisUrl":                 "",
+	"haLock":                   "",
+	"routingPresets":           "",
+	"geoipUrl":                 "",
+	"geositeUrl":               "",
+	"geoSigningKey":            "",
+	"torEnable":                "false",
+	"torManaged":               "false",
+	"torAddress":               "127.0.0.1:9050",
+	"torDomains":               "domain:onion",
+	"reachabilityChecker":      "",
+	"reachabilityCheckerToken": "",
+	"latencyProbeUrls":         "",
+	"latencyBalancers":         "false",
+	"tracingEndpoint":          "",
+	"tracingHeaders":           "",
+	"debugEnable":              "false",
+	"jwtSessions":              "false",
+	"jwtAccessMinutes":         "15",
+	"jwtRefreshDays":           "7",
 }
 
 type SettingService struct {
@@ -50,54 +129,9 @@ func (s *SettingService) GetAllSetting() (*entity.AllSetting, error) {
 		return nil, err
 	}
 	allSetting := &entity.AllSetting{}
-	t := reflect.TypeOf(allSetting).Elem()
-	v := reflect.ValueOf(allSetting).Elem()
-	fields := reflect_util.GetFields(t)
-
-	setSetting := func(key, value string) (err error) {
-		defer func() {
-			panicErr := recover()
-			if panicErr != nil {
-				err = errors.New(fmt.Sprint(panicErr))
-			}
-		}()
-
-		var found bool
-		var field reflect.StructField
-		for _, f := range fields {
-			if f.Tag.Get("json") == key {
-				field = f
-				found = true
-				break
-			}
-		}
-
-		if !found {
-			// Some settings are automatically generated, no need to return to the front end to modify the user
-			return nil
-		}
-
-		fieldV := v.FieldByName(field.Name)
-		switch t := fieldV.Interface().(type) {
-		case int:
-			n, err := strconv.ParseInt(value, 10, 64)
-			if err != nil {
-				return err
-			}
-			fieldV.SetInt(n)
-		case string:
-			fieldV.SetString(value)
-		case bool:
-			fieldV.SetBool(value == "true")
-		default:
-			return common.NewErrorf("unknown field %v type %v", key, t)
-		}
-		return
-	}
-
 	keyMap := map[string]bool{}
 	for _, setting := range settings {
-		err := setSetting(setting.Key, setting.Value)
+		err := setAllSettingField(allSetting, setting.Key, setting.Value)
 		if err != nil {
 			return nil, err
 		}
@@ -108,7 +142,7 @@ func (s *SettingService) GetAllSetting() (*entity.AllSetting, error) {
 		if keyMap[key] {
 			continue
 		}
-		err := setSetting(key, value)
+		err := setAllSettingField(allSetting, key, value)
 		if err != nil {
 			return nil, err
 		}
@@ -117,6 +151,50 @@ func (s *SettingService) GetAllSetting() (*entity.AllSetting, error) {
 	return allSetting, nil
 }
 
+// setAllSettingField sets the field of the setting with the key from its saved value
+func setAllSettingField(allSetting *entity.AllSetting, key string, value string) (err error) {
+	defer func() {
+		panicErr := recover()
+		if panicErr != nil {
+			err = errors.New(fmt.Sprint(panicErr))
+		}
+	}()
+
+	t := reflect.TypeOf(allSetting).Elem()
+	v := reflect.ValueOf(allSetting).Elem()
+	var found bool
+	var field reflect.StructField
+	for _, f := range reflect_util.GetFields(t) {
+		if f.Tag.Get("json") == key {
+			field = f
+			found = true
+			break
+		}
+	}
+
+	if !found {
+		// Some settings are automatically generated, no need to return to the front end to modify the user
+		return nil
+	}
+
+	fieldV := v.FieldByName(field.Name)
+	switch t := fieldV.Interface().(type) {
+	case int:
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return err
+		}
+		fieldV.SetInt(n)
+	case string:
+		fieldV.SetString(value)
+	case bool:
+		fieldV.SetBool(value == "true")
+	default:
+		return common.NewErrorf("unknown field %v type %v", key, t)
+	}
+	return
+}
+
 func (s *SettingService) ResetSettings() error {
 	db := database.GetDB()
 	return db.Where("1 = 1").Delete(model.Setting{}).Error
@@ -133,10 +211,14 @@ func (s *SettingService) getSetting(key string) (*model.Setting, error) {
 }
 
 func (s *SettingService) saveSetting(key string, value string) error {
-	setting, err := s.getSetting(key)
-	db := database.GetDB()
+	return s.saveSettingTx(database.GetDB(), key, value)
+}
+
+func (s *SettingService) saveSettingTx(tx *gorm.DB, key string, value string) error {
+	setting := &model.Setting{}
+	err := tx.Model(model.Setting{}).Where("key = ?", key).First(setting).Error
 	if database.IsNotFound(err) {
-		return db.Create(&model.Setting{
+		return tx.Create(&model.Setting{
 			Key:   key,
 			Value: value,
 		}).Error
@@ -145,7 +227,15 @@ func (s *SettingService) saveSetting(key string, value string) error {
 	}
 	setting.Key = key
 	setting.Value = value
-	return db.Save(setting).Error
+	return tx.Save(setting).Error
+}
+
+// SetSetting saves a setting by its key, for settings that have no setter of their own
+func (s *SettingService) SetSetting(key string, value string) error {
+	if _, ok := defaultValueMap[key]; !ok {
+		return common.NewError("unknown setting:", key)
+	}
+	return s.saveSetting(key, value)
 }
 
 func (s *SettingService) getString(key string) (string, error) {
@@ -214,6 +304,11 @@ func (s *SettingService) SetTgBotChatId(chatId int) error {
 	return s.setInt("tgBotChatId", chatId)
 }
 
+// GetTgBotUsers returns the allowlist of telegram users and the commands each may use, see botauth.Parse
+func (s *SettingService) GetTgBotUsers() (string, error) {
+	return s.getString("tgBotUsers")
+}
+
 func (s *SettingService) SetTgbotenabled(value bool) error {
 	return s.setBool("tgBotEnable", value)
 }
@@ -230,6 +325,442 @@ func (s *SettingService) GetTgbotRuntime() (string, error) {
 	return s.getString("tgRunTime")
 }
 
+func (s *SettingService) GetIpHistoryRetention() (int, error) {
+	return s.getInt("ipHistoryRetention")
+}
+
+// GetUniqueClientIds reports whether a uuid or password may only be used by one client of all inbounds
+func (s *SettingService) GetUniqueClientIds() (bool, error) {
+	return s.getBool("uniqueClientIds")
+}
+
+func (s *SettingService) GetTsdbEnable() (bool, error) {
+	return s.getBool("tsdbEnable")
+}
+
+func (s *SettingService) GetTsdbUrl() (string, error) {
+	return s.getString("tsdbUrl")
+}
+
+func (s *SettingService) GetTsdbToken() (string, error) {
+	return s.getString("tsdbToken")
+}
+
+func (s *SettingService) GetTsdbInterval() (int, error) {
+	return s.getInt("tsdbInterval")
+}
+
+func (s *SettingService) GetAgentToken() (string, error) {
+	return s.getString("agentToken")
+}
+
+func (s *SettingService) SetAgentToken(token string) error {
+	return s.setString("agentToken", token)
+}
+
+// GetAcmeAccountKey returns the PEM key of the ACME account, made on the first issuance
+func (s *SettingService) GetAcmeAccountKey() (string, error) {
+	return s.getString("acmeAccountKey")
+}
+
+func (s *SettingService) SetAcmeAccountKey(key string) error {
+	return s.setString("acmeAccountKey", key)
+}
+
+func (s *SettingService) GetLoginRateLimit() (int, error) {
+	return s.getInt("loginRateLimit")
+}
+
+func (s *SettingService) GetApiRateLimit() (int, error) {
+	return s.getInt("apiRateLimit")
+}
+
+func (s *SettingService) GetSubRateLimit() (int, error) {
+	return s.getInt("subRateLimit")
+}
+
+// GetSubSkipOfflineNodes reports whether subscriptions leave out the replicas on nodes the health check found down
+func (s *SettingService) GetSubSkipOfflineNodes() (bool, error) {
+	return s.getBool("subSkipOfflineNodes")
+}
+
+// GetTrustedProxies returns the addresses and cidrs of the reverse proxies whose X-Forwarded-For is believed
+func (s *SettingService) GetTrustedProxies() ([]string, error) {
+	value, err := s.getString("trustedProxies")
+	if err != nil {
+		return nil, err
+	}
+	proxies := make([]string, 0)
+	for _, proxy := range strings.Split(value, ",") {
+		if proxy = strings.TrimSpace(proxy); proxy != "" {
+			proxies = append(proxies, proxy)
+		}
+	}
+	return proxies, nil
+}
+
+func (s *SettingService) GetPaymentSecret() (string, error) {
+	return s.getString("paymentSecret")
+}
+
+func (s *SettingService) GetTrialEnable() (bool, error) {
+	return s.getBool("trialEnable")
+}
+
+func (s *SettingService) GetTrialInboundId() (int, error) {
+	return s.getInt("trialInboundId")
+}
+
+// GetTrialTraffic returns the traffic of a trial client in GB
+func (s *SettingService) GetTrialTraffic() (int, error) {
+	return s.getInt("trialTraffic")
+}
+
+func (s *SettingService) GetTrialHours() (int, error) {
+	return s.getInt("trialHours")
+}
+
+func (s *SettingService) GetTrialCooldownDays() (int, error) {
+	return s.getInt("trialCooldownDays")
+}
+
+// GetTrialApproval tells whether trials wait for an admin to approve them in telegram
+func (s *SettingService) GetTrialApproval() (bool, error) {
+	return s.getBool("trialApproval")
+}
+
+func (s *SettingService) GetLogFormat() (string, error) {
+	return s.getString("logFormat")
+}
+
+func (s *SettingService) GetLogFile() (string, error) {
+	return s.getString("logFile")
+}
+
+// GetLogMaxSize returns the size in MB at which panel and xray logs are rotated
+func (s *SettingService) GetLogMaxSize() (int, error) {
+	return s.getInt("logMaxSize")
+}
+
+func (s *SettingService) GetLogMaxFiles() (int, error) {
+	return s.getInt("logMaxFiles")
+}
+
+// GetLogMaxAge returns the days rotated logs are kept, 0 keeps them until logMaxFiles is exceeded
+func (s *SettingService) GetLogMaxAge() (int, error) {
+	return s.getInt("logMaxAge")
+}
+
+func (s *SettingService) GetLogShipping() (string, error) {
+	return s.getString("logShipping")
+}
+
+func (s *SettingService) GetLogSyslogFacility() (string, error) {
+	return s.getString("logSyslogFacility")
+}
+
+func (s *SettingService) GetLogSyslogTag() (string, error) {
+	return s.getString("logSyslogTag")
+}
+
+func (s *SettingService) GetLogLevelWeb() (string, error) {
+	return s.getString("logLevelWeb")
+}
+
+func (s *SettingService) GetLogLevelXray() (string, error) {
+	return s.getString("logLevelXray")
+}
+
+func (s *SettingService) GetLogLevelTgbot() (string, error) {
+	return s.getString("logLevelTgbot")
+}
+
+func (s *SettingService) GetLogLevelJob() (string, error) {
+	return s.getString("logLevelJob")
+}
+
+// defaultJobSchedules are the cron specs the background jobs run on unless jobSchedules overrides them by name
+var defaultJobSchedules = map[string]string{
+	"checkXrayRunning":    "@every 30s",
+	"xrayTraffic":         "@every 10s",
+	"flushTraffic":        "@every 30s",
+	"accessLog":           "@every 10s",
+	"alert":               "@every 30s",
+	"logRotate":           "@every 5m",
+	"pruneIpHistory":      "@daily",
+	"pruneTrafficHistory": "@daily",
+	"replicaSync":         "@every 5m",
+	"nodeTraffic":         "@every 1m",
+	"nodeHealth":          "@every 30s",
+	"checkInbound":        "@every 30s",
+	"connLimit":           "@every 10s",
+	"clientSchedule":      "@every 1m",
+	"portHopping":         "@every 30s",
+	"firewall":            "@every 5m",
+	"certRenew":           "@daily",
+	"billingReset":        "@daily",
+	"realityCheck":        "@every 30m",
+	"geoUpdate":           "@weekly",
+	"torCheck":            "@every 1m",
+	"reachability":        "@every 30m",
+	"outboundLatency":     "@every 5m",
+}
+
+func (s *SettingService) GetJobSchedules() (map[string]string, error) {
+	value, err := s.getString("jobSchedules")
+	if err != nil {
+		return nil, err
+	}
+	schedules := map[string]string{}
+	err = json.Unmarshal([]byte(value), &schedules)
+	if err != nil {
+		return nil, err
+	}
+	return schedules, nil
+}
+
+// GetJobSchedule returns the cron spec of the named job, the default if jobSchedules does not set one
+func (s *SettingService) GetJobSchedule(name string) string {
+	schedules, err := s.GetJobSchedules()
+	if err != nil {
+		logger.Warning("get job schedules failed:", err)
+	} else if spec, ok := schedules[name]; ok && spec != "" {
+		return spec
+	}
+	return defaultJobSchedules[name]
+}
+
+func (s *SettingService) GetGeoipCountryDb() (string, error) {
+	return s.getString("geoipCountryDb")
+}
+
+func (s *SettingService) GetGeoipAsnDb() (string, error) {
+	return s.getString("geoipAsnDb")
+}
+
+func (s *SettingService) GetLanguage() (string, error) {
+	return s.getString("language")
+}
+
+func (s *SettingService) GetSmtpHost() (string, error) {
+	return s.getString("smtpHost")
+}
+
+func (s *SettingService) GetSmtpPort() (int, error) {
+	return s.getInt("smtpPort")
+}
+
+func (s *SettingService) GetSmtpUsername() (string, error) {
+	return s.getString("smtpUsername")
+}
+
+func (s *SettingService) GetSmtpPassword() (string, error) {
+	return s.getString("smtpPassword")
+}
+
+func (s *SettingService) GetSmtpFrom() (string, error) {
+	return s.getString("smtpFrom")
+}
+
+func (s *SettingService) GetSmtpTo() (string, error) {
+	return s.getString("smtpTo")
+}
+
+func (s *SettingService) GetSmtpLoginNotify() (bool, error) {
+	return s.getBool("smtpLoginNotify")
+}
+
+// GetWebCertificateId returns the stored certificate the panel serves https with, it takes the place of the cert and key files, 0 for none
+func (s *SettingService) GetWebCertificateId() (int, error) {
+	return s.getInt("webCertificateId")
+}
+
+// GetAcmeEmail returns the contact address of the ACME account certificates are issued with
+func (s *SettingService) GetAcmeEmail() (string, error) {
+	return s.getString("acmeEmail")
+}
+
+func (s *SettingService) GetAcmeDirectory() (string, error) {
+	return s.getString("acmeDirectory")
+}
+
+func (s *SettingService) GetAcmeDnsProvider() (string, error) {
+	return s.getString("acmeDnsProvider")
+}
+
+// GetAcmeDnsCredentials returns the json object of the api credentials of the dns provider
+func (s *SettingService) GetAcmeDnsCredentials() (string, error) {
+	return s.getString("acmeDnsCredentials")
+}
+
+func (s *SettingService) GetFirewallDriver() (string, error) {
+	return s.getString("firewallDriver")
+}
+
+func (s *SettingService) GetFirewallDryRun() (bool, error) {
+	return s.getBool("firewallDryRun")
+}
+
+func (s *SettingService) GetPreferredAddressFamily() (string, error) {
+	return s.getString("preferredAddressFamily")
+}
+
+// GetEventScripts returns the shell commands to run by event name
+func (s *SettingService) GetEventScripts() (map[string]string, error) {
+	value, err := s.getString("eventScripts")
+	if err != nil {
+		return nil, err
+	}
+	scripts := map[string]string{}
+	err = json.Unmarshal([]byte(value), &scripts)
+	if err != nil {
+		return nil, err
+	}
+	return scripts, nil
+}
+
+// GetRedisUrl is the redis panel instances coordinate through, empty runs alone
+func (s *SettingService) GetRedisUrl() (string, error) {
+	return s.getString("redisUrl")
+}
+
+// GetHaLock is redis or the path of a lock file the active panel instance holds, empty runs without a standby
+func (s *SettingService) GetHaLock() (string, error) {
+	return s.getString("haLock")
+}
+
+// GetRoutingPresets returns the names of the enabled routing presets, in the order of their rules
+func (s *SettingService) GetRoutingPresets() ([]string, error) {
+	value, err := s.getString("routingPresets")
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0)
+	for _, name := range strings.Split(value, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names, nil
+}
+
+// GetGeoipUrl is where geoip.dat is updated from, empty keeps the file that came with xray
+func (s *SettingService) GetGeoipUrl() (string, error) {
+	return s.getString("geoipUrl")
+}
+
+// GetGeositeUrl is where geosite.dat is updated from, empty keeps the file that came with xray
+func (s *SettingService) GetGeositeUrl() (string, error) {
+	return s.getString("geositeUrl")
+}
+
+// GetGeoSigningKey is the base64 ed25519 public key the geo files must be signed with, empty only checks their checksums
+func (s *SettingService) GetGeoSigningKey() (string, error) {
+	return s.getString("geoSigningKey")
+}
+
+// GetTorEnable tells whether xray gets a tor outbound and sends the tor domains through it
+func (s *SettingService) GetTorEnable() (bool, error) {
+	return s.getBool("torEnable")
+}
+
+// GetTorManaged tells whether the panel installs the tor daemon and restarts it when it stops answering
+func (s *SettingService) GetTorManaged() (bool, error) {
+	return s.getBool("torManaged")
+}
+
+// GetTorAddress is the socks address of the tor daemon
+func (s *SettingService) GetTorAddress() (string, error) {
+	return s.getString("torAddress")
+}
+
+// GetTorDomains returns the domains sent through tor, in the format of xray routing rules
+func (s *SettingService) GetTorDomains() ([]string, error) {
+	value, err := s.getString("torDomains")
+	if err != nil {
+		return nil, err
+	}
+	domains := make([]string, 0)
+	for _, domain := range strings.Split(value, ",") {
+		if domain = strings.TrimSpace(domain); domain != "" {
+			domains = append(domains, domain)
+		}
+	}
+	return domains, nil
+}
+
+// GetReachabilityChecker is the node name or the url of another panel that checks from outside whether the inbound ports are reachable, empty turns the check off
+func (s *SettingService) GetReachabilityChecker() (string, error) {
+	return s.getString("reachabilityChecker")
+}
+
+// GetReachabilityCheckerToken is the agent token of the panel at the reachability checker url
+func (s *SettingService) GetReachabilityCheckerToken() (string, error) {
+	return s.getString("reachabilityCheckerToken")
+}
+
+// GetLatencyProbeUrls returns the urls requested through every outbound to measure its latency, none turns the probes off
+func (s *SettingService) GetLatencyProbeUrls() ([]string, error) {
+	value, err := s.getString("latencyProbeUrls")
+	if err != nil {
+		return nil, err
+	}
+	urls := make([]string, 0)
+	for _, u := range strings.Split(value, ",") {
+		if u = strings.TrimSpace(u); u != "" {
+			urls = append(urls, u)
+		}
+	}
+	return urls, nil
+}
+
+// GetLatencyBalancers tells whether balancers of the xray template use the outbound with the lowest latency
+func (s *SettingService) GetLatencyBalancers() (bool, error) {
+	return s.getBool("latencyBalancers")
+}
+
+// GetTracingEndpoint is the OTLP http endpoint spans are sent to, like http://collector:4318/v1/traces, empty turns tracing off
+func (s *SettingService) GetTracingEndpoint() (string, error) {
+	return s.getString("tracingEndpoint")
+}
+
+// GetTracingHeaders returns the headers sent with the spans, e.g. the api key of the collector. The
+// setting has name=value pairs separated by commas
+func (s *SettingService) GetTracingHeaders() (map[string]string, error) {
+	value, err := s.getString("tracingHeaders")
+	if err != nil {
+		return nil, err
+	}
+	headers := map[string]string{}
+	for _, pair := range strings.Split(value, ",") {
+		name, value, ok := strings.Cut(pair, "=")
+		if name = strings.TrimSpace(name); ok && name != "" {
+			headers[name] = strings.TrimSpace(value)
+		}
+	}
+	return headers, nil
+}
+
+// GetDebugEnable tells whether the pprof profiles and runtime stats are served under /debug to admins
+func (s *SettingService) GetDebugEnable() (bool, error) {
+	return s.getBool("debugEnable")
+}
+
+// GetJwtSessions tells whether logins are kept in signed tokens instead of the cookie session, so replicas and restarts keep them
+func (s *SettingService) GetJwtSessions() (bool, error) {
+	return s.getBool("jwtSessions")
+}
+
+// GetJwtAccessMinutes is how long an access token is valid before it is renewed with the refresh token
+func (s *SettingService) GetJwtAccessMinutes() (int, error) {
+	return s.getInt("jwtAccessMinutes")
+}
+
+// GetJwtRefreshDays is how long a login lasts without a visit to the panel
+func (s *SettingService) GetJwtRefreshDays() (int, error) {
+	return s.getInt("jwtRefreshDays")
+}
+
 func (s *SettingService) GetPort() (int, error) {
 	return s.getInt("webPort")
 }
@@ -271,6 +802,10 @@ func (s *SettingService) GetBasePath() (string, error) {
 	return basePath, nil
 }
 
+func (s *SettingService) SetBasePath(basePath string) error {
+	return s.setString("webBasePath", basePath)
+}
+
 func (s *SettingService) GetTimeLocation() (*time.Location, error) {
 	l, err := s.getString("timeLocation")
 	if err != nil {
@@ -285,10 +820,77 @@ func (s *SettingService) GetTimeLocation() (*time.Location, error) {
 	return location, nil
 }
 
-func (s *SettingService) UpdateAllSetting(c *gin.Context, allSetting *entity.AllSetting) error {
+// checkAllSetting runs the checks of the settings that need more than the fields themselves
+func checkAllSetting(allSetting *entity.AllSetting) error {
 	if err := allSetting.CheckValid(); err != nil {
 		return err
 	}
+	if err := checkJobSchedules(allSetting.JobSchedules); err != nil {
+		return err
+	}
+	if err := checkEventScripts(allSetting.EventScripts); err != nil {
+		return err
+	}
+	if err := checkRoutingPresets(allSetting.RoutingPresets); err != nil {
+		return err
+	}
+	return checkWebCertificate(allSetting.WebCertificateId)
+}
+
+// ApplyBootstrap writes the first user and the settings of a bootstrap config to a new database. All of
+// them are checked before anything is written and written in one transaction, so a config with a
+// mistake leaves the defaults instead of part of it
+func (s *SettingService) ApplyBootstrap(username string, password string, settings map[string]string) error {
+	allSetting, err := s.GetAllSetting()
+	if err != nil {
+		return err
+	}
+	for key, value := range settings {
+		if _, ok := defaultValueMap[key]; !ok {
+			return common.NewError("unknown setting:", key)
+		}
+		err = setAllSettingField(allSetting, key, value)
+		if err != nil {
+			return common.NewErrorf("setting %v: %v", key, err)
+		}
+	}
+	err = checkAllSetting(allSetting)
+	if err != nil {
+		return err
+	}
+	hasUser := username != "" || password != ""
+	if hasUser && (username == "" || password == "") {
+		return common.NewError("the bootstrap user needs a username and a password")
+	}
+
+	db := database.GetDB()
+	return db.Transaction(func(tx *gorm.DB) error {
+		if hasUser {
+			userService := UserService{}
+			err := userService.updateFirstUser(tx, username, password)
+			if err != nil {
+				return err
+			}
+		}
+		for key, value := range settings {
+			err := s.saveSettingTx(tx, key, value)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s *SettingService) UpdateAllSetting(c *gin.Context, allSetting *entity.AllSetting) error {
+	if err := checkAllSetting(allSetting); err != nil {
+		return err
+	}
+
+	// a request that was cancelled or a panel shutting down saves nothing rather than part of the settings
+	if err := c.Request.Context().Err(); err != nil {
+		return err
+	}
 
 	v := reflect.ValueOf(allSetting).Elem()
 	t := reflect.TypeOf(allSetting).Elem()
@@ -309,9 +911,99 @@ func (s *SettingService) UpdateAllSetting(c *gin.Context, allSetting *entity.All
 			errs = append(errs, err)
 		}
 	}
+	if len(errs) == 0 {
+		errs = append(errs, s.ApplyLogLevels(), s.ApplyTracing(), s.LoadGeoip())
+		locale.SetLanguage(allSetting.Language)
+	}
 	return common.Combine(errs...)
 }
 
+// checkWebCertificate rejects a panel certificate that is not stored, the panel would not start with it
+func checkWebCertificate(id int) error {
+	if id == 0 {
+		return nil
+	}
+	db := database.GetDB()
+	var count int64
+	err := db.Model(model.Certificate{}).Where("id = ?", id).Count(&count).Error
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return common.NewError("certificate not found:", id)
+	}
+	return nil
+}
+
+// checkJobSchedules rejects schedules of jobs that do not exist, CheckValid already parsed the specs
+func checkJobSchedules(value string) error {
+	schedules := map[string]string{}
+	err := json.Unmarshal([]byte(value), &schedules)
+	if err != nil {
+		return err
+	}
+	for name := range schedules {
+		if _, ok := defaultJobSchedules[name]; !ok && name != "tsdbExport" {
+			return common.NewError("unknown job in schedules:", name)
+		}
+	}
+	return nil
+}
+
+// ApplyLogLevels sets the saved level of each log module, it takes effect without a restart
+func (s *SettingService) ApplyLogLevels() error {
+	levels := map[string]string{
+		"logLevelWeb":   "web",
+		"logLevelXray":  "xray",
+		"logLevelTgbot": "tgbot",
+		"logLevelJob":   "job",
+	}
+	for key, module := range levels {
+		level, err := s.getString(key)
+		if err != nil {
+			return err
+		}
+		err = logger.SetModuleLevel(module, level)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ApplyTracing sends spans to the saved OTLP endpoint from now on, or stops tracing without one
+func (s *SettingService) ApplyTracing() error {
+	endpoint, err := s.GetTracingEndpoint()
+	if err != nil {
+		return err
+	}
+	headers, err := s.GetTracingHeaders()
+	if err != nil {
+		return err
+	}
+	tracing.Configure(endpoint, headers, "x-ui")
+	return nil
+}
+
+// LoadGeoip opens the configured GeoIP databases, without a country database the geoip.dat of xray is used
+func (s *SettingService) LoadGeoip() error {
+	countryDb, err := s.GetGeoipCountryDb()
+	if err != nil {
+		return err
+	}
+	asnDb, err := s.GetGeoipAsnDb()
+	if err != nil {
+		return err
+	}
+	if countryDb == "" {
+		countryDb = xray.GetGeoipPath()
+		if _, err := os.Stat(countryDb); err != nil {
+			countryDb = ""
+		}
+	}
+	return geoip.Load(countryDb, asnDb)
+}
+
 func (s *SettingService) handleInboundsFromConfig(c *gin.Context, value string) error {
 	// update inbounds :)
 	// get inbounds from value
@@ -382,11 +1074,19 @@ func (s *SettingService) handleInboundsFromConfig(c *gin.Context, value string)
 		inbounds = append(inbounds, &inboundStruct)
 	}
 
-	if err := global.GetInbounds().AddInbounds(inbounds); err != nil {
+	if len(inbounds) == 0 {
+		return nil
+	}
+	inboundService := InboundServiceImpl{}
+	if err := inboundService.AddInbounds(inbounds); err != nil {
 		if !strings.Contains(strings.ToLower(err.Error()), "port") {
 			return err
 		}
+		return nil
 	}
 
+	// one restart for the whole batch, picked up by the restart check of the inbound controller
+	xrayService := XrayService{}
+	xrayService.SetToNeedRestart()
 	return nil
 }
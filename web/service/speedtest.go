@@ -0,0 +1,170 @@
+package service
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+	"x-ui/database"
+	"x-ui/database/model"
+	"x-ui/util/common"
+)
+
+const (
+	speedTestServer       = "https://speed.cloudflare.com"
+	speedTestDownloadSize = 25 * 1000 * 1000
+	speedTestUploadSize   = 10 * 1000 * 1000
+)
+
+var speedTestLock sync.Mutex
+
+type SpeedTestService struct {
+}
+
+// zeroReader produces n zero bytes, used as upload payload without allocating it
+type zeroReader struct {
+	n int64
+}
+
+func (r *zeroReader) Read(p []byte) (int, error) {
+	if r.n <= 0 {
+		return 0, io.EOF
+	}
+	if int64(len(p)) > r.n {
+		p = p[:r.n]
+	}
+	for i := range p {
+		p[i] = 0
+	}
+	r.n -= int64(len(p))
+	return len(p), nil
+}
+
+func newSpeedTestClient(proxy string) (*http.Client, error) {
+	transport := &http.Transport{}
+	if proxy != "" {
+		proxyUrl, err := url.Parse(proxy)
+		if err != nil {
+			return nil, err
+		}
+		switch proxyUrl.Scheme {
+		case "http", "https", "socks5":
+		default:
+			return nil, common.NewError("unsupported proxy scheme:", proxyUrl.Scheme)
+		}
+		transport.Proxy = http.ProxyURL(proxyUrl)
+	}
+	return &http.Client{
+		Transport: transport,
+		Timeout:   time.Minute,
+	}, nil
+}
+
+func measureLatency(client *http.Client) (float64, error) {
+	best := time.Duration(0)
+	for i := 0; i < 3; i++ {
+		start := time.Now()
+		resp, err := client.Get(speedTestServer + "/__down?bytes=0")
+		if err != nil {
+			return 0, err
+		}
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		elapsed := time.Since(start)
+		if best == 0 || elapsed < best {
+			best = elapsed
+		}
+	}
+	return float64(best) / float64(time.Millisecond), nil
+}
+
+func measureDownload(client *http.Client) (float64, error) {
+	start := time.Now()
+	resp, err := client.Get(fmt.Sprintf("%s/__down?bytes=%d", speedTestServer, speedTestDownloadSize))
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	n, err := io.Copy(io.Discard, resp.Body)
+	if err != nil {
+		return 0, err
+	}
+	return float64(n*8) / time.Since(start).Seconds(), nil
+}
+
+func measureUpload(client *http.Client) (float64, error) {
+	start := time.Now()
+	req, err := http.NewRequest(http.MethodPost, speedTestServer+"/__up", &zeroReader{n: speedTestUploadSize})
+	if err != nil {
+		return 0, err
+	}
+	req.ContentLength = speedTestUploadSize
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	return float64(speedTestUploadSize*8) / time.Since(start).Seconds(), nil
+}
+
+// RunSpeedTest measures latency and throughput to the test server, through the outbound with the tag if it
+// is not empty, through proxy otherwise if that is not empty. Outbounds are reached through their probe inbounds
+func (s *SpeedTestService) RunSpeedTest(proxy string, outbound string) (*model.SpeedTestResult, error) {
+	if !speedTestLock.TryLock() {
+		return nil, common.NewError("a speed test is already running")
+	}
+	defer speedTestLock.Unlock()
+
+	proxy = strings.TrimSpace(proxy)
+	outbound = strings.TrimSpace(outbound)
+	clientProxy := proxy
+	if outbound != "" {
+		var err error
+		clientProxy, err = outboundProxy(outbound)
+		if err != nil {
+			return nil, err
+		}
+		proxy = ""
+	}
+	client, err := newSpeedTestClient(clientProxy)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &model.SpeedTestResult{
+		Time:     time.Now().Unix(),
+		Proxy:    proxy,
+		Outbound: outbound,
+	}
+	result.Latency, err = measureLatency(client)
+	if err == nil {
+		result.Download, err = measureDownload(client)
+	}
+	if err == nil {
+		result.Upload, err = measureUpload(client)
+	}
+	if err != nil {
+		result.Error = err.Error()
+	}
+
+	db := database.GetDB()
+	saveErr := db.Create(result).Error
+	if err != nil {
+		return result, err
+	}
+	return result, saveErr
+}
+
+func (s *SpeedTestService) GetSpeedTestResults(limit int) ([]*model.SpeedTestResult, error) {
+	db := database.GetDB()
+	var results []*model.SpeedTestResult
+	err := db.Model(model.SpeedTestResult{}).Order("time desc").Limit(limit).Find(&results).Error
+	if err != nil {
+		return nil, err
+	}
+	return results, nil
+}
@@ -0,0 +1,133 @@
+package service
+
+import (
+	"encoding/json"
+	"strings"
+	"x-ui/database/model"
+	"x-ui/util/common"
+)
+
+// streamNumber returns a json number of the stream settings, ok is false if it is there but not a number
+func streamNumber(stream map[string]interface{}, keys ...string) (float64, bool) {
+	switch value := streamValue(stream, keys...).(type) {
+	case nil:
+		return 0, true
+	case float64:
+		return value, true
+	}
+	return 0, false
+}
+
+// checkStreamSettings checks the transport settings of an inbound that xray would only refuse when it starts
+func checkStreamSettings(inbound *model.Inbound) error {
+	if inbound.StreamSettings == "" {
+		return nil
+	}
+	stream := map[string]interface{}{}
+	err := json.Unmarshal([]byte(inbound.StreamSettings), &stream)
+	if err != nil {
+		return common.NewError("stream settings are not valid json:", err)
+	}
+	switch streamString(stream, "network") {
+	case "kcp":
+		return checkKcpSettings(stream)
+	case "grpc":
+		return checkGrpcSettings(stream)
+	case "httpupgrade":
+		return checkHttpPath("httpupgrade", streamString(stream, "httpupgradeSettings", "path"))
+	case "xhttp":
+		return checkXHttpSettings(stream)
+	}
+	return nil
+}
+
+// checkKcpSettings checks the mkcp settings against the ranges xray accepts, the seed obfuscates
+// the packets and is optional
+func checkKcpSettings(stream map[string]interface{}) error {
+	switch header := streamString(stream, "kcpSettings", "header", "type"); header {
+	case "", "none", "srtp", "utp", "wechat-video", "dtls", "wireguard":
+	default:
+		return common.NewError("unknown mkcp header type:", header)
+	}
+	if congestion := streamValue(stream, "kcpSettings", "congestion"); congestion != nil {
+		if _, ok := congestion.(bool); !ok {
+			return common.NewError("mkcp congestion must be true or false")
+		}
+	}
+	seed := streamString(stream, "kcpSettings", "seed")
+	if strings.ContainsAny(seed, " \t\r\n") {
+		return common.NewError("mkcp seed can not contain spaces")
+	}
+	ranges := []struct {
+		key      string
+		min, max float64
+	}{
+		{"mtu", 576, 1460},
+		{"tti", 10, 100},
+		{"uplinkCapacity", 0, 1 << 20},
+		{"downlinkCapacity", 0, 1 << 20},
+		{"readBufferSize", 0, 1 << 10},
+		{"writeBufferSize", 0, 1 << 10},
+	}
+	for _, r := range ranges {
+		value, ok := streamNumber(stream, "kcpSettings", r.key)
+		if !ok {
+			return common.NewErrorf("mkcp %v must be a number", r.key)
+		}
+		if streamValue(stream, "kcpSettings", r.key) != nil && (value < r.min || value > r.max) {
+			return common.NewErrorf("mkcp %v must be between %v and %v: %v", r.key, r.min, r.max, value)
+		}
+	}
+	return nil
+}
+
+// checkGrpcSettings checks the grpc settings, all but serviceName only matter to clients, which get them
+// through share links and client configs
+func checkGrpcSettings(stream map[string]interface{}) error {
+	serviceName := streamString(stream, "grpcSettings", "serviceName")
+	if strings.ContainsAny(serviceName, " \t\r\n") {
+		return common.NewError("grpc service name can not contain spaces:", serviceName)
+	}
+	if multiMode := streamValue(stream, "grpcSettings", "multiMode"); multiMode != nil {
+		if _, ok := multiMode.(bool); !ok {
+			return common.NewError("grpc multiMode must be true or false")
+		}
+	}
+	idleTimeout, ok := streamNumber(stream, "grpcSettings", "idle_timeout")
+	if !ok || idleTimeout < 0 || (idleTimeout > 0 && idleTimeout < 10) {
+		return common.NewError("grpc idle timeout must be 0 or at least 10 seconds")
+	}
+	healthCheckTimeout, ok := streamNumber(stream, "grpcSettings", "health_check_timeout")
+	if !ok || healthCheckTimeout < 0 {
+		return common.NewError("grpc health check timeout can not be negative")
+	}
+	initialWindowsSize, ok := streamNumber(stream, "grpcSettings", "initial_windows_size")
+	if !ok || initialWindowsSize < 0 {
+		return common.NewError("grpc initial windows size can not be negative")
+	}
+	return nil
+}
+
+// checkHttpPath checks the path of the http based transports, an empty one is xray's default /
+func checkHttpPath(network string, path string) error {
+	if path != "" && !strings.HasPrefix(path, "/") {
+		return common.NewErrorf("%v path must start with /: %v", network, path)
+	}
+	if strings.ContainsAny(path, " \t\r\n?#") {
+		return common.NewErrorf("%v path can not contain spaces, ? or #: %v", network, path)
+	}
+	return nil
+}
+
+func checkXHttpSettings(stream map[string]interface{}) error {
+	err := checkHttpPath("xhttp", streamString(stream, "xhttpSettings", "path"))
+	if err != nil {
+		return err
+	}
+	switch mode := streamString(stream, "xhttpSettings", "mode"); mode {
+	case "", "auto", "packet-up", "stream-up", "stream-one":
+	default:
+		return common.NewError("xhttp mode must be auto, packet-up, stream-up or stream-one:", mode)
+	}
+	return nil
+}
@@ -0,0 +1,74 @@
+package service
+
+import (
+	"crypto/rand"
+	_ "embed"
+	"encoding/hex"
+	"encoding/json"
+	"x-ui/util/common"
+	"x-ui/util/random"
+)
+
+//go:embed stream_presets.json
+var streamPresetsJson []byte
+
+// StreamPreset is a named stream settings block for new inbounds, keys and seeds it leaves empty are
+// generated when it is expanded
+type StreamPreset struct {
+	Name           string                 `json:"name"`
+	Title          string                 `json:"title"`
+	Description    string                 `json:"description"`
+	StreamSettings map[string]interface{} `json:"streamSettings"`
+}
+
+// GetStreamPresets returns the presets shipped with the panel, each call parses them anew so callers may
+// change what they get
+func GetStreamPresets() ([]*StreamPreset, error) {
+	presets := make([]*StreamPreset, 0)
+	err := json.Unmarshal(streamPresetsJson, &presets)
+	if err != nil {
+		return nil, err
+	}
+	return presets, nil
+}
+
+// ExpandStreamPreset returns the stream settings of the preset with the name, with fresh reality keys and
+// short id or mKCP seed where the preset needs them
+func ExpandStreamPreset(name string) (string, error) {
+	presets, err := GetStreamPresets()
+	if err != nil {
+		return "", err
+	}
+	var stream map[string]interface{}
+	for _, preset := range presets {
+		if preset.Name == name {
+			stream = preset.StreamSettings
+		}
+	}
+	if stream == nil {
+		return "", common.NewError("stream preset not found:", name)
+	}
+
+	if reality, ok := stream["realitySettings"].(map[string]interface{}); ok && streamString(reality, "privateKey") == "" {
+		privateKey, publicKey, err := newRealityKeys()
+		if err != nil {
+			return "", err
+		}
+		shortId := make([]byte, 8)
+		rand.Read(shortId)
+		reality["privateKey"] = privateKey
+		reality["shortIds"] = []string{hex.EncodeToString(shortId)}
+		if settings, ok := reality["settings"].(map[string]interface{}); ok {
+			settings["publicKey"] = publicKey
+		}
+	}
+	if kcp, ok := stream["kcpSettings"].(map[string]interface{}); ok && kcp["seed"] == "" {
+		kcp["seed"] = random.Seq(10)
+	}
+
+	data, err := json.Marshal(stream)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
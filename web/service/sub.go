@@ -0,0 +1,159 @@
+package service
+
+import (
+	"encoding/base64"
+	"net/url"
+	"strings"
+	"x-ui/database"
+	"x-ui/database/model"
+	"x-ui/logger"
+	"x-ui/util/common"
+	"x-ui/util/random"
+)
+
+// ClientSubEnable turns the subscription url of a client on or off
+type ClientSubEnable struct {
+	SubEnable bool `json:"subEnable" form:"subEnable"`
+}
+
+// SubService serves the subscription of a client, the share links of every inbound it is in and of the
+// replicas of those inbounds on nodes, at /sub/<subId>
+type SubService struct {
+	inboundService InboundServiceImpl
+	nodeService    NodeService
+	settingService SettingService
+}
+
+// subReplica is an inbound pushed to a node as it is shared in subscriptions
+type subReplica struct {
+	inbound *model.Inbound
+	address string
+}
+
+// getSubReplicas returns the pushed replicas of the inbounds by inbound id, with the port of the replica and
+// the host of its node. Replicas on disabled nodes are left out, and on offline ones if subSkipOfflineNodes is on
+func (s *SubService) getSubReplicas(inbounds []*model.Inbound) (map[int][]*subReplica, error) {
+	db := database.GetDB()
+	var replicas []*model.InboundReplica
+	err := db.Model(model.InboundReplica{}).Where("remote_id > 0").Find(&replicas).Error
+	if err != nil || len(replicas) == 0 {
+		return nil, err
+	}
+	nodes, err := s.nodeService.GetNodes()
+	if err != nil {
+		return nil, err
+	}
+	skipOffline, err := s.settingService.GetSubSkipOfflineNodes()
+	if err != nil {
+		return nil, err
+	}
+	nodeById := map[int]*model.Node{}
+	for _, node := range nodes {
+		nodeById[node.Id] = node
+	}
+	inboundById := map[int]*model.Inbound{}
+	for _, inbound := range inbounds {
+		inboundById[inbound.Id] = inbound
+	}
+
+	result := map[int][]*subReplica{}
+	for _, replica := range replicas {
+		node := nodeById[replica.NodeId]
+		inbound := inboundById[replica.InboundId]
+		if node == nil || inbound == nil || !node.Enable || (skipOffline && !node.Online) {
+			continue
+		}
+		u, err := url.Parse(node.Address)
+		if err != nil || u.Hostname() == "" {
+			logger.Warning("node address is not a valid url:", node.Address)
+			continue
+		}
+		// the node gets the inbound without its extra ports and port hopping, see pushReplica
+		remote := *inbound
+		remote.Remark = inbound.Remark + "-" + node.Name
+		remote.ExtraPorts = ""
+		remote.PortHopping = ""
+		if replica.Port > 0 {
+			remote.Port = replica.Port
+		}
+		result[inbound.Id] = append(result[inbound.Id], &subReplica{inbound: &remote, address: u.Hostname()})
+	}
+	return result, nil
+}
+
+// clientSubEnabled tells whether the subscription of the client is on, clients from before the flag have it on
+func clientSubEnabled(client map[string]interface{}) bool {
+	enable, ok := client["subEnable"].(bool)
+	return !ok || enable
+}
+
+// GetSubscription returns the base64 encoded share links of the clients with the subId, made with address like
+// GenLink, and those of the replicas of their inbounds with the hosts of the nodes. It fails for unknown subIds
+// and when the subscription of the client is off
+func (s *SubService) GetSubscription(subId string, address string) (string, error) {
+	if subId == "" {
+		return "", common.NewError("subscription not found")
+	}
+	inbounds, err := s.inboundService.GetAllInbounds()
+	if err != nil {
+		return "", err
+	}
+	replicas, err := s.getSubReplicas(inbounds)
+	if err != nil {
+		return "", err
+	}
+	found := false
+	links := make([]string, 0)
+	for _, inbound := range inbounds {
+		_, clients, err := parseClients(inbound)
+		if err != nil {
+			continue
+		}
+		for _, c := range clients {
+			client, ok := c.(map[string]interface{})
+			if !ok || client["subId"] != subId {
+				continue
+			}
+			if !clientSubEnabled(client) {
+				return "", common.NewError("subscription is disabled:", subId)
+			}
+			found = true
+			if !inbound.Enable {
+				continue
+			}
+			email, _ := client["email"].(string)
+			inboundLinks, err := GenLinks(inbound, email, address)
+			if err != nil {
+				return "", err
+			}
+			links = append(links, inboundLinks...)
+			for _, replica := range replicas[inbound.Id] {
+				link, err := GenLink(replica.inbound, email, replica.address)
+				if err != nil {
+					return "", err
+				}
+				links = append(links, link)
+			}
+		}
+	}
+	if !found {
+		return "", common.NewError("subscription not found:", subId)
+	}
+	rendered := &SubscriptionLinks{}
+	if mutateSubscriptionPlugins(&SubscriptionLinks{SubId: subId, Links: links}, rendered) {
+		links = rendered.Links
+	}
+	return base64.StdEncoding.EncodeToString([]byte(strings.Join(links, "\n"))), nil
+}
+
+// SetClientSubEnable turns the subscription of the client with the email on or off without touching the client,
+// clients from before subscriptions get a subId here
+func (s *SubService) SetClientSubEnable(email string, enable bool) error {
+	_, err := s.inboundService.UpdateClient(email, func(client map[string]interface{}) {
+		if subId, _ := client["subId"].(string); subId == "" {
+			client["subId"] = random.SecureSeq(16)
+		}
+		client["subEnable"] = enable
+	})
+	return err
+}
@@ -0,0 +1,142 @@
+package service
+
+import (
+	"encoding/json"
+	"os/exec"
+	"time"
+	"x-ui/logger"
+	"x-ui/util/tor"
+	"x-ui/xray"
+)
+
+// the tag of the tor outbound, routing rules of the template may send traffic to it as well
+const torTag = "tor"
+
+// TorStatus is how the tor daemon is doing, Error is why it is not reachable
+type TorStatus struct {
+	Enable    bool   `json:"enable"`
+	Managed   bool   `json:"managed"`
+	Address   string `json:"address"`
+	Installed bool   `json:"installed"`
+	Reachable bool   `json:"reachable"`
+	Error     string `json:"error,omitempty"`
+}
+
+// TorService connects xray to a tor daemon, either one the panel installs and keeps running or an
+// existing one at the tor address
+type TorService struct {
+	settingService SettingService
+	xrayService    XrayService
+}
+
+func (s *TorService) GetTorStatus() (*TorStatus, error) {
+	status := &TorStatus{}
+	var err error
+	status.Enable, err = s.settingService.GetTorEnable()
+	if err != nil {
+		return nil, err
+	}
+	status.Managed, err = s.settingService.GetTorManaged()
+	if err != nil {
+		return nil, err
+	}
+	status.Address, err = s.settingService.GetTorAddress()
+	if err != nil {
+		return nil, err
+	}
+	_, err = exec.LookPath("tor")
+	status.Installed = err == nil
+	err = tor.Check(status.Address, time.Second*5)
+	status.Reachable = err == nil
+	if err != nil {
+		status.Error = err.Error()
+	}
+	return status, nil
+}
+
+// InstallTor installs the tor daemon and starts it
+func (s *TorService) InstallTor() error {
+	err := tor.Install()
+	if err != nil {
+		return err
+	}
+	return tor.Restart()
+}
+
+// CheckTor restarts a managed tor daemon that stopped answering, installing it first if it is missing
+func (s *TorService) CheckTor() error {
+	status, err := s.GetTorStatus()
+	if err != nil {
+		return err
+	}
+	if !status.Enable || status.Reachable {
+		return nil
+	}
+	if !status.Managed {
+		logger.Warning("tor is not reachable at", status.Address+":", status.Error)
+		return nil
+	}
+	logger.Warning("tor is not reachable, restarting it:", status.Error)
+	return s.InstallTor()
+}
+
+// addTorOutbound adds the tor outbound unless the template has one already and puts a rule in front of
+// the template rules that sends the tor domains to it
+func addTorOutbound(xrayConfig *xray.Config, address string, domains []string) error {
+	outbounds := make([]interface{}, 0)
+	if len(xrayConfig.OutboundConfigs) > 0 {
+		err := json.Unmarshal(xrayConfig.OutboundConfigs, &outbounds)
+		if err != nil {
+			return err
+		}
+	}
+	found := false
+	for _, outbound := range outbounds {
+		found = found || outboundTag(outbound) == torTag
+	}
+	if !found {
+		host, port, err := splitHostPort(address, 9050)
+		if err != nil {
+			return err
+		}
+		outbounds = append(outbounds, map[string]interface{}{
+			"tag":      torTag,
+			"protocol": "socks",
+			"settings": map[string]interface{}{
+				"servers": []interface{}{
+					map[string]interface{}{"address": host, "port": port},
+				},
+			},
+		})
+		outboundConfigs, err := json.Marshal(outbounds)
+		if err != nil {
+			return err
+		}
+		xrayConfig.OutboundConfigs = outboundConfigs
+	}
+
+	if len(domains) == 0 {
+		return nil
+	}
+	routing := map[string]interface{}{}
+	if len(xrayConfig.RouterConfig) > 0 {
+		err := json.Unmarshal(xrayConfig.RouterConfig, &routing)
+		if err != nil {
+			return err
+		}
+	}
+	templateRules, _ := routing["rules"].([]interface{})
+	routing["rules"] = append([]interface{}{
+		map[string]interface{}{
+			"type":        "field",
+			"domain":      domains,
+			"outboundTag": torTag,
+		},
+	}, templateRules...)
+	routerConfig, err := json.Marshal(routing)
+	if err != nil {
+		return err
+	}
+	xrayConfig.RouterConfig = routerConfig
+	return nil
+}
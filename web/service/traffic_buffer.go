@@ -0,0 +1,119 @@
+package service
+
+import (
+	"context"
+	"sync"
+	"x-ui/database"
+	"x-ui/xray"
+)
+
+// traffic read from xray is summed up here and written to the database in one transaction per flush,
+// instead of three transactions every time the stats are read
+var trafficBufferLock sync.Mutex
+var inboundTrafficBuffer = map[string]*xray.Traffic{}
+var clientTrafficBuffer = map[string]*xray.ClientTraffic{}
+
+// failedFlushes counts the flushes that failed in a row, the traffic of all of them is still buffered
+var failedFlushes int
+
+type TrafficBufferService struct {
+	inboundService        InboundServiceImpl
+	trafficHistoryService TrafficHistoryService
+}
+
+func (s *TrafficBufferService) Add(traffics []*xray.Traffic, clientTraffics []*xray.ClientTraffic) {
+	trafficBufferLock.Lock()
+	defer trafficBufferLock.Unlock()
+	for _, traffic := range traffics {
+		if !traffic.IsInbound || traffic.Up+traffic.Down == 0 {
+			continue
+		}
+		buffered, ok := inboundTrafficBuffer[traffic.Tag]
+		if !ok {
+			buffered = &xray.Traffic{IsInbound: true, Tag: traffic.Tag}
+			inboundTrafficBuffer[traffic.Tag] = buffered
+		}
+		buffered.Up += traffic.Up
+		buffered.Down += traffic.Down
+	}
+	for _, traffic := range clientTraffics {
+		if traffic.Up+traffic.Down == 0 {
+			continue
+		}
+		buffered, ok := clientTrafficBuffer[traffic.Email]
+		if !ok {
+			buffered = &xray.ClientTraffic{Email: traffic.Email}
+			clientTrafficBuffer[traffic.Email] = buffered
+		}
+		buffered.Up += traffic.Up
+		buffered.Down += traffic.Down
+	}
+}
+
+func (s *TrafficBufferService) take() ([]*xray.Traffic, []*xray.ClientTraffic) {
+	trafficBufferLock.Lock()
+	defer trafficBufferLock.Unlock()
+	traffics := make([]*xray.Traffic, 0, len(inboundTrafficBuffer))
+	for _, traffic := range inboundTrafficBuffer {
+		traffics = append(traffics, traffic)
+	}
+	clientTraffics := make([]*xray.ClientTraffic, 0, len(clientTrafficBuffer))
+	for _, traffic := range clientTrafficBuffer {
+		clientTraffics = append(clientTraffics, traffic)
+	}
+	inboundTrafficBuffer = map[string]*xray.Traffic{}
+	clientTrafficBuffer = map[string]*xray.ClientTraffic{}
+	return traffics, clientTraffics
+}
+
+// Flush writes the inbound counters, client counters, traffic history and country traffic of the buffer in one transaction,
+// if that fails the traffic is put back to be written by the next flush
+func (s *TrafficBufferService) Flush(ctx context.Context) (err error) {
+	traffics, clientTraffics := s.take()
+	if len(traffics) == 0 && len(clientTraffics) == 0 {
+		return nil
+	}
+	db := database.GetDB().WithContext(ctx)
+	tx := db.Begin()
+	defer func() {
+		if err == nil {
+			err = tx.Commit().Error
+		} else {
+			tx.Rollback()
+		}
+		if err != nil {
+			s.Add(traffics, clientTraffics)
+		}
+		trafficBufferLock.Lock()
+		if err != nil {
+			failedFlushes++
+		} else {
+			failedFlushes = 0
+		}
+		trafficBufferLock.Unlock()
+	}()
+	err = s.inboundService.addTraffic(tx, traffics)
+	if err != nil {
+		return
+	}
+	err = s.inboundService.addClientTraffic(tx, clientTraffics)
+	if err != nil {
+		return
+	}
+	err = s.trafficHistoryService.addTrafficHistory(tx, traffics)
+	if err != nil {
+		return
+	}
+	return s.trafficHistoryService.addCountryTraffic(tx, clientTraffics)
+}
+
+// dbWriteSamples are the alert samples of the db_write_failures metric, the writes that failed in the last
+// ten minutes because the database stayed locked and the traffic flushes that failed in a row
+func dbWriteSamples() []alertSample {
+	trafficBufferLock.Lock()
+	defer trafficBufferLock.Unlock()
+	return []alertSample{
+		{subject: "database", value: float64(database.FailedWrites())},
+		{subject: "traffic flush", value: float64(failedFlushes)},
+	}
+}
@@ -0,0 +1,317 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+	"x-ui/database"
+	"x-ui/database/model"
+	"x-ui/util/common"
+	"x-ui/xray"
+
+	"gorm.io/gorm"
+)
+
+const trafficHistoryRetention = time.Hour * 24 * 90
+
+// resolutions a series can be downsampled to, the smallest one giving at most maxSeriesPoints wins
+var seriesResolutions = []time.Duration{
+	time.Minute,
+	time.Minute * 5,
+	time.Minute * 15,
+	time.Hour,
+	time.Hour * 6,
+	time.Hour * 24,
+}
+
+const maxSeriesPoints = 300
+
+type TrafficPoint struct {
+	Time int64 `json:"time" gorm:"column:bucket"`
+	Up   int64 `json:"up"`
+	Down int64 `json:"down"`
+}
+
+type TrafficSeries struct {
+	Inbound    string          `json:"inbound"`
+	From       int64           `json:"from"`
+	To         int64           `json:"to"`
+	Resolution int64           `json:"resolution"`
+	Points     []*TrafficPoint `json:"points"`
+}
+
+// TrafficBreakdown is the traffic of one protocol, transport and security combination, the fields
+// that were not grouped by are empty
+type TrafficBreakdown struct {
+	Protocol  string `json:"protocol"`
+	Transport string `json:"transport"`
+	Security  string `json:"security"`
+	Up        int64  `json:"up"`
+	Down      int64  `json:"down"`
+}
+
+// CountryTrafficSum is the traffic clients moved from one country
+type CountryTrafficSum struct {
+	Country string `json:"country"`
+	Up      int64  `json:"up"`
+	Down    int64  `json:"down"`
+}
+
+// unknownCountry is the user assigned iso code the traffic of addresses without a country is counted under
+const unknownCountry = "ZZ"
+
+type TrafficHistoryService struct {
+}
+
+func (s *TrafficHistoryService) AddTrafficHistory(traffics []*xray.Traffic) (err error) {
+	if len(traffics) == 0 {
+		return nil
+	}
+	db := database.GetDB()
+	tx := db.Begin()
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		} else {
+			tx.Commit()
+		}
+	}()
+	return s.addTrafficHistory(tx, traffics)
+}
+
+func (s *TrafficHistoryService) addTrafficHistory(tx *gorm.DB, traffics []*xray.Traffic) error {
+	bucket := time.Now().Truncate(time.Minute).Unix()
+	var inbounds []*model.Inbound
+	err := tx.Model(model.Inbound{}).Select("tag, protocol, stream_settings").Find(&inbounds).Error
+	if err != nil {
+		return err
+	}
+	inboundsByTag := map[string]*model.Inbound{}
+	for _, inbound := range inbounds {
+		inboundsByTag[inbound.Tag] = inbound
+	}
+	for _, traffic := range traffics {
+		if !traffic.IsInbound || traffic.Up+traffic.Down == 0 {
+			continue
+		}
+		result := tx.Model(model.TrafficHistory{}).
+			Where("tag = ? and time = ?", traffic.Tag, bucket).
+			UpdateColumns(map[string]interface{}{
+				"up":   gorm.Expr("up + ?", traffic.Up),
+				"down": gorm.Expr("down + ?", traffic.Down)})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			history := &model.TrafficHistory{
+				Tag:  traffic.Tag,
+				Time: bucket,
+				Up:   traffic.Up,
+				Down: traffic.Down,
+			}
+			if inbound, ok := inboundsByTag[traffic.Tag]; ok {
+				history.Protocol = string(inbound.Protocol)
+				history.Transport, history.Security = streamTransport(inbound.StreamSettings)
+			}
+			err := tx.Create(history).Error
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// addCountryTraffic adds the client traffic to the countries the clients are online from, the traffic
+// of a client online from several countries is split evenly between them
+func (s *TrafficHistoryService) addCountryTraffic(tx *gorm.DB, clientTraffics []*xray.ClientTraffic) error {
+	bucket := time.Now().Truncate(time.Hour).Unix()
+	sums := map[string]*CountryTrafficSum{}
+	for _, traffic := range clientTraffics {
+		countries := clientCountries(traffic.Email)
+		if len(countries) == 0 {
+			// moved traffic before the access log showed where from
+			countries = []string{unknownCountry}
+		}
+		n := int64(len(countries))
+		for i, country := range countries {
+			sum, ok := sums[country]
+			if !ok {
+				sum = &CountryTrafficSum{Country: country}
+				sums[country] = sum
+			}
+			sum.Up += traffic.Up / n
+			sum.Down += traffic.Down / n
+			if i == 0 {
+				sum.Up += traffic.Up % n
+				sum.Down += traffic.Down % n
+			}
+		}
+	}
+	for _, sum := range sums {
+		if sum.Up+sum.Down == 0 {
+			continue
+		}
+		result := tx.Model(model.CountryTraffic{}).
+			Where("country = ? and time = ?", sum.Country, bucket).
+			UpdateColumns(map[string]interface{}{
+				"up":   gorm.Expr("up + ?", sum.Up),
+				"down": gorm.Expr("down + ?", sum.Down)})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			err := tx.Create(&model.CountryTraffic{
+				Country: sum.Country,
+				Time:    bucket,
+				Up:      sum.Up,
+				Down:    sum.Down,
+			}).Error
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// GetCountryTraffic sums up the client traffic of the last span by country, largest first
+func (s *TrafficHistoryService) GetCountryTraffic(span time.Duration) ([]*CountryTrafficSum, error) {
+	if span <= 0 {
+		return nil, common.NewError("range must be positive")
+	}
+	db := database.GetDB()
+	sums := make([]*CountryTrafficSum, 0)
+	err := db.Model(model.CountryTraffic{}).
+		Select("country, sum(up) as up, sum(down) as down").
+		Where("time >= ?", time.Now().Add(-span).Truncate(time.Hour).Unix()).
+		Group("country").
+		Order("sum(up) + sum(down) desc").
+		Scan(&sums).Error
+	if err != nil {
+		return nil, err
+	}
+	return sums, nil
+}
+
+// streamTransport returns the network and security of stream settings, e.g. ws and tls
+func streamTransport(streamSettings string) (string, string) {
+	stream := map[string]interface{}{}
+	json.Unmarshal([]byte(streamSettings), &stream)
+	network, _ := stream["network"].(string)
+	security, _ := stream["security"].(string)
+	if network == "" {
+		network = "tcp"
+	}
+	if security == "" {
+		security = "none"
+	}
+	return network, security
+}
+
+// GetTrafficBreakdown sums up the traffic of the last span by the given columns, any of protocol,
+// transport and security
+func (s *TrafficHistoryService) GetTrafficBreakdown(span time.Duration, by []string) ([]*TrafficBreakdown, error) {
+	if span <= 0 {
+		return nil, common.NewError("range must be positive")
+	}
+	columns := make([]string, 0, len(by))
+	for _, column := range by {
+		switch column {
+		case "protocol", "transport", "security":
+			columns = append(columns, column)
+		default:
+			return nil, common.NewError("can not break traffic down by:", column)
+		}
+	}
+	if len(columns) == 0 {
+		columns = []string{"protocol", "transport", "security"}
+	}
+	group := strings.Join(columns, ", ")
+
+	db := database.GetDB()
+	breakdown := make([]*TrafficBreakdown, 0)
+	err := db.Model(model.TrafficHistory{}).
+		Select(group+", sum(up) as up, sum(down) as down").
+		Where("time >= ?", time.Now().Add(-span).Unix()).
+		Group(group).
+		Order("sum(up) + sum(down) desc").
+		Scan(&breakdown).Error
+	if err != nil {
+		return nil, err
+	}
+	return breakdown, nil
+}
+
+// ParseRange accepts go durations plus a "d" suffix for days, e.g. 90m, 24h, 7d
+func ParseRange(value string) (time.Duration, error) {
+	value = strings.TrimSpace(value)
+	if strings.HasSuffix(value, "d") {
+		days, err := strconv.Atoi(strings.TrimSuffix(value, "d"))
+		if err != nil {
+			return 0, common.NewError("invalid range:", value)
+		}
+		return time.Hour * 24 * time.Duration(days), nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, common.NewError("invalid range:", value)
+	}
+	return d, nil
+}
+
+func pickResolution(span time.Duration) time.Duration {
+	for _, resolution := range seriesResolutions {
+		if span/resolution <= maxSeriesPoints {
+			return resolution
+		}
+	}
+	return seriesResolutions[len(seriesResolutions)-1]
+}
+
+// GetTrafficSeries returns the traffic of the last span, for one inbound tag or all inbounds if tag is empty
+func (s *TrafficHistoryService) GetTrafficSeries(tag string, span time.Duration) (*TrafficSeries, error) {
+	if span <= 0 {
+		return nil, common.NewError("range must be positive")
+	}
+	if span > trafficHistoryRetention {
+		span = trafficHistoryRetention
+	}
+	resolution := pickResolution(span)
+	step := int64(resolution / time.Second)
+	now := time.Now()
+	from := now.Add(-span).Unix() / step * step
+
+	db := database.GetDB()
+	query := db.Model(model.TrafficHistory{}).
+		Select("time / ? * ? as bucket, sum(up) as up, sum(down) as down", step, step).
+		Where("time >= ?", from)
+	if tag != "" {
+		query = query.Where("tag = ?", tag)
+	}
+	points := make([]*TrafficPoint, 0)
+	err := query.Group("bucket").Order("bucket").Scan(&points).Error
+	if err != nil {
+		return nil, err
+	}
+	return &TrafficSeries{
+		Inbound:    tag,
+		From:       from,
+		To:         now.Unix(),
+		Resolution: step,
+		Points:     points,
+	}, nil
+}
+
+func (s *TrafficHistoryService) PruneTrafficHistory(ctx context.Context) (int64, error) {
+	before := time.Now().Add(-trafficHistoryRetention).Unix()
+	db := database.GetDB().WithContext(ctx)
+	result := db.Where("time < ?", before).Delete(model.TrafficHistory{})
+	if result.Error != nil {
+		return 0, result.Error
+	}
+	countries := db.Where("time < ?", before).Delete(model.CountryTraffic{})
+	return result.RowsAffected + countries.RowsAffected, countries.Error
+}
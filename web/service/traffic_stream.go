@@ -0,0 +1,75 @@
+package service
+
+import (
+	"sync"
+	"time"
+)
+
+// minimum time between two pushed snapshots, regardless of how often traffic is collected
+const trafficStreamMinInterval = time.Second
+
+type InboundTraffic struct {
+	Tag       string `json:"tag"`
+	Up        int64  `json:"up"`
+	Down      int64  `json:"down"`
+	UpSpeed   int64  `json:"upSpeed"`
+	DownSpeed int64  `json:"downSpeed"`
+}
+
+type TrafficSnapshot struct {
+	Time     int64             `json:"time"`
+	Up       int64             `json:"up"`
+	Down     int64             `json:"down"`
+	Inbounds []*InboundTraffic `json:"inbounds"`
+}
+
+var trafficSubscribers = map[chan *TrafficSnapshot]struct{}{}
+var trafficStreamLock sync.Mutex
+var lastTrafficPublish time.Time
+
+type TrafficStreamService struct {
+}
+
+func (s *TrafficStreamService) Subscribe() chan *TrafficSnapshot {
+	trafficStreamLock.Lock()
+	defer trafficStreamLock.Unlock()
+	// a single slot: slow readers only ever see the latest snapshot
+	ch := make(chan *TrafficSnapshot, 1)
+	trafficSubscribers[ch] = struct{}{}
+	return ch
+}
+
+func (s *TrafficStreamService) Unsubscribe(ch chan *TrafficSnapshot) {
+	trafficStreamLock.Lock()
+	defer trafficStreamLock.Unlock()
+	delete(trafficSubscribers, ch)
+}
+
+func (s *TrafficStreamService) HasSubscribers() bool {
+	trafficStreamLock.Lock()
+	defer trafficStreamLock.Unlock()
+	return len(trafficSubscribers) > 0
+}
+
+func (s *TrafficStreamService) Publish(snapshot *TrafficSnapshot) {
+	trafficStreamLock.Lock()
+	defer trafficStreamLock.Unlock()
+
+	if time.Since(lastTrafficPublish) < trafficStreamMinInterval {
+		return
+	}
+	lastTrafficPublish = time.Now()
+
+	for ch := range trafficSubscribers {
+		select {
+		case ch <- snapshot:
+		default:
+			// drop the stale snapshot the subscriber has not read yet
+			select {
+			case <-ch:
+			default:
+			}
+			ch <- snapshot
+		}
+	}
+}
@@ -0,0 +1,251 @@
+package service
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+	"x-ui/database"
+	"x-ui/database/model"
+	"x-ui/util/common"
+	"x-ui/util/random"
+	"x-ui/web/locale"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"gorm.io/gorm"
+)
+
+// trialLock serializes the cooldown check and the claim of a source
+var trialLock sync.Mutex
+
+type TrialAccount struct {
+	Email      string `json:"email"`
+	Link       string `json:"link"`
+	Total      int64  `json:"total"`
+	ExpiryTime int64  `json:"expiryTime"`
+}
+
+const (
+	TrialPending  = "pending"
+	TrialApproved = "approved"
+	TrialDenied   = "denied"
+)
+
+type TrialService struct {
+	inboundService InboundServiceImpl
+	settingService SettingService
+	xrayService    XrayService
+	notifyService  NotifyService
+}
+
+// checkTrialClaim returns the claim of source, new if it has none, or an error if its last trial is
+// within the cooldown
+func checkTrialClaim(source string, cooldownDays int, now time.Time) (*model.TrialClaim, error) {
+	db := database.GetDB()
+	claim := &model.TrialClaim{}
+	err := db.Model(model.TrialClaim{}).Where("source = ?", source).First(claim).Error
+	if err != nil && err != gorm.ErrRecordNotFound {
+		return nil, err
+	}
+	if err == nil {
+		if cooldownDays == 0 || now.Before(time.Unix(claim.Time, 0).AddDate(0, 0, cooldownDays)) {
+			return nil, common.NewError("a trial was already created for", source)
+		}
+	}
+	return claim, nil
+}
+
+// CreateTrial adds a limited client to the trial inbound for source, at most once per cooldown,
+// and returns its share link built for address
+func (s *TrialService) CreateTrial(source string, address string) (*TrialAccount, error) {
+	enable, err := s.settingService.GetTrialEnable()
+	if err != nil {
+		return nil, err
+	}
+	if !enable {
+		return nil, common.NewError("trial accounts are disabled")
+	}
+	inboundId, err := s.settingService.GetTrialInboundId()
+	if err != nil {
+		return nil, err
+	}
+	trafficGB, err := s.settingService.GetTrialTraffic()
+	if err != nil {
+		return nil, err
+	}
+	hours, err := s.settingService.GetTrialHours()
+	if err != nil {
+		return nil, err
+	}
+	cooldownDays, err := s.settingService.GetTrialCooldownDays()
+	if err != nil {
+		return nil, err
+	}
+
+	trialLock.Lock()
+	defer trialLock.Unlock()
+
+	db := database.GetDB()
+	now := time.Now()
+	claim, err := checkTrialClaim(source, cooldownDays, now)
+	if err != nil {
+		return nil, err
+	}
+
+	inbound, err := s.inboundService.GetInbound(inboundId)
+	if err != nil {
+		return nil, common.NewError("trial inbound not found:", inboundId)
+	}
+	email := "trial-" + strings.ToLower(random.Seq(8))
+	total := int64(trafficGB) * 1024 * 1024 * 1024
+	expiryTime := now.Add(time.Hour * time.Duration(hours)).UnixMilli()
+	client, err := NewClient(inbound.Protocol, email, total, expiryTime)
+	if err != nil {
+		return nil, err
+	}
+	inbound, err = s.inboundService.AddClient(inboundId, client)
+	if err != nil {
+		return nil, err
+	}
+	s.xrayService.SetToNeedRestart()
+
+	claim.Source = source
+	claim.Email = email
+	claim.Time = now.Unix()
+	err = db.Save(claim).Error
+	if err != nil {
+		return nil, err
+	}
+
+	link, err := GenLink(inbound, email, address)
+	if err != nil {
+		return nil, err
+	}
+	return &TrialAccount{
+		Email:      email,
+		Link:       link,
+		Total:      total,
+		ExpiryTime: expiryTime,
+	}, nil
+}
+
+// RequestTrial creates a trial right away, or with the trialApproval setting stores a request and asks the
+// admin chat in telegram to approve it. chatId is the telegram chat of the requester, 0 for web requests
+func (s *TrialService) RequestTrial(source string, address string, chatId int64) (*TrialAccount, *model.TrialRequest, error) {
+	approval, err := s.settingService.GetTrialApproval()
+	if err != nil {
+		return nil, nil, err
+	}
+	if !approval {
+		account, err := s.CreateTrial(source, address)
+		return account, nil, err
+	}
+	enable, err := s.settingService.GetTrialEnable()
+	if err != nil {
+		return nil, nil, err
+	}
+	if !enable {
+		return nil, nil, common.NewError("trial accounts are disabled")
+	}
+	cooldownDays, err := s.settingService.GetTrialCooldownDays()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	trialLock.Lock()
+	defer trialLock.Unlock()
+
+	now := time.Now()
+	_, err = checkTrialClaim(source, cooldownDays, now)
+	if err != nil {
+		return nil, nil, err
+	}
+	db := database.GetDB()
+	var count int64
+	err = db.Model(model.TrialRequest{}).Where("source = ? and status = ?", source, TrialPending).Count(&count).Error
+	if err != nil {
+		return nil, nil, err
+	}
+	if count > 0 {
+		return nil, nil, common.NewError("a trial request is already waiting for approval for", source)
+	}
+	request := &model.TrialRequest{
+		Source:  source,
+		Address: address,
+		ChatId:  chatId,
+		Token:   random.SecureSeq(16),
+		Status:  TrialPending,
+		Time:    now.Unix(),
+	}
+	err = db.Create(request).Error
+	if err != nil {
+		return nil, nil, err
+	}
+	keyboard := tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(locale.I18n("tgbot.approve"), fmt.Sprintf("trial_approve:%d", request.Id)),
+			tgbotapi.NewInlineKeyboardButtonData(locale.I18n("tgbot.deny"), fmt.Sprintf("trial_deny:%d", request.Id)),
+		),
+	)
+	err = s.notifyService.SendTelegramKeyboard(locale.I18n("tgbot.trialRequest", "Id", request.Id, "Source", source), keyboard)
+	if err != nil {
+		db.Delete(request)
+		return nil, nil, err
+	}
+	return nil, request, nil
+}
+
+func (s *TrialService) getTrialRequest(id int) (*model.TrialRequest, error) {
+	db := database.GetDB()
+	request := &model.TrialRequest{}
+	err := db.Model(model.TrialRequest{}).First(request, id).Error
+	if err != nil {
+		return nil, err
+	}
+	return request, nil
+}
+
+// GetTrialRequest returns the request with the id if token is its token, its link is set once it is approved
+func (s *TrialService) GetTrialRequest(id int, token string) (*model.TrialRequest, error) {
+	request, err := s.getTrialRequest(id)
+	if err != nil || subtle.ConstantTimeCompare([]byte(request.Token), []byte(token)) != 1 {
+		return nil, common.NewError("trial request not found:", id)
+	}
+	return request, nil
+}
+
+// claimTrialRequest moves a pending request to status, it fails if another admin answered it first
+func (s *TrialService) claimTrialRequest(id int, status string) (*model.TrialRequest, error) {
+	db := database.GetDB()
+	result := db.Model(model.TrialRequest{}).Where("id = ? and status = ?", id, TrialPending).Update("status", status)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, common.NewError("trial request is not pending:", id)
+	}
+	return s.getTrialRequest(id)
+}
+
+// ApproveTrialRequest creates the trial of the pending request, the request goes back to pending if that fails
+func (s *TrialService) ApproveTrialRequest(id int) (*model.TrialRequest, *TrialAccount, error) {
+	request, err := s.claimTrialRequest(id, TrialApproved)
+	if err != nil {
+		return nil, nil, err
+	}
+	db := database.GetDB()
+	account, err := s.CreateTrial(request.Source, request.Address)
+	if err != nil {
+		db.Model(request).Update("status", TrialPending)
+		return request, nil, err
+	}
+	request.Email = account.Email
+	request.Link = account.Link
+	err = db.Save(request).Error
+	return request, account, err
+}
+
+func (s *TrialService) DenyTrialRequest(id int) (*model.TrialRequest, error) {
+	return s.claimTrialRequest(id, TrialDenied)
+}
@@ -0,0 +1,93 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+	"x-ui/util/common"
+)
+
+var tagEscaper = strings.NewReplacer(",", `\,`, "=", `\=`, " ", `\ `)
+
+// TsdbExportService pushes samples in the InfluxDB line protocol, which VictoriaMetrics accepts as well
+type TsdbExportService struct {
+	settingService SettingService
+	inboundService InboundServiceImpl
+	serverService  ServerService
+}
+
+func escapeTag(value string) string {
+	if value == "" {
+		return "none"
+	}
+	return tagEscaper.Replace(value)
+}
+
+func (s *TsdbExportService) buildLines(now time.Time) (string, error) {
+	inbounds, err := s.inboundService.GetAllInboundTraffics()
+	if err != nil {
+		return "", err
+	}
+	ts := now.UnixNano()
+	var buf strings.Builder
+	for _, inbound := range inbounds {
+		fmt.Fprintf(&buf, "xui_inbound,tag=%s,remark=%s,protocol=%s up=%di,down=%di,total=%di,enable=%t %d\n",
+			escapeTag(inbound.Tag), escapeTag(inbound.Remark), escapeTag(string(inbound.Protocol)),
+			inbound.Up, inbound.Down, inbound.Total, inbound.Enable, ts)
+		for _, stat := range inbound.ClientStats {
+			fmt.Fprintf(&buf, "xui_client,email=%s,inbound=%s up=%di,down=%di,total=%di,enable=%t %d\n",
+				escapeTag(stat.Email), escapeTag(inbound.Tag),
+				stat.Up, stat.Down, stat.Total, stat.Enable, ts)
+		}
+	}
+
+	status := s.serverService.GetStatus(nil)
+	fmt.Fprintf(&buf, "xui_server cpu=%f,mem_used=%di,mem_total=%di,disk_used=%di,disk_total=%di,tcp=%di,udp=%di,net_sent=%di,net_recv=%di,xray_running=%t %d\n",
+		status.Cpu, status.Mem.Current, status.Mem.Total, status.Disk.Current, status.Disk.Total,
+		status.TcpCount, status.UdpCount, status.NetTraffic.Sent, status.NetTraffic.Recv,
+		status.Xray.State == Running, ts)
+	return buf.String(), nil
+}
+
+func (s *TsdbExportService) Export(ctx context.Context) error {
+	writeUrl, err := s.settingService.GetTsdbUrl()
+	if err != nil {
+		return err
+	}
+	if writeUrl == "" {
+		return common.NewError("time-series database url is empty")
+	}
+	token, err := s.settingService.GetTsdbToken()
+	if err != nil {
+		return err
+	}
+
+	lines, err := s.buildLines(time.Now())
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, writeUrl, bytes.NewBufferString(lines))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	if token != "" {
+		req.Header.Set("Authorization", "Token "+token)
+	}
+	client := &http.Client{
+		Timeout: time.Second * 10,
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return common.NewErrorf("time-series database responded with status %v", resp.StatusCode)
+	}
+	return nil
+}
@@ -25,6 +25,20 @@ func (s *UserService) GetFirstUser() (*model.User, error) {
 	return user, nil
 }
 
+// GetUser returns the user by id, nil if there is none
+func (s *UserService) GetUser(id int) *model.User {
+	db := database.GetDB()
+	user := &model.User{}
+	err := db.Model(model.User{}).Where("id = ?", id).First(user).Error
+	if err != nil {
+		if err != gorm.ErrRecordNotFound {
+			logger.Warning("get user err:", err)
+		}
+		return nil
+	}
+	return user
+}
+
 func (s *UserService) CheckUser(username string, password string) *model.User {
 	db := database.GetDB()
 
@@ -50,23 +64,58 @@ func (s *UserService) UpdateUser(id int, username string, password string) error
 		Error
 }
 
+// SetViewer adds a viewer or changes the password of one, the names of admins can not be taken
+func (s *UserService) SetViewer(username string, password string) error {
+	if username == "" || password == "" {
+		return errors.New("username and password can not be empty")
+	}
+	db := database.GetDB()
+	user := &model.User{}
+	err := db.Model(model.User{}).Where("username = ?", username).First(user).Error
+	if database.IsNotFound(err) {
+		return db.Create(&model.User{Username: username, Password: password, Viewer: true}).Error
+	} else if err != nil {
+		return err
+	}
+	if !user.Viewer {
+		return errors.New("user is not a viewer: " + username)
+	}
+	user.Password = password
+	return db.Save(user).Error
+}
+
+func (s *UserService) DelViewer(username string) error {
+	db := database.GetDB()
+	result := db.Where("username = ? and viewer = ?", username, true).Delete(model.User{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errors.New("viewer not found: " + username)
+	}
+	return nil
+}
+
 func (s *UserService) UpdateFirstUser(username string, password string) error {
 	if username == "" {
 		return errors.New("username can not be empty")
 	} else if password == "" {
 		return errors.New("password can not be empty")
 	}
-	db := database.GetDB()
+	return s.updateFirstUser(database.GetDB(), username, password)
+}
+
+func (s *UserService) updateFirstUser(tx *gorm.DB, username string, password string) error {
 	user := &model.User{}
-	err := db.Model(model.User{}).First(user).Error
+	err := tx.Model(model.User{}).First(user).Error
 	if database.IsNotFound(err) {
 		user.Username = username
 		user.Password = password
-		return db.Model(model.User{}).Create(user).Error
+		return tx.Model(model.User{}).Create(user).Error
 	} else if err != nil {
 		return err
 	}
 	user.Username = username
 	user.Password = password
-	return db.Save(user).Error
+	return tx.Save(user).Error
 }
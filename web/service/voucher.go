@@ -0,0 +1,109 @@
+package service
+
+import (
+	"strings"
+	"time"
+	"x-ui/database"
+	"x-ui/database/model"
+	"x-ui/util/common"
+	"x-ui/util/random"
+)
+
+const maxVoucherBatch = 1000
+
+type VoucherService struct {
+	inboundService InboundServiceImpl
+	xrayService    XrayService
+}
+
+func (s *VoucherService) GetVouchers() ([]*model.Voucher, error) {
+	db := database.GetDB()
+	var vouchers []*model.Voucher
+	err := db.Model(model.Voucher{}).Order("id desc").Find(&vouchers).Error
+	if err != nil {
+		return nil, err
+	}
+	return vouchers, nil
+}
+
+func newVoucherCode() string {
+	code := random.SecureUpperSeq(12)
+	return code[0:4] + "-" + code[4:8] + "-" + code[8:12]
+}
+
+// GenerateVouchers creates count unused vouchers worth traffic bytes and days days each
+func (s *VoucherService) GenerateVouchers(count int, traffic int64, days int) ([]*model.Voucher, error) {
+	if count <= 0 || count > maxVoucherBatch {
+		return nil, common.NewErrorf("voucher count must be between 1 and %v", maxVoucherBatch)
+	}
+	if traffic < 0 || days < 0 || traffic+int64(days) == 0 {
+		return nil, common.NewError("a voucher needs positive traffic or days")
+	}
+	now := time.Now().Unix()
+	vouchers := make([]*model.Voucher, 0, count)
+	for i := 0; i < count; i++ {
+		vouchers = append(vouchers, &model.Voucher{
+			Code:      newVoucherCode(),
+			Traffic:   traffic,
+			Days:      days,
+			CreatedAt: now,
+		})
+	}
+	db := database.GetDB()
+	return vouchers, db.Create(&vouchers).Error
+}
+
+func (s *VoucherService) DelVoucher(id int) error {
+	db := database.GetDB()
+	return db.Delete(model.Voucher{}, id).Error
+}
+
+// Redeem credits the voucher to the client with the email. Traffic is added to a limited quota and days are
+// added to the later of now and the expiry, unlimited quotas and expiries stay unlimited.
+func (s *VoucherService) Redeem(email string, code string) (*model.Voucher, error) {
+	code = strings.ToUpper(strings.TrimSpace(code))
+	if _, _, err := s.inboundService.FindClient(email); err != nil {
+		return nil, err
+	}
+
+	db := database.GetDB()
+	voucher := &model.Voucher{}
+	err := db.Model(model.Voucher{}).Where("code = ?", code).First(voucher).Error
+	if err != nil {
+		return nil, common.NewError("voucher not found:", code)
+	}
+	// claim it first so concurrent redemptions of one code can not both succeed
+	now := time.Now()
+	result := db.Model(model.Voucher{}).
+		Where("id = ? and used_by = ?", voucher.Id, "").
+		Updates(map[string]interface{}{"used_by": email, "used_at": now.Unix()})
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, common.NewError("voucher already used:", code)
+	}
+
+	_, err = s.inboundService.UpdateClient(email, func(client map[string]interface{}) {
+		if total := clientInt(client, "totalGB"); total > 0 {
+			client["totalGB"] = total + voucher.Traffic
+		}
+		if expiryTime := clientInt(client, "expiryTime"); expiryTime > 0 && voucher.Days > 0 {
+			from := now
+			if old := time.UnixMilli(expiryTime); old.After(now) {
+				from = old
+			}
+			client["expiryTime"] = from.Add(time.Hour * 24 * time.Duration(voucher.Days)).UnixMilli()
+		}
+	})
+	if err != nil {
+		// give the voucher back, the client did not get anything
+		db.Model(model.Voucher{}).Where("id = ?", voucher.Id).
+			Updates(map[string]interface{}{"used_by": "", "used_at": 0})
+		return nil, err
+	}
+	s.xrayService.SetToNeedRestart()
+	voucher.UsedBy = email
+	voucher.UsedAt = now.Unix()
+	return voucher, nil
+}
@@ -0,0 +1,152 @@
+package service
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/url"
+	"strings"
+	"time"
+	"x-ui/database"
+	"x-ui/database/model"
+	"x-ui/logger"
+	"x-ui/util/common"
+)
+
+const (
+	EventInboundCreated  = "inbound.created"
+	EventInboundUpdated  = "inbound.updated"
+	EventInboundDeleted  = "inbound.deleted"
+	EventInboundDepleted = "inbound.depleted"
+	EventClientDepleted  = "client.depleted"
+	EventClientRenewed   = "client.renewed"
+	EventClientRotated   = "client.rotated"
+	EventXrayRestarted   = "xray.restarted"
+	EventLoginFailed     = "login.failed"
+	EventPortBlocked     = "port.blocked"
+)
+
+var webhookEvents = []string{
+	EventInboundCreated,
+	EventInboundUpdated,
+	EventInboundDeleted,
+	EventInboundDepleted,
+	EventClientDepleted,
+	EventClientRenewed,
+	EventClientRotated,
+	EventXrayRestarted,
+	EventLoginFailed,
+	EventPortBlocked,
+}
+
+type WebhookPayload struct {
+	Event string      `json:"event"`
+	Time  int64       `json:"time"`
+	Data  interface{} `json:"data"`
+}
+
+type WebhookService struct {
+	notifyService NotifyService
+}
+
+func (s *WebhookService) GetWebhooks() ([]*model.Webhook, error) {
+	db := database.GetDB()
+	var webhooks []*model.Webhook
+	err := db.Model(model.Webhook{}).Find(&webhooks).Error
+	if err != nil {
+		return nil, err
+	}
+	return webhooks, nil
+}
+
+func (s *WebhookService) checkWebhook(webhook *model.Webhook) error {
+	u, err := url.Parse(webhook.Url)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return common.NewError("webhook url is not valid:", webhook.Url)
+	}
+	for _, event := range strings.Split(webhook.Events, ",") {
+		event = strings.TrimSpace(event)
+		if event != "" && !common.IsSubString(event, append([]string{}, webhookEvents...)) {
+			return common.NewError("unknown webhook event:", event)
+		}
+	}
+	return nil
+}
+
+func (s *WebhookService) AddWebhook(webhook *model.Webhook) (*model.Webhook, error) {
+	if err := s.checkWebhook(webhook); err != nil {
+		return webhook, err
+	}
+	db := database.GetDB()
+	return webhook, db.Create(webhook).Error
+}
+
+func (s *WebhookService) UpdateWebhook(webhook *model.Webhook) (*model.Webhook, error) {
+	if err := s.checkWebhook(webhook); err != nil {
+		return webhook, err
+	}
+	db := database.GetDB()
+	return webhook, db.Save(webhook).Error
+}
+
+func (s *WebhookService) DelWebhook(id int) error {
+	db := database.GetDB()
+	return db.Delete(model.Webhook{}, id).Error
+}
+
+func matchEvent(filter string, event string) bool {
+	if strings.TrimSpace(filter) == "" {
+		return true
+	}
+	for _, e := range strings.Split(filter, ",") {
+		if strings.TrimSpace(e) == event {
+			return true
+		}
+	}
+	return false
+}
+
+// Sign returns the X-XUI-Signature header value, the hex hmac-sha256 of the body keyed by the secret
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Dispatch sends the event to the plugins, its event script and every subscribed webhook in the background,
+// failures are only logged
+func (s *WebhookService) Dispatch(event string, data interface{}) {
+	payload := &WebhookPayload{
+		Event: event,
+		Time:  time.Now().Unix(),
+		Data:  data,
+	}
+	go func() {
+		observePlugins(event, payload)
+		runEventScripts(payload)
+		webhooks, err := s.GetWebhooks()
+		if err != nil {
+			logger.Warning("get webhooks failed:", err)
+			return
+		}
+		body, err := json.Marshal(payload)
+		if err != nil {
+			logger.Warning("encode webhook payload failed:", err)
+			return
+		}
+		for _, webhook := range webhooks {
+			if !webhook.Enable || !matchEvent(webhook.Events, event) {
+				continue
+			}
+			headers := map[string]string{"X-XUI-Event": event}
+			if webhook.Secret != "" {
+				headers["X-XUI-Signature"] = Sign(webhook.Secret, body)
+			}
+			err := s.notifyService.PostWebhook(webhook.Url, body, headers)
+			if err != nil {
+				logger.Warning("send webhook failed:", webhook.Name, event, err)
+			}
+		}
+	}()
+}
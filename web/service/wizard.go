@@ -0,0 +1,345 @@
+package service
+
+import (
+	"crypto/ecdh"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+	"x-ui/database/model"
+	"x-ui/util/common"
+
+	"github.com/google/uuid"
+)
+
+// FallbackWizard describes a VLESS inbound with XTLS Vision that hides behind a camouflage site.
+// With tls security clients connect to Domain with a stored certificate and everything that is not VLESS
+// falls back to the plain http Decoy, requests to the base path of a plain http panel fall back to the panel.
+// With reality security the handshake is borrowed from the tls 1.3 site Decoy, Domain is then only the
+// address of the share link
+type FallbackWizard struct {
+	Security      string `json:"security" form:"security"`
+	Domain        string `json:"domain" form:"domain"`
+	Decoy         string `json:"decoy" form:"decoy"`
+	Port          int    `json:"port" form:"port"`
+	CertificateId int    `json:"certificateId" form:"certificateId"`
+	Email         string `json:"email" form:"email"`
+	Remark        string `json:"remark" form:"remark"`
+}
+
+// WizardStep is one check of the wizard, the inbound is only added if all of them are ok
+type WizardStep struct {
+	Name    string `json:"name"`
+	Ok      bool   `json:"ok"`
+	Message string `json:"message"`
+}
+
+type WizardResult struct {
+	Steps   []*WizardStep  `json:"steps"`
+	Inbound *model.Inbound `json:"inbound"`
+	Link    string         `json:"link"`
+}
+
+func (r *WizardResult) step(name string, err error, message string) bool {
+	step := &WizardStep{Name: name, Ok: err == nil, Message: message}
+	if err != nil {
+		step.Message = err.Error()
+	}
+	r.Steps = append(r.Steps, step)
+	return step.Ok
+}
+
+type WizardService struct {
+	inboundService     InboundServiceImpl
+	serverService      ServerService
+	settingService     SettingService
+	certificateService CertificateService
+}
+
+// splitHostPort accepts host or host:port
+func splitHostPort(address string, defaultPort int) (string, int, error) {
+	host, portString, err := net.SplitHostPort(address)
+	if err != nil {
+		return address, defaultPort, nil
+	}
+	port, err := strconv.Atoi(portString)
+	if err != nil || port <= 0 || port > 65535 {
+		return "", 0, common.NewError("not a valid port:", portString)
+	}
+	return host, port, nil
+}
+
+// checkDomain makes sure the domain resolves to a public address of this server
+func (s *WizardService) checkDomain(domain string) (string, error) {
+	ips, err := net.LookupIP(domain)
+	if err != nil {
+		return "", err
+	}
+	v4, v6 := s.serverService.GetPublicIP()
+	for _, ip := range ips {
+		if ip.String() == v4 || ip.String() == v6 {
+			return fmt.Sprintf("%v resolves to %v", domain, ip), nil
+		}
+	}
+	return "", common.NewErrorf("%v resolves to %v, not to this server %v %v", domain, ips, v4, v6)
+}
+
+// checkPort makes sure no inbound has the port and nothing else listens on it
+func (s *WizardService) checkPort(port int) (string, error) {
+	if port <= 0 || port > 65535 {
+		return "", common.NewError("not a valid port:", port)
+	}
+	exist, err := s.inboundService.checkPortExist(port, 0)
+	if err != nil {
+		return "", err
+	}
+	if exist {
+		return "", common.NewError("Port already exists:", port)
+	}
+	listener, err := net.Listen("tcp", net.JoinHostPort("", strconv.Itoa(port)))
+	if err != nil {
+		return "", err
+	}
+	listener.Close()
+	return fmt.Sprintf("port %v is free", port), nil
+}
+
+// checkCertificate makes sure the stored certificate covers the domain and has not expired
+func (s *WizardService) checkCertificate(id int, domain string) (string, error) {
+	if id <= 0 {
+		return "", common.NewError("tls needs a stored certificate")
+	}
+	pair, err := s.certificateService.GetKeyPair(id)
+	if err != nil {
+		return "", err
+	}
+	leaf, err := x509.ParseCertificate(pair.Certificate[0])
+	if err != nil {
+		return "", err
+	}
+	if err := leaf.VerifyHostname(domain); err != nil {
+		return "", err
+	}
+	if time.Now().After(leaf.NotAfter) {
+		return "", common.NewError("certificate expired at", leaf.NotAfter)
+	}
+	return fmt.Sprintf("certificate covers %v until %v", domain, leaf.NotAfter.Format("2006-01-02")), nil
+}
+
+// checkDecoy connects to the camouflage site, reality needs tls 1.3 from it, a tls fallback a plain http server
+func (s *WizardService) checkDecoy(security string, host string, port int) (string, error) {
+	address := net.JoinHostPort(host, strconv.Itoa(port))
+	if security != "reality" {
+		conn, err := net.DialTimeout("tcp", address, time.Second*10)
+		if err != nil {
+			return "", err
+		}
+		conn.Close()
+		return fmt.Sprintf("%v is reachable", address), nil
+	}
+	h2, err := checkTls13Site(address, host)
+	if err != nil {
+		return "", common.NewErrorf("%v does not speak tls 1.3: %v", address, err)
+	}
+	if !h2 {
+		return fmt.Sprintf("%v speaks tls 1.3 but not h2, a site with h2 blends in better", address), nil
+	}
+	return fmt.Sprintf("%v speaks tls 1.3 and h2", address), nil
+}
+
+// newRealityKeys returns an x25519 private and public key in the base64 form of xray
+func newRealityKeys() (string, string, error) {
+	key, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return "", "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(key.Bytes()), base64.RawURLEncoding.EncodeToString(key.PublicKey().Bytes()), nil
+}
+
+// panelFallback returns the fallback of the panel, nil if the panel serves https and can not be a fallback
+func (s *WizardService) panelFallback() (map[string]interface{}, error) {
+	certFile, err := s.settingService.GetCertFile()
+	if err != nil {
+		return nil, err
+	}
+	certificateId, err := s.settingService.GetWebCertificateId()
+	if err != nil {
+		return nil, err
+	}
+	if certFile != "" || certificateId > 0 {
+		return nil, nil
+	}
+	port, err := s.settingService.GetPort()
+	if err != nil {
+		return nil, err
+	}
+	basePath, err := s.settingService.GetBasePath()
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{"path": basePath, "dest": port}, nil
+}
+
+// buildStream returns the stream settings and the fallbacks of the inbound
+func (s *WizardService) buildStream(form *FallbackWizard, decoyHost string, decoyPort int, result *WizardResult) (map[string]interface{}, []interface{}, error) {
+	if form.Security == "reality" {
+		privateKey, publicKey, err := newRealityKeys()
+		if err != nil {
+			return nil, nil, err
+		}
+		shortId := make([]byte, 8)
+		rand.Read(shortId)
+		stream := map[string]interface{}{
+			"network":  "tcp",
+			"security": "reality",
+			"realitySettings": map[string]interface{}{
+				"show":        false,
+				"dest":        net.JoinHostPort(decoyHost, strconv.Itoa(decoyPort)),
+				"xver":        0,
+				"serverNames": []string{decoyHost},
+				"privateKey":  privateKey,
+				"shortIds":    []string{hex.EncodeToString(shortId)},
+				// not read by xray, kept for share links
+				"settings": map[string]interface{}{
+					"publicKey":   publicKey,
+					"fingerprint": "chrome",
+				},
+			},
+		}
+		return stream, []interface{}{}, nil
+	}
+
+	fallbacks := []interface{}{
+		map[string]interface{}{"dest": net.JoinHostPort(decoyHost, strconv.Itoa(decoyPort))},
+	}
+	panel, err := s.panelFallback()
+	if err != nil {
+		return nil, nil, err
+	}
+	if panel != nil {
+		fallbacks = append(fallbacks, panel)
+		result.step("panel", nil, fmt.Sprintf("requests to %v fall back to the panel", panel["path"]))
+	} else {
+		result.step("panel", nil, "the panel serves https itself and is not a fallback")
+	}
+	stream := map[string]interface{}{
+		"network":  "tcp",
+		"security": "tls",
+		"tlsSettings": map[string]interface{}{
+			"serverName":   form.Domain,
+			"alpn":         []string{"http/1.1"},
+			"certificates": []interface{}{},
+		},
+	}
+	return stream, fallbacks, nil
+}
+
+// CreateFallbackInbound checks the setup step by step and adds the inbound if every step passed,
+// otherwise the result only has the steps and the error names the failed ones
+func (s *WizardService) CreateFallbackInbound(userId int, form *FallbackWizard) (*WizardResult, error) {
+	result := &WizardResult{Steps: make([]*WizardStep, 0)}
+	if form.Security != "tls" && form.Security != "reality" {
+		return nil, common.NewError("security must be tls or reality:", form.Security)
+	}
+	if form.Port == 0 {
+		form.Port = 443
+	}
+	if form.Email == "" {
+		form.Email = strings.SplitN(uuid.NewString(), "-", 2)[0]
+	}
+	defaultDecoyPort := 80
+	if form.Security == "reality" {
+		defaultDecoyPort = 443
+	}
+	decoyHost, decoyPort, err := splitHostPort(form.Decoy, defaultDecoyPort)
+	if err != nil || decoyHost == "" {
+		return nil, common.NewError("decoy is not a valid host or host:port:", form.Decoy)
+	}
+
+	if form.Domain != "" {
+		message, err := s.checkDomain(form.Domain)
+		result.step("dns", err, message)
+	} else if form.Security == "tls" {
+		result.step("dns", common.NewError("tls needs the domain clients connect to"), "")
+	}
+	message, err := s.checkPort(form.Port)
+	result.step("port", err, message)
+	message, err = s.checkDecoy(form.Security, decoyHost, decoyPort)
+	result.step("decoy", err, message)
+	if form.Security == "tls" {
+		message, err = s.checkCertificate(form.CertificateId, form.Domain)
+		result.step("certificate", err, message)
+	}
+
+	stream, fallbacks, err := s.buildStream(form, decoyHost, decoyPort, result)
+	if err != nil {
+		return nil, err
+	}
+	failed := make([]string, 0)
+	for _, step := range result.Steps {
+		if !step.Ok {
+			failed = append(failed, step.Name)
+		}
+	}
+	if len(failed) > 0 {
+		return result, common.NewError("the wizard found problems with:", strings.Join(failed, ", "))
+	}
+
+	settings := map[string]interface{}{
+		"clients": []interface{}{
+			map[string]interface{}{
+				"id":         uuid.NewString(),
+				"flow":       "xtls-rprx-vision",
+				"email":      form.Email,
+				"totalGB":    0,
+				"expiryTime": 0,
+			},
+		},
+		"decryption": "none",
+		"fallbacks":  fallbacks,
+	}
+	settingsJson, err := json.MarshalIndent(settings, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	streamJson, err := json.MarshalIndent(stream, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	remark := form.Remark
+	if remark == "" {
+		remark = fmt.Sprintf("vless-%v-%v", form.Security, form.Port)
+	}
+	inbound := &model.Inbound{
+		UserId:         userId,
+		Remark:         remark,
+		Enable:         true,
+		Port:           form.Port,
+		Protocol:       model.VLESS,
+		Settings:       string(settingsJson),
+		StreamSettings: string(streamJson),
+		Tag:            fmt.Sprintf("inbound-%v", form.Port),
+		Sniffing:       `{"enabled": true, "destOverride": ["http", "tls"]}`,
+	}
+	if form.Security == "tls" {
+		inbound.CertificateId = form.CertificateId
+	}
+	inbound, err = s.inboundService.AddInbound(inbound)
+	if err != nil {
+		return result, err
+	}
+	result.Inbound = inbound
+
+	address := form.Domain
+	if address == "" {
+		address = s.serverService.GetPreferredPublicIP()
+	}
+	result.Link, _ = GenLink(inbound, form.Email, address)
+	return result, nil
+}
@@ -1,9 +1,12 @@
 package service
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"sync"
+	"time"
+	"x-ui/database/model"
 	"x-ui/logger"
 	"x-ui/xray"
 
@@ -15,9 +18,27 @@ var lock sync.Mutex
 var isNeedXrayRestart atomic.Bool
 var result string
 
+// xrayStartTime is the start of the running xray in unix nanoseconds, the metrics read it without the lock
+var xrayStartTime atomic.Int64
+var xrayRestartCount atomic.Int64
+
+// restarts asked for in quick succession, e.g. a bulk edit or saving the template and adding an inbound,
+// are coalesced into one: xray restarts once no new request came for restartDebounce,
+// but no later than restartMaxDelay after the first pending request
+const restartDebounce = time.Second * 3
+const restartMaxDelay = time.Second * 30
+
+var restartLock sync.Mutex
+var restartTimer *time.Timer
+var restartFirstRequest time.Time
+
 type XrayService struct {
-	inboundService InboundServiceImpl
-	settingService SettingService
+	inboundService     InboundServiceImpl
+	settingService     SettingService
+	webhookService     WebhookService
+	certificateService CertificateService
+	policyService      PolicyService
+	portForwardService PortForwardService
 }
 
 func (s *XrayService) IsXrayRunning() bool {
@@ -45,6 +66,20 @@ func (s *XrayService) GetXrayResult() string {
 	return result
 }
 
+// GetXrayUptime returns how long the current xray process has been running
+func (s *XrayService) GetXrayUptime() time.Duration {
+	if !s.IsXrayRunning() {
+		return 0
+	}
+	return time.Since(time.Unix(0, xrayStartTime.Load()))
+}
+
+// GetXrayRestartCount returns how often xray was started again since the panel started, the first start
+// does not count
+func (s *XrayService) GetXrayRestartCount() int64 {
+	return xrayRestartCount.Load()
+}
+
 func (s *XrayService) GetXrayVersion() string {
 	if p == nil {
 		return "Unknown"
@@ -68,15 +103,28 @@ func (s *XrayService) GetXrayConfig() (*xray.Config, error) {
 		return nil, err
 	}
 
-	s.inboundService.DisableInvalidClients()
+	s.inboundService.DisableInvalidClients(context.Background())
 
-	inbounds, err := s.inboundService.GetAllInbounds()
+	loc, err := s.settingService.GetTimeLocation()
 	if err != nil {
 		return nil, err
 	}
-	for _, inbound := range inbounds {
+	now := time.Now().In(loc)
+	scheduledOff := map[string]bool{}
+	// the inbounds are read a batch at a time, only the config built from them is held in full and the
+	// country restrictions are kept apart for the routing
+	countryInbounds := make([]*model.Inbound, 0)
+	err = s.inboundService.EachInbound(func(inbound *model.Inbound) error {
 		if !inbound.Enable {
-			continue
+			return nil
+		}
+		if inbound.CountryMode != "" {
+			countryInbounds = append(countryInbounds, &model.Inbound{
+				Tag:         inbound.Tag,
+				Enable:      inbound.Enable,
+				CountryMode: inbound.CountryMode,
+				Countries:   inbound.Countries,
+			})
 		}
 		// get settings clients
 		settings := map[string]interface{}{}
@@ -93,7 +141,7 @@ func (s *XrayService) GetXrayConfig() (*xray.Config, error) {
 					if c["email"] == clientTraffic.Email {
 						if !clientTraffic.Enable {
 							clients = RemoveIndex(clients, index)
-							logger.Info("Remove Inbound User", c["email"], "due the expire or traffic limit")
+							logger.Xray.Info("Remove Inbound User", c["email"], "due the expire or traffic limit")
 
 						}
 
@@ -101,32 +149,144 @@ func (s *XrayService) GetXrayConfig() (*xray.Config, error) {
 				}
 
 			}
+			// notes are for the admin only, xray has no use for them, and clients outside of their
+			// schedule are left out until their hours start
+			scheduled := make([]interface{}, 0, len(clients))
+			for _, client := range clients {
+				if c, ok := client.(map[string]interface{}); ok {
+					delete(c, "notes")
+					if clientOutOfSchedule(c, now) {
+						email, _ := c["email"].(string)
+						scheduledOff[email] = true
+						continue
+					}
+				}
+				scheduled = append(scheduled, client)
+			}
+			clients = scheduled
 			settings["clients"] = clients
 			modifiedSettings, err := json.Marshal(settings)
 			if err != nil {
-				return nil, err
+				return err
 			}
 
 			inbound.Settings = string(modifiedSettings)
 		}
+		s.certificateService.applyCertificate(inbound)
 		inboundConfig := inbound.GenXrayInboundConfig()
 		xrayConfig.InboundConfigs = append(xrayConfig.InboundConfigs, *inboundConfig)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	setScheduledOffClients(scheduledOff)
+	torEnable, err := s.settingService.GetTorEnable()
+	if err != nil {
+		return nil, err
+	}
+	if torEnable {
+		torAddress, err := s.settingService.GetTorAddress()
+		if err != nil {
+			return nil, err
+		}
+		torDomains, err := s.settingService.GetTorDomains()
+		if err != nil {
+			return nil, err
+		}
+		// before the blocking rules, which go in front of it
+		err = addTorOutbound(xrayConfig, torAddress, torDomains)
+		if err != nil {
+			return nil, err
+		}
+	}
+	err = addCountryRules(xrayConfig, countryInbounds)
+	if err != nil {
+		return nil, err
+	}
+	err = addConnLimitRules(xrayConfig)
+	if err != nil {
+		return nil, err
+	}
+	routingPresets, err := s.settingService.GetRoutingPresets()
+	if err != nil {
+		return nil, err
+	}
+	err = addRoutingPresets(xrayConfig, routingPresets)
+	if err != nil {
+		return nil, err
+	}
+	err = s.policyService.addPolicyLevels(xrayConfig)
+	if err != nil {
+		return nil, err
+	}
+	err = s.portForwardService.addPortForwards(xrayConfig)
+	if err != nil {
+		return nil, err
+	}
+	latencyProbeUrls, err := s.settingService.GetLatencyProbeUrls()
+	if err != nil {
+		return nil, err
+	}
+	if len(latencyProbeUrls) > 0 {
+		// last, so every outbound added above is probed as well
+		err = addLatencyProbes(xrayConfig)
+		if err != nil {
+			return nil, err
+		}
+	}
+	latencyBalancers, err := s.settingService.GetLatencyBalancers()
+	if err != nil {
+		return nil, err
+	}
+	if latencyBalancers {
+		err = addLatencyBalancers(xrayConfig, latencyProbeUrls)
+		if err != nil {
+			return nil, err
+		}
+	}
+	rendered := &xray.Config{}
+	if mutatePlugins(HookConfigRender, xrayConfig, rendered) {
+		xrayConfig = rendered
 	}
 	return xrayConfig, nil
 }
 
-func (s *XrayService) GetXrayTraffic() ([]*xray.Traffic, []*xray.ClientTraffic, error) {
+func (s *XrayService) GetXrayTraffic(ctx context.Context) ([]*xray.Traffic, []*xray.ClientTraffic, error) {
 	if !s.IsXrayRunning() {
 		return nil, nil, errors.New("xray is not running")
 	}
-	return p.GetTraffic(true)
+	return p.GetTraffic(ctx, true)
+}
+
+// AddSourceRule appends a rule to the routing of the running xray, see xray.Process.AddSourceRule
+func (s *XrayService) AddSourceRule(ruleTag string, outboundTag string, email string, sources []string) error {
+	lock.Lock()
+	defer lock.Unlock()
+	if !s.IsXrayRunning() {
+		return errors.New("xray is not running")
+	}
+	return p.AddSourceRule(ruleTag, outboundTag, email, sources)
+}
+
+// RemoveRule removes the rule with the tag from the routing of the running xray
+func (s *XrayService) RemoveRule(ruleTag string) error {
+	lock.Lock()
+	defer lock.Unlock()
+	if !s.IsXrayRunning() {
+		return errors.New("xray is not running")
+	}
+	return p.RemoveRule(ruleTag)
 }
 
 func (s *XrayService) RestartXray(isForce bool) error {
-	return nil
 	lock.Lock()
 	defer lock.Unlock()
-	logger.Debug("restart xray, force:", isForce)
+	if IsStandby() {
+		logger.Xray.Debug("not starting xray on a standby panel instance")
+		return nil
+	}
+	logger.Xray.Debug("restart xray, force:", isForce)
 
 	xrayConfig, err := s.GetXrayConfig()
 	if err != nil {
@@ -135,29 +295,84 @@ func (s *XrayService) RestartXray(isForce bool) error {
 
 	if p != nil && p.IsRunning() {
 		if !isForce && p.GetConfig().Equals(xrayConfig) {
-			logger.Debug("not need to restart xray")
+			logger.Xray.Debug("not need to restart xray")
 			return nil
 		}
 		p.Stop()
 	}
 
+	restarted := p != nil
 	p = xray.NewProcess(xrayConfig)
 	result = ""
-	return p.Start()
+	err = p.Start()
+	if err != nil {
+		return err
+	}
+	xrayStartTime.Store(time.Now().UnixNano())
+	if restarted {
+		xrayRestartCount.Inc()
+	}
+	// every start is dispatched, so a standby instance taking over is reported as well
+	s.webhookService.Dispatch(EventXrayRestarted, map[string]interface{}{
+		"version":   p.GetVersion(),
+		"restarted": restarted,
+	})
+	return nil
 }
 
 func (s *XrayService) StopXray() error {
 	lock.Lock()
 	defer lock.Unlock()
-	logger.Debug("stop xray")
+	logger.Xray.Debug("stop xray")
 	if s.IsXrayRunning() {
 		return p.Stop()
 	}
 	return errors.New("xray is not running")
 }
 
+// SetToNeedRestart schedules a restart of xray, see restartDebounce
 func (s *XrayService) SetToNeedRestart() {
+	restartLock.Lock()
+	defer restartLock.Unlock()
 	isNeedXrayRestart.Store(true)
+
+	now := time.Now()
+	if restartTimer == nil {
+		restartFirstRequest = now
+	}
+	delay := restartDebounce
+	if deadline := restartFirstRequest.Add(restartMaxDelay); now.Add(delay).After(deadline) {
+		delay = deadline.Sub(now)
+	}
+	if restartTimer == nil {
+		restartTimer = time.AfterFunc(delay, s.restartPending)
+	} else {
+		restartTimer.Reset(delay)
+	}
+}
+
+func (s *XrayService) restartPending() {
+	restartLock.Lock()
+	restartTimer = nil
+	restartLock.Unlock()
+
+	if s.IsNeedRestartAndSetFalse() {
+		err := s.RestartXray(false)
+		if err != nil {
+			logger.Xray.Error("restart xray failed:", err)
+		}
+	}
+}
+
+// CancelPendingRestart drops a scheduled restart, used when the panel stops
+func (s *XrayService) CancelPendingRestart() {
+	restartLock.Lock()
+	defer restartLock.Unlock()
+	if restartTimer != nil {
+		restartTimer.Stop()
+		restartTimer = nil
+	}
+	isNeedXrayRestart.Store(false)
 }
 
 func (s *XrayService) IsNeedRestartAndSetFalse() bool {
@@ -0,0 +1,140 @@
+package session
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+	"time"
+	"x-ui/database/model"
+	"x-ui/util/jwt"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	accessCookie  = "x-ui-access"
+	refreshCookie = "x-ui-refresh"
+)
+
+// jwtConfig is set when logins are kept in signed tokens instead of the cookie session, nothing of a
+// login is then stored by the panel, so replicas that share the secret accept each other's logins
+type jwtConfig struct {
+	key        []byte
+	accessTTL  time.Duration
+	refreshTTL time.Duration
+	// getUser reads the user again when an access token is refreshed, nil if it was removed
+	getUser func(id int) *model.User
+}
+
+var jwtSessions *jwtConfig
+
+type accessClaims struct {
+	jwt.Claims
+	Username string `json:"name"`
+	Viewer   bool   `json:"viewer,omitempty"`
+	Type     string `json:"typ"`
+}
+
+// refreshClaims carry a fingerprint of the password keyed with the signing key, changing the password ends
+// the logins made with the old one and the token tells nothing about the password without the key
+type refreshClaims struct {
+	jwt.Claims
+	Password string `json:"pwd"`
+	Type     string `json:"typ"`
+}
+
+// UseJWT keeps logins in short lived access tokens that are renewed with a refresh token while it is
+// valid, a nil key goes back to the cookie session
+func UseJWT(key []byte, accessTTL time.Duration, refreshTTL time.Duration, getUser func(id int) *model.User) {
+	if key == nil {
+		jwtSessions = nil
+		return
+	}
+	jwtSessions = &jwtConfig{key: key, accessTTL: accessTTL, refreshTTL: refreshTTL, getUser: getUser}
+}
+
+func (j *jwtConfig) passwordFingerprint(password string) string {
+	mac := hmac.New(sha256.New, j.key)
+	mac.Write([]byte(password))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func setTokenCookie(c *gin.Context, name string, value string, ttl time.Duration) {
+	http.SetCookie(c.Writer, &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     "/",
+		MaxAge:   int(ttl.Seconds()),
+		HttpOnly: true,
+		Secure:   c.Request.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+func (j *jwtConfig) setLoginUser(c *gin.Context, user *model.User) error {
+	now := time.Now()
+	subject := strconv.Itoa(user.Id)
+	access, err := jwt.Sign(j.key, &accessClaims{
+		Claims:   jwt.Claims{Subject: subject, IssuedAt: now.Unix(), ExpiresAt: now.Add(j.accessTTL).Unix()},
+		Username: user.Username,
+		Viewer:   user.Viewer,
+		Type:     "access",
+	})
+	if err != nil {
+		return err
+	}
+	refresh, err := jwt.Sign(j.key, &refreshClaims{
+		Claims:   jwt.Claims{Subject: subject, IssuedAt: now.Unix(), ExpiresAt: now.Add(j.refreshTTL).Unix()},
+		Password: j.passwordFingerprint(user.Password),
+		Type:     "refresh",
+	})
+	if err != nil {
+		return err
+	}
+	setTokenCookie(c, accessCookie, access, j.accessTTL)
+	setTokenCookie(c, refreshCookie, refresh, j.refreshTTL)
+	c.Set(loginUser, user)
+	return nil
+}
+
+// getLoginUser reads the user from the access token, or from the database with the refresh token once
+// the access token expired, and then issues new tokens
+func (j *jwtConfig) getLoginUser(c *gin.Context) *model.User {
+	if token, err := c.Cookie(accessCookie); err == nil {
+		claims := &accessClaims{}
+		if jwt.Verify(j.key, token, claims) == nil && claims.Type == "access" {
+			if id, err := strconv.Atoi(claims.Subject); err == nil {
+				user := &model.User{Id: id, Username: claims.Username, Viewer: claims.Viewer}
+				c.Set(loginUser, user)
+				return user
+			}
+		}
+	}
+	token, err := c.Cookie(refreshCookie)
+	if err != nil {
+		return nil
+	}
+	claims := &refreshClaims{}
+	if jwt.Verify(j.key, token, claims) != nil || claims.Type != "refresh" {
+		return nil
+	}
+	id, err := strconv.Atoi(claims.Subject)
+	if err != nil {
+		return nil
+	}
+	user := j.getUser(id)
+	if user == nil || !hmac.Equal([]byte(j.passwordFingerprint(user.Password)), []byte(claims.Password)) {
+		return nil
+	}
+	if j.setLoginUser(c, user) != nil {
+		return nil
+	}
+	return user
+}
+
+func (j *jwtConfig) clearSession(c *gin.Context) {
+	setTokenCookie(c, accessCookie, "", -time.Second)
+	setTokenCookie(c, refreshCookie, "", -time.Second)
+}
@@ -0,0 +1,106 @@
+package session
+
+import (
+	"net/http"
+	"strconv"
+	"x-ui/util/random"
+	"x-ui/util/redis"
+
+	"github.com/gin-contrib/sessions"
+	"github.com/gorilla/securecookie"
+	gsessions "github.com/gorilla/sessions"
+)
+
+// sessions live this long in the redis when their cookie has no max age, like the signed cookies
+const redisSessionMaxAge = 86400 * 30
+
+// redisStore keeps the values of sessions in redis and only their signed id in the cookie, panel instances
+// sharing the redis share the sessions and a logout ends a session on all of them
+type redisStore struct {
+	client    *redis.Client
+	keyPrefix string
+	codecs    []securecookie.Codec
+	options   *gsessions.Options
+}
+
+func NewRedisStore(client *redis.Client, keyPrefix string, keyPairs ...[]byte) sessions.Store {
+	return &redisStore{
+		client:    client,
+		keyPrefix: keyPrefix,
+		codecs:    securecookie.CodecsFromPairs(keyPairs...),
+		options:   &gsessions.Options{Path: "/", MaxAge: redisSessionMaxAge},
+	}
+}
+
+func (s *redisStore) Options(options sessions.Options) {
+	s.options = options.ToGorillaOptions()
+}
+
+func (s *redisStore) Get(r *http.Request, name string) (*gsessions.Session, error) {
+	return gsessions.GetRegistry(r).Get(s, name)
+}
+
+// New loads the session of the cookie, a session missing from the redis, e.g. expired, starts over empty
+func (s *redisStore) New(r *http.Request, name string) (*gsessions.Session, error) {
+	session := gsessions.NewSession(s, name)
+	options := *s.options
+	session.Options = &options
+	session.IsNew = true
+	cookie, err := r.Cookie(name)
+	if err != nil {
+		return session, nil
+	}
+	var id string
+	err = securecookie.DecodeMulti(name, cookie.Value, &id, s.codecs...)
+	if err != nil {
+		return session, err
+	}
+	data, err := s.client.Get(s.keyPrefix + id)
+	if err == redis.ErrNil {
+		return session, nil
+	}
+	if err != nil {
+		return session, err
+	}
+	err = securecookie.DecodeMulti(name, data, &session.Values, s.codecs...)
+	if err != nil {
+		return session, err
+	}
+	session.ID = id
+	session.IsNew = false
+	return session, nil
+}
+
+// Save writes the session to the redis, a negative max age deletes it there and in the cookie
+func (s *redisStore) Save(r *http.Request, w http.ResponseWriter, session *gsessions.Session) error {
+	if session.Options.MaxAge < 0 {
+		if session.ID != "" {
+			if _, err := s.client.Do("DEL", s.keyPrefix+session.ID); err != nil {
+				return err
+			}
+		}
+		http.SetCookie(w, gsessions.NewCookie(session.Name(), "", session.Options))
+		return nil
+	}
+	if session.ID == "" {
+		session.ID = random.SecureSeq(32)
+	}
+	data, err := securecookie.EncodeMulti(session.Name(), session.Values, s.codecs...)
+	if err != nil {
+		return err
+	}
+	maxAge := session.Options.MaxAge
+	if maxAge == 0 {
+		maxAge = redisSessionMaxAge
+	}
+	_, err = s.client.Do("SET", s.keyPrefix+session.ID, data, "EX", strconv.Itoa(maxAge))
+	if err != nil {
+		return err
+	}
+	encoded, err := securecookie.EncodeMulti(session.Name(), session.ID, s.codecs...)
+	if err != nil {
+		return err
+	}
+	http.SetCookie(w, gsessions.NewCookie(session.Name(), encoded, session.Options))
+	return nil
+}
@@ -8,7 +8,8 @@ import (
 )
 
 const (
-	loginUser = "LOGIN_USER"
+	loginUser    = "LOGIN_USER"
+	portalClient = "PORTAL_CLIENT"
 )
 
 func init() {
@@ -16,12 +17,26 @@ func init() {
 }
 
 func SetLoginUser(c *gin.Context, user *model.User) error {
+	if jwtSessions != nil {
+		return jwtSessions.setLoginUser(c, user)
+	}
 	s := sessions.Default(c)
 	s.Set(loginUser, user)
 	return s.Save()
 }
 
+// SetRequestUser authenticates only the current request, e.g. for basic auth, without creating a session
+func SetRequestUser(c *gin.Context, user *model.User) {
+	c.Set(loginUser, user)
+}
+
 func GetLoginUser(c *gin.Context) *model.User {
+	if obj, ok := c.Get(loginUser); ok {
+		return obj.(*model.User)
+	}
+	if jwtSessions != nil {
+		return jwtSessions.getLoginUser(c)
+	}
 	s := sessions.Default(c)
 	obj := s.Get(loginUser)
 	if obj == nil {
@@ -36,6 +51,9 @@ func IsLogin(c *gin.Context) bool {
 }
 
 func ClearSession(c *gin.Context) {
+	if jwtSessions != nil {
+		jwtSessions.clearSession(c)
+	}
 	s := sessions.Default(c)
 	s.Clear()
 	s.Options(sessions.Options{
@@ -44,3 +62,22 @@ func ClearSession(c *gin.Context) {
 	})
 	s.Save()
 }
+
+// SetPortalClient logs an end user into the portal, kept apart from the admin login so neither grants the other
+func SetPortalClient(c *gin.Context, email string) error {
+	s := sessions.Default(c)
+	s.Set(portalClient, email)
+	return s.Save()
+}
+
+func GetPortalClient(c *gin.Context) string {
+	s := sessions.Default(c)
+	email, _ := s.Get(portalClient).(string)
+	return email
+}
+
+func ClearPortalClient(c *gin.Context) error {
+	s := sessions.Default(c)
+	s.Delete(portalClient)
+	return s.Save()
+}
@@ -2,8 +2,11 @@ package web
 
 import (
 	"context"
+	"crypto/hmac"
+	"crypto/sha256"
 	"crypto/tls"
 	"embed"
+	"fmt"
 	"html/template"
 	"io"
 	"io/fs"
@@ -16,18 +19,20 @@ import (
 	"x-ui/config"
 	"x-ui/logger"
 	"x-ui/util/common"
+	"x-ui/util/random"
+	"x-ui/util/tracing"
 	"x-ui/web/controller"
 	"x-ui/web/job"
+	"x-ui/web/locale"
 	"x-ui/web/network"
 	"x-ui/web/service"
+	"x-ui/web/session"
 
 	"github.com/gin-contrib/sessions"
 	"github.com/gin-contrib/sessions/cookie"
 	"github.com/gin-gonic/gin"
 	"github.com/nicksnyder/go-i18n/v2/i18n"
-	"github.com/pelletier/go-toml/v2"
 	"github.com/robfig/cron/v3"
-	"golang.org/x/text/language"
 )
 
 //go:embed assets/*
@@ -81,14 +86,28 @@ type Server struct {
 	httpServer *http.Server
 	listener   net.Listener
 
-	index  *controller.IndexController
-	server *controller.ServerController
-	xui    *controller.XUIController
-	api    *controller.APIController
-
-	xrayService    service.XrayService
-	settingService service.SettingService
-	inboundService service.InboundServiceImpl
+	index   *controller.IndexController
+	server  *controller.ServerController
+	xui     *controller.XUIController
+	api     *controller.APIController
+	apiV1   *controller.APIV1Controller
+	metrics *controller.MetricsController
+	health  *controller.HealthController
+	portal  *controller.PortalController
+	payment *controller.PaymentController
+	trial   *controller.TrialController
+	sub     *controller.SubController
+	agent   *controller.AgentController
+	debug   *controller.DebugController
+
+	// isAgent serves only the agent api for a central panel, without the web UI
+	isAgent bool
+
+	xrayService         service.XrayService
+	settingService      service.SettingService
+	inboundService      service.InboundServiceImpl
+	certificateService  service.CertificateService
+	coordinationService service.CoordinationService
 
 	cron *cron.Cron
 
@@ -104,6 +123,12 @@ func NewServer() *Server {
 	}
 }
 
+func NewAgentServer() *Server {
+	s := NewServer()
+	s.isAgent = true
+	return s
+}
+
 func (s *Server) getHtmlFiles() ([]string, error) {
 	files := make([]string, 0)
 	dir, _ := os.Getwd()
@@ -157,6 +182,15 @@ func (s *Server) initRouter() (*gin.Engine, error) {
 
 	engine := gin.Default()
 
+	trustedProxies, err := s.settingService.GetTrustedProxies()
+	if err != nil {
+		return nil, err
+	}
+	err = engine.SetTrustedProxies(trustedProxies)
+	if err != nil {
+		return nil, err
+	}
+
 	secret, err := s.settingService.GetSecret()
 	if err != nil {
 		return nil, err
@@ -168,11 +202,60 @@ func (s *Server) initRouter() (*gin.Engine, error) {
 	}
 	assetsBasePath := basePath + "assets/"
 
-	store := cookie.NewStore(secret)
+	var store sessions.Store
+	if client := s.coordinationService.GetRedis(); client != nil {
+		store = session.NewRedisStore(client, "x-ui:session:", secret)
+	} else {
+		store = cookie.NewStore(secret)
+	}
 	engine.Use(sessions.Sessions("session", store))
+	err = s.initJwtSessions(secret)
+	if err != nil {
+		return nil, err
+	}
 	engine.Use(func(c *gin.Context) {
 		c.Set("base_path", basePath)
 	})
+	engine.Use(func(c *gin.Context) {
+		// requests keep the id given by a proxy in front of the panel, so log lines can be correlated
+		requestId := c.GetHeader("X-Request-Id")
+		if requestId == "" || len(requestId) > 64 {
+			requestId = random.Seq(16)
+		}
+		c.Set("request_id", requestId)
+		c.Header("X-Request-Id", requestId)
+	})
+	engine.Use(func(c *gin.Context) {
+		// a proxy or client that traces passes its trace on with a traceparent header
+		path := c.FullPath()
+		if path == "" {
+			path = "unmatched"
+		}
+		ctx, span := tracing.Start(tracing.Extract(c.Request.Context(), c.GetHeader("traceparent")), c.Request.Method+" "+path, tracing.KindServer)
+		if span == nil {
+			return
+		}
+		c.Request = c.Request.WithContext(ctx)
+		c.Next()
+		span.SetAttribute("http.method", c.Request.Method)
+		span.SetAttribute("http.route", path)
+		span.SetAttribute("http.status_code", c.Writer.Status())
+		span.SetAttribute("x-ui.request_id", c.GetString("request_id"))
+		var err error
+		if c.Writer.Status() >= http.StatusInternalServerError {
+			err = fmt.Errorf("status %v", c.Writer.Status())
+		}
+		span.End(err)
+	})
+	engine.Use(func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+		path := c.FullPath()
+		if path == "" {
+			path = "unmatched"
+		}
+		service.HttpRequestDuration.Observe(time.Since(start).Seconds(), c.Request.Method, path, strconv.Itoa(c.Writer.Status()))
+	})
 	engine.Use(func(c *gin.Context) {
 		uri := c.Request.RequestURI
 		if strings.HasPrefix(uri, assetsBasePath) {
@@ -184,6 +267,13 @@ func (s *Server) initRouter() (*gin.Engine, error) {
 		return nil, err
 	}
 
+	if s.isAgent {
+		g := engine.Group(basePath)
+		s.health = controller.NewHealthController(g)
+		s.agent = controller.NewAgentController(g)
+		return engine, nil
+	}
+
 	if config.IsDebug() {
 		// for develop
 		files, err := s.getHtmlFiles()
@@ -203,32 +293,55 @@ func (s *Server) initRouter() (*gin.Engine, error) {
 	}
 
 	g := engine.Group(basePath)
+	container := &controller.Container{
+		Cron: s.cron,
+		Ctx:  s.ctx,
+	}
 
 	s.index = controller.NewIndexController(g)
-	s.server = controller.NewServerController(g)
+	s.server = controller.NewServerController(g, container)
 	s.xui = controller.NewXUIController(g)
-	s.api = controller.NewAPIController(g)
+	s.api = controller.NewAPIController(g, s.server)
+	s.apiV1 = controller.NewAPIV1Controller(g, s.server)
+	s.metrics = controller.NewMetricsController(g)
+	s.portal = controller.NewPortalController(g)
+	s.payment = controller.NewPaymentController(g)
+	s.trial = controller.NewTrialController(g)
+	s.sub = controller.NewSubController(g)
+	s.health = controller.NewHealthController(g)
+	s.debug = controller.NewDebugController(g)
 
 	return engine, nil
 }
 
-func (s *Server) initI18n(engine *gin.Engine) error {
-	bundle := i18n.NewBundle(language.SimplifiedChinese)
-	bundle.RegisterUnmarshalFunc("toml", toml.Unmarshal)
-	err := fs.WalkDir(i18nFS, "translation", func(path string, d fs.DirEntry, err error) error {
-		if err != nil {
-			return err
-		}
-		if d.IsDir() {
-			return nil
-		}
-		data, err := i18nFS.ReadFile(path)
-		if err != nil {
-			return err
-		}
-		_, err = bundle.ParseMessageFileBytes(data, path)
+// initJwtSessions keeps logins in tokens signed with a key derived from the secret of the panel when the
+// jwtSessions setting is on, panels sharing a database share the secret and accept each other's logins
+func (s *Server) initJwtSessions(secret []byte) error {
+	enabled, err := s.settingService.GetJwtSessions()
+	if err != nil {
 		return err
-	})
+	}
+	if !enabled {
+		session.UseJWT(nil, 0, 0, nil)
+		return nil
+	}
+	accessMinutes, err := s.settingService.GetJwtAccessMinutes()
+	if err != nil {
+		return err
+	}
+	refreshDays, err := s.settingService.GetJwtRefreshDays()
+	if err != nil {
+		return err
+	}
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte("x-ui jwt sessions"))
+	userService := service.UserService{}
+	session.UseJWT(mac.Sum(nil), time.Minute*time.Duration(accessMinutes), time.Hour*24*time.Duration(refreshDays), userService.GetUser)
+	return nil
+}
+
+func (s *Server) initI18n(engine *gin.Engine) error {
+	err := locale.InitLocalizer(i18nFS)
 	if err != nil {
 		return err
 	}
@@ -284,7 +397,7 @@ func (s *Server) initI18n(engine *gin.Engine) error {
 			lang = c.GetHeader("Accept-Language")
 		}
 
-		localizer = i18n.NewLocalizer(bundle, lang)
+		localizer = locale.NewLocalizer(lang)
 		c.Set("localizer", localizer)
 		c.Set("I18n", I18n)
 		c.Next()
@@ -293,22 +406,123 @@ func (s *Server) initI18n(engine *gin.Engine) error {
 	return nil
 }
 
+// jobParser reads the specs like the cron of the server, which runs with seconds
+var jobParser = cron.NewParser(cron.Second | cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow | cron.Descriptor)
+
+// addJob schedules the job on the cron spec configured for name
+func (s *Server) addJob(name string, j cron.Job) {
+	s.addJobSpec(name, s.settingService.GetJobSchedule(name), j)
+}
+
+// addJobSpec registers the job under name, so its runs are recorded and it can be triggered by hand
+func (s *Server) addJobSpec(name string, spec string, j cron.Job) error {
+	schedule, err := jobParser.Parse(spec)
+	if err != nil {
+		logger.Warningf("add job %v on %q failed: %v", name, spec, err)
+		return err
+	}
+	next := schedule.Next(time.Now())
+	s.cron.Schedule(schedule, job.Register(name, j, schedule.Next(next).Sub(next)))
+	return nil
+}
+
 func (s *Server) startTask() {
+	// Elect the active one of redundant panel instances before starting xray, and every 5 seconds after,
+	// on a fixed schedule as the active instance has to renew its lock before it expires
+	election := job.NewLeaderElectionJob()
+	election.Run()
+	s.addJobSpec("leaderElection", "@every 5s", election)
+
 	err := s.xrayService.RestartXray(true)
 	if err != nil {
 		logger.Warning("start xray failed:", err)
 	}
+	// The intervals below are the defaults, the jobSchedules setting can change each of them
+
 	// Check whether xray is running every 30 seconds
-	s.cron.AddJob("@every 30s", job.NewCheckXrayRunningJob())
+	s.addJob("checkXrayRunning", job.NewCheckXrayRunningJob())
 
 	go func() {
 		time.Sleep(time.Second * 5)
 		// Statistics every 10 seconds, start the delay for 5 seconds for the first time, and staggered with the time to restart xray
-		s.cron.AddJob("@every 10s", job.NewXrayTrafficJob())
+		s.addJob("xrayTraffic", job.NewXrayTrafficJob())
 	}()
 
+	// Write the traffic collected above to the database every 30 seconds, in one transaction
+	s.addJob("flushTraffic", job.NewFlushTrafficJob())
+
+	// Parse new xray access log lines every 10 seconds to track online clients
+	s.addJob("accessLog", job.NewAccessLogJob())
+
+	// Block the addresses of clients online from more addresses than their connection limit every 10 seconds
+	s.addJob("connLimit", job.NewConnLimitJob())
+
+	// Restart xray every minute in which a client entered or left the hours of its schedule
+	s.addJob("clientSchedule", job.NewClientScheduleJob())
+
+	// Open the ports of inbounds in the host firewall and close the ones of removed inbounds, every 5 minutes
+	s.addJob("firewall", job.NewFirewallJob())
+
+	// Redirect the port hopping ranges of inbounds to their ports every 30 seconds, when they changed
+	s.addJob("portHopping", job.NewPortHoppingJob())
+
+	// Evaluate alert rules every 30 seconds
+	s.addJob("alert", job.NewAlertJob())
+
+	// Rotate the panel and xray logs that grew past the size limit every 5 minutes
+	s.addJob("logRotate", job.NewLogRotateJob())
+
+	// Drop client ip records older than the retention every day
+	s.addJob("pruneIpHistory", job.NewPruneIpHistoryJob())
+
+	// Drop traffic history older than 90 days every day
+	s.addJob("pruneTrafficHistory", job.NewPruneTrafficHistoryJob())
+
+	// Push replicated inbounds to their nodes again every 5 minutes in case a node missed an edit,
+	// add the client traffic of all nodes to the local counters every minute and check their health every 30 seconds
+	if !s.isAgent {
+		s.addJob("replicaSync", job.NewReplicaSyncJob())
+		s.addJob("nodeTraffic", job.NewNodeTrafficJob())
+		s.addJob("nodeHealth", job.NewNodeHealthJob())
+	}
+
+	// Push traffic and server samples to a time-series database if configured
+	isTsdbEnabled, err := s.settingService.GetTsdbEnable()
+	if err == nil && isTsdbEnabled {
+		interval, err := s.settingService.GetTsdbInterval()
+		if err != nil || interval < 10 {
+			interval = 60
+		}
+		spec := fmt.Sprintf("@every %ds", interval)
+		if schedules, err := s.settingService.GetJobSchedules(); err == nil && schedules["tsdbExport"] != "" {
+			spec = schedules["tsdbExport"]
+		}
+		s.addJobSpec("tsdbExport", spec, job.NewTsdbExportJob())
+	}
+
+	// Reset the traffic of inbounds and clients whose monthly reset day passed since their last reset, every day at midnight
+	s.addJob("billingReset", job.NewBillingResetJob())
+
+	// Renew the managed certificates that expire within 30 days, every day at midnight
+	s.addJob("certRenew", job.NewCertRenewJob())
+
+	// Check that the camouflage sites of reality inbounds still speak tls 1.3 and h2, every 30 minutes
+	s.addJob("realityCheck", job.NewRealityCheckJob())
+
+	// Update the geo files from their configured urls every week
+	s.addJob("geoUpdate", job.NewGeoUpdateJob(s.ctx))
+
+	// Restart the managed tor daemon when it stopped answering, every minute
+	s.addJob("torCheck", job.NewTorCheckJob())
+
+	// Have the reachability checker connect to the inbound ports from outside, every 30 minutes
+	s.addJob("reachability", job.NewReachabilityJob())
+
+	// Measure the latency through every outbound and pick the outbounds of balancers, every 5 minutes
+	s.addJob("outboundLatency", job.NewOutboundLatencyJob())
+
 	// Check the inbound traffic every 30 seconds that the traffic exceeds and expires
-	s.cron.AddJob("@every 30s", job.NewCheckInboundJob())
+	s.addJob("checkInbound", job.NewCheckInboundJob())
 
 	// Make a traffic condition every day, 8:30
 	var entry cron.EntryID
@@ -320,9 +534,8 @@ func (s *Server) startTask() {
 			runtime = "@daily"
 		}
 		logger.Infof("Tg notify enabled,run at %s", runtime)
-		_, err = s.cron.AddJob(runtime, job.NewStatsNotifyJob())
+		err = s.addJobSpec("statsNotify", runtime, job.NewStatsNotifyJob())
 		if err != nil {
-			logger.Warning("Add NewStatsNotifyJob error", err)
 			return
 		}
 		// listen for TG bot income messages
@@ -340,6 +553,53 @@ func (s *Server) Start() (err error) {
 		}
 	}()
 
+	logFormat, err := s.settingService.GetLogFormat()
+	if err != nil {
+		return err
+	}
+	logger.SetFormat(logFormat)
+	logFile, err := s.settingService.GetLogFile()
+	if err != nil {
+		return err
+	}
+	err = logger.SetFile(logFile)
+	if err != nil {
+		logger.Warning("open log file failed:", err)
+	}
+	shipping, err := s.settingService.GetLogShipping()
+	if err != nil {
+		return err
+	}
+	facility, err := s.settingService.GetLogSyslogFacility()
+	if err != nil {
+		return err
+	}
+	tag, err := s.settingService.GetLogSyslogTag()
+	if err != nil {
+		return err
+	}
+	err = logger.SetShipping(shipping, facility, tag)
+	if err != nil {
+		logger.Warning("ship logs to", shipping, "failed:", err)
+	}
+	err = s.settingService.ApplyLogLevels()
+	if err != nil {
+		logger.Warning("apply log levels failed:", err)
+	}
+	err = s.settingService.ApplyTracing()
+	if err != nil {
+		logger.Warning("apply tracing failed:", err)
+	}
+	lang, err := s.settingService.GetLanguage()
+	if err != nil {
+		return err
+	}
+	locale.SetLanguage(lang)
+	err = s.settingService.LoadGeoip()
+	if err != nil {
+		logger.Warning("load geoip databases failed:", err)
+	}
+
 	loc, err := s.settingService.GetTimeLocation()
 	if err != nil {
 		return err
@@ -368,25 +628,38 @@ func (s *Server) Start() (err error) {
 	if err != nil {
 		return err
 	}
+	certificateId, err := s.settingService.GetWebCertificateId()
+	if err != nil {
+		return err
+	}
 	listenAddr := net.JoinHostPort(listen, strconv.Itoa(port))
 	listener, err := net.Listen("tcp", listenAddr)
 	if err != nil {
 		return err
 	}
-	if certFile != "" || keyFile != "" {
-		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	isHttps := certificateId > 0 || certFile != "" || keyFile != ""
+	if isHttps {
+		c := &tls.Config{}
+		if certificateId > 0 {
+			// a stored certificate takes the place of the files, it is looked up on every handshake so that renewals apply
+			_, err = s.certificateService.GetKeyPair(certificateId)
+			c.GetCertificate = func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+				return s.certificateService.GetKeyPair(certificateId)
+			}
+		} else {
+			var cert tls.Certificate
+			cert, err = tls.LoadX509KeyPair(certFile, keyFile)
+			c.Certificates = []tls.Certificate{cert}
+		}
 		if err != nil {
 			listener.Close()
 			return err
 		}
-		c := &tls.Config{
-			Certificates: []tls.Certificate{cert},
-		}
 		listener = network.NewAutoHttpsListener(listener)
 		listener = tls.NewListener(listener, c)
 	}
 
-	if certFile != "" || keyFile != "" {
+	if isHttps {
 		logger.Info("web server run https on", listener.Addr())
 	} else {
 		logger.Info("web server run http on", listener.Addr())
@@ -397,6 +670,10 @@ func (s *Server) Start() (err error) {
 
 	s.httpServer = &http.Server{
 		Handler: engine,
+		// requests end with the server, so downloads and uploads they started stop on shutdown
+		BaseContext: func(net.Listener) context.Context {
+			return s.ctx
+		},
 	}
 
 	go func() {
@@ -406,20 +683,30 @@ func (s *Server) Start() (err error) {
 	return nil
 }
 
+// shutdownTimeout is how long Stop waits for the requests in flight to finish
+const shutdownTimeout = time.Second * 10
+
 func (s *Server) Stop() error {
-	s.cancel()
-	s.xrayService.StopXray()
-	if s.cron != nil {
-		s.cron.Stop()
-	}
+	// drain the requests first, their context is cancelled only once they finished or the timeout passed
 	var err1 error
 	var err2 error
 	if s.httpServer != nil {
-		err1 = s.httpServer.Shutdown(s.ctx)
+		ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		err1 = s.httpServer.Shutdown(ctx)
+		cancel()
 	}
 	if s.listener != nil {
 		err2 = s.listener.Close()
 	}
+	s.cancel()
+	s.xrayService.CancelPendingRestart()
+	s.xrayService.StopXray()
+	if s.cron != nil {
+		s.cron.Stop()
+	}
+	job.NewFlushTrafficJob().Run()
+	// last, so the spans of the last requests and the flush are exported
+	tracing.Shutdown()
 	return common.Combine(err1, err2)
 }
 
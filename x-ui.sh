@@ -634,6 +634,7 @@ show_usage() {
     echo -e "x-ui update       - Update x-ui "
     echo -e "x-ui install      - Install x-ui "
     echo -e "x-ui uninstall    - Uninstall x-ui "
+    echo -e "x-ui check        - Check database, xray, ports, certificates, clock and geo files"
     echo "------------------------------------------"
 }
 
@@ -756,6 +757,9 @@ if [[ $# > 0 ]]; then
     "uninstall")
         check_install 0 && uninstall 0
         ;;
+    "check")
+        check_install 0 && shift && /usr/local/x-ui/x-ui check "$@"
+        ;;
     *) show_usage ;;
     esac
 else
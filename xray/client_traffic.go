@@ -9,4 +9,7 @@ type ClientTraffic struct {
 	Down       int64  `json:"down" form:"down"`
 	ExpiryTime int64  `json:"expiryTime" form:"expiryTime"`
 	Total      int64  `json:"total" form:"total"`
+	LastReset  int64  `json:"lastReset" form:"-"`
+	// Notes are the notes of the client from the settings of its inbound
+	Notes string `json:"notes" form:"notes" gorm:"-"`
 }
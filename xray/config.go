@@ -2,6 +2,7 @@ package xray
 
 import (
 	"bytes"
+	"encoding/json"
 	"x-ui/util/json_util"
 )
 
@@ -17,6 +18,7 @@ type Config struct {
 	Stats           json_util.RawMessage `json:"stats"`
 	Reverse         json_util.RawMessage `json:"reverse"`
 	FakeDNS         json_util.RawMessage `json:"fakeDns"`
+	Observatory     json_util.RawMessage `json:"observatory"`
 }
 
 func (c *Config) Equals(other *Config) bool {
@@ -58,5 +60,40 @@ func (c *Config) Equals(other *Config) bool {
 	if !bytes.Equal(c.FakeDNS, other.FakeDNS) {
 		return false
 	}
+	if !bytes.Equal(c.Observatory, other.Observatory) {
+		return false
+	}
 	return true
 }
+
+type LogConfig struct {
+	Access   string `json:"access"`
+	Error    string `json:"error"`
+	LogLevel string `json:"loglevel"`
+}
+
+func (c *Config) GetLogConfig() *LogConfig {
+	logConfig := &LogConfig{}
+	if len(c.LogConfig) > 0 {
+		json.Unmarshal(c.LogConfig, logConfig)
+	}
+	return logConfig
+}
+
+// GetAccessLogPath returns the access log file of the config, empty if access logging is disabled
+func (c *Config) GetAccessLogPath() string {
+	access := c.GetLogConfig().Access
+	if access == "none" {
+		return ""
+	}
+	return access
+}
+
+// GetErrorLogPath returns the error log file of the config, empty if it goes to stdout or is disabled
+func (c *Config) GetErrorLogPath() string {
+	errorLog := c.GetLogConfig().Error
+	if errorLog == "none" {
+		return ""
+	}
+	return errorLog
+}
@@ -7,7 +7,7 @@ import (
 
 type InboundConfig struct {
 	Listen         json_util.RawMessage `json:"listen"` // listen 不能为空字符串
-	Port           int                  `json:"port"`
+	Port           json_util.RawMessage `json:"port"`
 	Protocol       string               `json:"protocol"`
 	Settings       json_util.RawMessage `json:"settings"`
 	StreamSettings json_util.RawMessage `json:"streamSettings"`
@@ -19,7 +19,7 @@ func (c *InboundConfig) Equals(other *InboundConfig) bool {
 	if !bytes.Equal(c.Listen, other.Listen) {
 		return false
 	}
-	if c.Port != other.Port {
+	if !bytes.Equal(c.Port, other.Port) {
 		return false
 	}
 	if c.Protocol != other.Protocol {
@@ -15,6 +15,7 @@ import (
 	"strings"
 	"time"
 	"x-ui/util/common"
+	"x-ui/util/tracing"
 
 	"github.com/Workiva/go-datastructures/queue"
 	statsservice "github.com/xtls/xray-core/app/stats/command"
@@ -44,6 +45,11 @@ func GetGeoipPath() string {
 	return "bin/geoip.dat"
 }
 
+// GetInboundGeoipPath is the geoip file the panel generates for the country allow lists of inbounds
+func GetInboundGeoipPath() string {
+	return "bin/inbound-geoip.dat"
+}
+
 func stopProcess(p *Process) {
 	p.Stop()
 }
@@ -120,25 +126,27 @@ func (p *Process) GetConfig() *Config {
 func (p *process) refreshAPIPort() {
 	for _, inbound := range p.config.InboundConfigs {
 		if inbound.Tag == "api" {
-			p.apiPort = inbound.Port
+			json.Unmarshal(inbound.Port, &p.apiPort)
 			break
 		}
 	}
 }
 
 func (p *process) refreshVersion() {
+	p.version = GetBinaryVersion()
+}
+
+func GetBinaryVersion() string {
 	cmd := exec.Command(GetBinaryPath(), "-version")
 	data, err := cmd.Output()
 	if err != nil {
-		p.version = "Unknown"
-	} else {
-		datas := bytes.Split(data, []byte(" "))
-		if len(datas) <= 1 {
-			p.version = "Unknown"
-		} else {
-			p.version = string(datas[1])
-		}
+		return "Unknown"
+	}
+	datas := bytes.Split(data, []byte(" "))
+	if len(datas) <= 1 {
+		return "Unknown"
 	}
+	return string(datas[1])
 }
 
 func (p *process) Start() (err error) {
@@ -230,7 +238,8 @@ func (p *process) Stop() error {
 	return p.cmd.Process.Kill()
 }
 
-func (p *process) GetTraffic(reset bool) ([]*Traffic, []*ClientTraffic, error) {
+// GetTraffic queries the stats of xray, ctx carries the trace the query is part of
+func (p *process) GetTraffic(ctx context.Context, reset bool) ([]*Traffic, []*ClientTraffic, error) {
 	if p.apiPort == 0 {
 		return nil, nil, common.NewError("xray api port wrong:", p.apiPort)
 	}
@@ -241,12 +250,17 @@ func (p *process) GetTraffic(reset bool) ([]*Traffic, []*ClientTraffic, error) {
 	defer conn.Close()
 
 	client := statsservice.NewStatsServiceClient(conn)
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	ctx, cancel := context.WithTimeout(ctx, time.Second*10)
 	defer cancel()
 	request := &statsservice.QueryStatsRequest{
 		Reset_: reset,
 	}
+	ctx, span := tracing.Start(ctx, "xray QueryStats", tracing.KindClient)
+	span.SetAttribute("rpc.system", "grpc")
+	span.SetAttribute("rpc.service", "xray.app.stats.command.StatsService")
+	span.SetAttribute("rpc.method", "QueryStats")
 	resp, err := client.QueryStats(ctx, request)
+	span.End(err)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -0,0 +1,123 @@
+package xray
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"time"
+	"x-ui/util/common"
+	"x-ui/util/tracing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// The routing service of xray 1.8 and newer adds and removes rules while xray runs. The xray-core module the
+// panel is built with predates these calls, so their requests are encoded here, the way dat files are
+const (
+	addRuleMethod    = "/xray.app.router.command.RoutingService/AddRule"
+	removeRuleMethod = "/xray.app.router.command.RoutingService/RemoveRule"
+	routerConfigType = "xray.app.router.Config"
+
+	// the numbers of the fields in the protos of xray 1.8
+	cidrIpField            protowire.Number = 1  // CIDR.ip
+	cidrPrefixField        protowire.Number = 2  // CIDR.prefix
+	geoipCidrField         protowire.Number = 2  // GeoIP.cidr
+	ruleTargetTagField     protowire.Number = 1  // RoutingRule.tag
+	ruleUserEmailField     protowire.Number = 7  // RoutingRule.user_email
+	ruleSourceGeoipField   protowire.Number = 11 // RoutingRule.source_geoip
+	ruleTagField           protowire.Number = 18 // RoutingRule.rule_tag
+	configRuleField        protowire.Number = 2  // Config.rule
+	typedMessageTypeField  protowire.Number = 1  // TypedMessage.type
+	typedMessageValueField protowire.Number = 2  // TypedMessage.value
+	addRuleConfigField     protowire.Number = 1  // AddRuleRequest.config
+	addRuleAppendField     protowire.Number = 2  // AddRuleRequest.shouldAppend
+	removeRuleTagField     protowire.Number = 1  // RemoveRuleRequest.ruleTag
+)
+
+// rawCodec sends requests that are encoded already and keeps the answers encoded
+type rawCodec struct{}
+
+func (rawCodec) Marshal(v interface{}) ([]byte, error) {
+	return *v.(*[]byte), nil
+}
+
+func (rawCodec) Unmarshal(data []byte, v interface{}) error {
+	*v.(*[]byte) = data
+	return nil
+}
+
+func (rawCodec) Name() string {
+	return "proto"
+}
+
+func appendBytesField(b []byte, num protowire.Number, value []byte) []byte {
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendBytes(b, value)
+}
+
+// sourceRule encodes a rule that sends the connections of the user from the addresses to the outbound
+func sourceRule(ruleTag string, outboundTag string, email string, sources []string) ([]byte, error) {
+	geoip := make([]byte, 0)
+	for _, source := range sources {
+		ip := net.ParseIP(source)
+		if ip == nil {
+			return nil, common.NewError("not an ip address:", source)
+		}
+		if ip4 := ip.To4(); ip4 != nil {
+			ip = ip4
+		}
+		cidr := appendBytesField(nil, cidrIpField, ip)
+		cidr = protowire.AppendTag(cidr, cidrPrefixField, protowire.VarintType)
+		cidr = protowire.AppendVarint(cidr, uint64(len(ip)*8))
+		geoip = appendBytesField(geoip, geoipCidrField, cidr)
+	}
+	rule := appendBytesField(nil, ruleTargetTagField, []byte(outboundTag))
+	rule = appendBytesField(rule, ruleUserEmailField, []byte(email))
+	rule = appendBytesField(rule, ruleSourceGeoipField, geoip)
+	return appendBytesField(rule, ruleTagField, []byte(ruleTag)), nil
+}
+
+func (p *process) invokeRouting(method string, request []byte) error {
+	if p.apiPort == 0 {
+		return common.NewError("xray api port wrong:", p.apiPort)
+	}
+	conn, err := grpc.Dial(fmt.Sprintf("127.0.0.1:%v", p.apiPort), grpc.WithInsecure())
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+	ctx, span := tracing.Start(ctx, "xray "+method, tracing.KindClient)
+	span.SetAttribute("rpc.system", "grpc")
+	span.SetAttribute("rpc.service", "xray.app.router.command.RoutingService")
+	var response []byte
+	err = conn.Invoke(ctx, method, &request, &response, grpc.ForceCodec(rawCodec{}))
+	span.End(err)
+	return err
+}
+
+// AddSourceRule appends a rule tagged ruleTag to the routing of the running xray that sends the connections of
+// the user from the addresses to the outbound. Xray can only append rules, it replaces all of them otherwise.
+// Xray older than 1.8 answers with an unimplemented error
+func (p *process) AddSourceRule(ruleTag string, outboundTag string, email string, sources []string) error {
+	rule, err := sourceRule(ruleTag, outboundTag, email, sources)
+	if err != nil {
+		return err
+	}
+	config := appendBytesField(nil, configRuleField, rule)
+	message := appendBytesField(nil, typedMessageTypeField, []byte(routerConfigType))
+	message = appendBytesField(message, typedMessageValueField, config)
+	request := appendBytesField(nil, addRuleConfigField, message)
+	request = protowire.AppendTag(request, addRuleAppendField, protowire.VarintType)
+	request = protowire.AppendVarint(request, 1)
+	return p.invokeRouting(addRuleMethod, request)
+}
+
+// RemoveRule removes the rule tagged ruleTag from the routing of the running xray
+func (p *process) RemoveRule(ruleTag string) error {
+	request := appendBytesField(nil, removeRuleTagField, []byte(ruleTag))
+	return p.invokeRouting(removeRuleMethod, request)
+}